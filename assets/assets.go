@@ -5,7 +5,9 @@
 package assets
 
 import (
-	_ "embed"
+	"embed"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"runtime"
 )
@@ -13,6 +15,22 @@ import (
 //go:embed html/hello.html
 var HelloHTML string // Embedded HTML page for a simple greeting.
 
+//go:embed css ico js locales tmpl
+var embedded embed.FS
+
+// FS returns the assets in dir, with the layout of this directory, such as
+// tmpl/login.html, css/pico.min.css, and locales/es.json. If dir is empty,
+// the copy embedded in the binary is returned, so the binary runs without
+// the assets on disk. Assets in dir replace all of the embedded assets,
+// not just those in dir.
+func FS(dir string) fs.FS {
+	if dir == "" {
+		return embedded
+	}
+
+	return os.DirFS(dir)
+}
+
 // AssetPath returns the directory of the file that calls this function.
 // It's useful for determining the path context in runtime, especially for
 // locating assets relative to executing code.  Returns an empty string if
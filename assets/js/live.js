@@ -0,0 +1,97 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// live.js adds the rows published by webauth.LiveHandler to the table that
+// follows the #live element. Each cell is filled from the column named by
+// the data-col attribute of its header. New rows are held while paused.
+// The added rows and the held rows are each limited to data-max, dropping
+// the oldest.
+(function () {
+  "use strict";
+
+  const live = document.getElementById("live");
+  if (!live || !window.EventSource) {
+    return;
+  }
+
+  let table = live.nextElementSibling;
+  while (table && table.tagName !== "TABLE") {
+    table = table.nextElementSibling;
+  }
+  if (!table || !table.tBodies.length) {
+    return;
+  }
+
+  const event = live.dataset.event;
+  const filter = (live.dataset.filter || "").toLowerCase();
+  const max = parseInt(live.dataset.max, 10) || 500;
+  const cols = Array.from(table.tHead.rows[0].cells, (th) => th.dataset.col);
+  const toggle = document.getElementById("live-toggle");
+  const status = document.getElementById("live-status");
+
+  const added = [];
+  const held = [];
+  let paused = false;
+
+  function matches(row) {
+    if (!filter) {
+      return true;
+    }
+    return Object.values(row).some((v) => v.toLowerCase().includes(filter));
+  }
+
+  function add(row) {
+    const tr = document.createElement("tr");
+    for (const col of cols) {
+      const td = tr.insertCell();
+      td.textContent = col ? row[col] || "" : "";
+    }
+    table.tBodies[0].prepend(tr);
+
+    added.push(tr);
+    if (added.length > max) {
+      added.shift().remove();
+    }
+  }
+
+  function showStatus() {
+    status.textContent = paused ? held.length + " new" : "";
+  }
+
+  const source = new EventSource("/live?event=" + encodeURIComponent(event));
+
+  source.addEventListener(event, (e) => {
+    const row = JSON.parse(e.data);
+    if (!matches(row)) {
+      return;
+    }
+
+    if (paused) {
+      held.push(row);
+      if (held.length > max) {
+        held.shift();
+      }
+      showStatus();
+      return;
+    }
+
+    add(row);
+  });
+
+  source.addEventListener("error", () => {
+    status.textContent = "Reconnecting";
+  });
+
+  source.addEventListener("open", showStatus);
+
+  toggle.addEventListener("click", () => {
+    paused = !paused;
+    toggle.textContent = paused ? "Resume" : "Pause";
+    if (!paused) {
+      held.splice(0).forEach(add);
+    }
+    showStatus();
+  });
+
+  toggle.hidden = false;
+})();
@@ -0,0 +1,50 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// relative-time.js keeps the text of time elements with a data-timestamp
+// attribute, in Unix seconds, relative to now, such as "5 minutes ago".
+// The strings match those of webutil.TimeAgo.
+(function () {
+  "use strict";
+
+  const units = [
+    ["year", 365 * 24 * 3600],
+    ["month", 30 * 24 * 3600],
+    ["day", 24 * 3600],
+    ["hour", 3600],
+    ["minute", 60],
+  ];
+
+  function timeAgo(ts, now) {
+    let d = now - ts;
+    const future = d < 0;
+    if (future) {
+      d = -d;
+    }
+
+    for (const [name, secs] of units) {
+      const n = Math.floor(d / secs);
+      if (n < 1) {
+        continue;
+      }
+
+      const s = n + " " + name + (n > 1 ? "s" : "");
+      return future ? "in " + s : s + " ago";
+    }
+
+    return "just now";
+  }
+
+  function refresh() {
+    const now = Date.now() / 1000;
+    for (const el of document.querySelectorAll("time[data-timestamp]")) {
+      const ts = parseInt(el.dataset.timestamp, 10);
+      if (!isNaN(ts)) {
+        el.textContent = timeAgo(ts, now);
+      }
+    }
+  }
+
+  refresh();
+  setInterval(refresh, 30 * 1000);
+})();
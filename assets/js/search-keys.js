@@ -0,0 +1,48 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// search-keys.js adds keyboard shortcuts to the admin search: "/" focuses
+// the search box, and the arrow keys move between the result links, which
+// Enter follows.
+(function () {
+  "use strict";
+
+  function links() {
+    return Array.from(document.querySelectorAll("#results a"));
+  }
+
+  document.addEventListener("keydown", function (e) {
+    const box = document.getElementById("q");
+    if (!box || e.altKey || e.ctrlKey || e.metaKey) {
+      return;
+    }
+
+    if (e.key === "/" && document.activeElement !== box) {
+      e.preventDefault();
+      box.focus();
+      box.select();
+      return;
+    }
+
+    if (e.key !== "ArrowDown" && e.key !== "ArrowUp") {
+      return;
+    }
+
+    const all = links();
+    if (all.length === 0) {
+      return;
+    }
+    e.preventDefault();
+
+    let i = all.indexOf(document.activeElement);
+    if (e.key === "ArrowDown") {
+      i = Math.min(i + 1, all.length - 1);
+    } else if (i <= 0) {
+      box.focus();
+      return;
+    } else {
+      i--;
+    }
+    all[i].focus();
+  });
+})();
@@ -0,0 +1,169 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package audit records who did what to whom, from where, and with what
+// result, for review by administrators.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Result is the outcome of an audited action.
+type Result string
+
+const (
+	Success Result = "success"
+	Failure Result = "failure"
+	Denied  Result = "denied" // Denied by a policy, such as a permission.
+)
+
+// ResultOf returns Success if succeeded is true, or Failure.
+func ResultOf(succeeded bool) Result {
+	if succeeded {
+		return Success
+	}
+	return Failure
+}
+
+// Maximum lengths of the fields of an Entry, matching the SQL schema.
+const (
+	MaxActorLen     = 30
+	MaxActionLen    = 30
+	MaxTargetLen    = 255
+	MaxIPLen        = 45
+	MaxUserAgentLen = 255
+	MaxMetadataLen  = 4096
+	MaxRequestIDLen = 64
+	MaxChangesLen   = 65535
+)
+
+// Entry is an audited action.
+type Entry struct {
+	Created   time.Time // Created is set when the entry is recorded.
+	Actor     string    // Actor is the username that acted, if any.
+	Action    string    // Action is what was done, such as "login".
+	Target    string    // Target is what was acted on, such as a username.
+	IP        string    // IP is the address of the client.
+	UserAgent string    // UserAgent is the User-Agent of the client.
+	Result    Result
+	Metadata  Metadata // Metadata holds other details of the action.
+	RequestID string   // RequestID is that of the request of the action.
+	Changes   Changes  // Changes are those of an admin to the Target.
+}
+
+// Metadata holds details of an Entry, which are saved as JSON.
+type Metadata map[string]string
+
+// String returns m as JSON, so that an Entry can be written as CSV.
+func (m Metadata) String() string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// ParseMetadata returns the Metadata of the JSON s, which may be empty.
+func ParseMetadata(s string) (Metadata, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var m Metadata
+	err := json.Unmarshal([]byte(s), &m)
+
+	return m, err
+}
+
+// FromRequest returns an Entry of action with the address and User-Agent
+// of the client of r.
+func FromRequest(r *http.Request, action string) Entry {
+	ip := webutil.ClientIP(r)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return Entry{Action: action, IP: ip, UserAgent: r.UserAgent()}
+}
+
+// truncate returns s limited to n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Truncated returns e with its fields limited to their maximum length.
+func (e Entry) Truncated() Entry {
+	e.Actor = truncate(e.Actor, MaxActorLen)
+	e.Action = truncate(e.Action, MaxActionLen)
+	e.Target = truncate(e.Target, MaxTargetLen)
+	e.IP = truncate(e.IP, MaxIPLen)
+	e.UserAgent = truncate(e.UserAgent, MaxUserAgentLen)
+	e.RequestID = truncate(e.RequestID, MaxRequestIDLen)
+	return e
+}
+
+// ErrMetadataTooLong is returned for an Entry with Metadata too long to
+// save.
+var ErrMetadataTooLong = errors.New("audit metadata too long")
+
+// ErrChangesTooLong is returned for an Entry with Changes too long to
+// save.
+var ErrChangesTooLong = errors.New("audit changes too long")
+
+// Filter selects entries. Empty fields match all entries.
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	Result Result
+	Since  time.Time // Since matches entries created at or after.
+	Until  time.Time // Until matches entries created before.
+	Limit  int       // Limit is the maximum number of entries, if positive.
+	Offset int       // Offset is the number of entries to skip.
+}
+
+// Match returns true if e matches the fields of f, ignoring Limit and
+// Offset.
+func (f Filter) Match(e Entry) bool {
+	return (f.Actor == "" || strings.EqualFold(f.Actor, e.Actor)) &&
+		(f.Action == "" || f.Action == e.Action) &&
+		(f.Target == "" || strings.EqualFold(f.Target, e.Target)) &&
+		(f.Result == "" || f.Result == e.Result) &&
+		(f.Since.IsZero() || !e.Created.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Created.Before(f.Until))
+}
+
+// Store saves and queries audit entries.
+type Store interface {
+	// RecordAudit saves e. Created is set by the store.
+	RecordAudit(e Entry) error
+
+	// AuditEntries returns the entries that match f, newest first, and
+	// the number that match, ignoring Limit and Offset.
+	AuditEntries(f Filter) ([]Entry, int, error)
+}
+
+// Page returns the entries of the page of f, by Offset and Limit.
+func Page(entries []Entry, f Filter) []Entry {
+	if f.Offset >= len(entries) {
+		return nil
+	}
+	entries = entries[max(f.Offset, 0):]
+
+	if f.Limit > 0 && f.Limit < len(entries) {
+		entries = entries[:f.Limit]
+	}
+
+	return entries
+}
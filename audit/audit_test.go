@@ -0,0 +1,95 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package audit_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	e := audit.Entry{Created: now, Actor: "Admin", Action: "login", Target: "bob", Result: audit.Success}
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   bool
+	}{
+		{"empty", audit.Filter{}, true},
+		{"actorCase", audit.Filter{Actor: "admin"}, true},
+		{"action", audit.Filter{Action: "logout"}, false},
+		{"target", audit.Filter{Target: "BOB"}, true},
+		{"result", audit.Filter{Result: audit.Failure}, false},
+		{"since", audit.Filter{Since: now}, true},
+		{"sinceAfter", audit.Filter{Since: now.Add(time.Second)}, false},
+		{"until", audit.Filter{Until: now}, false},
+		{"all", audit.Filter{Actor: "admin", Action: "login", Result: audit.Success, Until: now.Add(time.Hour)}, true},
+	}
+
+	for _, tc := range tests {
+		if got := tc.filter.Match(e); got != tc.want {
+			t.Errorf("%s: Match() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	entries := make([]audit.Entry, 5)
+	for i := range entries {
+		entries[i].Target = string(rune('a' + i))
+	}
+
+	tests := []struct {
+		limit, offset int
+		want          string
+	}{
+		{0, 0, "abcde"},
+		{2, 0, "ab"},
+		{2, 4, "e"},
+		{2, 5, ""},
+		{0, 3, "de"},
+	}
+
+	for _, tc := range tests {
+		var got strings.Builder
+		for _, e := range audit.Page(entries, audit.Filter{Limit: tc.limit, Offset: tc.offset}) {
+			got.WriteString(e.Target)
+		}
+		if got.String() != tc.want {
+			t.Errorf("Page(%d, %d) = %q, want %q", tc.limit, tc.offset, got.String(), tc.want)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	m := audit.Metadata{"rule": "country:CN"}
+
+	got, err := audit.ParseMetadata(m.String())
+	if err != nil {
+		t.Fatalf("ParseMetadata() failed: %v", err)
+	}
+	if got["rule"] != "country:CN" {
+		t.Errorf("ParseMetadata(%q) = %v, want %v", m.String(), got, m)
+	}
+
+	if s := audit.Metadata(nil).String(); s != "" {
+		t.Errorf("empty Metadata String() = %q, want empty", s)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.1:1234"
+	r.Header.Set("User-Agent", strings.Repeat("x", audit.MaxUserAgentLen+1))
+
+	e := audit.FromRequest(r, "login").Truncated()
+	if e.IP != "203.0.113.1" || e.Action != "login" || len(e.UserAgent) != audit.MaxUserAgentLen {
+		t.Errorf("FromRequest() = %+v", e)
+	}
+}
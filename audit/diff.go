@@ -0,0 +1,137 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Change is a field of an entity that was changed, with its values before
+// and after as JSON. Before is empty for an added field, and After is
+// empty for a removed one.
+type Change struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Changes are the changes to an entity by an action, which are saved as
+// JSON.
+type Changes []Change
+
+// String returns c as JSON, so that an Entry can be written as CSV.
+func (c Changes) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// ParseChanges returns the Changes of the JSON s, which may be empty.
+func ParseChanges(s string) (Changes, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var c Changes
+	err := json.Unmarshal([]byte(s), &c)
+
+	return c, err
+}
+
+// ErrNotObject is returned by Diff for a value that is not a JSON object.
+var ErrNotObject = errors.New("audit diff of a value that is not an object")
+
+// Diff returns the changes from before to after, ordered by field. Both
+// are marshaled as JSON objects, such as structs or maps, and nil is an
+// empty object, so Diff(nil, v) is the creation of v and Diff(v, nil) its
+// removal. Nested objects are compared by field, with names joined by a
+// dot, such as "address.city"; other values, such as arrays, as a whole.
+//
+// Every field of before and after is recorded, so they must not hold
+// secrets, such as password hashes.
+func Diff(before, after any) (Changes, error) {
+	b, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(b)+len(a))
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	slices.SortFunc(fields, strings.Compare)
+
+	var changes Changes
+	for _, field := range fields {
+		if b[field] != a[field] {
+			changes = append(changes, Change{Field: field, Before: b[field], After: a[field]})
+		}
+	}
+
+	return changes, nil
+}
+
+// flatten returns the fields of v, as a JSON object, by their dotted names
+// with their values as JSON.
+func flatten(v any) (map[string]string, error) {
+	fields := make(map[string]string)
+	if v == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	switch obj := obj.(type) {
+	case nil:
+		return fields, nil
+	case map[string]any:
+		flattenInto(fields, "", obj)
+		return fields, nil
+	default:
+		return nil, ErrNotObject
+	}
+}
+
+// flattenInto adds the fields of obj to fields, with names after prefix.
+func flattenInto(fields map[string]string, prefix string, obj map[string]any) {
+	for k, v := range obj {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+
+		if nested, ok := v.(map[string]any); ok && len(nested) > 0 {
+			flattenInto(fields, name, nested)
+			continue
+		}
+
+		b, _ := json.Marshal(v)
+		fields[name] = string(b)
+	}
+}
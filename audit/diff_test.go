@@ -0,0 +1,89 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package audit_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bnixon67/webapp/audit"
+)
+
+type address struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type person struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age"`
+	Tags    []string `json:"tags"`
+	Address address  `json:"address"`
+}
+
+func TestDiff(t *testing.T) {
+	alice := person{Name: "alice", Age: 30, Tags: []string{"a"}, Address: address{City: "Austin"}}
+	moved := alice
+	moved.Age, moved.Tags, moved.Address = 31, []string{"a", "b"}, address{City: "Boston", Zip: "02101"}
+
+	tests := []struct {
+		name          string
+		before, after any
+		want          audit.Changes
+	}{
+		{
+			name: "same", before: alice, after: alice,
+		},
+		{
+			name: "changed", before: alice, after: moved,
+			want: audit.Changes{
+				{Field: "address.city", Before: `"Austin"`, After: `"Boston"`},
+				{Field: "address.zip", After: `"02101"`},
+				{Field: "age", Before: "30", After: "31"},
+				{Field: "tags", Before: `["a"]`, After: `["a","b"]`},
+			},
+		},
+		{
+			name: "created", before: nil, after: map[string]bool{"disabled": true},
+			want: audit.Changes{{Field: "disabled", After: "true"}},
+		},
+		{
+			name: "removed", before: map[string]int{"canary": 5}, after: (*person)(nil),
+			want: audit.Changes{{Field: "canary", Before: "5"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := audit.Diff(tc.before, tc.after)
+			if err != nil {
+				t.Fatalf("Diff() failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := audit.Diff("alice", nil); !errors.Is(err, audit.ErrNotObject) {
+		t.Errorf("Diff(string) error = %v, want %v", err, audit.ErrNotObject)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	c := audit.Changes{{Field: "disabled", Before: "false", After: "true"}}
+
+	got, err := audit.ParseChanges(c.String())
+	if err != nil || !reflect.DeepEqual(got, c) {
+		t.Errorf("ParseChanges(%q) = %+v, %v, want %+v", c.String(), got, err, c)
+	}
+
+	if got, err := audit.ParseChanges(""); got != nil || err != nil {
+		t.Errorf(`ParseChanges("") = %+v, %v, want nil`, got, err)
+	}
+	if s := audit.Changes(nil).String(); s != "" {
+		t.Errorf("String() = %q, want empty", s)
+	}
+}
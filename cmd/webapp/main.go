@@ -8,9 +8,10 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
-	"net/http"
 	"os"
 
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/i18n"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/weblog"
 	"github.com/bnixon67/webapp/webutil"
@@ -60,14 +61,34 @@ func main() {
 	// Show config in log.
 	slog.Info("using config", slog.Any("config", cfg))
 
+	// Validate the time zones of pages.
+	tz, err := webutil.NewTimeZones(cfg.App.TimeZone, cfg.App.TimeZones)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error in config:", err)
+		os.Exit(ExitConfig)
+	}
+
 	// Define custom template functions.
 	funcMap := template.FuncMap{
-		"ToTimeZone": webutil.ToTimeZone,
-		"Join":       webutil.Join,
+		"ToTimeZone":   tz.ToTimeZone,
+		"LocalTime":    tz.LocalTime,
+		"RelativeTime": tz.RelativeTime,
+		"Join":         webutil.Join,
+		"CSRFField":    webutil.CSRFField,
+		"NonceAttr":    webutil.NonceAttr,
+		"AssetURL":     staticHandler(cfg.App).URL,
+		"T":            i18n.T,
 	}
 
-	// Parse templates.
-	tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern, funcMap)
+	// Parse templates, the embedded ones unless a pattern is in config.
+	var tmpl *template.Template
+	if cfg.App.TmplPattern != "" {
+		tmpl, err = webutil.TemplatesWithDelims(cfg.App.TmplPattern, funcMap,
+			cfg.App.TmplLeftDelim, cfg.App.TmplRightDelim)
+	} else {
+		tmpl, err = webutil.TemplatesFS(assets.FS(cfg.App.AssetsDir), "tmpl/*.html", funcMap,
+			cfg.App.TmplLeftDelim, cfg.App.TmplRightDelim)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error initializing templates:", err)
 		os.Exit(ExitTemplate)
@@ -75,16 +96,17 @@ func main() {
 
 	// Create the web app.
 	app, err := webapp.New(
-		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl))
+		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl),
+		webapp.WithTimeZones(tz))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error creating new handler:", err)
 		os.Exit(ExitHandler)
 	}
 
-	// Create new ServeMux for HTTP requests and add routes and middleware.
-	mux := http.NewServeMux()
-	AddRoutes(mux, app)
-	handler := AddMiddleware(mux)
+	// Create new Router for HTTP requests and add routes and middleware.
+	router := webapp.NewRouter()
+	AddRoutes(router, app)
+	handler := AddMiddleware(router)
 
 	// Create the web server.
 	srv, err := cfg.Server.Create(handler)
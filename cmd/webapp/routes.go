@@ -5,37 +5,46 @@ package main
 
 import (
 	"net/http"
-	"path/filepath"
 
 	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
 )
 
-func AddRoutes(mux *http.ServeMux, app *webapp.WebApp) {
-
-	// Get directory for assets, using a default if not specified in config.
-	if app.Config.App.AssetsDir == "" {
-		app.Config.App.AssetsDir = assets.AssetPath()
-	}
-	assetsDir := app.Config.App.AssetsDir
-
-	cssFile := filepath.Join(assetsDir, "css", "pico.min.css")
-	icoFile := filepath.Join(assetsDir, "ico", "webapp.ico")
-
-	mux.HandleFunc("GET /pico.min.css", webhandler.FileHandler(cssFile))
-	mux.HandleFunc("GET /favicon.ico", webhandler.FileHandler(icoFile))
-	mux.HandleFunc("GET /hello", app.HelloTextHandlerGet)
-	mux.HandleFunc("GET /hellohtml", app.HelloHTMLHandlerGet)
-	mux.HandleFunc("GET /build", app.BuildHandlerGet)
-	mux.HandleFunc("GET /headers", app.HeadersHandlerGet)
-	mux.HandleFunc("GET /remote", webhandler.RemoteGetHandler)
-	mux.HandleFunc("GET /request", webhandler.RequestGetHandler)
-	mux.HandleFunc("GET /", app.RootHandlerGet)
+func AddRoutes(router *webapp.Router, app *webapp.WebApp) {
+
+	// Serve the embedded assets, unless overridden in config.
+	static := staticHandler(app.Config.App)
+
+	get := []string{http.MethodGet}
+
+	router.Add(
+		webapp.Route{Path: "/pico.min.css", Methods: get, Handler: static.File("css/pico.min.css")},
+		webapp.Route{Path: "/favicon.ico", Methods: get, Handler: static.File("ico/webapp.ico")},
+		webapp.Route{Path: staticPrefix, Methods: get, Handler: static},
+		webapp.Route{Path: "/hello", Methods: get, Handler: http.HandlerFunc(app.HelloTextHandlerGet)},
+		webapp.Route{Path: "/hellohtml", Methods: get, Handler: http.HandlerFunc(app.HelloHTMLHandlerGet)},
+		webapp.Route{Path: "/build", Methods: get, Handler: http.HandlerFunc(app.BuildHandlerGet)},
+		webapp.Route{Path: "/headers", Methods: get, Handler: http.HandlerFunc(app.HeadersHandlerGet)},
+		webapp.Route{Path: "/remote", Methods: get, Handler: http.HandlerFunc(webhandler.RemoteGetHandler)},
+		webapp.Route{Path: "/request", Methods: get, Handler: http.HandlerFunc(webhandler.RequestGetHandler)},
+		webapp.Route{Path: "/", Methods: get, Handler: http.HandlerFunc(app.RootHandlerGet)},
+	)
+}
+
+// staticPrefix is the path of the fingerprinted URLs of the assets.
+const staticPrefix = "/static/"
+
+// staticHandler returns the handler of the assets, which are embedded
+// unless cfg has an AssetsDir.
+func staticHandler(cfg webapp.AppConfig) *webutil.StaticHandler {
+	return webutil.NewStaticHandler(assets.FS(cfg.AssetsDir), staticPrefix)
 }
 
 func AddMiddleware(h http.Handler) http.Handler {
 	// Functions are executed in reverse, so last added is called first.
+	h = webhandler.Recover(h)
 	h = webhandler.LogRequest(h)
 	h = webhandler.MiddlewareLogger(h)
 	h = webhandler.NewRequestIDMiddleware(h)
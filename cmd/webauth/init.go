@@ -2,35 +2,82 @@ package main
 
 import (
 	"html/template"
+	"io/fs"
 
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/weblog"
 	"github.com/bnixon67/webapp/webutil"
 )
 
-// Init initializes logging, templates, and database.
-func Init(cfg webauth.Config) (*template.Template, *webauth.AuthDB, error) {
+// Init initializes logging, time zones, templates, and database.
+func Init(cfg webauth.Config) (*template.Template, *webutil.TimeZones, *webauth.AuthDB, error) {
 	// Initialize logging.
 	err := weblog.Init(cfg.Log)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	// Validate the time zones of pages.
+	tz, err := webutil.NewTimeZones(cfg.App.TimeZone, cfg.App.TimeZones)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Initialize templates with custom functions.
-	tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern,
-		template.FuncMap{
-			"ToTimeZone": webutil.ToTimeZone,
-			"Join":       webutil.Join,
-		})
+	funcMap := template.FuncMap{
+		"ToTimeZone":   tz.ToTimeZone,
+		"LocalTime":    tz.LocalTime,
+		"RelativeTime": tz.RelativeTime,
+		"Join":         webutil.Join,
+		"CSRFField":    webutil.CSRFField,
+		"NonceAttr":    webutil.NonceAttr,
+		"AssetURL":     staticHandler(cfg.App).URL,
+		"T":            i18n.T,
+	}
+	tmpl, err := templates(cfg.App, funcMap)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// Initialize db
-	db, err := webauth.InitDB(cfg.SQL.DriverName, cfg.SQL.DataSourceName)
+	db, err := webauth.OpenDB(cfg.SQL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return tmpl, tz, db, nil
+}
+
+// templates parses the templates matching the TmplPattern of cfg or, if
+// it is empty, those of the assets, which are embedded unless cfg has an
+// AssetsDir.
+func templates(cfg webapp.AppConfig, funcMap template.FuncMap) (*template.Template, error) {
+	if cfg.TmplPattern != "" {
+		return webutil.TemplatesWithDelims(cfg.TmplPattern, funcMap, cfg.TmplLeftDelim, cfg.TmplRightDelim)
+	}
+
+	return webutil.TemplatesFS(assets.FS(cfg.AssetsDir), "tmpl/*.html", funcMap, cfg.TmplLeftDelim, cfg.TmplRightDelim)
+}
+
+// loadCatalog returns the translations of the locales of the assets, which
+// are embedded unless cfg has an AssetsDir.
+func loadCatalog(cfg webapp.AppConfig) (*i18n.Catalog, error) {
+	locales, err := fs.Sub(assets.FS(cfg.AssetsDir), "locales")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return tmpl, db, nil
+	return i18n.Load(locales, i18n.DefaultLanguage)
+}
+
+// staticPrefix is the path of the fingerprinted URLs of the assets.
+const staticPrefix = "/static/"
+
+// staticHandler returns the handler of the assets, which are embedded
+// unless cfg has an AssetsDir.
+func staticHandler(cfg webapp.AppConfig) *webutil.StaticHandler {
+	return webutil.NewStaticHandler(assets.FS(cfg.AssetsDir), staticPrefix)
 }
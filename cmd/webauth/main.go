@@ -5,16 +5,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
 	"os"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
-	"github.com/bnixon67/webapp/email"
+	"github.com/bnixon67/webapp/notify"
+	"github.com/bnixon67/webapp/watchdog"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/websse"
 )
 
 const (
@@ -23,35 +28,49 @@ const (
 	ExitInit
 	ExitApp
 	ExitServer
-	ExitEmail
+	ExitNotify
 )
 
-// SendStartingEmail sends an email indicating the server is starting.
-func SendStartingEmail(to, from string, cfg email.SMTPConfig) error {
+// NotifyStarting sends a notification indicating the server is starting.
+func NotifyStarting(n notify.Notifier) error {
 	hostName, err := os.Hostname()
 	if err != nil {
 		return err
 	}
-	subj := "starting webauth"
-	body := "starting webauth on" + hostName
 
-	err = cfg.SendMessage(from, []string{to}, subj, body)
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	return nil
+	return n.Notify(ctx, notify.Message{
+		Kind:    notify.KindStartup,
+		Subject: "starting webauth",
+		Body:    "starting webauth on " + hostName,
+	})
 }
 
 func main() {
+	routes := flag.Bool("routes", false, "print the routes as JSON and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-routes] [config file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// Check for command line argument with config file.
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "usage: %s [config file]\n", os.Args[0])
+	if flag.NArg() != 1 {
+		flag.Usage()
 		os.Exit(ExitUsage)
 	}
 
 	// Read config.
-	cfg, err := webauth.LoadConfigFromJSON(os.Args[1])
+	cfg, err := webauth.LoadConfigFromJSON(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitConfig)
+	}
+
+	// Set the first-boot admin from the environment.
+	cfg.Bootstrap, err = cfg.Bootstrap.WithEnv(os.Getenv)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(ExitConfig)
@@ -68,8 +87,20 @@ func main() {
 		os.Exit(ExitConfig)
 	}
 
-	// Initialize logging, templates, database.
-	tmpl, db, err := Init(*cfg)
+	if *routes {
+		exitCode := PrintRoutes(os.Stdout, *cfg)
+		os.Exit(exitCode)
+	}
+
+	// Initialize logging, time zones, templates, database.
+	tmpl, tz, db, err := Init(*cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitInit)
+	}
+
+	// Load the translations of pages and emails.
+	catalog, err := loadCatalog(cfg.App)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(ExitInit)
@@ -77,20 +108,32 @@ func main() {
 
 	slog.Info("config", "cfg", cfg)
 
+	// Create the server for live updates of the admin pages.
+	live := websse.NewServer()
+	live.Run()
+
 	// Create the app.
 	app, err := webauth.NewApp(
 		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl),
+		webapp.WithTimeZones(tz),
 		webauth.WithConfig(*cfg), webauth.WithDB(db),
+		webauth.WithLive(live), webauth.WithCatalog(catalog),
 	)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to create app:", err)
 		os.Exit(ExitApp)
 	}
 
+	// Create the admin of a new deployment, if configured.
+	if _, err := app.Bootstrap(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to bootstrap:", err)
+		os.Exit(ExitApp)
+	}
+
 	// Create new ServeMux for HTTP requests and add routes and middleware.
-	mux := http.NewServeMux()
+	mux := webhandler.NewMux()
 	AddRoutes(mux, app)
-	handler := AddMiddleware(mux)
+	handler := AddMiddleware(mux, app)
 
 	// Create the web server.
 	srv, err := cfg.Server.Create(handler)
@@ -99,15 +142,55 @@ func main() {
 		os.Exit(ExitServer)
 	}
 
-	// Send starting email to confirm SMTP configuration is valid.
-	err = SendStartingEmail("bnixon67@gmail.com", cfg.EmailFrom, cfg.SMTP)
+	// Send starting notification to confirm the sinks are valid.
+	err = NotifyStarting(app.Notifier)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(ExitEmail)
+		os.Exit(ExitNotify)
 	}
 
-	// Create a new context.
-	ctx := context.Background()
+	// Create a new context, which is canceled on shutdown to stop the
+	// background tasks.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// End the live streams, so their connections can drain, and then
+	// stop the background tasks, leave the instance registry, and close
+	// the database.
+	srv.HTTPServer.RegisterOnShutdown(live.Close)
+	srv.OnShutdown(func(context.Context) error {
+		cancel()
+		return nil
+	})
+	srv.OnShutdown(app.Deregister)
+	srv.OnShutdown(func(context.Context) error {
+		return db.Close()
+	})
+	srv.OnShutdown(func(context.Context) error {
+		return app.Redis.Close()
+	})
+
+	// Warn if goroutines or open files appear to leak.
+	wd := watchdog.New(
+		watchdog.WithGauge("goroutines", watchdog.Goroutines, 1000),
+		watchdog.WithGauge("fds", watchdog.OpenFDs, 1000),
+	)
+	go wd.Run(ctx)
+
+	// Record heartbeats in the instance registry to elect the leader.
+	go app.RunRegistry(ctx, webauth.DefaultHeartbeatInterval)
+
+	// Purge deleted accounts and expired data, and refresh reports.
+	go app.RunMaintenance(ctx, time.Hour)
+
+	// Publish scheduled announcements when they are due.
+	go app.RunAnnouncements(ctx, webauth.DefaultAnnouncementInterval)
+
+	// Add new events to the search index, if enabled.
+	go app.RunSearchIndexer(ctx)
+
+	// Relay live messages between instances through Redis, if enabled.
+	go app.RunBroker(ctx)
 
 	// Start the web server.
 	err = srv.Run(ctx)
@@ -117,3 +200,25 @@ func main() {
 		os.Exit(ExitServer)
 	}
 }
+
+// PrintRoutes writes the route inventory for cfg to w as JSON and returns
+// the exit code. The app is created without a database, so the inventory
+// can be generated for a security review without a running server.
+func PrintRoutes(w io.Writer, cfg webauth.Config) int {
+	app, err := webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to create app:", err)
+		return ExitApp
+	}
+
+	mux := webhandler.NewMux()
+	AddRoutes(mux, app)
+
+	err = webhandler.WriteRoutes(w, app.RouteInventory(mux))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitApp
+	}
+
+	return 0
+}
@@ -2,50 +2,148 @@ package main
 
 import (
 	"net/http"
-	"path/filepath"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webhealth"
+	"github.com/bnixon67/webapp/webutil"
 )
 
-func AddRoutes(mux *http.ServeMux, app *webauth.AuthApp) {
-	assetDir := assets.AssetPath()
-	cssFile := filepath.Join(assetDir, "css", "pico.min.css")
-	icoFile := filepath.Join(assetDir, "ico", "favicon.ico")
+func AddRoutes(mux *webhandler.Mux, app *webauth.AuthApp) {
+	// Serve the embedded assets, unless overridden in config.
+	static := staticHandler(app.Cfg.App)
+	file := static.File
+
+	// Declare what handlers check themselves for the route inventory.
+	get := webhandler.RouteMethods(http.MethodGet)
+	getPost := webhandler.RouteMethods(http.MethodGet, http.MethodPost)
+	login := webhandler.RouteLogin()
+	cors := webhandler.RouteCORS(app.CORS)
+	perm := func(p webauth.Permission) webhandler.RouteOption {
+		return webhandler.RoutePermissions(string(p))
+	}
+
+	// Event streams stay open, so they have no deadline.
+	stream := webhandler.RouteTimeout(webhandler.NoTimeout)
+
+	// Declare the titles and parents of pages for breadcrumbs and menus.
+	nav := func(title, parent string) webhandler.RouteOption {
+		return func(r *webhandler.Route) {
+			webhandler.RouteTitle(title)(r)
+			webhandler.RouteParent(parent)(r)
+		}
+	}
 
 	mux.Handle("/",
 		http.RedirectHandler("/user", http.StatusFound))
-	mux.HandleFunc("/events", app.EventsHandler)
-	mux.HandleFunc("/eventscsv", app.EventsCSVHandler)
-	mux.HandleFunc("/favicon.ico", webhandler.FileHandler(icoFile))
-	mux.HandleFunc("/forgot", app.ForgotHandler)
+	mux.HandleFunc("/account/delete", app.AccountDeleteHandler, getPost, login, nav("Delete Account", "/user"))
+	mux.HandleFunc("GET /account/export", app.AccountExportHandler, login)
+	mux.HandleFunc("/admin/search", app.AdminSearchHandler, get, perm(webauth.PermViewUsers), nav("Search", ""))
+	mux.HandleFunc("/announcements", app.AnnouncementsHandler, getPost, perm(webauth.PermManageAnnouncements), nav("Announcements", ""))
+	mux.HandleFunc("GET /announcements/live", app.AnnouncementStreamHandler, cors, stream)
+	mux.HandleFunc("/audit", app.AuditHandler, get, perm(webauth.PermViewAudit), nav("Audit Log", ""))
+	mux.HandleFunc("/auditcsv", app.AuditCSVHandler, get, perm(webauth.PermViewAudit))
+	mux.HandleFunc("/audit/history", app.AuditHistoryHandler, get, perm(webauth.PermViewAudit))
+	mux.HandleFunc("/events", app.EventsHandler, get, perm(webauth.PermViewEvents), nav("Events", ""))
+	mux.HandleFunc("/eventscsv", app.EventsCSVHandler, get, perm(webauth.PermViewEvents))
+	mux.HandleFunc("/favicon.ico", file("ico/favicon.ico"))
+	mux.HandleFunc("/forgot", app.ForgotHandler, getPost)
+	mux.Handle("/healthz", webhealth.Handler(app.LiveChecks), webhandler.RouteMethods(http.MethodGet, http.MethodHead))
 	mux.HandleFunc("GET /confirm", app.ConfirmHandlerGet)
+	mux.Handle("POST "+webauth.CSPReportPath,
+		webhandler.RateLimit(http.HandlerFunc(app.CSPReportHandler), app.CSPReportQuota),
+		webhandler.RouteRateLimit(app.CSPReportRateLimit()))
+	mux.HandleFunc("GET /csp-reports", app.CSPReportsHandler, perm(webauth.PermViewCSPReports), nav("CSP Reports", ""))
 	mux.HandleFunc("GET /confirmed", app.ConfirmedHandlerGet)
 	mux.HandleFunc("GET /confirm_request", app.ConfirmRequestHandlerGet)
 	mux.HandleFunc("GET /confirm_request_sent", app.ConfirmRequestSentHandlerGet)
+	mux.HandleFunc("GET /confirm/resend", app.ConfirmResendHandlerGet)
+	mux.HandleFunc("GET /instances", app.InstancesHandler, perm(webauth.PermViewInstances), nav("Instances", ""))
 	mux.HandleFunc("GET /login", app.LoginGetHandler)
-	mux.HandleFunc("GET /user", app.UserGetHandler)
-	mux.HandleFunc("/logout", app.LogoutHandler)
+	mux.HandleFunc("GET /user", app.UserGetHandler, login, nav("Account", ""))
+	mux.HandleFunc("GET /live", app.LiveHandler, login, cors, stream)
+	mux.HandleFunc("/live.js", file("js/live.js"))
+	mux.HandleFunc("/logout", app.LogoutHandler, get)
+	mux.HandleFunc("/magic", app.MagicHandler, getPost)
 	mux.HandleFunc("POST /confirm", app.ConfirmHandlerPost)
 	mux.HandleFunc("POST /confirm_request", app.ConfirmRequestHandlerPost)
+	mux.HandleFunc("POST /confirm/resend", app.ConfirmResendHandlerPost)
 	mux.HandleFunc("POST /login", app.LoginPostHandler)
-	mux.HandleFunc("/register", app.RegisterHandler)
-	mux.HandleFunc("/reset", app.ResetHandler)
-	mux.HandleFunc("/users", app.UsersHandler)
-	mux.HandleFunc("/userscsv", app.UsersCSVHandler)
-	mux.HandleFunc("/pico.min.css", webhandler.FileHandler(cssFile))
+	mux.HandleFunc("/oauth/login", app.OAuthLoginHandler, get)
+	mux.HandleFunc("/oauth/callback", app.OAuthCallbackHandler, get)
+	mux.HandleFunc("/profile", app.ProfileHandler, getPost, login, nav("Profile", "/user"))
+	mux.HandleFunc("GET /ratelimits", app.RateLimitsHandler, perm(webauth.PermViewRateLimits), nav("Rate Limits", ""))
+	mux.HandleFunc("/relative-time.js", file("js/relative-time.js"))
+	mux.HandleFunc("/search-keys.js", file("js/search-keys.js"))
+	mux.HandleFunc("/reports", app.ReportsHandler, get, perm(webauth.PermViewReports), nav("Reports", ""))
+	mux.HandleFunc("/reportscsv", app.ReportsCSVHandler, get, perm(webauth.PermViewReports))
+	mux.Handle("/readyz", webhealth.Handler(app.Checks), webhandler.RouteMethods(http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/register", app.RegisterHandler, getPost)
+	mux.HandleFunc("/reset", app.ResetHandler, getPost)
+	mux.HandleFunc("/sessions", app.SessionsHandler, get, login, nav("Sessions", "/user"))
+	mux.HandleFunc("/tokens", app.TokensHandler, getPost, login, nav("API Tokens", "/user"))
+	mux.HandleFunc("POST "+webauth.APILoginPath, app.APILoginHandler, cors)
+	mux.HandleFunc("POST "+webauth.APIRefreshPath, app.APIRefreshHandler, cors)
+	mux.HandleFunc("GET "+webauth.APIPrefix+"/users", app.APIUsersHandler, login, cors)
+	mux.HandleFunc("GET "+webauth.APIPrefix+"/events", app.APIEventsHandler, perm(webauth.PermViewEvents), cors)
+	mux.HandleFunc(webauth.APIPrefix+"/routes", app.APIRoutesHandler, getPost, perm(webauth.PermManageRoutes), cors)
+	mux.Handle("GET /api/token",
+		webhandler.BearerAuth(http.HandlerFunc(app.TokenInfoHandler), app.APITokenBearer),
+		login)
+	mux.HandleFunc("/status", app.StatusHandler, get, nav("Status", ""))
+	mux.HandleFunc("POST /status/incidents", app.StatusIncidentHandler, perm(webauth.PermManageIncidents))
+	mux.HandleFunc(webauth.UnsubscribePath, app.UnsubscribeHandler, getPost)
+	mux.HandleFunc("POST /webhook/bounce/{provider}", app.BounceWebhookHandler)
+	mux.HandleFunc("/email_prefs", app.EmailPrefsHandler, getPost, login, nav("Email Preferences", "/user"))
+	mux.HandleFunc("/username", app.UsernameHandler, getPost, login, nav("Username", "/user"))
+	mux.HandleFunc("/users", app.UsersHandler, get, perm(webauth.PermViewUsers), nav("Users", ""))
+	mux.HandleFunc("POST /users/bulk", app.UsersBulkHandler, perm(webauth.PermManageUsers))
+	mux.HandleFunc("POST /users/rename", app.RenameUserHandler, perm(webauth.PermManageUsers))
+	mux.HandleFunc("/userscsv", app.UsersCSVHandler, get, perm(webauth.PermViewUsers))
+	mux.HandleFunc("/waitlist", app.WaitlistHandler, getPost, perm(webauth.PermManageUsers), nav("Waitlist", "/users"))
+	mux.HandleFunc("POST /views/{table}", app.SavedViewHandler, login)
+	mux.HandleFunc("/pico.min.css", file("css/pico.min.css"))
+	mux.Handle("GET "+staticPrefix, static)
+
+	// Add the Markdown pages if enabled in config.
+	if app.Pages != nil {
+		app.Pages.AddRoutes(mux, app.MarkdownPage)
+	}
+
+	// Add pprof and expvar handlers if enabled in config.
+	app.AddDebugRoutes(mux)
 
 	// https://www.w3.org/TR/change-password-url/
 	mux.Handle("/.well-known/change-password",
 		http.RedirectHandler("/forgot", http.StatusFound))
+
+	// Serve the assets of the status page if the database schema does
+	// not match.
+	app.SchemaExempt = append(app.SchemaExempt, "/favicon.ico", "/pico.min.css", staticPrefix)
+
+	// Let admins disable or canary routes at runtime.
+	app.ManageRoutes(mux)
 }
 
-func AddMiddleware(h http.Handler) http.Handler {
-	h = webhandler.AddSecurityHeaders(h)
+func AddMiddleware(mux *webhandler.Mux, app *webauth.AuthApp) http.Handler {
+	var h http.Handler = mux
+
+	h = app.SessionValues(h)
+	h = app.RefreshSession(h)
+	h = webhandler.Deadline(h, mux.TimeoutFor(app.RequestTimeout))
+	h = app.RateLimit(h)
+	h = app.Screen(h)
+	h = app.CSRF(h)
+	h = app.VerifySignature(h)
+	h = app.ReissueSignedCookies(h)
+	h = webutil.WithErrorPage(h, app.ErrorPage)
+	h = webhandler.RecoverWithResponse(h, app.PanicPage, app.RecordPanic)
+	h = app.SecurityHeaders(h)
+	h = app.Catalog.Middleware(h)
 	h = webhandler.LogRequest(h)
 	h = webhandler.MiddlewareLogger(h)
-	h = webhandler.NewRequestIDMiddleware(h)
+	h = webhandler.NewUUIDRequestIDMiddleware(h)
+	h = app.RealIP(h)
 
 	return h
 }
@@ -0,0 +1,196 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webtest"
+	"github.com/bnixon67/webapp/webutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// handlerForTest returns the routes and middleware of the server for an
+// app with the test config and a MemStore with the user "test".
+func handlerForTest(t *testing.T) (http.Handler, *webauth.AuthApp) {
+	cfg, err := webauth.LoadConfigFromJSON("../../webauth/testdata/test_config.json")
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	tz, err := webutil.NewTimeZones(cfg.App.TimeZone, cfg.App.TimeZones)
+	if err != nil {
+		t.Fatalf("failed to create time zones: %v", err)
+	}
+	tmpl, err := webutil.TemplatesWithFuncs("../../assets/tmpl/*.html",
+		template.FuncMap{
+			"ToTimeZone":   tz.ToTimeZone,
+			"LocalTime":    tz.LocalTime,
+			"RelativeTime": tz.RelativeTime,
+			"Join":         webutil.Join,
+			"CSRFField":    webutil.CSRFField,
+			"NonceAttr":    webutil.NonceAttr,
+			"T":            i18n.T,
+		})
+	if err != nil {
+		t.Fatalf("failed to init templates: %v", err)
+	}
+
+	store := webauth.NewMemStore()
+	if err := store.AddUser(webauth.User{Username: "test", Email: "test@email"}, ""); err != nil {
+		t.Fatalf("failed to add user: %v", err)
+	}
+
+	app, err := webauth.NewApp(
+		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl),
+		webapp.WithTimeZones(tz),
+		webauth.WithConfig(*cfg), webauth.WithDB(store),
+	)
+	if err != nil {
+		t.Fatalf("failed to create app: %v", err)
+	}
+
+	mux := webhandler.NewMux()
+	AddRoutes(mux, app)
+
+	return AddMiddleware(mux, app), app
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	h, app := handlerForTest(t)
+
+	unsubscribe := url.Values{
+		"u": {"test"}, "c": {string(webauth.EmailReminder)},
+		"s": {app.Sign("unsubscribe", "test", string(webauth.EmailReminder))},
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		// Forms posted without a CSRF token are rejected.
+		{"login", "/login", "username=test&password=password", http.StatusForbidden},
+		// Email clients post RFC 8058 one-click unsubscribes without a
+		// token, which are allowed since the link is signed.
+		{"unsubscribe", "/unsubscribe?" + unsubscribe.Encode(), "List-Unsubscribe=One-Click", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+
+	allowed, err := app.EmailAllowed("test", webauth.EmailReminder)
+	if err != nil || allowed {
+		t.Errorf("EmailAllowed() = %t, %v, want false after unsubscribe", allowed, err)
+	}
+}
+
+func TestHeaderConformance(t *testing.T) {
+	h, app := handlerForTest(t)
+
+	hash, err := webauth.BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if err := app.DB.SetHashedPassword("test", hash); err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+
+	// login returns a login request with the CSRF cookie and token of a
+	// login page.
+	login := func() *http.Request {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+		var csrf *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == webhandler.CSRFCookieName {
+				csrf = c
+			}
+		}
+		if csrf == nil {
+			t.Fatal("login page has no CSRF cookie")
+		}
+
+		body := url.Values{"username": {"test"}, "password": {"password"}, webutil.CSRFFieldName: {csrf.Value}}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(csrf)
+		return r
+	}
+
+	webtest.HeaderSuite{
+		Handler:  h,
+		Dynamic:  []string{"/login", "/register", "/forgot"},
+		Static:   []string{"/favicon.ico", "/pico.min.css", "/live.js"},
+		Requests: []func() *http.Request{login},
+	}.Run(t)
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	tz, err := webutil.NewTimeZones("", nil)
+	if err != nil {
+		t.Fatalf("failed to create time zones: %v", err)
+	}
+
+	// Without a pattern, the embedded templates are parsed.
+	tmpl, err := templates(webapp.AppConfig{}, template.FuncMap{
+		"ToTimeZone":   tz.ToTimeZone,
+		"LocalTime":    tz.LocalTime,
+		"RelativeTime": tz.RelativeTime,
+		"Join":         webutil.Join,
+		"CSRFField":    webutil.CSRFField,
+		"NonceAttr":    webutil.NonceAttr,
+		"T":            i18n.T,
+	})
+	if err != nil {
+		t.Fatalf("templates() failed: %v", err)
+	}
+	if tmpl.Lookup("login.html") == nil {
+		t.Error("embedded templates have no login.html")
+	}
+
+	url, err := staticHandler(webapp.AppConfig{}).URL("css/pico.min.css")
+	if err != nil {
+		t.Fatalf("URL() failed: %v", err)
+	}
+
+	h, _ := handlerForTest(t)
+	for _, target := range []string{"/pico.min.css", "/favicon.ico", "/live.js", url} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("GET %s = %d with %d bytes, want embedded asset", target, w.Code, w.Body.Len())
+		}
+	}
+
+	catalog, err := loadCatalog(webapp.AppConfig{})
+	if err != nil {
+		t.Fatalf("loadCatalog() failed: %v", err)
+	}
+	if got := catalog.Printer("es").T(webauth.MsgLoginFailed); got == webauth.MsgLoginFailed {
+		t.Errorf("embedded catalog has no Spanish for %q", webauth.MsgLoginFailed)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Command webauthctl performs maintenance tasks on the webauth database
+// and config.
+//
+// Usage:
+//
+//	webauthctl [config file] token list [username]
+//	webauthctl [config file] token inspect [token or fingerprint]
+//	webauthctl [config file] token revoke [token or fingerprint]
+//	webauthctl [config file] key list
+//	webauthctl [config file] key rotate
+//	webauthctl [config file] key remove [id]
+//	webauthctl [config file] retention report
+//	webauthctl [config file] retention purge
+//
+// A token is identified by its value or by its fingerprint, which is
+// logged instead of the value. This allows a token that leaked, e.g., into
+// a log or support ticket, to be found and revoked.
+//
+// The key commands manage the keys that sign URLs and cookies. A rotate
+// adds a new key to the config file and makes it the current key, which
+// takes effect when webauth is restarted. Retired keys still verify
+// signatures, and cookies signed with them are re-issued, until they are
+// removed.
+//
+// The retention commands report or purge the data older than the
+// Retention periods of the config. The report is a dry run, which shows
+// what would be purged.
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+const (
+	ExitUsage = iota + 1
+	ExitConfig
+	ExitInit
+	ExitCommand
+)
+
+var ErrUsage = errors.New("invalid usage")
+
+const usage = `usage: %[1]s [config file] token list [username]
+       %[1]s [config file] token inspect [token or fingerprint]
+       %[1]s [config file] token revoke [token or fingerprint]
+       %[1]s [config file] key list
+       %[1]s [config file] key rotate
+       %[1]s [config file] key remove [id]
+       %[1]s [config file] retention report
+       %[1]s [config file] retention purge
+`
+
+func main() {
+	if len(os.Args) < 4 || (os.Args[2] != "token" && os.Args[2] != "key" && os.Args[2] != "retention") {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(ExitUsage)
+	}
+
+	// The key commands only use the config file.
+	if os.Args[2] == "key" {
+		exit(runKey(os.Stdout, os.Args[1], os.Args[3:]))
+	}
+
+	// Read config.
+	cfg, err := webauth.LoadConfigFromJSON(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitConfig)
+	}
+
+	// Initialize db.
+	db, err := webauth.OpenDB(cfg.SQL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitInit)
+	}
+
+	if os.Args[2] == "retention" {
+		err = runRetention(os.Stdout, cfg, db, os.Args[3:])
+	} else {
+		err = runToken(os.Stdout, db, os.Args[3:])
+	}
+	db.Close()
+	exit(err)
+}
+
+// exit exits with the status for err from a command.
+func exit(err error) {
+	if errors.Is(err, ErrUsage) {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		os.Exit(ExitUsage)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitCommand)
+	}
+	os.Exit(0)
+}
+
+// runToken runs the token command with args and writes the output to w.
+func runToken(w io.Writer, store webauth.TokenStore, args []string) error {
+	switch {
+	case args[0] == "list" && len(args) <= 2:
+		var username string
+		if len(args) == 2 {
+			username = args[1]
+		}
+		tokens, err := store.Tokens(username)
+		if err != nil {
+			return err
+		}
+		return writeTokens(w, tokens)
+
+	case args[0] == "inspect" && len(args) == 2:
+		t, err := findToken(store, args[1])
+		if err != nil {
+			return err
+		}
+		return writeToken(w, t)
+
+	case args[0] == "revoke" && len(args) == 2:
+		t, err := findToken(store, args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.RemoveTokenForFingerprint(t.Fingerprint); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "revoked %s token %s of %s\n", t.Kind, t.Fingerprint, t.Username)
+		return err
+	}
+
+	return ErrUsage
+}
+
+// runRetention runs the retention command with args on store and writes
+// the output to w.
+func runRetention(w io.Writer, cfg *webauth.Config, store webauth.AuthStore, args []string) error {
+	if len(args) != 1 || (args[0] != "report" && args[0] != "purge") {
+		return ErrUsage
+	}
+
+	app, err := webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg), webauth.WithDB(store))
+	if err != nil {
+		return err
+	}
+
+	results, err := app.EnforceRetention(args[0] == "report")
+	if err != nil {
+		return err
+	}
+
+	return writeRetention(w, results)
+}
+
+// findToken returns the token identified by s, which is either a
+// fingerprint or a token value.
+func findToken(store webauth.TokenStore, s string) (webauth.TokenInfo, error) {
+	if webauth.IsTokenFingerprint(s) {
+		t, err := store.TokenForFingerprint(s)
+		if !errors.Is(err, webauth.ErrTokenNotFound) {
+			return t, err
+		}
+	}
+
+	return store.TokenForFingerprint(webauth.TokenFingerprint(s))
+}
+
+// runKey runs the key command with args on the config file at path and
+// writes the output to w.
+func runKey(w io.Writer, path string, args []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", webauth.ErrConfigRead, err)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		ids, current, err := webauth.SigningKeyIDs(data)
+		if err != nil {
+			return err
+		}
+		return writeKeys(w, ids, current)
+
+	case args[0] == "rotate" && len(args) == 1:
+		data, id, err := webauth.RotateSigningKey(data, rand.Reader, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := writeConfig(path, data); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "added signing key %s, restart webauth to use it\n", id)
+		return err
+
+	case args[0] == "remove" && len(args) == 2:
+		data, err := webauth.RemoveSigningKey(data, args[1])
+		if err != nil {
+			return err
+		}
+		if err := writeConfig(path, data); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "removed signing key %s\n", args[1])
+		return err
+	}
+
+	return ErrUsage
+}
+
+// writeConfig replaces the config file at path with data, keeping its
+// permissions since it holds secrets.
+func writeConfig(path string, data []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
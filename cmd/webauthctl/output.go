@@ -0,0 +1,87 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// timeFormat is the format of times in the output.
+const timeFormat = time.RFC3339
+
+// writeTokens writes a table of tokens to w.
+func writeTokens(w io.Writer, tokens []webauth.TokenInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "FINGERPRINT\tKIND\tUSER\tNAME\tCREATED\tEXPIRES")
+	for _, t := range tokens {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.Fingerprint, t.Kind, t.Username, t.Name,
+			t.Created.Format(timeFormat), t.Expires.Format(timeFormat))
+	}
+
+	return tw.Flush()
+}
+
+// writeToken writes the details of t to w.
+func writeToken(w io.Writer, t webauth.TokenInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	expires := t.Expires.Format(timeFormat)
+	if t.Expires.Before(time.Now()) {
+		expires += " (expired)"
+	}
+
+	fmt.Fprintf(tw, "Fingerprint:\t%s\n", t.Fingerprint)
+	fmt.Fprintf(tw, "Kind:\t%s\n", t.Kind)
+	fmt.Fprintf(tw, "User:\t%s\n", t.Username)
+	if t.Name != "" {
+		fmt.Fprintf(tw, "Name:\t%s\n", t.Name)
+	}
+	fmt.Fprintf(tw, "Created:\t%s\n", t.Created.Format(timeFormat))
+	fmt.Fprintf(tw, "Expires:\t%s\n", expires)
+	if !t.LastActive.IsZero() {
+		fmt.Fprintf(tw, "Last Active:\t%s\n", t.LastActive.Format(timeFormat))
+	}
+
+	return tw.Flush()
+}
+
+// writeKeys writes the ids of the signing keys to w, marking the current
+// key.
+func writeKeys(w io.Writer, ids []string, current string) error {
+	for _, id := range ids {
+		state := "retired"
+		if id == current {
+			state = "current"
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", id, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRetention writes a table of retention results to w.
+func writeRetention(w io.Writer, results []webauth.RetentionResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "CATEGORY\tBEFORE\tROWS\tACTION")
+	for _, r := range results {
+		action := "purged"
+		if r.DryRun {
+			action = "would purge"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n",
+			r.Category, r.Cutoff.Format(timeFormat), r.Rows, action)
+	}
+
+	return tw.Flush()
+}
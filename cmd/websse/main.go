@@ -13,6 +13,8 @@ import (
 	"path/filepath"
 
 	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/watchdog"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/weblog"
@@ -60,10 +62,22 @@ func main() {
 	// Show config in log.
 	slog.Info("using config", slog.Any("config", cfg))
 
+	// Validate the time zones of pages.
+	tz, err := webutil.NewTimeZones(cfg.App.TimeZone, cfg.App.TimeZones)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error in config:", err)
+		os.Exit(ExitConfig)
+	}
+
 	// Define custom template functions.
 	funcMap := template.FuncMap{
-		"ToTimeZone": webutil.ToTimeZone,
-		"Join":       webutil.Join,
+		"ToTimeZone":   tz.ToTimeZone,
+		"LocalTime":    tz.LocalTime,
+		"RelativeTime": tz.RelativeTime,
+		"Join":         webutil.Join,
+		"CSRFField":    webutil.CSRFField,
+		"NonceAttr":    webutil.NonceAttr,
+		"T":            i18n.T,
 	}
 
 	// Parse templates.
@@ -76,7 +90,8 @@ func main() {
 
 	// Create the web app.
 	app, err := webapp.New(
-		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl))
+		webapp.WithName(cfg.App.Name), webapp.WithTemplate(tmpl),
+		webapp.WithTimeZones(tz))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error creating new handler:", err)
 		os.Exit(ExitHandler)
@@ -98,6 +113,20 @@ func main() {
 	sseServer.RegisterEvents("", "event1", "event2")
 	sseServer.Run()
 
+	// Create a new context.
+	ctx := context.Background()
+
+	// Warn if goroutines, open files, or SSE clients appear to leak.
+	// Clients can leak when a proxy holds connections open.
+	wd := watchdog.New(
+		watchdog.WithGauge("goroutines", watchdog.Goroutines, 1000),
+		watchdog.WithGauge("fds", watchdog.OpenFDs, 1000),
+		watchdog.WithGauge("sse_clients", func() (int, error) {
+			return sseServer.ClientCount(), nil
+		}, 500),
+	)
+	go wd.Run(ctx)
+
 	mux.HandleFunc("/", app.RootHandlerGet)
 	mux.HandleFunc("/w3.css", webhandler.FileHandler(cssFile))
 	mux.HandleFunc("/favicon.ico", webhandler.FileHandler(icoFile))
@@ -116,9 +145,6 @@ func main() {
 		os.Exit(ExitServer)
 	}
 
-	// Create a new context.
-	ctx := context.Background()
-
 	// Run the web server.
 	err = srv.Run(ctx)
 	if err != nil {
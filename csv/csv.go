@@ -21,29 +21,16 @@ var (
 // field names as headers.  This function assumes that the data provided is
 // a slice of structs.
 func SliceOfStructsToCSV(w io.Writer, data interface{}) error {
-	sliceValue := reflect.ValueOf(data)
-	if sliceValue.Kind() != reflect.Slice {
-		return ErrCSVNotSlice
+	records, err := Records(data)
+	if err != nil {
+		return err
 	}
 
 	cw := csv.NewWriter(w)
 	// Don't defer cw.Flush() to allow checking for Errors
 
-	for i := 0; i < sliceValue.Len(); i++ {
-		structValue := sliceValue.Index(i)
-
-		if structValue.Kind() != reflect.Struct {
-			return ErrCSVNotSliceOfStructs
-		}
-
-		// write headers if first row
-		if i == 0 {
-			if err := writeHeader(cw, structValue); err != nil {
-				return err
-			}
-		}
-
-		if err := writeRecord(cw, structValue); err != nil {
+	for _, record := range records {
+		if err := cw.Write(record); err != nil {
 			return err
 		}
 	}
@@ -58,8 +45,36 @@ func SliceOfStructsToCSV(w io.Writer, data interface{}) error {
 	return nil
 }
 
-// writeHeader writes CSV headers from the struct field names or `csv` tags.
-func writeHeader(cw *csv.Writer, v reflect.Value) error {
+// Records returns a slice of structs as records, as written by
+// SliceOfStructsToCSV. The first record is the headers, unless data is
+// empty. This allows other formats to write the same rows as CSV.
+func Records(data interface{}) ([][]string, error) {
+	sliceValue := reflect.ValueOf(data)
+	if sliceValue.Kind() != reflect.Slice {
+		return nil, ErrCSVNotSlice
+	}
+
+	var records [][]string
+	for i := 0; i < sliceValue.Len(); i++ {
+		structValue := sliceValue.Index(i)
+
+		if structValue.Kind() != reflect.Struct {
+			return nil, ErrCSVNotSliceOfStructs
+		}
+
+		// add headers if first row
+		if i == 0 {
+			records = append(records, header(structValue))
+		}
+
+		records = append(records, record(structValue))
+	}
+
+	return records, nil
+}
+
+// header returns CSV headers from the struct field names or `csv` tags.
+func header(v reflect.Value) []string {
 	var headers []string
 	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
@@ -70,15 +85,15 @@ func writeHeader(cw *csv.Writer, v reflect.Value) error {
 		}
 		headers = append(headers, name)
 	}
-	return cw.Write(headers)
+	return headers
 }
 
-// writeRecord converts struct fields to CSV record.
-func writeRecord(cw *csv.Writer, v reflect.Value) error {
+// record converts struct fields to CSV record.
+func record(v reflect.Value) []string {
 	var records []string
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
 		records = append(records, fmt.Sprintf("%v", field.Interface()))
 	}
-	return cw.Write(records)
+	return records
 }
@@ -4,15 +4,21 @@
 package email
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/mail"
 	"net/smtp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bnixon67/required"
+	"github.com/bnixon67/webapp/webtrace"
 )
 
 // SMTPConfig holds configuration for an SMTP server for sending emails.
@@ -56,10 +62,25 @@ var (
 	ErrEmailNoRecipients     = errors.New("failed to provide one recipient")
 	ErrEmailInvalidRecipient = errors.New("invalid 'recipient' address")
 	ErrEmailSendFailed       = errors.New("failed to send email")
+	ErrEmailInvalidHeader    = errors.New("invalid header")
 )
 
 // SendMessage sends an email using the configured SMTP server settings.
 func (s SMTPConfig) SendMessage(from string, recipients []string, subject, body string) error {
+	return s.SendMessageWithHeaders(from, recipients, subject, body, nil)
+}
+
+// SendMessageWithHeaders sends an email like SendMessage with additional
+// headers, such as List-Unsubscribe. Headers are written in sorted order
+// after the standard From, To, and Subject headers.
+func (s SMTPConfig) SendMessageWithHeaders(from string, recipients []string, subject, body string, extra map[string]string) error {
+	return s.SendMessageWithHeadersContext(context.Background(), from, recipients, subject, body, extra)
+}
+
+// SendMessageWithHeadersContext sends an email like SendMessageWithHeaders.
+// The connection to the SMTP server is closed if ctx is done before the
+// email is sent. If ctx is traced, the send is a child span.
+func (s SMTPConfig) SendMessageWithHeadersContext(ctx context.Context, from string, recipients []string, subject, body string, extra map[string]string) error {
 	if isValid, err := s.IsValid(); !isValid || err != nil {
 		return ErrEmailInvalidConfig
 	}
@@ -77,17 +98,116 @@ func (s SMTPConfig) SendMessage(from string, recipients []string, subject, body
 		}
 	}
 
-	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n",
+	for key, value := range extra {
+		if !validHeader(key, value) {
+			return fmt.Errorf("%w: %q", ErrEmailInvalidHeader, key)
+		}
+	}
+
+	var headers strings.Builder
+	fmt.Fprintf(&headers, "From: %s\r\nTo: %s\r\nSubject: %s\r\n",
 		from, strings.Join(recipients, ", "), subject)
-	message := []byte(headers + body)
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&headers, "%s: %s\r\n", key, extra[key])
+	}
+	headers.WriteString("\r\n")
+	message := []byte(headers.String() + body)
 
 	serverAddr := net.JoinHostPort(s.Host, s.Port)
 
+	ctx, span := webtrace.StartSpan(ctx, "smtp.send")
+	defer span.End()
+	span.SetAttribute("smtp.host", s.Host)
+	span.SetAttribute("smtp.recipients", strconv.Itoa(len(recipients)))
+
 	auth := smtp.PlainAuth("", s.Username, s.Password, s.Host)
-	err := smtp.SendMail(serverAddr, auth, from, recipients, message)
+	err := sendMail(ctx, serverAddr, s.Host, auth, from, recipients, message)
 	if err != nil {
+		span.SetError(err)
 		return fmt.Errorf("%w: %v", ErrEmailSendFailed, err)
 	}
 
 	return err
 }
+
+// sendMail is smtp.SendMail with a context to cancel the connection.
+func sendMail(ctx context.Context, addr, host string, a smtp.Auth, from string, to []string, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock any read or write on the connection when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// validHeader returns true if key is a valid header name and value does not
+// contain line breaks that could be used to inject headers.
+func validHeader(key, value string) bool {
+	if key == "" || strings.ContainsAny(value, "\r\n") {
+		return false
+	}
+
+	for _, c := range key {
+		if c <= ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -4,6 +4,7 @@
 package email_test
 
 import (
+	"context"
 	"errors"
 	"net"
 	"os"
@@ -146,6 +147,79 @@ func TestSendEmail(t *testing.T) {
 	}
 }
 
+func TestSendMessageWithHeaders(t *testing.T) {
+	smtpConfig := email.SMTPConfig{
+		Host:     MockSMTPHost,
+		Port:     MockSMTPPort,
+		Username: "smtpuser@example.com",
+		Password: "password",
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+	}{
+		{
+			name:    "nilHeaders",
+			headers: nil,
+			wantErr: nil,
+		},
+		{
+			name: "validHeaders",
+			headers: map[string]string{
+				"List-Unsubscribe":      "<https://example.com/unsubscribe>",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "injectedValue",
+			headers: map[string]string{"X-Foo": "bar\r\nBcc: evil@example.com"},
+			wantErr: email.ErrEmailInvalidHeader,
+		},
+		{
+			name:    "invalidName",
+			headers: map[string]string{"X Foo": "bar"},
+			wantErr: email.ErrEmailInvalidHeader,
+		},
+		{
+			name:    "emptyName",
+			headers: map[string]string{"": "bar"},
+			wantErr: email.ErrEmailInvalidHeader,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := smtpConfig.SendMessageWithHeaders("from@example.com",
+				[]string{"recipient@example.com"}, "Greetings",
+				"Hello, How are you?", tc.headers)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("SendMessageWithHeaders() got error = %q, want error %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendMessageWithHeadersContext(t *testing.T) {
+	smtpConfig := email.SMTPConfig{
+		Host:     MockSMTPHost,
+		Port:     MockSMTPPort,
+		Username: "smtpuser@example.com",
+		Password: "password",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := smtpConfig.SendMessageWithHeadersContext(ctx, "from@example.com",
+		[]string{"recipient@example.com"}, "Greetings", "Hello", nil)
+	if !errors.Is(err, email.ErrEmailSendFailed) {
+		t.Errorf("SendMessageWithHeadersContext() got error = %q, want error %q", err, email.ErrEmailSendFailed)
+	}
+}
+
 func TestSMTPConfigMarshalJSON(t *testing.T) {
 	testCases := []struct {
 		name  string
@@ -0,0 +1,315 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package i18n translates the messages and email templates of an
+// application to the language of each request, negotiated from its
+// Accept-Language header.
+//
+// Messages are looked up by their English text, such as "Login failed.",
+// so a message without a translation is shown in English. A message with
+// arguments is a fmt format, such as "%s registration".
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language of the messages in the source.
+const DefaultLanguage = "en"
+
+// Catalog has the translations of messages and templates by language.
+type Catalog struct {
+	fallback  string
+	messages  map[string]map[string]string // messages by language and key.
+	templates map[string]map[string]string // templates by language and name.
+}
+
+// NewCatalog returns an empty Catalog, which is used for requests in
+// the fallback language or in a language without translations.
+func NewCatalog(fallback string) *Catalog {
+	return &Catalog{
+		fallback:  fallback,
+		messages:  make(map[string]map[string]string),
+		templates: make(map[string]map[string]string),
+	}
+}
+
+// Load returns a Catalog of the translations in fsys. Each "<lang>.json"
+// file, such as es.json or pt-BR.json, has the messages of the language as
+// a JSON object of keys to translations, and each "<lang>/<name>.txt" file,
+// such as es/register.txt, is the template name in the language.
+func Load(fsys fs.FS, fallback string) (*Catalog, error) {
+	c := NewCatalog(fallback)
+
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, fmt.Errorf("invalid catalog %s: %w", file, err)
+		}
+		c.AddMessages(strings.TrimSuffix(file, ".json"), messages)
+	}
+
+	files, err = fs.Glob(fsys, "*/*.txt")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		lang, name := path.Split(file)
+		c.AddTemplate(strings.TrimSuffix(lang, "/"), strings.TrimSuffix(name, ".txt"), string(b))
+	}
+
+	return c, nil
+}
+
+// AddMessages adds the translations of messages in lang, by key.
+func (c *Catalog) AddMessages(lang string, messages map[string]string) {
+	lang = canonical(lang)
+	if c.messages[lang] == nil {
+		c.messages[lang] = make(map[string]string, len(messages))
+	}
+	for key, msg := range messages {
+		c.messages[lang][key] = msg
+	}
+}
+
+// AddTemplate adds the translation of the template name in lang.
+func (c *Catalog) AddTemplate(lang, name, text string) {
+	lang = canonical(lang)
+	if c.templates[lang] == nil {
+		c.templates[lang] = make(map[string]string)
+	}
+	c.templates[lang][name] = text
+}
+
+// Languages returns the languages of c, the fallback first and the
+// others in order.
+func (c *Catalog) Languages() []string {
+	var langs []string
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	for lang := range c.templates {
+		if _, ok := c.messages[lang]; !ok {
+			langs = append(langs, lang)
+		}
+	}
+	langs = slices.DeleteFunc(langs, func(lang string) bool { return lang == canonical(c.fallback) })
+	slices.Sort(langs)
+
+	return append([]string{canonical(c.fallback)}, langs...)
+}
+
+// has returns true if c has translations in lang or it is the fallback.
+func (c *Catalog) has(lang string) bool {
+	_, messages := c.messages[lang]
+	_, templates := c.templates[lang]
+
+	return messages || templates || lang == canonical(c.fallback)
+}
+
+// Match returns the language of c that best matches the Accept-Language
+// header accept, such as "es-MX, es;q=0.9, en;q=0.5", or the fallback.
+// A region that c does not have matches its language, so "es-MX" is "es"
+// if c has "es" but not "es-MX".
+func (c *Catalog) Match(accept string) string {
+	for _, lang := range parseAccept(accept) {
+		if lang == "*" {
+			break
+		}
+		if c.has(lang) {
+			return lang
+		}
+		if base, _, ok := strings.Cut(lang, "-"); ok && c.has(base) {
+			return base
+		}
+	}
+
+	return canonical(c.fallback)
+}
+
+// parseAccept returns the languages of the Accept-Language header accept
+// in canonical form, most preferred first, without those with q=0.
+func parseAccept(accept string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(accept, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = canonical(lang)
+		if lang == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+
+	slices.SortStableFunc(langs, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.lang
+	}
+
+	return tags
+}
+
+// canonical returns the language tag lang with its language in lower case
+// and its region in upper case, such as "pt-BR".
+func canonical(lang string) string {
+	lang = strings.TrimSpace(strings.ReplaceAll(lang, "_", "-"))
+	base, region, ok := strings.Cut(lang, "-")
+	if !ok {
+		return strings.ToLower(base)
+	}
+
+	return strings.ToLower(base) + "-" + strings.ToUpper(region)
+}
+
+// Printer translates to a language of a Catalog.
+type Printer struct {
+	catalog *Catalog
+	lang    string
+}
+
+// Printer returns the Printer of lang, or of the fallback if lang is
+// empty.
+func (c *Catalog) Printer(lang string) *Printer {
+	if lang == "" {
+		lang = c.fallback
+	}
+
+	return &Printer{catalog: c, lang: canonical(lang)}
+}
+
+// Lang returns the language of p, or DefaultLanguage if p is nil.
+func (p *Printer) Lang() string {
+	if p == nil {
+		return DefaultLanguage
+	}
+
+	return p.lang
+}
+
+// langs returns the languages to look up a translation for p, the
+// language of p, its base language, and the fallback.
+func (p *Printer) langs() []string {
+	langs := []string{p.lang}
+	if base, _, ok := strings.Cut(p.lang, "-"); ok {
+		langs = append(langs, base)
+	}
+
+	return append(langs, canonical(p.catalog.fallback))
+}
+
+// T returns the translation of the message key, formatted with args by
+// fmt.Sprintf if there are any. A key without a translation is used as
+// the message.
+func (p *Printer) T(key string, args ...any) string {
+	msg := key
+	if p != nil {
+		for _, lang := range p.langs() {
+			if s, ok := p.catalog.messages[lang][key]; ok {
+				msg = s
+				break
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// Template returns the translation of the template name, or text if it
+// has none.
+func (p *Printer) Template(name, text string) string {
+	if p != nil {
+		for _, lang := range p.langs() {
+			if s, ok := p.catalog.templates[lang][name]; ok {
+				return s
+			}
+		}
+	}
+
+	return text
+}
+
+// T translates key with p, as Printer.T. It is the "T" function of
+// templates, such as {{T .Printer "Login failed."}}, and p may be nil.
+func T(p *Printer, key string, args ...any) string {
+	return p.T(key, args...)
+}
+
+type languageKeyType struct{}
+
+var languageKey = languageKeyType{}
+
+// WithLanguage returns a copy of ctx with the language lang.
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, languageKey, lang)
+}
+
+// Language returns the language of ctx, or an empty string if it has
+// none.
+func Language(ctx context.Context) string {
+	lang, _ := ctx.Value(languageKey).(string)
+	return lang
+}
+
+// Middleware returns a handler that calls next with the language of c
+// that best matches the Accept-Language of the request in its context and
+// sets the Content-Language of the response to it.
+func (c *Catalog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := c.Match(r.Header.Get("Accept-Language"))
+
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", lang)
+
+		next.ServeHTTP(w, r.WithContext(WithLanguage(r.Context(), lang)))
+	})
+}
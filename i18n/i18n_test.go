@@ -0,0 +1,125 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package i18n_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bnixon67/webapp/i18n"
+)
+
+func catalogForTest(t *testing.T) *i18n.Catalog {
+	t.Helper()
+
+	c, err := i18n.Load(fstest.MapFS{
+		"es.json":         {Data: []byte(`{"Login failed.": "Error al iniciar sesión.", "%s registration": "Registro en %s"}`)},
+		"pt-BR.json":      {Data: []byte(`{"Login failed.": "Falha no login."}`)},
+		"es/register.txt": {Data: []byte("Hola {{.Username}}")},
+	}, "en")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	return c
+}
+
+func TestLoad(t *testing.T) {
+	c := catalogForTest(t)
+
+	if got, want := c.Languages(), []string{"en", "es", "pt-BR"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Languages() = %v, want %v", got, want)
+	}
+
+	if _, err := i18n.Load(fstest.MapFS{"es.json": {Data: []byte(`[]`)}}, "en"); err == nil {
+		t.Error("Load() of invalid catalog did not fail")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c := catalogForTest(t)
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"ES-mx", "es"},
+		{"pt-br", "pt-BR"},
+		{"pt", "en"},
+		{"fr, es;q=0.5", "es"},
+		{"en;q=0.4, es;q=0.8", "es"},
+		{"es;q=0, en", "en"},
+		{"fr, *", "en"},
+		{"es;q=bad, pt-BR", "pt-BR"},
+	}
+
+	for _, tc := range tests {
+		if got := c.Match(tc.accept); got != tc.want {
+			t.Errorf("Match(%q) = %q, want %q", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	c := catalogForTest(t)
+
+	tests := []struct {
+		lang string
+		key  string
+		args []any
+		want string
+	}{
+		{"es", "Login failed.", nil, "Error al iniciar sesión."},
+		{"es-MX", "Login failed.", nil, "Error al iniciar sesión."},
+		{"es", "%s registration", []any{"App"}, "Registro en App"},
+		{"es", "Missing.", nil, "Missing."},
+		{"en", "Login failed.", nil, "Login failed."},
+		{"", "%s registration", []any{"App"}, "App registration"},
+	}
+
+	for _, tc := range tests {
+		if got := c.Printer(tc.lang).T(tc.key, tc.args...); got != tc.want {
+			t.Errorf("Printer(%q).T(%q) = %q, want %q", tc.lang, tc.key, got, tc.want)
+		}
+	}
+
+	if got := i18n.T(nil, "Hi %s", "Al"); got != "Hi Al" {
+		t.Errorf("T(nil) = %q, want %q", got, "Hi Al")
+	}
+	if got := c.Printer("es").Template("register", "Hello"); got != "Hola {{.Username}}" {
+		t.Errorf("Template() = %q, want translation", got)
+	}
+	if got := c.Printer("pt-BR").Template("register", "Hello"); got != "Hello" {
+		t.Errorf("Template() = %q, want default", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	c := catalogForTest(t)
+
+	var got string
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = i18n.Language(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "es-ES,es;q=0.9")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got != "es" {
+		t.Errorf("Language() = %q, want %q", got, "es")
+	}
+	if lang := w.Header().Get("Content-Language"); lang != "es" {
+		t.Errorf("Content-Language = %q, want %q", lang, "es")
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept-Language" {
+		t.Errorf("Vary = %q, want %q", vary, "Accept-Language")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bnixon67/webapp/email"
+)
+
+// MatrixConfig holds settings to send notifications to a Matrix room.
+type MatrixConfig struct {
+	Homeserver  string // Base URL of the homeserver.
+	RoomID      string // Room to send notifications to.
+	AccessToken string // Access token of the sending user.
+}
+
+// Config holds the sinks that receive notifications. Sinks that are not
+// configured are not used.
+type Config struct {
+	EmailTo []string     // Recipients of email notifications.
+	Slack   string       // Slack incoming webhook URL.
+	Teams   string       // Microsoft Teams incoming webhook URL.
+	Matrix  MatrixConfig // Matrix room.
+}
+
+// RedactedConfig is a copy of Config to hide sensitive information.
+type RedactedConfig Config
+
+// redact creates a copy of Config with webhook URLs and tokens redacted,
+// since they grant permission to post.
+func (c Config) redact() RedactedConfig {
+	r := RedactedConfig(c)
+	if r.Slack != "" {
+		r.Slack = "[REDACTED]"
+	}
+	if r.Teams != "" {
+		r.Teams = "[REDACTED]"
+	}
+	if r.Matrix.AccessToken != "" {
+		r.Matrix.AccessToken = "[REDACTED]"
+	}
+	return r
+}
+
+// MarshalJSON redacts sensitive information when marshalling to JSON.
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.redact())
+}
+
+// String returns a string for Config with sensitive data redacted.
+func (c Config) String() string {
+	return fmt.Sprintf("%+v", c.redact())
+}
+
+// Notifier returns a Notifier that sends to each configured sink. Emails
+// are sent using smtp from the address from.
+func (c Config) Notifier(smtp email.SMTPConfig, from string) Multi {
+	var m Multi
+
+	if len(c.EmailTo) > 0 {
+		m = append(m, EmailNotifier{SMTP: smtp, From: from, To: c.EmailTo})
+	}
+	if c.Slack != "" {
+		m = append(m, SlackNotifier{URL: c.Slack})
+	}
+	if c.Teams != "" {
+		m = append(m, TeamsNotifier{URL: c.Teams})
+	}
+	if c.Matrix.Homeserver != "" {
+		m = append(m, MatrixNotifier{
+			Homeserver:  c.Matrix.Homeserver,
+			RoomID:      c.Matrix.RoomID,
+			AccessToken: c.Matrix.AccessToken,
+		})
+	}
+
+	return m
+}
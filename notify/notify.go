@@ -0,0 +1,185 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package notify sends operational alerts, such as a server starting, to
+// email recipients and chat channels.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bnixon67/webapp/email"
+)
+
+// Kind identifies the reason for a notification.
+type Kind string
+
+const (
+	KindStartup      Kind = "startup"       // Server started.
+	KindPanic        Kind = "panic"         // Handler recovered from a panic.
+	KindLockoutSpike Kind = "lockout_spike" // Unusual number of lockouts.
+	KindCertExpiry   Kind = "cert_expiry"   // Certificate expires soon.
+)
+
+// Message is an operational notification.
+type Message struct {
+	Kind    Kind
+	Subject string
+	Body    string
+}
+
+// Notifier sends a Message to a sink, such as email or a chat channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// ErrNotifyFailed indicates a sink did not accept a notification.
+var ErrNotifyFailed = errors.New("notify failed")
+
+// Multi is a Notifier that sends to each of its Notifiers.
+type Multi []Notifier
+
+// Notify sends msg to every Notifier, returning the joined errors of any
+// that fail.
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// title returns the text used as the title of msg.
+func (msg Message) title() string {
+	if msg.Kind == "" {
+		return msg.Subject
+	}
+
+	return fmt.Sprintf("[%s] %s", msg.Kind, msg.Subject)
+}
+
+// EmailNotifier sends notifications by email.
+type EmailNotifier struct {
+	SMTP email.SMTPConfig
+	From string
+	To   []string
+}
+
+// Notify sends msg by email.
+func (e EmailNotifier) Notify(ctx context.Context, msg Message) error {
+	err := e.SMTP.SendMessageWithHeadersContext(ctx, e.From, e.To, msg.title(), msg.Body, nil)
+	if err != nil {
+		return fmt.Errorf("%w: email: %v", ErrNotifyFailed, err)
+	}
+
+	return nil
+}
+
+// DefaultClient is used by the webhook sinks if Client is nil.
+var DefaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// send marshals payload as JSON and sends it to target.
+func send(ctx context.Context, client *http.Client, method, target, sink string, header http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotifyFailed, sink, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotifyFailed, sink, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotifyFailed, sink, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s: %s", ErrNotifyFailed, sink, resp.Status)
+	}
+
+	return nil
+}
+
+// SlackNotifier sends notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts msg to the Slack webhook.
+func (s SlackNotifier) Notify(ctx context.Context, msg Message) error {
+	payload := map[string]string{"text": "*" + msg.title() + "*\n" + msg.Body}
+
+	return send(ctx, s.Client, http.MethodPost, s.URL, "slack", nil, payload)
+}
+
+// TeamsNotifier sends notifications to a Microsoft Teams incoming webhook.
+type TeamsNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts msg to the Teams webhook as a message card.
+func (t TeamsNotifier) Notify(ctx context.Context, msg Message) error {
+	payload := map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  msg.title(),
+		"title":    msg.title(),
+		"text":     msg.Body,
+	}
+
+	return send(ctx, t.Client, http.MethodPost, t.URL, "teams", nil, payload)
+}
+
+// MatrixNotifier sends notifications to a Matrix room.
+type MatrixNotifier struct {
+	Homeserver  string // Base URL of the homeserver, e.g., https://matrix.org.
+	RoomID      string
+	AccessToken string
+	Client      *http.Client
+}
+
+// Notify sends msg to the Matrix room as a text message.
+func (m MatrixNotifier) Notify(ctx context.Context, msg Message) error {
+	txn := make([]byte, 8)
+	if _, err := rand.Read(txn); err != nil {
+		return fmt.Errorf("%w: matrix: %v", ErrNotifyFailed, err)
+	}
+
+	// See https://spec.matrix.org/latest/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+	target := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.Homeserver, url.PathEscape(m.RoomID), hex.EncodeToString(txn))
+
+	header := http.Header{"Authorization": {"Bearer " + m.AccessToken}}
+	payload := map[string]string{
+		"msgtype": "m.text",
+		"body":    msg.title() + "\n" + msg.Body,
+	}
+
+	return send(ctx, m.Client, http.MethodPut, target, "matrix", header, payload)
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/email"
+	"github.com/bnixon67/webapp/notify"
+	"github.com/google/go-cmp/cmp"
+)
+
+// request records a request received by a test server.
+type request struct {
+	Method string
+	Path   string
+	Auth   string
+	Body   map[string]string
+}
+
+// testServer returns a server that records requests and responds with status.
+func testServer(t *testing.T, status int, got *request) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.Method = r.Method
+		got.Path = r.URL.Path
+		got.Auth = r.Header.Get("Authorization")
+		if err := json.Unmarshal(body, &got.Body); err != nil {
+			t.Errorf("invalid JSON body %q: %v", body, err)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+var msg = notify.Message{Kind: notify.KindStartup, Subject: "starting", Body: "on host"}
+
+func TestSlackNotifier(t *testing.T) {
+	var got request
+	srv := testServer(t, http.StatusOK, &got)
+
+	err := notify.SlackNotifier{URL: srv.URL + "/hook"}.Notify(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	want := request{
+		Method: http.MethodPost,
+		Path:   "/hook",
+		Body:   map[string]string{"text": "*[startup] starting*\non host"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("request mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	var got request
+	srv := testServer(t, http.StatusOK, &got)
+
+	err := notify.TeamsNotifier{URL: srv.URL}.Notify(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	if got.Body["@type"] != "MessageCard" || got.Body["title"] != "[startup] starting" || got.Body["text"] != "on host" {
+		t.Errorf("unexpected body %v", got.Body)
+	}
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	var got request
+	srv := testServer(t, http.StatusOK, &got)
+
+	n := notify.MatrixNotifier{Homeserver: srv.URL, RoomID: "!room:host", AccessToken: "token"}
+	if err := n.Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify() = %v", err)
+	}
+
+	prefix := "/_matrix/client/v3/rooms/!room:host/send/m.room.message/"
+	if got.Method != http.MethodPut || !strings.HasPrefix(got.Path, prefix) {
+		t.Errorf("got %s %s, want PUT %s...", got.Method, got.Path, prefix)
+	}
+	if got.Auth != "Bearer token" {
+		t.Errorf("got Authorization %q", got.Auth)
+	}
+	if got.Body["msgtype"] != "m.text" || got.Body["body"] != "[startup] starting\non host" {
+		t.Errorf("unexpected body %v", got.Body)
+	}
+}
+
+func TestNotifierFailure(t *testing.T) {
+	var got request
+	srv := testServer(t, http.StatusForbidden, &got)
+
+	err := notify.SlackNotifier{URL: srv.URL}.Notify(context.Background(), msg)
+	if !errors.Is(err, notify.ErrNotifyFailed) {
+		t.Errorf("Notify() = %v, want %v", err, notify.ErrNotifyFailed)
+	}
+}
+
+// notifierFunc adapts a function to a Notifier.
+type notifierFunc func(context.Context, notify.Message) error
+
+func (f notifierFunc) Notify(ctx context.Context, msg notify.Message) error {
+	return f(ctx, msg)
+}
+
+func TestMulti(t *testing.T) {
+	var calls int
+	ok := notifierFunc(func(context.Context, notify.Message) error {
+		calls++
+		return nil
+	})
+	errFail := errors.New("fail")
+	fail := notifierFunc(func(context.Context, notify.Message) error {
+		calls++
+		return errFail
+	})
+
+	err := notify.Multi{fail, ok}.Notify(context.Background(), msg)
+	if !errors.Is(err, errFail) {
+		t.Errorf("Notify() = %v, want %v", err, errFail)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want 2", calls)
+	}
+
+	if err := (notify.Multi{}).Notify(context.Background(), msg); err != nil {
+		t.Errorf("empty Multi Notify() = %v, want nil", err)
+	}
+}
+
+func TestConfigNotifier(t *testing.T) {
+	cfg := notify.Config{
+		EmailTo: []string{"ops@example.com"},
+		Slack:   "https://hooks.slack.com/x",
+		Matrix:  notify.MatrixConfig{Homeserver: "https://matrix.org"},
+	}
+
+	got := cfg.Notifier(email.SMTPConfig{}, "app@example.com")
+	if len(got) != 3 {
+		t.Fatalf("got %d notifiers, want 3", len(got))
+	}
+	if _, ok := got[0].(notify.EmailNotifier); !ok {
+		t.Errorf("got %T, want EmailNotifier", got[0])
+	}
+	if _, ok := got[1].(notify.SlackNotifier); !ok {
+		t.Errorf("got %T, want SlackNotifier", got[1])
+	}
+	if _, ok := got[2].(notify.MatrixNotifier); !ok {
+		t.Errorf("got %T, want MatrixNotifier", got[2])
+	}
+}
+
+func TestConfigRedact(t *testing.T) {
+	cfg := notify.Config{
+		Slack:  "https://hooks.slack.com/secret",
+		Teams:  "https://teams/secret",
+		Matrix: notify.MatrixConfig{Homeserver: "https://matrix.org", AccessToken: "secret"},
+	}
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() = %v", err)
+	}
+	if strings.Contains(string(b), "secret") || strings.Contains(cfg.String(), "secret") {
+		t.Errorf("config not redacted: %s", b)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package pwned checks if passwords appeared in data breaches using the
+// Pwned Passwords range API of Have I Been Pwned.
+//
+// The API uses k-anonymity. Only the first five characters of the SHA-1
+// hash of a password are sent, and the suffixes of all hashes with that
+// prefix are returned, so the password, or its full hash, never leaves
+// the server. Responses are cached, since each prefix is shared by many
+// passwords.
+//
+// In offline mode, the ranges are read from a directory of files named
+// by prefix, e.g., 21BD1.txt, each with lines of SUFFIX:COUNT as returned
+// by the API, such as those created by the PwnedPasswordsDownloader.
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used if not set by an Option.
+const (
+	DefaultURL      = "https://api.pwnedpasswords.com/range/"
+	DefaultCacheTTL = 24 * time.Hour
+	DefaultTimeout  = 5 * time.Second
+)
+
+// prefixLen is the number of hex characters of the hash sent to the API.
+const prefixLen = 5
+
+// entry is a cached range.
+type entry struct {
+	counts  map[string]int // counts are the breach counts by hash suffix.
+	expires time.Time
+}
+
+// Checker checks passwords against the Pwned Passwords ranges. It is safe
+// for concurrent use.
+type Checker struct {
+	url    string
+	dir    string
+	client *http.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]entry // cache of ranges by prefix.
+}
+
+// Option configures a Checker.
+type Option func(*Checker)
+
+// WithURL returns an Option to set the URL of the range API. The prefix
+// is appended to it.
+func WithURL(url string) Option {
+	return func(c *Checker) {
+		c.url = url
+	}
+}
+
+// WithDir returns an Option to read ranges from dir instead of the API.
+func WithDir(dir string) Option {
+	return func(c *Checker) {
+		c.dir = dir
+	}
+}
+
+// WithClient returns an Option to set the HTTP client used for the API.
+func WithClient(client *http.Client) Option {
+	return func(c *Checker) {
+		c.client = client
+	}
+}
+
+// WithCacheTTL returns an Option to set how long ranges are cached. A
+// zero or negative ttl disables the cache.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(c *Checker) {
+		c.ttl = ttl
+	}
+}
+
+// WithNow returns an Option to set the source of the current time used to
+// expire the cache, e.g., for tests.
+func WithNow(now func() time.Time) Option {
+	return func(c *Checker) {
+		c.now = now
+	}
+}
+
+// New returns a Checker with the given options.
+func New(opts ...Option) *Checker {
+	c := &Checker{
+		url:    DefaultURL,
+		client: &http.Client{Timeout: DefaultTimeout},
+		ttl:    DefaultCacheTTL,
+		now:    time.Now,
+		cache:  make(map[string]entry),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Count returns the number of times password appeared in breaches, which
+// is zero if it is not known to be breached.
+func (c *Checker) Count(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	counts, err := c.lookup(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	return counts[suffix], nil
+}
+
+// lookup returns the range for prefix from the cache, directory, or API.
+func (c *Checker) lookup(ctx context.Context, prefix string) (map[string]int, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	e, ok := c.cache[prefix]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.counts, nil
+	}
+
+	var counts map[string]int
+	var err error
+	if c.dir != "" {
+		counts, err = c.readRange(prefix)
+	} else {
+		counts, err = c.fetchRange(ctx, prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		for p, e := range c.cache {
+			if !now.Before(e.expires) {
+				delete(c.cache, p)
+			}
+		}
+		c.cache[prefix] = entry{counts: counts, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+	}
+
+	return counts, nil
+}
+
+// readRange returns the range for prefix from the directory. A missing
+// file is an empty range.
+func (c *Checker) readRange(prefix string) (map[string]int, error) {
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseRange(f)
+}
+
+var ErrStatus = errors.New("unexpected status")
+
+// fetchRange returns the range for prefix from the API. Padding is
+// requested so the size of the response does not reveal the prefix.
+func (c *Checker) fetchRange(ctx context.Context, prefix string) (map[string]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrStatus, resp.Status)
+	}
+
+	return parseRange(resp.Body)
+}
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// parseRange returns the counts in r, which has lines of SUFFIX:COUNT.
+// Padding entries have a count of zero and are ignored.
+func parseRange(r io.Reader) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		suffix, count, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, line)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRange, line)
+		}
+		if n > 0 {
+			counts[strings.ToUpper(suffix)] = n
+		}
+	}
+
+	return counts, scanner.Err()
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package pwned_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/pwned"
+)
+
+// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const (
+	prefix = "5BAA6"
+	suffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+// rangeBody is a response for prefix with a padding entry.
+const rangeBody = "003D68EB55068C33ACE09247EE4C639306B:3\r\n" +
+	suffix + ":9545824\r\n" +
+	"FFFFF0000000000000000000000000000FF:0\r\n"
+
+func TestCount(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/range/"+prefix {
+			t.Errorf("got path %q, want %q", r.URL.Path, "/range/"+prefix)
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("missing Add-Padding header")
+		}
+		w.Write([]byte(rangeBody))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := pwned.New(pwned.WithURL(srv.URL+"/range/"), pwned.WithCacheTTL(time.Hour),
+		pwned.WithNow(func() time.Time { return now }))
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"password", 9545824},
+		{"password", 9545824},
+	}
+
+	for _, tc := range tests {
+		got, err := c.Count(context.Background(), tc.password)
+		if err != nil {
+			t.Fatalf("Count(%q) failed: %v", tc.password, err)
+		}
+		if got != tc.want {
+			t.Errorf("Count(%q) = %d, want %d", tc.password, got, tc.want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1 with cache", requests)
+	}
+
+	// The cache expires after the TTL.
+	now = now.Add(time.Hour)
+	if _, err := c.Count(context.Background(), "password"); err != nil {
+		t.Fatalf("Count() failed: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2 after cache expired", requests)
+	}
+}
+
+func TestCountNotBreached(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rangeBody))
+	}))
+	defer srv.Close()
+
+	c := pwned.New(pwned.WithURL(srv.URL + "/"))
+
+	got, err := c.Count(context.Background(), "a password not in the range")
+	if err != nil {
+		t.Fatalf("Count() failed: %v", err)
+	}
+	if got != 0 {
+		t.Errorf("Count() = %d, want 0", got)
+	}
+}
+
+func TestCountErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"status", http.StatusServiceUnavailable, "", pwned.ErrStatus},
+		{"noColon", http.StatusOK, "ABC\r\n", pwned.ErrInvalidRange},
+		{"badCount", http.StatusOK, "ABC:x\r\n", pwned.ErrInvalidRange},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			c := pwned.New(pwned.WithURL(srv.URL + "/"))
+
+			_, err := c.Count(context.Background(), "password")
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Count() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountOffline(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.ToLower(rangeBody)), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The URL is never used in offline mode.
+	c := pwned.New(pwned.WithDir(dir), pwned.WithURL("http://invalid.invalid/"))
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"password", 9545824},
+		{"no range file", 0},
+	}
+
+	for _, tc := range tests {
+		got, err := c.Count(context.Background(), tc.password)
+		if err != nil {
+			t.Fatalf("Count(%q) failed: %v", tc.password, err)
+		}
+		if got != tc.want {
+			t.Errorf("Count(%q) = %d, want %d", tc.password, got, tc.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package util
 import (
 	"crypto/rand"
 	"errors"
+	"io"
 	"math/big"
 	"unicode/utf8"
 )
@@ -14,6 +15,12 @@ import (
 // from characters in the charset. This version is Unicode-aware and works
 // correctly with multi-byte characters.
 func RandomStringFromCharset(charset string, length int) (string, error) {
+	return RandomStringFromCharsetReader(rand.Reader, charset, length)
+}
+
+// RandomStringFromCharsetReader is like RandomStringFromCharset but reads
+// random bytes from r instead of crypto/rand.
+func RandomStringFromCharsetReader(r io.Reader, charset string, length int) (string, error) {
 	if utf8.RuneCountInString(charset) == 0 {
 		return "", errors.New("empty charset")
 	}
@@ -31,7 +38,7 @@ func RandomStringFromCharset(charset string, length int) (string, error) {
 
 	buffer := make([]rune, length)
 	for i := 0; i < length; i++ {
-		index, err := rand.Int(rand.Reader, charsetLen)
+		index, err := rand.Int(r, charsetLen)
 		if err != nil {
 			return "", err
 		}
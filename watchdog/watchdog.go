@@ -0,0 +1,204 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package watchdog samples runtime gauges, such as the number of goroutines
+// or open file descriptors, and warns when they grow steadily past a
+// threshold, which usually indicates a leak.
+//
+// The latest sample of each gauge is published with expvar under
+// "watchdog", so it is visible at /debug/vars.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Gauge returns the current value of a measurement.
+type Gauge func() (int, error)
+
+// Goroutines is a Gauge of the number of goroutines.
+func Goroutines() (int, error) {
+	return runtime.NumGoroutine(), nil
+}
+
+// ErrUnsupported indicates a Gauge is not available on this platform.
+var ErrUnsupported = errors.New("unsupported platform")
+
+// OpenFDs is a Gauge of the number of open file descriptors. It is only
+// supported on Linux.
+func OpenFDs() (int, error) {
+	if runtime.GOOS != "linux" {
+		return 0, ErrUnsupported
+	}
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// Defaults used if not set by an Option.
+const (
+	DefaultInterval = time.Minute
+	DefaultWindow   = 5
+)
+
+// metrics holds the latest sample of each gauge.
+var metrics = expvar.NewMap("watchdog")
+
+// watch is a Gauge with its threshold and recent samples.
+type watch struct {
+	name      string
+	gauge     Gauge
+	threshold int
+	samples   []int
+	warned    bool
+}
+
+// Watchdog periodically samples gauges.
+type Watchdog struct {
+	mu       sync.Mutex
+	interval time.Duration
+	window   int
+	watches  []*watch
+}
+
+// Option configures a Watchdog.
+type Option func(*Watchdog)
+
+// WithInterval returns an Option to set the time between samples.
+func WithInterval(d time.Duration) Option {
+	return func(w *Watchdog) {
+		w.interval = d
+	}
+}
+
+// WithWindow returns an Option to set the number of consecutive increases
+// required before a gauge over its threshold is considered to be leaking.
+func WithWindow(n int) Option {
+	return func(w *Watchdog) {
+		w.window = n
+	}
+}
+
+// WithGauge returns an Option to watch gauge, warning if it grows past
+// threshold.
+func WithGauge(name string, gauge Gauge, threshold int) Option {
+	return func(w *Watchdog) {
+		w.watches = append(w.watches, &watch{name: name, gauge: gauge, threshold: threshold})
+	}
+}
+
+// New returns a Watchdog with the given options.
+func New(opts ...Option) *Watchdog {
+	w := &Watchdog{interval: DefaultInterval, window: DefaultWindow}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.window < 1 {
+		w.window = 1
+	}
+
+	return w
+}
+
+// Warning describes a gauge that appears to be leaking.
+type Warning struct {
+	Name      string
+	Value     int
+	Threshold int
+	Samples   []int // Samples are the recent increasing values.
+}
+
+// Sample reads each gauge once and returns a Warning for each gauge that
+// is over its threshold and increased on each of the last window samples.
+// A gauge is only reported again after it stops growing or drops below
+// its threshold.
+func (w *Watchdog) Sample() []Warning {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var warnings []Warning
+
+	for _, wt := range w.watches {
+		value, err := wt.gauge()
+		if err != nil {
+			slog.Debug("failed to sample gauge", "name", wt.name, "err", err)
+			continue
+		}
+
+		v := new(expvar.Int)
+		v.Set(int64(value))
+		metrics.Set(wt.name, v)
+
+		wt.samples = append(wt.samples, value)
+		if len(wt.samples) > w.window+1 {
+			wt.samples = wt.samples[1:]
+		}
+
+		if !(value > wt.threshold && increasing(wt.samples, w.window)) {
+			wt.warned = false
+			continue
+		}
+		if wt.warned {
+			continue
+		}
+		wt.warned = true
+
+		warning := Warning{
+			Name:      wt.name,
+			Value:     value,
+			Threshold: wt.threshold,
+			Samples:   append([]int(nil), wt.samples...),
+		}
+		slog.Warn("possible leak",
+			slog.String("name", warning.Name),
+			slog.Int("value", warning.Value),
+			slog.Int("threshold", warning.Threshold),
+			slog.Any("samples", warning.Samples))
+		warnings = append(warnings, warning)
+	}
+
+	return warnings
+}
+
+// increasing returns true if samples has window increases in a row.
+func increasing(samples []int, window int) bool {
+	if len(samples) < window+1 {
+		return false
+	}
+
+	for i := 1; i < len(samples); i++ {
+		if samples[i] <= samples[i-1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Run samples the gauges every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Sample()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package watchdog_test
+
+import (
+	"errors"
+	"expvar"
+	"runtime"
+	"testing"
+
+	"github.com/bnixon67/webapp/watchdog"
+)
+
+// sequence returns a Gauge that returns each value in turn.
+func sequence(values ...int) watchdog.Gauge {
+	var i int
+	return func() (int, error) {
+		v := values[i]
+		if i < len(values)-1 {
+			i++
+		}
+		return v, nil
+	}
+}
+
+func TestSample(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []int
+		threshold int
+		want      []bool // want is true if a warning is expected per sample.
+	}{
+		{
+			name:      "belowThreshold",
+			values:    []int{1, 2, 3, 4, 5},
+			threshold: 10,
+			want:      []bool{false, false, false, false, false},
+		},
+		{
+			name:      "growing",
+			values:    []int{10, 11, 12, 13, 14, 15},
+			threshold: 5,
+			want:      []bool{false, false, false, true, false, false},
+		},
+		{
+			name:      "notMonotonic",
+			values:    []int{10, 11, 11, 12, 13, 14},
+			threshold: 5,
+			want:      []bool{false, false, false, false, false, true},
+		},
+		{
+			name:      "warnsAgainAfterRecovery",
+			values:    []int{10, 11, 12, 13, 12, 13, 14, 15},
+			threshold: 5,
+			want:      []bool{false, false, false, true, false, false, false, true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := watchdog.New(
+				watchdog.WithWindow(3),
+				watchdog.WithGauge(tc.name, sequence(tc.values...), tc.threshold),
+			)
+
+			for i, want := range tc.want {
+				got := w.Sample()
+				if (len(got) == 1) != want {
+					t.Errorf("sample %d (%d): got %v, want warning %v",
+						i, tc.values[i], got, want)
+				}
+			}
+
+			v := expvar.Get("watchdog").(*expvar.Map).Get(tc.name)
+			if v == nil || v.String() == "" {
+				t.Errorf("expvar not published for %s", tc.name)
+			}
+		})
+	}
+}
+
+func TestSampleGaugeError(t *testing.T) {
+	w := watchdog.New(watchdog.WithWindow(1), watchdog.WithGauge("err",
+		func() (int, error) { return 0, errors.New("failed") }, 0))
+
+	for i := 0; i < 3; i++ {
+		if got := w.Sample(); len(got) != 0 {
+			t.Errorf("Sample() = %v, want no warnings", got)
+		}
+	}
+}
+
+func TestGauges(t *testing.T) {
+	if n, err := watchdog.Goroutines(); err != nil || n < 1 {
+		t.Errorf("Goroutines() = %d, %v", n, err)
+	}
+
+	n, err := watchdog.OpenFDs()
+	if runtime.GOOS == "linux" {
+		if err != nil || n < 1 {
+			t.Errorf("OpenFDs() = %d, %v", n, err)
+		}
+	} else if !errors.Is(err, watchdog.ErrUnsupported) {
+		t.Errorf("OpenFDs() err = %v, want %v", err, watchdog.ErrUnsupported)
+	}
+}
@@ -17,8 +17,16 @@ import (
 // AppConfig holds settings related to the web application itself.
 type AppConfig struct {
 	Name        string `required:"true"` // Name of the web application.
-	AssetsDir   string // Directory for static web assets.
-	TmplPattern string // Glob pattern for template files.
+	AssetsDir   string // Directory for static web assets, the embedded copy if empty.
+	TmplPattern string // Glob pattern for template files, the assets in tmpl if empty.
+
+	// TmplLeftDelim and TmplRightDelim are the delimiters of template
+	// actions, if not the defaults, {{ and }}.
+	TmplLeftDelim  string
+	TmplRightDelim string
+
+	TimeZone  string   // Time zone of pages, webutil.DefaultTimeZone if empty.
+	TimeZones []string // Time zones pages may use, any if empty.
 }
 
 // Config consolidates configs, including app, server, and log settings.
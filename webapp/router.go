@@ -0,0 +1,157 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webapp
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Middleware wraps a handler to add behavior, such as logging requests.
+type Middleware func(http.Handler) http.Handler
+
+// Route declares a route of a Router.
+type Route struct {
+	Path       string       // Path is a pattern without a method, such as "/users/{id}".
+	Methods    []string     // Methods are those allowed, or any if empty. GET also allows HEAD.
+	Handler    http.Handler // Handler serves the requests that are allowed.
+	Roles      []string     // Roles are the roles, any of which is required.
+	Middleware []Middleware // Middleware wraps Handler, the first outermost.
+
+	// Options declare more of the route for the route inventory, such as
+	// its title in menus.
+	Options []webhandler.RouteOption
+}
+
+// Group declares routes that share a path prefix, roles, and middleware.
+// The Roles of the group are required by routes that do not declare their
+// own, and its Middleware wraps that of each route.
+type Group struct {
+	Prefix     string // Prefix is added to the path of each route, such as "/admin".
+	Roles      []string
+	Middleware []Middleware
+	Routes     []Route
+}
+
+// Router registers declared routes with a webhandler.Mux, so each route
+// gets its method checking, role checking, and middleware from one place.
+// A request passes, in order, the Middleware of the Router, the method
+// check, the Middleware of the group, the role check, and the Middleware
+// of the route. A request with a method the route does not allow gets
+// http.StatusMethodNotAllowed with an Allow header.
+type Router struct {
+	Mux *webhandler.Mux
+
+	// RequireRole returns next wrapped to require a logged in user with
+	// one of roles, such as webauth.AuthApp.RequireRole. It must be set to
+	// add routes with Roles.
+	RequireRole func(next http.Handler, roles ...string) http.Handler
+
+	// Middleware wraps every route, the first outermost, inside any
+	// middleware applied to the Router as a whole.
+	Middleware []Middleware
+}
+
+// NewRouter returns a Router with a new Mux.
+func NewRouter() *Router {
+	return &Router{Mux: webhandler.NewMux()}
+}
+
+// ServeHTTP dispatches the request to the route that matches it.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.Mux.ServeHTTP(w, r)
+}
+
+// Add registers routes. Like http.ServeMux.Handle, it panics if a route
+// is invalid or conflicts with another.
+func (rt *Router) Add(routes ...Route) {
+	for _, route := range routes {
+		rt.add(route, nil)
+	}
+}
+
+// AddGroup registers the routes of groups, as Add does.
+func (rt *Router) AddGroup(groups ...Group) {
+	for _, g := range groups {
+		for _, route := range g.Routes {
+			route.Path = g.Prefix + route.Path
+			if len(route.Roles) == 0 {
+				route.Roles = g.Roles
+			}
+			rt.add(route, g.Middleware)
+		}
+	}
+}
+
+// add registers route with its handler wrapped by outer, the middleware
+// of its group.
+func (rt *Router) add(route Route, outer []Middleware) {
+	switch {
+	case !strings.HasPrefix(route.Path, "/"):
+		panic(fmt.Sprintf("webapp: route path %q must start with /", route.Path))
+	case route.Handler == nil:
+		panic(fmt.Sprintf("webapp: route %q has no handler", route.Path))
+	case len(route.Roles) > 0 && rt.RequireRole == nil:
+		panic(fmt.Sprintf("webapp: route %q has roles but Router has no RequireRole", route.Path))
+	}
+
+	h := wrap(route.Handler, route.Middleware)
+
+	if len(route.Roles) > 0 {
+		h = rt.RequireRole(h, route.Roles...)
+		route.Options = append(route.Options, webhandler.RouteRoles(route.Roles...))
+	}
+
+	h = wrap(h, outer)
+
+	if len(route.Methods) > 0 {
+		methods := allowedMethods(route.Methods)
+		h = allowMethods(h, methods)
+		route.Options = append(route.Options, webhandler.RouteMethods(methods...))
+	}
+
+	rt.Mux.Handle(route.Path, wrap(h, rt.Middleware), route.Options...)
+}
+
+// wrap returns h wrapped by middleware, the first outermost.
+func wrap(h http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// allowedMethods returns methods with HEAD added if GET is allowed.
+func allowedMethods(methods []string) []string {
+	allowed := slices.Clone(methods)
+	if slices.Contains(allowed, http.MethodGet) && !slices.Contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+
+	return allowed
+}
+
+// allowMethods returns a handler that calls next only for requests with
+// one of methods. Otherwise, it responds with http.StatusMethodNotAllowed
+// and the methods in the Allow header.
+func allowMethods(next http.Handler, methods []string) http.Handler {
+	allow := strings.Join(methods, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(methods, r.Method) {
+			w.Header().Set("Allow", allow)
+			webutil.Error(w, r, http.StatusMethodNotAllowed, "", "")
+			webhandler.RequestLogger(r).Error("invalid method", "method", r.Method)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webapp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// textHandler responds with text.
+func textHandler(text string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, text)
+	})
+}
+
+// tag returns middleware that adds name to the X-Trace header, to record
+// the order in which middleware runs.
+func tag(name string) webapp.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireRole allows requests with a role in the X-Role header.
+func requireRole(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(roles, r.Header.Get("X-Role")) {
+			w.Header().Add("X-Trace", "denied")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Add("X-Trace", "role")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestRouter(t *testing.T) {
+	rt := webapp.NewRouter()
+	rt.RequireRole = requireRole
+	rt.Middleware = []webapp.Middleware{tag("router")}
+
+	rt.Add(
+		webapp.Route{Path: "/hello", Methods: []string{http.MethodGet}, Handler: textHandler("hello")},
+		webapp.Route{Path: "/any", Handler: textHandler("any"), Middleware: []webapp.Middleware{tag("a"), tag("b")}},
+	)
+	rt.AddGroup(webapp.Group{
+		Prefix:     "/admin",
+		Roles:      []string{"admin"},
+		Middleware: []webapp.Middleware{tag("group")},
+		Routes: []webapp.Route{
+			{Path: "/users", Methods: []string{http.MethodGet, http.MethodPost}, Handler: textHandler("users"), Middleware: []webapp.Middleware{tag("route")}},
+			{Path: "/reports", Handler: textHandler("reports"), Roles: []string{"auditor"}},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		role      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+		wantTrace []string
+	}{
+		{"get", http.MethodGet, "/hello", "", http.StatusOK, "hello", "", []string{"router"}},
+		{"head", http.MethodHead, "/hello", "", http.StatusOK, "", "", []string{"router"}},
+		{"post", http.MethodPost, "/hello", "", http.StatusMethodNotAllowed, "Error: Method Not Allowed\n", "GET, HEAD", []string{"router"}},
+		{"any method", http.MethodDelete, "/any", "", http.StatusOK, "any", "", []string{"router", "a", "b"}},
+		{"group", http.MethodPost, "/admin/users", "admin", http.StatusOK, "users", "", []string{"router", "group", "role", "route"}},
+		{"group denied", http.MethodGet, "/admin/users", "", http.StatusUnauthorized, "Unauthorized\n", "", []string{"router", "group", "denied"}},
+		{"group method before role", http.MethodPut, "/admin/users", "", http.StatusMethodNotAllowed, "Error: Method Not Allowed\n", "GET, POST, HEAD", []string{"router"}},
+		{"route roles", http.MethodGet, "/admin/reports", "auditor", http.StatusOK, "reports", "", []string{"router", "group", "role"}},
+		{"route roles replace group", http.MethodGet, "/admin/reports", "admin", http.StatusUnauthorized, "Unauthorized\n", "", []string{"router", "group", "denied"}},
+		{"not found", http.MethodGet, "/missing", "", http.StatusNotFound, "404 page not found\n", "", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			if tc.role != "" {
+				r.Header.Set("X-Role", tc.role)
+			}
+			w := httptest.NewRecorder()
+
+			rt.ServeHTTP(w, r)
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if tc.method != http.MethodHead && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tc.wantBody)
+			}
+			if got := w.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tc.wantAllow)
+			}
+			if got := w.Header().Values("X-Trace"); !slices.Equal(got, tc.wantTrace) {
+				t.Errorf("X-Trace = %v, want %v", got, tc.wantTrace)
+			}
+		})
+	}
+}
+
+func TestRouterInventory(t *testing.T) {
+	rt := webapp.NewRouter()
+	rt.RequireRole = requireRole
+	rt.AddGroup(webapp.Group{
+		Prefix: "/admin",
+		Roles:  []string{"admin"},
+		Routes: []webapp.Route{
+			{Path: "/users", Methods: []string{http.MethodGet}, Handler: textHandler("users"), Options: []webhandler.RouteOption{webhandler.RouteTitle("Users")}},
+		},
+	})
+
+	routes := rt.Mux.Routes()
+	if len(routes) != 1 {
+		t.Fatalf("Routes() = %v, want 1 route", routes)
+	}
+	got := routes[0]
+	if got.Path != "/admin/users" || got.Title != "Users" ||
+		!slices.Equal(got.Methods, []string{http.MethodGet, http.MethodHead}) ||
+		!slices.Equal(got.Roles, []string{"admin"}) || !got.Login {
+		t.Errorf("route = %+v, want /admin/users for admin with GET and HEAD", got)
+	}
+}
+
+func TestRouterInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		route webapp.Route
+		want  string
+	}{
+		{"method in path", webapp.Route{Path: "GET /x", Handler: textHandler("x")}, "must start with /"},
+		{"no handler", webapp.Route{Path: "/x"}, "no handler"},
+		{"no RequireRole", webapp.Route{Path: "/x", Handler: textHandler("x"), Roles: []string{"admin"}}, "no RequireRole"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, tc.want) {
+					t.Errorf("panic = %q, want it to contain %q", msg, tc.want)
+				}
+			}()
+
+			webapp.NewRouter().Add(tc.route)
+		})
+	}
+}
@@ -22,6 +22,7 @@ type WebApp struct {
 	Config                           // Provides embedded AppConfig.
 	Tmpl          *template.Template // Tmpl holds parsed templates.
 	BuildDateTime time.Time          // Time executable last modified.
+	TimeZones     *webutil.TimeZones // TimeZones converts times for pages.
 }
 
 // String returns a string representation of WebApp.
@@ -51,8 +52,17 @@ func WithTemplate(tmpl *template.Template) Option {
 	}
 }
 
+// WithTimeZones creates an Option to set the time zones of the WebApp,
+// which must also be used by the template functions.
+func WithTimeZones(tz *webutil.TimeZones) Option {
+	return func(app *WebApp) {
+		app.TimeZones = tz
+	}
+}
+
 // New creates a new WebApp instance with the provided options,
 // initializing its BuildDateTime to the executable's modification time.
+// If no TimeZones are given, webutil.DefaultTimeZone is used.
 //
 // It returns an error if the name is not specified or if it encounters
 // issues determining the build time.
@@ -72,6 +82,14 @@ func New(opts ...Option) (*WebApp, error) {
 		return nil, errors.New("missing Name")
 	}
 
+	// Default to the time zone used before it was configurable.
+	if app.TimeZones == nil {
+		app.TimeZones, err = webutil.NewTimeZones("", nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	logIfDebug(app)
 
 	return app, nil
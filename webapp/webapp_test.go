@@ -9,6 +9,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/bnixon67/webapp/i18n"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/weblog"
 	"github.com/bnixon67/webapp/webutil"
@@ -97,6 +98,9 @@ var (
 	testApp  *webapp.WebApp
 )
 
+// tzForTest converts the times of templates in tests.
+var tzForTest, _ = webutil.NewTimeZones("", nil)
+
 func AppForTest(t *testing.T) *webapp.WebApp {
 	initOnce.Do(func() {
 		cfg, err := webapp.LoadConfigFromJSON(TestConfigFile)
@@ -110,8 +114,13 @@ func AppForTest(t *testing.T) *webapp.WebApp {
 		}
 
 		funcMap := template.FuncMap{
-			"ToTimeZone": webutil.ToTimeZone,
-			"Join":       webutil.Join,
+			"ToTimeZone":   tzForTest.ToTimeZone,
+			"LocalTime":    tzForTest.LocalTime,
+			"RelativeTime": tzForTest.RelativeTime,
+			"Join":         webutil.Join,
+			"CSRFField":    webutil.CSRFField,
+			"NonceAttr":    webutil.NonceAttr,
+			"T":            i18n.T,
 		}
 
 		tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern, funcMap)
@@ -0,0 +1,292 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DeleteTokenKind    = "delete"
+	DeleteTokenSize    = 32
+	DeleteTokenExpires = "1h"
+)
+
+var (
+	ErrDeleteTokenNotFound = errors.New("delete token not found")
+	ErrDeleteTokenExpired  = errors.New("delete token expired")
+	ErrDeleteTokenUser     = errors.New("delete token for another user")
+	ErrDeleteDisabled      = errors.New("account deletion disabled")
+)
+
+// AccountExport is the data of a user, exported as JSON before their
+// account is deleted.
+type AccountExport struct {
+	User            User
+	EmailPrefs      EmailPrefs
+	UsernameHistory []UsernameChange
+	Prefs           map[string]string
+	Events          []Event
+}
+
+// UsernameForDeleteToken returns the username for a delete token.
+//
+// If token is not found, ErrDeleteTokenNotFound is returned.
+//
+// If token is expired, ErrDeleteTokenExpired is returned and token is removed.
+func (db *AuthDB) UsernameForDeleteToken(tokenValue string) (string, error) {
+	var username string
+	var expires time.Time
+
+	qry := `SELECT users.username, tokens.expires FROM tokens JOIN users ON tokens.user_id = users.id WHERE kind = ? AND hashedValue = ? LIMIT 1`
+	err := db.QueryRow(qry, DeleteTokenKind, Hash(tokenValue)).Scan(&username, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrDeleteTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Check if token is expired.
+	if expires.Before(db.now()) {
+		db.RemoveToken(DeleteTokenKind, tokenValue)
+		return "", ErrDeleteTokenExpired
+	}
+
+	return username, nil
+}
+
+// ScheduleDeletion schedules the account of username to be purged at at.
+// A zero at cancels a scheduled deletion.
+func (db *AuthDB) ScheduleDeletion(username string, at time.Time) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	exists, err := db.UserExists(username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	var deleteAfter sql.NullTime
+	if !at.IsZero() {
+		deleteAfter = sql.NullTime{Time: at, Valid: true}
+	}
+
+	_, err = db.Exec(`UPDATE users SET delete_after = ? WHERE username = ?`, deleteAfter, username)
+
+	return err
+}
+
+// DeletionScheduled returns when the account of username will be purged,
+// or the zero time if its deletion is not scheduled.
+func (db *AuthDB) DeletionScheduled(username string) (time.Time, error) {
+	if db == nil {
+		return time.Time{}, ErrInvalidDB
+	}
+
+	var deleteAfter sql.NullTime
+	err := db.QueryRow(`SELECT delete_after FROM users WHERE username = ?`, username).Scan(&deleteAfter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return deleteAfter.Time, nil
+}
+
+// DueDeletions returns the usernames of accounts scheduled to be purged at
+// or before now, the earliest first.
+func (db *AuthDB) DueDeletions(now time.Time) ([]string, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	rows, err := db.Query(`SELECT username FROM users WHERE delete_after IS NOT NULL AND delete_after <= ? ORDER BY delete_after`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, rows.Err()
+}
+
+// PurgeUser deletes username and the data linked to them, and replaces
+// their username in their events with their Pseudonym, like DeleteUsers.
+func (db *AuthDB) PurgeUser(username string) error {
+	results, err := db.DeleteUsers([]string{username})
+	if err != nil {
+		return err
+	}
+
+	return results[0].Err
+}
+
+// EventsForUser returns the events of username, newest first.
+func (db *AuthDB) EventsForUser(username string) ([]Event, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT ` + eventColumns + ` FROM events WHERE ` + eventsForUser + ` ORDER BY created DESC`
+
+	return db.scanEvents(qry, username, username)
+}
+
+// Template for the email to confirm the deletion of an account.
+const emailDeleteTemplate = `
+To confirm the deletion of your {{.Title}} account, please visit {{.BaseURL}}/account/delete?dtoken={{.Token.Value}} by {{.Token.Expires.Format "January 2, 2006 3:04 PM MST"}}.
+
+You can ignore this message if you did not request to delete your account.
+`
+
+// RequestDeletion emails a link to user to confirm the deletion of their
+// account.
+func (app *AuthApp) RequestDeletion(ctx context.Context, user User) error {
+	if app.deleteGrace == 0 {
+		return ErrDeleteDisabled
+	}
+
+	token, err := app.DB.CreateToken(DeleteTokenKind, user.Username, DeleteTokenSize, DeleteTokenExpires)
+	if err != nil {
+		return err
+	}
+
+	body, err := app.emailBody(ctx, "delete", emailDeleteTemplate,
+		emailData{Token: token, Title: app.Cfg.App.Name, BaseURL: app.Cfg.Auth.BaseURL})
+	if err != nil {
+		return err
+	}
+
+	subj := app.Printer(ctx).T("%s confirm account deletion", app.Cfg.App.Name)
+	return app.sendEmail(ctx, user.Email, subj, body, nil)
+}
+
+// ConfirmDeletion uses the delete token value of user to schedule the
+// deletion of their account after Config.Auth.DeleteGrace and returns when
+// it will be purged. The token must belong to user, so that a link sent
+// by email cannot delete the account of whoever opens it.
+func (app *AuthApp) ConfirmDeletion(user User, value string) (time.Time, error) {
+	if app.deleteGrace == 0 {
+		return time.Time{}, ErrDeleteDisabled
+	}
+
+	username, err := app.DB.UsernameForDeleteToken(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if username != user.Username {
+		return time.Time{}, ErrDeleteTokenUser
+	}
+
+	if err := app.DB.RemoveToken(DeleteTokenKind, value); err != nil {
+		return time.Time{}, err
+	}
+
+	at := app.Clock.Now().Add(app.deleteGrace)
+	if err := app.DB.ScheduleDeletion(username, at); err != nil {
+		return time.Time{}, err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeDeleteScheduled, username, EventDetails{"at": at.UTC().Format(time.RFC3339)}))
+
+	return at, nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the account of username.
+func (app *AuthApp) CancelDeletion(username string) error {
+	if err := app.DB.ScheduleDeletion(username, time.Time{}); err != nil {
+		return err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeDeleteCanceled, username, nil))
+
+	return nil
+}
+
+// ExportAccount returns the data of username to export.
+func (app *AuthApp) ExportAccount(username string) (AccountExport, error) {
+	var (
+		export AccountExport
+		err    error
+	)
+
+	export.User, err = app.DB.UserForName(username)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	export.EmailPrefs, err = app.DB.EmailPrefs(username)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	export.UsernameHistory, err = app.DB.UsernameHistory(username)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	names, err := app.DB.PrefNames(username, "")
+	if err != nil {
+		return AccountExport{}, err
+	}
+	export.Prefs = make(map[string]string, len(names))
+	for _, name := range names {
+		export.Prefs[name], err = app.DB.Pref(username, name)
+		if err != nil {
+			return AccountExport{}, err
+		}
+	}
+
+	export.Events, err = app.DB.EventsForUser(username)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	return export, nil
+}
+
+// PurgeDeletedAccounts purges the accounts whose deletion is due and
+// returns the number purged. A delete event is written first, so that it
+// is anonymized with the other events of the user as a record of the
+// deletion.
+func (app *AuthApp) PurgeDeletedAccounts() (int, error) {
+	usernames, err := app.DB.DueDeletions(app.Clock.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int
+	for _, username := range usernames {
+		app.DB.RecordEvent(NewEvent(TypeDeletePurged, username, nil))
+
+		if err := app.DB.PurgeUser(username); err != nil {
+			return purged, fmt.Errorf("purge %s: %w", username, err)
+		}
+		purged++
+
+		slog.Info("purged deleted account", "username", username)
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const AccountDeleteTmpl = "account_delete.html"
+
+// Messages displayed to the user for an account deletion.
+const (
+	MsgDeleteInvalid  = "The link to delete your account is invalid, expired, or for another user."
+	MsgDeleteCanceled = "The deletion of your account was canceled."
+	MsgDeleteUsername = "Please enter your username to confirm."
+)
+
+// AccountDeletePageData contains data to render the account delete
+// template.
+type AccountDeletePageData struct {
+	CommonData
+	User        User
+	DeleteAfter time.Time // DeleteAfter is when a scheduled deletion is due.
+	Token       string    // Token is the token of a link to confirm.
+	EmailFrom   string    // EmailFrom is set after a link is sent.
+	Message     string
+	Wizard      WizardState // Wizard is the step before a link is sent.
+}
+
+// accountDeleteWizard returns the Wizard to confirm the deletion of the
+// account of username before a link is sent: a review of what is deleted,
+// then entering the username.
+func accountDeleteWizard(username string) *Wizard {
+	return &Wizard{
+		Name: "account-delete",
+		Steps: []WizardStep{
+			{Name: "review"},
+			{Name: "confirm", Validate: func(r *http.Request, values map[string]string) error {
+				if !strings.EqualFold(strings.TrimSpace(r.PostFormValue("username")), username) {
+					return errors.New(MsgDeleteUsername)
+				}
+				return nil
+			}},
+		},
+	}
+}
+
+// AccountDeleteHandler handles /account/delete requests of the logged in
+// user to delete their account, if Config.Auth.DeleteGrace is set.
+//
+// Otherwise, the user reviews what is deleted and enters their username,
+// using a Wizard, and then a link to confirm the deletion is sent by
+// email. A GET with the token of the link shows a button to confirm, so
+// that a link opened by an email scanner does not delete the account. Once confirmed, the
+// account is purged by RunMaintenance after the grace period, unless a
+// POST with the cancel action cancels the deletion.
+func (app *AuthApp) AccountDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.accountDeleteGet, Post: app.accountDeletePost}.ServeHTTP(w, r)
+}
+
+// accountDeleteGet serves the wizard to delete the account or, with the
+// token of the link, the button to confirm the deletion.
+func (app *AuthApp) accountDeleteGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.accountDeleteData(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("username", data.User.Username)
+
+	if token := r.URL.Query().Get("dtoken"); token != "" {
+		data.Token = token
+	} else if !app.handleDeleteWizard(w, r, logger, &data) {
+		return
+	}
+
+	app.renderAccountDelete(w, r, logger, data)
+}
+
+// accountDeletePost confirms or cancels the deletion of the account, or
+// handles a step of the wizard to delete it.
+func (app *AuthApp) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.accountDeleteData(w, r, logger)
+	if !ok {
+		return
+	}
+	user := data.User
+	logger = logger.With("username", user.Username)
+
+	switch {
+	case r.PostFormValue("dtoken") != "":
+		_, err := app.ConfirmDeletion(user, r.PostFormValue("dtoken"))
+		switch {
+		case errors.Is(err, ErrDeleteTokenNotFound),
+			errors.Is(err, ErrDeleteTokenExpired),
+			errors.Is(err, ErrDeleteTokenUser):
+			logger.Warn("invalid token", "err", err)
+			data.Message = MsgDeleteInvalid
+		case err != nil:
+			logger.Error("failed to schedule deletion", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		default:
+			logger.Info("scheduled deletion")
+		}
+
+	case r.PostFormValue("action") == "cancel":
+		err := app.CancelDeletion(user.Username)
+		if err != nil {
+			logger.Error("failed to cancel deletion", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+		logger.Info("canceled deletion")
+		data.Message = MsgDeleteCanceled
+
+	default:
+		if !app.handleDeleteWizard(w, r, logger, &data) {
+			return
+		}
+	}
+
+	app.renderAccountDelete(w, r, logger, data)
+}
+
+// accountDeleteData returns the data of the account deletion page of the
+// logged in user. If deletion is not enabled or the user cannot be found,
+// an error is written, and if the user is not logged in, the page is
+// rendered, and false is returned.
+func (app *AuthApp) accountDeleteData(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (AccountDeletePageData, bool) {
+	if app.deleteGrace == 0 {
+		logger.Warn("account deletion not enabled")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return AccountDeletePageData{}, false
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return AccountDeletePageData{}, false
+	}
+
+	data := AccountDeletePageData{User: user}
+	if user.Username == "" {
+		app.RenderPage(w, r, logger, AccountDeleteTmpl, &data)
+		return AccountDeletePageData{}, false
+	}
+
+	return data, true
+}
+
+// handleDeleteWizard handles a step of the wizard of data and, once it
+// is done, requests the deletion. If it fails, an error is written and
+// false is returned.
+func (app *AuthApp) handleDeleteWizard(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data *AccountDeletePageData) bool {
+	var err error
+	data.Wizard, err = accountDeleteWizard(data.User.Username).Handle(r, app.Session(r))
+	if err != nil {
+		logger.Error("failed to save wizard", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return false
+	}
+	if !data.Wizard.Done {
+		return true
+	}
+
+	err = app.RequestDeletion(r.Context(), data.User)
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
+		logger.Error("failed to request deletion", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return false
+	}
+	data.EmailFrom = app.Cfg.EmailFrom
+
+	return true
+}
+
+// renderAccountDelete renders the account deletion page of data with the
+// scheduled deletion of the user.
+func (app *AuthApp) renderAccountDelete(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data AccountDeletePageData) {
+	var err error
+	data.DeleteAfter, err = app.DB.DeletionScheduled(data.User.Username)
+	if err != nil {
+		logger.Error("failed to get scheduled deletion", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.RenderPage(w, r, logger, AccountDeleteTmpl, &data)
+
+	logger.Info("done")
+}
+
+// AccountExportHandler responds with the data of the logged in user as a
+// JSON attachment, so they can keep a copy before deleting their account.
+func (app *AuthApp) AccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	if user.Username == "" {
+		logger.Warn("no user")
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+	logger = logger.With("username", user.Username)
+
+	export, err := app.ExportAccount(user.Username)
+	if err != nil {
+		logger.Error("failed to export account", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment;filename=account.json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		logger.Error("failed to encode export", "err", err)
+		return
+	}
+
+	logger.Info("done")
+}
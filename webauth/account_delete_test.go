@@ -0,0 +1,258 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withDeleteGrace returns a config modifier that enables account deletion.
+func withDeleteGrace(d string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.DeleteGrace = d
+	}
+}
+
+func TestMemStoreAccountDeletion(t *testing.T) {
+	store := StoreForTest(t)
+	now := time.Now()
+
+	if err := store.ScheduleDeletion("missing", now); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("ScheduleDeletion() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+
+	if err := store.ScheduleDeletion("test", now.Add(time.Hour)); err != nil {
+		t.Fatalf("ScheduleDeletion() failed: %v", err)
+	}
+	if err := store.ScheduleDeletion("admin", now.Add(-time.Hour)); err != nil {
+		t.Fatalf("ScheduleDeletion() failed: %v", err)
+	}
+	if at, err := store.DeletionScheduled("test"); err != nil || !at.Equal(now.Add(time.Hour)) {
+		t.Errorf("DeletionScheduled() = %v, %v, want %v", at, err, now.Add(time.Hour))
+	}
+
+	due, err := store.DueDeletions(now.Add(2 * time.Hour))
+	if err != nil || !slices.Equal(due, []string{"admin", "test"}) {
+		t.Errorf("DueDeletions() = %v, %v, want [admin test]", due, err)
+	}
+
+	if err := store.ScheduleDeletion("test", time.Time{}); err != nil {
+		t.Fatalf("ScheduleDeletion() to cancel failed: %v", err)
+	}
+	if due, _ := store.DueDeletions(now.Add(2 * time.Hour)); !slices.Equal(due, []string{"admin"}) {
+		t.Errorf("DueDeletions() after cancel = %v, want [admin]", due)
+	}
+
+	user, err := store.UserForName("test")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+	store.WriteEvent(webauth.EventLogin, true, "test", "")
+	if err := store.PurgeUser("test"); err != nil {
+		t.Fatalf("PurgeUser() failed: %v", err)
+	}
+	if exists, _ := store.UserExists("test"); exists {
+		t.Error("user exists after PurgeUser()")
+	}
+	if events, _ := store.EventsForUser("test"); len(events) != 0 {
+		t.Errorf("EventsForUser() after PurgeUser() = %v, want none", events)
+	}
+	if events := eventsOf(t, store, webauth.Pseudonym(user.ID)); len(events) != 1 || events[0].Name != webauth.EventLogin {
+		t.Errorf("events of pseudonym after PurgeUser() = %+v, want the login event", events)
+	}
+	if err := store.PurgeUser("test"); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("PurgeUser() again = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+}
+
+func TestAccountDeleteHandler(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){withDeleteGrace("168h")},
+		webauth.WithDB(store), webauth.WithClock(clock))
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	request := func(method, target string, data url.Values) string {
+		w := requestAs(app.AccountDeleteHandler, login.Value, method, target, data.Encode())
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d, want %d", method, target, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	// The wizard reviews the deletion and confirms the username before
+	// sending the link.
+	for _, step := range []struct {
+		name   string
+		method string
+		data   url.Values
+		want   string
+	}{
+		{"start", http.MethodGet, nil, `id="next"`},
+		{"review", http.MethodPost, url.Values{"action": {"next"}}, `id="request"`},
+		{"resume", http.MethodGet, nil, `id="request"`},
+		{"back", http.MethodPost, url.Values{"action": {"back"}}, `id="next"`},
+		{"next", http.MethodPost, url.Values{"action": {"next"}}, `id="request"`},
+		{"wrongUsername", http.MethodPost, url.Values{"action": {"next"}, "username": {"admin"}}, webauth.MsgDeleteUsername},
+		{"confirm", http.MethodPost, url.Values{"action": {"next"}, "username": {"Test"}}, app.Cfg.EmailFrom},
+		{"restart", http.MethodGet, nil, `id="next"`},
+	} {
+		if body := request(step.method, "/account/delete", step.data); !strings.Contains(body, step.want) {
+			t.Errorf("%s got %q, expected %q in body", step.name, body, step.want)
+		}
+	}
+
+	other, err := store.CreateToken(webauth.DeleteTokenKind, "admin", webauth.DeleteTokenSize, webauth.DeleteTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if body := request(http.MethodPost, "/account/delete", url.Values{"dtoken": {other.Value}}); !strings.Contains(body, webauth.MsgDeleteInvalid) {
+		t.Errorf("token of other user got %q, expected %q in body", body, webauth.MsgDeleteInvalid)
+	}
+
+	token, err := store.CreateToken(webauth.DeleteTokenKind, "test", webauth.DeleteTokenSize, webauth.DeleteTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if body := request(http.MethodGet, "/account/delete?dtoken="+url.QueryEscape(token.Value), nil); !strings.Contains(body, `id="confirm"`) {
+		t.Errorf("link got %q, want confirm button", body)
+	}
+	if body := request(http.MethodPost, "/account/delete", url.Values{"dtoken": {token.Value}}); !strings.Contains(body, `id="cancel"`) {
+		t.Errorf("confirm got %q, want cancel button", body)
+	}
+
+	// The account is not purged during the grace period.
+	clock.Advance(24 * time.Hour)
+	if n, err := app.PurgeDeletedAccounts(); n != 0 || err != nil {
+		t.Errorf("PurgeDeletedAccounts() during grace = %d, %v, want 0", n, err)
+	}
+
+	if body := request(http.MethodPost, "/account/delete", url.Values{"action": {"cancel"}}); !strings.Contains(body, webauth.MsgDeleteCanceled) {
+		t.Errorf("cancel got %q, expected %q in body", body, webauth.MsgDeleteCanceled)
+	}
+	clock.Advance(168 * time.Hour)
+	if n, err := app.PurgeDeletedAccounts(); n != 0 || err != nil {
+		t.Errorf("PurgeDeletedAccounts() after cancel = %d, %v, want 0", n, err)
+	}
+
+	if _, err := app.ConfirmDeletion(webauth.User{Username: "test"}, token.Value); !errors.Is(err, webauth.ErrDeleteTokenNotFound) {
+		t.Errorf("ConfirmDeletion() with used token = %v, want %v", err, webauth.ErrDeleteTokenNotFound)
+	}
+
+	login, err = app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+	token, err = store.CreateToken(webauth.DeleteTokenKind, "test", webauth.DeleteTokenSize, webauth.DeleteTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	request(http.MethodPost, "/account/delete", url.Values{"dtoken": {token.Value}})
+	user, err := store.UserForName("test")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+	clock.Advance(169 * time.Hour)
+	if n, err := app.PurgeDeletedAccounts(); n != 1 || err != nil {
+		t.Fatalf("PurgeDeletedAccounts() = %d, %v, want 1", n, err)
+	}
+
+	if exists, _ := store.UserExists("test"); exists {
+		t.Error("user exists after purge")
+	}
+	if events, _ := store.EventsForUser("test"); len(events) != 0 {
+		t.Errorf("events after purge = %+v, want none", events)
+	}
+	events := eventsOf(t, store, webauth.Pseudonym(user.ID))
+	if len(events) == 0 || events[0].Name != webauth.EventDelete {
+		t.Errorf("events of pseudonym after purge = %+v, want the delete event first", events)
+	}
+}
+
+// eventsOf returns the events of store with username, newest first.
+func eventsOf(t *testing.T, store webauth.AuthStore, username string) []webauth.Event {
+	t.Helper()
+
+	all, err := store.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() failed: %v", err)
+	}
+
+	var events []webauth.Event
+	for _, e := range all {
+		if e.Username == username {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+func TestAccountDeleteHandlerDisabled(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	w := requestAs(app.AccountDeleteHandler, "", http.MethodGet, "/account/delete", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAccountExportHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	w := requestAs(app.AccountExportHandler, "", http.MethodGet, "/account/export", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without login status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+	if err := app.DB.SetPref("test", "view", "x"); err != nil {
+		t.Fatalf("SetPref() failed: %v", err)
+	}
+
+	w = requestAs(app.AccountExportHandler, login.Value, http.MethodGet, "/account/export", "")
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("Content-Disposition = %q, want attachment", w.Header().Get("Content-Disposition"))
+	}
+
+	var export webauth.AccountExport
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	if export.User.Username != "test" || export.Prefs["view"] != "x" || len(export.Events) == 0 {
+		t.Errorf("export = %+v, want user, prefs, and events", export)
+	}
+}
+
+func TestConfigDeleteGrace(t *testing.T) {
+	for _, d := range []string{"x", "0s"} {
+		cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		withDeleteGrace(d)(cfg)
+
+		_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+		if !errors.Is(err, webauth.ErrInvalidConfig) {
+			t.Errorf("NewApp() with DeleteGrace %q error = %v, want %v", d, err, webauth.ErrInvalidConfig)
+		}
+	}
+}
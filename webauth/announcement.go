@@ -0,0 +1,216 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bnixon67/webapp/websse"
+)
+
+// AnnouncementsEvent is the live stream topic of announcements, which is
+// registered on the Live server of the app.
+const AnnouncementsEvent = "announcements"
+
+// Maximum lengths of the fields of an Announcement, matching the SQL schema.
+const (
+	MaxAnnouncementTopicLen   = 30
+	MaxAnnouncementMessageLen = 255
+)
+
+// AnnouncementHistory is how long sent and canceled announcements are
+// listed.
+const AnnouncementHistory = 7 * 24 * time.Hour
+
+// DefaultAnnouncementInterval is how often RunAnnouncements checks for
+// announcements that are due.
+const DefaultAnnouncementInterval = 15 * time.Second
+
+// Announcement is a message scheduled to be published on a live stream
+// topic at PublishAt, such as "maintenance starts in 10 minutes".
+type Announcement struct {
+	ID        int64
+	Topic     string
+	Message   string
+	PublishAt time.Time
+	Created   time.Time
+	Sent      sql.NullTime // Sent is not valid until it is published.
+	Canceled  sql.NullTime // Canceled is not valid unless it was canceled.
+}
+
+// Pending returns true if a is neither sent nor canceled.
+func (a Announcement) Pending() bool {
+	return !a.Sent.Valid && !a.Canceled.Valid
+}
+
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// ScheduleAnnouncement saves a pending announcement of message on topic
+// to be published at publishAt.
+func (db *AuthDB) ScheduleAnnouncement(topic, message string, publishAt time.Time) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+	if len(topic) > MaxAnnouncementTopicLen || len(message) > MaxAnnouncementMessageLen {
+		return ErrValueTooLong
+	}
+
+	_, err := db.Exec("INSERT INTO announcements(topic, message, publish_at) VALUES (?, ?, ?)", topic, message, publishAt.UTC())
+	return err
+}
+
+// CancelAnnouncement cancels the pending announcement with id.
+func (db *AuthDB) CancelAnnouncement(id int64) error {
+	return db.setAnnouncement("canceled", id)
+}
+
+// MarkAnnouncementSent records that the pending announcement with id was
+// published.
+func (db *AuthDB) MarkAnnouncementSent(id int64) error {
+	return db.setAnnouncement("sent", id)
+}
+
+// setAnnouncement sets column, either sent or canceled, of the pending
+// announcement with id to the current time.
+func (db *AuthDB) setAnnouncement(column string, id int64) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	qry := "UPDATE announcements SET " + column + " = ? WHERE id = ? AND sent IS NULL AND canceled IS NULL"
+	result, err := db.Exec(qry, db.now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAnnouncementNotFound
+	}
+
+	return nil
+}
+
+// Announcements returns the pending announcements and those sent or
+// canceled since the given time, in order of publication.
+func (db *AuthDB) Announcements(since time.Time) ([]Announcement, error) {
+	return db.queryAnnouncements("(sent IS NULL AND canceled IS NULL) OR publish_at >= ?", since.UTC())
+}
+
+// DueAnnouncements returns the pending announcements to be published at
+// or before now, in order of publication.
+func (db *AuthDB) DueAnnouncements(now time.Time) ([]Announcement, error) {
+	return db.queryAnnouncements("sent IS NULL AND canceled IS NULL AND publish_at <= ?", now.UTC())
+}
+
+// queryAnnouncements returns the announcements that match the condition
+// where with args, in order of publication.
+func (db *AuthDB) queryAnnouncements(where string, args ...any) ([]Announcement, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT id, topic, message, publish_at, created, sent, canceled FROM announcements WHERE ` + where + ` ORDER BY publish_at, id`
+	rows, err := db.Query(qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []Announcement
+	for rows.Next() {
+		var a Announcement
+
+		err := rows.Scan(&a.ID, &a.Topic, &a.Message, &a.PublishAt, &a.Created, &a.Sent, &a.Canceled)
+		if err != nil {
+			return nil, err
+		}
+
+		announcements = append(announcements, a)
+	}
+
+	return announcements, rows.Err()
+}
+
+// AnnouncementTopic returns true if announcements can be published on
+// topic, which must be registered on the Live server. The topics of the
+// admin tables are excluded, since their clients expect rows.
+func (app *AuthApp) AnnouncementTopic(topic string) bool {
+	if app.Live == nil || topic == "" {
+		return false
+	}
+	if _, isTable := tables[topic]; isTable {
+		return false
+	}
+
+	return app.Live.EventExists(topic)
+}
+
+// PublishDueAnnouncements publishes the announcements that are due to
+// their topic on app.Live and marks them sent. It returns the number
+// published. An announcement is sent at most once, so it is marked sent
+// before it is published.
+func (app *AuthApp) PublishDueAnnouncements() (int, error) {
+	if app.Live == nil {
+		return 0, nil
+	}
+
+	due, err := app.DB.DueAnnouncements(app.Clock.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, a := range due {
+		err := app.DB.MarkAnnouncementSent(a.ID)
+		if errors.Is(err, ErrAnnouncementNotFound) {
+			// Canceled or sent by another instance.
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		msg := websse.Message{Event: a.Topic, Data: a.Message, ID: strconv.FormatInt(a.ID, 10)}
+		if err := app.publisher().Publish(msg); err != nil {
+			slog.Error("failed to publish announcement", "id", a.ID, "topic", a.Topic, "err", err)
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// RunAnnouncements publishes the announcements that are due every
+// interval until ctx is done, so they are published within interval of
+// their time. If interval is zero, DefaultAnnouncementInterval is used.
+func (app *AuthApp) RunAnnouncements(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultAnnouncementInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := app.PublishDueAnnouncements(); err != nil {
+			slog.Error("failed to publish announcements", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const AnnouncementsTmpl = "announcements.html"
+
+// AnnouncementTimeLayout is the layout of the "at" form value, as sent by
+// a datetime-local input, in the default time zone of the app.
+const AnnouncementTimeLayout = "2006-01-02T15:04"
+
+// AnnouncementsPageData contains data to render the announcements template.
+type AnnouncementsPageData struct {
+	CommonData
+	User          User
+	Announcements []Announcement
+	Topics        []string
+}
+
+// announcementJSON is the JSON form of an Announcement.
+type announcementJSON struct {
+	ID        int64      `json:"id"`
+	Topic     string     `json:"topic"`
+	Message   string     `json:"message"`
+	PublishAt time.Time  `json:"publishAt"`
+	Sent      *time.Time `json:"sent,omitempty"`
+	Canceled  *time.Time `json:"canceled,omitempty"`
+}
+
+// AnnouncementsHandler allows admins to list, schedule, and cancel
+// announcements. A GET shows the pending and recent announcements, as JSON
+// if requested. A POST has the "action" form value "schedule", with
+// "topic", "message", and "at", or "cancel", with "id".
+func (app *AuthApp) AnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.announcementsGet, Post: app.announcementsPost}.ServeHTTP(w, r)
+}
+
+// announcementsGet shows the pending and recent announcements.
+func (app *AuthApp) announcementsGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, ok := app.announcementsUser(w, r, logger)
+	if !ok {
+		return
+	}
+
+	announcements, err := app.DB.Announcements(app.Clock.Now().Add(-AnnouncementHistory))
+	if err != nil {
+		logger.Error("failed to get announcements", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	if webutil.WantsJSON(r) {
+		data := []announcementJSON{}
+		for _, a := range announcements {
+			aj := announcementJSON{ID: a.ID, Topic: a.Topic, Message: a.Message, PublishAt: a.PublishAt}
+			if a.Sent.Valid {
+				aj.Sent = &a.Sent.Time
+			}
+			if a.Canceled.Valid {
+				aj.Canceled = &a.Canceled.Time
+			}
+			data = append(data, aj)
+		}
+
+		if err := webutil.RespondWithJSON(w, http.StatusOK, data); err != nil {
+			logger.Error("failed to write JSON", "err", err)
+		}
+		return
+	}
+
+	app.RenderPage(w, r, logger, AnnouncementsTmpl, &AnnouncementsPageData{
+		User:          user,
+		Announcements: announcements,
+		Topics:        []string{AnnouncementsEvent},
+	})
+
+	logger.Info("done")
+}
+
+// announcementsUser returns the logged in user if they can manage
+// announcements. If not, an error is written and false is returned.
+func (app *AuthApp) announcementsUser(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (User, bool) {
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return User{}, false
+	}
+
+	if !user.Can(PermManageAnnouncements) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// announcementsPost schedules or cancels an announcement.
+func (app *AuthApp) announcementsPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, ok := app.announcementsUser(w, r, logger)
+	if !ok {
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "schedule":
+		topic := r.PostFormValue("topic")
+		if topic == "" {
+			topic = AnnouncementsEvent
+		}
+		message := strings.TrimSpace(r.PostFormValue("message"))
+		at, err := time.ParseInLocation(AnnouncementTimeLayout, r.PostFormValue("at"), app.TimeZones.Default())
+		if err != nil || message == "" || !app.AnnouncementTopic(topic) {
+			logger.Warn("invalid announcement", "topic", topic, "err", err)
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+
+		err = app.DB.ScheduleAnnouncement(topic, message, at)
+		if errors.Is(err, ErrValueTooLong) {
+			logger.Warn("announcement too long")
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+		if err != nil {
+			logger.Error("failed to schedule announcement", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		app.DB.RecordEvent(NewEvent(TypeAnnounceScheduled, user.Username,
+			EventDetails{"topic": topic, "at": at.UTC().Format(time.RFC3339)}))
+
+	case "cancel":
+		id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+		if err != nil {
+			logger.Warn("invalid id", "err", err)
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+
+		err = app.DB.CancelAnnouncement(id)
+		if errors.Is(err, ErrAnnouncementNotFound) {
+			logger.Warn("announcement not found", "id", id)
+			webutil.Error(w, r, http.StatusNotFound, "", "")
+			return
+		}
+		if err != nil {
+			logger.Error("failed to cancel announcement", "err", err, "id", id)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		app.DB.RecordEvent(NewEvent(TypeAnnounceCanceled, user.Username, EventDetails{"id": strconv.FormatInt(id, 10)}))
+
+	default:
+		logger.Warn("invalid action")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	http.Redirect(w, r, "/announcements", http.StatusSeeOther)
+
+	logger.Info("done")
+}
+
+// AnnouncementStreamHandler streams the announcements of the topic named
+// by the event query parameter to any client. It responds with
+// http.StatusNotFound if the app has no Live server or the topic is not
+// for announcements.
+func (app *AuthApp) AnnouncementStreamHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	if !app.AnnouncementTopic(r.URL.Query().Get("event")) {
+		logger.Warn("not an announcement topic")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	// The stream stays open longer than the WriteTimeout of the server.
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		logger.Warn("failed to clear write deadline", "err", err)
+	}
+
+	app.Live.EventStreamHandler(w, r)
+}
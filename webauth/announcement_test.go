@@ -0,0 +1,286 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/websse"
+)
+
+func TestAnnouncementStore(t *testing.T) {
+	// The SQL store is tested only if there is a test database.
+	t.Run("sql", func(t *testing.T) {
+		testAnnouncementStore(t, DBForTest(t))
+	})
+	t.Run("memory", func(t *testing.T) {
+		testAnnouncementStore(t, StoreForTest(t))
+	})
+}
+
+// testAnnouncementStore tests that store schedules, cancels, and sends
+// announcements in order of publication.
+func testAnnouncementStore(t *testing.T, store webauth.AuthStore) {
+	now := time.Now().Truncate(time.Second)
+	topic := "announce-test"
+
+	for _, a := range []struct {
+		message string
+		at      time.Time
+	}{
+		{"later", now.Add(time.Hour)},
+		{"due", now.Add(-time.Minute)},
+		{"canceled", now.Add(-2 * time.Minute)},
+	} {
+		if err := store.ScheduleAnnouncement(topic, a.message, a.at); err != nil {
+			t.Fatalf("ScheduleAnnouncement(%q) failed: %v", a.message, err)
+		}
+	}
+	if err := store.ScheduleAnnouncement(topic, strings.Repeat("x", webauth.MaxAnnouncementMessageLen+1), now); !errors.Is(err, webauth.ErrValueTooLong) {
+		t.Errorf("ScheduleAnnouncement() of long message = %v, want %v", err, webauth.ErrValueTooLong)
+	}
+
+	// byMessage returns the announcements of topic since by message.
+	byMessage := func(since time.Time) map[string]webauth.Announcement {
+		all, err := store.Announcements(since)
+		if err != nil {
+			t.Fatalf("Announcements() failed: %v", err)
+		}
+		m := make(map[string]webauth.Announcement)
+		for _, a := range all {
+			if a.Topic == topic {
+				m[a.Message] = a
+			}
+		}
+		return m
+	}
+	announcements := byMessage(now)
+
+	if err := store.CancelAnnouncement(announcements["canceled"].ID); err != nil {
+		t.Fatalf("CancelAnnouncement() failed: %v", err)
+	}
+	if err := store.CancelAnnouncement(announcements["canceled"].ID); !errors.Is(err, webauth.ErrAnnouncementNotFound) {
+		t.Errorf("CancelAnnouncement() again = %v, want %v", err, webauth.ErrAnnouncementNotFound)
+	}
+
+	due, err := store.DueAnnouncements(now)
+	if err != nil {
+		t.Fatalf("DueAnnouncements() failed: %v", err)
+	}
+	var dueMessages []string
+	for _, a := range due {
+		if a.Topic == topic {
+			dueMessages = append(dueMessages, a.Message)
+		}
+	}
+	if len(dueMessages) != 1 || dueMessages[0] != "due" {
+		t.Fatalf("DueAnnouncements() = %q, want [due]", dueMessages)
+	}
+
+	if err := store.MarkAnnouncementSent(announcements["due"].ID); err != nil {
+		t.Fatalf("MarkAnnouncementSent() failed: %v", err)
+	}
+	if err := store.MarkAnnouncementSent(announcements["due"].ID); !errors.Is(err, webauth.ErrAnnouncementNotFound) {
+		t.Errorf("MarkAnnouncementSent() again = %v, want %v", err, webauth.ErrAnnouncementNotFound)
+	}
+
+	// Sent and canceled announcements are listed only if recent.
+	recent := byMessage(now.Add(-time.Hour))
+	if a := recent["due"]; !a.Sent.Valid || a.Pending() {
+		t.Errorf("due = %+v, want sent", a)
+	}
+	if a := recent["canceled"]; !a.Canceled.Valid || a.Pending() {
+		t.Errorf("canceled = %+v, want canceled", a)
+	}
+	if a := recent["later"]; !a.Pending() || !a.PublishAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("later = %+v, want pending at %v", a, now.Add(time.Hour))
+	}
+
+	current := byMessage(now)
+	if _, ok := current["due"]; ok || len(current) != 1 {
+		t.Errorf("Announcements(now) = %+v, want only later", current)
+	}
+}
+
+func TestPublishDueAnnouncements(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	live := websse.NewServer()
+	live.Run()
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithLive(live), webauth.WithClock(clock))
+
+	ts := httptest.NewServer(http.HandlerFunc(app.AnnouncementStreamHandler))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/announcements/live?event="+webauth.AnnouncementsEvent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("could not get stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	for live.ClientCount() < 1 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("client not added")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	err = app.DB.ScheduleAnnouncement(webauth.AnnouncementsEvent, "maintenance starts in 10 minutes", clock.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ScheduleAnnouncement() failed: %v", err)
+	}
+
+	if n, err := app.PublishDueAnnouncements(); n != 0 || err != nil {
+		t.Errorf("PublishDueAnnouncements() before due = %d, %v, want 0", n, err)
+	}
+
+	clock.Advance(time.Minute)
+	if n, err := app.PublishDueAnnouncements(); n != 1 || err != nil {
+		t.Errorf("PublishDueAnnouncements() = %d, %v, want 1", n, err)
+	}
+	if n, err := app.PublishDueAnnouncements(); n != 0 || err != nil {
+		t.Errorf("PublishDueAnnouncements() again = %d, %v, want 0", n, err)
+	}
+
+	var msg string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && msg != "" {
+			break
+		}
+		msg += line + "\n"
+	}
+	for _, want := range []string{"event: " + webauth.AnnouncementsEvent, "data: maintenance starts in 10 minutes"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestAnnouncementsHandler(t *testing.T) {
+	live := websse.NewServer()
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithLive(live))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	schedule := func(topic, message, at string) string {
+		return url.Values{"action": {"schedule"}, "topic": {topic}, "message": {message}, "at": {at}}.Encode()
+	}
+	at := time.Now().Add(time.Hour).In(app.TimeZones.Default()).Format(webauth.AnnouncementTimeLayout)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"notAdmin", userToken.Value, schedule("", "hello", at), http.StatusUnauthorized},
+		{"schedule", adminToken.Value, schedule("", "maintenance soon", at), http.StatusSeeOther},
+		{"missingMessage", adminToken.Value, schedule("", "", at), http.StatusBadRequest},
+		{"invalidTime", adminToken.Value, schedule("", "hello", "soon"), http.StatusBadRequest},
+		{"tableTopic", adminToken.Value, schedule(webauth.EventsTable.Name, "hello", at), http.StatusBadRequest},
+		{"unknownTopic", adminToken.Value, schedule("secrets", "hello", at), http.StatusBadRequest},
+		{"cancelMissing", adminToken.Value, "action=cancel&id=999", http.StatusNotFound},
+		{"invalidAction", adminToken.Value, "action=publish", http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(app.AnnouncementsHandler, tc.token, http.MethodPost, "/announcements", tc.body)
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+
+	w := requestAs(app.AnnouncementsHandler, adminToken.Value, http.MethodGet, "/announcements?format=json", "")
+	var got []struct {
+		ID      int64
+		Topic   string
+		Message string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body, err)
+	}
+	if len(got) != 1 || got[0].Message != "maintenance soon" || got[0].Topic != webauth.AnnouncementsEvent {
+		t.Fatalf("got %+v, want the scheduled announcement", got)
+	}
+
+	w = requestAs(app.AnnouncementsHandler, adminToken.Value, http.MethodGet, "/announcements", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "maintenance soon") {
+		t.Errorf("got status %d and body %q, want the announcement", w.Code, w.Body)
+	}
+
+	w = requestAs(app.AnnouncementsHandler, adminToken.Value, http.MethodPost, "/announcements", "action=cancel&id="+strconv.FormatInt(got[0].ID, 10))
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("cancel status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+
+	events, err := app.DB.EventsForUser("admin")
+	if err != nil {
+		t.Fatalf("EventsForUser() failed: %v", err)
+	}
+	var types []webauth.EventType
+	for _, e := range events {
+		if e.Name == webauth.EventAnnounce {
+			types = append(types, e.Type)
+		}
+	}
+	if len(types) != 2 || types[0] != webauth.TypeAnnounceCanceled || types[1] != webauth.TypeAnnounceScheduled {
+		t.Errorf("got event types %q, want canceled and scheduled", types)
+	}
+}
+
+func TestAnnouncementStreamHandler(t *testing.T) {
+	noLive := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithLive(websse.NewServer()))
+
+	tests := []struct {
+		name   string
+		h      http.HandlerFunc
+		target string
+	}{
+		{"notEnabled", noLive.AnnouncementStreamHandler, "/announcements/live?event=" + webauth.AnnouncementsEvent},
+		{"tableTopic", app.AnnouncementStreamHandler, "/announcements/live?event=" + webauth.EventsTable.Name},
+		{"missingTopic", app.AnnouncementStreamHandler, "/announcements/live"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(tc.h, "", http.MethodGet, tc.target, "")
+			if w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+		})
+	}
+}
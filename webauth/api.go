@@ -0,0 +1,343 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// APIPrefix is the path prefix of the JSON API.
+const APIPrefix = "/api/v1"
+
+// APILoginPath is the path of APILoginHandler. It is exempt from CSRF,
+// since it requires a JSON body, which a cross-site form cannot send.
+const APILoginPath = APIPrefix + "/login"
+
+// maxAPIBodyLen is the maximum size of a JSON request body.
+const maxAPIBodyLen = 1 << 20
+
+// apiError is the JSON form of an error.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiLogin is the JSON form of a login token and the refresh token, if
+// enabled. The token is sent as a bearer token or in the login cookie.
+type apiLogin struct {
+	Token          string     `json:"token"`
+	Expires        time.Time  `json:"expires"`
+	RefreshToken   string     `json:"refreshToken,omitempty"`
+	RefreshExpires *time.Time `json:"refreshExpires,omitempty"`
+}
+
+// apiUser is the JSON form of a User. The details are only shown to users
+// with PermViewUsers.
+type apiUser struct {
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+	*apiUserDetails
+}
+
+// apiUserDetails are the fields of apiUser shown to users with
+// PermViewUsers.
+type apiUserDetails struct {
+	Email     string    `json:"email"`
+	Admin     bool      `json:"admin"`
+	Confirmed bool      `json:"confirmed"`
+	Disabled  bool      `json:"disabled"`
+	Bounce    string    `json:"bounce,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// apiUsers is the JSON form of the users.
+type apiUsers struct {
+	Users []apiUser `json:"users"`
+}
+
+// apiEvent is the JSON form of an Event.
+type apiEvent struct {
+	Name      EventName `json:"name"`
+	Succeeded bool      `json:"succeeded"`
+	Username  string    `json:"username"`
+	Message   string    `json:"message"`
+	Created   time.Time `json:"created"`
+}
+
+// apiEvents is the JSON form of the events.
+type apiEvents struct {
+	Events []apiEvent `json:"events"`
+	Panics []apiEvent `json:"panics"`
+}
+
+// respondAPIError responds with code and msg as JSON. If msg is empty, the
+// text of code is used.
+func respondAPIError(w http.ResponseWriter, logger *slog.Logger, code int, msg string) {
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	if err := webutil.RespondWithJSON(w, code, apiError{Error: msg}); err != nil {
+		logger.Error("failed to write JSON", "err", err)
+	}
+}
+
+// respondAPI responds with v as JSON.
+func respondAPI(w http.ResponseWriter, logger *slog.Logger, v any) {
+	if err := webutil.RespondWithJSON(w, http.StatusOK, v); err != nil {
+		logger.Error("failed to write JSON", "err", err)
+		return
+	}
+
+	logger.Info("done")
+}
+
+// respondAPILogin responds with the tokens of s as JSON.
+func respondAPILogin(w http.ResponseWriter, logger *slog.Logger, s session) {
+	data := apiLogin{Token: s.login.Value, Expires: s.login.Expires}
+	if s.refresh.Value != "" {
+		data.RefreshToken = s.refresh.Value
+		data.RefreshExpires = &s.refresh.Expires
+	}
+
+	webutil.SetNoCacheHeaders(w)
+	respondAPI(w, logger, data)
+}
+
+// apiUserFromRequest returns the user of an API request, which is
+// authenticated by the signature of a client in Config.Signature.Clients,
+// a bearer token, or the login cookie. A bearer token can be an API token
+// or a login token from APILoginHandler. A user authenticated by a
+// signature or an API token only has the permissions of its scopes. If
+// the request is not authenticated, an empty user is returned.
+func (app *AuthApp) apiUserFromRequest(w http.ResponseWriter, r *http.Request) (User, error) {
+	if user, err := app.signatureUser(r.Context()); err != nil || user.Username != "" {
+		return user, err
+	}
+
+	token := webhandler.BearerToken(r)
+	if token == "" {
+		return app.UserFromRequest(w, r)
+	}
+
+	b, err := app.APITokenBearer(r.Context(), token)
+	if err == nil {
+		user, err := app.DB.UserForName(b.Subject)
+		if err != nil {
+			return User{}, err
+		}
+
+		// Limit the user to the scopes of the token.
+		user.IsAdmin, user.Roles, user.Permissions = false, nil, nil
+		for _, scope := range b.Scopes {
+			user.Permissions = append(user.Permissions, Permission(scope))
+		}
+
+		return user, nil
+	}
+	if !errors.Is(err, webhandler.ErrBearerInvalid) {
+		return User{}, err
+	}
+
+	user, err := app.DB.UserForLoginTokenContext(r.Context(), token)
+	if errors.Is(err, ErrUserLoginTokenNotFound) || errors.Is(err, ErrUserLoginTokenExpired) {
+		return User{}, nil
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	roles, err := app.DB.UserRoles(user.Username)
+	if err != nil {
+		return User{}, err
+	}
+	user.setRoles(roles)
+
+	return user, nil
+}
+
+// apiUser returns the user of an API request, or responds with an error
+// and returns false if the request is not authenticated.
+func (app *AuthApp) apiUser(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (User, bool) {
+	user, err := app.apiUserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return User{}, false
+	}
+
+	if user.Username == "" {
+		logger.Warn("user not authenticated")
+		respondAPIError(w, logger, http.StatusUnauthorized, "")
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// withSavedView returns r with the query of a saved view, so that the API
+// applies the view instead of redirecting to it.
+func withSavedView(r *http.Request, query string) *http.Request {
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query
+	return r
+}
+
+// APILoginHandler logs in a user with the username and password of a
+// JSON body and responds with the login token as JSON.
+func (app *AuthApp) APILoginHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		logger.Warn("invalid content type", "type", mediaType)
+		respondAPIError(w, logger, http.StatusUnsupportedMediaType, "")
+		return
+	}
+
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(io.LimitReader(r.Body, maxAPIBodyLen)).Decode(&body)
+	if err != nil {
+		logger.Warn("invalid JSON", "err", err)
+		respondAPIError(w, logger, http.StatusBadRequest, "")
+		return
+	}
+
+	form := newLoginForm(body.Username, body.Password, "")
+	logger = logger.With("username", form.Username)
+
+	s, status, msg := app.login(logger, r, form)
+	if msg != "" {
+		respondAPIError(w, logger, status, msg)
+		return
+	}
+
+	respondAPILogin(w, logger, s)
+}
+
+// APIUsersHandler responds with the users as JSON. Users with
+// PermViewUsers also get the details of each user and can use the view
+// query parameters of UsersTable.
+func (app *AuthApp) APIUsersHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, ok := app.apiUser(w, r, logger)
+	if !ok {
+		return
+	}
+
+	list, err := app.listUsers(r, user)
+	if err == nil && list.Query != "" {
+		list, err = app.listUsers(withSavedView(r, list.Query), user)
+	}
+	switch {
+	case errors.Is(err, ErrViewNotFound):
+		logger.Warn("saved view not found")
+		respondAPIError(w, logger, http.StatusNotFound, "")
+		return
+	case err != nil:
+		logger.Error("failed to list users", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return
+	}
+
+	data := apiUsers{Users: []apiUser{}}
+	for _, u := range list.Users {
+		au := apiUser{Username: u.Username, FullName: u.FullName}
+		if user.Can(PermViewUsers) {
+			au.apiUserDetails = &apiUserDetails{
+				Email:     u.Email,
+				Admin:     u.IsAdmin,
+				Confirmed: u.Confirmed,
+				Disabled:  u.Disabled,
+				Bounce:    string(list.Bounces[u.Username]),
+				Created:   u.Created,
+			}
+		}
+		data.Users = append(data.Users, au)
+	}
+
+	respondAPI(w, logger, data)
+}
+
+// APIEventsHandler responds with the events as JSON to users with
+// PermViewEvents, who can use the view query parameters of EventsTable.
+func (app *AuthApp) APIEventsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, ok := app.apiUser(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if !user.Can(PermViewEvents) {
+		logger.Warn("user not authorized", "user", user)
+		respondAPIError(w, logger, http.StatusForbidden, "")
+		return
+	}
+
+	list, err := app.listEvents(r, user)
+	if err == nil && list.Query != "" {
+		list, err = app.listEvents(withSavedView(r, list.Query), user)
+	}
+	switch {
+	case errors.Is(err, ErrViewNotFound):
+		logger.Warn("saved view not found")
+		respondAPIError(w, logger, http.StatusNotFound, "")
+		return
+	case err != nil:
+		logger.Error("failed to list events", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return
+	}
+
+	respondAPI(w, logger, apiEvents{
+		Events: toAPIEvents(list.Events),
+		Panics: toAPIEvents(list.Panics),
+	})
+}
+
+// toAPIEvents returns the JSON form of events.
+func toAPIEvents(events []Event) []apiEvent {
+	data := make([]apiEvent, 0, len(events))
+	for _, e := range events {
+		data = append(data, apiEvent{
+			Name:      e.Name,
+			Succeeded: e.Succeeded,
+			Username:  e.Username,
+			Message:   e.Message,
+			Created:   e.Created,
+		})
+	}
+	return data
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// apiRequest requests target from h with the bearer token, if not empty,
+// and returns the response.
+func apiRequest(h http.HandlerFunc, method, target, bearer, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if bearer != "" {
+		r.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+
+	h(w, r)
+
+	return w
+}
+
+// decodeJSON decodes the body of w into v.
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode %q: %v", w.Body, err)
+	}
+}
+
+func TestAPILoginHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{"valid", "application/json", `{"username":"test","password":"password"}`, http.StatusOK, ""},
+		{"wrong password", "application/json", `{"username":"test","password":"wrong"}`, http.StatusUnauthorized, webauth.MsgLoginFailed},
+		{"missing password", "application/json", `{"username":"test"}`, http.StatusBadRequest, webauth.MsgMissingPassword},
+		{"invalid JSON", "application/json", `{`, http.StatusBadRequest, http.StatusText(http.StatusBadRequest)},
+		{"form", "application/x-www-form-urlencoded", "username=test&password=password", http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := apiRequest(app.APILoginHandler, http.MethodPost, webauth.APILoginPath, "", tc.contentType, tc.body)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+
+			var got struct {
+				Token   string
+				Expires time.Time
+				Error   string
+			}
+			decodeJSON(t, w, &got)
+
+			if got.Error != tc.wantError {
+				t.Errorf("error = %q, want %q", got.Error, tc.wantError)
+			}
+			if tc.wantStatus == http.StatusOK {
+				if _, err := app.DB.UserForLoginToken(got.Token); err != nil {
+					t.Errorf("login token not valid: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginPostHandlerJSON(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	data := url.Values{"username": {"test"}, "password": {"password"}}
+	w := apiRequest(app.LoginPostHandler, http.MethodPost, "/login", "", "application/x-www-form-urlencoded", data.Encode())
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var got struct{ Token string }
+	decodeJSON(t, w, &got)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != webauth.LoginTokenCookieName || cookies[0].Value != got.Token {
+		t.Errorf("cookies = %v, want login cookie with token %q", cookies, got.Token)
+	}
+}
+
+// apiUsersResponse is the decoded response of APIUsersHandler.
+type apiUsersResponse struct {
+	Users []struct {
+		Username string
+		FullName string
+		Email    string
+		Admin    *bool
+	}
+}
+
+func TestAPIUsersHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	if w := apiRequest(app.APIUsersHandler, http.MethodGet, "/api/v1/users", "", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("status without login = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := apiRequest(app.APIUsersHandler, http.MethodGet, "/api/v1/users", "invalid", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("status with invalid token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	test, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+	admin, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+
+	// A user without PermViewUsers does not get the details.
+	w := apiRequest(app.APIUsersHandler, http.MethodGet, "/api/v1/users", test.Value, "", "")
+	var got apiUsersResponse
+	decodeJSON(t, w, &got)
+	if len(got.Users) == 0 {
+		t.Fatalf("no users in %q", w.Body)
+	}
+	for _, u := range got.Users {
+		if u.Email != "" || u.Admin != nil {
+			t.Errorf("user %q has details %q", u.Username, w.Body)
+		}
+	}
+
+	// The view query parameters apply to the JSON.
+	w = apiRequest(app.APIUsersHandler, http.MethodGet, "/api/v1/users?q=CONFIRMED&sort=username", admin.Value, "", "")
+	got = apiUsersResponse{}
+	decodeJSON(t, w, &got)
+	if len(got.Users) != 2 || got.Users[0].Username != "confirmed" || got.Users[0].Email != "confirmed@email" || got.Users[0].Admin == nil {
+		t.Errorf("got users %q, want confirmed and unconfirmed with details", w.Body)
+	}
+
+	// UsersHandler responds with the same JSON if requested.
+	w2 := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users?q=CONFIRMED&sort=username", nil)
+	r.Header.Set("Accept", "application/json")
+	r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: admin.Value})
+	app.UsersHandler(w2, r)
+	if w2.Body.String() != w.Body.String() {
+		t.Errorf("UsersHandler() JSON = %q, want %q", w2.Body, w.Body)
+	}
+}
+
+func TestAPIEventsHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	admin, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	test, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	w := apiRequest(app.APIEventsHandler, http.MethodGet, "/api/v1/events?q=login", admin.Value, "", "")
+	var got struct {
+		Events []struct {
+			Name     string
+			Username string
+		}
+		Panics []struct{}
+	}
+	decodeJSON(t, w, &got)
+	if w.Code != http.StatusOK || len(got.Events) == 0 || got.Panics == nil {
+		t.Errorf("got %d %q, want login events", w.Code, w.Body)
+	}
+
+	if w := apiRequest(app.APIEventsHandler, http.MethodGet, "/api/v1/events", test.Value, "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("status without permission = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// An API token only has the permissions of its scopes, even for an
+	// admin.
+	profile, err := store.CreateAPIToken("admin", "profile", []webauth.Permission{webauth.ScopeReadProfile}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIToken() failed: %v", err)
+	}
+	if w := apiRequest(app.APIEventsHandler, http.MethodGet, "/api/v1/events", profile.Value, "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("status with profile scope = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	events, err := store.CreateAPIToken("admin", "events", []webauth.Permission{webauth.PermViewEvents}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIToken() failed: %v", err)
+	}
+	if w := apiRequest(app.APIEventsHandler, http.MethodGet, "/api/v1/events", events.Value, "", ""); w.Code != http.StatusOK {
+		t.Errorf("status with events scope = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webid"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// API tokens, or personal access tokens, let programs call the API as a
+// user. Each token has a name, scopes that limit what it can do, and an
+// expiration. Like other tokens, only the hash of the value is stored.
+const (
+	APITokenKind       = "api" // Kind of API tokens in the tokens table.
+	APITokenSize       = 32    // Size of an API token.
+	APITokenMaxDays    = 365   // Maximum days until an API token expires.
+	MaxAPITokenNameLen = 50    // Maximum length of the name, matching the SQL schema.
+	maxAPIScopesLen    = 255   // Maximum length of the joined scopes.
+)
+
+// ScopeReadProfile allows a token to read the profile of its user. Unlike
+// the other scopes, any user can grant it.
+const ScopeReadProfile Permission = "profile:read"
+
+// APIScopes are the scopes that can be granted to an API token. Users can
+// only grant the permissions they have.
+var APIScopes = []Permission{
+	ScopeReadProfile,
+	PermViewEvents,
+	PermViewUsers,
+	PermManageUsers,
+	PermManageIncidents,
+	PermViewRateLimits,
+	PermViewCSPReports,
+	PermViewReports,
+	PermViewAudit,
+	PermViewInstances,
+	PermManageRoutes,
+}
+
+// APITokenExpirations are the choices, in days, of when a new API token
+// expires.
+var APITokenExpirations = []int{7, 30, 90, APITokenMaxDays}
+
+const TokensTmpl = "tokens.html"
+
+const (
+	MsgAPITokenCreated = "Copy your new token now. It will not be shown again."
+	MsgAPITokenRevoked = "The token was revoked."
+	MsgAPITokenInvalid = "Enter a name, at least one scope, and an expiration."
+)
+
+var (
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrAPITokenExpired  = errors.New("API token expired")
+)
+
+// APIToken describes an API token of a user, without its value.
+type APIToken struct {
+	ID      string
+	Name    string
+	Scopes  []Permission
+	Expires time.Time
+	Created time.Time
+}
+
+// canGrant returns true if u can grant scope to an API token.
+func (u User) canGrant(scope Permission) bool {
+	return slices.Contains(APIScopes, scope) && (scope == ScopeReadProfile || u.Can(scope))
+}
+
+// joinScopes returns scopes separated by spaces, as in OAuth.
+func joinScopes(scopes []Permission) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+	return strings.Join(s, " ")
+}
+
+// splitScopes returns the scopes of s, which was joined by joinScopes.
+func splitScopes(s string) []Permission {
+	var scopes []Permission
+	for _, scope := range strings.Fields(s) {
+		scopes = append(scopes, Permission(scope))
+	}
+	return scopes
+}
+
+// validAPIToken returns an error if name or scopes cannot be stored.
+func validAPIToken(name string, scopes []Permission) error {
+	if len(name) > MaxAPITokenNameLen || len(joinScopes(scopes)) > maxAPIScopesLen {
+		return ErrValueTooLong
+	}
+	return nil
+}
+
+// CreateAPIToken creates and saves an API token for username with name
+// and scopes that expires at expires.
+func (db *AuthDB) CreateAPIToken(username, name string, scopes []Permission, expires time.Time) (Token, error) {
+	if db == nil {
+		return Token{}, ErrInvalidDB
+	}
+
+	if err := validAPIToken(name, scopes); err != nil {
+		return Token{}, err
+	}
+
+	id, err := webid.NewString()
+	if err != nil {
+		return Token{}, err
+	}
+
+	value, err := RandomStringFrom(randReader(db.Rand), APITokenSize)
+	if err != nil {
+		return Token{}, err
+	}
+
+	qry := `INSERT INTO tokens (hashedValue, expires, kind, user_id, id, name, scopes) SELECT ?, ?, ?, users.id, ?, ?, ? FROM users WHERE username = ?`
+	result, err := db.Exec(qry, Hash(value), expires, APITokenKind, id, name, joinScopes(scopes), username)
+	if err != nil {
+		return Token{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return Token{}, err
+	}
+	if rows != 1 {
+		return Token{}, ErrUserNotFound
+	}
+
+	return Token{Value: value, Expires: expires, Kind: APITokenKind}, nil
+}
+
+// APITokens returns the API tokens of username, including expired
+// tokens, with the newest first.
+func (db *AuthDB) APITokens(username string) ([]APIToken, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT t.id, t.name, t.scopes, t.expires, t.created FROM tokens t JOIN users u ON u.id = t.user_id WHERE t.kind = ? AND u.username = ? ORDER BY t.created DESC, t.name`
+	rows, err := db.Query(qry, APITokenKind, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var (
+			t      APIToken
+			scopes string
+		)
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.Expires, &t.Created); err != nil {
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken removes the API token of username with id.
+func (db *AuthDB) RevokeAPIToken(username, id string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	qry := `DELETE FROM tokens WHERE kind = ? AND id = ? AND user_id = (SELECT id FROM users WHERE username = ?)`
+	result, err := db.Exec(qry, APITokenKind, id, username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
+
+// UserForAPIToken returns the user and scopes of the API token with
+// value. An expired token is removed and ErrAPITokenExpired is returned.
+func (db *AuthDB) UserForAPIToken(ctx context.Context, value string) (User, []Permission, error) {
+	if db == nil {
+		return EmptyUser, nil, ErrInvalidDB
+	}
+
+	var (
+		user    User
+		expires time.Time
+		scopes  string
+	)
+
+	qry := `SELECT users.id, username, fullName, email, admin, confirmed, disabled, expires, scopes FROM users INNER JOIN tokens ON users.id = tokens.user_id WHERE tokens.kind = ? AND hashedValue = ? LIMIT 1`
+	err := db.QueryRowContext(ctx, qry, APITokenKind, Hash(value)).Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Confirmed, &user.Disabled, &expires, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmptyUser, nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return EmptyUser, nil, err
+	}
+
+	if expires.Before(db.now()) {
+		if err := db.RemoveToken(APITokenKind, value); err != nil {
+			return EmptyUser, nil, err
+		}
+		return EmptyUser, nil, ErrAPITokenExpired
+	}
+
+	return user, splitScopes(scopes), nil
+}
+
+// APITokenBearer is a webhandler.BearerFunc that authenticates API
+// tokens. The scopes of the Bearer are limited to those the user can
+// still grant, so removing a role also limits the tokens of the user.
+func (app *AuthApp) APITokenBearer(ctx context.Context, token string) (webhandler.Bearer, error) {
+	user, scopes, err := app.DB.UserForAPIToken(ctx, token)
+	if errors.Is(err, ErrAPITokenNotFound) || errors.Is(err, ErrAPITokenExpired) {
+		return webhandler.Bearer{}, fmt.Errorf("%w: %v", webhandler.ErrBearerInvalid, err)
+	}
+	if err != nil {
+		return webhandler.Bearer{}, err
+	}
+
+	if user.Disabled {
+		return webhandler.Bearer{}, fmt.Errorf("%w: %v", webhandler.ErrBearerInvalid, ErrUserDisabled)
+	}
+
+	roles, err := app.DB.UserRoles(user.Username)
+	if err != nil {
+		return webhandler.Bearer{}, err
+	}
+	user.setRoles(roles)
+
+	b := webhandler.Bearer{Subject: user.Username}
+	for _, scope := range scopes {
+		if user.canGrant(scope) {
+			b.Scopes = append(b.Scopes, string(scope))
+		}
+	}
+
+	return b, nil
+}
+
+// TokensPageData contains data passed to the HTML template.
+type TokensPageData struct {
+	CommonData
+	User        User
+	Tokens      []APIToken
+	Scopes      []Permission // Scopes the user can grant.
+	Expirations []int        // Expirations are the choices in days.
+	NewToken    string       // NewToken is the value of a created token.
+	Message     string
+	Now         time.Time
+}
+
+// TokensHandler shows the API tokens of the logged in user. A POST
+// request with action "create" creates a token with the name, scopes, and
+// days until it expires. The value is shown only once. A POST request
+// with action "revoke" revokes the token with id.
+func (app *AuthApp) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.tokensGet, Post: app.tokensPost}.ServeHTTP(w, r)
+}
+
+// tokensGet serves the API tokens of the logged in user.
+func (app *AuthApp) tokensGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.tokensData(w, r, logger)
+	if !ok {
+		return
+	}
+
+	app.renderTokens(w, r, logger, data)
+}
+
+// tokensPost creates or revokes an API token of the logged in user.
+func (app *AuthApp) tokensPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.tokensData(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if data.User.Username == "" {
+		app.renderTokens(w, r, logger, data)
+		return
+	}
+
+	var err error
+	switch r.PostFormValue("action") {
+	case "create":
+		data.NewToken, data.Message, err = app.createAPIToken(r, data.User)
+	case "revoke":
+		data.Message, err = app.revokeAPIToken(r, data.User)
+	default:
+		logger.Warn("invalid action", "action", r.PostFormValue("action"))
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to change API tokens", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.renderTokens(w, r, logger, data)
+}
+
+// tokensData returns the data of the tokens page of the logged in user,
+// without their tokens. If the user cannot be found, an error is written
+// and false is returned.
+func (app *AuthApp) tokensData(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (TokensPageData, bool) {
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return TokensPageData{}, false
+	}
+
+	data := TokensPageData{
+		CommonData:  CommonData{Title: app.Cfg.App.Name},
+		User:        user,
+		Expirations: APITokenExpirations,
+		Now:         app.Clock.Now(),
+	}
+	for _, scope := range APIScopes {
+		if user.canGrant(scope) {
+			data.Scopes = append(data.Scopes, scope)
+		}
+	}
+
+	return data, true
+}
+
+// renderTokens renders the tokens page of data with the tokens of the
+// user, if logged in.
+func (app *AuthApp) renderTokens(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data TokensPageData) {
+	if data.User.Username != "" {
+		var err error
+		data.Tokens, err = app.DB.APITokens(data.User.Username)
+		if err != nil {
+			logger.Error("failed to get API tokens", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	app.RenderPage(w, r, logger, TokensTmpl, &data)
+
+	logger.Info("done")
+}
+
+// createAPIToken creates the API token requested by r for user and
+// returns its value and a message. If the request is not valid, the value
+// is empty.
+func (app *AuthApp) createAPIToken(r *http.Request, user User) (string, string, error) {
+	name := strings.TrimSpace(r.PostFormValue("name"))
+
+	days, err := strconv.Atoi(r.PostFormValue("days"))
+	if err != nil || days < 1 || days > APITokenMaxDays {
+		return "", MsgAPITokenInvalid, nil
+	}
+
+	var scopes []Permission
+	for _, s := range r.PostForm["scope"] {
+		scope := Permission(s)
+		if !user.canGrant(scope) {
+			return "", MsgAPITokenInvalid, nil
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if name == "" || len(scopes) == 0 || validAPIToken(name, scopes) != nil {
+		return "", MsgAPITokenInvalid, nil
+	}
+
+	expires := app.Clock.Now().Add(time.Duration(days) * 24 * time.Hour)
+	token, err := app.DB.CreateAPIToken(user.Username, name, scopes, expires)
+	if err != nil {
+		return "", "", err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeAPITokenCreated, user.Username, EventDetails{"name": name}))
+	app.Audit(r, audit.Entry{
+		Actor:    user.Username,
+		Action:   AuditCreateToken,
+		Target:   name,
+		Result:   audit.Success,
+		Metadata: audit.Metadata{"scopes": joinScopes(scopes)},
+	})
+
+	return token.Value, MsgAPITokenCreated, nil
+}
+
+// revokeAPIToken revokes the API token of user with the id of r and
+// returns a message.
+func (app *AuthApp) revokeAPIToken(r *http.Request, user User) (string, error) {
+	id := r.PostFormValue("id")
+
+	err := app.DB.RevokeAPIToken(user.Username, id)
+	if errors.Is(err, ErrAPITokenNotFound) {
+		return MsgAPITokenInvalid, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeAPITokenRevoked, user.Username, EventDetails{"id": id}))
+	app.Audit(r, audit.Entry{Actor: user.Username, Action: AuditRevokeToken, Target: id, Result: audit.Success})
+
+	return MsgAPITokenRevoked, nil
+}
+
+// TokenInfoHandler responds with the subject and scopes of the request,
+// as JSON. Use it with webhandler.BearerAuth and APITokenBearer, so that
+// clients can check their tokens.
+func (app *AuthApp) TokenInfoHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	b, ok := webhandler.BearerFromContext(r.Context())
+	if !ok {
+		logger.Error("request not authenticated by bearer")
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	webutil.RespondWithJSON(w, http.StatusOK, b)
+
+	logger.Info("done")
+}
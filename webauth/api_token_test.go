@@ -0,0 +1,184 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMemStoreAPIToken(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := StoreForTest(t)
+	store.SetClock(clock)
+
+	scopes := []webauth.Permission{webauth.ScopeReadProfile}
+	token, err := store.CreateAPIToken("test", "script", scopes, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIToken() failed: %v", err)
+	}
+
+	if _, err := store.CreateAPIToken("missing", "script", scopes, clock.Now()); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("CreateAPIToken() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+	if _, err := store.CreateAPIToken("test", strings.Repeat("x", webauth.MaxAPITokenNameLen+1), scopes, clock.Now()); !errors.Is(err, webauth.ErrValueTooLong) {
+		t.Errorf("CreateAPIToken() with long name = %v, want %v", err, webauth.ErrValueTooLong)
+	}
+
+	user, got, err := store.UserForAPIToken(context.Background(), token.Value)
+	if err != nil {
+		t.Fatalf("UserForAPIToken() failed: %v", err)
+	}
+	if user.Username != "test" || len(got) != 1 || got[0] != webauth.ScopeReadProfile {
+		t.Errorf("UserForAPIToken() = %q, %q, want %q, %q", user.Username, got, "test", scopes)
+	}
+
+	tokens, err := store.APITokens("test")
+	if err != nil {
+		t.Fatalf("APITokens() failed: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "script" || tokens[0].ID == "" {
+		t.Fatalf("APITokens() = %+v, want one token named script", tokens)
+	}
+
+	if err := store.RevokeAPIToken("admin", tokens[0].ID); !errors.Is(err, webauth.ErrAPITokenNotFound) {
+		t.Errorf("RevokeAPIToken() by other user = %v, want %v", err, webauth.ErrAPITokenNotFound)
+	}
+	if err := store.RevokeAPIToken("test", tokens[0].ID); err != nil {
+		t.Errorf("RevokeAPIToken() = %v, want nil", err)
+	}
+	if _, _, err := store.UserForAPIToken(context.Background(), token.Value); !errors.Is(err, webauth.ErrAPITokenNotFound) {
+		t.Errorf("UserForAPIToken() after revoke = %v, want %v", err, webauth.ErrAPITokenNotFound)
+	}
+
+	token, err = store.CreateAPIToken("test", "expiring", scopes, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIToken() failed: %v", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if _, _, err := store.UserForAPIToken(context.Background(), token.Value); !errors.Is(err, webauth.ErrAPITokenExpired) {
+		t.Errorf("UserForAPIToken() after expires = %v, want %v", err, webauth.ErrAPITokenExpired)
+	}
+}
+
+// newTokenRE matches the new token shown by the tokens page.
+var newTokenRE = regexp.MustCompile(`<code id="newToken">([^<]+)</code>`)
+
+func TestTokensHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	post := func(data url.Values) *httptest.ResponseRecorder {
+		return requestAs(app.TokensHandler, login.Value, http.MethodPost, "/tokens", data.Encode())
+	}
+
+	// A user cannot grant permissions they do not have.
+	w := post(url.Values{
+		"action": {"create"}, "name": {"script"}, "days": {"30"},
+		"scope": {string(webauth.PermViewUsers)},
+	})
+	if !strings.Contains(w.Body.String(), webauth.MsgAPITokenInvalid) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgAPITokenInvalid)
+	}
+
+	w = post(url.Values{
+		"action": {"create"}, "name": {"script"}, "days": {"30"},
+		"scope": {string(webauth.ScopeReadProfile)},
+	})
+	m := newTokenRE.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("no new token in body:\n%s", w.Body)
+	}
+	value := html.UnescapeString(m[1])
+
+	api := webhandler.BearerAuth(http.HandlerFunc(app.TokenInfoHandler), app.APITokenBearer)
+	get := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/token", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	w = get(value)
+	want := `{"Subject":"test","Scopes":["profile:read"]}`
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+		t.Errorf("got %d %q, want %d %q", w.Code, w.Body, http.StatusOK, want)
+	}
+
+	// The login token is not an API token.
+	if w := get(login.Value); w.Code != http.StatusUnauthorized {
+		t.Errorf("login token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	tokens, err := store.APITokens("test")
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("APITokens() = %v, %v, want one token", tokens, err)
+	}
+
+	w = post(url.Values{"action": {"revoke"}, "id": {tokens[0].ID}})
+	if !strings.Contains(w.Body.String(), webauth.MsgAPITokenRevoked) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgAPITokenRevoked)
+	}
+
+	if w := get(value); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPITokenBearerScopes(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	err := store.SaveRole(webauth.Role{
+		Name:        "auditor",
+		Permissions: []webauth.Permission{webauth.PermViewEvents},
+	})
+	if err != nil {
+		t.Fatalf("SaveRole() failed: %v", err)
+	}
+	if err := store.GrantRole("test", "auditor"); err != nil {
+		t.Fatalf("GrantRole() failed: %v", err)
+	}
+
+	scopes := []webauth.Permission{webauth.ScopeReadProfile, webauth.PermViewEvents}
+	token, err := store.CreateAPIToken("test", "script", scopes, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIToken() failed: %v", err)
+	}
+
+	b, err := app.APITokenBearer(context.Background(), token.Value)
+	if err != nil || !b.HasScope(string(webauth.PermViewEvents)) {
+		t.Errorf("APITokenBearer() = %+v, %v, want scope %q", b, err, webauth.PermViewEvents)
+	}
+
+	// Revoking the role removes the scope from the token.
+	if err := store.RevokeRole("test", "auditor"); err != nil {
+		t.Fatalf("RevokeRole() failed: %v", err)
+	}
+	b, err = app.APITokenBearer(context.Background(), token.Value)
+	if err != nil || b.HasScope(string(webauth.PermViewEvents)) || !b.HasScope(string(webauth.ScopeReadProfile)) {
+		t.Errorf("APITokenBearer() after revoke = %+v, %v, want only %q", b, err, webauth.ScopeReadProfile)
+	}
+
+	if _, err := app.APITokenBearer(context.Background(), "invalid"); !errors.Is(err, webhandler.ErrBearerInvalid) {
+		t.Errorf("APITokenBearer() for invalid token = %v, want %v", err, webhandler.ErrBearerInvalid)
+	}
+}
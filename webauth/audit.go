@@ -0,0 +1,185 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// Actions of the audit log.
+const (
+	AuditLogin         = "login"
+	AuditLogout        = "logout"
+	AuditRegister      = "register"
+	AuditResetPassword = "reset_password"
+	AuditAccessDenied  = "access"
+	AuditRenameUser    = "rename_user"
+	AuditDisableUser   = "disable_user"
+	AuditDeleteUser    = "delete_user"
+	AuditApproveUser   = "approve_user"
+	AuditCreateToken   = "create_api_token"
+	AuditRevokeToken   = "revoke_api_token"
+	AuditScreen        = "screen"
+	AuditRouteState    = "route_state"
+)
+
+// Audit records e in the audit log, with the address and User-Agent of the
+// client of r and the ID of r. Failures are logged, since the action was
+// already done.
+func (app *AuthApp) Audit(r *http.Request, e audit.Entry) {
+	client := audit.FromRequest(r, e.Action)
+	e.IP, e.UserAgent = client.IP, client.UserAgent
+	e.RequestID = webhandler.RequestID(r.Context())
+
+	err := app.DB.RecordAudit(e)
+	if err != nil {
+		slog.Error("failed to record audit entry", "entry", e, "err", err)
+	}
+}
+
+// auditedUser is the state of a user in the Changes of audit entries of
+// admin actions. It has no personal data, such as the email of the user,
+// since entries are kept after the user is deleted.
+type auditedUser struct {
+	Admin      bool `json:"admin"`
+	Confirmed  bool `json:"confirmed"`
+	Disabled   bool `json:"disabled"`
+	Waitlisted bool `json:"waitlisted"`
+}
+
+// auditedUserOf returns the audited state of u.
+func auditedUserOf(u User) auditedUser {
+	return auditedUser{Admin: u.IsAdmin, Confirmed: u.Confirmed, Disabled: u.Disabled, Waitlisted: u.Waitlisted}
+}
+
+// auditChanges returns the changes from before to after, as audit.Diff,
+// for an audit entry. Failures are logged, since the action was already
+// done.
+func auditChanges(before, after any) audit.Changes {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		slog.Error("failed to diff audit changes", "err", err)
+	}
+
+	return changes
+}
+
+// RecordAudit saves e in the audit log.
+func (db *AuthDB) RecordAudit(e audit.Entry) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	metadata := e.Metadata.String()
+	if len(metadata) > audit.MaxMetadataLen {
+		return audit.ErrMetadataTooLong
+	}
+	changes := e.Changes.String()
+	if len(changes) > audit.MaxChangesLen {
+		return audit.ErrChangesTooLong
+	}
+
+	e = e.Truncated()
+
+	const qry = `INSERT INTO audit_log(actor, action, target, ip, user_agent, result, metadata, request_id, changes) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(qry, e.Actor, e.Action, e.Target, e.IP, e.UserAgent, e.Result,
+		sql.NullString{String: metadata, Valid: metadata != ""}, e.RequestID, sql.NullString{String: changes, Valid: changes != ""})
+
+	return err
+}
+
+// auditWhere returns the WHERE clause and arguments of the fields of f.
+func auditWhere(f audit.Filter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	for _, c := range []struct {
+		cond string
+		arg  any
+		ok   bool
+	}{
+		{"LOWER(actor) = LOWER(?)", f.Actor, f.Actor != ""},
+		{"action = ?", f.Action, f.Action != ""},
+		{"LOWER(target) = LOWER(?)", f.Target, f.Target != ""},
+		{"result = ?", f.Result, f.Result != ""},
+		{"created >= ?", f.Since, !f.Since.IsZero()},
+		{"created < ?", f.Until, !f.Until.IsZero()},
+	} {
+		if c.ok {
+			conds = append(conds, c.cond)
+			args = append(args, c.arg)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// AuditEntries returns the entries of the audit log that match f, newest
+// first, and the number that match.
+func (db *AuthDB) AuditEntries(f audit.Filter) ([]audit.Entry, int, error) {
+	if db == nil {
+		return nil, 0, ErrInvalidDB
+	}
+
+	where, args := auditWhere(f)
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	qry := "SELECT created, actor, action, target, ip, user_agent, result, metadata, request_id, changes FROM audit_log" +
+		where + " ORDER BY created DESC, id DESC"
+	if f.Limit > 0 {
+		qry += fmt.Sprintf(" LIMIT %d OFFSET %d", f.Limit, max(f.Offset, 0))
+	}
+
+	rows, err := db.Query(qry, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var (
+			e        audit.Entry
+			metadata sql.NullString
+			changes  sql.NullString
+		)
+
+		err := rows.Scan(&e.Created, &e.Actor, &e.Action, &e.Target, &e.IP, &e.UserAgent, &e.Result, &metadata, &e.RequestID, &changes)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		e.Metadata, err = audit.ParseMetadata(metadata.String)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid audit metadata: %w", err)
+		}
+
+		e.Changes, err = audit.ParseChanges(changes.String)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid audit changes: %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, total, rows.Err()
+}
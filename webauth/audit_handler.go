@@ -0,0 +1,275 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	AuditTmpl        = "audit.html"
+	AuditHistoryTmpl = "audit_history.html"
+)
+
+// AuditPageSize is the number of entries on each page of AuditHandler.
+const AuditPageSize = 50
+
+// AuditResults are the results that can be filtered by.
+var AuditResults = []audit.Result{audit.Success, audit.Failure, audit.Denied}
+
+// AuditPageData contains data passed to the HTML template.
+type AuditPageData struct {
+	CommonData
+	User    User
+	Filter  audit.Filter
+	Query   url.Values // Query is the filter as query parameters.
+	Results []audit.Result
+	Entries []audit.Entry
+	Total   int // Total is the number of entries that match the filter.
+	Page    int
+	Pages   int
+	PrevURL string // PrevURL is the previous page, if any.
+	NextURL string // NextURL is the next page, if any.
+	CSVURL  string
+}
+
+var errAuditQuery = errors.New("invalid audit query")
+
+// parseAuditFilter returns the filter of the query q. Since and until are
+// dates, as "2006-01-02", and until includes its day.
+func parseAuditFilter(q url.Values) (audit.Filter, error) {
+	f := audit.Filter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Result: audit.Result(q.Get("result")),
+	}
+
+	if f.Result != "" && !slices.Contains(AuditResults, f.Result) {
+		return f, errAuditQuery
+	}
+
+	var err error
+	if s := q.Get("since"); s != "" {
+		f.Since, err = time.Parse(time.DateOnly, s)
+		if err != nil {
+			return f, errAuditQuery
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		f.Until, err = time.Parse(time.DateOnly, s)
+		if err != nil {
+			return f, errAuditQuery
+		}
+		f.Until = f.Until.AddDate(0, 0, 1)
+	}
+
+	return f, nil
+}
+
+// auditUser returns the user of r if they have PermViewAudit and the
+// filter of the query of r, or responds with an error and returns false.
+func (app *AuthApp) auditUser(w http.ResponseWriter, r *http.Request) (User, audit.Filter, bool) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return User{}, audit.Filter{}, false
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return User{}, audit.Filter{}, false
+	}
+	if !user.Can(PermViewAudit) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return User{}, audit.Filter{}, false
+	}
+
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		logger.Warn("invalid filter", "query", r.URL.RawQuery)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return User{}, audit.Filter{}, false
+	}
+
+	return user, filter, true
+}
+
+// AuditHandler shows a user with PermViewAudit a page of the audit log,
+// newest first, filtered by the actor, action, target, result, since,
+// and until query parameters.
+func (app *AuthApp) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, filter, ok := app.auditUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	filter.Limit = AuditPageSize
+	filter.Offset = (page - 1) * AuditPageSize
+
+	entries, total, err := app.DB.AuditEntries(filter)
+	if err != nil {
+		logger.Error("failed to get audit entries", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	query := r.URL.Query()
+	query.Del("page")
+	pageURL := func(page int) string {
+		q := maps.Clone(query)
+		q.Set("page", strconv.Itoa(page))
+		return "/audit?" + q.Encode()
+	}
+
+	data := AuditPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Filter:     filter,
+		Query:      query,
+		Results:    AuditResults,
+		Entries:    entries,
+		Total:      total,
+		Page:       page,
+		Pages:      max((total+AuditPageSize-1)/AuditPageSize, 1),
+		CSVURL:     "/auditcsv?" + query.Encode(),
+	}
+	if page > 1 {
+		data.PrevURL = pageURL(page - 1)
+	}
+	if page < data.Pages {
+		data.NextURL = pageURL(page + 1)
+	}
+
+	app.RenderPage(w, r, logger, AuditTmpl, &data)
+
+	logger.Info("done")
+}
+
+// auditRow is an audit.Entry as a CSV row.
+type auditRow struct {
+	Created   string
+	Actor     string
+	Action    string
+	Target    string
+	IP        string
+	UserAgent string `csv:"User Agent"`
+	Result    audit.Result
+	Metadata  audit.Metadata
+	RequestID string `csv:"Request ID"`
+	Changes   audit.Changes
+}
+
+// AuditCSVHandler responds with all the entries of AuditHandler in the
+// format of webutil.Export, CSV by default.
+func (app *AuthApp) AuditCSVHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	_, filter, ok := app.auditUser(w, r)
+	if !ok {
+		return
+	}
+
+	entries, _, err := app.DB.AuditEntries(filter)
+	if err != nil {
+		logger.Error("failed to get audit entries", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	rows := make([]auditRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, auditRow{
+			Created:   e.Created.UTC().Format(time.RFC3339),
+			Actor:     e.Actor,
+			Action:    e.Action,
+			Target:    e.Target,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Result:    e.Result,
+			Metadata:  e.Metadata,
+			RequestID: e.RequestID,
+			Changes:   e.Changes,
+		})
+	}
+
+	err = webutil.Export(w, r, "audit", rows)
+	if err != nil {
+		logger.Error("failed to export audit entries", "err", err)
+		return
+	}
+
+	logger.Info("done")
+}
+
+// AuditHistoryData contains data passed to the HTML template.
+type AuditHistoryData struct {
+	CommonData
+	User     User
+	Target   string
+	Entries  []audit.Entry
+	Total    int    // Total is the number of entries of Target.
+	AuditURL string // AuditURL is the audit log of all entries of Target.
+}
+
+// AuditHistoryHandler shows a user with PermViewAudit the history of the
+// entity in the target query parameter, such as a username or a route
+// pattern: the newest AuditPageSize entries of the audit log with it as
+// their target, with the changes made to it. Other query parameters filter
+// the entries as for AuditHandler.
+func (app *AuthApp) AuditHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, filter, ok := app.auditUser(w, r)
+	if !ok {
+		return
+	}
+
+	if filter.Target == "" {
+		logger.Warn("missing target")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+	filter.Limit = AuditPageSize
+
+	entries, total, err := app.DB.AuditEntries(filter)
+	if err != nil {
+		logger.Error("failed to get audit entries", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := AuditHistoryData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Target:     filter.Target,
+		Entries:    entries,
+		Total:      total,
+		AuditURL:   "/audit?" + r.URL.Query().Encode(),
+	}
+
+	app.RenderPage(w, r, logger, AuditHistoryTmpl, &data)
+
+	logger.Info("done")
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestAuditLogin(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	for _, password := range []string{"password", "wrong"} {
+		data := url.Values{"username": {"test"}, "password": {password}}
+		geoRequest(app.LoginPostHandler, "/login", "203.0.113.1", data)
+	}
+
+	entries, total, err := store.AuditEntries(audit.Filter{Actor: "TEST", Action: webauth.AuditLogin})
+	if err != nil {
+		t.Fatalf("AuditEntries() failed: %v", err)
+	}
+	if total != 2 || len(entries) != 2 {
+		t.Fatalf("AuditEntries() = %+v, %d, want 2 entries", entries, total)
+	}
+	if entries[0].Result != audit.Failure || entries[1].Result != audit.Success {
+		t.Errorf("results = %q, %q, want newest first %q, %q",
+			entries[0].Result, entries[1].Result, audit.Failure, audit.Success)
+	}
+	if entries[0].IP != "203.0.113.1" {
+		t.Errorf("IP = %q, want %q", entries[0].IP, "203.0.113.1")
+	}
+}
+
+func TestAuditAccessDenied(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := app.RequirePermission(next, webauth.PermViewAudit)
+
+	w := requestAs(h.ServeHTTP, token.Value, http.MethodGet, "/audit", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	entries, _, _ := store.AuditEntries(audit.Filter{Result: audit.Denied})
+	if len(entries) != 1 || entries[0].Actor != "test" || entries[0].Target != "/audit" {
+		t.Errorf("AuditEntries() = %+v, want denied access to /audit by test", entries)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	start := time.Now().Truncate(24 * time.Hour)
+	clock := webauth.NewFakeClock(start)
+	store := StoreForTest(t)
+	store.SetClock(clock)
+	app := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	n := webauth.AuditPageSize + 10
+	for i := range n {
+		clock.Set(start.Add(time.Duration(i) * time.Minute))
+		store.RecordAudit(audit.Entry{
+			Actor:    "admin",
+			Action:   webauth.AuditDisableUser,
+			Target:   "user" + strconv.Itoa(i),
+			Result:   audit.Success,
+			Metadata: audit.Metadata{"n": strconv.Itoa(i)},
+		})
+	}
+	clock.Set(start.Add(-48 * time.Hour))
+	store.RecordAudit(audit.Entry{Actor: "test", Action: webauth.AuditLogin, Result: audit.Failure})
+
+	tests := []struct {
+		name       string
+		handler    func(*webauth.AuthApp) http.HandlerFunc
+		token      string
+		target     string
+		wantStatus int
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:       "firstPage",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      adminToken.Value,
+			target:     "/audit?action=" + webauth.AuditDisableUser,
+			wantStatus: http.StatusOK,
+			want:       []string{"user" + strconv.Itoa(n-1) + "<", "page 1 of 2", "page=2"},
+			notWant:    []string{">user9<", "Previous"},
+		},
+		{
+			name:       "lastPage",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      adminToken.Value,
+			target:     "/audit?action=" + webauth.AuditDisableUser + "&page=2",
+			wantStatus: http.StatusOK,
+			want:       []string{">user9<", "page 2 of 2", "Previous"},
+			notWant:    []string{">user10<", "Next"},
+		},
+		{
+			name:       "since",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      adminToken.Value,
+			target:     "/audit?result=failure&until=" + start.Add(-24*time.Hour).Format(time.DateOnly),
+			wantStatus: http.StatusOK,
+			want:       []string{"1 entries", ">login<"},
+		},
+		{
+			name:       "badResult",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      adminToken.Value,
+			target:     "/audit?result=maybe",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "badDate",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      adminToken.Value,
+			target:     "/audit?since=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "notAllowed",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditHandler },
+			token:      userToken.Value,
+			target:     "/audit",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "csv",
+			handler:    func(a *webauth.AuthApp) http.HandlerFunc { return a.AuditCSVHandler },
+			token:      adminToken.Value,
+			target:     "/auditcsv?target=user0",
+			wantStatus: http.StatusOK,
+			want:       []string{"Created,Actor,Action,Target,IP,User Agent,Result,Metadata,Request ID,Changes\n", `"{""n"":""0""}"`},
+			notWant:    []string{"user1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(tc.handler(app), tc.token, http.MethodGet, tc.target, "")
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+
+			body := w.Body.String()
+			for _, s := range tc.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("expected %q in body %q", s, body)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("did not expect %q in body", s)
+				}
+			}
+		})
+	}
+}
+
+func TestRetainAudit(t *testing.T) {
+	start := time.Now()
+	clock := webauth.NewFakeClock(start)
+	store := StoreForTest(t)
+	store.SetClock(clock)
+	app := newAppForTest(t, []func(*webauth.Config){
+		func(cfg *webauth.Config) {
+			cfg.Retention = webauth.ConfigRetention{Events: "0", Emails: "0", Analytics: "0", Audit: "30d"}
+		},
+	}, webauth.WithDB(store), webauth.WithClock(clock))
+
+	clock.Set(start.Add(-31 * 24 * time.Hour))
+	store.RecordAudit(audit.Entry{Action: webauth.AuditLogin, Result: audit.Success})
+	clock.Set(start)
+	store.RecordAudit(audit.Entry{Action: webauth.AuditLogin, Result: audit.Success})
+
+	results, err := app.EnforceRetention(false)
+	if err != nil {
+		t.Fatalf("EnforceRetention() failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Category != webauth.RetainAudit || results[0].Rows != 1 {
+		t.Errorf("EnforceRetention() = %+v, want 1 audit entry purged", results)
+	}
+	if _, total, _ := store.AuditEntries(audit.Filter{}); total != 1 {
+		t.Errorf("audit entries after purge = %d, want 1", total)
+	}
+}
+
+func TestAuditHistory(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	postBulk(t, app, adminToken.Value, "action=disable&confirm=yes&username=test")
+
+	entries, _, _ := store.AuditEntries(audit.Filter{Action: webauth.AuditDisableUser, Target: "test"})
+	want := audit.Changes{{Field: "disabled", Before: "false", After: "true"}}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Changes, want) {
+		t.Fatalf("AuditEntries() = %+v, want changes %+v", entries, want)
+	}
+
+	w := requestAs(app.AuditHistoryHandler, adminToken.Value, http.MethodGet, "/audit/history?target=TEST", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, s := range []string{"History of TEST", webauth.AuditDisableUser, "<td>disabled</td>", "<del>false</del>", "<ins>true</ins>"} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("expected %q in body %q", s, w.Body.String())
+		}
+	}
+
+	if w := requestAs(app.AuditHistoryHandler, adminToken.Value, http.MethodGet, "/audit/history", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("status without target = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := requestAs(app.AuditHistoryHandler, userToken.Value, http.MethodGet, "/audit/history?target=test", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("status for user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
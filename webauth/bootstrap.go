@@ -0,0 +1,133 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BootstrapEnvPrefix is the prefix of the environment variables that set
+// ConfigBootstrap, such as WEBAUTH_BOOTSTRAP_USERNAME, so that a new
+// deployment, e.g., by Terraform or Docker Compose, does not need a config
+// file with secrets.
+const BootstrapEnvPrefix = "WEBAUTH_BOOTSTRAP_"
+
+// DefaultBootstrapSetupExpires is how long the setup URL of the bootstrap
+// admin is valid, if ConfigBootstrap.SetupExpires is empty.
+const DefaultBootstrapSetupExpires = "24h"
+
+// ConfigBootstrap holds the admin created by AuthApp.Bootstrap on the first
+// boot, when there are no users. It is ignored once there are users.
+type ConfigBootstrap struct {
+	Username string // Username of the admin, or empty to not create one.
+	Email    string // Email of the admin.
+	FullName string // FullName of the admin, or Username if empty.
+	Password string // Password of the admin, or empty to log a setup URL.
+
+	// Invite logs a setup URL for the admin to choose a password, even
+	// if Password is set, so that the password is never in the config.
+	Invite bool
+
+	SetupExpires string // Duration string of the setup URL, or DefaultBootstrapSetupExpires if empty.
+}
+
+// WithEnv returns c with the fields set by the environment variables of
+// getenv, such as os.Getenv, named by BootstrapEnvPrefix and the field in
+// upper case, e.g., WEBAUTH_BOOTSTRAP_PASSWORD. An unset or empty
+// variable keeps the field of c.
+func (c ConfigBootstrap) WithEnv(getenv func(string) string) (ConfigBootstrap, error) {
+	for name, field := range map[string]*string{
+		"USERNAME":      &c.Username,
+		"EMAIL":         &c.Email,
+		"FULLNAME":      &c.FullName,
+		"PASSWORD":      &c.Password,
+		"SETUP_EXPIRES": &c.SetupExpires,
+	} {
+		if v := getenv(BootstrapEnvPrefix + name); v != "" {
+			*field = v
+		}
+	}
+
+	if v := getenv(BootstrapEnvPrefix + "INVITE"); v != "" {
+		invite, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid %sINVITE %q: %w", BootstrapEnvPrefix, v, err)
+		}
+		c.Invite = invite
+	}
+
+	return c, nil
+}
+
+var ErrBootstrapInvalid = errors.New("invalid bootstrap admin")
+
+// Bootstrap creates the confirmed admin of Config.Bootstrap if there are
+// no users, so that a new deployment needs no manual SQL. If the admin
+// has no password or is invited, it gets a random password and the
+// one-time setup URL to choose one is logged and returned.
+//
+// Bootstrap does nothing and returns an empty URL if Config.Bootstrap
+// has no Username or there are users.
+func (app *AuthApp) Bootstrap() (string, error) {
+	c := app.Cfg.Bootstrap
+	if c.Username == "" {
+		return "", nil
+	}
+
+	if strings.ContainsFunc(c.Username, isSpace) || len(c.Username) > MaxUsernameLen {
+		return "", fmt.Errorf("%w: username %q", ErrBootstrapInvalid, c.Username)
+	}
+	if len(c.Email) > maxEmailLen || !strings.Contains(c.Email, "@") {
+		return "", fmt.Errorf("%w: email %q", ErrBootstrapInvalid, c.Email)
+	}
+	if c.FullName == "" {
+		c.FullName = c.Username
+	}
+	if c.SetupExpires == "" {
+		c.SetupExpires = DefaultBootstrapSetupExpires
+	}
+	if _, err := time.ParseDuration(c.SetupExpires); err != nil {
+		return "", fmt.Errorf("%w: setup expires: %w", ErrBootstrapInvalid, err)
+	}
+
+	invite := c.Invite || c.Password == ""
+	password := c.Password
+	if invite {
+		var err error
+		password, err = GenerateRandomString(32)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	created, err := app.DB.BootstrapAdmin(c.Username, c.FullName, c.Email, password)
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		slog.Debug("bootstrap skipped, users exist", "username", c.Username)
+		return "", nil
+	}
+
+	if !invite {
+		slog.Warn("bootstrap created admin", "username", c.Username)
+		return "", nil
+	}
+
+	token, err := app.DB.CreateToken("reset", c.Username, ResetTokenSize, c.SetupExpires)
+	if err != nil {
+		return "", err
+	}
+
+	setupURL := app.Cfg.Auth.BaseURL + "/reset?rtoken=" + token.Value
+	slog.Warn("bootstrap created admin, visit the setup URL to set its password",
+		"username", c.Username, "url", setupURL, "expires", token.Expires)
+
+	return setupURL, nil
+}
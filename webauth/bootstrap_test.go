@@ -0,0 +1,125 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestConfigBootstrapWithEnv(t *testing.T) {
+	env := map[string]string{
+		"WEBAUTH_BOOTSTRAP_USERNAME": "root",
+		"WEBAUTH_BOOTSTRAP_EMAIL":    "root@email",
+		"WEBAUTH_BOOTSTRAP_INVITE":   "true",
+	}
+	getenv := func(name string) string { return env[name] }
+
+	c := webauth.ConfigBootstrap{Username: "admin", FullName: "Admin User", Password: "password"}
+	got, err := c.WithEnv(getenv)
+	if err != nil {
+		t.Fatalf("WithEnv() failed: %v", err)
+	}
+
+	want := webauth.ConfigBootstrap{Username: "root", Email: "root@email", FullName: "Admin User", Password: "password", Invite: true}
+	if got != want {
+		t.Errorf("WithEnv() = %+v, want %+v", got, want)
+	}
+
+	env["WEBAUTH_BOOTSTRAP_INVITE"] = "maybe"
+	if _, err := c.WithEnv(getenv); err == nil {
+		t.Error("WithEnv() of invalid INVITE did not fail")
+	}
+}
+
+func bootstrapAppForTest(t *testing.T, store webauth.AuthStore, c webauth.ConfigBootstrap) *webauth.AuthApp {
+	t.Helper()
+
+	return newAppForTest(t,
+		[]func(*webauth.Config){func(cfg *webauth.Config) { cfg.Bootstrap = c }},
+		webauth.WithDB(store))
+}
+
+func TestBootstrapPassword(t *testing.T) {
+	store := webauth.NewMemStore()
+	app := bootstrapAppForTest(t, store, webauth.ConfigBootstrap{Username: "root", Email: "root@email", Password: "secret"})
+
+	setupURL, err := app.Bootstrap()
+	if err != nil || setupURL != "" {
+		t.Fatalf("Bootstrap() = %q, %v, want no setup URL", setupURL, err)
+	}
+
+	user, err := store.UserForName("root")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+	if !user.IsAdmin || !user.Confirmed || user.FullName != "root" {
+		t.Errorf("user = %+v, want confirmed admin with FullName root", user)
+	}
+	if err := store.CheckPassword("root", "secret"); err != nil {
+		t.Errorf("CheckPassword() failed: %v", err)
+	}
+
+	// A second boot keeps the admin.
+	if _, err := app.Bootstrap(); err != nil {
+		t.Errorf("second Bootstrap() failed: %v", err)
+	}
+}
+
+func TestBootstrapInvite(t *testing.T) {
+	store := webauth.NewMemStore()
+	app := bootstrapAppForTest(t, store, webauth.ConfigBootstrap{Username: "root", Email: "root@email", Password: "secret", Invite: true})
+
+	setupURL, err := app.Bootstrap()
+	if err != nil {
+		t.Fatalf("Bootstrap() failed: %v", err)
+	}
+	if !strings.HasPrefix(setupURL, app.Cfg.Auth.BaseURL+"/reset?rtoken=") {
+		t.Fatalf("Bootstrap() = %q, want reset URL", setupURL)
+	}
+
+	rtoken := strings.TrimPrefix(setupURL, app.Cfg.Auth.BaseURL+"/reset?rtoken=")
+	username, err := store.UsernameForResetToken(rtoken)
+	if err != nil || username != "root" {
+		t.Errorf("UsernameForResetToken() = %q, %v, want %q", username, err, "root")
+	}
+
+	// The configured password is ignored for an invite.
+	if err := store.CheckPassword("root", "secret"); err == nil {
+		t.Error("CheckPassword() of configured password succeeded")
+	}
+}
+
+func TestBootstrapSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		store webauth.AuthStore
+		c     webauth.ConfigBootstrap
+		err   error
+	}{
+		{"unset", webauth.NewMemStore(), webauth.ConfigBootstrap{}, nil},
+		{"usersExist", StoreForTest(t), webauth.ConfigBootstrap{Username: "root", Email: "root@email"}, nil},
+		{"invalidEmail", webauth.NewMemStore(), webauth.ConfigBootstrap{Username: "root", Email: "root"}, webauth.ErrBootstrapInvalid},
+		{"invalidUsername", webauth.NewMemStore(), webauth.ConfigBootstrap{Username: "root user", Email: "root@email"}, webauth.ErrBootstrapInvalid},
+		{"invalidExpires", webauth.NewMemStore(), webauth.ConfigBootstrap{Username: "root", Email: "root@email", SetupExpires: "soon"}, webauth.ErrBootstrapInvalid},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := bootstrapAppForTest(t, tc.store, tc.c)
+
+			setupURL, err := app.Bootstrap()
+			if !errors.Is(err, tc.err) || setupURL != "" {
+				t.Errorf("Bootstrap() = %q, %v, want no setup URL and %v", setupURL, err, tc.err)
+			}
+
+			if exists, _ := tc.store.UserExists("root"); exists {
+				t.Error("Bootstrap() created root")
+			}
+		})
+	}
+}
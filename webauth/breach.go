@@ -0,0 +1,100 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bnixon67/webapp/pwned"
+)
+
+const (
+	MsgPasswordBreached     = "This password appeared in a data breach. Please choose a different password."
+	MsgPasswordBreachedWarn = "This password appeared in a data breach. Choose a different password or confirm to use it anyway."
+)
+
+// ConfigBreach holds how new passwords are checked against passwords
+// known from data breaches, using the k-anonymity range API of Have I
+// Been Pwned. Only the first five characters of the SHA-1 hash of a
+// password are sent.
+type ConfigBreach struct {
+	Mode     string // "" (disabled), "warn", or "reject".
+	URL      string // URL of the range API. Default pwned.DefaultURL.
+	Dir      string // Dir of range files to use offline instead of URL.
+	CacheTTL string // Duration string to cache ranges. Default 24h.
+}
+
+// breachCheck is the parsed ConfigBreach.
+type breachCheck struct {
+	checker *pwned.Checker // checker is nil if disabled.
+	warn    bool           // warn allows breached passwords if confirmed.
+}
+
+// parse returns the breachCheck for c that uses clock to expire the cache.
+func (c ConfigBreach) parse(clock Clock) (breachCheck, error) {
+	var b breachCheck
+
+	switch c.Mode {
+	case "":
+		return b, nil
+	case "warn":
+		b.warn = true
+	case "reject":
+	default:
+		return b, fmt.Errorf("unknown Breach.Mode %q", c.Mode)
+	}
+
+	opts := []pwned.Option{pwned.WithNow(clock.Now)}
+	if c.URL != "" {
+		opts = append(opts, pwned.WithURL(c.URL))
+	}
+	if c.Dir != "" {
+		opts = append(opts, pwned.WithDir(c.Dir))
+	}
+	if c.CacheTTL != "" {
+		ttl, err := time.ParseDuration(c.CacheTTL)
+		if err != nil {
+			return b, fmt.Errorf("invalid Breach.CacheTTL: %w", err)
+		}
+		opts = append(opts, pwned.WithCacheTTL(ttl))
+	}
+
+	b.checker = pwned.New(opts...)
+
+	return b, nil
+}
+
+// breachMessage returns the message to show if password appeared in a
+// data breach, or "" if it can be used. If warn is true, the password can
+// be used once the user confirms with acknowledged. Errors checking the
+// password are logged and the password is allowed, so an unavailable
+// service does not prevent registration or reset.
+func (app *AuthApp) breachMessage(ctx context.Context, logger *slog.Logger, password string, acknowledged bool) (msg string, warn bool) {
+	if app.breach.checker == nil {
+		return "", false
+	}
+
+	count, err := app.breach.checker.Count(ctx, password)
+	if err != nil {
+		logger.Error("failed to check breached passwords", "err", err)
+		return "", false
+	}
+	if count == 0 {
+		return "", false
+	}
+
+	logger.Warn("password appeared in breach", "count", count, "warn", app.breach.warn, "acknowledged", acknowledged)
+
+	if !app.breach.warn {
+		return MsgPasswordBreached, false
+	}
+	if acknowledged {
+		return "", false
+	}
+
+	return MsgPasswordBreachedWarn, true
+}
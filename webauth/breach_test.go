@@ -0,0 +1,167 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// breachServer returns a range API server that reports "password one" as
+// breached. Its SHA-1 is A63F1597E4EFED34DC55D8355C6DC40610EEE88E.
+func breachServer(t *testing.T, status int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("597E4EFED34DC55D8355C6DC40610EEE88E:12\r\n"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestConfigBreach(t *testing.T) {
+	tests := []struct {
+		name    string
+		breach  webauth.ConfigBreach
+		wantErr error
+	}{
+		{"disabled", webauth.ConfigBreach{}, nil},
+		{"warn", webauth.ConfigBreach{Mode: "warn"}, nil},
+		{"reject", webauth.ConfigBreach{Mode: "reject", Dir: t.TempDir(), CacheTTL: "1h"}, nil},
+		{"unknownMode", webauth.ConfigBreach{Mode: "block"}, webauth.ErrInvalidConfig},
+		{"invalidTTL", webauth.ConfigBreach{Mode: "warn", CacheTTL: "x"}, webauth.ErrInvalidConfig},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("LoadConfigFromJSON() failed: %v", err)
+			}
+			cfg.Auth.Breach = tc.breach
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterBreachedPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		status       int
+		ack          string
+		wantInBody   string
+		wantLocation string
+	}{
+		{"reject", "reject", http.StatusOK, "yes", webauth.MsgPasswordBreached, ""},
+		{"warn", "warn", http.StatusOK, "", webauth.MsgPasswordBreachedWarn, ""},
+		{"warnAck", "warn", http.StatusOK, "yes", "", "/login"},
+		{"unavailable", "reject", http.StatusServiceUnavailable, "", "", "/login"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := breachServer(t, tc.status)
+			app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+				cfg.Auth.Breach = webauth.ConfigBreach{Mode: tc.mode, URL: srv.URL + "/"}
+			}}, webauth.WithDB(StoreForTest(t)))
+
+			data := url.Values{
+				"username":  {"breach"},
+				"fullName":  {"full name"},
+				"email":     {"breach@email"},
+				"password1": {"password one"},
+				"password2": {"password one"},
+				"breachAck": {tc.ack},
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(data.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			app.RegisterHandler(w, r)
+
+			if tc.wantInBody != "" && !strings.Contains(w.Body.String(), tc.wantInBody) {
+				t.Errorf("got body %q, expected %q in body", w.Body, tc.wantInBody)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("got location %q, expected %q", got, tc.wantLocation)
+			}
+
+			exists, err := app.DB.UserExists("breach")
+			if err != nil {
+				t.Fatalf("UserExists() failed: %v", err)
+			}
+			if exists != (tc.wantLocation != "") {
+				t.Errorf("user exists = %v, want %v", exists, tc.wantLocation != "")
+			}
+		})
+	}
+}
+
+func TestResetBreachedPassword(t *testing.T) {
+	srv := breachServer(t, http.StatusOK)
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Auth.Breach = webauth.ConfigBreach{Mode: "warn", URL: srv.URL + "/"}
+	}}, webauth.WithDB(store))
+
+	token, err := store.CreateToken("reset", "test", webauth.ResetTokenSize, webauth.ResetTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	nonce, err := store.CreateFormNonce(webauth.FormReset, webauth.FormNonceExpires)
+	if err != nil {
+		t.Fatalf("CreateFormNonce() failed: %v", err)
+	}
+
+	data := url.Values{
+		"rtoken":    {token.Value},
+		"password1": {"password one"},
+		"password2": {"password one"},
+		"formNonce": {nonce},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/reset", strings.NewReader(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	app.ResetHandler(w, r)
+
+	body := w.Body.String()
+	if !strings.Contains(body, webauth.MsgPasswordBreachedWarn) || !strings.Contains(body, `name="breachAck"`) {
+		t.Errorf("got body %q, expected warning and confirmation", body)
+	}
+	if !strings.Contains(body, token.Value) {
+		t.Error("reset token not kept in form")
+	}
+	if err := store.CheckPassword("test", "password"); err != nil {
+		t.Errorf("password changed before confirmation: %v", err)
+	}
+
+	data.Set("breachAck", "yes")
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "/reset", strings.NewReader(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	app.ResetHandler(w, r)
+
+	if got := w.Header().Get("Location"); got != "/login" {
+		t.Errorf("got location %q, expected %q", got, "/login")
+	}
+	if err := store.CheckPassword("test", "password one"); err != nil {
+		t.Errorf("password not changed after confirmation: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/netip"
+	"time"
+
+	"github.com/bnixon67/webapp/webcache"
+	"github.com/bnixon67/webapp/webredis"
+)
+
+// Defaults of ConfigCache.
+const (
+	DefaultGeoCacheTTL      = time.Hour
+	DefaultFragmentCacheTTL = 10 * time.Second
+	DefaultCacheMaxEntries  = 10000
+)
+
+// ConfigCache holds the settings of the in-memory caches, whose stats are
+// published with expvar under "webcache". A TTL of "0" disables a cache.
+type ConfigCache struct {
+	// Sessions is how long the users of login tokens are cached, such as
+	// "30s". A logout is seen at once, but other changes to users and
+	// their sessions, and logouts on other instances, are only seen when
+	// it expires, so it is disabled if empty. If Config.Redis is set, the
+	// cache is kept in Redis, so logouts are seen by all instances.
+	Sessions string
+
+	Geo        string // Geo is how long countries are cached, or DefaultGeoCacheTTL if empty.
+	Fragments  string // Fragments is how long page fragments are cached, or DefaultFragmentCacheTTL if empty.
+	MaxEntries int    // MaxEntries of each cache, or DefaultCacheMaxEntries if zero.
+}
+
+// caches are the caches of ConfigCache. A disabled cache is nil.
+type caches struct {
+	sessions  webcache.Store[string, User]           // sessions are users by hashed login token.
+	geo       *webcache.Cache[netip.Addr, string]    // geo are countries by address.
+	fragments *webcache.Cache[string, template.HTML] // fragments are rendered templates by name and key.
+}
+
+// parse returns the caches of c that are enabled. The session cache is
+// kept in redis if it is not nil.
+func (c ConfigCache) parse(clock Clock, redis *webredis.Client) (caches, error) {
+	maxEntries := c.MaxEntries
+	if maxEntries < 0 {
+		return caches{}, fmt.Errorf("negative Cache.MaxEntries %d", maxEntries)
+	}
+	if maxEntries == 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+
+	ttl := func(field, value string, def time.Duration) (time.Duration, error) {
+		if value == "" {
+			return def, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Cache.%s: %w", field, err)
+		}
+		if d < 0 {
+			return 0, fmt.Errorf("negative Cache.%s %q", field, value)
+		}
+		return d, nil
+	}
+	opts := func(name string, ttl time.Duration) []webcache.Option {
+		return []webcache.Option{
+			webcache.WithTTL(ttl),
+			webcache.WithMaxEntries(maxEntries),
+			webcache.WithNow(clock.Now),
+			webcache.WithMetrics(name),
+		}
+	}
+
+	var cs caches
+
+	sessions, err := ttl("Sessions", c.Sessions, 0)
+	if err != nil {
+		return caches{}, err
+	}
+	switch {
+	case sessions > 0 && redis != nil:
+		cs.sessions = webredis.NewCache[User](redis, "sessions", sessions)
+	case sessions > 0:
+		cs.sessions = webcache.New[string, User](opts("sessions", sessions)...)
+	}
+
+	geo, err := ttl("Geo", c.Geo, DefaultGeoCacheTTL)
+	if err != nil {
+		return caches{}, err
+	}
+	if geo > 0 {
+		cs.geo = webcache.New[netip.Addr, string](opts("geo", geo)...)
+	}
+
+	fragments, err := ttl("Fragments", c.Fragments, DefaultFragmentCacheTTL)
+	if err != nil {
+		return caches{}, err
+	}
+	if fragments > 0 {
+		cs.fragments = webcache.New[string, template.HTML](opts("fragments", fragments)...)
+	}
+
+	return cs, nil
+}
+
+// sessionUser returns the user of loginToken with their roles, from the
+// session cache if enabled.
+func (app *AuthApp) sessionUser(ctx context.Context, loginToken string) (User, error) {
+	load := func(ctx context.Context) (User, error) {
+		user, err := app.DB.UserForLoginTokenContext(ctx, loginToken)
+		if err != nil {
+			return User{}, err
+		}
+
+		roles, err := app.DB.UserRoles(user.Username)
+		if err != nil {
+			return User{}, err
+		}
+		user.setRoles(roles)
+
+		return user, nil
+	}
+
+	if app.caches.sessions == nil {
+		return load(ctx)
+	}
+
+	return app.caches.sessions.GetOrLoad(ctx, Hash(loginToken), load)
+}
+
+// forgetSession removes loginToken from the session cache, e.g., when the
+// user logs out.
+func (app *AuthApp) forgetSession(loginToken string) {
+	if app.caches.sessions != nil {
+		app.caches.sessions.Delete(Hash(loginToken))
+	}
+}
+
+// country returns the country of addr from app.Geo, which is cached if
+// enabled.
+func (app *AuthApp) country(addr netip.Addr) (string, error) {
+	if app.caches.geo == nil {
+		return app.Geo.Country(addr)
+	}
+
+	return app.caches.geo.GetOrLoad(context.Background(), addr, func(context.Context) (string, error) {
+		return app.Geo.Country(addr)
+	})
+}
+
+// Fragment returns the template name executed with the data returned by
+// load, such as part of a page that is slow to build and the same for
+// all users. It is cached by name and key for Config.Cache.Fragments, and
+// load is only called if it is not cached.
+func (app *AuthApp) Fragment(ctx context.Context, name, key string, load func(context.Context) (any, error)) (template.HTML, error) {
+	render := func(ctx context.Context) (template.HTML, error) {
+		data, err := load(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if app.Tmpl == nil {
+			return "", fmt.Errorf("no template for fragment %q", name)
+		}
+
+		var buf bytes.Buffer
+		if err := app.Tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+
+		// The output of html/template is already escaped.
+		return template.HTML(buf.String()), nil
+	}
+
+	if app.caches.fragments == nil {
+		return render(ctx)
+	}
+
+	return app.caches.fragments.GetOrLoad(ctx, name+"\x00"+key, render)
+}
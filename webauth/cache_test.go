@@ -0,0 +1,203 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestSessionCache(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Cache.Sessions = "1m"
+	}}, webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	username := func() string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+		user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("UserFromRequest() failed: %v", err)
+		}
+		return user.Username
+	}
+
+	if got := username(); got != "test" {
+		t.Fatalf("username = %q, want %q", got, "test")
+	}
+
+	// A session removed elsewhere is seen when the cache expires.
+	if err := app.DB.RemoveToken(webauth.LoginTokenKind, token.Value); err != nil {
+		t.Fatalf("RemoveToken() failed: %v", err)
+	}
+	if got := username(); got != "test" {
+		t.Errorf("username = %q from cache, want %q", got, "test")
+	}
+
+	clock.Advance(time.Minute)
+	if got := username(); got != "" {
+		t.Errorf("username = %q after cache expired, want empty", got)
+	}
+}
+
+func TestSessionCacheLogout(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Cache.Sessions = "1m"
+	}}, webauth.WithDB(StoreForTest(t)))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	requestAs(app.LogoutHandler, token.Value, http.MethodGet, "/logout", "")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+	user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+	if err != nil || user.Username != "" {
+		t.Errorf("UserFromRequest() = %q, %v after logout, want no user", user.Username, err)
+	}
+}
+
+func TestSessionCacheAuthChange(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Cache.Sessions = "1m"
+	}}, webauth.WithDB(StoreForTest(t)))
+
+	user := func(token string) webauth.User {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token})
+		user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("UserFromRequest() failed: %v", err)
+		}
+		return user
+	}
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+	if got := user(token.Value).Username; got != "test" {
+		t.Fatalf("username = %q, want %q", got, "test")
+	}
+
+	// A role granted to the user is seen before the cache expires.
+	if err := app.DB.SaveRole(webauth.Role{Name: "editor", Permissions: []webauth.Permission{webauth.PermViewUsers}}); err != nil {
+		t.Fatalf("SaveRole() failed: %v", err)
+	}
+	if err := app.DB.GrantRole("test", "editor"); err != nil {
+		t.Fatalf("GrantRole() failed: %v", err)
+	}
+	if got := user(token.Value); !got.Can(webauth.PermViewUsers) {
+		t.Errorf("roles = %v after GrantRole, want editor", got.Roles)
+	}
+
+	// A disabled user is rejected before the cache expires.
+	if _, err := app.DB.DisableUsers([]string{"test"}); err != nil {
+		t.Fatalf("DisableUsers() failed: %v", err)
+	}
+	if got := user(token.Value).Username; got != "" {
+		t.Errorf("username = %q after DisableUsers, want empty", got)
+	}
+}
+
+func TestGeoCache(t *testing.T) {
+	var lookups int
+	geo := webauth.GeoLocatorFunc(func(addr netip.Addr) (string, error) {
+		lookups++
+		return geoForTest(addr)
+	})
+
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Geo.Block = []string{"CN"}
+	}}, webauth.WithDB(StoreForTest(t)), webauth.WithGeoLocator(geo))
+
+	data := url.Values{"username": {"test"}, "password": {"password"}}
+	for i := 0; i < 2; i++ {
+		w := geoRequest(app.LoginPostHandler, "/login", "192.0.2.1", data)
+		if !strings.Contains(w.Body.String(), webauth.MsgGeoBlocked) {
+			t.Errorf("body does not contain %q", webauth.MsgGeoBlocked)
+		}
+	}
+
+	if lookups != 1 {
+		t.Errorf("got %d lookups, want 1", lookups)
+	}
+}
+
+func TestFragment(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	var loads int
+	load := func(context.Context) (any, error) {
+		loads++
+		return webauth.StatusSummaryData{Healthy: true}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := app.Fragment(context.Background(), webauth.StatusSummaryTmpl, "", load)
+		if err != nil {
+			t.Fatalf("Fragment() failed: %v", err)
+		}
+		if !strings.Contains(string(got), "All systems operational") {
+			t.Errorf("Fragment() = %q, want summary", got)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("got %d loads, want 1", loads)
+	}
+
+	errLoad := errors.New("load failed")
+	_, err := app.Fragment(context.Background(), webauth.StatusSummaryTmpl, "other", func(context.Context) (any, error) {
+		return nil, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Errorf("Fragment() error = %v, want %v", err, errLoad)
+	}
+}
+
+func TestConfigCacheInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*webauth.Config)
+	}{
+		{"sessions", func(c *webauth.Config) { c.Cache.Sessions = "soon" }},
+		{"geo", func(c *webauth.Config) { c.Cache.Geo = "-1h" }},
+		{"fragments", func(c *webauth.Config) { c.Cache.Fragments = "1" }},
+		{"maxEntries", func(c *webauth.Config) { c.Cache.MaxEntries = -1 }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			tc.modify(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, webauth.ErrInvalidConfig) {
+				t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clock := webauth.NewFakeClock(start)
+
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, want %v", got, start)
+	}
+
+	clock.Advance(time.Hour)
+	if got, want := clock.Now(), start.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Now() after Advance = %v, want %v", got, want)
+	}
+
+	clock.Set(start)
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now() after Set = %v, want %v", got, start)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	app := AppWithClockForTest(t, clock)
+
+	token, err := app.CreateLoginToken("test")
+	if err != nil {
+		t.Fatalf("CreateLoginToken() failed: %v", err)
+	}
+
+	d, err := time.ParseDuration(app.Cfg.Auth.LoginExpires)
+	if err != nil {
+		t.Fatalf("invalid LoginExpires: %v", err)
+	}
+	if want := clock.Now().Add(d); !token.Expires.Equal(want) {
+		t.Errorf("token.Expires = %v, want %v", token.Expires, want)
+	}
+}
@@ -11,28 +11,77 @@ import (
 
 	"github.com/bnixon67/required"
 	"github.com/bnixon67/webapp/email"
+	"github.com/bnixon67/webapp/notify"
 	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/weblog"
+	"github.com/bnixon67/webapp/webpages"
+	"github.com/bnixon67/webapp/webredis"
+	"github.com/bnixon67/webapp/webserver"
 )
 
 // ConfigAuth holds settings specific to the auth app.
 type ConfigAuth struct {
-	BaseURL      string `required:"true"` // Base URL of the application.
-	LoginExpires string `required:"true"` // Duration string for expiry.
+	BaseURL        string `required:"true"` // Base URL of the application.
+	LoginExpires   string `required:"true"` // Duration string for expiry.
+	RefreshExpires string // Duration string for refresh tokens, if enabled.
+	MagicExpires   string // Duration string for login links, if enabled.
+	DeleteGrace    string // Duration string before deleted accounts are purged, if enabled.
+	SessionIdle    string // Duration string unused sessions are kept, if limited.
+	ResendCooldown string // Duration string between confirm resends.
+	ResendDailyMax int    // Maximum confirm resends per day.
+	SigningKey     string // Secret key used to sign URLs.
+	BounceSecret   string // Secret required by the bounce webhook.
+
+	SigningKeyID string            // ID of the key in SigningKeys used to sign.
+	SigningKeys  map[string]string // Signing keys by ID, including retired keys.
+
+	UsernameCooldown  string   // Duration string between username changes.
+	UsernameGrace     string   // Duration string old usernames still work.
+	ReservedUsernames []string // Usernames users cannot change to.
+
+	// ConcealAccounts makes registration respond the same whether or not
+	// the username or email is registered, and emails the address instead.
+	ConcealAccounts bool
+
+	Password ConfigPassword // Password hashing algorithm and parameters.
+	Breach   ConfigBreach   // Check of new passwords against data breaches.
+	Cookie   ConfigCookie   // Format of cookie values.
 }
 
 // ConfigSQL hold SQL database connection settings.
 type ConfigSQL struct {
 	DriverName     string `required:"true"` // Database driver name.
 	DataSourceName string `required:"true"` // Database connection string.
+	Migrate        bool   // Apply pending migrations when opened.
 }
 
 // Config represents the overall application configuration.
 type Config struct {
-	webapp.Config                  // Inherit webapp.Config
-	Auth          ConfigAuth       // Auth app configuration.
-	SQL           ConfigSQL        // SQL Database configuration.
-	SMTP          email.SMTPConfig // SMTP server configuration.
-	EmailFrom     string           `required:"true"` // From address for emails.
+	webapp.Config                        // Inherit webapp.Config
+	Auth          ConfigAuth             // Auth app configuration.
+	SQL           ConfigSQL              // SQL Database configuration.
+	SMTP          email.SMTPConfig       // SMTP server configuration.
+	EmailFrom     string                 `required:"true"` // From address for emails.
+	Notify        notify.Config          // Operational notification sinks.
+	Debug         ConfigDebug            // pprof and expvar handlers.
+	OAuth         map[string]ConfigOAuth // OAuth login providers by name.
+	Deadline      ConfigDeadline         // Request deadlines.
+	RateLimit     ConfigRateLimit        // API request quotas.
+	Signature     ConfigSignature        // Keys of API clients that sign requests.
+	CSP           ConfigCSP              // Content Security Policy reports.
+	Retention     ConfigRetention        // Retention periods of data.
+	Geo           ConfigGeo              // Restrictions by client location.
+	Screen        ConfigScreen           // Screening of suspicious requests.
+	Risk          ConfigRisk             // Risk scores of logins and registrations.
+	Security      ConfigSecurity         // Hardening of cookies and headers.
+	Pages         webpages.Config        // Markdown pages, if Pages.Dir is set.
+	Proxy         ConfigProxy            // Reverse proxies trusted to forward the client.
+	CORS          ConfigCORS             // Cross-origin access to the API.
+	Search        ConfigSearch           // Full-text search index.
+	Cache         ConfigCache            // In-memory caches.
+	Redis         webredis.Config        // State shared by instances, if Redis.Addr is set.
+	Bootstrap     ConfigBootstrap        // Admin created on the first boot, if there are no users.
+	Waitlist      ConfigWaitlist         // New users held for approval, if Waitlist.Enabled.
 }
 
 var (
@@ -73,9 +122,51 @@ func (c *Config) redact() RedactedConfig {
 
 	r := RedactedConfig(*c)
 	r.SQL.DataSourceName = "[REDACTED]"
+	if r.Auth.SigningKey != "" {
+		r.Auth.SigningKey = "[REDACTED]"
+	}
+	if r.Auth.BounceSecret != "" {
+		r.Auth.BounceSecret = "[REDACTED]"
+	}
+	if r.Auth.SigningKeys != nil {
+		keys := make(map[string]string, len(r.Auth.SigningKeys))
+		for id := range r.Auth.SigningKeys {
+			keys[id] = "[REDACTED]"
+		}
+		r.Auth.SigningKeys = keys
+	}
+	if r.Redis.Password != "" {
+		r.Redis.Password = "[REDACTED]"
+	}
+	if r.Bootstrap.Password != "" {
+		r.Bootstrap.Password = "[REDACTED]"
+	}
+	if r.Signature.Keys != nil {
+		keys := make(map[string]string, len(r.Signature.Keys))
+		for id := range r.Signature.Keys {
+			keys[id] = "[REDACTED]"
+		}
+		r.Signature.Keys = keys
+	}
 	return r
 }
 
+// Hash returns a hash of the redacted config, which is the same for
+// instances of an app with the same config. The Server and Log settings
+// are left out, since they can differ between instances.
+func (c *Config) Hash() string {
+	r := c.redact()
+	r.Server = webserver.Config{}
+	r.Log = weblog.Config{}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+
+	return Hash(string(b))
+}
+
 // MarshalJSON customizes JSON marshalling to redact sensitive Config data.
 func (c *Config) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.redact())
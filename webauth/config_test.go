@@ -11,7 +11,9 @@ import (
 	"testing"
 
 	"github.com/bnixon67/webapp/email"
+	"github.com/bnixon67/webapp/notify"
 	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webredis"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -165,17 +167,30 @@ func TestConfigIsValid(t *testing.T) {
 
 func TestConfigMarshalJSON(t *testing.T) {
 	input := webauth.Config{
+		Auth: webauth.ConfigAuth{
+			SigningKey:   "secret",
+			BounceSecret: "secret",
+		},
 		SQL: webauth.ConfigSQL{
 			DataSourceName: "user:password@localhost/db",
 		},
 		SMTP: email.SMTPConfig{
 			Password: "supersecret",
 		},
+		Notify: notify.Config{
+			Slack: "https://hooks.slack.com/secret",
+		},
+		Redis: webredis.Config{
+			Password: "secret",
+		},
+		Bootstrap: webauth.ConfigBootstrap{
+			Password: "secret",
+		},
 	}
 
-	empty := `{"App":{"Name":"","AssetsDir":"","TmplPattern":""},"Server":{"Host":"","Port":"","CertFile":"","KeyFile":""},"Log":{"Filename":"","Type":"","Level":"","AddSource":false},"Auth":{"BaseURL":"","LoginExpires":""},"SQL":{"DriverName":"","DataSourceName":""},"SMTP":{"Host":"","Port":"","Username":"","Password":""},"EmailFrom":""}`
+	empty := `{"App":{"Name":"","AssetsDir":"","TmplPattern":"","TmplLeftDelim":"","TmplRightDelim":"","TimeZone":"","TimeZones":null},"Server":{"Host":"","Port":"","CertFile":"","KeyFile":"","Certs":null,"ShutdownTimeout":"","ReadTimeout":"","WriteTimeout":"","IdleTimeout":"","ReadHeaderTimeout":"","MaxHeaderBytes":0,"MaxBodyBytes":0,"UnixSocket":"","UnixSocketPerm":"","TLSReload":"","H2C":false,"HTTP3":false,"Autocert":{"Domains":null,"CacheDir":"","Email":"","HTTPAddr":""}},"Log":{"Filename":"","Type":"","Level":"","AddSource":false},"Auth":{"BaseURL":"","LoginExpires":"","RefreshExpires":"","MagicExpires":"","DeleteGrace":"","SessionIdle":"","ResendCooldown":"","ResendDailyMax":0,"SigningKey":"","BounceSecret":"","SigningKeyID":"","SigningKeys":null,"UsernameCooldown":"","UsernameGrace":"","ReservedUsernames":null,"ConcealAccounts":false,"Password":{"Algorithm":"","BcryptCost":0,"Argon2Time":0,"Argon2Memory":0,"Argon2Threads":0},"Breach":{"Mode":"","URL":"","Dir":"","CacheTTL":""},"Cookie":{"Version":"","MinVersion":""}},"SQL":{"DriverName":"","DataSourceName":"","Migrate":false},"SMTP":{"Host":"","Port":"","Username":"","Password":""},"EmailFrom":"","Notify":{"EmailTo":null,"Slack":"","Teams":"","Matrix":{"Homeserver":"","RoomID":"","AccessToken":""}},"Debug":{"Enabled":false,"AllowIPs":null},"OAuth":null,"Deadline":{"Page":"","API":"","APIPrefixes":null},"RateLimit":{"Limit":0,"Window":""},"Signature":{"Keys":null,"Clients":null,"MaxSkew":""},"CSP":{"Directives":null,"ReportLimit":0},"Retention":{"Events":"","Emails":"","Analytics":"","Audit":"","DryRun":false},"Geo":{"Block":null,"Challenge":null,"Tor":"","TorExitList":"","AllowIPs":null,"AllowUsers":null},"Screen":{"Paths":null,"UserAgents":null,"NoAccept":false,"Fingerprints":null,"Block":0,"Limit":0},"Risk":{"Challenge":0,"Deny":0,"Window":""},"Security":{"Hardened":false,"HSTSMaxAge":"","HSTSPreload":false,"ReferrerPolicy":"","PermissionsPolicy":null,"FrameOptions":""},"Pages":{"Dir":"","Prefix":"","Routes":null,"Layout":""},"Proxy":{"Trusted":null},"CORS":{"Origins":null,"Methods":null,"Headers":null,"ExposedHeaders":null,"Credentials":false,"MaxAge":""},"Search":{"Index":false,"Interval":""},"Cache":{"Sessions":"","Geo":"","Fragments":"","MaxEntries":0},"Redis":{"Addr":"","Password":"","DB":0,"PoolSize":0,"Timeout":"","Prefix":""},"Bootstrap":{"Username":"","Email":"","FullName":"","Password":"","Invite":false,"SetupExpires":""},"Waitlist":{"Enabled":false,"Cohort":0}}`
 
-	want := `{"App":{"Name":"","AssetsDir":"","TmplPattern":""},"Server":{"Host":"","Port":"","CertFile":"","KeyFile":""},"Log":{"Filename":"","Type":"","Level":"","AddSource":false},"Auth":{"BaseURL":"","LoginExpires":""},"SQL":{"DriverName":"","DataSourceName":"[REDACTED]"},"SMTP":{"Host":"","Port":"","Username":"","Password":"[REDACTED]"},"EmailFrom":""}`
+	want := `{"App":{"Name":"","AssetsDir":"","TmplPattern":"","TmplLeftDelim":"","TmplRightDelim":"","TimeZone":"","TimeZones":null},"Server":{"Host":"","Port":"","CertFile":"","KeyFile":"","Certs":null,"ShutdownTimeout":"","ReadTimeout":"","WriteTimeout":"","IdleTimeout":"","ReadHeaderTimeout":"","MaxHeaderBytes":0,"MaxBodyBytes":0,"UnixSocket":"","UnixSocketPerm":"","TLSReload":"","H2C":false,"HTTP3":false,"Autocert":{"Domains":null,"CacheDir":"","Email":"","HTTPAddr":""}},"Log":{"Filename":"","Type":"","Level":"","AddSource":false},"Auth":{"BaseURL":"","LoginExpires":"","RefreshExpires":"","MagicExpires":"","DeleteGrace":"","SessionIdle":"","ResendCooldown":"","ResendDailyMax":0,"SigningKey":"[REDACTED]","BounceSecret":"[REDACTED]","SigningKeyID":"","SigningKeys":null,"UsernameCooldown":"","UsernameGrace":"","ReservedUsernames":null,"ConcealAccounts":false,"Password":{"Algorithm":"","BcryptCost":0,"Argon2Time":0,"Argon2Memory":0,"Argon2Threads":0},"Breach":{"Mode":"","URL":"","Dir":"","CacheTTL":""},"Cookie":{"Version":"","MinVersion":""}},"SQL":{"DriverName":"","DataSourceName":"[REDACTED]","Migrate":false},"SMTP":{"Host":"","Port":"","Username":"","Password":"[REDACTED]"},"EmailFrom":"","Notify":{"EmailTo":null,"Slack":"[REDACTED]","Teams":"","Matrix":{"Homeserver":"","RoomID":"","AccessToken":""}},"Debug":{"Enabled":false,"AllowIPs":null},"OAuth":null,"Deadline":{"Page":"","API":"","APIPrefixes":null},"RateLimit":{"Limit":0,"Window":""},"Signature":{"Keys":null,"Clients":null,"MaxSkew":""},"CSP":{"Directives":null,"ReportLimit":0},"Retention":{"Events":"","Emails":"","Analytics":"","Audit":"","DryRun":false},"Geo":{"Block":null,"Challenge":null,"Tor":"","TorExitList":"","AllowIPs":null,"AllowUsers":null},"Screen":{"Paths":null,"UserAgents":null,"NoAccept":false,"Fingerprints":null,"Block":0,"Limit":0},"Risk":{"Challenge":0,"Deny":0,"Window":""},"Security":{"Hardened":false,"HSTSMaxAge":"","HSTSPreload":false,"ReferrerPolicy":"","PermissionsPolicy":null,"FrameOptions":""},"Pages":{"Dir":"","Prefix":"","Routes":null,"Layout":""},"Proxy":{"Trusted":null},"CORS":{"Origins":null,"Methods":null,"Headers":null,"ExposedHeaders":null,"Credentials":false,"MaxAge":""},"Search":{"Index":false,"Interval":""},"Cache":{"Sessions":"","Geo":"","Fragments":"","MaxEntries":0},"Redis":{"Addr":"","Password":"[REDACTED]","DB":0,"PoolSize":0,"Timeout":"","Prefix":""},"Bootstrap":{"Username":"","Email":"","FullName":"","Password":"[REDACTED]","Invite":false,"SetupExpires":""},"Waitlist":{"Enabled":false,"Cohort":0}}`
 
 	testCases := []struct {
 		name  string
@@ -221,14 +236,30 @@ func TestConfigString(t *testing.T) {
 		{
 			name: "testRedact",
 			input: &webauth.Config{
+				Auth: webauth.ConfigAuth{
+					SigningKey:   "secret",
+					BounceSecret: "secret",
+				},
 				SQL: webauth.ConfigSQL{
 					DataSourceName: "user:password@localhost/db",
 				},
 				SMTP: email.SMTPConfig{
 					Password: "supersecret",
 				},
+				Notify: notify.Config{
+					Slack: "https://hooks.slack.com/secret",
+				},
+				OAuth: map[string]webauth.ConfigOAuth{
+					"google": {ClientID: "id", ClientSecret: "secret"},
+				},
+				Redis: webredis.Config{
+					Password: "secret",
+				},
+				Bootstrap: webauth.ConfigBootstrap{
+					Password: "secret",
+				},
 			},
-			want: `{Config:{App:{Name: AssetsDir: TmplPattern:} Server:{Host: Port: CertFile: KeyFile:} Log:{Filename: Type: Level: AddSource:false}} Auth:{BaseURL: LoginExpires:} SQL:{DriverName: DataSourceName:[REDACTED]} SMTP:{Host: Port: Username: Password:[REDACTED]} EmailFrom:}`,
+			want: `{Config:{App:{Name: AssetsDir: TmplPattern: TmplLeftDelim: TmplRightDelim: TimeZone: TimeZones:[]} Server:{Host: Port: CertFile: KeyFile: Certs:[] ShutdownTimeout: ReadTimeout: WriteTimeout: IdleTimeout: ReadHeaderTimeout: MaxHeaderBytes:0 MaxBodyBytes:0 UnixSocket: UnixSocketPerm: TLSReload: H2C:false HTTP3:false Autocert:{Domains:[] CacheDir: Email: HTTPAddr:}} Log:{Filename: Type: Level: AddSource:false}} Auth:{BaseURL: LoginExpires: RefreshExpires: MagicExpires: DeleteGrace: SessionIdle: ResendCooldown: ResendDailyMax:0 SigningKey:[REDACTED] BounceSecret:[REDACTED] SigningKeyID: SigningKeys:map[] UsernameCooldown: UsernameGrace: ReservedUsernames:[] ConcealAccounts:false Password:{Algorithm: BcryptCost:0 Argon2Time:0 Argon2Memory:0 Argon2Threads:0} Breach:{Mode: URL: Dir: CacheTTL:} Cookie:{Version: MinVersion:}} SQL:{DriverName: DataSourceName:[REDACTED] Migrate:false} SMTP:{Host: Port: Username: Password:[REDACTED]} EmailFrom: Notify:{EmailTo:[] Slack:[REDACTED] Teams: Matrix:{Homeserver: RoomID: AccessToken:}} Debug:{Enabled:false AllowIPs:[]} OAuth:map[google:{Kind: Issuer: ClientID:id ClientSecret:[REDACTED] Scopes:[] Label:}] Deadline:{Page: API: APIPrefixes:[]} RateLimit:{Limit:0 Window:} Signature:{Keys:map[] Clients:map[] MaxSkew:} CSP:{Directives:map[] ReportLimit:0} Retention:{Events: Emails: Analytics: Audit: DryRun:false} Geo:{Block:[] Challenge:[] Tor: TorExitList: AllowIPs:[] AllowUsers:[]} Screen:{Paths:[] UserAgents:[] NoAccept:false Fingerprints:[] Block:0 Limit:0} Risk:{Challenge:0 Deny:0 Window:} Security:{Hardened:false HSTSMaxAge: HSTSPreload:false ReferrerPolicy: PermissionsPolicy:map[] FrameOptions:} Pages:{Dir: Prefix: Routes:map[] Layout:} Proxy:{Trusted:[]} CORS:{Origins:[] Methods:[] Headers:[] ExposedHeaders:[] Credentials:false MaxAge:} Search:{Index:false Interval:} Cache:{Sessions: Geo: Fragments: MaxEntries:0} Redis:{Addr: Password:[REDACTED] DB:0 PoolSize:0 Timeout: Prefix:} Bootstrap:{Username: Email: FullName: Password:[REDACTED] Invite:false SetupExpires:} Waitlist:{Enabled:false Cohort:0}}`,
 		},
 	}
 
@@ -241,3 +272,25 @@ func TestConfigString(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigHash(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	want := cfg.Hash()
+
+	// Settings of the instance itself do not change the hash.
+	same := *cfg
+	same.Server.Port = "9999"
+	same.Log.Level = "DEBUG"
+	if got := same.Hash(); got != want {
+		t.Errorf("Hash() = %q after server and log changes, want %q", got, want)
+	}
+
+	other := *cfg
+	other.Auth.LoginExpires = "1h"
+	if got := other.Hash(); got == want {
+		t.Errorf("Hash() = %q after auth change, want it to differ", got)
+	}
+}
@@ -40,7 +40,7 @@ func (app *AuthApp) ConfirmHandlerGet(w http.ResponseWriter, r *http.Request) {
 	ctoken := r.URL.Query().Get("ctoken")
 
 	data := ConfirmData{ConfirmToken: ctoken}
-	app.RenderPage(w, logger, ConfirmTmpl, &data)
+	app.RenderPage(w, r, logger, ConfirmTmpl, &data)
 
 	logger.Info("done")
 }
@@ -57,16 +57,16 @@ var tokenErrToMsg = map[error]string{
 	ErrConfirmTokenExpired: MsgExpiredConfirmToken,
 }
 
-func (app *AuthApp) respondWithError(w http.ResponseWriter, logger *slog.Logger, err error, ctoken string) {
+func (app *AuthApp) respondWithError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error, ctoken string) {
 	logger.Error("failed to confirm user", "err", err)
 
 	msg, ok := tokenErrToMsg[err]
 	if !ok {
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	app.RenderPage(w, logger, ConfirmTmpl, &ConfirmData{Message: msg})
+	app.RenderPage(w, r, logger, ConfirmTmpl, &ConfirmData{Message: msg})
 }
 
 // ConfirmHandlerPost processes POST requests for user email confirmation.
@@ -86,18 +86,18 @@ func (app *AuthApp) ConfirmHandlerPost(w http.ResponseWriter, r *http.Request) {
 
 	username, err := app.DB.UsernameForConfirmToken(ctoken)
 	if err != nil {
-		app.respondWithError(w, logger, err, ctoken)
+		app.respondWithError(w, r, logger, err, ctoken)
 		return
 	}
 
 	err = app.DB.ConfirmUser(username, ctoken)
 	if err != nil {
-		app.respondWithError(w, logger, err, ctoken)
+		app.respondWithError(w, r, logger, err, ctoken)
 		return
 	}
 
 	logger.Info("user confirmed", "username", username)
-	app.DB.WriteEvent(EventConfirmed, true, username, "success")
+	app.DB.RecordEvent(NewEvent(TypeConfirmed, username, nil))
 
 	http.Redirect(w, r, "/confirmed", http.StatusSeeOther)
 }
@@ -4,28 +4,17 @@
 package webauth_test
 
 import (
-	"bytes"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"testing"
-	"text/template"
+	"time"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
 )
 
 func confirmBody(data webauth.ConfirmData) string {
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", webauth.ConfirmTmpl)
-
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	var body bytes.Buffer
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest(webauth.ConfirmTmpl, data)
 }
 
 func TestConfirmHandlerGet(t *testing.T) {
@@ -56,34 +45,27 @@ func TestConfirmHandlerGet(t *testing.T) {
 }
 
 func TestConfirmHandlerPost(t *testing.T) {
-	app := AppForTest(t)
+	clock := webauth.NewFakeClock(time.Now())
+	app := AppWithClockForTest(t, clock)
 
 	header := http.Header{
 		"Content-Type": {"application/x-www-form-urlencoded"},
 	}
 
-	utoken, err := app.DB.CreateConfirmEmailToken("unconfirmed")
+	expiredToken, err := app.CreateConfirmEmailToken("expired")
 	if err != nil {
-		t.Fatalf("could not create confirm email token")
+		t.Fatalf("could not create expired confirm email token: %v", err)
 	}
 
-	_, err = app.DB.Exec(
-		"UPDATE users SET confirmed = 0 WHERE username = ?",
-		"unconfirmed")
+	d, err := time.ParseDuration(webauth.ConfirmTokenExpires)
 	if err != nil {
-		t.Fatalf("could not unconfirm user")
+		t.Fatalf("invalid ConfirmTokenExpires: %v", err)
 	}
+	clock.Advance(d + time.Second)
 
-	expiredToken, err := app.DB.CreateConfirmEmailToken("expired")
+	utoken, err := app.CreateConfirmEmailToken("unconfirmed")
 	if err != nil {
-		t.Fatalf("could not create expired confirm email token")
-	}
-
-	_, err = app.DB.Exec(
-		"UPDATE tokens SET expires = NOW() WHERE username = ?",
-		"expired")
-	if err != nil {
-		t.Fatalf("could not expire token: %v", err)
+		t.Fatalf("could not create confirm email token")
 	}
 
 	tests := []webhandler.TestCase{
@@ -4,8 +4,8 @@
 package webauth
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -40,7 +40,7 @@ func (app *AuthApp) ConfirmRequestHandlerGet(w http.ResponseWriter, r *http.Requ
 	}
 
 	data := ConfirmRequestPageData{}
-	app.RenderPage(w, logger, "confirm_request.html", &data)
+	app.RenderPage(w, r, logger, "confirm_request.html", &data)
 
 	logger.Info("done")
 }
@@ -62,7 +62,7 @@ func (app *AuthApp) ConfirmRequestHandlerPost(w http.ResponseWriter, r *http.Req
 	if email == "" {
 		logger.Warn("email is empty")
 		data := ConfirmRequestPageData{Message: MsgMissingEmail}
-		app.RenderPage(w, logger, "confirm_request.html", &data)
+		app.RenderPage(w, r, logger, "confirm_request.html", &data)
 		return
 	}
 
@@ -70,7 +70,7 @@ func (app *AuthApp) ConfirmRequestHandlerPost(w http.ResponseWriter, r *http.Req
 	if err != nil && !errors.Is(err, ErrUserNotFound) {
 		logger.Error("failed to get username for email",
 			"err", err, "email", email)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 	if username == "" {
@@ -80,18 +80,18 @@ func (app *AuthApp) ConfirmRequestHandlerPost(w http.ResponseWriter, r *http.Req
 		// that the provided email address is not registered.
 	}
 
-	token, err := app.DB.CreateConfirmEmailToken(username)
+	token, err := app.CreateConfirmEmailToken(username)
 	if err != nil {
 		slog.Error("failed to create confirm email token",
 			"err", err, "username", username)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	err = sendEmailToConfirm(username, email, token, app.Cfg)
-	if err != nil {
+	err = app.sendEmailToConfirm(r.Context(), username, email, token)
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
 		logger.Error("unable to send email", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
@@ -108,15 +108,16 @@ You can ignore this message if you did not request to confirm an email for {{.Ti
 `
 
 // sendEmailToConfirm sends an email to allow user to confirm their email.
-func sendEmailToConfirm(username, email string, token Token, cfg Config) error {
-	subj := fmt.Sprintf("%s confirm email", cfg.App.Name)
+func (app *AuthApp) sendEmailToConfirm(ctx context.Context, username, email string, token Token) error {
+	cfg := app.Cfg
+	subj := app.Printer(ctx).T("%s confirm email", cfg.App.Name)
 
 	var body string
 	var err error
 
 	switch {
 	case username == "":
-		body, err = emailBody(
+		body, err = app.emailBody(ctx,
 			"notregistered",
 			emailNotRegisteredTemplate,
 			emailData{
@@ -125,8 +126,8 @@ func sendEmailToConfirm(username, email string, token Token, cfg Config) error {
 				BaseURL: cfg.Auth.BaseURL,
 			})
 	default:
-		body, err = emailBody(
-			"password",
+		body, err = app.emailBody(ctx,
+			"confirm",
 			confirmRequestEmailTmpl,
 			emailData{
 				Token:   token,
@@ -139,23 +140,15 @@ func sendEmailToConfirm(username, email string, token Token, cfg Config) error {
 		}
 	}
 
-	err = cfg.SMTP.SendMessage(cfg.EmailFrom, []string{email}, subj, body)
-	if err != nil {
-		return err
-	}
-
-	slog.Info("sent email", slog.Group("email",
-		slog.String("to", email), slog.String("subject", subj)))
-
-	return err
+	return app.sendEmail(ctx, email, subj, body, nil)
 }
 
 // CreateConfirmEmailToken generates a new token to confirm a user's email.
-func (db *AuthDB) CreateConfirmEmailToken(username string) (Token, error) {
+func (app *AuthApp) CreateConfirmEmailToken(username string) (Token, error) {
 	// special case for empty username
 	if username == "" {
 		return Token{}, nil
 	}
 
-	return db.CreateToken("confirm", username, ConfirmTokenSize, ConfirmTokenExpires)
+	return app.DB.CreateToken("confirm", username, ConfirmTokenSize, ConfirmTokenExpires)
 }
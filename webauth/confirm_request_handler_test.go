@@ -4,50 +4,20 @@
 package webauth_test
 
 import (
-	"bytes"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"testing"
-	"text/template"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
 )
 
 func confirmRequestBody(data webauth.ConfirmRequestPageData) string {
-	// Get path to template file.
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", "confirm_request.html")
-
-	// Parse the HTML template from a file.
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	// Create a buffer to store the rendered HTML.
-	var body bytes.Buffer
-
-	// Execute the template with the data and write result to the buffer.
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest("confirm_request.html", data)
 }
 
 func sentConfirmRequestBody(data webauth.ConfirmRequestPageData) string {
-	// Get path to template file.
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", "confirm_request_sent.html")
-
-	// Parse the HTML template from a file.
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	// Create a buffer to store the rendered HTML.
-	var body bytes.Buffer
-
-	// Execute the template with the data and write the result to the buffer.
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest("confirm_request_sent.html", data)
 }
 
 func TestConfirmRequestHandlerGet(t *testing.T) {
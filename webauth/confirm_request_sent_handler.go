@@ -29,7 +29,7 @@ func (app *AuthApp) ConfirmRequestSentHandlerGet(w http.ResponseWriter, r *http.
 	}
 
 	data := ConfirmRequestSentData{EmailFrom: app.Cfg.EmailFrom}
-	app.RenderPage(w, logger, ConfirmRequestSentTmpl, &data)
+	app.RenderPage(w, r, logger, ConfirmRequestSentTmpl, &data)
 
 	logger.Info("done")
 }
@@ -4,27 +4,15 @@
 package webauth_test
 
 import (
-	"bytes"
 	"net/http"
-	"path/filepath"
 	"testing"
-	"text/template"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
 )
 
 func confirmRequestSentBody(data webauth.ConfirmRequestSentData) string {
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", webauth.ConfirmRequestSentTmpl)
-
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	var body bytes.Buffer
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest(webauth.ConfirmRequestSentTmpl, data)
 }
 
 func TestConfirmRequestSentHandlerGet(t *testing.T) {
@@ -0,0 +1,270 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const ConfirmResendTmpl = "confirm_resend.html"
+
+// Default limits used if not provided in the config.
+const (
+	DefaultResendCooldown = "1m" // Minimum time between resends.
+	DefaultResendDailyMax = 5    // Maximum resends in a 24 hour period.
+)
+
+// Messages displayed to the user for a resend request.
+const (
+	MsgAlreadyConfirmed = "Your email is already confirmed."
+	MsgResendCooldown   = "A confirmation was recently sent. Please wait before trying again."
+	MsgResendDailyLimit = "Too many confirmations were sent today. Please try again tomorrow."
+	MsgResendFailed     = "Unable to send a confirmation. Please try again later."
+)
+
+var (
+	ErrResendCooldown   = errors.New("confirm resend cooldown active")
+	ErrResendDailyLimit = errors.New("confirm resend daily limit reached")
+)
+
+// ResendLimit defines how often a confirm token can be resent to a user.
+type ResendLimit struct {
+	Cooldown time.Duration // Minimum time between resends.
+	DailyMax int           // Maximum resends in a 24 hour period.
+}
+
+// ResendLimit returns the confirm resend limits from the config, using
+// defaults for missing values. An error is returned for invalid values.
+func (c ConfigAuth) ResendLimit() (ResendLimit, error) {
+	cooldown := c.ResendCooldown
+	if cooldown == "" {
+		cooldown = DefaultResendCooldown
+	}
+
+	d, err := time.ParseDuration(cooldown)
+	if err != nil {
+		return ResendLimit{}, err
+	}
+	if d < 0 {
+		return ResendLimit{}, fmt.Errorf("negative ResendCooldown %q", cooldown)
+	}
+
+	dailyMax := c.ResendDailyMax
+	if dailyMax == 0 {
+		dailyMax = DefaultResendDailyMax
+	}
+	if dailyMax < 0 {
+		return ResendLimit{}, fmt.Errorf("negative ResendDailyMax %d", dailyMax)
+	}
+
+	return ResendLimit{Cooldown: d, DailyMax: dailyMax}, nil
+}
+
+// Check returns an error if another resend is not allowed at now, given
+// count resends in the last 24 hours with the most recent at last.
+func (l ResendLimit) Check(count int, last, now time.Time) error {
+	if count >= l.DailyMax {
+		return ErrResendDailyLimit
+	}
+
+	if !last.IsZero() && now.Sub(last) < l.Cooldown {
+		return ErrResendCooldown
+	}
+
+	return nil
+}
+
+// ResendCount returns the number of successful confirm resends for username
+// since the given time and the time of the most recent one.
+func (db *AuthDB) ResendCount(username string, since time.Time) (int, time.Time, error) {
+	if db == nil {
+		return 0, time.Time{}, ErrInvalidDB
+	}
+
+	var (
+		count int
+		last  time.Time
+	)
+
+	// Scan each row instead of using MAX(created), which some drivers
+	// return as text, since the number of resends is limited.
+	qry := `SELECT created FROM events WHERE name = ? AND succeeded = true AND ` + eventsForUser + ` AND created > ? ORDER BY created DESC`
+	rows, err := db.Query(qry, EventResend, username, username, since)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var created time.Time
+		if err := rows.Scan(&created); err != nil {
+			return 0, time.Time{}, err
+		}
+		if count == 0 {
+			last = created
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return count, last, nil
+}
+
+// ConfirmResendData contains data to render the confirm resend template.
+type ConfirmResendData struct {
+	CommonData
+	User    User   // Current user, if logged in.
+	Message string // An message to display to the user.
+}
+
+// ConfirmResendHandlerGet processes GET requests for the confirm resend
+// page. A logged in user can request a new confirmation token directly,
+// otherwise the user is identified by their email. Submission is via a POST
+// request, which is handled by ConfirmResendHandlerPost.
+func (app *AuthApp) ConfirmResendHandlerGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.IsMethodOrError(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := ConfirmResendData{User: user}
+	app.RenderPage(w, r, logger, ConfirmResendTmpl, &data)
+
+	logger.Info("done")
+}
+
+// ConfirmResendHandlerPost processes POST requests to resend a confirmation
+// token, subject to a per-user cooldown and daily maximum.
+//
+// For a user identified by email, the response does not reveal if the email
+// is registered, confirmed, or rate limited.
+func (app *AuthApp) ConfirmResendHandlerPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.IsMethodOrError(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	loggedIn := user.Username != ""
+
+	if !loggedIn {
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		if email == "" {
+			logger.Warn("email is empty")
+			data := ConfirmResendData{Message: MsgMissingEmail}
+			app.RenderPage(w, r, logger, ConfirmResendTmpl, &data)
+			return
+		}
+
+		user, err = app.userForEmail(email)
+		if err != nil {
+			if errors.Is(err, ErrUserNotFound) {
+				logger.Warn("did not find user for email",
+					"email", email)
+				http.Redirect(w, r, "/confirm_request_sent", http.StatusSeeOther)
+				return
+			}
+			logger.Error("failed to get user for email",
+				"err", err, "email", email)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+	logger = logger.With(slog.String("username", user.Username))
+
+	msg, err := app.resendConfirm(r.Context(), user)
+	if err != nil {
+		logger.Warn("did not resend confirm", "err", err)
+		if loggedIn {
+			data := ConfirmResendData{User: user, Message: msg}
+			app.RenderPage(w, r, logger, ConfirmResendTmpl, &data)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/confirm_request_sent", http.StatusSeeOther)
+
+	logger.Info("done")
+}
+
+// userForEmail returns the user with the given email.
+func (app *AuthApp) userForEmail(email string) (User, error) {
+	username, err := app.DB.UsernameForEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+
+	return app.DB.UserForName(username)
+}
+
+// resendConfirm checks the resend limits for the user and, if allowed,
+// creates and emails a new confirm token. If not sent, a message to
+// display to the user and the error is returned.
+func (app *AuthApp) resendConfirm(ctx context.Context, user User) (string, error) {
+	if user.Confirmed {
+		return MsgAlreadyConfirmed, errors.New("user already confirmed")
+	}
+
+	limit, err := app.Cfg.Auth.ResendLimit()
+	if err != nil {
+		return MsgResendFailed, err
+	}
+
+	now := app.Clock.Now()
+	count, last, err := app.DB.ResendCount(user.Username, now.Add(-24*time.Hour))
+	if err != nil {
+		return MsgResendFailed, err
+	}
+
+	err = limit.Check(count, last, now)
+	if err != nil {
+		app.DB.RecordEvent(ErrorEvent(TypeResendFailed, user.Username, err))
+		if errors.Is(err, ErrResendDailyLimit) {
+			return MsgResendDailyLimit, err
+		}
+		return MsgResendCooldown, err
+	}
+
+	token, err := app.CreateConfirmEmailToken(user.Username)
+	if err != nil {
+		return MsgResendFailed, err
+	}
+
+	err = app.sendEmailToConfirm(ctx, user.Username, user.Email, token)
+	if err != nil {
+		app.DB.RecordEvent(ErrorEvent(TypeResendFailed, user.Username, err))
+		return MsgResendFailed, err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeResendSent, user.Username, nil))
+
+	return "", nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func confirmResendBody(data webauth.ConfirmResendData) string {
+	return renderForTest(webauth.ConfirmResendTmpl, data)
+}
+
+func TestConfigAuthResendLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     webauth.ConfigAuth
+		want    webauth.ResendLimit
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			cfg:  webauth.ConfigAuth{},
+			want: webauth.ResendLimit{
+				Cooldown: time.Minute,
+				DailyMax: webauth.DefaultResendDailyMax,
+			},
+		},
+		{
+			name: "configured",
+			cfg: webauth.ConfigAuth{
+				ResendCooldown: "10m",
+				ResendDailyMax: 3,
+			},
+			want: webauth.ResendLimit{
+				Cooldown: 10 * time.Minute,
+				DailyMax: 3,
+			},
+		},
+		{
+			name:    "invalidCooldown",
+			cfg:     webauth.ConfigAuth{ResendCooldown: "foo"},
+			wantErr: true,
+		},
+		{
+			name:    "negativeCooldown",
+			cfg:     webauth.ConfigAuth{ResendCooldown: "-1m"},
+			wantErr: true,
+		},
+		{
+			name:    "negativeDailyMax",
+			cfg:     webauth.ConfigAuth{ResendDailyMax: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.cfg.ResendLimit()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ResendLimit() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ResendLimit() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResendLimitCheck(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	limit := webauth.ResendLimit{Cooldown: 5 * time.Minute, DailyMax: 3}
+
+	tests := []struct {
+		name    string
+		count   int
+		last    time.Time
+		wantErr error
+	}{
+		{"first", 0, time.Time{}, nil},
+		{"afterCooldown", 1, now.Add(-5 * time.Minute), nil},
+		{"duringCooldown", 1, now.Add(-time.Minute), webauth.ErrResendCooldown},
+		{"dailyLimit", 3, now.Add(-time.Hour), webauth.ErrResendDailyLimit},
+		{"dailyLimitAndCooldown", 3, now, webauth.ErrResendDailyLimit},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := limit.Check(tc.count, tc.last, now)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Check(%d, %v, %v) = %v, want %v",
+					tc.count, tc.last, now, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfirmResendHandlerGet(t *testing.T) {
+	app := AppForTest(t)
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "validRequest",
+			Target:        "/confirm/resend",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusOK,
+			WantBody: confirmResendBody(webauth.ConfirmResendData{
+				CommonData: webauth.CommonData{
+					Title: app.Cfg.App.Name,
+				},
+			}),
+		},
+		{
+			Name:          "invalidMethod",
+			Target:        "/confirm/resend",
+			RequestMethod: http.MethodPatch,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "Error: Method Not Allowed\n",
+		},
+	}
+
+	webhandler.TestHandler(t, app.ConfirmResendHandlerGet, tests)
+}
+
+func TestConfirmResendHandlerPost(t *testing.T) {
+	app := AppForTest(t)
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/confirm/resend",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "Error: Method Not Allowed\n",
+		},
+		{
+			Name:           "missingEmail",
+			Target:         "/confirm/resend",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			WantStatus:     http.StatusOK,
+			WantBody: confirmResendBody(webauth.ConfirmResendData{
+				CommonData: webauth.CommonData{
+					Title: app.Cfg.App.Name,
+				},
+				Message: webauth.MsgMissingEmail,
+			}),
+		},
+		{
+			Name:           "unknownEmail",
+			Target:         "/confirm/resend",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestBody:    url.Values{"email": {"unknown@email"}}.Encode(),
+			WantStatus:     http.StatusSeeOther,
+		},
+		{
+			Name:           "confirmedEmail",
+			Target:         "/confirm/resend",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestBody:    url.Values{"email": {"confirmed@email"}}.Encode(),
+			WantStatus:     http.StatusSeeOther,
+		},
+	}
+
+	webhandler.TestHandler(t, app.ConfirmResendHandlerPost, tests)
+}
@@ -28,7 +28,7 @@ func (app *AuthApp) ConfirmedHandlerGet(w http.ResponseWriter, r *http.Request)
 	}
 
 	data := ConfirmedData{}
-	app.RenderPage(w, logger, ConfirmedTmpl, &data)
+	app.RenderPage(w, r, logger, ConfirmedTmpl, &data)
 
 	logger.Info("done")
 }
@@ -4,32 +4,15 @@
 package webauth_test
 
 import (
-	"bytes"
 	"net/http"
-	"path/filepath"
 	"testing"
-	"text/template"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
 )
 
 func confirmedBody(data webauth.ConfirmedData) string {
-	// Get path to template file.
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", webauth.ConfirmedTmpl)
-
-	// Parse the HTML template from a file.
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	// Create a buffer to store the rendered HTML.
-	var body bytes.Buffer
-
-	// Execute the template with the data and write result to the buffer.
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest(webauth.ConfirmedTmpl, data)
 }
 
 func TestConfirmedHandlerGet(t *testing.T) {
@@ -0,0 +1,178 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// Versions of the format of cookie values.
+const (
+	CookieV0            = 0        // CookieV0 is the unversioned value.
+	CookieV1            = 1        // CookieV1 prefixes the value with "v1.".
+	LatestCookieVersion = CookieV1 // LatestCookieVersion can be read.
+)
+
+// ConfigCookie controls the format of cookie values, so that instances
+// running different versions can share cookies during a rolling or
+// blue/green deploy.
+//
+// A new format is rolled out by first deploying a version that accepts
+// it, with Version set to the old format, and then changing Version once
+// no instance that cannot read the new format remains. Version defaults
+// to "v0", which instances from before versioning can read. Cookies in an
+// older format that is still accepted are re-issued in the Version
+// format on the next request. Cookies older than MinVersion are removed,
+// which requires the user to login again.
+type ConfigCookie struct {
+	Version    string // Version written, e.g., "v1". Defaults to "v0".
+	MinVersion string // Oldest version accepted. Defaults to "v0".
+}
+
+var (
+	ErrCookieVersion = errors.New("invalid cookie version")
+	ErrCookieTooOld  = errors.New("cookie version no longer accepted")
+	ErrCookieTooNew  = errors.New("cookie version not supported")
+)
+
+// cookieVersionRE matches the version prefix of a cookie value.
+// Unversioned values, i.e., base64 tokens and signed payloads, never
+// match since they do not contain a dot after a "v" and digits.
+var cookieVersionRE = regexp.MustCompile(`^v([0-9]{1,3})\.`)
+
+// cookieFormat is the parsed ConfigCookie.
+type cookieFormat struct {
+	write int // write is the version of new cookies.
+	min   int // min is the oldest version accepted.
+}
+
+// parseCookieVersion returns the version named by s, e.g., "v1", or def if
+// s is empty.
+func parseCookieVersion(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+
+	if len(s) < 2 || s[0] != 'v' {
+		return 0, fmt.Errorf("%w: %q", ErrCookieVersion, s)
+	}
+	v, err := strconv.Atoi(s[1:])
+	if err != nil || v < CookieV0 || v > LatestCookieVersion {
+		return 0, fmt.Errorf("%w: %q", ErrCookieVersion, s)
+	}
+
+	return v, nil
+}
+
+// format returns the validated format of c.
+func (c ConfigCookie) format() (cookieFormat, error) {
+	var f cookieFormat
+	var err error
+
+	f.write, err = parseCookieVersion(c.Version, CookieV0)
+	if err != nil {
+		return cookieFormat{}, err
+	}
+
+	f.min, err = parseCookieVersion(c.MinVersion, CookieV0)
+	if err != nil {
+		return cookieFormat{}, err
+	}
+
+	if f.min > f.write {
+		return cookieFormat{}, fmt.Errorf("%w: MinVersion %q is newer than Version %q", ErrCookieVersion, c.MinVersion, c.Version)
+	}
+
+	return f, nil
+}
+
+// encode returns value in the format of new cookies.
+func (f cookieFormat) encode(value string) string {
+	if f.write == CookieV0 {
+		return value
+	}
+
+	return "v" + strconv.Itoa(f.write) + "." + value
+}
+
+// decode returns the value and version of the cookie value v.
+//
+// ErrCookieTooOld is returned if the version is older than accepted, so
+// the cookie should be removed. ErrCookieTooNew is returned if the
+// version is newer than this build can read, so the cookie should be
+// kept for the instance that wrote it.
+func (f cookieFormat) decode(v string) (string, int, error) {
+	m := cookieVersionRE.FindStringSubmatch(v)
+	if m == nil {
+		if f.min > CookieV0 {
+			return "", CookieV0, ErrCookieTooOld
+		}
+		return v, CookieV0, nil
+	}
+
+	version, _ := strconv.Atoi(m[1])
+	switch {
+	case version > LatestCookieVersion:
+		return "", version, ErrCookieTooNew
+	case version < f.min:
+		return "", version, ErrCookieTooOld
+	}
+
+	return v[len(m[0]):], version, nil
+}
+
+// reissue returns true if a cookie of version should be re-issued in the
+// format of new cookies.
+func (f cookieFormat) reissue(version int) bool {
+	return version != f.write
+}
+
+// loginCookie returns the login cookie for token in the format of new
+// cookies.
+func (app *AuthApp) loginCookie(token Token, remember bool) *http.Cookie {
+	c := LoginCookie(app.cookies.encode(token.Value), token.Expires, remember)
+	c.Name = app.loginCookieName()
+	return c
+}
+
+// loginCookieToken returns the login token and the version of the login
+// cookie of r. The token is empty if there is no login cookie.
+func (app *AuthApp) loginCookieToken(r *http.Request) (string, int, error) {
+	value, err := CookieValue(r, app.loginCookieName())
+	if err != nil || value == "" {
+		return "", CookieV0, err
+	}
+
+	return app.cookies.decode(value)
+}
+
+// reissueLoginCookie sets a login cookie for token in the format of new
+// cookies. Whether the user asked to be remembered is not known, so the
+// cookie expires with the token.
+func (app *AuthApp) reissueLoginCookie(w http.ResponseWriter, token string) error {
+	t, err := app.DB.TokenForFingerprint(TokenFingerprint(token))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, app.loginCookie(Token{Value: token, Expires: t.Expires}, true))
+
+	return nil
+}
+
+// clearLoginCookie removes the login cookie. If hardened, it is Secure,
+// since browsers ignore prefixed cookies that are not.
+func (app *AuthApp) clearLoginCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   app.loginCookieName(),
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+		Secure: app.Cfg.Security.Hardened,
+	})
+}
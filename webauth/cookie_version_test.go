@@ -0,0 +1,167 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withCookieFormat returns a config modifier that sets the cookie format.
+func withCookieFormat(version, minVersion string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.Cookie = webauth.ConfigCookie{Version: version, MinVersion: minVersion}
+	}
+}
+
+func TestLoginCookieVersions(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		minVersion  string
+		prefix      string // prefix of the login token in the cookie.
+		wantUser    bool
+		wantReissue bool
+		wantPrefix  string // wantPrefix is the prefix of a re-issued cookie.
+		wantClear   bool
+	}{
+		{"unversioned", "", "", "", true, false, "", false},
+		{"upgrade unversioned", "v1", "", "", true, true, "v1.", false},
+		{"current", "v1", "", "v1.", true, false, "", false},
+		{"rollback", "v0", "", "v1.", true, true, "", false},
+		{"reject unversioned", "v1", "v1", "", false, false, "", true},
+		{"newer", "v1", "", "v2.", false, false, "", false},
+		{"invalid version", "v1", "", "v1x.", false, false, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newAppForTest(t, []func(*webauth.Config){withCookieFormat(tc.version, tc.minVersion)}, webauth.WithDB(StoreForTest(t)))
+
+			token, err := app.LoginUser("test", "password")
+			if err != nil {
+				t.Fatalf("could not login test: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/user", nil)
+			r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: tc.prefix + token.Value})
+			w := httptest.NewRecorder()
+
+			user, err := app.UserFromRequest(w, r)
+			if err != nil {
+				t.Fatalf("UserFromRequest() failed: %v", err)
+			}
+			if got := user.Username == "test"; got != tc.wantUser {
+				t.Errorf("UserFromRequest() user = %q, want user %v", user.Username, tc.wantUser)
+			}
+
+			cookies := w.Result().Cookies()
+			switch {
+			case tc.wantClear:
+				if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+					t.Errorf("cookies = %v, want login cookie removed", cookies)
+				}
+			case tc.wantReissue:
+				if len(cookies) != 1 || cookies[0].Value != tc.wantPrefix+token.Value || cookies[0].Expires.IsZero() {
+					t.Errorf("cookies = %v, want login cookie %q", cookies, tc.wantPrefix+token.Value)
+				}
+			default:
+				if len(cookies) != 0 {
+					t.Errorf("cookies = %v, want none", cookies)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginPostHandlerCookieVersion(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){withCookieFormat("v1", "")}, webauth.WithDB(StoreForTest(t)))
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=test&password=password"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	app.LoginPostHandler(w, r)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !strings.HasPrefix(cookies[0].Value, "v1.") {
+		t.Fatalf("cookies = %v, want v1 login cookie", cookies)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/user", nil)
+	r.AddCookie(cookies[0])
+	user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+	if err != nil || user.Username != "test" {
+		t.Errorf("UserFromRequest() = %q, %v, want test", user.Username, err)
+	}
+}
+
+func TestSignedCookieVersions(t *testing.T) {
+	p := newFakeProvider(t, "subject", "oauth@example.com")
+	provider := func(cfg *webauth.Config) {
+		cfg.OAuth = map[string]webauth.ConfigOAuth{
+			"test": {Issuer: p.URL, ClientID: "client", ClientSecret: "secret"},
+		}
+	}
+	keys := withSigningKeys("key", "", nil)
+	old := AppWithoutDBForTest(t, provider, keys)
+	upgrade := AppWithoutDBForTest(t, provider, keys, withCookieFormat("v1", ""))
+	strict := AppWithoutDBForTest(t, provider, keys, withCookieFormat("v1", "v1"))
+
+	cookie, _ := startOAuthLogin(t, old, p)
+
+	reissue := func(app *webauth.AuthApp, c *http.Cookie) []*http.Cookie {
+		r := httptest.NewRequest(http.MethodGet, "/oauth/callback", nil)
+		r.AddCookie(c)
+		w := httptest.NewRecorder()
+		app.ReissueSignedCookies(http.NotFoundHandler()).ServeHTTP(w, r)
+		return w.Result().Cookies()
+	}
+
+	got := reissue(upgrade, cookie)
+	if len(got) != 1 || got[0].Value != "v1."+cookie.Value {
+		t.Fatalf("cookies = %v, want %q", got, "v1."+cookie.Value)
+	}
+	if got := reissue(upgrade, got[0]); len(got) != 0 {
+		t.Errorf("cookies after upgrade = %v, want none", got)
+	}
+
+	// A rejected cookie is not re-issued, so the login must be restarted.
+	if got := reissue(strict, cookie); len(got) != 0 {
+		t.Errorf("cookies with rejected version = %v, want none", got)
+	}
+}
+
+func TestConfigCookieInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		minVersion string
+	}{
+		{"invalid", "1", ""},
+		{"unknown", "v9", ""},
+		{"min newer", "v0", "v1"},
+		{"invalid min", "", "x"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			withCookieFormat(tc.version, tc.minVersion)(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, webauth.ErrInvalidConfig) || !strings.Contains(err.Error(), webauth.ErrCookieVersion.Error()) {
+				t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrCookieVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// ConfigCORS holds the Cross-Origin Resource Sharing policy of the JSON
+// API and live update routes, so browser apps on other origins can use
+// them. Other origins are not allowed if Origins is empty.
+type ConfigCORS struct {
+	Origins        []string // Origins allowed, "*", or a wildcard like "https://*.example.com".
+	Methods        []string // Methods allowed, or GET, HEAD, and POST if empty.
+	Headers        []string // Headers allowed in requests, such as "Authorization".
+	ExposedHeaders []string // ExposedHeaders readable in responses.
+	Credentials    bool     // Credentials allows cookies with requests.
+	MaxAge         string   // MaxAge preflight results are cached, such as "1h".
+}
+
+// policy returns the CORS policy of c, or nil if no origins are allowed.
+func (c ConfigCORS) policy() (*webhandler.CORSPolicy, error) {
+	if len(c.Origins) == 0 {
+		return nil, nil
+	}
+
+	var (
+		maxAge time.Duration
+		err    error
+	)
+	if c.MaxAge != "" {
+		maxAge, err = time.ParseDuration(c.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CORS.MaxAge: %w", err)
+		}
+	}
+
+	return &webhandler.CORSPolicy{
+		Origins:        c.Origins,
+		Methods:        c.Methods,
+		Headers:        c.Headers,
+		ExposedHeaders: c.ExposedHeaders,
+		Credentials:    c.Credentials,
+		MaxAge:         maxAge,
+	}, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestConfigCORS(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+	if app.CORS != nil {
+		t.Errorf("CORS = %+v, want nil without origins", app.CORS)
+	}
+
+	app = AppWithoutDBForTest(t, func(cfg *webauth.Config) {
+		cfg.CORS = webauth.ConfigCORS{
+			Origins:     []string{"https://app.example.com"},
+			Credentials: true,
+			MaxAge:      "10m",
+		}
+	})
+	if app.CORS == nil || !app.CORS.AllowsOrigin("https://app.example.com") ||
+		!app.CORS.Credentials || app.CORS.MaxAge != 10*time.Minute {
+		t.Errorf("CORS = %+v, want policy of config", app.CORS)
+	}
+}
+
+func TestConfigCORSInvalid(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	cfg.CORS = webauth.ConfigCORS{Origins: []string{"*"}, MaxAge: "forever"}
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// CSPReportPath is the path that collects Content Security Policy
+// violation reports. It is exempt from CSRF, since browsers send the
+// reports without a token.
+const CSPReportPath = "/csp-report"
+
+// DefaultCSPReportLimit is the default number of reports accepted from an
+// address per window.
+const DefaultCSPReportLimit = 100
+
+// Maximum lengths of the fields of a CSPReport, matching the SQL schema.
+// Longer values are truncated.
+const (
+	MaxCSPDirectiveLen  = 100
+	MaxCSPBlockedURILen = 255
+)
+
+// ConfigCSP holds the Content Security Policy and the settings for its
+// violation reports.
+type ConfigCSP struct {
+	// Directives have the sources of Content-Security-Policy directives,
+	// such as "script-src": ["'self'", "'nonce'"], which replace the
+	// sources of the directive in webhandler.DefaultSecurityHeaders.
+	// Directives without sources are removed. A source of
+	// webhandler.CSPNonceSource is replaced by the nonce of each
+	// request, which pages add to inline scripts with NonceAttr.
+	Directives map[string][]string
+
+	// ReportLimit is the number of reports accepted from each address per
+	// RateLimit.Window, or per minute if RateLimit is not set. If zero,
+	// DefaultCSPReportLimit is used.
+	ReportLimit int
+}
+
+// reportLimit returns the validated limit of c.
+func (c ConfigCSP) reportLimit() (int, error) {
+	if c.ReportLimit < 0 {
+		return 0, fmt.Errorf("negative CSP.ReportLimit %d", c.ReportLimit)
+	}
+	if c.ReportLimit == 0 {
+		return DefaultCSPReportLimit, nil
+	}
+	return c.ReportLimit, nil
+}
+
+// CSPReport is the number of violations of a directive that blocked a URI.
+type CSPReport struct {
+	Directive  string
+	BlockedURI string
+	Reports    int
+	FirstSeen  time.Time
+	LastSeen   time.Time
+}
+
+// truncate returns s limited to n bytes, without a partial UTF-8 rune.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
+
+// RecordCSPViolation counts a violation of directive that blocked
+// blockedURI at when.
+func (db *AuthDB) RecordCSPViolation(directive, blockedURI string, when time.Time) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	directive = truncate(directive, MaxCSPDirectiveLen)
+	blockedURI = truncate(blockedURI, MaxCSPBlockedURILen)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := db.Dialect.bindArgs([]any{when, directive, blockedURI})
+
+	result, err := tx.Exec(db.Rebind("UPDATE csp_reports SET reports = reports + 1, last_seen = ? WHERE directive = ? AND blocked_uri = ?"), args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		_, err = tx.Exec(db.Rebind("INSERT INTO csp_reports(directive, blocked_uri, reports, first_seen, last_seen) VALUES (?, ?, 1, ?, ?)"), args[1], args[2], args[0], args[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CSPReports returns the violations of each directive and blocked URI,
+// with the most reports first.
+func (db *AuthDB) CSPReports() ([]CSPReport, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT directive, blocked_uri, reports, first_seen, last_seen FROM csp_reports ORDER BY reports DESC, directive, blocked_uri`
+	rows, err := db.Query(qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []CSPReport
+	for rows.Next() {
+		var c CSPReport
+		if err := rows.Scan(&c.Directive, &c.BlockedURI, &c.Reports, &c.FirstSeen, &c.LastSeen); err != nil {
+			return nil, err
+		}
+		reports = append(reports, c)
+	}
+
+	return reports, rows.Err()
+}
+
+// cspReportWindow returns the length of the windows used to limit
+// reports, which are the RateLimit windows, if set.
+func (app *AuthApp) cspReportWindow() time.Duration {
+	if app.rateLimit.window > 0 {
+		return app.rateLimit.window
+	}
+	return time.Minute
+}
+
+// CSPReportQuota is a webhandler.QuotaFunc that counts reports from the
+// client address against Config.CSP.ReportLimit.
+func (app *AuthApp) CSPReportQuota(r *http.Request) (webhandler.Quota, bool, error) {
+	d := app.cspReportWindow()
+	window := app.Clock.Now().UTC().Truncate(d)
+
+	requests, err := app.DB.CountRequest("csp:"+remoteHost(r), window)
+	if err != nil {
+		return webhandler.Quota{}, false, err
+	}
+
+	return webhandler.Quota{
+		Limit:     app.cspReportLimit,
+		Remaining: app.cspReportLimit - requests,
+		Reset:     window.Add(d),
+	}, true, nil
+}
+
+// CSPReportHandler records the Content Security Policy violations sent by
+// browsers for the report-uri and report-to directives. It responds with
+// http.StatusNoContent. Use webhandler.RateLimit with CSPReportQuota to
+// limit the reports from each address.
+func (app *AuthApp) CSPReportHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	violations, err := webhandler.ParseCSPReport(r)
+	if err != nil {
+		logger.Warn("invalid report", "err", err)
+		status := http.StatusBadRequest
+		if !errors.Is(err, webhandler.ErrCSPReport) {
+			status = http.StatusInternalServerError
+		}
+		webutil.Error(w, r, status, "", "")
+		return
+	}
+
+	now := app.Clock.Now()
+	for _, v := range violations {
+		logger.Info("csp violation",
+			"document", v.DocumentURI,
+			"directive", v.Directive,
+			"blocked", v.BlockedURI,
+			"disposition", v.Disposition)
+
+		if err := app.DB.RecordCSPViolation(v.Directive, v.BlockedURI, now); err != nil {
+			logger.Error("failed to record violation", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CSPReportsPageData contains data passed to the HTML template.
+type CSPReportsPageData struct {
+	CommonData
+	User    User
+	Reports []CSPReport
+}
+
+// CSPReportsHandler shows an admin a summary of the Content Security
+// Policy violations by directive and blocked URI.
+func (app *AuthApp) CSPReportsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	if !user.Can(PermViewCSPReports) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	reports, err := app.DB.CSPReports()
+	if err != nil {
+		logger.Error("failed to get CSP reports", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := &CSPReportsPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Reports:    reports,
+	}
+
+	app.RenderPage(w, r, logger, "csp_reports.html", data)
+
+	logger.Info("done")
+}
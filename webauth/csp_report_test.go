@@ -0,0 +1,135 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// postCSPReport posts a report-uri report of directive blocking uri.
+func postCSPReport(h http.Handler, addr, directive, uri string) *httptest.ResponseRecorder {
+	body := `{"csp-report":{"document-uri":"https://example.com/","effective-directive":"` + directive + `","blocked-uri":"` + uri + `"}}`
+	r := httptest.NewRequest(http.MethodPost, webauth.CSPReportPath, strings.NewReader(body))
+	r.Header.Set("Content-Type", webhandler.CSPReportContentType)
+	r.RemoteAddr = addr
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.CSP.ReportLimit = 2
+	}}, webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	h := webhandler.RateLimit(http.HandlerFunc(app.CSPReportHandler), app.CSPReportQuota)
+
+	for _, addr := range []string{"192.0.2.1:1", "192.0.2.1:2", "192.0.2.2:1"} {
+		w := postCSPReport(h, addr, "script-src-elem", "https://evil.example/x.js")
+		if w.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+		}
+	}
+	clock.Advance(time.Second)
+	postCSPReport(h, "192.0.2.2:1", "img-src", "data")
+
+	// The third report from the same address is limited.
+	w := postCSPReport(h, "192.0.2.1:3", "img-src", "data")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status over limit = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	// A new window allows reports again.
+	clock.Advance(time.Minute)
+	w = postCSPReport(h, "192.0.2.1:3", "bad", "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status in new window = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, webauth.CSPReportPath, strings.NewReader("{"))
+	r.Header.Set("Content-Type", webhandler.CSPReportContentType)
+	w = httptest.NewRecorder()
+	app.CSPReportHandler(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status for invalid report = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	reports, err := app.DB.CSPReports()
+	if err != nil {
+		t.Fatalf("CSPReports() failed: %v", err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports, want 3: %+v", len(reports), reports)
+	}
+	got := reports[0]
+	if got.Directive != "script-src-elem" || got.BlockedURI != "https://evil.example/x.js" || got.Reports != 3 {
+		t.Errorf("first report = %+v, want script-src-elem with 3 reports", got)
+	}
+	if !got.LastSeen.Equal(got.FirstSeen) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, got.FirstSeen)
+	}
+}
+
+func TestCSPReportsHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	w := requestAs(app.CSPReportsHandler, adminToken.Value, http.MethodGet, "/csp-reports", "")
+	if !strings.Contains(w.Body.String(), "No violations reported.") {
+		t.Errorf("body does not report no violations:\n%s", w.Body.String())
+	}
+
+	long := strings.Repeat("x", webauth.MaxCSPBlockedURILen+10)
+	if err := store.RecordCSPViolation("img-src", long, time.Now()); err != nil {
+		t.Fatalf("RecordCSPViolation() failed: %v", err)
+	}
+
+	w = requestAs(app.CSPReportsHandler, userToken.Value, http.MethodGet, "/csp-reports", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status for user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = requestAs(app.CSPReportsHandler, adminToken.Value, http.MethodGet, "/csp-reports", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status for admin = %d, want %d", w.Code, http.StatusOK)
+	}
+	want := "<td>" + long[:webauth.MaxCSPBlockedURILen] + "</td>"
+	if body := w.Body.String(); !strings.Contains(body, "<td>img-src</td>") || !strings.Contains(body, want) {
+		t.Errorf("body missing truncated report:\n%s", body)
+	}
+}
+
+func TestConfigCSP(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("LoadConfigFromJSON() failed: %v", err)
+	}
+	cfg.CSP.ReportLimit = -1
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
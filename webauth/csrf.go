@@ -0,0 +1,42 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// CSRFExemptPrefixes are the paths not checked for a CSRF token. Webhooks
+// are called by other servers and authenticated with a shared secret, CSP
+// reports are sent by browsers without a token, the login and refresh
+// APIs only accept JSON, which cross-site forms cannot send, and email
+// clients post RFC 8058 one-click unsubscribes to signed links.
+var CSRFExemptPrefixes = []string{"/webhook/", CSPReportPath, APILoginPath, APIRefreshPath, UnsubscribePath}
+
+// CSRF returns middleware that requires a valid CSRF token for each POST
+// and other unsafe request handled by next, except for CSRFExemptPrefixes
+// and requests with a signature verified by VerifySignature or a bearer
+// token, which do not rely on cookies. Pages rendered by RenderPage include the token for
+// their forms.
+func (app *AuthApp) CSRF(next http.Handler) http.Handler {
+	checked := webhandler.CSRF(next, CSRFExemptPrefixes...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := webhandler.SignatureKeyID(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Browsers do not add bearer tokens to cross-site requests, so
+		// requests that use them cannot be forged.
+		if webhandler.BearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		checked.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestCSRF(t *testing.T) {
+	app := AppForTest(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", app.LoginGetHandler)
+	mux.HandleFunc("POST /login", app.LoginPostHandler)
+	mux.HandleFunc("POST /webhook/bounce/{provider}", app.BounceWebhookHandler)
+	h := app.CSRF(mux)
+
+	// The login page includes the token from the cookie in its form.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == webhandler.CSRFCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("no CSRF cookie")
+	}
+	if field := string(webutil.CSRFField(cookie.Value)); !strings.Contains(w.Body.String(), field) {
+		t.Errorf("login page missing %s", field)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		token      string
+		wantStatus int
+	}{
+		{"loginWithToken", "/login", cookie.Value, http.StatusOK},
+		{"loginWithoutToken", "/login", "", http.StatusForbidden},
+		// The webhook is not configured, but is not rejected for CSRF.
+		{"webhookExempt", "/webhook/bounce/ses", "", http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"username": {"test"}, "password": {"wrong"}}
+			if tc.token != "" {
+				form.Set(webutil.CSRFFieldName, tc.token)
+			}
+			r := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(cookie)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -4,10 +4,14 @@
 package webauth
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"time"
+
+	"github.com/bnixon67/webapp/webid"
 )
 
 var (
@@ -15,12 +19,80 @@ var (
 	ErrInitDBPing = errors.New("db ping failed")
 )
 
+// AuthDB is an AuthStore that uses a SQL database.
 type AuthDB struct {
 	*sql.DB
+	Dialect Dialect   // Dialect of the SQL. If empty, DialectMySQL is used.
+	Clock   Clock     // Clock is used to expire tokens. If nil, time.Now is used.
+	Rand    io.Reader // Rand is used to create tokens. If nil, crypto/rand is used.
+
+	// Hasher hashes passwords. If nil, a BcryptHasher is used.
+	Hasher PasswordHasher
+
+	// Waitlist holds new users for approval, see ConfigWaitlist.
+	Waitlist bool
+
+	locks leases // locks are the locks of DialectSQLite.
+}
+
+// now returns the current time from db.Clock.
+func (db *AuthDB) now() time.Time {
+	return clockNow(db.Clock)
+}
+
+// SetClock sets the Clock used to expire tokens.
+func (db *AuthDB) SetClock(c Clock) {
+	db.Clock = c
+}
+
+// SetRand sets the source of random bytes used to create tokens.
+func (db *AuthDB) SetRand(r io.Reader) {
+	db.Rand = r
+}
+
+// SetPasswordHasher sets the PasswordHasher used to hash new passwords.
+func (db *AuthDB) SetPasswordHasher(h PasswordHasher) {
+	db.Hasher = h
+}
+
+// newID returns a new id of a record, such as a user, from db.Rand and
+// db.Clock, so that tests can predict it.
+func (db *AuthDB) newID() (string, error) {
+	g := webid.Generator{Rand: randReader(db.Rand), Now: db.now}
+
+	id, err := g.New()
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// SetWaitlist sets whether new users are held for approval.
+func (db *AuthDB) SetWaitlist(enabled bool) {
+	db.Waitlist = enabled
 }
 
 // InitDB initializes a db connection and verifies with a Ping().
+// The Dialect is chosen by DialectForDriver and the driver must be
+// registered by the program, e.g., by importing github.com/go-sql-driver/mysql,
+// github.com/jackc/pgx/v5/stdlib, or modernc.org/sqlite.
+//
+// For SQLite, dataSourceName is a file path, file: URI, or ":memory:". The
+// directory of the file is created if needed and the migrations are always
+// applied, so a new database file can be used without a separate setup step.
+// Use OpenDB to apply migrations for other dialects.
 func InitDB(driverName, dataSourceName string) (*AuthDB, error) {
+	dialect := DialectForDriver(driverName)
+
+	if dialect == DialectSQLite {
+		var err error
+		dataSourceName, err = sqliteDSN(dataSourceName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInitDBOpen, err)
+		}
+	}
+
 	// Open connection to database.
 	db, err := sql.Open(driverName, dataSourceName)
 	if err != nil {
@@ -33,12 +105,36 @@ func InitDB(driverName, dataSourceName string) (*AuthDB, error) {
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(25)
 
+	// SQLite allows one writer and each connection to :memory: is a
+	// different database.
+	if dialect == DialectSQLite {
+		db.SetMaxOpenConns(1)
+		db.SetConnMaxLifetime(0)
+	}
+
 	// Ping database to confirm connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInitDBPing, err)
 	}
 
-	return &AuthDB{DB: db}, nil
+	authDB := &AuthDB{DB: db, Dialect: dialect}
+
+	if dialect == DialectSQLite {
+		if _, err := authDB.Migrate(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return authDB, nil
+}
+
+// PingContext verifies the connection to the database is still alive.
+func (db *AuthDB) PingContext(ctx context.Context) error {
+	if db == nil || db.DB == nil {
+		return ErrInvalidDB
+	}
+
+	return db.DB.PingContext(ctx)
 }
 
 var (
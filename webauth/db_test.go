@@ -67,8 +67,7 @@ func TestInitDB(t *testing.T) {
 }
 
 func TestRowExists(t *testing.T) {
-	a := AppForTest(t)
-	db := a.DB
+	db := DBForTest(t)
 
 	// Define test cases
 	tests := []struct {
@@ -0,0 +1,74 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIPrefixes are the path prefixes of API routes if
+// ConfigDeadline.APIPrefixes is not set.
+var DefaultAPIPrefixes = []string{"/api/", "/webhook/"}
+
+// ConfigDeadline holds the time allowed to handle a request. An empty
+// duration means requests have no deadline.
+type ConfigDeadline struct {
+	Page        string   // Duration string for page routes.
+	API         string   // Duration string for API routes.
+	APIPrefixes []string // Path prefixes of API routes.
+}
+
+// requestTimeouts are the parsed durations of a ConfigDeadline.
+type requestTimeouts struct {
+	page, api   time.Duration
+	apiPrefixes []string
+}
+
+// parse returns the durations of c.
+func (c ConfigDeadline) parse() (requestTimeouts, error) {
+	var t requestTimeouts
+
+	for _, d := range []struct {
+		name string
+		s    string
+		dst  *time.Duration
+	}{
+		{"Page", c.Page, &t.page},
+		{"API", c.API, &t.api},
+	} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil {
+			return requestTimeouts{}, fmt.Errorf("invalid Deadline.%s: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+
+	t.apiPrefixes = c.APIPrefixes
+	if t.apiPrefixes == nil {
+		t.apiPrefixes = DefaultAPIPrefixes
+	}
+
+	return t, nil
+}
+
+// RequestTimeout is a webhandler.TimeoutFunc that returns the Deadline
+// for r. Requests to /debug/ and /live have no deadline, since profiles
+// can be longer and the live stream stays open.
+func (app *AuthApp) RequestTimeout(r *http.Request) time.Duration {
+	if strings.HasPrefix(r.URL.Path, "/debug/") || r.URL.Path == "/live" {
+		return 0
+	}
+
+	if app.isAPIRequest(r) {
+		return app.timeouts.api
+	}
+
+	return app.timeouts.page
+}
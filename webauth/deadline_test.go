@@ -0,0 +1,53 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	app := AppWithoutDBForTest(t, func(cfg *webauth.Config) {
+		cfg.Deadline = webauth.ConfigDeadline{Page: "5s", API: "2s"}
+	})
+
+	tests := []struct {
+		target string
+		want   time.Duration
+	}{
+		{"/login", 5 * time.Second},
+		{"/webhook/bounce/ses", 2 * time.Second},
+		{"/api/users", 2 * time.Second},
+		{"/debug/pprof/profile", 0},
+		{"/live", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			got := app.RequestTimeout(httptest.NewRequest("GET", tc.target, nil))
+			if got != tc.want {
+				t.Errorf("RequestTimeout() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewAppInvalidDeadline(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to created config: %v", err)
+	}
+	cfg.Deadline.Page = "soon"
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
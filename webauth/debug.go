@@ -0,0 +1,91 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// ConfigDebug holds settings for the /debug handlers.
+type ConfigDebug struct {
+	Enabled  bool     // Enabled mounts pprof and expvar under /debug.
+	AllowIPs []string // IPs or CIDRs allowed without an admin login.
+}
+
+// Prefixes returns AllowIPs parsed as prefixes. A single IP is converted
+// to a prefix that contains only that IP.
+func (c ConfigDebug) Prefixes() ([]netip.Prefix, error) {
+	prefixes, err := webhandler.ParsePrefixes(c.AllowIPs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AllowIPs: %w", err)
+	}
+
+	return prefixes, nil
+}
+
+// clientAllowed returns true if the IP of the client of r is in prefixes.
+// The client is the address of the connection, unless RealIP found it
+// from the headers of a trusted proxy, so it cannot be spoofed.
+func clientAllowed(r *http.Request, prefixes []netip.Prefix) bool {
+	addr, err := webhandler.ClientAddr(r)
+	if err != nil {
+		return false
+	}
+
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireDebugAccess returns a handler that calls next if the request is
+// from an address in Debug.AllowIPs or from a logged in admin user.
+func (app *AuthApp) RequireDebugAccess(next http.Handler) http.Handler {
+	admin := app.RequireAdmin(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientAllowed(r, app.debugAllow) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		admin.ServeHTTP(w, r)
+	})
+}
+
+// AddDebugRoutes adds the net/http/pprof and expvar handlers to mux under
+// /debug, guarded by RequireDebugAccess, if Debug.Enabled is true.
+//
+// CPU profiles and traces must be shorter than the server WriteTimeout,
+// e.g., /debug/pprof/profile?seconds=5.
+//
+// The routes are recorded as requiring RoleAdmin, although addresses in
+// Debug.AllowIPs do not need to login.
+func (app *AuthApp) AddDebugRoutes(mux *webhandler.Mux) {
+	if !app.Cfg.Debug.Enabled {
+		return
+	}
+
+	guard := func(h http.HandlerFunc) http.Handler {
+		return app.RequireDebugAccess(h)
+	}
+
+	admin := webhandler.RouteRoles(RoleAdmin)
+
+	mux.Handle("/debug/pprof/", guard(pprof.Index), admin)
+	mux.Handle("/debug/pprof/cmdline", guard(pprof.Cmdline), admin)
+	mux.Handle("/debug/pprof/profile", guard(pprof.Profile), admin)
+	mux.Handle("/debug/pprof/symbol", guard(pprof.Symbol), admin)
+	mux.Handle("/debug/pprof/trace", guard(pprof.Trace), admin)
+	mux.Handle("/debug/vars", app.RequireDebugAccess(expvar.Handler()), admin)
+}
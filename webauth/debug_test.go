@@ -0,0 +1,127 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestConfigDebugPrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{name: "none"},
+		{
+			name:  "ipAndCIDR",
+			allow: []string{"127.0.0.1", "10.1.2.3/8", "::1"},
+			want: []netip.Prefix{
+				netip.MustParsePrefix("127.0.0.1/32"),
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("::1/128"),
+			},
+		},
+		{name: "invalidIP", allow: []string{"localhost"}, wantErr: true},
+		{name: "invalidCIDR", allow: []string{"10.0.0.0/99"}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := webauth.ConfigDebug{AllowIPs: tc.allow}.Prefixes()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Prefixes() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Prefixes() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddDebugRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		debug      webauth.ConfigDebug
+		target     string
+		remoteAddr string
+		wantStatus int
+	}{
+		{
+			name:       "disabled",
+			target:     "/debug/vars",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "allowedVars",
+			debug:      webauth.ConfigDebug{Enabled: true, AllowIPs: []string{"192.0.2.0/24"}},
+			target:     "/debug/vars",
+			remoteAddr: "192.0.2.1:1234",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowedPprof",
+			debug:      webauth.ConfigDebug{Enabled: true, AllowIPs: []string{"::1"}},
+			target:     "/debug/pprof/",
+			remoteAddr: "[::1]:1234",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "notAllowed",
+			debug:      webauth.ConfigDebug{Enabled: true, AllowIPs: []string{"10.0.0.1"}},
+			target:     "/debug/pprof/heap",
+			remoteAddr: "192.0.2.1:1234",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := AppWithoutDBForTest(t, func(c *webauth.Config) {
+				c.Debug = tc.debug
+			})
+
+			mux := webhandler.NewMux()
+			app.AddDebugRoutes(mux)
+
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.remoteAddr != "" {
+				r.RemoteAddr = tc.remoteAddr
+			}
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewAppInvalidDebugAllowIPs(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to created config: %v", err)
+	}
+	cfg.Debug.AllowIPs = []string{"not an ip"}
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
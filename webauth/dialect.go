@@ -0,0 +1,197 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bnixon67/webapp/webtrace"
+)
+
+// Dialect is the flavor of SQL used by a database. Queries in AuthDB are
+// written with ? placeholders and rebound for the dialect.
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// DialectForDriver returns the Dialect for a database/sql driver name.
+// The "postgres" (lib/pq) and "pgx" (pgx stdlib) drivers use DialectPostgres,
+// the "sqlite" (modernc.org/sqlite) and "sqlite3" (mattn/go-sqlite3) drivers
+// use DialectSQLite, and all others use DialectMySQL.
+func DialectForDriver(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx":
+		return DialectPostgres
+	case "sqlite", "sqlite3":
+		return DialectSQLite
+	default:
+		return DialectMySQL
+	}
+}
+
+// Rebind returns qry with ? placeholders replaced by the placeholders of d.
+// A ? inside a quoted string is not replaced.
+func (d Dialect) Rebind(qry string) string {
+	if d != DialectPostgres || !strings.Contains(qry, "?") {
+		return qry
+	}
+
+	var (
+		b      strings.Builder
+		n      int
+		quoted bool
+	)
+	b.Grow(len(qry) + 8)
+
+	for i := 0; i < len(qry); i++ {
+		c := qry[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// bindArgs returns args converted for d.
+func (d Dialect) bindArgs(args []any) []any {
+	if d == DialectSQLite {
+		return sqliteArgs(args)
+	}
+
+	return args
+}
+
+// onConflict returns the clause that ends an INSERT so that a row with the
+// same primary key, of cols, is updated by set instead. Columns in set must
+// be qualified by the table name.
+func (d Dialect) onConflict(cols, set string) string {
+	if d == DialectMySQL {
+		return " ON DUPLICATE KEY UPDATE " + set
+	}
+
+	return " ON CONFLICT (" + cols + ") DO UPDATE SET " + set
+}
+
+// duplicateMessages are parts of the errors of the drivers of each dialect
+// for a row that violates a unique constraint, which are matched instead
+// of importing the drivers.
+var duplicateMessages = map[Dialect][]string{
+	DialectMySQL:    {"Error 1062"},
+	DialectPostgres: {"23505", "duplicate key value"},
+	DialectSQLite:   {"UNIQUE constraint failed"},
+}
+
+// duplicateKey returns err wrapped with ErrDuplicateKey if it is the
+// error of d for a row that violates a unique constraint, or err if not.
+func (d Dialect) duplicateKey(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, msg := range duplicateMessages[d] {
+		if strings.Contains(err.Error(), msg) {
+			return fmt.Errorf("%w: %v", ErrDuplicateKey, err)
+		}
+	}
+
+	return err
+}
+
+// The methods below replace those of the embedded *sql.DB so that queries
+// and their arguments are rebound for the dialect of db.
+
+// Exec executes a query without returning any rows.
+func (db *AuthDB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.DB.Exec(db.Dialect.Rebind(query), db.Dialect.bindArgs(args)...)
+}
+
+// Query executes a query that returns rows.
+func (db *AuthDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.DB.Query(db.Dialect.Rebind(query), db.Dialect.bindArgs(args)...)
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+func (db *AuthDB) QueryRow(query string, args ...any) *sql.Row {
+	return db.DB.QueryRow(db.Dialect.Rebind(query), db.Dialect.bindArgs(args)...)
+}
+
+// The Context methods below are also traced. If ctx is from a request
+// traced by webhandler.Trace, each query is a child span of the request.
+
+// ExecContext is like Exec but the query is canceled if ctx is done.
+func (db *AuthDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+
+	result, err := db.DB.ExecContext(ctx, query, db.Dialect.bindArgs(args)...)
+	if err != nil {
+		span.SetError(err)
+	}
+
+	return result, err
+}
+
+// QueryContext is like Query but the query is canceled if ctx is done.
+func (db *AuthDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+
+	rows, err := db.DB.QueryContext(ctx, query, db.Dialect.bindArgs(args)...)
+	if err != nil {
+		span.SetError(err)
+	}
+
+	return rows, err
+}
+
+// QueryRowContext is like QueryRow but the query is canceled if ctx is done.
+func (db *AuthDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.startQuerySpan(ctx, query)
+	defer span.End()
+
+	row := db.DB.QueryRowContext(ctx, query, db.Dialect.bindArgs(args)...)
+	if err := row.Err(); err != nil {
+		span.SetError(err)
+	}
+
+	return row
+}
+
+// startQuerySpan starts a span for query with the Tracer of ctx, if any.
+func (db *AuthDB) startQuerySpan(ctx context.Context, query string) (context.Context, webtrace.Span) {
+	ctx, span := webtrace.StartSpan(ctx, "db.query")
+
+	system := db.Dialect
+	if system == "" {
+		system = DialectMySQL
+	}
+	span.SetAttribute("db.system", string(system))
+	span.SetAttribute("db.statement", query)
+
+	return ctx, span
+}
+
+// Rebind returns query rebound for the dialect of db, for queries run
+// with a *sql.Tx.
+func (db *AuthDB) Rebind(query string) string {
+	return db.Dialect.Rebind(query)
+}
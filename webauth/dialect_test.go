@@ -0,0 +1,78 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestDialectForDriver(t *testing.T) {
+	tests := []struct {
+		driverName string
+		want       webauth.Dialect
+	}{
+		{"mysql", webauth.DialectMySQL},
+		{"postgres", webauth.DialectPostgres},
+		{"pgx", webauth.DialectPostgres},
+		{"sqlite", webauth.DialectSQLite},
+		{"sqlite3", webauth.DialectSQLite},
+		{"other", webauth.DialectMySQL},
+	}
+
+	for _, tc := range tests {
+		if got := webauth.DialectForDriver(tc.driverName); got != tc.want {
+			t.Errorf("DialectForDriver(%q) = %q, want %q", tc.driverName, got, tc.want)
+		}
+	}
+}
+
+func TestDialectRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect webauth.Dialect
+		qry     string
+		want    string
+	}{
+		{
+			name:    "mysql",
+			dialect: webauth.DialectMySQL,
+			qry:     "SELECT 1 FROM users WHERE username = ? AND email = ?",
+			want:    "SELECT 1 FROM users WHERE username = ? AND email = ?",
+		},
+		{
+			name:    "empty",
+			dialect: "",
+			qry:     "SELECT 1 FROM users WHERE username = ?",
+			want:    "SELECT 1 FROM users WHERE username = ?",
+		},
+		{
+			name:    "postgres",
+			dialect: webauth.DialectPostgres,
+			qry:     "SELECT 1 FROM users WHERE username = ? AND email = ?",
+			want:    "SELECT 1 FROM users WHERE username = $1 AND email = $2",
+		},
+		{
+			name:    "postgresQuoted",
+			dialect: webauth.DialectPostgres,
+			qry:     "SELECT 1 FROM tokens WHERE kind = 'why?' AND hashedValue = ?",
+			want:    "SELECT 1 FROM tokens WHERE kind = 'why?' AND hashedValue = $1",
+		},
+		{
+			name:    "postgresNoPlaceholders",
+			dialect: webauth.DialectPostgres,
+			qry:     "SELECT username FROM users",
+			want:    "SELECT username FROM users",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.dialect.Rebind(tc.qry); got != tc.want {
+				t.Errorf("Rebind(%q) = %q, want %q", tc.qry, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/i18n"
+)
+
+func TestEmailBodyTranslated(t *testing.T) {
+	catalog := i18n.NewCatalog(i18n.DefaultLanguage)
+	catalog.AddTemplate("es", "forgot_user", "Su nombre de usuario de {{.Title}} es {{.Username}}.")
+	app := &AuthApp{Catalog: catalog}
+
+	data := emailData{Title: "App", Username: "alice"}
+
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"es", "Su nombre de usuario de App es alice."},
+		{"", "Your user name for App is alice."},
+	}
+
+	for _, tc := range tests {
+		ctx := i18n.WithLanguage(context.Background(), tc.lang)
+		got, err := app.emailBody(ctx, "forgot_user", emailForgotUserTemplate, data)
+		if err != nil {
+			t.Fatalf("emailBody() failed: %v", err)
+		}
+		if strings.TrimSpace(got) != tc.want {
+			t.Errorf("emailBody() for %q = %q, want %q", tc.lang, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// BounceKind identifies the kind of delivery problem reported for an email.
+type BounceKind string
+
+const (
+	BounceHard      BounceKind = "hard"      // Permanent delivery failure.
+	BounceSoft      BounceKind = "soft"      // Temporary delivery failure.
+	BounceComplaint BounceKind = "complaint" // Recipient marked as spam.
+)
+
+// Suppresses returns true if future emails to an address with this kind of
+// bounce should not be sent.
+func (k BounceKind) Suppresses() bool {
+	return k == BounceHard || k == BounceComplaint
+}
+
+// Bounce is a bounce or complaint reported by an email provider.
+type Bounce struct {
+	Email  string
+	Kind   BounceKind
+	Reason string
+}
+
+// BounceAdapter converts the body of a provider webhook into bounces.
+// Notifications that are not bounces or complaints are ignored.
+type BounceAdapter func(body []byte) ([]Bounce, error)
+
+// BounceAdapters maps a provider name, used in the webhook path, to the
+// adapter for the payload sent by that provider.
+var BounceAdapters = map[string]BounceAdapter{
+	"generic":  GenericBounceAdapter,
+	"sendgrid": SendGridBounceAdapter,
+	"ses":      SESBounceAdapter,
+}
+
+var (
+	ErrBouncePayload = errors.New("invalid bounce payload")
+	ErrBounceKind    = errors.New("invalid bounce kind")
+)
+
+// GenericBounceAdapter accepts a JSON object, or an array of objects, with
+// the fields "email", "kind", and "reason", where kind is one of "hard",
+// "soft", or "complaint".
+func GenericBounceAdapter(body []byte) ([]Bounce, error) {
+	type payload struct {
+		Email  string     `json:"email"`
+		Kind   BounceKind `json:"kind"`
+		Reason string     `json:"reason"`
+	}
+
+	var list []payload
+	if err := json.Unmarshal(body, &list); err != nil {
+		var one payload
+		if err := json.Unmarshal(body, &one); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBouncePayload, err)
+		}
+		list = []payload{one}
+	}
+
+	bounces := make([]Bounce, 0, len(list))
+	for _, p := range list {
+		switch p.Kind {
+		case BounceHard, BounceSoft, BounceComplaint:
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrBounceKind, p.Kind)
+		}
+		bounces = append(bounces, Bounce{Email: p.Email, Kind: p.Kind, Reason: p.Reason})
+	}
+
+	return bounces, nil
+}
+
+// SendGridBounceAdapter accepts the SendGrid Event Webhook payload.
+// See https://docs.sendgrid.com/for-developers/tracking-events/event.
+func SendGridBounceAdapter(body []byte) ([]Bounce, error) {
+	var events []struct {
+		Email  string `json:"email"`
+		Event  string `json:"event"`
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBouncePayload, err)
+	}
+
+	var bounces []Bounce
+	for _, e := range events {
+		var kind BounceKind
+
+		switch {
+		case e.Event == "bounce" && e.Type == "blocked":
+			kind = BounceSoft
+		case e.Event == "bounce":
+			kind = BounceHard
+		case e.Event == "spamreport":
+			kind = BounceComplaint
+		default:
+			continue
+		}
+
+		bounces = append(bounces, Bounce{Email: e.Email, Kind: kind, Reason: e.Reason})
+	}
+
+	return bounces, nil
+}
+
+// SESBounceAdapter accepts an Amazon SES notification delivered by SNS.
+// Subscription confirmations are ignored and must be confirmed manually.
+// See https://docs.aws.amazon.com/ses/latest/dg/notification-contents.html.
+func SESBounceAdapter(body []byte) ([]Bounce, error) {
+	var envelope struct {
+		Type    string
+		Message string
+	}
+
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBouncePayload, err)
+	}
+
+	if envelope.Type != "Notification" {
+		return nil, nil
+	}
+
+	type recipient struct {
+		EmailAddress   string `json:"emailAddress"`
+		DiagnosticCode string `json:"diagnosticCode"`
+	}
+
+	var msg struct {
+		NotificationType string `json:"notificationType"`
+		Bounce           struct {
+			BounceType        string      `json:"bounceType"`
+			BouncedRecipients []recipient `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Complaint struct {
+			ComplaintFeedbackType string      `json:"complaintFeedbackType"`
+			ComplainedRecipients  []recipient `json:"complainedRecipients"`
+		} `json:"complaint"`
+	}
+
+	if err := json.Unmarshal([]byte(envelope.Message), &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBouncePayload, err)
+	}
+
+	var bounces []Bounce
+	switch msg.NotificationType {
+	case "Bounce":
+		kind := BounceSoft
+		if msg.Bounce.BounceType == "Permanent" {
+			kind = BounceHard
+		}
+		for _, r := range msg.Bounce.BouncedRecipients {
+			bounces = append(bounces, Bounce{Email: r.EmailAddress, Kind: kind, Reason: r.DiagnosticCode})
+		}
+	case "Complaint":
+		for _, r := range msg.Complaint.ComplainedRecipients {
+			bounces = append(bounces, Bounce{Email: r.EmailAddress, Kind: BounceComplaint, Reason: msg.Complaint.ComplaintFeedbackType})
+		}
+	}
+
+	return bounces, nil
+}
+
+// normalizeEmail returns email in the form used to record bounces.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// RecordBounce saves a bounce or complaint for an email address.
+func (db *AuthDB) RecordBounce(b Bounce) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	reason := b.Reason
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+
+	_, err := db.Exec("INSERT INTO email_bounces(email, kind, reason) VALUES (?, ?, ?)", normalizeEmail(b.Email), b.Kind, reason)
+	return err
+}
+
+// EmailSuppressed returns true if email has a hard bounce or complaint.
+func (db *AuthDB) EmailSuppressed(email string) (bool, error) {
+	if db == nil {
+		return false, ErrInvalidDB
+	}
+
+	var count int
+	qry := `SELECT COUNT(*) FROM email_bounces WHERE email = ? AND kind IN (?, ?)`
+	err := db.QueryRow(qry, normalizeEmail(email), BounceHard, BounceComplaint).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// BounceKinds returns the most severe bounce kind recorded for each email
+// address, keyed by the normalized email.
+func (db *AuthDB) BounceKinds() (map[string]BounceKind, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	rows, err := db.Query(`SELECT email, kind FROM email_bounces ORDER BY created`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kinds := make(map[string]BounceKind)
+	for rows.Next() {
+		var email string
+		var kind BounceKind
+
+		if err := rows.Scan(&email, &kind); err != nil {
+			return nil, err
+		}
+
+		// Keep a suppressing kind over a later soft bounce.
+		if kinds[email].Suppresses() && !kind.Suppresses() {
+			continue
+		}
+		kinds[email] = kind
+	}
+
+	return kinds, rows.Err()
+}
+
+// sendEmail sends an email to the address to, unless the address is
+// suppressed by a hard bounce or complaint, in which case it returns
+// ErrEmailSuppressed. The email is not sent if ctx is done.
+func (app *AuthApp) sendEmail(ctx context.Context, to, subject, body string, headers map[string]string) error {
+	suppressed, err := app.DB.EmailSuppressed(to)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		slog.Warn("suppressed email to bounced address", slog.Group("email",
+			slog.String("to", to), slog.String("subject", subject)))
+		return ErrEmailSuppressed
+	}
+
+	err = app.Cfg.SMTP.SendMessageWithHeadersContext(ctx, app.Cfg.EmailFrom, []string{to}, subject, body, headers)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("sent email", slog.Group("email",
+		slog.String("to", to), slog.String("subject", subject)))
+
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// MaxBounceBodySize is the largest webhook body accepted, in bytes.
+const MaxBounceBodySize = 1 << 20
+
+// BounceSecretHeader is the header that can hold the bounce webhook secret
+// instead of the "token" query parameter.
+const BounceSecretHeader = "X-Webhook-Secret"
+
+// validBounceSecret returns true if the request contains the configured
+// bounce webhook secret.
+func (app *AuthApp) validBounceSecret(r *http.Request) bool {
+	secret := r.Header.Get(BounceSecretHeader)
+	if secret == "" {
+		secret = r.URL.Query().Get("token")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(app.Cfg.Auth.BounceSecret)) == 1
+}
+
+// BounceWebhookHandler records bounces and complaints posted by an email
+// provider. The provider is taken from the "provider" path value and
+// selects the adapter from BounceAdapters.
+//
+// The webhook is disabled unless Auth.BounceSecret is configured.
+func (app *AuthApp) BounceWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.IsMethodOrError(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	if app.Cfg.Auth.BounceSecret == "" {
+		logger.Warn("bounce webhook disabled")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	if !app.validBounceSecret(r) {
+		logger.Warn("invalid bounce webhook secret")
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	provider := r.PathValue("provider")
+	logger = logger.With("provider", provider)
+
+	adapter, ok := BounceAdapters[provider]
+	if !ok {
+		logger.Warn("unknown bounce provider")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBounceBodySize))
+	if err != nil {
+		logger.Error("failed to read body", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	bounces, err := adapter(body)
+	if err != nil {
+		logger.Error("failed to parse bounces", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	for _, b := range bounces {
+		err := app.DB.RecordBounce(b)
+		if err != nil {
+			logger.Error("failed to record bounce", "err", err, "bounce", b)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		username, err := app.DB.UsernameForEmail(b.Email)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			logger.Error("failed to get username for email", "err", err)
+		}
+
+		app.DB.RecordEvent(NewEvent(TypeBounce, username, EventDetails{"kind": string(b.Kind), "reason": b.Reason}))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	logger.Info("done", "bounces", len(bounces))
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBounceAdapters(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter webauth.BounceAdapter
+		body    string
+		want    []webauth.Bounce
+		wantErr error
+	}{
+		{
+			name:    "genericObject",
+			adapter: webauth.GenericBounceAdapter,
+			body:    `{"email":"a@email","kind":"hard","reason":"no such user"}`,
+			want: []webauth.Bounce{
+				{Email: "a@email", Kind: webauth.BounceHard, Reason: "no such user"},
+			},
+		},
+		{
+			name:    "genericArray",
+			adapter: webauth.GenericBounceAdapter,
+			body:    `[{"email":"a@email","kind":"soft"},{"email":"b@email","kind":"complaint"}]`,
+			want: []webauth.Bounce{
+				{Email: "a@email", Kind: webauth.BounceSoft},
+				{Email: "b@email", Kind: webauth.BounceComplaint},
+			},
+		},
+		{
+			name:    "genericInvalidKind",
+			adapter: webauth.GenericBounceAdapter,
+			body:    `{"email":"a@email","kind":"other"}`,
+			wantErr: webauth.ErrBounceKind,
+		},
+		{
+			name:    "genericInvalidJSON",
+			adapter: webauth.GenericBounceAdapter,
+			body:    `not json`,
+			wantErr: webauth.ErrBouncePayload,
+		},
+		{
+			name:    "sendgrid",
+			adapter: webauth.SendGridBounceAdapter,
+			body: `[
+				{"email":"a@email","event":"bounce","type":"bounce","reason":"550"},
+				{"email":"b@email","event":"bounce","type":"blocked"},
+				{"email":"c@email","event":"spamreport"},
+				{"email":"d@email","event":"delivered"}
+			]`,
+			want: []webauth.Bounce{
+				{Email: "a@email", Kind: webauth.BounceHard, Reason: "550"},
+				{Email: "b@email", Kind: webauth.BounceSoft},
+				{Email: "c@email", Kind: webauth.BounceComplaint},
+			},
+		},
+		{
+			name:    "sesBounce",
+			adapter: webauth.SESBounceAdapter,
+			body:    `{"Type":"Notification","Message":"{\"notificationType\":\"Bounce\",\"bounce\":{\"bounceType\":\"Permanent\",\"bouncedRecipients\":[{\"emailAddress\":\"a@email\",\"diagnosticCode\":\"550\"}]}}"}`,
+			want: []webauth.Bounce{
+				{Email: "a@email", Kind: webauth.BounceHard, Reason: "550"},
+			},
+		},
+		{
+			name:    "sesComplaint",
+			adapter: webauth.SESBounceAdapter,
+			body:    `{"Type":"Notification","Message":"{\"notificationType\":\"Complaint\",\"complaint\":{\"complaintFeedbackType\":\"abuse\",\"complainedRecipients\":[{\"emailAddress\":\"a@email\"}]}}"}`,
+			want: []webauth.Bounce{
+				{Email: "a@email", Kind: webauth.BounceComplaint, Reason: "abuse"},
+			},
+		},
+		{
+			name:    "sesSubscription",
+			adapter: webauth.SESBounceAdapter,
+			body:    `{"Type":"SubscriptionConfirmation","Message":"confirm"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.adapter([]byte(tc.body))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got err %v, want %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("bounces mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBounceKindSuppresses(t *testing.T) {
+	tests := map[webauth.BounceKind]bool{
+		webauth.BounceHard:      true,
+		webauth.BounceComplaint: true,
+		webauth.BounceSoft:      false,
+		"":                      false,
+	}
+
+	for kind, want := range tests {
+		if got := kind.Suppresses(); got != want {
+			t.Errorf("BounceKind(%q).Suppresses() = %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestBounceWebhookHandlerRejects(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/bounce/{provider}", app.BounceWebhookHandler)
+
+	disabled := []webhandler.TestCase{
+		{
+			Name:          "disabled",
+			Target:        "/webhook/bounce/generic",
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusNotFound,
+			WantBody:      "Error: Not Found\n",
+		},
+	}
+	webhandler.TestHandler(t, mux.ServeHTTP, disabled)
+
+	app.Cfg.Auth.BounceSecret = "secret"
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/webhook/bounce/generic?token=secret",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "Error: Method Not Allowed\n",
+		},
+		{
+			Name:          "missingSecret",
+			Target:        "/webhook/bounce/generic",
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusUnauthorized,
+			WantBody:      "Error: Unauthorized\n",
+		},
+		{
+			Name:           "wrongSecretHeader",
+			Target:         "/webhook/bounce/generic",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: http.Header{webauth.BounceSecretHeader: {"wrong"}},
+			WantStatus:     http.StatusUnauthorized,
+			WantBody:       "Error: Unauthorized\n",
+		},
+		{
+			Name:          "unknownProvider",
+			Target:        "/webhook/bounce/unknown?token=secret",
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusNotFound,
+			WantBody:      "Error: Not Found\n",
+		},
+		{
+			Name:           "invalidPayload",
+			Target:         "/webhook/bounce/generic",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: http.Header{webauth.BounceSecretHeader: {"secret"}},
+			RequestBody:    "not json",
+			WantStatus:     http.StatusBadRequest,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:          "noBounces",
+			Target:        "/webhook/bounce/sendgrid?token=secret",
+			RequestMethod: http.MethodPost,
+			RequestBody:   `[{"email":"a@email","event":"delivered"}]`,
+			WantStatus:    http.StatusNoContent,
+		},
+	}
+
+	webhandler.TestHandler(t, mux.ServeHTTP, tests)
+}
+
+func TestBounceWebhookHandlerSuppresses(t *testing.T) {
+	app := AppForTest(t)
+
+	app.Cfg.Auth.BounceSecret = "secret"
+	defer func() { app.Cfg.Auth.BounceSecret = "" }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/bounce/{provider}", app.BounceWebhookHandler)
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "hardBounce",
+			Target:        "/webhook/bounce/generic?token=secret",
+			RequestMethod: http.MethodPost,
+			RequestBody:   `{"email":"Bounced@Email","kind":"hard","reason":"550"}`,
+			WantStatus:    http.StatusNoContent,
+		},
+	}
+
+	webhandler.TestHandler(t, mux.ServeHTTP, tests)
+
+	suppressed, err := app.DB.EmailSuppressed("bounced@email")
+	if err != nil {
+		t.Fatalf("EmailSuppressed() failed: %v", err)
+	}
+	if !suppressed {
+		t.Errorf("EmailSuppressed() = false after hard bounce")
+	}
+}
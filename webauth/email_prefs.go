@@ -0,0 +1,182 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+)
+
+// EmailCategory identifies the kind of email sent to a user.
+type EmailCategory string
+
+const (
+	EmailSecurity EmailCategory = "security" // Account and security alerts.
+	EmailReminder EmailCategory = "reminder" // Reminders, such as to confirm.
+	EmailDigest   EmailCategory = "digest"   // Periodic summaries.
+)
+
+// OptionalEmailCategories are the categories a user can unsubscribe from.
+// Security emails cannot be disabled.
+var OptionalEmailCategories = []EmailCategory{EmailReminder, EmailDigest}
+
+// Optional returns true if a user can unsubscribe from the category.
+func (c EmailCategory) Optional() bool {
+	return slices.Contains(OptionalEmailCategories, c)
+}
+
+// EmailPrefs indicates if a user receives emails for each category.
+type EmailPrefs map[EmailCategory]bool
+
+var (
+	ErrEmailCategoryRequired = errors.New("email category cannot be disabled")
+	ErrEmailSuppressed       = errors.New("email suppressed")
+)
+
+// EmailPrefs returns the email preferences for username. Categories without
+// a saved preference are enabled.
+func (db *AuthDB) EmailPrefs(username string) (EmailPrefs, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	prefs := EmailPrefs{EmailSecurity: true}
+	for _, c := range OptionalEmailCategories {
+		prefs[c] = true
+	}
+
+	qry := `SELECT category, enabled FROM email_prefs JOIN users ON email_prefs.user_id = users.id WHERE users.username = ?`
+	rows, err := db.Query(qry, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category EmailCategory
+		var enabled bool
+
+		if err := rows.Scan(&category, &enabled); err != nil {
+			return nil, err
+		}
+
+		if category.Optional() {
+			prefs[category] = enabled
+		}
+	}
+
+	return prefs, rows.Err()
+}
+
+// SetEmailPref saves the email preference for username and category.
+// If username does not exist, ErrUserNotFound is returned.
+func (db *AuthDB) SetEmailPref(username string, category EmailCategory, enabled bool) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	if !category.Optional() {
+		return fmt.Errorf("%w: %q", ErrEmailCategoryRequired, category)
+	}
+
+	return db.WithTx(func(tx *Tx) error {
+		_, err := tx.Exec("DELETE FROM email_prefs WHERE user_id = (SELECT id FROM users WHERE username = ?) AND category = ?", username, category)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("INSERT INTO email_prefs(user_id, category, enabled) SELECT id, ?, ? FROM users WHERE username = ?", category, enabled, username)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != 1 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
+
+// EmailAllowed returns true if username receives emails in category.
+func (app *AuthApp) EmailAllowed(username string, category EmailCategory) (bool, error) {
+	if !category.Optional() {
+		return true, nil
+	}
+
+	prefs, err := app.DB.EmailPrefs(username)
+	if err != nil {
+		return false, err
+	}
+
+	return prefs[category], nil
+}
+
+// UnsubscribeURL returns a signed URL that unsubscribes username from
+// emails in category without requiring a login.
+func (app *AuthApp) UnsubscribeURL(username string, category EmailCategory) string {
+	v := url.Values{
+		"u": {username},
+		"c": {string(category)},
+		"s": {app.Sign("unsubscribe", username, string(category))},
+	}
+
+	return app.Cfg.Auth.BaseURL + UnsubscribePath + "?" + v.Encode()
+}
+
+// validUnsubscribe returns true if sig is a valid signature to unsubscribe
+// username from category.
+func (app *AuthApp) validUnsubscribe(username string, category EmailCategory, sig string) bool {
+	return app.ValidSignature(sig, "unsubscribe", username, string(category))
+}
+
+// Template for the footer added to optional emails.
+const unsubscribeFooterTmpl = `
+--
+To stop receiving these emails, visit {{.}}
+`
+
+// SendUserEmail sends an email in category to user. Emails in an optional
+// category are suppressed, returning ErrEmailSuppressed, if the user has
+// unsubscribed. Otherwise, they include a one-click unsubscribe link.
+// Emails to an address with a hard bounce or complaint are also suppressed.
+func (app *AuthApp) SendUserEmail(ctx context.Context, category EmailCategory, user User, subject, body string) error {
+	var headers map[string]string
+
+	if category.Optional() {
+		allowed, err := app.EmailAllowed(user.Username, category)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			slog.Info("suppressed email",
+				slog.String("username", user.Username),
+				slog.String("category", string(category)))
+			return ErrEmailSuppressed
+		}
+
+		unsubscribeURL := app.UnsubscribeURL(user.Username, category)
+		footer, err := app.emailBody(ctx, "unsubscribe", unsubscribeFooterTmpl, unsubscribeURL)
+		if err != nil {
+			return err
+		}
+		body += footer
+
+		// See RFC 2369 and RFC 8058.
+		headers = map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+
+	return app.sendEmail(ctx, user.Email, subject, body, headers)
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	EmailPrefsTmpl  = "email_prefs.html"
+	UnsubscribeTmpl = "unsubscribe.html"
+)
+
+// UnsubscribePath is the path of the signed links to unsubscribe.
+const UnsubscribePath = "/unsubscribe"
+
+const (
+	MsgEmailPrefsSaved    = "Your email preferences were saved."
+	MsgUnsubscribed       = "You have been unsubscribed."
+	MsgInvalidUnsubscribe = "This unsubscribe link is invalid."
+)
+
+// EmailPrefsPageData contains data to render the email preferences template.
+type EmailPrefsPageData struct {
+	CommonData
+	User       User
+	Prefs      EmailPrefs
+	Categories []EmailCategory // Categories the user can change.
+	Message    string
+}
+
+// EmailPrefsHandler handles requests to view or change the email
+// preferences of the logged in user.
+func (app *AuthApp) EmailPrefsHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.emailPrefsGet, Post: app.emailPrefsPost}.ServeHTTP(w, r)
+}
+
+// emailPrefsGet serves the email preferences of the logged in user.
+func (app *AuthApp) emailPrefsGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.renderEmailPrefs(w, r, logger, EmailPrefsPageData{User: user})
+}
+
+// emailPrefsPost saves the email preferences of the logged in user.
+func (app *AuthApp) emailPrefsPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := EmailPrefsPageData{User: user}
+	if user.Username == "" {
+		app.renderEmailPrefs(w, r, logger, data)
+		return
+	}
+
+	for _, c := range OptionalEmailCategories {
+		enabled := r.PostFormValue(string(c)) == "on"
+		err := app.DB.SetEmailPref(user.Username, c, enabled)
+		if err != nil {
+			logger.Error("failed to set email pref",
+				"err", err, "category", c)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeEmailPrefSaved, user.Username, nil))
+	data.Message = MsgEmailPrefsSaved
+
+	app.renderEmailPrefs(w, r, logger, data)
+}
+
+// renderEmailPrefs renders the email preferences page of data with the
+// preferences of the user, if logged in.
+func (app *AuthApp) renderEmailPrefs(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data EmailPrefsPageData) {
+	data.Categories = OptionalEmailCategories
+
+	if data.User.Username != "" {
+		var err error
+		data.Prefs, err = app.DB.EmailPrefs(data.User.Username)
+		if err != nil {
+			logger.Error("failed to get email prefs", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	app.RenderPage(w, r, logger, EmailPrefsTmpl, &data)
+
+	logger.Info("done")
+}
+
+// UnsubscribePageData contains data to render the unsubscribe template.
+type UnsubscribePageData struct {
+	CommonData
+	Username  string
+	Category  EmailCategory
+	Signature string
+	Done      bool // Done is true if the user was unsubscribed.
+	Message   string
+}
+
+// UnsubscribeHandler handles signed unsubscribe links.
+//
+// A GET request asks the user to confirm, which avoids link scanners
+// unsubscribing the user. A POST request, including a one-click request
+// from an email client per RFC 8058, unsubscribes the user.
+func (app *AuthApp) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.unsubscribeGet, Post: app.unsubscribePost}.ServeHTTP(w, r)
+}
+
+// unsubscribeGet asks the user to confirm the unsubscribe link.
+func (app *AuthApp) unsubscribeGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.unsubscribeData(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("username", data.Username, "category", data.Category)
+
+	app.RenderPage(w, r, logger, UnsubscribeTmpl, &data)
+
+	logger.Info("done")
+}
+
+// unsubscribePost unsubscribes the user of the unsubscribe link.
+func (app *AuthApp) unsubscribePost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.unsubscribeData(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("username", data.Username, "category", data.Category)
+
+	err := app.DB.SetEmailPref(data.Username, data.Category, false)
+	if err != nil {
+		logger.Error("failed to unsubscribe", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeEmailPrefUnsubscribed, data.Username, EventDetails{"category": string(data.Category)}))
+	data.Done = true
+	data.Message = MsgUnsubscribed
+
+	app.RenderPage(w, r, logger, UnsubscribeTmpl, &data)
+
+	logger.Info("done")
+}
+
+// unsubscribeData returns the data of the unsubscribe link of r. If the
+// link is not valid, the page is rendered with an error and false is
+// returned.
+func (app *AuthApp) unsubscribeData(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (UnsubscribePageData, bool) {
+	// FormValue accepts the values from the query or the form.
+	data := UnsubscribePageData{
+		Username:  r.FormValue("u"),
+		Category:  EmailCategory(r.FormValue("c")),
+		Signature: r.FormValue("s"),
+	}
+
+	if !data.Category.Optional() || !app.validUnsubscribe(data.Username, data.Category, data.Signature) {
+		logger.Warn("invalid unsubscribe", "username", data.Username, "category", data.Category)
+		app.RenderPage(w, r, logger, UnsubscribeTmpl,
+			&UnsubscribePageData{Message: MsgInvalidUnsubscribe})
+		return UnsubscribePageData{}, false
+	}
+
+	return data, true
+}
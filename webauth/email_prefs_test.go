@@ -0,0 +1,184 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func unsubscribeBody(data webauth.UnsubscribePageData) string {
+	return renderForTest(webauth.UnsubscribeTmpl, data)
+}
+
+func TestEmailCategoryOptional(t *testing.T) {
+	tests := []struct {
+		category webauth.EmailCategory
+		want     bool
+	}{
+		{webauth.EmailSecurity, false},
+		{webauth.EmailReminder, true},
+		{webauth.EmailDigest, true},
+		{"unknown", false},
+	}
+
+	for _, tc := range tests {
+		if got := tc.category.Optional(); got != tc.want {
+			t.Errorf("EmailCategory(%q).Optional() = %v, want %v",
+				tc.category, got, tc.want)
+		}
+	}
+}
+
+func TestUnsubscribeURL(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	got := app.UnsubscribeURL("test", webauth.EmailDigest)
+
+	prefix := app.Cfg.Auth.BaseURL + "/unsubscribe?"
+	if !strings.HasPrefix(got, prefix) {
+		t.Fatalf("UnsubscribeURL() = %q, want prefix %q", got, prefix)
+	}
+
+	values, err := url.ParseQuery(strings.TrimPrefix(got, prefix))
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+
+	if values.Get("u") != "test" || values.Get("c") != string(webauth.EmailDigest) {
+		t.Errorf("UnsubscribeURL() values = %v", values)
+	}
+
+	sig := values.Get("s")
+	if !app.ValidSignature(sig, "unsubscribe", "test", string(webauth.EmailDigest)) {
+		t.Errorf("signature %q is not valid", sig)
+	}
+	if app.ValidSignature(sig, "unsubscribe", "admin", string(webauth.EmailDigest)) {
+		t.Errorf("signature %q is valid for a different user", sig)
+	}
+}
+
+func TestUnsubscribeHandlerGet(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	sig := app.Sign("unsubscribe", "test", string(webauth.EmailDigest))
+	valid := url.Values{"u": {"test"}, "c": {"digest"}, "s": {sig}}
+	security := url.Values{
+		"u": {"test"}, "c": {"security"},
+		"s": {app.Sign("unsubscribe", "test", "security")},
+	}
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/unsubscribe",
+			RequestMethod: http.MethodPut,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "PUT Method Not Allowed\n",
+		},
+		{
+			Name:          "valid",
+			Target:        "/unsubscribe?" + valid.Encode(),
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusOK,
+			WantBody: unsubscribeBody(webauth.UnsubscribePageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Username:   "test",
+				Category:   webauth.EmailDigest,
+				Signature:  sig,
+			}),
+		},
+		{
+			Name:          "invalidSignature",
+			Target:        "/unsubscribe?u=admin&c=digest&s=" + sig,
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusOK,
+			WantBody: unsubscribeBody(webauth.UnsubscribePageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Message:    webauth.MsgInvalidUnsubscribe,
+			}),
+		},
+		{
+			Name:          "securityCategory",
+			Target:        "/unsubscribe?" + security.Encode(),
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusOK,
+			WantBody: unsubscribeBody(webauth.UnsubscribePageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Message:    webauth.MsgInvalidUnsubscribe,
+			}),
+		},
+	}
+
+	webhandler.TestHandler(t, app.UnsubscribeHandler, tests)
+}
+
+func TestUnsubscribeHandlerPost(t *testing.T) {
+	app := AppForTest(t)
+
+	sig := app.Sign("unsubscribe", "test", string(webauth.EmailReminder))
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	query := url.Values{"u": {"test"}, "c": {"reminder"}, "s": {sig}}
+
+	tests := []webhandler.TestCase{
+		{
+			Name:           "oneClick",
+			Target:         "/unsubscribe?" + query.Encode(),
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestBody:    "List-Unsubscribe=One-Click",
+			WantStatus:     http.StatusOK,
+			WantBody: unsubscribeBody(webauth.UnsubscribePageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Username:   "test",
+				Category:   webauth.EmailReminder,
+				Signature:  sig,
+				Done:       true,
+				Message:    webauth.MsgUnsubscribed,
+			}),
+		},
+	}
+
+	webhandler.TestHandler(t, app.UnsubscribeHandler, tests)
+
+	allowed, err := app.EmailAllowed("test", webauth.EmailReminder)
+	if err != nil {
+		t.Fatalf("EmailAllowed() failed: %v", err)
+	}
+	if allowed {
+		t.Errorf("EmailAllowed() = true after unsubscribe")
+	}
+}
+
+func TestSetEmailPref(t *testing.T) {
+	app := AppForTest(t)
+
+	err := app.DB.SetEmailPref("test", webauth.EmailSecurity, false)
+	if !errors.Is(err, webauth.ErrEmailCategoryRequired) {
+		t.Errorf("SetEmailPref(security) = %v, want %v",
+			err, webauth.ErrEmailCategoryRequired)
+	}
+
+	for _, enabled := range []bool{false, true} {
+		err = app.DB.SetEmailPref("test", webauth.EmailDigest, enabled)
+		if err != nil {
+			t.Fatalf("SetEmailPref(digest, %v) failed: %v", enabled, err)
+		}
+
+		prefs, err := app.DB.EmailPrefs("test")
+		if err != nil {
+			t.Fatalf("EmailPrefs() failed: %v", err)
+		}
+		if prefs[webauth.EmailDigest] != enabled || !prefs[webauth.EmailSecurity] {
+			t.Errorf("EmailPrefs() = %v after SetEmailPref(digest, %v)",
+				prefs, enabled)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// Login, forgot, and register must not reveal whether a username or email
+// is registered, by their response or by how long they take to respond.
+// Login fails with the same message for any reason and checks a dummy hash
+// for unknown users, so they cost as much as a wrong password. Forgot
+// always shows the same page and sends an email either way. Register does
+// the same if Config.Auth.ConcealAccounts is set, emailing the existing
+// account rather than the address that was registered.
+
+// dummyPassword is a hash of a random password, created by the Hasher of
+// the app when first needed.
+type dummyPassword struct {
+	once sync.Once
+	hash string
+}
+
+// dummyPasswordHash returns a hash with the same algorithm and cost as
+// new passwords, which no password matches.
+func (app *AuthApp) dummyPasswordHash() string {
+	app.dummy.once.Do(func() {
+		password, err := GenerateRandomString(32)
+		if err == nil {
+			app.dummy.hash, err = app.Hasher.Hash(password)
+		}
+		if err != nil {
+			slog.Error("failed to create dummy password hash", "err", err)
+		}
+	})
+
+	return app.dummy.hash
+}
+
+// checkPassword checks the password of username like CheckPassword, but
+// if the user is not found, it checks a dummy hash, so unknown users take
+// as long as a wrong password.
+func (app *AuthApp) checkPassword(username, password string) error {
+	err := app.DB.CheckPassword(username, password)
+	if errors.Is(err, ErrUserNotFound) {
+		_ = comparePasswordsWith(app.Hasher, app.dummyPasswordHash(), password)
+	}
+
+	return err
+}
+
+// registerExisting responds to a registration of a username or email that
+// already exists as if it succeeded. It hashes the password, as for a new
+// user, and emails the existing account why no account was created. The
+// address of the registration is not emailed, since it may not belong to
+// whoever registered it.
+func (app *AuthApp) registerExisting(w http.ResponseWriter, r *http.Request, logger *slog.Logger, username, email, password string, emailExists bool) {
+	_, err := app.Hasher.Hash(password)
+	if err != nil {
+		logger.Error("failed to hash password", "err", err)
+	}
+
+	// The existing account is the one with the email or, if the email is
+	// not registered, the username.
+	existing := username
+	if emailExists {
+		existing, err = app.DB.UsernameForEmail(email)
+	}
+	var user User
+	if err == nil {
+		user, err = app.DB.UserForName(existing)
+	}
+	if err == nil {
+		err = app.sendRegisterExistingEmail(r.Context(), user, emailExists)
+	}
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
+		logger.Error("unable to send register existing email", "err", err)
+	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// Templates for the emails sent instead of registering an account.
+const (
+	emailRegisterEmailExistsTmpl = `
+An account for {{.Title}} is already registered with the email address {{.Email}}, so no new account was created.
+
+If you forgot your username or password, please visit {{.BaseURL}}/forgot.
+
+You can ignore this message if you did not try to register for an account.
+`
+	emailRegisterUsernameExistsTmpl = `
+Someone tried to register for {{.Title}} with your username {{.Username}}, so no account was created and your account is unchanged.
+
+If you forgot your password, please visit {{.BaseURL}}/forgot.
+
+You can ignore this message if you did not try to register for an account.
+`
+)
+
+// sendRegisterExistingEmail emails user that a registration was not
+// created because their email or, if not emailExists, their username is
+// already registered.
+func (app *AuthApp) sendRegisterExistingEmail(ctx context.Context, user User, emailExists bool) error {
+	name, tmpl := "register_username_exists", emailRegisterUsernameExistsTmpl
+	if emailExists {
+		name, tmpl = "register_email_exists", emailRegisterEmailExistsTmpl
+	}
+
+	data := emailData{
+		Email:    user.Email,
+		Title:    app.Cfg.App.Name,
+		BaseURL:  app.Cfg.Auth.BaseURL,
+		Username: user.Username,
+	}
+	body, err := app.emailBody(ctx, name, tmpl, data)
+	if err != nil {
+		return err
+	}
+
+	subj := app.Printer(ctx).T("%s registration", app.Cfg.App.Name)
+
+	return app.sendEmail(ctx, user.Email, subj, body, nil)
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// countingHasher is a PasswordHasher that counts the passwords it hashes
+// and compares, so tests can check that unknown accounts do the same work
+// as existing ones.
+type countingHasher struct {
+	webauth.BcryptHasher
+	hashes, compares atomic.Int64
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashes.Add(1)
+	return h.BcryptHasher.Hash(password)
+}
+
+func (h *countingHasher) Compare(hashedPassword, password string) error {
+	h.compares.Add(1)
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		return fmt.Errorf("%w: %v", webauth.ErrInvalidPassword, err)
+	}
+	return nil
+}
+
+// work returns the number of passwords hashed and compared by h while
+// serving a POST of body to target with handler.
+func (h *countingHasher) work(handler http.HandlerFunc, target string, body url.Values) (int64, int64, *http.Response) {
+	hashes, compares := h.hashes.Load(), h.compares.Load()
+	w := requestAs(handler, "", http.MethodPost, target, body.Encode())
+
+	return h.hashes.Load() - hashes, h.compares.Load() - compares, w.Result()
+}
+
+func TestEnumeration(t *testing.T) {
+	conceal := func(c *webauth.Config) { c.Auth.ConcealAccounts = true }
+	hasher := &countingHasher{BcryptHasher: webauth.BcryptHasher{Cost: 4}}
+	app := newAppForTest(t, []func(*webauth.Config){conceal},
+		webauth.WithDB(StoreForTest(t)), webauth.WithPasswordHasher(hasher))
+
+	// Create the dummy hash of unknown users before counting.
+	requestAs(app.LoginPostHandler, "", http.MethodPost, "/login", "username=unknown&password=wrong")
+
+	// Each case compares a request for an existing account with one for an
+	// unknown account.
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		target   string
+		existing url.Values
+		unknown  url.Values
+	}{
+		{
+			name: "login", handler: app.LoginPostHandler, target: "/login",
+			existing: url.Values{"username": {"test"}, "password": {"wrong"}},
+			unknown:  url.Values{"username": {"unknown"}, "password": {"wrong"}},
+		},
+		{
+			name: "forgotPassword", handler: app.ForgotHandler, target: "/forgot",
+			existing: url.Values{"email": {"test@email"}, "action": {"password"}},
+			unknown:  url.Values{"email": {"unknown@email"}, "action": {"password"}},
+		},
+		{
+			name: "forgotUser", handler: app.ForgotHandler, target: "/forgot",
+			existing: url.Values{"email": {"test@email"}, "action": {"user"}},
+			unknown:  url.Values{"email": {"unknown@email"}, "action": {"user"}},
+		},
+		{
+			name: "registerUsername", handler: app.RegisterHandler, target: "/register",
+			existing: registerValues("test", "other@email"),
+			unknown:  registerValues("newuser", "newuser@email"),
+		},
+		{
+			name: "registerEmail", handler: app.RegisterHandler, target: "/register",
+			existing: registerValues("other", "test@email"),
+			unknown:  registerValues("newemail", "newemail@email"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			existingHashes, existingCompares, existing := hasher.work(tc.handler, tc.target, tc.existing)
+			unknownHashes, unknownCompares, unknown := hasher.work(tc.handler, tc.target, tc.unknown)
+
+			if existing.StatusCode != unknown.StatusCode {
+				t.Errorf("status = %d for existing, %d for unknown", existing.StatusCode, unknown.StatusCode)
+			}
+			if existing.Header.Get("Location") != unknown.Header.Get("Location") {
+				t.Errorf("location = %q for existing, %q for unknown",
+					existing.Header.Get("Location"), unknown.Header.Get("Location"))
+			}
+
+			// Unknown accounts cost as much as existing ones, so they
+			// cannot be told apart by time.
+			if existingHashes != unknownHashes || existingCompares != unknownCompares {
+				t.Errorf("hashes, compares = %d, %d for existing, %d, %d for unknown",
+					existingHashes, existingCompares, unknownHashes, unknownCompares)
+			}
+		})
+	}
+
+	// A login of an unknown user checks the dummy hash.
+	if _, compares, _ := hasher.work(app.LoginPostHandler, "/login", url.Values{"username": {"nobody"}, "password": {"wrong"}}); compares != 1 {
+		t.Errorf("compares for unknown login = %d, want 1", compares)
+	}
+}
+
+// TestEnumerationBodies checks that the pages are the same for existing and
+// unknown accounts.
+func TestEnumerationBodies(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	tests := []struct {
+		name              string
+		handler           http.HandlerFunc
+		target            string
+		existing, unknown url.Values
+	}{
+		{"login", app.LoginPostHandler, "/login",
+			url.Values{"username": {"test"}, "password": {"wrong"}},
+			url.Values{"username": {"unknown"}, "password": {"wrong"}}},
+		{"forgot", app.ForgotHandler, "/forgot",
+			url.Values{"email": {"test@email"}, "action": {"password"}},
+			url.Values{"email": {"unknown@email"}, "action": {"password"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := requestAs(tc.handler, "", http.MethodPost, tc.target, tc.existing.Encode())
+			unknown := requestAs(tc.handler, "", http.MethodPost, tc.target, tc.unknown.Encode())
+
+			if existing.Code != unknown.Code || existing.Body.String() != unknown.Body.String() {
+				t.Errorf("got %d %q for existing, %d %q for unknown",
+					existing.Code, existing.Body, unknown.Code, unknown.Body)
+			}
+		})
+	}
+}
+
+// registerValues returns the form values to register username and email.
+func registerValues(username, email string) url.Values {
+	return url.Values{
+		"username":  {username},
+		"fullName":  {"Full Name"},
+		"email":     {email},
+		"password1": {"a long password"},
+		"password2": {"a long password"},
+	}
+}
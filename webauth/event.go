@@ -4,10 +4,15 @@
 package webauth
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
+
+	"github.com/bnixon67/webapp/webid"
 )
 
 // EventName represents possible event types within the system.
@@ -20,47 +25,108 @@ const (
 	EventSaveToken EventName = "save_token"
 	EventResetPass EventName = "reset_pass"
 	EventConfirmed EventName = "confirmed"
+	EventResend    EventName = "resend"
+	EventEmailPref EventName = "email_pref"
+	EventBounce    EventName = "bounce"
+	EventIncident  EventName = "incident"
+	EventAnnounce  EventName = "announce"
+	EventOAuth     EventName = "oauth"
+	EventPanic     EventName = "panic"
+	EventRename    EventName = "rename"
+	EventDisable   EventName = "disable"
+	EventDelete    EventName = "delete"
+	EventAPIToken  EventName = "api_token"
+	EventRefresh   EventName = "refresh"
+	EventProfile   EventName = "profile"
+	EventScreen    EventName = "screen"
+	EventWaitlist  EventName = "waitlist"
 	EventMaxName   EventName = "1234567890" // Event defined as varchar(10).
 )
 
+// MaxEventMessageLen is the maximum length of an event message, matching
+// the SQL schema.
+const MaxEventMessageLen = 255
+
 // Event represents a system event, such as a user login or registration.
 type Event struct {
-	Name      EventName // Name of the event.
-	Succeeded bool      // Indicates if the event was successful.
-	Username  string    // Username associated with the event.
-	Message   string    // Message or details about the event.
-	Created   time.Time // Timestamp of event, set by db when inserted.
+	ID        string       // ID of the event, assigned when recorded.
+	Name      EventName    // Name of the event.
+	Type      EventType    // Type of the event, if known.
+	Succeeded bool         // Indicates if the event was successful.
+	Username  string       // Username associated with the event.
+	Message   string       // Message or details about the event.
+	Details   EventDetails // Details of the event, by the schema of Type.
+	Created   time.Time    // Timestamp of event, set by db when inserted.
 }
 
 // LogValue implements slog.LogValuer. It returns a group containing
 // the fields of Event, so that they appear together in the log output.
 func (e Event) LogValue() slog.Value {
 	return slog.GroupValue(
+		slog.String("ID", e.ID),
 		slog.String("Name", string(e.Name)),
+		slog.String("Type", string(e.Type)),
 		slog.Bool("Succeeded", e.Succeeded),
 		slog.String("Username", e.Username),
 		slog.String("Message", e.Message),
+		slog.String("Details", e.Details.String()),
 		slog.Time("Created", e.Created),
 	)
 }
 
+// eventsForUser is a condition that matches the events of a user, given
+// their username twice. Events are linked to the user by id, so they are kept
+// if the user is renamed. Events without a user, such as a failed login for
+// an unknown username, are matched by username.
+const eventsForUser = `(user_id = (SELECT id FROM users WHERE username = ?) OR (user_id IS NULL AND username = ?))`
+
 var (
 	ErrWriteEventDBNil  = errors.New("WriteEvent: db is nil")
 	ErrWriteEventFailed = errors.New("WriteEvent: db write failed")
 )
 
-// WriteEvent saves an event to database.
+// eventColumns are the columns of events scanned by scanEvent.
+const eventColumns = `id, name, type, succeeded, username, message, details, created`
+
+// WriteEvent saves an event without a type to database. The event is
+// linked to the user with username, if any. Use RecordEvent with NewEvent
+// for an event with a type.
 func (db *AuthDB) WriteEvent(name EventName, succeeded bool, username, message string) error {
-	e := Event{Name: name, Succeeded: succeeded, Username: username, Message: message}
-	logger := slog.With("event", e, "func", "WriteEvent")
+	return db.RecordEvent(Event{Name: name, Succeeded: succeeded, Username: username, Message: message})
+}
+
+// RecordEvent saves e to database, if it matches the schema of its type.
+// The event is linked to the user with its username, if any, and is given
+// an ID if it does not have one.
+func (db *AuthDB) RecordEvent(e Event) error {
+	logger := slog.With("event", e, "func", "RecordEvent")
 
 	if db == nil {
 		logger.Error("nil db")
 		return ErrWriteEventDBNil
 	}
 
-	const qry = `INSERT INTO events(name, succeeded, username, message) VALUES(?, ?, ?, ?)`
-	result, err := db.Exec(qry, e.Name, e.Succeeded, e.Username, e.Message)
+	if err := e.Validate(); err != nil {
+		logger.Error("invalid event", "err", err)
+		return fmt.Errorf("%w: %v", ErrWriteEventFailed, err)
+	}
+
+	if e.ID == "" {
+		id, err := webid.NewString()
+		if err != nil {
+			logger.Error("failed to create id", "err", err)
+			return fmt.Errorf("%w: %v", ErrWriteEventFailed, err)
+		}
+		e.ID = id
+	}
+
+	var details sql.NullString
+	if len(e.Details) > 0 {
+		details = sql.NullString{String: e.Details.String(), Valid: true}
+	}
+
+	const qry = `INSERT INTO events(id, name, type, succeeded, username, user_id, message, details) VALUES(?, ?, ?, ?, ?, (SELECT id FROM users WHERE username = ?), ?, ?)`
+	result, err := db.Exec(qry, e.ID, e.Name, e.Type, e.Succeeded, e.Username, e.Username, e.Message, details)
 	if err != nil {
 		logger.Error("failed to write event", "err", err)
 		return fmt.Errorf("%w: %v", ErrWriteEventFailed, err)
@@ -82,6 +148,24 @@ func (db *AuthDB) WriteEvent(name EventName, succeeded bool, username, message s
 	return nil
 }
 
+// scanEvent scans a row of eventColumns into e.
+func scanEvent(row interface{ Scan(...any) error }, e *Event) error {
+	var id, details sql.NullString
+	err := row.Scan(&id, &e.Name, &e.Type, &e.Succeeded, &e.Username, &e.Message, &details, &e.Created)
+	if err != nil {
+		return err
+	}
+	e.ID = id.String
+
+	if details.Valid && details.String != "" {
+		if err := json.Unmarshal([]byte(details.String), &e.Details); err != nil {
+			return fmt.Errorf("invalid details: %w", err)
+		}
+	}
+
+	return nil
+}
+
 var (
 	ErrGetEventsDBNil = errors.New("GetEvents: db is nil")
 	ErrGetEventsQuery = errors.New("GetEvents: query failed")
@@ -98,7 +182,7 @@ func (db *AuthDB) GetEvents() ([]Event, error) {
 		return nil, ErrRowExistsDBNil
 	}
 
-	qry := `SELECT name, succeeded, username, message, created FROM events ORDER BY created DESC`
+	qry := `SELECT ` + eventColumns + ` FROM events ORDER BY created DESC`
 	rows, err := db.Query(qry)
 	if err != nil {
 		slog.Error("query for events failed", "err", err)
@@ -111,7 +195,7 @@ func (db *AuthDB) GetEvents() ([]Event, error) {
 	for rows.Next() {
 		var event Event
 
-		err := rows.Scan(&event.Name, &event.Succeeded, &event.Username, &event.Message, &event.Created)
+		err := scanEvent(rows, &event)
 		if err != nil {
 			slog.Error("failed rows.Scan", "err", err)
 			return nil, fmt.Errorf("%w: %v", ErrGetEventsScan, err)
@@ -128,3 +212,54 @@ func (db *AuthDB) GetEvents() ([]Event, error) {
 
 	return events, nil
 }
+
+// ListEvents returns the events selected by q, newest first by default,
+// and the number of events that match.
+func (db *AuthDB) ListEvents(q ListQuery) ([]Event, int, error) {
+	if db == nil {
+		return nil, 0, ErrInvalidDB
+	}
+
+	where, args, order := EventsTable.sqlClauses(q)
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM events"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events, err := db.scanEvents("SELECT "+eventColumns+" FROM events"+where+order, args...)
+
+	return events, total, err
+}
+
+// EventsNamed returns the most recent events with name, up to limit.
+func (db *AuthDB) EventsNamed(name EventName, limit int) ([]Event, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := "SELECT " + eventColumns + " FROM events WHERE name = ? ORDER BY created DESC LIMIT " + strconv.Itoa(limit)
+
+	return db.scanEvents(qry, name)
+}
+
+// scanEvents returns the events of the query qry with args.
+func (db *AuthDB) scanEvents(qry string, args ...any) ([]Event, error) {
+	rows, err := db.Query(qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
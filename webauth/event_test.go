@@ -15,7 +15,7 @@ func TestWriteEvent(t *testing.T) {
 
 	testCases := []struct {
 		name    string
-		db      *webauth.AuthDB
+		db      webauth.EventStore
 		event   webauth.Event
 		wantErr error
 	}{
@@ -41,7 +41,7 @@ func TestWriteEvent(t *testing.T) {
 		},
 		{
 			name:    "InvalidDB",
-			db:      nil,
+			db:      (*webauth.AuthDB)(nil),
 			event:   webauth.Event{},
 			wantErr: webauth.ErrWriteEventDBNil,
 		},
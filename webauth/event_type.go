@@ -0,0 +1,287 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// EventType classifies an event more precisely than its name, so that
+// events can be filtered and alerted on without parsing their message.
+// Events written by WriteEvent have no type.
+type EventType string
+
+const (
+	TypeLoginPassword          EventType = "login.password"
+	TypeLoginMagic             EventType = "login.magic"
+	TypeLoginOAuth             EventType = "login.oauth"
+	TypeLoginFailed            EventType = "login.failed"
+	TypeLoginMagicFailed       EventType = "login.magic_failed"
+	TypeLogout                 EventType = "logout"
+	TypeRegisterUser           EventType = "register.user"
+	TypeRegisterOAuth          EventType = "register.oauth"
+	TypeRegisterUsernameExists EventType = "register.username_exists"
+	TypeRegisterEmailExists    EventType = "register.email_exists"
+	TypeRegisterBreached       EventType = "register.breached"
+	TypeRegisterFailed         EventType = "register.failed"
+	TypeGeoRestricted          EventType = "geo"
+	TypeRiskRestricted         EventType = "risk"
+	TypeConfirmed              EventType = "confirmed"
+	TypeResendSent             EventType = "resend.sent"
+	TypeResendFailed           EventType = "resend.failed"
+	TypeResetPass              EventType = "reset_pass.succeeded"
+	TypeResetBreached          EventType = "reset_pass.breached"
+	TypeResetNonce             EventType = "reset_pass.nonce"
+	TypeResetUsed              EventType = "reset_pass.used"
+	TypeRenameSelf             EventType = "rename.self"
+	TypeRenameAdmin            EventType = "rename.admin"
+	TypeDisableAdmin           EventType = "disable.admin"
+	TypeDeleteAdmin            EventType = "delete.admin"
+	TypeDeleteScheduled        EventType = "delete.scheduled"
+	TypeDeleteCanceled         EventType = "delete.canceled"
+	TypeDeletePurged           EventType = "delete.purged"
+	TypeAPITokenCreated        EventType = "api_token.created"
+	TypeAPITokenRevoked        EventType = "api_token.revoked"
+	TypeRefreshReused          EventType = "refresh.reused"
+	TypeRefreshFailed          EventType = "refresh.failed"
+	TypeEmailPrefSaved         EventType = "email_pref.saved"
+	TypeEmailPrefUnsubscribed  EventType = "email_pref.unsubscribed"
+	TypeBounce                 EventType = "bounce"
+	TypeIncidentCreated        EventType = "incident.created"
+	TypeIncidentResolved       EventType = "incident.resolved"
+	TypeAnnounceScheduled      EventType = "announce.scheduled"
+	TypeAnnounceCanceled       EventType = "announce.canceled"
+	TypeOAuthFailed            EventType = "oauth.failed"
+	TypeOAuthEmailExists       EventType = "oauth.email_exists"
+	TypeOAuthLinked            EventType = "oauth.linked"
+	TypePanic                  EventType = "panic"
+	TypeProfileName            EventType = "profile.name"
+	TypeProfileEmailExists     EventType = "profile.email_exists"
+	TypeProfileEmailRequested  EventType = "profile.email_requested"
+	TypeProfileEmailChanged    EventType = "profile.email_changed"
+	TypeScreen                 EventType = "screen"
+	TypeWaitlistAdded          EventType = "waitlist.added"
+	TypeWaitlistApproved       EventType = "waitlist.approved"
+	TypeWaitlistReleased       EventType = "waitlist.released"
+	TypeMax                    EventType = "123456789012345678901234567890" // Type defined as varchar(30).
+)
+
+// EventDetails are the structured data of an event by key, such as the
+// email or provider, which are stored as JSON.
+type EventDetails map[string]string
+
+// String returns d as JSON, so that it is readable in exports.
+func (d EventDetails) String() string {
+	if len(d) == 0 {
+		return ""
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Sprintf("%v", map[string]string(d))
+	}
+
+	return string(b)
+}
+
+// EventSchema describes the events of an EventType.
+type EventSchema struct {
+	Names     []EventName // Names used with the type. The first is the default.
+	Succeeded bool        // Succeeded is the result of events of the type.
+	Message   string      // Message of the events, with {key} replaced by a detail.
+}
+
+// eventSchemas are the schemas by EventType.
+var eventSchemas = map[EventType]EventSchema{
+	TypeLoginPassword:          {Names: []EventName{EventLogin}, Succeeded: true, Message: "logged in user"},
+	TypeLoginMagic:             {Names: []EventName{EventLogin}, Succeeded: true, Message: "login with magic link"},
+	TypeLoginOAuth:             {Names: []EventName{EventLogin}, Succeeded: true, Message: "login with {provider}"},
+	TypeLoginFailed:            {Names: []EventName{EventLogin}, Message: "{error}"},
+	TypeLoginMagicFailed:       {Names: []EventName{EventLogin}, Message: "magic link: {error}"},
+	TypeLogout:                 {Names: []EventName{EventLogout}, Succeeded: true, Message: "logged out user"},
+	TypeRegisterUser:           {Names: []EventName{EventRegister}, Succeeded: true, Message: "registered user"},
+	TypeRegisterOAuth:          {Names: []EventName{EventRegister}, Succeeded: true, Message: "registered with {provider}"},
+	TypeRegisterUsernameExists: {Names: []EventName{EventRegister}, Message: "user name already exists"},
+	TypeRegisterEmailExists:    {Names: []EventName{EventRegister}, Message: "email already exists: {email}"},
+	TypeRegisterBreached:       {Names: []EventName{EventRegister}, Message: "breached password"},
+	TypeRegisterFailed:         {Names: []EventName{EventRegister}, Message: "{error}"},
+	TypeGeoRestricted:          {Names: []EventName{EventLogin, EventRegister}, Message: "{action} by rule {rule} from {addr}"},
+	TypeRiskRestricted:         {Names: []EventName{EventLogin, EventRegister}, Message: "{decision} by risk score {score}: {reasons}"},
+	TypeConfirmed:              {Names: []EventName{EventConfirmed}, Succeeded: true, Message: "success"},
+	TypeResendSent:             {Names: []EventName{EventResend}, Succeeded: true, Message: "sent confirm token"},
+	TypeResendFailed:           {Names: []EventName{EventResend}, Message: "{error}"},
+	TypeResetPass:              {Names: []EventName{EventResetPass}, Succeeded: true, Message: "success"},
+	TypeResetBreached:          {Names: []EventName{EventResetPass}, Message: "breached password"},
+	TypeResetNonce:             {Names: []EventName{EventResetPass}, Message: "invalid form nonce"},
+	TypeResetUsed:              {Names: []EventName{EventResetPass}, Message: "reset token already used"},
+	TypeRenameSelf:             {Names: []EventName{EventRename}, Succeeded: true, Message: "changed from {from}"},
+	TypeRenameAdmin:            {Names: []EventName{EventRename}, Succeeded: true, Message: "renamed from {from} by {admin}"},
+	TypeDisableAdmin:           {Names: []EventName{EventDisable}, Succeeded: true, Message: "disable by {admin}"},
+	TypeDeleteAdmin:            {Names: []EventName{EventDelete}, Succeeded: true, Message: "delete by {admin}"},
+	TypeDeleteScheduled:        {Names: []EventName{EventDelete}, Succeeded: true, Message: "deletion scheduled for {at}"},
+	TypeDeleteCanceled:         {Names: []EventName{EventDelete}, Succeeded: true, Message: "deletion canceled"},
+	TypeDeletePurged:           {Names: []EventName{EventDelete}, Succeeded: true, Message: "account deleted at user request"},
+	TypeAPITokenCreated:        {Names: []EventName{EventAPIToken}, Succeeded: true, Message: "created {name}"},
+	TypeAPITokenRevoked:        {Names: []EventName{EventAPIToken}, Succeeded: true, Message: "revoked {id}"},
+	TypeRefreshReused:          {Names: []EventName{EventRefresh}, Message: "refresh token reused, sessions revoked"},
+	TypeRefreshFailed:          {Names: []EventName{EventRefresh}, Message: "{error}"},
+	TypeEmailPrefSaved:         {Names: []EventName{EventEmailPref}, Succeeded: true, Message: "saved email preferences"},
+	TypeEmailPrefUnsubscribed:  {Names: []EventName{EventEmailPref}, Succeeded: true, Message: "unsubscribed from {category}"},
+	TypeBounce:                 {Names: []EventName{EventBounce}, Message: "{kind}: {reason}"},
+	TypeIncidentCreated:        {Names: []EventName{EventIncident}, Succeeded: true, Message: "created {title}"},
+	TypeIncidentResolved:       {Names: []EventName{EventIncident}, Succeeded: true, Message: "resolved {id}"},
+	TypeAnnounceScheduled:      {Names: []EventName{EventAnnounce}, Succeeded: true, Message: "scheduled on {topic} for {at}"},
+	TypeAnnounceCanceled:       {Names: []EventName{EventAnnounce}, Succeeded: true, Message: "canceled {id}"},
+	TypeOAuthFailed:            {Names: []EventName{EventOAuth}, Message: "{provider}: {error}"},
+	TypeOAuthEmailExists:       {Names: []EventName{EventOAuth}, Message: "{provider}: email exists: {email}"},
+	TypeOAuthLinked:            {Names: []EventName{EventOAuth}, Succeeded: true, Message: "linked {provider}"},
+	TypePanic:                  {Names: []EventName{EventPanic}, Message: "{method} {path} stack={stack}: {value}"},
+	TypeProfileName:            {Names: []EventName{EventProfile}, Succeeded: true, Message: "full name changed"},
+	TypeProfileEmailExists:     {Names: []EventName{EventProfile}, Message: "email already exists: {email}"},
+	TypeProfileEmailRequested:  {Names: []EventName{EventProfile}, Succeeded: true, Message: "email change requested: {email}"},
+	TypeProfileEmailChanged:    {Names: []EventName{EventProfile}, Succeeded: true, Message: "email changed to {email}"},
+	TypeScreen:                 {Names: []EventName{EventScreen}, Message: "score {score} at {path}: {reasons}"},
+	TypeWaitlistAdded:          {Names: []EventName{EventWaitlist}, Succeeded: true, Message: "waitlisted for approval"},
+	TypeWaitlistApproved:       {Names: []EventName{EventWaitlist}, Succeeded: true, Message: "approved by {admin}"},
+	TypeWaitlistReleased:       {Names: []EventName{EventWaitlist}, Succeeded: true, Message: "released in cohort by {admin}"},
+}
+
+// EventSchemaFor returns the schema of t, or false if t is not known.
+func EventSchemaFor(t EventType) (EventSchema, bool) {
+	s, ok := eventSchemas[t]
+	return s, ok
+}
+
+// EventTypes returns the known event types, sorted.
+func EventTypes() []EventType {
+	types := make([]EventType, 0, len(eventSchemas))
+	for t := range eventSchemas {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	return types
+}
+
+// detailKeyRE matches a {key} in the message of an EventSchema.
+var detailKeyRE = regexp.MustCompile(`\{(\w+)\}`)
+
+// Keys returns the detail keys of s, in the order used by its message.
+func (s EventSchema) Keys() []string {
+	var keys []string
+	for _, m := range detailKeyRE.FindAllStringSubmatch(s.Message, -1) {
+		keys = append(keys, m[1])
+	}
+	return keys
+}
+
+// MaxEventDetailLen is the maximum length of the value of an event detail.
+const MaxEventDetailLen = MaxEventMessageLen
+
+// NewEvent returns an event of type t for username with details. The name,
+// result, and message are set by the schema of t. The message and details
+// are truncated to their maximum length.
+func NewEvent(t EventType, username string, details EventDetails) Event {
+	s := eventSchemas[t]
+
+	e := Event{Type: t, Succeeded: s.Succeeded, Username: username}
+	if len(s.Names) > 0 {
+		e.Name = s.Names[0]
+	}
+
+	if len(details) > 0 {
+		e.Details = make(EventDetails, len(details))
+		for k, v := range details {
+			e.Details[k] = truncate(v, MaxEventDetailLen)
+		}
+	}
+
+	e.Message = detailKeyRE.ReplaceAllStringFunc(s.Message, func(key string) string {
+		return e.Details[key[1:len(key)-1]]
+	})
+	e.Message = truncate(e.Message, MaxEventMessageLen)
+
+	return e
+}
+
+// ErrorEvent returns an event of type t for username, with err as the
+// "error" detail.
+func ErrorEvent(t EventType, username string, err error) Event {
+	return NewEvent(t, username, EventDetails{"error": err.Error()})
+}
+
+// Named returns e with name, for types used with more than one name, such
+// as TypeGeoRestricted.
+func (e Event) Named(name EventName) Event {
+	e.Name = name
+	return e
+}
+
+// replaceDetails returns e with the details equal to one of values
+// replaced by to and, if any were, its message rendered again from the
+// schema of its type. It returns false if no details were replaced.
+func (e Event) replaceDetails(to string, values ...string) (Event, bool) {
+	var replaced bool
+	details := make(EventDetails, len(e.Details))
+	for k, v := range e.Details {
+		if v != "" && slices.Contains(values, v) {
+			v, replaced = to, true
+		}
+		details[k] = v
+	}
+	if !replaced {
+		return e, false
+	}
+
+	e.Details = details
+	if _, ok := eventSchemas[e.Type]; ok {
+		e.Message = NewEvent(e.Type, e.Username, details).Message
+	}
+
+	return e, true
+}
+
+// ErrEventSchema means that an event does not match the schema of its type.
+var ErrEventSchema = errors.New("event does not match schema")
+
+// Validate returns an error wrapping ErrEventSchema if e does not match
+// the schema of its type. An event without a type must not have details.
+func (e Event) Validate() error {
+	if e.Type == "" {
+		if len(e.Details) > 0 {
+			return fmt.Errorf("%w: details without type", ErrEventSchema)
+		}
+		return nil
+	}
+
+	s, ok := eventSchemas[e.Type]
+	if !ok {
+		return fmt.Errorf("%w: unknown type %q", ErrEventSchema, e.Type)
+	}
+	if !slices.Contains(s.Names, e.Name) {
+		return fmt.Errorf("%w: name %q not used with type %q", ErrEventSchema, e.Name, e.Type)
+	}
+	if e.Succeeded != s.Succeeded {
+		return fmt.Errorf("%w: succeeded %t for type %q", ErrEventSchema, e.Succeeded, e.Type)
+	}
+
+	keys := s.Keys()
+	for k := range e.Details {
+		if !slices.Contains(keys, k) {
+			return fmt.Errorf("%w: unknown detail %q for type %q", ErrEventSchema, k, e.Type)
+		}
+	}
+	for _, k := range keys {
+		if _, ok := e.Details[k]; !ok {
+			return fmt.Errorf("%w: missing detail %q for type %q", ErrEventSchema, k, e.Type)
+		}
+	}
+
+	return nil
+}
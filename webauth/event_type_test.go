@@ -0,0 +1,189 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webauth/migrations"
+	"github.com/bnixon67/webapp/webid"
+)
+
+func TestNewEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   webauth.Event
+		want    webauth.Event
+		wantErr error
+	}{
+		{
+			name:  "noDetails",
+			event: webauth.NewEvent(webauth.TypeLoginPassword, "test", nil),
+			want:  webauth.Event{Name: webauth.EventLogin, Type: webauth.TypeLoginPassword, Succeeded: true, Username: "test", Message: "logged in user"},
+		},
+		{
+			name:  "details",
+			event: webauth.NewEvent(webauth.TypeRenameAdmin, "new", webauth.EventDetails{"from": "old", "admin": "admin"}),
+			want: webauth.Event{
+				Name: webauth.EventRename, Type: webauth.TypeRenameAdmin, Succeeded: true, Username: "new",
+				Message: "renamed from old by admin", Details: webauth.EventDetails{"from": "old", "admin": "admin"},
+			},
+		},
+		{
+			name:  "error",
+			event: webauth.ErrorEvent(webauth.TypeLoginFailed, "test", webauth.ErrUserNotFound),
+			want: webauth.Event{
+				Name: webauth.EventLogin, Type: webauth.TypeLoginFailed, Username: "test",
+				Message: webauth.ErrUserNotFound.Error(), Details: webauth.EventDetails{"error": webauth.ErrUserNotFound.Error()},
+			},
+		},
+		{
+			name:  "named",
+			event: webauth.NewEvent(webauth.TypeGeoRestricted, "test", webauth.EventDetails{"action": "block", "rule": "country:XX", "addr": "192.0.2.1"}).Named(webauth.EventRegister),
+			want: webauth.Event{
+				Name: webauth.EventRegister, Type: webauth.TypeGeoRestricted, Username: "test",
+				Message: "block by rule country:XX from 192.0.2.1", Details: webauth.EventDetails{"action": "block", "rule": "country:XX", "addr": "192.0.2.1"},
+			},
+		},
+		{
+			name:    "missingDetail",
+			event:   webauth.NewEvent(webauth.TypeRenameAdmin, "new", webauth.EventDetails{"from": "old"}),
+			wantErr: webauth.ErrEventSchema,
+		},
+		{
+			name:    "unknownDetail",
+			event:   webauth.NewEvent(webauth.TypeLogout, "test", webauth.EventDetails{"extra": "x"}),
+			wantErr: webauth.ErrEventSchema,
+		},
+		{
+			name:    "wrongName",
+			event:   webauth.NewEvent(webauth.TypeLogout, "test", nil).Named(webauth.EventLogin),
+			wantErr: webauth.ErrEventSchema,
+		},
+		{
+			name:    "unknownType",
+			event:   webauth.Event{Name: webauth.EventLogin, Type: "nosuch"},
+			wantErr: webauth.ErrEventSchema,
+		},
+		{
+			name:  "untyped",
+			event: webauth.Event{Name: webauth.EventLogin, Message: "free form"},
+			want:  webauth.Event{Name: webauth.EventLogin, Message: "free form"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.event.Validate()
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Validate() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && !reflect.DeepEqual(tc.event, tc.want) {
+				t.Errorf("got %+v, want %+v", tc.event, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewEventTruncated(t *testing.T) {
+	long := strings.Repeat("é", webauth.MaxEventMessageLen)
+
+	e := webauth.NewEvent(webauth.TypeLoginFailed, "test", webauth.EventDetails{"error": long})
+	if len(e.Message) > webauth.MaxEventMessageLen || len(e.Details["error"]) > webauth.MaxEventDetailLen {
+		t.Errorf("message of %d and detail of %d bytes not truncated", len(e.Message), len(e.Details["error"]))
+	}
+	if !strings.HasPrefix(long, e.Message) {
+		t.Errorf("message %q is not a valid prefix", e.Message)
+	}
+}
+
+func TestEventTypes(t *testing.T) {
+	types := webauth.EventTypes()
+
+	for _, typ := range types {
+		s, ok := webauth.EventSchemaFor(typ)
+		if !ok || len(s.Names) == 0 || s.Message == "" {
+			t.Errorf("schema of %q = %+v, %t, want names and message", typ, s, ok)
+		}
+		if len(typ) > len(webauth.TypeMax) {
+			t.Errorf("type %q longer than %d", typ, len(webauth.TypeMax))
+		}
+	}
+
+	// The migration that adds types backfills every type, except those
+	// added after it, which have no earlier events.
+	later := map[webauth.EventType]bool{
+		webauth.TypeAnnounceScheduled: true,
+		webauth.TypeAnnounceCanceled:  true,
+		webauth.TypeWaitlistAdded:     true,
+		webauth.TypeWaitlistApproved:  true,
+		webauth.TypeWaitlistReleased:  true,
+	}
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		all, err := migrations.Load(dialect)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", dialect, err)
+		}
+		var sql string
+		for _, m := range all {
+			if m.Name == "event_types" {
+				sql = m.SQL
+			}
+		}
+		for _, typ := range types {
+			if !later[typ] && !strings.Contains(sql, "= '"+string(typ)+"' WHERE") {
+				t.Errorf("%s event_types migration does not set type %q", dialect, typ)
+			}
+		}
+	}
+}
+
+func TestRecordEvent(t *testing.T) {
+	stores := map[string]webauth.AuthStore{"memory": StoreForTest(t)}
+	// The SQL store is tested only if there is a test database.
+	t.Run("sql", func(t *testing.T) {
+		testRecordEvent(t, DBForTest(t))
+	})
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testRecordEvent(t, store)
+		})
+	}
+}
+
+// testRecordEvent tests that an event with a type and details is recorded
+// and read by store.
+func testRecordEvent(t *testing.T, store webauth.AuthStore) {
+	want := webauth.NewEvent(webauth.TypeProfileEmailChanged, "test", webauth.EventDetails{"email": "recorded@email"})
+	if err := store.RecordEvent(want); err != nil {
+		t.Fatalf("RecordEvent() failed: %v", err)
+	}
+
+	invalid := webauth.NewEvent(webauth.TypeProfileEmailChanged, "test", nil)
+	if err := store.RecordEvent(invalid); !errors.Is(err, webauth.ErrWriteEventFailed) {
+		t.Errorf("RecordEvent() of invalid event error = %v, want %v", err, webauth.ErrWriteEventFailed)
+	}
+
+	events, err := store.EventsForUser("test")
+	if err != nil {
+		t.Fatalf("EventsForUser() failed: %v", err)
+	}
+	for _, e := range events {
+		if e.Type != want.Type || e.Details["email"] != "recorded@email" {
+			continue
+		}
+		if e.Name != want.Name || e.Message != want.Message || !reflect.DeepEqual(e.Details, want.Details) {
+			t.Errorf("got %+v, want %+v", e, want)
+		}
+		if id, err := webid.Parse(e.ID); err != nil || id.Version() != 7 {
+			t.Errorf("got ID %q, want a UUIDv7", e.ID)
+		}
+		return
+	}
+	t.Errorf("event %+v not found in %+v", want, events)
+}
@@ -4,9 +4,10 @@
 package webauth
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
-	"github.com/bnixon67/webapp/csv"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
@@ -16,44 +17,121 @@ type EventsPageData struct {
 	CommonData
 	User   User
 	Events []Event
+	Panics []Event  // Panics are the most recent panic events.
+	Views  ViewData // Views are the view controls, shown to an admin.
 }
 
-// EventsHandler displays a list of events.
+// eventList is the events shown to a user with PermViewEvents.
+type eventList struct {
+	Events []Event
+	Panics []Event // Panics are the most recent panic events.
+	Views  ViewData
+	Query  string // Query of a saved view to redirect to.
+}
+
+// listEvents returns the page of events shown to user for r. It is shared
+// by the HTML and JSON handlers. If r names a saved view, only the Query is
+// set.
+func (app *AuthApp) listEvents(r *http.Request, user User) (eventList, error) {
+	var (
+		list eventList
+		err  error
+	)
+
+	list.Panics, err = app.DB.EventsNamed(EventPanic, MaxRecentPanics)
+	if err != nil {
+		return eventList{}, err
+	}
+
+	if !user.Can(PermViewEvents) {
+		return list, nil
+	}
+
+	list.Views, list.Query, err = app.viewData(r, user, EventsTable)
+	if err != nil || list.Query != "" {
+		return eventList{Query: list.Query}, err
+	}
+
+	list.Events, list.Views.Total, err = app.DB.ListEvents(list.Views.View.ListQuery())
+	if err != nil {
+		return eventList{}, err
+	}
+
+	return list, nil
+}
+
+// EventsHandler displays a list of events. It responds with JSON, like
+// APIEventsHandler, if requested by the Accept header.
 func (app *AuthApp) EventsHandler(w http.ResponseWriter, r *http.Request) {
 	// Get logger with request info and function name.
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
+	if webutil.WantsJSON(r) {
+		app.APIEventsHandler(w, r)
+		return
+	}
+
 	// Check if the HTTP method is valid.
 	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
 		logger.Error("invalid method")
 		return
 	}
 
-	user, err := app.DB.UserFromRequest(w, r)
+	user, err := app.UserFromRequest(w, r)
 	if err != nil {
 		logger.Error("failed to get user", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	events, err := app.DB.GetEvents()
-	if err != nil {
-		logger.Error("failed to get events", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+	list, err := app.listEvents(r, user)
+	switch {
+	case errors.Is(err, ErrViewNotFound):
+		logger.Warn("saved view not found")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	case err != nil:
+		logger.Error("failed to list events", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	case list.Query != "":
+		http.Redirect(w, r, EventsTable.URL(list.Query), http.StatusFound)
 		return
 	}
 
-	app.RenderPage(w, logger, "events.html",
+	app.RenderPage(w, r, logger, "events.html",
 		&EventsPageData{
 			CommonData: CommonData{Title: app.Cfg.App.Name},
 			User:       user,
-			Events:     events,
+			Events:     list.Events,
+			Panics:     list.Panics,
+			Views:      list.Views,
 		})
 
 	logger.Info("done")
 }
 
-// EventsCSVHandler provides list of events as a CSV file.
+// eventColumn returns the value of a column of EventsTable for e.
+func eventColumn(e Event, col string) string {
+	switch col {
+	case "name":
+		return string(e.Name)
+	case "type":
+		return string(e.Type)
+	case "succeeded":
+		return strconv.FormatBool(e.Succeeded)
+	case "username":
+		return e.Username
+	case "message":
+		return e.Message
+	case "created":
+		return e.Created.Format(sortableTime)
+	}
+	return ""
+}
+
+// EventsCSVHandler provides list of events as a file in the format of
+// webutil.Export, CSV by default.
 func (app *AuthApp) EventsCSVHandler(w http.ResponseWriter, r *http.Request) {
 	// Get logger with request info and function name.
 	logger := webhandler.RequestLoggerWithFuncName(r)
@@ -64,34 +142,29 @@ func (app *AuthApp) EventsCSVHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.DB.UserFromRequest(w, r)
+	user, err := app.UserFromRequest(w, r)
 	if err != nil {
 		logger.Error("failed to get user", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	if !user.IsAdmin {
+	if !user.Can(PermViewEvents) {
 		logger.Error("user not authorized", "user", user)
-		webutil.RespondWithError(w, http.StatusUnauthorized)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
 		return
 	}
 
 	events, err := app.DB.GetEvents()
 	if err != nil {
 		logger.Error("failed to get events", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", "attachment;filename=events.csv")
-
-	err = csv.SliceOfStructsToCSV(w, events)
+	err = webutil.Export(w, r, "events", events)
 	if err != nil {
-		logger.Error("failed to convert struct to CSV",
-			"err", err, "events", events)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		logger.Error("failed to export events", "err", err)
 		return
 	}
 }
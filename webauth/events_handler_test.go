@@ -14,24 +14,21 @@ import (
 	"github.com/bnixon67/webapp/csv"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
-	"github.com/bnixon67/webapp/webutil"
 )
 
 func eventsBody(t *testing.T, data webauth.EventsPageData) string {
 	tmplName := "events.html"
 
-	// Initialize FuncMap with the custom function.
-	funcMap := template.FuncMap{"ToTimeZone": webutil.ToTimeZone}
-
 	// Directly include the name of the template in New for clarity.
-	tmpl := template.New(tmplName).Funcs(funcMap)
+	tmpl := template.New(tmplName).Funcs(tmplFuncsForTest)
 
 	// Get path to template file.
 	assetDir := assets.AssetPath()
 	tmplFile := filepath.Join(assetDir, "tmpl", tmplName)
+	viewFile := filepath.Join(assetDir, "tmpl", "table_view.html")
 
-	// Parse the template file, checking for errors.
-	tmpl, err := tmpl.ParseFiles(tmplFile)
+	// Parse the template files, checking for errors.
+	tmpl, err := tmpl.ParseFiles(tmplFile, viewFile)
 	if err != nil {
 		t.Fatalf("could not parse template file '%s': %v", tmplFile, err)
 	}
@@ -103,7 +100,7 @@ func TestEventsHandler(t *testing.T) {
 					Title: app.Cfg.App.Name,
 				},
 			}),
-			WantCookies: []http.Cookie{http.Cookie{Name: "login", MaxAge: -1, Raw: "login=; Max-Age=0"}},
+			WantCookies: []http.Cookie{http.Cookie{Name: "login", Path: "/", MaxAge: -1, Raw: "login=; Path=/; Max-Age=0"}},
 		},
 		{
 			Name:          "Valid GET Request with Good Login Token - Non Admin",
@@ -133,6 +130,7 @@ func TestEventsHandler(t *testing.T) {
 					Title: app.Cfg.App.Name,
 				},
 				User: admin, Events: events,
+				Views: webauth.ViewData{Table: webauth.EventsTable},
 			}),
 		},
 	}
@@ -188,7 +186,7 @@ func TestEventsCSVHandler(t *testing.T) {
 			},
 			WantStatus:  http.StatusUnauthorized,
 			WantBody:    "Error: Unauthorized\n",
-			WantCookies: []http.Cookie{http.Cookie{Name: "login", MaxAge: -1, Raw: "login=; Max-Age=0"}},
+			WantCookies: []http.Cookie{http.Cookie{Name: "login", Path: "/", MaxAge: -1, Raw: "login=; Path=/; Max-Age=0"}},
 		},
 		{
 			Name:          "Valid GET Request with Good Login Token - Non Admin",
@@ -5,7 +5,8 @@ package webauth
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"slices"
@@ -36,22 +37,7 @@ type ForgotPageData struct {
 
 // ForgotHandler handles HTTP requests for forgot user or password.
 func (app *AuthApp) ForgotHandler(w http.ResponseWriter, r *http.Request) {
-	// Get logger with request info and function name.
-	logger := webhandler.RequestLoggerWithFuncName(r)
-
-	// Check if the HTTP method is valid.
-	if !webutil.CheckAllowedMethods(w, r, http.MethodGet, http.MethodPost) {
-		logger.Error("invalid method")
-		return
-	}
-
-	// Route to the appropriate handler based on the HTTP method.
-	switch r.Method {
-	case http.MethodGet:
-		app.forgotGet(w, r)
-	case http.MethodPost:
-		app.forgotPost(w, r)
-	}
+	webhandler.MethodHandler{Get: app.forgotGet, Post: app.forgotPost}.ServeHTTP(w, r)
 }
 
 // forgotGet serves the page to initiate a password reset request.
@@ -60,7 +46,7 @@ func (app *AuthApp) forgotGet(w http.ResponseWriter, r *http.Request) {
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
 	data := ForgotPageData{}
-	app.RenderPage(w, logger, TemplateForgot, &data)
+	app.RenderPage(w, r, logger, TemplateForgot, &data)
 
 	logger.Info("done")
 }
@@ -102,7 +88,7 @@ func (app *AuthApp) forgotPost(w http.ResponseWriter, r *http.Request) {
 	errMessage := validateForgotPostForm(email, action)
 	if errMessage != "" {
 		logger.Warn("invalid form data", "errMessage", errMessage)
-		app.RenderPage(w, logger, "forgot.html", &ForgotPageData{Message: errMessage})
+		app.RenderPage(w, r, logger, "forgot.html", &ForgotPageData{Message: errMessage})
 		return
 	}
 
@@ -114,22 +100,21 @@ func (app *AuthApp) forgotPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create and save a password reset token
-	token, err := app.DB.createPasswordResetToken(username)
+	token, err := app.createPasswordResetToken(username)
 	if err != nil {
 		slog.Error("failed to create password reset token", "err", err, "username", username)
 	}
 
-	err = sendEmailForAction(action, username, email, token, app.Cfg)
-	if err != nil {
+	err = app.sendEmailForAction(r.Context(), action, username, email, token)
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
 		logger.Error("unable to send email", "err", err)
-		http.Error(w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "email_failed",
+			"The email could not be sent. Please try again later.")
 		return
 	}
 
 	data := ForgotPageData{EmailFrom: app.Cfg.EmailFrom}
-	app.RenderPage(w, logger, TemplateForgotSent, &data)
+	app.RenderPage(w, r, logger, TemplateForgotSent, &data)
 
 	logger.Info("done")
 }
@@ -160,10 +145,12 @@ Your user name for {{.Title}} is {{.Username}}.
 `
 )
 
-// emailBody constructs the body of an email using a given template and data.
-func emailBody(name, text string, data any) (string, error) {
+// emailBody constructs the body of an email using the template name, with
+// the default text, and data. The template is translated to the language
+// of ctx, if the Catalog has it.
+func (app *AuthApp) emailBody(ctx context.Context, name, text string, data any) (string, error) {
 	// Create a template.
-	tmpl, err := template.New(name).Parse(text)
+	tmpl, err := template.New(name).Parse(app.Printer(ctx).Template(name, text))
 	if err != nil {
 		return "", err
 	}
@@ -179,15 +166,16 @@ func emailBody(name, text string, data any) (string, error) {
 }
 
 // sendEmailForAction sends an email corresponding to a user's reques action.
-func sendEmailForAction(action, username, email string, token Token, cfg Config) error {
-	subj := fmt.Sprintf("%s forgot %s request", cfg.App.Name, action)
+func (app *AuthApp) sendEmailForAction(ctx context.Context, action, username, email string, token Token) error {
+	cfg := app.Cfg
+	subj := app.Printer(ctx).T("%s forgot %s request", cfg.App.Name, action)
 
 	var body string
 	var err error
 
 	switch {
 	case username == "":
-		body, err = emailBody(
+		body, err = app.emailBody(ctx,
 			"notregistered",
 			emailNotRegisteredTemplate,
 			emailData{
@@ -196,8 +184,8 @@ func sendEmailForAction(action, username, email string, token Token, cfg Config)
 				BaseURL: cfg.Auth.BaseURL,
 			})
 	case action == "password":
-		body, err = emailBody(
-			"password",
+		body, err = app.emailBody(ctx,
+			"forgot_password",
 			emailForgotPasswordTemplate,
 			emailData{
 				Token:   token,
@@ -205,8 +193,8 @@ func sendEmailForAction(action, username, email string, token Token, cfg Config)
 				BaseURL: cfg.Auth.BaseURL,
 			})
 	case action == "user":
-		body, err = emailBody(
-			"user",
+		body, err = app.emailBody(ctx,
+			"forgot_user",
 			emailForgotUserTemplate,
 			emailData{
 				Username: username,
@@ -219,23 +207,15 @@ func sendEmailForAction(action, username, email string, token Token, cfg Config)
 		return err
 	}
 
-	err = cfg.SMTP.SendMessage(cfg.EmailFrom, []string{email}, subj, body)
-	if err != nil {
-		return err
-	}
-
-	slog.Info("sent email", slog.Group("email",
-		slog.String("to", email), slog.String("subject", subj)))
-
-	return nil
+	return app.sendEmail(ctx, email, subj, body, nil)
 }
 
 // createPasswordResetToken generates a new token for resetting a user's password.
-func (db *AuthDB) createPasswordResetToken(username string) (Token, error) {
+func (app *AuthApp) createPasswordResetToken(username string) (Token, error) {
 	// special case for empty username
 	if username == "" {
 		return Token{}, nil
 	}
 
-	return db.CreateToken("reset", username, ResetTokenSize, ResetTokenExpires)
+	return app.DB.CreateToken("reset", username, ResetTokenSize, ResetTokenExpires)
 }
@@ -0,0 +1,96 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Form nonces protect sensitive forms from replay. Unlike the CSRF token,
+// which is valid for the session, each nonce is stored when a form is
+// rendered and removed when the form is submitted, so resubmitting a
+// captured request is rejected even with a valid session.
+const (
+	FormNonceFieldName = "formNonce"      // Name of the hidden form field.
+	FormNonceSize      = 32               // Size of a nonce.
+	FormNonceExpires   = 30 * time.Minute // Time to submit a form.
+)
+
+// Forms that require a nonce.
+const (
+	FormReset      = "reset"       // FormReset submits a password reset.
+	FormBulkDelete = "bulk_delete" // FormBulkDelete confirms deleting users.
+)
+
+const MsgFormNonceInvalid = "This form expired or was already submitted. Please try again."
+
+var ErrFormNonceInvalid = errors.New("form nonce invalid, expired, or used")
+
+// CreateFormNonce creates and saves a nonce for form that expires after
+// duration. Expired nonces are removed.
+func (db *AuthDB) CreateFormNonce(form string, duration time.Duration) (string, error) {
+	if db == nil {
+		return "", ErrInvalidDB
+	}
+
+	value, err := RandomStringFrom(randReader(db.Rand), FormNonceSize)
+	if err != nil {
+		return "", err
+	}
+
+	now := db.now()
+
+	_, err = db.Exec("DELETE FROM form_nonces WHERE expires <= ?", now)
+	if err != nil {
+		return "", err
+	}
+
+	qry := "INSERT INTO form_nonces(hashedValue, form, expires) VALUES (?, ?, ?)"
+	_, err = db.Exec(qry, Hash(value), form, now.Add(duration))
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// UseFormNonce removes the unexpired nonce for form with value. It returns
+// ErrFormNonceInvalid if there is no such nonce, so each nonce can only be
+// used once.
+func (db *AuthDB) UseFormNonce(form, value string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	qry := "DELETE FROM form_nonces WHERE hashedValue = ? AND form = ? AND expires > ?"
+	result, err := db.Exec(qry, Hash(value), form, db.now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrFormNonceInvalid
+	}
+
+	return nil
+}
+
+// newFormNonce returns a new nonce for form, or "" if it cannot be
+// created, which is logged. The form can then not be submitted, but the
+// page can still be shown.
+func (app *AuthApp) newFormNonce(logger *slog.Logger, form string) string {
+	nonce, err := app.DB.CreateFormNonce(form, FormNonceExpires)
+	if err != nil {
+		logger.Error("failed to create form nonce", "form", form, "err", err)
+		return ""
+	}
+
+	return nonce
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// formNonceRE matches the form nonce field of a page.
+var formNonceRE = regexp.MustCompile(`name="formNonce" value="([^"]+)"`)
+
+// formNonce returns the form nonce in body.
+func formNonce(t *testing.T, body string) string {
+	t.Helper()
+
+	m := formNonceRE.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no form nonce in body:\n%s", body)
+	}
+
+	return html.UnescapeString(m[1])
+}
+
+func TestMemStoreFormNonce(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := StoreForTest(t)
+	store.SetClock(clock)
+
+	nonce, err := store.CreateFormNonce(webauth.FormReset, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateFormNonce() failed: %v", err)
+	}
+
+	if err := store.UseFormNonce(webauth.FormBulkDelete, nonce); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+		t.Errorf("UseFormNonce() for other form = %v, want %v", err, webauth.ErrFormNonceInvalid)
+	}
+	if err := store.UseFormNonce(webauth.FormReset, nonce); err != nil {
+		t.Errorf("UseFormNonce() = %v, want nil", err)
+	}
+	if err := store.UseFormNonce(webauth.FormReset, nonce); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+		t.Errorf("UseFormNonce() again = %v, want %v", err, webauth.ErrFormNonceInvalid)
+	}
+
+	nonce, err = store.CreateFormNonce(webauth.FormReset, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateFormNonce() failed: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if err := store.UseFormNonce(webauth.FormReset, nonce); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+		t.Errorf("UseFormNonce() after expires = %v, want %v", err, webauth.ErrFormNonceInvalid)
+	}
+}
+
+func TestResetFormNonce(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	post := func(data url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/reset", strings.NewReader(data.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		app.ResetHandler(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	app.ResetHandler(w, httptest.NewRequest(http.MethodGet, "/reset", nil))
+	nonce := formNonce(t, w.Body.String())
+
+	token, err := store.CreateToken("reset", "test", webauth.ResetTokenSize, webauth.ResetTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	data := url.Values{
+		"rtoken":    {token.Value},
+		"password1": {"new password"},
+		"password2": {"new password"},
+	}
+
+	// Without a nonce, the password is not changed.
+	w = post(data)
+	if !strings.Contains(w.Body.String(), webauth.MsgFormNonceInvalid) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgFormNonceInvalid)
+	}
+	if err := store.CheckPassword("test", "password"); err != nil {
+		t.Errorf("password changed without form nonce: %v", err)
+	}
+
+	data.Set(webauth.FormNonceFieldName, nonce)
+	w = post(data)
+	if got := w.Header().Get("Location"); got != "/login" {
+		t.Errorf("got location %q, expected %q", got, "/login")
+	}
+	if err := store.CheckPassword("test", "new password"); err != nil {
+		t.Errorf("password not changed: %v", err)
+	}
+
+	// Replaying the request is rejected, even with a valid reset token.
+	token, err = store.CreateToken("reset", "test", webauth.ResetTokenSize, webauth.ResetTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	data.Set("rtoken", token.Value)
+	data.Set("password1", "replayed")
+	data.Set("password2", "replayed")
+	w = post(data)
+	if !strings.Contains(w.Body.String(), webauth.MsgFormNonceInvalid) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgFormNonceInvalid)
+	}
+	if err := store.CheckPassword("test", "new password"); err != nil {
+		t.Errorf("password changed by replay: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+const (
+	MsgGeoBlocked   = "Sorry, this is not available from your location."
+	MsgGeoChallenge = "For your security, please login with the link sent to your email."
+)
+
+// GeoLocator looks up the country of an IP address, e.g., with a GeoIP
+// database, for the country rules of Config.Geo.
+type GeoLocator interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country of
+	// addr, such as "US", or "" if it is not known.
+	Country(addr netip.Addr) (string, error)
+}
+
+// GeoLocatorFunc is an adapter to use a function as a GeoLocator.
+type GeoLocatorFunc func(addr netip.Addr) (string, error)
+
+// Country calls f(addr).
+func (f GeoLocatorFunc) Country(addr netip.Addr) (string, error) {
+	return f(addr)
+}
+
+// WithGeoLocator returns an Option to set the GeoLocator used by the
+// country rules of Config.Geo.
+func WithGeoLocator(g GeoLocator) Option {
+	return func(a *AuthApp) {
+		a.Geo = g
+	}
+}
+
+// GeoAction is the action taken for a login or registration from a
+// restricted location.
+type GeoAction string
+
+const (
+	GeoAllow     GeoAction = ""          // Allow the request.
+	GeoBlock     GeoAction = "block"     // Refuse the request.
+	GeoChallenge GeoAction = "challenge" // Require a login link sent by email.
+)
+
+// ConfigGeo holds the restrictions of logins and registrations by the
+// location of the client. A challenged login must use a login link sent
+// to the email of the user, so challenges require Auth.MagicExpires.
+// Registrations are not challenged, since a new user must login next.
+type ConfigGeo struct {
+	Block       []string  // Block countries, as ISO 3166-1 alpha-2 codes.
+	Challenge   []string  // Challenge countries, as ISO 3166-1 alpha-2 codes.
+	Tor         GeoAction // Tor is the action for Tor exit nodes.
+	TorExitList string    // TorExitList is a file of Tor exit addresses.
+	AllowIPs    []string  // AllowIPs are addresses or CIDRs never restricted.
+	AllowUsers  []string  // AllowUsers are usernames never restricted.
+}
+
+// geoPolicy is the parsed ConfigGeo.
+type geoPolicy struct {
+	countries  map[string]GeoAction // countries are the actions by country.
+	tor        GeoAction
+	torFile    string
+	allowIPs   []netip.Prefix
+	allowUsers map[string]bool // allowUsers are lowercase usernames.
+
+	mu       sync.RWMutex
+	torExits map[netip.Addr]bool // torExits are loaded from torFile.
+}
+
+// parse returns the geoPolicy of c. The Tor exit list is loaded, if any.
+func (c ConfigGeo) parse() (*geoPolicy, error) {
+	p := &geoPolicy{
+		countries:  make(map[string]GeoAction),
+		tor:        c.Tor,
+		torFile:    c.TorExitList,
+		allowUsers: make(map[string]bool),
+	}
+
+	for action, codes := range map[GeoAction][]string{GeoBlock: c.Block, GeoChallenge: c.Challenge} {
+		for _, code := range codes {
+			if len(code) != 2 {
+				return nil, fmt.Errorf("invalid Geo country %q", code)
+			}
+			code = strings.ToUpper(code)
+			if _, ok := p.countries[code]; ok {
+				return nil, fmt.Errorf("Geo country %q in Block and Challenge", code)
+			}
+			p.countries[code] = action
+		}
+	}
+
+	switch c.Tor {
+	case GeoAllow:
+	case GeoBlock, GeoChallenge:
+		if c.TorExitList == "" {
+			return nil, fmt.Errorf("Geo.Tor %q without Geo.TorExitList", c.Tor)
+		}
+		if err := p.loadTorExits(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown Geo.Tor %q", c.Tor)
+	}
+
+	var err error
+	p.allowIPs, err = ConfigDebug{AllowIPs: c.AllowIPs}.Prefixes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Geo.AllowIPs: %w", err)
+	}
+
+	for _, username := range c.AllowUsers {
+		p.allowUsers[strings.ToLower(username)] = true
+	}
+
+	return p, nil
+}
+
+// challenges returns true if a rule of p challenges requests.
+func (p *geoPolicy) challenges() bool {
+	for _, action := range p.countries {
+		if action == GeoChallenge {
+			return true
+		}
+	}
+	return p.tor == GeoChallenge
+}
+
+// loadTorExits reads the Tor exit addresses of p.torFile. Each line is an
+// address, or an "ExitAddress" line of the exit list of the Tor Project.
+// Other lines are ignored.
+func (p *geoPolicy) loadTorExits() error {
+	f, err := os.Open(p.torFile)
+	if err != nil {
+		return fmt.Errorf("invalid Geo.TorExitList: %w", err)
+	}
+	defer f.Close()
+
+	exits := make(map[netip.Addr]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "ExitAddress" {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if addr, err := netip.ParseAddr(fields[0]); err == nil {
+			exits[addr.Unmap()] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("invalid Geo.TorExitList: %w", err)
+	}
+
+	p.mu.Lock()
+	p.torExits = exits
+	p.mu.Unlock()
+
+	return nil
+}
+
+// isTorExit returns true if addr is a Tor exit node.
+func (p *geoPolicy) isTorExit(addr netip.Addr) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.torExits[addr]
+}
+
+// ReloadTorExitList loads Config.Geo.TorExitList again, e.g., after it is
+// updated. It does nothing if Tor exit nodes are not restricted.
+func (app *AuthApp) ReloadTorExitList() error {
+	if app.geo == nil || app.geo.tor == GeoAllow {
+		return nil
+	}
+
+	return app.geo.loadTorExits()
+}
+
+// geoRule returns the action and the name of the rule of Config.Geo that
+// matches a request from addr by username, which may be empty. The name is
+// "tor" or "country:" and the country code.
+func (app *AuthApp) geoRule(addr netip.Addr, username string) (GeoAction, string, error) {
+	p := app.geo
+	if p == nil || p.allowUsers[strings.ToLower(username)] {
+		return GeoAllow, "", nil
+	}
+	for _, prefix := range p.allowIPs {
+		if prefix.Contains(addr) {
+			return GeoAllow, "", nil
+		}
+	}
+
+	if p.tor != GeoAllow && p.isTorExit(addr) {
+		return p.tor, "tor", nil
+	}
+
+	if len(p.countries) == 0 || app.Geo == nil {
+		return GeoAllow, "", nil
+	}
+
+	country, err := app.country(addr)
+	if err != nil {
+		return GeoAllow, "", err
+	}
+
+	action := p.countries[strings.ToUpper(country)]
+	if action == GeoAllow {
+		return GeoAllow, "", nil
+	}
+
+	return action, "country:" + strings.ToUpper(country), nil
+}
+
+// geoRestrict returns the action of Config.Geo for the request r to
+// login or register, by event, as username. Unless challenge is true,
+// challenge rules are ignored. A restricted request is logged with the
+// rule that matched and recorded as a failed event. The client is located
+// by the address of the connection, not headers it could spoof, unless
+// RealIP found it from the headers of a trusted proxy. It is blocked if
+// the address is not an IP. If the location cannot be found,
+// the request is allowed.
+func (app *AuthApp) geoRestrict(logger *slog.Logger, r *http.Request, event EventName, username string, challenge bool) GeoAction {
+	var action GeoAction
+	var rule, client string
+
+	addr, err := webhandler.ClientAddr(r)
+	if err != nil {
+		if app.geo == nil || app.geo.allowUsers[strings.ToLower(username)] {
+			return GeoAllow
+		}
+		action, rule, client = GeoBlock, "addr", r.RemoteAddr
+	} else {
+		action, rule, err = app.geoRule(addr, username)
+		if err != nil {
+			logger.Error("failed to locate client", "addr", addr, "err", err)
+			return GeoAllow
+		}
+		client = addr.String()
+	}
+	if action == GeoAllow || (action == GeoChallenge && !challenge) {
+		return GeoAllow
+	}
+
+	logger.Warn("geo restriction", "rule", rule, "action", action, "addr", client, "event", event)
+	app.DB.RecordEvent(NewEvent(TypeGeoRestricted, username, EventDetails{"action": string(action), "rule": rule, "addr": client}).Named(event))
+	app.Audit(r, audit.Entry{
+		Actor:    username,
+		Action:   string(event),
+		Result:   audit.Denied,
+		Metadata: audit.Metadata{"geo": string(action), "rule": rule},
+	})
+
+	return action
+}
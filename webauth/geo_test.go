@@ -0,0 +1,254 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// geoForTest locates 192.0.2.0/24 in "CN", 198.51.100.0/24 in "RU", and
+// other addresses in "US".
+var geoForTest = webauth.GeoLocatorFunc(func(addr netip.Addr) (string, error) {
+	switch {
+	case netip.MustParsePrefix("192.0.2.0/24").Contains(addr):
+		return "CN", nil
+	case netip.MustParsePrefix("198.51.100.0/24").Contains(addr):
+		return "RU", nil
+	}
+	return "US", nil
+})
+
+// withGeo returns a config modifier that sets the location restrictions.
+func withGeo(geo webauth.ConfigGeo) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Geo = geo
+	}
+}
+
+// geoRequest serves a POST of data from addr to handler.
+func geoRequest(handler http.HandlerFunc, target, addr string, data url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(data.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = addr + ":1234"
+	w := httptest.NewRecorder()
+
+	handler(w, r)
+
+	return w
+}
+
+func TestConfigGeo(t *testing.T) {
+	torList := filepath.Join(t.TempDir(), "tor.txt")
+	if err := os.WriteFile(torList, []byte("ExitAddress 203.0.113.9 2024-05-01 00:00:00\n203.0.113.10\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		geo     webauth.ConfigGeo
+		magic   string
+		wantErr error
+	}{
+		{name: "empty"},
+		{name: "block", geo: webauth.ConfigGeo{Block: []string{"cn"}}},
+		{name: "badCountry", geo: webauth.ConfigGeo{Block: []string{"CHN"}}, wantErr: webauth.ErrInvalidConfig},
+		{name: "both", geo: webauth.ConfigGeo{Block: []string{"CN"}, Challenge: []string{"CN"}}, magic: "15m", wantErr: webauth.ErrInvalidConfig},
+		{name: "challenge", geo: webauth.ConfigGeo{Challenge: []string{"RU"}}, magic: "15m"},
+		{name: "challengeNoMagic", geo: webauth.ConfigGeo{Challenge: []string{"RU"}}, wantErr: webauth.ErrInvalidConfig},
+		{name: "tor", geo: webauth.ConfigGeo{Tor: webauth.GeoBlock, TorExitList: torList}},
+		{name: "torNoList", geo: webauth.ConfigGeo{Tor: webauth.GeoBlock}, wantErr: webauth.ErrInvalidConfig},
+		{name: "torMissingList", geo: webauth.ConfigGeo{Tor: webauth.GeoBlock, TorExitList: torList + ".missing"}, wantErr: webauth.ErrInvalidConfig},
+		{name: "torUnknown", geo: webauth.ConfigGeo{Tor: "deny", TorExitList: torList}, wantErr: webauth.ErrInvalidConfig},
+		{name: "badAllowIPs", geo: webauth.ConfigGeo{AllowIPs: []string{"bad"}}, wantErr: webauth.ErrInvalidConfig},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("LoadConfigFromJSON() failed: %v", err)
+			}
+			cfg.Geo = tc.geo
+			cfg.Auth.MagicExpires = tc.magic
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeoRestrictLogin(t *testing.T) {
+	torList := filepath.Join(t.TempDir(), "tor.txt")
+	if err := os.WriteFile(torList, []byte("203.0.113.9\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := StoreForTest(t)
+	app := newAppForTest(t,
+		[]func(*webauth.Config){
+			withMagicExpires("15m"),
+			withGeo(webauth.ConfigGeo{
+				Block:       []string{"CN"},
+				Challenge:   []string{"RU"},
+				Tor:         webauth.GeoBlock,
+				TorExitList: torList,
+				AllowIPs:    []string{"192.0.2.128/25"},
+				AllowUsers:  []string{"admin"},
+			}),
+		},
+		webauth.WithDB(store), webauth.WithGeoLocator(geoForTest))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		addr     string
+		wantMsg  string // wantMsg is empty if the login succeeds.
+	}{
+		{name: "allowed", username: "test", password: "password", addr: "203.0.113.1"},
+		{name: "blocked", username: "test", password: "password", addr: "192.0.2.1", wantMsg: webauth.MsgGeoBlocked},
+		{name: "tor", username: "test", password: "password", addr: "203.0.113.9", wantMsg: webauth.MsgGeoBlocked},
+		{name: "allowIP", username: "test", password: "password", addr: "192.0.2.200"},
+		{name: "allowUser", username: "admin", password: "password", addr: "192.0.2.1"},
+		{name: "challenged", username: "test", password: "password", addr: "198.51.100.1", wantMsg: webauth.MsgGeoChallenge},
+		{name: "challengedBadPassword", username: "confirmed", password: "wrong", addr: "198.51.100.1", wantMsg: webauth.MsgLoginFailed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := url.Values{"username": {tc.username}, "password": {tc.password}}
+			w := geoRequest(app.LoginPostHandler, "/login", tc.addr, data)
+
+			if tc.wantMsg == "" {
+				if w.Code != http.StatusSeeOther {
+					t.Errorf("got status %d, want %d", w.Code, http.StatusSeeOther)
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tc.wantMsg) {
+				t.Errorf("got body %q, expected %q in body", w.Body, tc.wantMsg)
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("restricted login set cookie %q", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+
+	// A challenged login sends a login link instead.
+	tokens, err := store.Tokens("test")
+	if err != nil {
+		t.Fatalf("Tokens() failed: %v", err)
+	}
+	var found bool
+	for _, token := range tokens {
+		found = found || token.Kind == webauth.MagicTokenKind
+	}
+	if !found {
+		t.Errorf("Tokens() = %+v, want %s token", tokens, webauth.MagicTokenKind)
+	}
+
+	// Each restriction is recorded with its rule.
+	events, err := store.EventsForUser("test")
+	if err != nil {
+		t.Fatalf("EventsForUser() failed: %v", err)
+	}
+	var rules []string
+	for _, e := range events {
+		if e.Name == webauth.EventLogin && !e.Succeeded && strings.Contains(e.Message, " by rule ") {
+			rules = append(rules, e.Message)
+		}
+	}
+	want := []string{
+		"challenge by rule country:RU from 198.51.100.1",
+		"block by rule tor from 203.0.113.9",
+		"block by rule country:CN from 192.0.2.1",
+	}
+	if strings.Join(rules, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events = %q, want %q", rules, want)
+	}
+}
+
+func TestGeoRestrictRegister(t *testing.T) {
+	app := newAppForTest(t,
+		[]func(*webauth.Config){withMagicExpires("15m"), withGeo(webauth.ConfigGeo{Block: []string{"CN"}, Challenge: []string{"RU"}})},
+		webauth.WithDB(StoreForTest(t)), webauth.WithGeoLocator(geoForTest))
+
+	data := url.Values{
+		"username":  {"new"},
+		"fullName":  {"New User"},
+		"email":     {"new@email"},
+		"password1": {"password"},
+		"password2": {"password"},
+	}
+
+	w := geoRequest(app.RegisterHandler, "/register", "192.0.2.1", data)
+	if !strings.Contains(w.Body.String(), webauth.MsgGeoBlocked) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgGeoBlocked)
+	}
+	if exists, _ := app.DB.UserExists("new"); exists {
+		t.Error("user registered from blocked country")
+	}
+
+	// Registrations are not challenged.
+	geoRequest(app.RegisterHandler, "/register", "198.51.100.1", data)
+	if exists, _ := app.DB.UserExists("new"); !exists {
+		t.Error("user not registered from challenged country")
+	}
+}
+
+func TestGeoRestrictClientAddr(t *testing.T) {
+	app := newAppForTest(t,
+		[]func(*webauth.Config){withGeo(webauth.ConfigGeo{Block: []string{"CN"}})},
+		webauth.WithDB(StoreForTest(t)), webauth.WithGeoLocator(geoForTest))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		wantMsg    string // wantMsg is empty if the login succeeds.
+	}{
+		{name: "allowed", remoteAddr: "203.0.113.1:1234"},
+		// The header is set by the client, so cannot be trusted.
+		{name: "spoofedHeader", remoteAddr: "192.0.2.1:1234", realIP: "203.0.113.1", wantMsg: webauth.MsgGeoBlocked},
+		{name: "unknownAddr", remoteAddr: "unknown", wantMsg: webauth.MsgGeoBlocked},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := url.Values{"username": {"test"}, "password": {"password"}}
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(data.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.RemoteAddr = tc.remoteAddr
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			w := httptest.NewRecorder()
+
+			app.LoginPostHandler(w, r)
+
+			if tc.wantMsg == "" {
+				if w.Code != http.StatusSeeOther {
+					t.Errorf("got status %d, want %d", w.Code, http.StatusSeeOther)
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tc.wantMsg) {
+				t.Errorf("got body %q, expected %q in body", w.Body, tc.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+// HostCookiePrefix starts the names of the session cookies if
+// Security.Hardened is set. Browsers only accept such cookies if they are
+// Secure, have Path=/, and have no Domain, so they cannot be set by a
+// subdomain or over HTTP.
+const HostCookiePrefix = "__Host-"
+
+// ConfigSecurity holds settings to harden the app.
+type ConfigSecurity struct {
+	// Hardened adds HostCookiePrefix to the names of the login and
+	// refresh cookies, and sets Strict-Transport-Security with preload
+	// on HTTPS responses, unless HSTSMaxAge is set. Enabling it logs out
+	// existing sessions, since their cookies have the old names.
+	Hardened bool
+
+	HSTSMaxAge        string              // HSTSMaxAge sets Strict-Transport-Security, such as "8760h".
+	HSTSPreload       bool                // HSTSPreload asks to be preloaded; HSTSMaxAge must be at least a year.
+	ReferrerPolicy    string              // ReferrerPolicy, such as "strict-origin-when-cross-origin".
+	PermissionsPolicy map[string][]string // PermissionsPolicy has the allowlist of features, such as "camera": [].
+	FrameOptions      string              // FrameOptions is DENY, the default, SAMEORIGIN, or "none" to omit it.
+}
+
+// loginCookieName returns the name of the login cookie.
+func (app *AuthApp) loginCookieName() string {
+	if app.Cfg.Security.Hardened {
+		return HostCookiePrefix + LoginTokenCookieName
+	}
+	return LoginTokenCookieName
+}
+
+// refreshCookieName returns the name of the refresh cookie.
+func (app *AuthApp) refreshCookieName() string {
+	if app.Cfg.Security.Hardened {
+		return HostCookiePrefix + RefreshTokenCookieName
+	}
+	return RefreshTokenCookieName
+}
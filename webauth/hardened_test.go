@@ -0,0 +1,107 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// hardened is a config modifier that sets Security.Hardened.
+func hardened(cfg *webauth.Config) {
+	cfg.Security.Hardened = true
+}
+
+func TestHardenedCookies(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){hardened, withRefreshExpires("720h")},
+		webauth.WithDB(StoreForTest(t)))
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=test&password=password&remember=on"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	app.LoginPostHandler(w, r)
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	for _, name := range []string{webauth.LoginTokenCookieName, webauth.RefreshTokenCookieName} {
+		c := cookies[webauth.HostCookiePrefix+name]
+		if c == nil {
+			t.Fatalf("no %s%s cookie in %v", webauth.HostCookiePrefix, name, w.Result().Cookies())
+		}
+		if !c.Secure || c.Path != "/" || c.Domain != "" {
+			t.Errorf("cookie %s = %v, want Secure, Path=/, and no Domain", c.Name, c)
+		}
+		if cookies[name] != nil {
+			t.Errorf("got unprefixed %s cookie", name)
+		}
+	}
+	login := cookies[webauth.HostCookiePrefix+webauth.LoginTokenCookieName]
+
+	// userFor returns the user of a request with the login cookie named name.
+	userFor := func(name string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: name, Value: login.Value})
+		user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("UserFromRequest() failed: %v", err)
+		}
+		return user.Username
+	}
+
+	if got := userFor(login.Name); got != "test" {
+		t.Errorf("user of prefixed cookie = %q, want %q", got, "test")
+	}
+	if got := userFor(webauth.LoginTokenCookieName); got != "" {
+		t.Errorf("user of unprefixed cookie = %q, want none", got)
+	}
+
+	// Logout removes the prefixed cookies with attributes browsers accept.
+	r = httptest.NewRequest(http.MethodGet, "/logout", nil)
+	r.AddCookie(login)
+	w = httptest.NewRecorder()
+	app.LogoutHandler(w, r)
+
+	if len(w.Result().Cookies()) == 0 {
+		t.Error("logout did not remove cookies")
+	}
+	for _, c := range w.Result().Cookies() {
+		if !strings.HasPrefix(c.Name, webauth.HostCookiePrefix) || c.MaxAge >= 0 || !c.Secure || c.Path != "/" {
+			t.Errorf("logout cookie = %v, want removed prefixed cookie", c)
+		}
+	}
+}
+
+func TestStrictTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify []func(*webauth.Config)
+		want   string
+	}{
+		{"default", nil, ""},
+		{"hardened", []func(*webauth.Config){hardened}, "max-age=31536000; includeSubDomains; preload"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newAppForTest(t, tc.modify, webauth.WithDB(StoreForTest(t)))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = &tls.ConnectionState{}
+			w := httptest.NewRecorder()
+			app.SecurityHeaders(http.NotFoundHandler()).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Strict-Transport-Security"); got != tc.want {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
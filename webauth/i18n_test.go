@@ -0,0 +1,53 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestLocalizedPage(t *testing.T) {
+	catalog, err := i18n.Load(os.DirFS(filepath.Join(assets.AssetPath(), "locales")), i18n.DefaultLanguage)
+	if err != nil {
+		t.Fatalf("failed to load catalog: %v", err)
+	}
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithCatalog(catalog))
+	h := app.Catalog.Middleware(http.HandlerFunc(app.LoginPostHandler))
+
+	tests := []struct {
+		accept string
+		want   []string
+	}{
+		{"es-MX,es;q=0.9", []string{`lang="es"`, "Error al iniciar sesión.", "Contraseña (obligatoria):"}},
+		{"fr", []string{`lang="en"`, webauth.MsgLoginFailed, "Password (required):"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.accept, func(t *testing.T) {
+			body := url.Values{"username": {"test"}, "password": {"wrong"}}.Encode()
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept-Language", tc.accept)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			for _, s := range tc.want {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("expected %q in body %q", s, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Incident is an entry on the status page describing a service problem.
+type Incident struct {
+	ID       int64
+	Title    string
+	Message  string
+	Created  time.Time
+	Resolved sql.NullTime // Resolved is not valid while the incident is open.
+}
+
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// CreateIncident adds an open incident.
+func (db *AuthDB) CreateIncident(title, message string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	_, err := db.Exec("INSERT INTO incidents(title, message) VALUES (?, ?)", title, message)
+	return err
+}
+
+// ResolveIncident marks the incident with id as resolved.
+func (db *AuthDB) ResolveIncident(id int64) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	result, err := db.Exec("UPDATE incidents SET resolved = ? WHERE id = ? AND resolved IS NULL", db.now(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIncidentNotFound
+	}
+
+	return nil
+}
+
+// RecentIncidents returns incidents that are open or were created since
+// the given time, newest first.
+func (db *AuthDB) RecentIncidents(since time.Time) ([]Incident, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT id, title, message, created, resolved FROM incidents WHERE resolved IS NULL OR created >= ? ORDER BY created DESC, id DESC`
+	rows, err := db.Query(qry, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []Incident
+	for rows.Next() {
+		var i Incident
+
+		err := rows.Scan(&i.ID, &i.Title, &i.Message, &i.Created, &i.Resolved)
+		if err != nil {
+			return nil, err
+		}
+
+		incidents = append(incidents, i)
+	}
+
+	return incidents, rows.Err()
+}
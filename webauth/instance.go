@@ -0,0 +1,383 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webid"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// DefaultHeartbeatInterval is how often an instance records a heartbeat in
+// the registry.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// An instance is live until it misses this many heartbeats.
+const missedHeartbeats = 3
+
+// InstanceRetention is how long an instance stays in the registry after
+// its last heartbeat, such as one that crashed.
+const InstanceRetention = 24 * time.Hour
+
+// Maximum lengths of the fields of an Instance, matching the SQL schema.
+// Longer values are truncated.
+const (
+	MaxInstanceHostLen    = 255
+	MaxInstanceVersionLen = 64
+)
+
+// Instance is a running instance of the app in the registry.
+type Instance struct {
+	ID        string
+	Host      string
+	Version   string // Version is the VCS revision or module version.
+	Started   time.Time
+	Heartbeat time.Time // Heartbeat is when the instance was last seen.
+	Leader    bool      // Leader is true for the live instance started first.
+
+	// ConfigHash is the Config.Hash of the instance, which differs from
+	// that of other instances if their configs differ.
+	ConfigHash string
+}
+
+// ConfigDrift returns true if instances run with different configs.
+// Instances without a ConfigHash, from before it was recorded, are
+// ignored.
+func ConfigDrift(instances []Instance) bool {
+	var hash string
+	for _, inst := range instances {
+		if inst.ConfigHash == "" {
+			continue
+		}
+		if hash != "" && inst.ConfigHash != hash {
+			return true
+		}
+		hash = inst.ConfigHash
+	}
+
+	return false
+}
+
+// compareInstances orders instances by when they started, and then by id.
+func compareInstances(a, b Instance) int {
+	return cmp.Or(a.Started.Compare(b.Started), cmp.Compare(a.ID, b.ID))
+}
+
+// instanceRegistry is the state of this instance in the registry.
+type instanceRegistry struct {
+	mu       sync.Mutex
+	self     Instance      // self is this instance, once registered.
+	interval time.Duration // interval is that of the heartbeats.
+
+	running atomic.Bool // running is true once a heartbeat was recorded.
+	leader  atomic.Bool // leader is true if this instance was elected.
+	drift   atomic.Bool // drift is true if live instances have other configs.
+}
+
+// buildVersion returns the version of the binary: its VCS revision, its
+// module version, or else when it was built.
+func buildVersion(built time.Time) string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return truncate(s.Value, 12)
+			}
+		}
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			return truncate(v, MaxInstanceVersionLen)
+		}
+	}
+
+	return built.Format(webapp.BuildDateTimeFormat)
+}
+
+// Self returns this instance, with a new id on first use.
+func (app *AuthApp) Self() (Instance, error) {
+	reg := app.registry
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.self.ID != "" {
+		return reg.self, nil
+	}
+
+	id, err := webid.NewString()
+	if err != nil {
+		return Instance{}, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	var built time.Time
+	if app.WebApp != nil {
+		built = app.BuildDateTime
+	}
+
+	reg.self = Instance{
+		ID:         id,
+		Host:       truncate(host, MaxInstanceHostLen),
+		Version:    buildVersion(built),
+		Started:    app.Clock.Now().UTC(),
+		ConfigHash: app.Cfg.Hash(),
+	}
+
+	return reg.self, nil
+}
+
+// heartbeatInterval returns the interval of the heartbeats of instances.
+func (app *AuthApp) heartbeatInterval() time.Duration {
+	app.registry.mu.Lock()
+	defer app.registry.mu.Unlock()
+
+	return cmp.Or(app.registry.interval, DefaultHeartbeatInterval)
+}
+
+// LiveInstances returns the instances that have not missed a heartbeat,
+// the first started first, which is the Leader.
+func (app *AuthApp) LiveInstances() ([]Instance, error) {
+	since := app.Clock.Now().Add(-missedHeartbeats * app.heartbeatInterval())
+
+	instances, err := app.DB.Instances(since)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) > 0 {
+		instances[0].Leader = true
+	}
+
+	return instances, nil
+}
+
+// Heartbeat records that this instance is alive in the registry and
+// elects it the leader if it is the live instance started first. A
+// warning is logged when the live instances start to have different
+// configs. The leader also purges instances last seen before
+// InstanceRetention.
+func (app *AuthApp) Heartbeat(ctx context.Context) error {
+	self, err := app.Self()
+	if err != nil {
+		return err
+	}
+	self.Heartbeat = app.Clock.Now().UTC()
+
+	if err := app.DB.Heartbeat(self); err != nil {
+		return err
+	}
+
+	instances, err := app.LiveInstances()
+	if err != nil {
+		return err
+	}
+
+	leader := len(instances) > 0 && instances[0].ID == self.ID
+	if app.registry.leader.Swap(leader) != leader {
+		slog.Info("leader changed", "instance", self.ID, "leader", leader)
+	}
+	app.registry.running.Store(true)
+
+	drift := ConfigDrift(instances)
+	if app.registry.drift.Swap(drift) != drift && drift {
+		slog.Warn("instances have different configs", "instance", self.ID, "config", self.ConfigHash)
+	}
+
+	if leader {
+		if _, err := app.DB.PurgeInstances(self.Heartbeat.Add(-InstanceRetention)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsLeader returns true if this instance is the leader, which runs the
+// jobs that must run on only one instance. An app that is not running
+// RunRegistry is alone, so it is the leader.
+func (app *AuthApp) IsLeader() bool {
+	return !app.registry.running.Load() || app.registry.leader.Load()
+}
+
+// RunRegistry records a Heartbeat every interval until ctx is done. A
+// failed heartbeat is logged, and the instance stays leader, or not,
+// until a heartbeat succeeds. Use Deregister when the app shuts down so
+// that another instance can take over at once.
+func (app *AuthApp) RunRegistry(ctx context.Context, interval time.Duration) {
+	app.registry.mu.Lock()
+	app.registry.interval = interval
+	app.registry.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.Heartbeat(ctx); err != nil {
+			slog.Error("failed to record heartbeat", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deregister removes this instance from the registry, if registered.
+func (app *AuthApp) Deregister(ctx context.Context) error {
+	if !app.registry.running.Load() {
+		return nil
+	}
+	app.registry.leader.Store(false)
+
+	self, err := app.Self()
+	if err != nil {
+		return err
+	}
+
+	return app.DB.RemoveInstance(self.ID)
+}
+
+// Heartbeat saves inst in the registry, replacing the previous heartbeat
+// of the instance with its id.
+func (db *AuthDB) Heartbeat(inst Instance) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	result, err := db.Exec("UPDATE instances SET host = ?, version = ?, config_hash = ?, heartbeat = ? WHERE id = ?",
+		inst.Host, inst.Version, inst.ConfigHash, inst.Heartbeat, inst.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil || rows > 0 {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO instances(id, host, version, config_hash, started, heartbeat) VALUES (?, ?, ?, ?, ?, ?)",
+		inst.ID, inst.Host, inst.Version, inst.ConfigHash, inst.Started, inst.Heartbeat)
+
+	return err
+}
+
+// Instances returns the instances with a heartbeat at or after since, the
+// first started first.
+func (db *AuthDB) Instances(since time.Time) ([]Instance, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	rows, err := db.Query("SELECT id, host, version, config_hash, started, heartbeat FROM instances WHERE heartbeat >= ? ORDER BY started, id", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []Instance
+	for rows.Next() {
+		var inst Instance
+		if err := rows.Scan(&inst.ID, &inst.Host, &inst.Version, &inst.ConfigHash, &inst.Started, &inst.Heartbeat); err != nil {
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+
+	return instances, rows.Err()
+}
+
+// RemoveInstance removes the instance with id from the registry.
+func (db *AuthDB) RemoveInstance(id string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	_, err := db.Exec("DELETE FROM instances WHERE id = ?", id)
+
+	return err
+}
+
+// PurgeInstances removes the instances with a heartbeat before before and
+// returns the number removed.
+func (db *AuthDB) PurgeInstances(before time.Time) (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	result, err := db.Exec("DELETE FROM instances WHERE heartbeat < ?", before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+// InstancesPageData contains data passed to the HTML template.
+type InstancesPageData struct {
+	CommonData
+	User      User
+	Self      string        // Self is the id of the instance that served the page.
+	Interval  time.Duration // Interval is that of the heartbeats.
+	Drift     bool          // Drift is true if the instances have different configs.
+	Instances []Instance
+}
+
+// InstancesHandler shows an admin the live instances of the app, their
+// versions, and their last heartbeat, with a warning if their configs
+// differ.
+func (app *AuthApp) InstancesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	if !user.Can(PermViewInstances) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	instances, err := app.LiveInstances()
+	if err != nil {
+		logger.Error("failed to get instances", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := &InstancesPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Interval:   app.heartbeatInterval(),
+		Drift:      ConfigDrift(instances),
+		Instances:  instances,
+	}
+	if self, err := app.Self(); err == nil && app.registry.running.Load() {
+		data.Self = self.ID
+	}
+
+	app.RenderPage(w, r, logger, "instances.html", data)
+
+	logger.Info("done")
+}
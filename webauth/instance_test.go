@@ -0,0 +1,219 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestHeartbeatLeader(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	// Two instances share the store, and first starts first.
+	store := StoreForTest(t)
+	first := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+	second := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	// An instance not in the registry runs alone.
+	if !first.IsLeader() || !second.IsLeader() {
+		t.Error("IsLeader() = false before heartbeat, want true")
+	}
+
+	heartbeat := func(app *webauth.AuthApp) {
+		t.Helper()
+		if err := app.Heartbeat(ctx); err != nil {
+			t.Fatalf("Heartbeat() failed: %v", err)
+		}
+	}
+
+	heartbeat(first)
+	clock.Advance(time.Second)
+	heartbeat(second)
+
+	if !first.IsLeader() {
+		t.Error("first IsLeader() = false, want true")
+	}
+	if second.IsLeader() {
+		t.Error("second IsLeader() = true, want false")
+	}
+
+	instances, err := second.LiveInstances()
+	if err != nil {
+		t.Fatalf("LiveInstances() failed: %v", err)
+	}
+	self, _ := first.Self()
+	if len(instances) != 2 || instances[0].ID != self.ID || !instances[0].Leader || instances[1].Leader {
+		t.Errorf("LiveInstances() = %+v, want first as leader of 2", instances)
+	}
+
+	// The second takes over once the first misses its heartbeats.
+	clock.Advance(time.Minute)
+	heartbeat(second)
+	if !second.IsLeader() {
+		t.Error("second IsLeader() = false after first stopped, want true")
+	}
+
+	// And after the first leaves the registry.
+	heartbeat(first)
+	heartbeat(second)
+	if second.IsLeader() {
+		t.Error("second IsLeader() = true after first returned, want false")
+	}
+	if err := first.Deregister(ctx); err != nil {
+		t.Fatalf("Deregister() failed: %v", err)
+	}
+	if first.IsLeader() {
+		t.Error("first IsLeader() = true after Deregister, want false")
+	}
+	heartbeat(second)
+	if !second.IsLeader() {
+		t.Error("second IsLeader() = false after first left, want true")
+	}
+}
+
+func TestHeartbeatPurge(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	old := webauth.Instance{ID: "old", Started: clock.Now(), Heartbeat: clock.Now().Add(-webauth.InstanceRetention - time.Second)}
+	if err := store.Heartbeat(old); err != nil {
+		t.Fatalf("Heartbeat() failed: %v", err)
+	}
+
+	if err := app.Heartbeat(context.Background()); err != nil {
+		t.Fatalf("Heartbeat() failed: %v", err)
+	}
+
+	instances, err := store.Instances(time.Time{})
+	if err != nil || len(instances) != 1 || instances[0].ID == "old" {
+		t.Errorf("Instances() = %+v, %v, want only this instance", instances, err)
+	}
+}
+
+func TestMaintenanceFollower(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+	store := StoreForTest(t)
+	leader := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+	follower := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	for _, app := range []*webauth.AuthApp{leader, follower} {
+		if err := app.Heartbeat(context.Background()); err != nil {
+			t.Fatalf("Heartbeat() failed: %v", err)
+		}
+		clock.Advance(time.Second)
+	}
+
+	if _, err := store.CountRequest("user:a", clock.Now().Add(-2*webauth.RateLimitHistory)); err != nil {
+		t.Fatalf("CountRequest() failed: %v", err)
+	}
+
+	// The lock is free, but the follower does not run shared tasks.
+	follower.RunMaintenanceOnce(context.Background(), time.Hour)
+	if usage, _ := store.RateLimitUsage(time.Time{}); len(usage) != 1 {
+		t.Errorf("RateLimitUsage() = %v after follower maintenance, want count kept", usage)
+	}
+
+	leader.RunMaintenanceOnce(context.Background(), time.Hour)
+	if usage, _ := store.RateLimitUsage(time.Time{}); len(usage) != 0 {
+		t.Errorf("RateLimitUsage() = %v after leader maintenance, want count purged", usage)
+	}
+}
+
+func TestInstancesHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	w := requestAs(app.InstancesHandler, adminToken.Value, http.MethodGet, "/instances", "")
+	if !strings.Contains(w.Body.String(), "No live instances.") {
+		t.Errorf("body does not report no instances:\n%s", w.Body.String())
+	}
+
+	if err := app.Heartbeat(context.Background()); err != nil {
+		t.Fatalf("Heartbeat() failed: %v", err)
+	}
+	self, _ := app.Self()
+
+	w = requestAs(app.InstancesHandler, userToken.Value, http.MethodGet, "/instances", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status for user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = requestAs(app.InstancesHandler, adminToken.Value, http.MethodGet, "/instances", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status for admin = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{self.ID + " (this instance)", self.Version, "<td>Leader</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestConfigDrift(t *testing.T) {
+	ctx := context.Background()
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+	same := newAppForTest(t, nil, webauth.WithDB(store))
+
+	for _, app := range []*webauth.AuthApp{app, same} {
+		if err := app.Heartbeat(ctx); err != nil {
+			t.Fatalf("Heartbeat() failed: %v", err)
+		}
+	}
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	drift := func() bool {
+		t.Helper()
+		w := requestAs(app.InstancesHandler, adminToken.Value, http.MethodGet, "/instances", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		return strings.Contains(w.Body.String(), "Config drift")
+	}
+
+	if drift() {
+		t.Error("page warns of drift for instances with the same config")
+	}
+
+	other := newAppForTest(t, []func(*webauth.Config){func(c *webauth.Config) { c.Auth.LoginExpires = "1h" }}, webauth.WithDB(store))
+	if err := other.Heartbeat(ctx); err != nil {
+		t.Fatalf("Heartbeat() failed: %v", err)
+	}
+
+	if !drift() {
+		t.Error("page does not warn of drift for instances with different configs")
+	}
+}
+
+func TestConfigDriftIgnoresUnknown(t *testing.T) {
+	instances := []webauth.Instance{{ConfigHash: "a"}, {}, {ConfigHash: "a"}}
+	if webauth.ConfigDrift(instances) {
+		t.Errorf("ConfigDrift(%v) = true, want false", instances)
+	}
+
+	instances = append(instances, webauth.Instance{ConfigHash: "b"})
+	if !webauth.ConfigDrift(instances) {
+		t.Errorf("ConfigDrift(%v) = false, want true", instances)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/websse"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// MaxLiveRows is the maximum number of rows that a page adds from the live
+// stream, or holds while paused, before it drops the oldest.
+const MaxLiveRows = 500
+
+// WithLive returns an Option to publish new events and registrations to s,
+// so the events and users pages of an admin are updated without a refresh.
+// The websse events are named for the table, i.e., "events" and "users".
+func WithLive(s *websse.Server) Option {
+	return func(a *AuthApp) {
+		a.Live = s
+	}
+}
+
+// liveStore is an AuthStore that publishes the rows of new events and
+// registrations to live.
+type liveStore struct {
+	AuthStore
+	live  websse.Publisher
+	clock Clock
+	tz    *webutil.TimeZones
+}
+
+// newLiveStore returns db wrapped to publish with pub to live, which has
+// the events for the tables registered.
+func newLiveStore(db AuthStore, live *websse.Server, pub websse.Publisher, clock Clock, tz *webutil.TimeZones) *liveStore {
+	live.RegisterEvents(EventsTable.Name, UsersTable.Name)
+
+	return &liveStore{AuthStore: db, live: pub, clock: clock, tz: tz}
+}
+
+// publisher returns the Publisher of app.Live, which also relays messages
+// to other instances if Config.Redis is set.
+func (app *AuthApp) publisher() websse.Publisher {
+	if app.broker != nil {
+		return app.broker
+	}
+
+	return app.Live
+}
+
+// WriteEvent writes the event and publishes it, like RecordEvent.
+func (s *liveStore) WriteEvent(name EventName, succeeded bool, username, message string) error {
+	return s.RecordEvent(Event{Name: name, Succeeded: succeeded, Username: username, Message: message})
+}
+
+// RecordEvent records e and publishes it. A registration is also published
+// as a new user.
+func (s *liveStore) RecordEvent(e Event) error {
+	err := s.AuthStore.RecordEvent(e)
+	if err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+
+	e.Created = now
+	row := liveRow(EventsTable, e, eventColumn)
+	row["created"] = s.tz.LocalTime(now).Format("2006-01-02 03:04 PM MST")
+	s.publish(EventsTable, row)
+
+	if e.Name == EventRegister && e.Succeeded {
+		user, err := s.AuthStore.UserForName(e.Username)
+		if err != nil {
+			slog.Warn("failed to get registered user", "username", e.Username, "err", err)
+			return nil
+		}
+		user.Created = now
+
+		row := liveRow(UsersTable, user, userColumn(nil))
+		row["created"] = now.Format("2006-01-02 03:04 PM")
+		s.publish(UsersTable, row)
+	}
+
+	return nil
+}
+
+// publish sends row to the clients of t. Messages are dropped instead of
+// delaying the request if the live server is busy.
+func (s *liveStore) publish(t Table, row map[string]string) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		slog.Error("failed to marshal live row", "table", t.Name, "err", err)
+		return
+	}
+
+	err = s.live.TryPublish(websse.Message{Event: t.Name, Data: string(data)})
+	if err != nil {
+		slog.Warn("failed to publish live row", "table", t.Name, "err", err)
+	}
+}
+
+// liveRow returns the value of each column of t for row, keyed by the
+// column name.
+func liveRow[T any](t Table, row T, value func(row T, col string) string) map[string]string {
+	m := make(map[string]string, len(t.Columns))
+	for _, c := range t.Columns {
+		m[c.Name] = value(row, c.Name)
+	}
+
+	return m
+}
+
+// LiveHandler streams the new rows of the table named by the event query
+// parameter to an admin. It responds with http.StatusNotFound if the app
+// has no Live server.
+func (app *AuthApp) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	if app.Live == nil {
+		logger.Warn("live updates not enabled")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	t, ok := tables[r.URL.Query().Get("event")]
+	if !ok {
+		logger.Warn("unknown table")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	if !user.Can(t.Perm) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	// The stream stays open longer than the WriteTimeout of the server.
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		logger.Warn("failed to clear write deadline", "err", err)
+	}
+
+	app.Live.EventStreamHandler(w, r)
+}
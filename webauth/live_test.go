@@ -0,0 +1,134 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/websse"
+)
+
+func TestLiveHandlerErrors(t *testing.T) {
+	noLive := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+	live := websse.NewServer()
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithLive(live))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		h          http.HandlerFunc
+		token      string
+		target     string
+		wantStatus int
+	}{
+		{"notEnabled", noLive.LiveHandler, "", "/live?event=events", http.StatusNotFound},
+		{"notAdmin", app.LiveHandler, userToken.Value, "/live?event=events", http.StatusUnauthorized},
+		{"unknownTable", app.LiveHandler, adminToken.Value, "/live?event=secrets", http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(tc.h, tc.token, http.MethodGet, tc.target, "")
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestLiveStream(t *testing.T) {
+	live := websse.NewServer()
+	live.Run()
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithLive(live))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(app.LiveHandler))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := func(event string) *bufio.Scanner {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/live?event="+event, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: adminToken.Value})
+
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("could not get stream: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+
+		return bufio.NewScanner(resp.Body)
+	}
+
+	events := stream("events")
+	users := stream("users")
+
+	// Wait for both clients to be added before publishing.
+	for live.ClientCount() < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("clients not added")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	err = app.DB.WriteEvent(webauth.EventRegister, true, "test", "registered")
+	if err != nil {
+		t.Fatalf("WriteEvent failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		scanner *bufio.Scanner
+		want    []string
+	}{
+		{"events", events, []string{"event: events", `"name":"register"`, `"succeeded":"true"`, `"username":"test"`}},
+		{"users", users, []string{"event: users", `"username":"test"`, `"admin":"false"`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var msg string
+			for tc.scanner.Scan() {
+				line := tc.scanner.Text()
+				if line == "" && msg != "" {
+					break
+				}
+				msg += line + "\n"
+			}
+
+			for _, want := range tc.want {
+				if !strings.Contains(msg, want) {
+					t.Errorf("message %q does not contain %q", msg, want)
+				}
+			}
+		})
+	}
+}
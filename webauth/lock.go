@@ -0,0 +1,99 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// leases are locks held in memory until they expire.
+type leases struct {
+	mu    sync.Mutex
+	until map[string]time.Time // until is when each lock expires.
+}
+
+// try acquires the lock of name from now until ttl later and returns true,
+// or returns false if it is held.
+func (l *leases) try(name string, now time.Time, ttl time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.until[name]) {
+		return false
+	}
+	if l.until == nil {
+		l.until = make(map[string]time.Time)
+	}
+	l.until[name] = now.Add(ttl)
+
+	return true
+}
+
+// TryLock acquires the lock of name for ttl and returns true, or returns
+// false if it is held.
+func (m *MemStore) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return m.locks.try(name, m.now(), ttl), nil
+}
+
+// lockKey returns the key of the Postgres advisory lock of name.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("webauth:" + name))
+
+	return int64(h.Sum64())
+}
+
+// TryLock acquires the lock of name for ttl and returns true, or returns
+// false if another session holds it.
+//
+// MySQL and Postgres use an advisory lock held by a connection of db until
+// ttl expires, so each lock held takes a connection from the pool. SQLite
+// has no advisory locks, so the lock is only held by db, which is enough
+// for a database used by one process.
+func (db *AuthDB) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	var (
+		key          any
+		lock, unlock string
+	)
+	switch db.Dialect {
+	case DialectSQLite:
+		return db.locks.try(name, db.now(), ttl), nil
+	case DialectPostgres:
+		key = lockKey(name)
+		lock, unlock = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+	default:
+		// Names of MySQL locks are limited to 64 characters.
+		if len(name) > 56 {
+			name = Hash(name)[:56]
+		}
+		key = "webauth:" + name
+		lock, unlock = "SELECT GET_LOCK(?, 0)", "SELECT RELEASE_LOCK(?)"
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	// GET_LOCK returns NULL on error, which is not acquired.
+	var acquired sql.NullBool
+	if err := conn.QueryRowContext(ctx, lock, key).Scan(&acquired); err != nil || !acquired.Bool {
+		conn.Close()
+		return false, err
+	}
+
+	time.AfterFunc(ttl, func() {
+		if _, err := conn.ExecContext(context.Background(), unlock, key); err != nil {
+			slog.Warn("failed to release lock", "name", name, "err", err)
+		}
+		conn.Close()
+	})
+
+	return true, nil
+}
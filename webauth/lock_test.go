@@ -0,0 +1,84 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestMemStoreTryLock(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+	store := webauth.NewMemStore()
+	store.SetClock(clock)
+	ctx := context.Background()
+
+	tryLock := func(name string, want bool) {
+		t.Helper()
+		if got, err := store.TryLock(ctx, name, time.Minute); err != nil || got != want {
+			t.Errorf("TryLock(%q) = %v, %v, want %v, nil", name, got, err, want)
+		}
+	}
+
+	tryLock("job", true)
+	tryLock("job", false)
+	tryLock("other", true)
+
+	clock.Advance(time.Minute)
+	tryLock("job", true)
+}
+
+func TestRunMaintenanceOnce(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+
+	// Two instances share the store.
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+	other := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	// purged returns true if a rate limit count is purged by run.
+	purged := func(run *webauth.AuthApp) bool {
+		t.Helper()
+		if _, err := store.CountRequest("user:a", clock.Now().Add(-2*webauth.RateLimitHistory)); err != nil {
+			t.Fatalf("CountRequest() failed: %v", err)
+		}
+		run.RunMaintenanceOnce(context.Background(), time.Hour)
+		usage, err := store.RateLimitUsage(time.Time{})
+		if err != nil {
+			t.Fatalf("RateLimitUsage() failed: %v", err)
+		}
+		return len(usage) == 0
+	}
+
+	if !purged(app) {
+		t.Error("first run did not purge rate limits")
+	}
+	if purged(other) {
+		t.Error("other instance purged rate limits in the same interval")
+	}
+
+	clock.Advance(time.Hour)
+	if !purged(other) {
+		t.Error("other instance did not purge rate limits in the next interval")
+	}
+}
+
+func TestRedisTryLock(t *testing.T) {
+	_, useRedis := redisForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){useRedis}, webauth.WithDB(StoreForTest(t)))
+	other := newAppForTest(t, []func(*webauth.Config){useRedis}, webauth.WithDB(StoreForTest(t)))
+	ctx := context.Background()
+
+	if got, err := app.DB.TryLock(ctx, "job", time.Minute); err != nil || !got {
+		t.Errorf("TryLock() = %v, %v, want true, nil", got, err)
+	}
+
+	// The lock is held in Redis rather than in the store of each instance.
+	if got, err := other.DB.TryLock(ctx, "job", time.Minute); err != nil || got {
+		t.Errorf("TryLock() of other instance = %v, %v, want false, nil", got, err)
+	}
+}
@@ -3,11 +3,26 @@
 
 package webauth
 
+import "log/slog"
+
 const LoginTokenSize = 32
 const LoginTokenKind = "login"
 
-// CreateLoginToken creates a login token for username.
+// CreateLoginToken creates a login token for username. ErrUserDisabled is
+// returned if the user is disabled and ErrUserWaitlisted if the user is
+// waiting for approval.
 func (app *AuthApp) CreateLoginToken(username string) (Token, error) {
+	user, err := app.DB.UserForName(username)
+	if err != nil {
+		return Token{}, err
+	}
+	if user.Disabled {
+		return Token{}, ErrUserDisabled
+	}
+	if user.Waitlisted {
+		return Token{}, ErrUserWaitlisted
+	}
+
 	token, err := app.DB.CreateToken(LoginTokenKind, username, LoginTokenSize, app.Cfg.Auth.LoginExpires)
 	if err != nil {
 		return Token{}, err
@@ -20,18 +35,58 @@ func (app *AuthApp) CreateLoginToken(username string) (Token, error) {
 func (app *AuthApp) LoginUser(username, password string) (Token, error) {
 	db := app.DB
 
-	err := db.CheckPassword(username, password)
+	// Accept a username changed within the grace period.
+	username, err := app.ResolveUsername(username)
 	if err != nil {
-		db.WriteEvent(EventLogin, false, username, err.Error())
+		db.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
+		return Token{}, err
+	}
+
+	err = app.checkPassword(username, password)
+	if err != nil {
+		db.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
 		return Token{}, err
 	}
 
 	token, err := app.CreateLoginToken(username)
 	if err != nil {
-		db.WriteEvent(EventLogin, false, username, err.Error())
+		db.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
 		return Token{}, err
 	}
 
-	db.WriteEvent(EventLogin, true, username, "logged in user")
+	app.rehashPassword(username, password)
+
+	db.RecordEvent(NewEvent(TypeLoginPassword, username, nil))
 	return token, nil
 }
+
+// rehashPassword hashes password again if the hash of username was not
+// created by app.Hasher, e.g., after the algorithm or cost is changed.
+// Errors are logged, since the login has already succeeded.
+func (app *AuthApp) rehashPassword(username, password string) {
+	logger := slog.With("username", username)
+
+	hashedPassword, err := app.DB.HashedPassword(username)
+	if err != nil {
+		logger.Error("failed to get hashed password", "err", err)
+		return
+	}
+
+	if !app.Hasher.NeedsRehash(hashedPassword) {
+		return
+	}
+
+	hashedPassword, err = app.Hasher.Hash(password)
+	if err != nil {
+		logger.Error("failed to hash password", "err", err)
+		return
+	}
+
+	err = app.DB.SetHashedPassword(username, hashedPassword)
+	if err != nil {
+		logger.Error("failed to save rehashed password", "err", err)
+		return
+	}
+
+	logger.Info("rehashed password")
+}
@@ -4,11 +4,13 @@
 package webauth
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/bnixon67/webapp/audit"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
@@ -19,7 +21,9 @@ const LoginPageName = "login.html"
 // LoginPageData contains data passed to the login HTML template.
 type LoginPageData struct {
 	CommonData
-	Message string
+	Message   string
+	Providers []OAuthProvider // Providers are the OAuth login providers.
+	Magic     bool            // Magic is true if login links are enabled.
 }
 
 // LoginGetHandler handles login GET requests.
@@ -31,7 +35,8 @@ func (app *AuthApp) LoginGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.RenderPage(w, logger, LoginPageName, &LoginPageData{})
+	data := LoginPageData{Providers: app.OAuthProviders(), Magic: app.magicExpires != 0}
+	app.RenderPage(w, r, logger, LoginPageName, &data)
 }
 
 const (
@@ -39,6 +44,7 @@ const (
 	MsgMissingUsername            = "Missing username."
 	MsgMissingPassword            = "Missing password."
 	MsgLoginFailed                = "Login failed."
+	MsgUserWaitlisted             = "Your account is waiting for approval. You will get an email once it is approved."
 )
 
 type loginForm struct {
@@ -51,10 +57,15 @@ type loginForm struct {
 // parseLoginForm extracts and validates the login form fields.
 // loginForm.Message will contain any errors related to the validation.
 func parseLoginForm(r *http.Request) loginForm {
+	return newLoginForm(r.PostFormValue("username"), r.PostFormValue("password"), r.PostFormValue("remember"))
+}
+
+// newLoginForm returns a validated loginForm with the given values.
+func newLoginForm(username, password, remember string) loginForm {
 	form := loginForm{
-		Username: strings.TrimSpace(r.PostFormValue("username")),
-		Password: strings.TrimSpace(r.PostFormValue("password")),
-		Remember: r.PostFormValue("remember"),
+		Username: strings.TrimSpace(username),
+		Password: strings.TrimSpace(password),
+		Remember: remember,
 	}
 
 	// Check for missing values.
@@ -70,7 +81,8 @@ func parseLoginForm(r *http.Request) loginForm {
 	return form
 }
 
-// LoginCookie creates and return a login cookie.
+// LoginCookie creates and return a login cookie for the whole site,
+// regardless of the path of the request that sets it.
 func LoginCookie(value string, expires time.Time, remember bool) *http.Cookie {
 	if !remember {
 		expires = time.Time{}
@@ -79,6 +91,7 @@ func LoginCookie(value string, expires time.Time, remember bool) *http.Cookie {
 	return &http.Cookie{
 		Name:     LoginTokenCookieName,
 		Value:    value,
+		Path:     "/",
 		Expires:  expires,
 		Secure:   true,
 		HttpOnly: true,
@@ -86,7 +99,80 @@ func LoginCookie(value string, expires time.Time, remember bool) *http.Cookie {
 	}
 }
 
-// LoginPostHandler handles login POST requests.
+// login logs in the user of the validated form of r and returns the
+// session. If the login fails, it returns the HTTP status and the message
+// for the user. It is shared by the HTML and JSON handlers.
+func (app *AuthApp) login(logger *slog.Logger, r *http.Request, form loginForm) (session, int, string) {
+	if form.Message != "" {
+		logger.Error("missing form values",
+			slog.String("message", form.Message))
+		return session{}, http.StatusBadRequest, form.Message
+	}
+
+	switch app.geoRestrict(logger, r, EventLogin, form.Username, true) {
+	case GeoBlock:
+		return session{}, http.StatusForbidden, MsgGeoBlocked
+	case GeoChallenge:
+		return app.loginChallenge(logger, r, form)
+	}
+
+	switch app.assessRisk(logger, r, EventLogin, form.Username, true) {
+	case RiskDeny:
+		return session{}, http.StatusForbidden, MsgRiskDenied
+	case RiskChallenge:
+		return app.loginChallenge(logger, r, form)
+	}
+
+	token, err := app.LoginUser(form.Username, form.Password)
+	app.Audit(r, audit.Entry{Actor: form.Username, Action: AuditLogin, Result: audit.ResultOf(err == nil)})
+	if errors.Is(err, ErrUserWaitlisted) {
+		// The password was checked, so this does not reveal the account.
+		logger.Warn("user waitlisted", "username", form.Username)
+		return session{}, http.StatusForbidden, MsgUserWaitlisted
+	}
+	if err != nil {
+		logger.Error("failed to login user", "err", err)
+		return session{}, http.StatusUnauthorized, MsgLoginFailed
+	}
+
+	s, err := app.newSession(token, form.Remember == "on")
+	if err != nil {
+		logger.Error("failed to create session", "err", err)
+		return session{}, http.StatusInternalServerError, MsgLoginFailed
+	}
+
+	return s, http.StatusOK, ""
+}
+
+// loginChallenge checks the password of the form of r and, instead of
+// logging in the user, sends a login link to their email. It returns the
+// HTTP status and the message for the user, like login.
+func (app *AuthApp) loginChallenge(logger *slog.Logger, r *http.Request, form loginForm) (session, int, string) {
+	username, err := app.ResolveUsername(form.Username)
+	if err == nil {
+		err = app.checkPassword(username, form.Password)
+	}
+	if err != nil {
+		logger.Error("failed to login user", "err", err)
+		app.DB.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
+		return session{}, http.StatusUnauthorized, MsgLoginFailed
+	}
+
+	user, err := app.DB.UserForName(username)
+	if err == nil {
+		err = app.sendMagicLink(r.Context(), user.Email)
+	}
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
+		logger.Error("failed to send login link", "err", err)
+		return session{}, http.StatusInternalServerError, MsgLoginFailed
+	}
+
+	return session{}, http.StatusForbidden, MsgGeoChallenge
+}
+
+// LoginPostHandler handles login POST requests. It responds with JSON,
+// like APILoginHandler, if requested by the Accept header, and also sets
+// the login cookie.
 func (app *AuthApp) LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
@@ -105,28 +191,26 @@ func (app *AuthApp) LoginPostHandler(w http.ResponseWriter, r *http.Request) {
 		),
 	)
 
-	if form.Message != "" {
-		logger.Error("missing form values",
-			slog.String("message", form.Message))
-
-		data := LoginPageData{Message: form.Message}
-		app.RenderPage(w, logger, LoginPageName, &data)
+	s, status, msg := app.login(logger, r, form)
 
+	if webutil.WantsJSON(r) {
+		if msg != "" {
+			respondAPIError(w, logger, status, msg)
+			return
+		}
+		app.setSessionCookies(w, s)
+		respondAPILogin(w, logger, s)
 		return
 	}
 
-	token, err := app.LoginUser(form.Username, form.Password)
-	if err != nil {
-		logger.Error("failed to login user", "err", err)
-
-		data := LoginPageData{Message: MsgLoginFailed}
-		app.RenderPage(w, logger, LoginPageName, &data)
+	if msg != "" {
+		data := LoginPageData{Message: msg, Providers: app.OAuthProviders(), Magic: app.magicExpires != 0}
+		app.RenderPage(w, r, logger, LoginPageName, &data)
 
 		return
 	}
 
-	cookie := LoginCookie(token.Value, token.Expires, form.Remember == "on")
-	http.SetCookie(w, cookie)
+	app.setSessionCookies(w, s)
 
 	redirect := r.URL.Query().Get("r")
 	if redirect == "" || !webutil.IsLocalSafeURL(redirect) {
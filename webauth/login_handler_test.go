@@ -4,15 +4,11 @@
 package webauth_test
 
 import (
-	"bytes"
-	"html/template"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/bnixon67/webapp/assets"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/google/go-cmp/cmp"
@@ -20,20 +16,7 @@ import (
 )
 
 func loginBody(data webauth.LoginPageData) string {
-	// Get path to template file.
-	assetDir := assets.AssetPath()
-	tmplFile := filepath.Join(assetDir, "tmpl", "login.html")
-
-	// Parse the HTML template from a file.
-	tmpl := template.Must(template.ParseFiles(tmplFile))
-
-	// Create a buffer to store the rendered HTML.
-	var body bytes.Buffer
-
-	// Execute the template with the data and write result to the buffer.
-	tmpl.Execute(&body, data)
-
-	return body.String()
+	return renderForTest("login.html", data)
 }
 
 func TestLoginGetHandler(t *testing.T) {
@@ -4,8 +4,10 @@
 package webauth
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/bnixon67/webapp/audit"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
@@ -27,44 +29,56 @@ func (app *AuthApp) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.DB.UserFromRequest(w, r)
+	user, err := app.UserFromRequest(w, r)
 	if err != nil {
 		logger.Error("failed to GetUser", "err", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	// Create an empty loginToken cookie with negative MaxAge to delete.
-	http.SetCookie(w,
-		&http.Cookie{
-			Name: LoginTokenCookieName, Value: "", MaxAge: -1,
-		})
+	app.clearLoginCookie(w)
 
 	// Get loginToken to remove.
-	loginTokenValue, err := CookieValue(r, LoginTokenCookieName)
+	loginTokenValue, _, err := app.loginCookieToken(r)
+	if errors.Is(err, ErrCookieTooOld) || errors.Is(err, ErrCookieTooNew) {
+		loginTokenValue, err = "", nil
+	}
 	if err != nil {
 		logger.Error("failed to GetCookieValue", "err", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
 	// Remove login token from database.
 	// TODO: consider removing all logins for user
 	if loginTokenValue != "" {
+		app.forgetSession(loginTokenValue)
 		err := app.DB.RemoveToken(LoginTokenKind, loginTokenValue)
 		if err != nil {
 			logger.Error("failed to RemoveToken",
 				"loginTokenValue", loginTokenValue,
 				"err", err)
 			// TODO: display error or just continue?
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	// Revoke the refresh token, so the session cannot be renewed.
+	if refresh := app.refreshCookieToken(r); refresh != "" {
+		app.clearRefreshCookie(w)
+		err := app.DB.RemoveToken(RefreshTokenKind, refresh)
+		if err != nil && !errors.Is(err, ErrTokenNotFound) {
+			logger.Error("failed to remove refresh token", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
 			return
 		}
 	}
 
 	// Render page.
-	app.RenderPage(w, logger, "logout.html", &LogoutPageData{})
+	app.RenderPage(w, r, logger, "logout.html", &LogoutPageData{})
 
 	logger.Info("logged out", "user", user)
-	app.DB.WriteEvent(EventLogout, true, user.Username, "logged out user")
+	app.DB.RecordEvent(NewEvent(TypeLogout, user.Username, nil))
+	app.Audit(r, audit.Entry{Actor: user.Username, Action: AuditLogout, Result: audit.Success})
 }
@@ -0,0 +1,241 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	MagicTokenKind = "magiclink"
+	MagicTokenSize = 32
+	MagicTmpl      = "magic.html"
+)
+
+const (
+	MsgMagicInvalid = "The login link is invalid, expired, or was already used."
+	MsgMagicFailed  = "Unable to login with the link."
+)
+
+var (
+	ErrMagicTokenNotFound = errors.New("magic link token not found")
+	ErrMagicTokenExpired  = errors.New("magic link token expired")
+)
+
+// MagicPageData contains data passed to the HTML template.
+type MagicPageData struct {
+	CommonData
+	Message   string
+	Token     string // Token is the token of a login link to confirm.
+	EmailFrom string // EmailFrom is set after a link is sent.
+}
+
+// UsernameForMagicToken returns the username for a magic link token.
+//
+// If token is not found, ErrMagicTokenNotFound is returned.
+//
+// If token is expired, ErrMagicTokenExpired is returned and token is removed.
+func (db *AuthDB) UsernameForMagicToken(tokenValue string) (string, error) {
+	var username string
+	var expires time.Time
+
+	qry := `SELECT users.username, tokens.expires FROM tokens JOIN users ON tokens.user_id = users.id WHERE kind = ? AND hashedValue = ? LIMIT 1`
+	err := db.QueryRow(qry, MagicTokenKind, Hash(tokenValue)).Scan(&username, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMagicTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Check if token is expired.
+	if expires.Before(db.now()) {
+		db.RemoveToken(MagicTokenKind, tokenValue)
+		return "", ErrMagicTokenExpired
+	}
+
+	return username, nil
+}
+
+// Template for the email with a login link.
+const emailMagicTemplate = `
+To login to {{.Title}}, please visit {{.BaseURL}}/magic?mtoken={{.Token.Value}} by {{.Token.Expires.Format "January 2, 2006 3:04 PM MST"}}.
+
+The link can only be used once. You can ignore this message if you did not request a login link for {{.Title}}.
+`
+
+// sendMagicLink sends a login link to email. If email is not registered,
+// the email says so instead, like the forgot emails.
+func (app *AuthApp) sendMagicLink(ctx context.Context, email string) error {
+	cfg := app.Cfg
+	subj := app.Printer(ctx).T("%s login link", cfg.App.Name)
+
+	username, err := app.DB.UsernameForEmail(email)
+	if err != nil || username == "" {
+		slog.Warn("failed to get username from email", "err", err, "email", email)
+	}
+
+	var body string
+	if username == "" {
+		body, err = app.emailBody(ctx, "notregistered", emailNotRegisteredTemplate,
+			emailData{Email: email, Title: cfg.App.Name, BaseURL: cfg.Auth.BaseURL})
+	} else {
+		var token Token
+		token, err = app.DB.CreateToken(MagicTokenKind, username, MagicTokenSize, cfg.Auth.MagicExpires)
+		if err != nil {
+			return err
+		}
+		body, err = app.emailBody(ctx, "magic", emailMagicTemplate,
+			emailData{Token: token, Title: cfg.App.Name, BaseURL: cfg.Auth.BaseURL})
+	}
+	if err != nil {
+		return err
+	}
+
+	return app.sendEmail(ctx, email, subj, body, nil)
+}
+
+// useMagicToken returns the username of the magic link token and removes
+// it, so that it can only be used once.
+func (app *AuthApp) useMagicToken(tokenValue string) (string, error) {
+	username, err := app.DB.UsernameForMagicToken(tokenValue)
+	if err != nil {
+		return "", err
+	}
+
+	// Only one request can remove the token.
+	err = app.DB.RemoveToken(MagicTokenKind, tokenValue)
+	if errors.Is(err, ErrTokenNotFound) {
+		return "", ErrMagicTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return username, nil
+}
+
+// MagicHandler handles /magic requests to login with a link sent by
+// email, if Config.Auth.MagicExpires is set.
+//
+// A GET without a token shows a form to send a link. A GET with a token,
+// from the link, shows a button to login, so that a link opened by an
+// email scanner is not used. A POST sends a link or, with a token, logs
+// in the user.
+func (app *AuthApp) MagicHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.magicGet, Post: app.magicPost}.ServeHTTP(w, r)
+}
+
+// magicGet serves the form to send a login link or, with a token, to
+// login.
+func (app *AuthApp) magicGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !app.magicEnabled(w, r, logger) {
+		return
+	}
+
+	data := MagicPageData{Token: r.URL.Query().Get("mtoken")}
+	app.RenderPage(w, r, logger, MagicTmpl, &data)
+}
+
+// magicPost sends a login link or, with a token, logs in the user.
+func (app *AuthApp) magicPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !app.magicEnabled(w, r, logger) {
+		return
+	}
+
+	// A login link answers a challenge, so only blocks apply.
+	if app.geoRestrict(logger, r, EventLogin, "", false) == GeoBlock {
+		app.RenderPage(w, r, logger, MagicTmpl, &MagicPageData{Message: MsgGeoBlocked})
+		return
+	}
+
+	if r.PostFormValue("mtoken") != "" {
+		app.magicLogin(w, r, logger)
+		return
+	}
+	app.magicSend(w, r, logger)
+}
+
+// magicEnabled returns true if login links are enabled. If not, an error
+// is written.
+func (app *AuthApp) magicEnabled(w http.ResponseWriter, r *http.Request, logger *slog.Logger) bool {
+	if app.magicExpires == 0 {
+		logger.Warn("login links not enabled")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return false
+	}
+
+	return true
+}
+
+// magicSend sends a login link to the email of the form.
+func (app *AuthApp) magicSend(w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	logger = logger.With(slog.String("email", email))
+
+	if email == "" {
+		logger.Warn("missing email")
+		app.RenderPage(w, r, logger, MagicTmpl, &MagicPageData{Message: MsgMissingEmail})
+		return
+	}
+
+	err := app.sendMagicLink(r.Context(), email)
+	if err != nil && !errors.Is(err, ErrEmailSuppressed) {
+		logger.Error("unable to send email", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.RenderPage(w, r, logger, MagicTmpl, &MagicPageData{EmailFrom: app.Cfg.EmailFrom})
+	logger.Info("done")
+}
+
+// magicLogin logs in the user of the token of the form.
+func (app *AuthApp) magicLogin(w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+	username, err := app.useMagicToken(r.PostFormValue("mtoken"))
+	if errors.Is(err, ErrMagicTokenNotFound) || errors.Is(err, ErrMagicTokenExpired) {
+		logger.Warn("invalid token", "err", err)
+		app.RenderPage(w, r, logger, MagicTmpl, &MagicPageData{Message: MsgMagicInvalid})
+		return
+	}
+	if err != nil {
+		logger.Error("failed to use token", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	logger = logger.With(slog.String("username", username))
+
+	token, err := app.CreateLoginToken(username)
+	if err == nil {
+		var s session
+		s, err = app.newSession(token, r.PostFormValue("remember") == "on")
+		if err == nil {
+			app.setSessionCookies(w, s)
+		}
+	}
+	if err != nil {
+		logger.Error("failed to login", "err", err)
+		app.DB.RecordEvent(ErrorEvent(TypeLoginMagicFailed, username, err))
+		app.RenderPage(w, r, logger, MagicTmpl, &MagicPageData{Message: MsgMagicFailed})
+		return
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeLoginMagic, username, nil))
+	logger.Info("logged in")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
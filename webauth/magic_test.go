@@ -0,0 +1,141 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withMagicExpires returns a config modifier that enables login links.
+func withMagicExpires(d string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.MagicExpires = d
+	}
+}
+
+// magicRequest serves a request to MagicHandler with the form data, if
+// not nil.
+func magicRequest(app *webauth.AuthApp, method, target string, data url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(data.Encode()))
+	if data != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	w := httptest.NewRecorder()
+
+	app.MagicHandler(w, r)
+
+	return w
+}
+
+func TestMagicHandlerSend(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){withMagicExpires("15m")}, webauth.WithDB(store))
+
+	w := magicRequest(app, http.MethodGet, "/magic", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `id="send"`) {
+		t.Errorf("got %d %q, want form to send link", w.Code, w.Body)
+	}
+
+	w = magicRequest(app, http.MethodPost, "/magic", url.Values{"email": {""}})
+	if !strings.Contains(w.Body.String(), webauth.MsgMissingEmail) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgMissingEmail)
+	}
+
+	// The same page is shown for unknown emails to not reveal users.
+	for _, email := range []string{"test@email", "unknown@email"} {
+		w = magicRequest(app, http.MethodPost, "/magic", url.Values{"email": {email}})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), app.Cfg.EmailFrom) {
+			t.Errorf("email %q got %d %q, want sent page", email, w.Code, w.Body)
+		}
+	}
+
+	tokens, err := store.Tokens("test")
+	if err != nil {
+		t.Fatalf("Tokens() failed: %v", err)
+	}
+	var found bool
+	for _, token := range tokens {
+		found = found || token.Kind == webauth.MagicTokenKind
+	}
+	if !found {
+		t.Errorf("Tokens() = %+v, want %s token", tokens, webauth.MagicTokenKind)
+	}
+}
+
+func TestMagicHandlerLogin(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){withMagicExpires("15m")}, webauth.WithDB(store), webauth.WithClock(clock))
+
+	token, err := store.CreateToken(webauth.MagicTokenKind, "test", webauth.MagicTokenSize, app.Cfg.Auth.MagicExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	// The link shows a button, so that opening it does not use the token.
+	w := magicRequest(app, http.MethodGet, "/magic?mtoken="+url.QueryEscape(token.Value), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `id="login"`) {
+		t.Errorf("got %d %q, want login button", w.Code, w.Body)
+	}
+
+	w = magicRequest(app, http.MethodPost, "/magic", url.Values{"mtoken": {token.Value}, "remember": {"on"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	login, _ := sessionCookies(w.Result().Cookies())
+	if login == nil {
+		t.Fatalf("cookies = %v, want login cookie", w.Result().Cookies())
+	}
+	if user, err := store.UserForLoginToken(login.Value); err != nil || user.Username != "test" {
+		t.Errorf("UserForLoginToken() = %q, %v, want test", user.Username, err)
+	}
+
+	// The token can only be used once.
+	w = magicRequest(app, http.MethodPost, "/magic", url.Values{"mtoken": {token.Value}})
+	if !strings.Contains(w.Body.String(), webauth.MsgMagicInvalid) || len(w.Result().Cookies()) != 0 {
+		t.Errorf("reused token got %q, expected %q in body", w.Body, webauth.MsgMagicInvalid)
+	}
+
+	token, err = store.CreateToken(webauth.MagicTokenKind, "test", webauth.MagicTokenSize, app.Cfg.Auth.MagicExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	clock.Advance(16 * time.Minute)
+	w = magicRequest(app, http.MethodPost, "/magic", url.Values{"mtoken": {token.Value}})
+	if !strings.Contains(w.Body.String(), webauth.MsgMagicInvalid) {
+		t.Errorf("expired token got %q, expected %q in body", w.Body, webauth.MsgMagicInvalid)
+	}
+}
+
+func TestMagicHandlerDisabled(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	if w := magicRequest(app, http.MethodGet, "/magic", nil); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestConfigMagicExpires(t *testing.T) {
+	for _, d := range []string{"x", "-1m"} {
+		cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		withMagicExpires(d)(cfg)
+
+		_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+		if !errors.Is(err, webauth.ErrInvalidConfig) {
+			t.Errorf("NewApp() with MagicExpires %q error = %v, want %v", d, err, webauth.ErrInvalidConfig)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MaintenanceTask is a task run periodically by RunMaintenance.
+type MaintenanceTask struct {
+	Name string
+	Run  func(ctx context.Context) error
+
+	// Shared is true if the task changes data shared by the instances of
+	// the app, so it only runs on one instance each interval.
+	Shared bool
+}
+
+// maintenanceLock is the lock held by the instance that runs the shared
+// MaintenanceTasks.
+const maintenanceLock = "maintenance"
+
+// MaintenanceTasks returns the tasks of RunMaintenance: purging the
+// accounts deleted by their users, if enabled, saving the activity of
+// sessions and removing those idle too long, removing the values of ended
+// sessions, removing rate limit counts older than RateLimitHistory,
+// refreshing the reports, enforcing the retention periods of data, and
+// reloading the Tor exit list, if restricted.
+func (app *AuthApp) MaintenanceTasks() []MaintenanceTask {
+	var tasks []MaintenanceTask
+
+	if app.deleteGrace > 0 {
+		tasks = append(tasks, MaintenanceTask{Name: "account purge", Shared: true, Run: func(context.Context) error {
+			_, err := app.PurgeDeletedAccounts()
+			return err
+		}})
+	}
+
+	// Each instance saves the session activity it has seen.
+	tasks = append(tasks,
+		MaintenanceTask{Name: "idle sessions", Run: func(context.Context) error {
+			_, err := app.SweepIdleSessions()
+			return err
+		}},
+		MaintenanceTask{Name: "session values", Shared: true, Run: func(context.Context) error {
+			_, err := app.DB.PurgeSessionValues()
+			return err
+		}},
+		MaintenanceTask{Name: "rate limits", Shared: true, Run: func(context.Context) error {
+			_, err := app.DB.PurgeRateLimits(app.Clock.Now().Add(-RateLimitHistory))
+			return err
+		}},
+		MaintenanceTask{Name: "reports", Shared: true, Run: app.RefreshReports},
+		MaintenanceTask{Name: "retention", Shared: true, Run: func(context.Context) error {
+			_, err := app.EnforceRetention(false)
+			return err
+		}},
+	)
+
+	if app.geo != nil && app.geo.tor != GeoAllow {
+		tasks = append(tasks, MaintenanceTask{Name: "tor exit list", Run: func(context.Context) error {
+			return app.ReloadTorExitList()
+		}})
+	}
+
+	return tasks
+}
+
+// RunMaintenance runs the MaintenanceTasks every interval until ctx is
+// done. A task that fails is logged and does not stop the others.
+//
+// Shared tasks only run on the leader, if RunRegistry is running, and only
+// if it acquires the maintenance lock of the datastore, or of Redis if
+// Config.Redis is set, so they run once each interval however many
+// instances of the app there are.
+func (app *AuthApp) RunMaintenance(ctx context.Context, interval time.Duration) {
+	tasks := app.MaintenanceTasks()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.runMaintenanceTasks(ctx, tasks, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunMaintenanceOnce runs the MaintenanceTasks once, as RunMaintenance
+// does each interval.
+func (app *AuthApp) RunMaintenanceOnce(ctx context.Context, interval time.Duration) {
+	app.runMaintenanceTasks(ctx, app.MaintenanceTasks(), interval)
+}
+
+// runMaintenanceTasks runs tasks, and the shared tasks only if this
+// instance is the leader and acquires the maintenance lock. The lock
+// expires a little before the next interval so that the instance holding
+// it can run them again.
+func (app *AuthApp) runMaintenanceTasks(ctx context.Context, tasks []MaintenanceTask, interval time.Duration) {
+	shared := app.IsLeader()
+	if shared {
+		var err error
+		shared, err = app.DB.TryLock(ctx, maintenanceLock, interval-interval/10)
+		if err != nil {
+			slog.Error("failed to lock maintenance", "err", err)
+		}
+	}
+
+	for _, task := range tasks {
+		if task.Shared && !shared {
+			continue
+		}
+		if err := task.Run(ctx); err != nil {
+			slog.Error("maintenance task failed", "task", task.Name, "err", err)
+		}
+	}
+}
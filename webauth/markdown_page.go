@@ -0,0 +1,47 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webpages"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// MarkdownPageData contains data to render the layout of a Markdown page.
+type MarkdownPageData struct {
+	CommonData
+	User User
+	Page *webpages.Page
+}
+
+// MarkdownPage renders a page of app.Pages with its layout. It is a
+// webpages.RenderFunc. The title of the page is the app name if the page
+// has none.
+func (app *AuthApp) MarkdownPage(w http.ResponseWriter, r *http.Request, page *webpages.Page) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet, http.MethodHead) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		logger.Error("failed to get user from request", "err", err)
+		return
+	}
+
+	data := &MarkdownPageData{
+		CommonData: CommonData{Title: page.Title},
+		User:       user,
+		Page:       page,
+	}
+	app.RenderPage(w, r, logger, page.Layout, data)
+
+	logger.Info("done", "page", page.Name)
+}
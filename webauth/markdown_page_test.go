@@ -0,0 +1,85 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// withPages is a config modifier that serves the Markdown pages in
+// testdata under /pages/.
+func withPages(cfg *webauth.Config) {
+	cfg.Pages.Dir = "testdata/pages"
+	cfg.Pages.Prefix = "/pages/"
+}
+
+func TestMarkdownPage(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){withPages}, webauth.WithDB(StoreForTest(t)))
+	if app.Pages == nil {
+		t.Fatal("Pages is nil")
+	}
+
+	mux := webhandler.NewMux()
+	app.Pages.AddRoutes(mux, app.MarkdownPage)
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{"anonymous", "", []string{"<title>Privacy Policy</title>", "<strong>only</strong>", `href="/login"`}},
+		{"user", login.Value, []string{"<title>Privacy Policy</title>", `href="/logout"`}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(mux.ServeHTTP, tc.token, http.MethodGet, "/pages/privacy", "")
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			for _, s := range tc.want {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("body does not contain %q:\n%s", s, w.Body)
+				}
+			}
+			if got := w.Header().Get("Cache-Control"); !strings.Contains(got, "no-store") {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pages/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status of missing page = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestMarkdownPageInvalidConfig(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Pages.Dir = "testdata/pages"
+	cfg.Pages.Prefix = "pages"
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) || !strings.Contains(err.Error(), "prefix") {
+		t.Errorf("NewApp() error = %v, want invalid prefix", err)
+	}
+}
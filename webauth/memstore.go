@@ -0,0 +1,2373 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webid"
+)
+
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrValueTooLong = errors.New("value too long")
+)
+
+// Maximum lengths of values, matching the SQL schema.
+const (
+	maxFullNameLen = 70
+	maxEmailLen    = 256
+	maxMessageLen  = 255
+)
+
+// memUser is a user with their hashed password.
+type memUser struct {
+	User
+	hashedPassword string
+	deleteAfter    time.Time // deleteAfter is zero unless deletion is scheduled.
+	pendingEmail   string    // pendingEmail is a new email to confirm.
+}
+
+// memToken is a saved token. The value is only kept as a hash. API
+// tokens also have an id, name, and scopes.
+type memToken struct {
+	userID     string
+	expires    time.Time
+	created    time.Time
+	lastActive time.Time
+	spent      time.Time // spent is when a refresh token was used.
+	api        APIToken
+	remember   bool
+}
+
+// memUsernameChange is a previous username of a user.
+type memUsernameChange struct {
+	UsernameChange
+	userID string
+}
+
+// memEvent is an event and the id of its user, if any.
+type memEvent struct {
+	Event
+	userID string
+}
+
+// memBounce is a recorded bounce.
+type memBounce struct {
+	Bounce
+	created time.Time
+}
+
+// MemStore is an AuthStore that keeps data in memory. It is safe for
+// concurrent use, but data is lost when the program exits, so it is meant
+// for tests and demos.
+//
+// Usernames and emails are compared without regard to case, like the
+// default MySQL collation.
+type MemStore struct {
+	Clock Clock     // Clock is used to expire tokens. If nil, time.Now is used.
+	Rand  io.Reader // Rand is used to create tokens. If nil, crypto/rand is used.
+
+	// Hasher hashes passwords. If nil, a BcryptHasher is used.
+	Hasher PasswordHasher
+
+	// Waitlist holds new users for approval, see ConfigWaitlist.
+	Waitlist bool
+
+	mu         sync.Mutex
+	users      map[string]*memUser   // users by lowercase username.
+	tokens     map[string]memToken   // tokens by kind and hashed value.
+	events     []memEvent            // events in the order written.
+	prefs      map[string]EmailPrefs // prefs by user id.
+	bounces    []memBounce
+	incidents  []Incident
+	announces  []Announcement          // announcements in the order scheduled.
+	identities map[string]string       // user ids by provider and subject.
+	renames    []memUsernameChange     // username changes in the order made.
+	userPrefs  map[string]string       // preference values by user id and name.
+	sessions   map[string]string       // session values by hashed login token and key.
+	rateLimits []RateLimitUsage        // request counts of recent windows.
+	nonces     map[string]memNonce     // form nonces by hashed value.
+	cspReports []CSPReport             // CSP violations in the order first seen.
+	roles      map[string]Role         // roles by name.
+	userRoles  map[string]bool         // granted roles by user id and role name.
+	reports    []Report                // reports in the order first saved.
+	audit      []audit.Entry           // audit entries in the order recorded.
+	docs       map[memDocKey]SearchDoc // search documents by kind and id.
+	instances  map[string]Instance     // instances in the registry by id.
+	routes     map[string]RouteState   // route states by pattern.
+	locks      leases
+}
+
+// memNonce is a form nonce in a MemStore.
+type memNonce struct {
+	form    string
+	expires time.Time
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		users:      make(map[string]*memUser),
+		tokens:     make(map[string]memToken),
+		prefs:      make(map[string]EmailPrefs),
+		identities: make(map[string]string),
+		userPrefs:  make(map[string]string),
+		sessions:   make(map[string]string),
+		nonces:     make(map[string]memNonce),
+		roles: map[string]Role{
+			RoleAdmin: {Name: RoleAdmin, Description: "All permissions", Permissions: []Permission{PermAll}},
+		},
+		userRoles: make(map[string]bool),
+	}
+}
+
+// now returns the current time from m.Clock.
+func (m *MemStore) now() time.Time {
+	return clockNow(m.Clock)
+}
+
+// SetClock sets the Clock used to expire tokens and timestamp records.
+func (m *MemStore) SetClock(c Clock) {
+	m.Clock = c
+}
+
+// SetRand sets the source of random bytes used to create tokens.
+func (m *MemStore) SetRand(r io.Reader) {
+	m.Rand = r
+}
+
+// SetPasswordHasher sets the PasswordHasher used to hash new passwords.
+func (m *MemStore) SetPasswordHasher(h PasswordHasher) {
+	m.Hasher = h
+}
+
+// SetWaitlist sets whether new users are held for approval.
+func (m *MemStore) SetWaitlist(enabled bool) {
+	m.Waitlist = enabled
+}
+
+// key joins parts into a map key.
+func key(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// PingContext always succeeds.
+func (m *MemStore) PingContext(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// AddUser adds user with the given hashed password, keeping the ID,
+// Created, IsAdmin, and Confirmed fields. It is used to load test data.
+func (m *MemStore) AddUser(user User, hashedPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.Created.IsZero() {
+		user.Created = m.now()
+	}
+
+	return m.addUser(user, hashedPassword)
+}
+
+// addUser adds user if the username and email are valid and unique. An ID
+// is assigned if user does not have one. m.mu must be held.
+func (m *MemStore) addUser(user User, hashedPassword string) error {
+	if len(user.Username) > MaxUsernameLen || len(user.FullName) > maxFullNameLen || len(user.Email) > maxEmailLen {
+		return ErrValueTooLong
+	}
+	if user.ID == "" {
+		id, err := webid.NewString()
+		if err != nil {
+			return err
+		}
+		user.ID = id
+	}
+	if m.userForID(user.ID) != nil {
+		return fmt.Errorf("%w: id %q", ErrDuplicateKey, user.ID)
+	}
+	if _, ok := m.users[strings.ToLower(user.Username)]; ok {
+		return fmt.Errorf("%w: username %q", ErrDuplicateKey, user.Username)
+	}
+	if m.userForEmail(user.Email) != nil {
+		return fmt.Errorf("%w: email %q", ErrDuplicateKey, user.Email)
+	}
+
+	user.LastLoginTime, user.LastLoginResult = time.Time{}, ""
+	m.users[strings.ToLower(user.Username)] = &memUser{User: user, hashedPassword: hashedPassword}
+
+	return nil
+}
+
+// userForID returns the user with id or nil. m.mu must be held.
+func (m *MemStore) userForID(id string) *memUser {
+	for _, u := range m.users {
+		if u.ID == id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// userID returns the id of username or "" if not found. m.mu must be held.
+func (m *MemStore) userID(username string) string {
+	if u, ok := m.users[strings.ToLower(username)]; ok {
+		return u.ID
+	}
+
+	return ""
+}
+
+// userForEmail returns the user with email or nil. m.mu must be held.
+func (m *MemStore) userForEmail(email string) *memUser {
+	for _, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// UserForName returns a user for the given username.
+func (m *MemStore) UserForName(username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return EmptyUser, ErrUserNotFound
+	}
+
+	user := u.User
+	user.Created = time.Time{} // Not returned by AuthDB.UserForName.
+
+	return user, nil
+}
+
+// UserExists returns true if the given username exists.
+func (m *MemStore) UserExists(username string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.users[strings.ToLower(username)]
+	return ok, nil
+}
+
+// EmailExists returns true if the given email exists.
+func (m *MemStore) EmailExists(email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userForEmail(email) != nil, nil
+}
+
+// UsernameForEmail returns the username for email or ErrUserNotFound.
+func (m *MemStore) UsernameForEmail(email string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userForEmail(email)
+	if u == nil {
+		return "", ErrUserNotFound
+	}
+
+	return u.Username, nil
+}
+
+// HashedPassword returns the hashed password for username.
+func (m *MemStore) HashedPassword(username string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+
+	return u.hashedPassword, nil
+}
+
+// SetHashedPassword replaces the hashed password for username.
+func (m *MemStore) SetHashedPassword(username, hashedPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[strings.ToLower(username)]; ok {
+		u.hashedPassword = hashedPassword
+	}
+
+	return nil
+}
+
+// ResetPassword replaces the hashed password for username with the reset
+// token resetToken, which is removed along with the other reset tokens of
+// username. ErrTokenNotFound is returned if resetToken is not an unexpired
+// reset token of username.
+func (m *MemStore) ResetPassword(username, resetToken, hashedPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	t, ok := m.tokens[key("reset", Hash(resetToken))]
+	if !ok || t.userID != u.ID || t.expires.Before(m.now()) {
+		return ErrTokenNotFound
+	}
+
+	u.hashedPassword = hashedPassword
+	for k, t := range m.tokens {
+		if t.userID == u.ID && strings.HasPrefix(k, key("reset", "")) {
+			delete(m.tokens, k)
+		}
+	}
+
+	return nil
+}
+
+// CheckPassword validates the password for a user.
+func (m *MemStore) CheckPassword(username, password string) error {
+	hashedPassword, err := m.HashedPassword(username)
+	if err != nil {
+		return err
+	}
+
+	return comparePasswordsWith(m.Hasher, hashedPassword, password)
+}
+
+// RegisterUser registers a user with the given values.
+func (m *MemStore) RegisterUser(username, fullName, email, password string) error {
+	hashedPassword, err := hasherOrDefault(m.Hasher).Hash(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := User{Username: username, FullName: fullName, Email: email, Waitlisted: m.Waitlist, Created: m.now()}
+	return m.addUser(user, hashedPassword)
+}
+
+// ConfirmUser marks username as confirmed and removes the confirm token
+// ctoken. ErrTokenNotFound is returned if ctoken is not an unexpired
+// confirm token of username.
+func (m *MemStore) ConfirmUser(username, ctoken string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	k := key("confirm", Hash(ctoken))
+	t, ok := m.tokens[k]
+	if !ok || t.userID != u.ID || t.expires.Before(m.now()) {
+		return ErrTokenNotFound
+	}
+
+	u.Confirmed = true
+	delete(m.tokens, k)
+
+	return nil
+}
+
+// RenameUser changes username to newUsername and records the old username.
+// Data linked to the user is kept, since it refers to the user by ID.
+func (m *MemStore) RenameUser(username, newUsername string) error {
+	if len(newUsername) > MaxUsernameLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if other, ok := m.users[strings.ToLower(newUsername)]; ok && other != u {
+		return ErrUsernameTaken
+	}
+
+	delete(m.users, strings.ToLower(username))
+	m.renames = append(m.renames, memUsernameChange{
+		UsernameChange: UsernameChange{Username: u.Username, Changed: m.now()},
+		userID:         u.ID,
+	})
+	u.Username = newUsername
+	m.users[strings.ToLower(newUsername)] = u
+
+	return nil
+}
+
+// UsernameHistory returns the previous usernames of username, newest first.
+func (m *MemStore) UsernameHistory(username string) ([]UsernameChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.userID(username)
+	if id == "" {
+		return nil, nil
+	}
+
+	var history []UsernameChange
+	for i := len(m.renames) - 1; i >= 0; i-- {
+		if m.renames[i].userID == id {
+			history = append(history, m.renames[i].UsernameChange)
+		}
+	}
+
+	return history, nil
+}
+
+// UsernameForOldName returns the current username of the user who most
+// recently changed from oldName after since or ErrUserNotFound.
+func (m *MemStore) UsernameForOldName(oldName string, since time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.renames) - 1; i >= 0; i-- {
+		c := m.renames[i]
+		if strings.EqualFold(c.Username, oldName) && c.Changed.After(since) {
+			if u := m.userForID(c.userID); u != nil {
+				return u.Username, nil
+			}
+		}
+	}
+
+	return "", ErrUserNotFound
+}
+
+// DisableUsers disables each user in usernames and removes their tokens.
+// A user that is not found is reported with ErrUserNotFound.
+func (m *MemStore) DisableUsers(usernames []string) ([]BulkResult, error) {
+	return m.bulkUsers(usernames, func(u *memUser, _ *BulkResult) {
+		m.removeTokens(u.ID)
+		u.Disabled = true
+	}), nil
+}
+
+// DeleteUsers deletes each user in usernames and the data linked to them,
+// except events, which are kept with the Pseudonym of the user. A user that
+// is not found is reported with ErrUserNotFound.
+func (m *MemStore) DeleteUsers(usernames []string) ([]BulkResult, error) {
+	return m.bulkUsers(usernames, func(u *memUser, result *BulkResult) {
+		result.Pseudonym = Pseudonym(u.ID)
+		m.pseudonymizeEvents(u, result.Pseudonym)
+		m.pseudonymizeAudit(u, result.Pseudonym)
+		m.deleteUser(u)
+	}), nil
+}
+
+// pseudonymizeEvents replaces the personal data of u in events by
+// pseudonym like AuthDB.DeleteUsers. m.mu must be held.
+func (m *MemStore) pseudonymizeEvents(u *memUser, pseudonym string) {
+	values := append(m.usernames(u), u.Email)
+
+	for i, e := range m.events {
+		switch {
+		case e.userID == u.ID:
+			m.events[i].Username = pseudonym
+			m.events[i].Message = ""
+			m.events[i].Details = nil
+		case len(e.Details) > 0:
+			m.events[i].Event, _ = e.replaceDetails(pseudonym, values...)
+		case u.Email != "":
+			m.events[i].Message = strings.ReplaceAll(e.Message, u.Email, pseudonym)
+		}
+	}
+}
+
+// pseudonymizeAudit replaces the current and previous usernames of u as
+// the actor or target of audit entries by pseudonym. m.mu must be held.
+func (m *MemStore) pseudonymizeAudit(u *memUser, pseudonym string) {
+	names := m.usernames(u)
+	named := func(s string) bool {
+		return slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, s) })
+	}
+
+	for i, e := range m.audit {
+		if named(e.Actor) {
+			m.audit[i].Actor = pseudonym
+		}
+		if named(e.Target) {
+			m.audit[i].Target = pseudonym
+		}
+	}
+}
+
+// usernames returns the current and previous usernames of u. m.mu must be
+// held.
+func (m *MemStore) usernames(u *memUser) []string {
+	names := []string{u.Username}
+	for _, c := range m.renames {
+		if c.userID == u.ID {
+			names = append(names, c.Username)
+		}
+	}
+
+	return names
+}
+
+// deleteUser deletes u and the data linked to them, except events. m.mu
+// must be held.
+func (m *MemStore) deleteUser(u *memUser) {
+	m.removeTokens(u.ID)
+	delete(m.prefs, u.ID)
+	for k := range m.userPrefs {
+		if strings.HasPrefix(k, key(u.ID, "")) {
+			delete(m.userPrefs, k)
+		}
+	}
+	for k, id := range m.identities {
+		if id == u.ID {
+			delete(m.identities, k)
+		}
+	}
+	m.renames = slices.DeleteFunc(m.renames, func(c memUsernameChange) bool {
+		return c.userID == u.ID
+	})
+	for k := range m.userRoles {
+		if strings.HasPrefix(k, key(u.ID, "")) {
+			delete(m.userRoles, k)
+		}
+	}
+	delete(m.users, strings.ToLower(u.Username))
+}
+
+// bulkUsers calls fn with each user in usernames and their result while
+// holding m.mu.
+func (m *MemStore) bulkUsers(usernames []string, fn func(*memUser, *BulkResult)) []BulkResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	results := make([]BulkResult, 0, len(usernames))
+	for _, username := range usernames {
+		u, ok := m.users[strings.ToLower(username)]
+		if !ok {
+			results = append(results, BulkResult{Username: username, Err: ErrUserNotFound})
+			continue
+		}
+
+		result := BulkResult{Username: username}
+		fn(u, &result)
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// removeTokens removes all tokens of the user with id. m.mu must be held.
+func (m *MemStore) removeTokens(id string) {
+	for k, t := range m.tokens {
+		if t.userID == id {
+			delete(m.tokens, k)
+		}
+	}
+}
+
+// GetUsers returns all users sorted by username. Like AuthDB.GetUsers,
+// only the id, username, full name, email, admin, disabled, and created
+// fields are set.
+func (m *MemStore) GetUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, User{
+			ID:       u.ID,
+			Username: u.Username,
+			FullName: u.FullName,
+			Email:    u.Email,
+			IsAdmin:  u.IsAdmin,
+			Disabled: u.Disabled,
+			Created:  u.Created,
+		})
+	}
+	slices.SortFunc(users, func(a, b User) int {
+		return cmp.Compare(a.Username, b.Username)
+	})
+
+	return users, nil
+}
+
+// ListUsers returns the users selected by q and the number that match.
+func (m *MemStore) ListUsers(q ListQuery) ([]User, int, error) {
+	users, err := m.GetUsers()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users, total := listRows(UsersTable, q, users, userColumn(nil))
+
+	return users, total, nil
+}
+
+// CreateToken creates and saves a token for user of size that expires in
+// duration.
+func (m *MemStore) CreateToken(kind, username string, size int, duration string) (Token, error) {
+	value, err := RandomStringFrom(randReader(m.Rand), size)
+	if err != nil {
+		return Token{}, err
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return Token{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return Token{}, ErrUserNotFound
+	}
+
+	token := Token{Value: value, Expires: m.now().Add(d), Kind: kind}
+	m.tokens[key(kind, Hash(value))] = memToken{userID: u.ID, expires: token.Expires, created: m.now()}
+
+	return token, nil
+}
+
+// RemoveToken removes the token with kind and value.
+func (m *MemStore) RemoveToken(kind, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key(kind, Hash(value))
+	if _, ok := m.tokens[k]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(m.tokens, k)
+
+	return nil
+}
+
+// token returns the user of the unexpired token of kind with value. If
+// the token is expired, it is removed and errExpired is returned.
+func (m *MemStore) token(kind, value string, errNotFound, errExpired error) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key(kind, Hash(value))
+	t, ok := m.tokens[k]
+	if !ok {
+		return EmptyUser, errNotFound
+	}
+	u := m.userForID(t.userID)
+	if u == nil {
+		return EmptyUser, errNotFound
+	}
+	if t.expires.Before(m.now()) {
+		delete(m.tokens, k)
+		return EmptyUser, errExpired
+	}
+
+	return u.User, nil
+}
+
+// UserForLoginToken returns a user for the given loginToken.
+func (m *MemStore) UserForLoginToken(loginToken string) (User, error) {
+	return m.UserForLoginTokenContext(context.Background(), loginToken)
+}
+
+// UserForLoginTokenContext returns a user for the given loginToken.
+func (m *MemStore) UserForLoginTokenContext(ctx context.Context, loginToken string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return EmptyUser, err
+	}
+
+	user, err := m.token(LoginTokenKind, loginToken, ErrUserLoginTokenNotFound, ErrUserLoginTokenExpired)
+	if err != nil {
+		return EmptyUser, err
+	}
+
+	user.LastLoginTime, user.LastLoginResult, err = m.LastLoginForUser(user.Username)
+	if err != nil {
+		return user, fmt.Errorf("%w: %v", ErrUserGetLastLoginFailed, err)
+	}
+
+	return user, nil
+}
+
+// UsernameForResetToken returns the username for a given reset token.
+func (m *MemStore) UsernameForResetToken(tokenValue string) (string, error) {
+	user, err := m.token("reset", tokenValue, ErrUserNotFound, ErrResetPasswordTokenExpired)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// UsernameForConfirmToken returns the username for a given confirm token.
+func (m *MemStore) UsernameForConfirmToken(tokenValue string) (string, error) {
+	if tokenValue == "" {
+		return "", ErrMissingConfirmToken
+	}
+
+	user, err := m.token("confirm", tokenValue, ErrTokenNotFound, ErrConfirmTokenExpired)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// UsernameForMagicToken returns the username for a magic link token.
+func (m *MemStore) UsernameForMagicToken(tokenValue string) (string, error) {
+	user, err := m.token(MagicTokenKind, tokenValue, ErrMagicTokenNotFound, ErrMagicTokenExpired)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// AddEvent adds e, keeping the Created field. It is used to load test data.
+// Like WriteEvent, the event is linked to the user with e.Username, if any.
+func (m *MemStore) AddEvent(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e.Created.IsZero() {
+		e.Created = m.now()
+	}
+	m.events = append(m.events, memEvent{Event: e, userID: m.userID(e.Username)})
+}
+
+// WriteEvent saves an event.
+func (m *MemStore) WriteEvent(name EventName, succeeded bool, username, message string) error {
+	return m.RecordEvent(Event{Name: name, Succeeded: succeeded, Username: username, Message: message})
+}
+
+// RecordEvent records e, if it matches the schema of its type. The event
+// is given an ID if it does not have one.
+func (m *MemStore) RecordEvent(e Event) error {
+	if len(e.Name) > len(EventMaxName) || len(e.Type) > len(TypeMax) || len(e.Username) > MaxUsernameLen || len(e.Message) > maxMessageLen {
+		return fmt.Errorf("%w: %v", ErrWriteEventFailed, ErrValueTooLong)
+	}
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrWriteEventFailed, err)
+	}
+	if e.ID == "" {
+		id, err := webid.NewString()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrWriteEventFailed, err)
+		}
+		e.ID = id
+	}
+
+	m.AddEvent(e)
+
+	return nil
+}
+
+// sortedEvents returns events that match, newest first. m.mu must be held.
+func (m *MemStore) sortedEvents(match func(memEvent) bool) []Event {
+	var events []Event
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if match(m.events[i]) {
+			events = append(events, m.events[i].Event)
+		}
+	}
+	slices.SortStableFunc(events, func(a, b Event) int {
+		return b.Created.Compare(a.Created)
+	})
+
+	return events
+}
+
+// GetEvents returns all events, newest first.
+func (m *MemStore) GetEvents() ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedEvents(func(memEvent) bool { return true }), nil
+}
+
+// ListEvents returns the events selected by q and the number that match.
+func (m *MemStore) ListEvents(q ListQuery) ([]Event, int, error) {
+	events, err := m.GetEvents()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events, total := listRows(EventsTable, q, events, eventColumn)
+
+	return events, total, nil
+}
+
+// EventsNamed returns the most recent events with name, up to limit.
+func (m *MemStore) EventsNamed(name EventName, limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.sortedEvents(func(e memEvent) bool { return e.Name == name })
+
+	return events[:min(limit, len(events))], nil
+}
+
+// forUser returns a function that matches the events of username, like
+// eventsForUser. m.mu must be held.
+func (m *MemStore) forUser(username string) func(memEvent) bool {
+	id := m.userID(username)
+
+	return func(e memEvent) bool {
+		if e.userID == "" {
+			return strings.EqualFold(e.Username, username)
+		}
+		return e.userID == id
+	}
+}
+
+// LastLoginForUser returns the time and result of the login before the
+// most recent login for username.
+func (m *MemStore) LastLoginForUser(username string) (time.Time, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	forUser := m.forUser(username)
+	logins := m.sortedEvents(func(e memEvent) bool {
+		return e.Name == EventLogin && forUser(e)
+	})
+	if len(logins) < 2 {
+		return time.Time{}, "", nil
+	}
+
+	result := "0"
+	if logins[1].Succeeded {
+		result = "1"
+	}
+
+	return logins[1].Created, result, nil
+}
+
+// ResendCount returns the number of confirm resends for username since the
+// given time and the time of the last one.
+func (m *MemStore) ResendCount(username string, since time.Time) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	forUser := m.forUser(username)
+	resends := m.sortedEvents(func(e memEvent) bool {
+		return e.Name == EventResend && e.Succeeded && forUser(e) &&
+			e.Created.After(since)
+	})
+	if len(resends) == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	return len(resends), resends[0].Created, nil
+}
+
+// EmailPrefs returns the email preferences for username.
+func (m *MemStore) EmailPrefs(username string) (EmailPrefs, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefs := EmailPrefs{EmailSecurity: true}
+	for _, c := range OptionalEmailCategories {
+		prefs[c] = true
+	}
+	if id := m.userID(username); id != "" {
+		for c, enabled := range m.prefs[id] {
+			prefs[c] = enabled
+		}
+	}
+
+	return prefs, nil
+}
+
+// SetEmailPref saves the email preference for username and category.
+func (m *MemStore) SetEmailPref(username string, category EmailCategory, enabled bool) error {
+	if !category.Optional() {
+		return fmt.Errorf("%w: %q", ErrEmailCategoryRequired, category)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.userID(username)
+	if id == "" {
+		return ErrUserNotFound
+	}
+	if m.prefs[id] == nil {
+		m.prefs[id] = make(EmailPrefs)
+	}
+	m.prefs[id][category] = enabled
+
+	return nil
+}
+
+// RecordBounce saves a bounce or complaint for an email address.
+func (m *MemStore) RecordBounce(b Bounce) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b.Email = normalizeEmail(b.Email)
+	if len(b.Reason) > maxMessageLen {
+		b.Reason = b.Reason[:maxMessageLen]
+	}
+	m.bounces = append(m.bounces, memBounce{Bounce: b, created: m.now()})
+
+	return nil
+}
+
+// EmailSuppressed returns true if email has a hard bounce or complaint.
+func (m *MemStore) EmailSuppressed(email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	email = normalizeEmail(email)
+	for _, b := range m.bounces {
+		if b.Email == email && b.Kind.Suppresses() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// BounceKinds returns the most severe bounce kind recorded for each email
+// address.
+func (m *MemStore) BounceKinds() (map[string]BounceKind, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kinds := make(map[string]BounceKind)
+	for _, b := range m.bounces {
+		if kinds[b.Email].Suppresses() && !b.Kind.Suppresses() {
+			continue
+		}
+		kinds[b.Email] = b.Kind
+	}
+
+	return kinds, nil
+}
+
+// CreateIncident adds an open incident.
+func (m *MemStore) CreateIncident(title, message string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.incidents = append(m.incidents, Incident{
+		ID:      int64(len(m.incidents) + 1),
+		Title:   title,
+		Message: message,
+		Created: m.now(),
+	})
+
+	return nil
+}
+
+// ResolveIncident marks the incident with id as resolved.
+func (m *MemStore) ResolveIncident(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.incidents {
+		if m.incidents[i].ID == id && !m.incidents[i].Resolved.Valid {
+			m.incidents[i].Resolved.Time = m.now()
+			m.incidents[i].Resolved.Valid = true
+			return nil
+		}
+	}
+
+	return ErrIncidentNotFound
+}
+
+// RecentIncidents returns incidents that are open or were created since
+// the given time, newest first.
+func (m *MemStore) RecentIncidents(since time.Time) ([]Incident, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var incidents []Incident
+	for i := len(m.incidents) - 1; i >= 0; i-- {
+		in := m.incidents[i]
+		if !in.Resolved.Valid || !in.Created.Before(since) {
+			incidents = append(incidents, in)
+		}
+	}
+
+	return incidents, nil
+}
+
+// ScheduleAnnouncement saves a pending announcement of message on topic
+// to be published at publishAt.
+func (m *MemStore) ScheduleAnnouncement(topic, message string, publishAt time.Time) error {
+	if len(topic) > MaxAnnouncementTopicLen || len(message) > MaxAnnouncementMessageLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.announces = append(m.announces, Announcement{
+		ID:        int64(len(m.announces) + 1),
+		Topic:     topic,
+		Message:   message,
+		PublishAt: publishAt,
+		Created:   m.now(),
+	})
+
+	return nil
+}
+
+// CancelAnnouncement cancels the pending announcement with id.
+func (m *MemStore) CancelAnnouncement(id int64) error {
+	return m.setAnnouncement(id, func(a *Announcement) *sql.NullTime { return &a.Canceled })
+}
+
+// MarkAnnouncementSent records that the pending announcement with id was
+// published.
+func (m *MemStore) MarkAnnouncementSent(id int64) error {
+	return m.setAnnouncement(id, func(a *Announcement) *sql.NullTime { return &a.Sent })
+}
+
+// setAnnouncement sets the time returned by field of the pending
+// announcement with id to the current time.
+func (m *MemStore) setAnnouncement(id int64, field func(*Announcement) *sql.NullTime) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.announces {
+		if a := &m.announces[i]; a.ID == id && a.Pending() {
+			*field(a) = sql.NullTime{Time: m.now(), Valid: true}
+			return nil
+		}
+	}
+
+	return ErrAnnouncementNotFound
+}
+
+// Announcements returns the pending announcements and those sent or
+// canceled since the given time, in order of publication.
+func (m *MemStore) Announcements(since time.Time) ([]Announcement, error) {
+	return m.matchAnnouncements(func(a Announcement) bool {
+		return a.Pending() || !a.PublishAt.Before(since)
+	}), nil
+}
+
+// DueAnnouncements returns the pending announcements to be published at
+// or before now, in order of publication.
+func (m *MemStore) DueAnnouncements(now time.Time) ([]Announcement, error) {
+	return m.matchAnnouncements(func(a Announcement) bool {
+		return a.Pending() && !a.PublishAt.After(now)
+	}), nil
+}
+
+// matchAnnouncements returns the announcements that match, in order of
+// publication.
+func (m *MemStore) matchAnnouncements(match func(Announcement) bool) []Announcement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var announcements []Announcement
+	for _, a := range m.announces {
+		if match(a) {
+			announcements = append(announcements, a)
+		}
+	}
+	slices.SortStableFunc(announcements, func(a, b Announcement) int {
+		return a.PublishAt.Compare(b.PublishAt)
+	})
+
+	return announcements
+}
+
+// UsernameForIdentity returns the username linked to the subject at
+// provider or ErrUserNotFound.
+func (m *MemStore) UsernameForIdentity(provider, subject string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.userForID(m.identities[key(provider, subject)])
+	if u == nil {
+		return "", ErrUserNotFound
+	}
+
+	return u.Username, nil
+}
+
+// LinkIdentity links the subject at provider to username.
+func (m *MemStore) LinkIdentity(provider, subject, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.linkIdentity(provider, subject, username)
+}
+
+// linkIdentity is LinkIdentity with m.mu held.
+func (m *MemStore) linkIdentity(provider, subject, username string) error {
+	k := key(provider, subject)
+	if _, ok := m.identities[k]; ok {
+		return fmt.Errorf("%w: identity %s %s", ErrDuplicateKey, provider, subject)
+	}
+	id := m.userID(username)
+	if id == "" {
+		return ErrUserNotFound
+	}
+	m.identities[k] = id
+
+	return nil
+}
+
+// CreateUserForIdentity registers username for id and links id to it.
+func (m *MemStore) CreateUserForIdentity(id OAuthIdentity, username string) error {
+	password, err := RandomStringFrom(randReader(m.Rand), 32)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hasherOrDefault(m.Hasher).Hash(password)
+	if err != nil {
+		return err
+	}
+
+	fullName := id.Name
+	if fullName == "" {
+		fullName = username
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.identities[key(id.Provider, id.Subject)]; ok {
+		return fmt.Errorf("%w: identity %s %s", ErrDuplicateKey, id.Provider, id.Subject)
+	}
+
+	user := User{
+		Username:   username,
+		FullName:   fullName,
+		Email:      id.Email,
+		Confirmed:  id.EmailVerified,
+		Waitlisted: m.Waitlist,
+		Created:    m.now(),
+	}
+	if err := m.addUser(user, hashedPassword); err != nil {
+		return err
+	}
+
+	return m.linkIdentity(id.Provider, id.Subject, username)
+}
+
+// loginActive returns true if hashedValue is a login token that has not
+// expired. m.mu must be held.
+func (m *MemStore) loginActive(hashedValue string) bool {
+	t, ok := m.tokens[key(LoginTokenKind, hashedValue)]
+	return ok && t.expires.After(m.now())
+}
+
+// SessionValue returns the value of key in the session of loginToken or
+// ErrSessionValueNotFound.
+func (m *MemStore) SessionValue(loginToken, k string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashedValue := Hash(loginToken)
+	value, ok := m.sessions[key(hashedValue, k)]
+	if !ok || !m.loginActive(hashedValue) {
+		return "", ErrSessionValueNotFound
+	}
+
+	return value, nil
+}
+
+// SetSessionValue saves value as key in the session of loginToken.
+func (m *MemStore) SetSessionValue(loginToken, k, value string) error {
+	if len(k) > MaxSessionKeyLen || len(value) > MaxSessionValueLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashedValue := Hash(loginToken)
+	if !m.loginActive(hashedValue) {
+		return ErrNoSession
+	}
+
+	if _, exists := m.sessions[key(hashedValue, k)]; !exists {
+		var n int
+		for sk := range m.sessions {
+			if strings.HasPrefix(sk, key(hashedValue, "")) {
+				n++
+			}
+		}
+		if n >= MaxSessionValues {
+			return ErrTooManySessionValues
+		}
+	}
+	m.sessions[key(hashedValue, k)] = value
+
+	return nil
+}
+
+// DeleteSessionValue deletes key from the session of loginToken, if it
+// exists.
+func (m *MemStore) DeleteSessionValue(loginToken, k string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, key(Hash(loginToken), k))
+
+	return nil
+}
+
+// PurgeSessionValues deletes the values of sessions whose login token was
+// removed.
+func (m *MemStore) PurgeSessionValues() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int
+	for sk := range m.sessions {
+		hashedValue, _, _ := strings.Cut(sk, "\x00")
+		if _, ok := m.tokens[key(LoginTokenKind, hashedValue)]; !ok {
+			delete(m.sessions, sk)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Pref returns the value of the preference name for username or
+// ErrPrefNotFound.
+func (m *MemStore) Pref(username, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.userPrefs[key(m.userID(username), name)]
+	if !ok {
+		return "", ErrPrefNotFound
+	}
+
+	return value, nil
+}
+
+// SetPref saves value as the preference name for username.
+func (m *MemStore) SetPref(username, name, value string) error {
+	if len(name) > MaxPrefNameLen || len(value) > MaxPrefValueLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.userID(username)
+	if id == "" {
+		return ErrUserNotFound
+	}
+	m.userPrefs[key(id, name)] = value
+
+	return nil
+}
+
+// DeletePref deletes the preference name for username, if it exists.
+func (m *MemStore) DeletePref(username, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.userPrefs, key(m.userID(username), name))
+
+	return nil
+}
+
+// PrefNames returns the sorted names of the preferences for username that
+// start with prefix.
+func (m *MemStore) PrefNames(username, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.userID(username)
+	if id == "" {
+		return nil, nil
+	}
+
+	var names []string
+	for k := range m.userPrefs {
+		userID, name, _ := strings.Cut(k, "\x00")
+		if userID == id && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// CountRequest adds a request for key in the window that starts at window
+// and returns the number of requests in it. Counts for earlier windows are
+// kept until removed by PurgeRateLimits.
+func (m *MemStore) CountRequest(key string, window time.Time) (int, error) {
+	if len(key) > MaxRateLimitKeyLen {
+		return 0, ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.rateLimits {
+		u := &m.rateLimits[i]
+		if u.Key == key && u.Window.Equal(window) {
+			u.Requests++
+			return u.Requests, nil
+		}
+	}
+
+	m.rateLimits = append(m.rateLimits, RateLimitUsage{Key: key, Window: window, Requests: 1})
+
+	return 1, nil
+}
+
+// PurgeRateLimits removes the counts of windows that start before before
+// and returns the number removed.
+func (m *MemStore) PurgeRateLimits(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.rateLimits)
+	m.rateLimits = slices.DeleteFunc(m.rateLimits, func(u RateLimitUsage) bool {
+		return u.Window.Before(before)
+	})
+
+	return n - len(m.rateLimits), nil
+}
+
+// RateLimitUsage returns the usage of each key in windows that start at
+// or after since, with the most requests first.
+func (m *MemStore) RateLimitUsage(since time.Time) ([]RateLimitUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var usage []RateLimitUsage
+	for _, u := range m.rateLimits {
+		if !u.Window.Before(since) {
+			usage = append(usage, u)
+		}
+	}
+	slices.SortFunc(usage, func(a, b RateLimitUsage) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Key, b.Key))
+	})
+
+	return usage, nil
+}
+
+// CreateFormNonce creates and saves a nonce for form that expires after
+// duration. Expired nonces are removed.
+func (m *MemStore) CreateFormNonce(form string, duration time.Duration) (string, error) {
+	value, err := RandomStringFrom(randReader(m.Rand), FormNonceSize)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for k, n := range m.nonces {
+		if !now.Before(n.expires) {
+			delete(m.nonces, k)
+		}
+	}
+	m.nonces[Hash(value)] = memNonce{form: form, expires: now.Add(duration)}
+
+	return value, nil
+}
+
+// UseFormNonce removes the unexpired nonce for form with value. It returns
+// ErrFormNonceInvalid if there is no such nonce, so each nonce can only be
+// used once.
+func (m *MemStore) UseFormNonce(form, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := Hash(value)
+	n, ok := m.nonces[k]
+	if !ok || n.form != form || !m.now().Before(n.expires) {
+		return ErrFormNonceInvalid
+	}
+	delete(m.nonces, k)
+
+	return nil
+}
+
+// RecordCSPViolation counts a violation of directive that blocked
+// blockedURI at when.
+func (m *MemStore) RecordCSPViolation(directive, blockedURI string, when time.Time) error {
+	directive = truncate(directive, MaxCSPDirectiveLen)
+	blockedURI = truncate(blockedURI, MaxCSPBlockedURILen)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.cspReports {
+		c := &m.cspReports[i]
+		if c.Directive == directive && c.BlockedURI == blockedURI {
+			c.Reports++
+			c.LastSeen = when
+			return nil
+		}
+	}
+
+	m.cspReports = append(m.cspReports, CSPReport{
+		Directive:  directive,
+		BlockedURI: blockedURI,
+		Reports:    1,
+		FirstSeen:  when,
+		LastSeen:   when,
+	})
+
+	return nil
+}
+
+// CSPReports returns the violations of each directive and blocked URI,
+// with the most reports first.
+func (m *MemStore) CSPReports() ([]CSPReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := slices.Clone(m.cspReports)
+	slices.SortFunc(reports, func(a, b CSPReport) int {
+		return cmp.Or(cmp.Compare(b.Reports, a.Reports),
+			cmp.Compare(a.Directive, b.Directive),
+			cmp.Compare(a.BlockedURI, b.BlockedURI))
+	})
+
+	return reports, nil
+}
+
+// Roles returns all roles ordered by name.
+func (m *MemStore) Roles() ([]Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedRoles(func(name string) bool { return true }), nil
+}
+
+// sortedRoles returns copies of the roles with a name allowed by include,
+// ordered by name. m.mu must be held.
+func (m *MemStore) sortedRoles(include func(name string) bool) []Role {
+	var roles []Role
+	for name, role := range m.roles {
+		if include(name) {
+			role.Permissions = slices.Clone(role.Permissions)
+			roles = append(roles, role)
+		}
+	}
+	slices.SortFunc(roles, func(a, b Role) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return roles
+}
+
+// UserRoles returns the roles granted to username ordered by name.
+func (m *MemStore) UserRoles(username string) ([]Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return nil, nil
+	}
+
+	return m.sortedRoles(func(name string) bool {
+		return m.userRoles[key(u.ID, name)]
+	}), nil
+}
+
+// SaveRole creates role or replaces the description and permissions of
+// the role with the same name.
+func (m *MemStore) SaveRole(role Role) error {
+	if err := validRole(role); err != nil {
+		return err
+	}
+
+	perms := slices.Clone(role.Permissions)
+	slices.Sort(perms)
+	role.Permissions = slices.Compact(perms)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.roles[role.Name] = role
+
+	return nil
+}
+
+// DeleteRole deletes the role name and revokes it from all users.
+func (m *MemStore) DeleteRole(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[name]; !ok {
+		return ErrRoleNotFound
+	}
+	delete(m.roles, name)
+
+	for k := range m.userRoles {
+		if strings.HasSuffix(k, key("", name)) {
+			delete(m.userRoles, k)
+		}
+	}
+
+	return nil
+}
+
+// GrantRole grants the role name to username. Granting a role the user
+// already has is not an error.
+func (m *MemStore) GrantRole(username, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if _, ok := m.roles[name]; !ok {
+		return ErrRoleNotFound
+	}
+
+	m.userRoles[key(u.ID, name)] = true
+
+	return nil
+}
+
+// RevokeRole revokes the role name from username. It returns
+// ErrRoleNotFound if the user does not have the role.
+func (m *MemStore) RevokeRole(username, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok || !m.userRoles[key(u.ID, name)] {
+		return ErrRoleNotFound
+	}
+	delete(m.userRoles, key(u.ID, name))
+
+	return nil
+}
+
+// CreateAPIToken creates and saves an API token for username with name
+// and scopes that expires at expires.
+func (m *MemStore) CreateAPIToken(username, name string, scopes []Permission, expires time.Time) (Token, error) {
+	if err := validAPIToken(name, scopes); err != nil {
+		return Token{}, err
+	}
+
+	id, err := webid.NewString()
+	if err != nil {
+		return Token{}, err
+	}
+
+	value, err := RandomStringFrom(randReader(m.Rand), APITokenSize)
+	if err != nil {
+		return Token{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return Token{}, ErrUserNotFound
+	}
+
+	m.tokens[key(APITokenKind, Hash(value))] = memToken{
+		userID:  u.ID,
+		expires: expires,
+		created: m.now(),
+		api: APIToken{
+			ID:      id,
+			Name:    name,
+			Scopes:  slices.Clone(scopes),
+			Expires: expires,
+			Created: m.now(),
+		},
+	}
+
+	return Token{Value: value, Expires: expires, Kind: APITokenKind}, nil
+}
+
+// APITokens returns the API tokens of username, including expired
+// tokens, with the newest first.
+func (m *MemStore) APITokens(username string) ([]APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return nil, nil
+	}
+
+	var tokens []APIToken
+	for k, t := range m.tokens {
+		if t.userID == u.ID && strings.HasPrefix(k, key(APITokenKind, "")) {
+			tokens = append(tokens, t.api)
+		}
+	}
+	slices.SortFunc(tokens, func(a, b APIToken) int {
+		if c := b.Created.Compare(a.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return tokens, nil
+}
+
+// RevokeAPIToken removes the API token of username with id.
+func (m *MemStore) RevokeAPIToken(username, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrAPITokenNotFound
+	}
+
+	for k, t := range m.tokens {
+		if t.userID == u.ID && t.api.ID == id && strings.HasPrefix(k, key(APITokenKind, "")) {
+			delete(m.tokens, k)
+			return nil
+		}
+	}
+
+	return ErrAPITokenNotFound
+}
+
+// UserForAPIToken returns the user and scopes of the API token with
+// value. An expired token is removed and ErrAPITokenExpired is returned.
+func (m *MemStore) UserForAPIToken(ctx context.Context, value string) (User, []Permission, error) {
+	if err := ctx.Err(); err != nil {
+		return EmptyUser, nil, err
+	}
+
+	user, err := m.token(APITokenKind, value, ErrAPITokenNotFound, ErrAPITokenExpired)
+	if err != nil {
+		return EmptyUser, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tokens[key(APITokenKind, Hash(value))]
+	if !ok {
+		return EmptyUser, nil, ErrAPITokenNotFound
+	}
+
+	return user, slices.Clone(t.api.Scopes), nil
+}
+
+// tokenInfos returns the tokens that match, with the newest first. m.mu
+// must be held.
+func (m *MemStore) tokenInfos(match func(TokenInfo) bool) []TokenInfo {
+	var tokens []TokenInfo
+	for k, t := range m.tokens {
+		kind, hashedValue, _ := strings.Cut(k, "\x00")
+		u := m.userForID(t.userID)
+		if u == nil {
+			continue
+		}
+
+		info := TokenInfo{
+			Fingerprint: hashedValue[:TokenFingerprintLen],
+			Kind:        kind,
+			Username:    u.Username,
+			Name:        t.api.Name,
+			Expires:     t.expires,
+			Created:     t.created,
+			LastActive:  t.lastActive,
+			hashedValue: hashedValue,
+		}
+		if match(info) {
+			tokens = append(tokens, info)
+		}
+	}
+
+	slices.SortFunc(tokens, func(a, b TokenInfo) int {
+		if c := b.Created.Compare(a.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.hashedValue, b.hashedValue)
+	})
+
+	return tokens
+}
+
+// Tokens returns the tokens of username, or of all users if username is
+// empty, with the newest first.
+func (m *MemStore) Tokens(username string) ([]TokenInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.tokenInfos(func(t TokenInfo) bool {
+		return username == "" || strings.EqualFold(t.Username, username)
+	}), nil
+}
+
+// TokenForFingerprint returns the token whose fingerprint starts with
+// fingerprint. It returns ErrTokenAmbiguous if more than one token
+// matches.
+func (m *MemStore) TokenForFingerprint(fingerprint string) (TokenInfo, error) {
+	if !IsTokenFingerprint(fingerprint) {
+		return TokenInfo{}, ErrTokenNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return oneToken(m.tokenInfos(func(t TokenInfo) bool {
+		return strings.HasPrefix(t.hashedValue, fingerprint)
+	}))
+}
+
+// RemoveTokenForFingerprint removes the token returned by
+// TokenForFingerprint.
+func (m *MemStore) RemoveTokenForFingerprint(fingerprint string) error {
+	t, err := m.TokenForFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tokens, key(t.Kind, t.hashedValue))
+
+	return nil
+}
+
+// CreateRefreshToken creates and saves a refresh token for username that
+// expires at expires.
+func (m *MemStore) CreateRefreshToken(username string, remember bool, expires time.Time) (Token, error) {
+	value, err := RandomStringFrom(randReader(m.Rand), RefreshTokenSize)
+	if err != nil {
+		return Token{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return Token{}, ErrUserNotFound
+	}
+
+	m.tokens[key(RefreshTokenKind, Hash(value))] = memToken{
+		userID:   u.ID,
+		expires:  expires,
+		created:  m.now(),
+		remember: remember,
+	}
+
+	return Token{Value: value, Expires: expires, Kind: RefreshTokenKind}, nil
+}
+
+// UseRefreshToken spends the refresh token with value and returns it. A
+// token used again within RefreshReuseGrace is returned with Spent set.
+// ErrRefreshTokenReused is returned, with the token, if it was spent
+// before RefreshReuseGrace.
+func (m *MemStore) UseRefreshToken(value string) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashedValue := Hash(value)
+
+	if t, ok := m.tokens[key(spentRefreshTokenKind, hashedValue)]; ok {
+		rt := RefreshToken{Remember: t.remember, Expires: t.expires}
+		if u := m.userForID(t.userID); u != nil {
+			rt.Username = u.Username
+		}
+		if m.now().Sub(t.spent) < RefreshReuseGrace {
+			rt.Spent = true
+			return rt, nil
+		}
+		return rt, ErrRefreshTokenReused
+	}
+
+	k := key(RefreshTokenKind, hashedValue)
+	t, ok := m.tokens[k]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	u := m.userForID(t.userID)
+	if u == nil {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if t.expires.Before(m.now()) {
+		return RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	delete(m.tokens, k)
+	t.spent = m.now()
+	m.tokens[key(spentRefreshTokenKind, hashedValue)] = t
+
+	return RefreshToken{Username: u.Username, Remember: t.remember, Expires: t.expires}, nil
+}
+
+// RevokeSessions removes the login and refresh tokens of username.
+func (m *MemStore) RevokeSessions(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.userID(username)
+	for k, t := range m.tokens {
+		if t.userID != id {
+			continue
+		}
+		for _, kind := range []string{LoginTokenKind, RefreshTokenKind, spentRefreshTokenKind} {
+			if strings.HasPrefix(k, key(kind, "")) {
+				delete(m.tokens, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetLastActive saves the last activity of login tokens, by their hashed
+// value. Tokens that no longer exist are ignored.
+func (m *MemStore) SetLastActive(lastActive map[string]time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hashedValue, when := range lastActive {
+		k := key(LoginTokenKind, hashedValue)
+		if t, ok := m.tokens[k]; ok {
+			t.lastActive = when
+			m.tokens[k] = t
+		}
+	}
+
+	return nil
+}
+
+// RemoveIdleSessions removes the login tokens not used since cutoff, and
+// the refresh tokens issued before cutoff of users without a login token
+// used since cutoff, and returns the number removed.
+func (m *MemStore) RemoveIdleSessions(cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lastActive := func(t memToken) time.Time {
+		if t.lastActive.IsZero() {
+			return t.created
+		}
+		return t.lastActive
+	}
+
+	active := make(map[string]bool)
+	for k, t := range m.tokens {
+		if strings.HasPrefix(k, key(LoginTokenKind, "")) && !lastActive(t).Before(cutoff) {
+			active[t.userID] = true
+		}
+	}
+
+	var removed int
+	for k, t := range m.tokens {
+		idle := strings.HasPrefix(k, key(LoginTokenKind, "")) && lastActive(t).Before(cutoff) ||
+			strings.HasPrefix(k, key(RefreshTokenKind, "")) && t.created.Before(cutoff) && !active[t.userID]
+		if idle {
+			delete(m.tokens, k)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// UsernameForDeleteToken returns the username for a delete token.
+func (m *MemStore) UsernameForDeleteToken(tokenValue string) (string, error) {
+	user, err := m.token(DeleteTokenKind, tokenValue, ErrDeleteTokenNotFound, ErrDeleteTokenExpired)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// EventsForUser returns the events of username, newest first.
+func (m *MemStore) EventsForUser(username string) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedEvents(m.forUser(username)), nil
+}
+
+// ScheduleDeletion schedules the account of username to be purged at at.
+// A zero at cancels a scheduled deletion.
+func (m *MemStore) ScheduleDeletion(username string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.deleteAfter = at
+
+	return nil
+}
+
+// DeletionScheduled returns when the account of username will be purged,
+// or the zero time if its deletion is not scheduled.
+func (m *MemStore) DeletionScheduled(username string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return time.Time{}, ErrUserNotFound
+	}
+
+	return u.deleteAfter, nil
+}
+
+// DueDeletions returns the usernames of accounts scheduled to be purged at
+// or before now, the earliest first.
+func (m *MemStore) DueDeletions(now time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*memUser
+	for _, u := range m.users {
+		if !u.deleteAfter.IsZero() && !u.deleteAfter.After(now) {
+			due = append(due, u)
+		}
+	}
+	slices.SortFunc(due, func(a, b *memUser) int {
+		return cmp.Or(a.deleteAfter.Compare(b.deleteAfter), cmp.Compare(a.Username, b.Username))
+	})
+
+	usernames := make([]string, 0, len(due))
+	for _, u := range due {
+		usernames = append(usernames, u.Username)
+	}
+
+	return usernames, nil
+}
+
+// PurgeUser deletes username and the data linked to them, and replaces
+// their username in their events with their Pseudonym, like DeleteUsers.
+func (m *MemStore) PurgeUser(username string) error {
+	results, _ := m.DeleteUsers([]string{username})
+
+	return results[0].Err
+}
+
+// UpdateUserFullName changes the full name of username.
+func (m *MemStore) UpdateUserFullName(username, fullName string) error {
+	if len(fullName) > maxFullNameLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.FullName = fullName
+
+	return nil
+}
+
+// UpdateUserEmail changes the email of username to email, which is
+// confirmed, and clears a pending email.
+func (m *MemStore) UpdateUserEmail(username, email string) error {
+	if len(email) > maxEmailLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if other := m.userForEmail(email); other != nil && other != u {
+		return ErrEmailTaken
+	}
+	u.Email = email
+	u.Confirmed = true
+	u.pendingEmail = ""
+
+	return nil
+}
+
+// SetPendingEmail saves email as the new email of username until it is
+// confirmed with UpdateUserEmail. An empty email clears it.
+func (m *MemStore) SetPendingEmail(username, email string) error {
+	if len(email) > maxEmailLen {
+		return ErrValueTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.pendingEmail = email
+
+	return nil
+}
+
+// PendingEmail returns the email of username waiting to be confirmed, or
+// "" if there is none.
+func (m *MemStore) PendingEmail(username string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[strings.ToLower(username)]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+
+	return u.pendingEmail, nil
+}
+
+// UsernameForEmailToken returns the username for an email token.
+func (m *MemStore) UsernameForEmailToken(tokenValue string) (string, error) {
+	user, err := m.token(EmailTokenKind, tokenValue, ErrEmailTokenNotFound, ErrEmailTokenExpired)
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// EventCounts returns the number of successful events of each name created
+// in [since, until).
+func (m *MemStore) EventCounts(since, until time.Time) (map[EventName]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[EventName]int)
+	for _, e := range m.events {
+		if e.Succeeded && !e.Created.Before(since) && e.Created.Before(until) {
+			counts[e.Name]++
+		}
+	}
+
+	return counts, nil
+}
+
+// SaveReport saves r, replacing the report of the same period and start.
+func (m *MemStore) SaveReport(r Report) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, saved := range m.reports {
+		if saved.Period == r.Period && saved.Start.Equal(r.Start) {
+			m.reports[i] = r
+			return nil
+		}
+	}
+	m.reports = append(m.reports, r)
+
+	return nil
+}
+
+// Report returns the report of period that starts at start, or
+// ErrReportNotFound.
+func (m *MemStore) Report(period ReportPeriod, start time.Time) (Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.reports {
+		if r.Period == period && r.Start.Equal(start) {
+			return r, nil
+		}
+	}
+
+	return Report{}, ErrReportNotFound
+}
+
+// Reports returns the reports of period, the newest first.
+func (m *MemStore) Reports(period ReportPeriod) ([]Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []Report
+	for _, r := range m.reports {
+		if r.Period == period {
+			reports = append(reports, r)
+		}
+	}
+	slices.SortFunc(reports, func(a, b Report) int {
+		return b.Start.Compare(a.Start)
+	})
+
+	return reports, nil
+}
+
+// expired counts the rows of category older than cutoff, removing
+// them if purge is true, and returns the number of rows. m.mu must be held.
+func (m *MemStore) expired(category RetentionCategory, cutoff time.Time, purge bool) (int, error) {
+	var n int
+	count := func(t time.Time) bool {
+		if t.Before(cutoff) {
+			n++
+			return purge
+		}
+		return false
+	}
+
+	switch category {
+	case RetainEvents:
+		m.events = slices.DeleteFunc(m.events, func(e memEvent) bool { return count(e.Created) })
+	case RetainEmails:
+		m.bounces = slices.DeleteFunc(m.bounces, func(b memBounce) bool {
+			return b.Kind != BounceHard && b.Kind != BounceComplaint && count(b.created)
+		})
+	case RetainAnalytics:
+		m.cspReports = slices.DeleteFunc(m.cspReports, func(c CSPReport) bool { return count(c.LastSeen) })
+	case RetainAudit:
+		m.audit = slices.DeleteFunc(m.audit, func(e audit.Entry) bool { return count(e.Created) })
+	default:
+		return 0, fmt.Errorf("unknown retention category %q", category)
+	}
+
+	return n, nil
+}
+
+// CountExpired returns the number of rows of category older than cutoff.
+func (m *MemStore) CountExpired(category RetentionCategory, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.expired(category, cutoff, false)
+}
+
+// PurgeExpired deletes the rows of category older than cutoff and returns
+// the number deleted.
+func (m *MemStore) PurgeExpired(category RetentionCategory, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.expired(category, cutoff, true)
+}
+
+// RecordAudit saves e in the audit log.
+func (m *MemStore) RecordAudit(e audit.Entry) error {
+	if len(e.Metadata.String()) > audit.MaxMetadataLen {
+		return audit.ErrMetadataTooLong
+	}
+	if len(e.Changes.String()) > audit.MaxChangesLen {
+		return audit.ErrChangesTooLong
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e = e.Truncated()
+	e.Created = m.now()
+	m.audit = append(m.audit, e)
+
+	return nil
+}
+
+// AuditEntries returns the entries of the audit log that match f, newest
+// first, and the number that match.
+func (m *MemStore) AuditEntries(f audit.Filter) ([]audit.Entry, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matched []audit.Entry
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		if f.Match(m.audit[i]) {
+			matched = append(matched, m.audit[i])
+		}
+	}
+
+	return audit.Page(matched, f), len(matched), nil
+}
+
+// Heartbeat saves inst in the registry, replacing the previous heartbeat
+// of the instance with its id.
+func (m *MemStore) Heartbeat(inst Instance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.instances == nil {
+		m.instances = make(map[string]Instance)
+	}
+	inst.Leader = false
+	m.instances[inst.ID] = inst
+
+	return nil
+}
+
+// Instances returns the instances with a heartbeat at or after since, the
+// first started first.
+func (m *MemStore) Instances(since time.Time) ([]Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var instances []Instance
+	for _, inst := range m.instances {
+		if !inst.Heartbeat.Before(since) {
+			instances = append(instances, inst)
+		}
+	}
+	slices.SortFunc(instances, compareInstances)
+
+	return instances, nil
+}
+
+// RemoveInstance removes the instance with id from the registry.
+func (m *MemStore) RemoveInstance(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.instances, id)
+
+	return nil
+}
+
+// PurgeInstances removes the instances with a heartbeat before before and
+// returns the number removed.
+func (m *MemStore) PurgeInstances(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.instances)
+	maps.DeleteFunc(m.instances, func(_ string, inst Instance) bool {
+		return inst.Heartbeat.Before(before)
+	})
+
+	return n - len(m.instances), nil
+}
+
+// SetRouteState saves s, replacing the state of its route.
+func (m *MemStore) SetRouteState(s RouteState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.routes == nil {
+		m.routes = make(map[string]RouteState)
+	}
+	m.routes[s.Pattern] = s
+
+	return nil
+}
+
+// RouteStates returns the saved route states ordered by pattern.
+func (m *MemStore) RouteStates() ([]RouteState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var states []RouteState
+	for _, s := range m.routes {
+		states = append(states, s)
+	}
+	slices.SortFunc(states, func(a, b RouteState) int {
+		return strings.Compare(a.Pattern, b.Pattern)
+	})
+
+	return states, nil
+}
+
+// RemoveRouteState removes the state of the route with pattern.
+func (m *MemStore) RemoveRouteState(pattern string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.routes, pattern)
+
+	return nil
+}
+
+// BootstrapAdmin registers a confirmed admin with the given values, if
+// there are no users, and returns true, or returns false if there are.
+func (m *MemStore) BootstrapAdmin(username, fullName, email, password string) (bool, error) {
+	hashedPassword, err := hasherOrDefault(m.Hasher).Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.users) > 0 {
+		return false, nil
+	}
+
+	user := User{Username: username, FullName: fullName, Email: email, IsAdmin: true, Confirmed: true, Created: m.now()}
+	if err := m.addUser(user, hashedPassword); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// WaitlistedUsers returns the users held for approval, oldest first. Like
+// AuthDB.WaitlistedUsers, only the id, username, full name, email,
+// confirmed, and created fields are set.
+func (m *MemStore) WaitlistedUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []User
+	for _, u := range m.users {
+		if !u.Waitlisted {
+			continue
+		}
+		users = append(users, User{
+			ID:         u.ID,
+			Username:   u.Username,
+			FullName:   u.FullName,
+			Email:      u.Email,
+			Confirmed:  u.Confirmed,
+			Waitlisted: true,
+			Created:    u.Created,
+		})
+	}
+	slices.SortFunc(users, func(a, b User) int {
+		return cmp.Or(a.Created.Compare(b.Created), cmp.Compare(a.Username, b.Username))
+	})
+
+	return users, nil
+}
+
+// ApproveUsers approves each waitlisted user in usernames, so they can
+// login. A user that is not found is reported with ErrUserNotFound and a
+// user that is not waitlisted with ErrNotWaitlisted.
+func (m *MemStore) ApproveUsers(usernames []string) ([]BulkResult, error) {
+	return m.bulkUsers(usernames, func(u *memUser, result *BulkResult) {
+		if !u.Waitlisted {
+			result.Err = ErrNotWaitlisted
+			return
+		}
+		u.Waitlisted = false
+	}), nil
+}
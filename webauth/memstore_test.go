@@ -0,0 +1,320 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestMemStoreRegisterUser(t *testing.T) {
+	store := webauth.NewMemStore()
+
+	if err := store.RegisterUser("user", "Full Name", "user@email", "password"); err != nil {
+		t.Fatalf("RegisterUser() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		email    string
+		wantErr  error
+	}{
+		{"duplicateUsername", "USER", "other@email", webauth.ErrDuplicateKey},
+		{"duplicateEmail", "other", "User@Email", webauth.ErrDuplicateKey},
+		{"usernameTooLong", "1234567890123456789012345678901", "long@email", webauth.ErrValueTooLong},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := store.RegisterUser(tc.username, "Full Name", tc.email, "password")
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("RegisterUser(%q, %q) = %v, want %v", tc.username, tc.email, err, tc.wantErr)
+			}
+		})
+	}
+
+	if err := store.CheckPassword("user", "password"); err != nil {
+		t.Errorf("CheckPassword() = %v, want nil", err)
+	}
+}
+
+func TestMemStoreTokens(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	store.SetClock(clock)
+
+	expired, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1m")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	token, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	user, err := store.UserForLoginToken(token.Value)
+	if err != nil || user.Username != "test" {
+		t.Errorf("UserForLoginToken() = %q, %v, want %q", user.Username, err, "test")
+	}
+
+	clock.Advance(time.Minute + time.Second)
+
+	_, err = store.UserForLoginToken(expired.Value)
+	if !errors.Is(err, webauth.ErrUserLoginTokenExpired) {
+		t.Errorf("UserForLoginToken(expired) = %v, want %v", err, webauth.ErrUserLoginTokenExpired)
+	}
+
+	// Expired tokens are removed.
+	err = store.RemoveToken(webauth.LoginTokenKind, expired.Value)
+	if !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("RemoveToken(expired) = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+
+	_, err = store.CreateToken(webauth.LoginTokenKind, "nosuchuser", webauth.LoginTokenSize, "1h")
+	if !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("CreateToken(nosuchuser) = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+}
+
+func TestMemStoreConfirmUser(t *testing.T) {
+	store := StoreForTest(t)
+
+	token, err := store.CreateToken("confirm", "unconfirmed", webauth.ConfirmTokenSize, webauth.ConfirmTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	// The token of another user neither confirms the user nor is removed.
+	err = store.ConfirmUser("test", token.Value)
+	if !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("ConfirmUser() for another user = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+
+	if err := store.ConfirmUser("unconfirmed", token.Value); err != nil {
+		t.Fatalf("ConfirmUser() failed: %v", err)
+	}
+	if user, _ := store.UserForName("unconfirmed"); !user.Confirmed {
+		t.Error("user not confirmed")
+	}
+
+	err = store.ConfirmUser("unconfirmed", token.Value)
+	if !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("ConfirmUser() reuse = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+}
+
+func TestMemStoreRenameUser(t *testing.T) {
+	store := StoreForTest(t)
+
+	token, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if err := store.SetEmailPref("test", webauth.EmailDigest, false); err != nil {
+		t.Fatalf("SetEmailPref() failed: %v", err)
+	}
+	if err := store.LinkIdentity("google", "sub", "test"); err != nil {
+		t.Fatalf("LinkIdentity() failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		store.WriteEvent(webauth.EventLogin, true, "test", "")
+	}
+
+	before, _ := store.UserForName("test")
+
+	tests := []struct {
+		name        string
+		username    string
+		newUsername string
+		wantErr     error
+	}{
+		{"notFound", "missing", "other", webauth.ErrUserNotFound},
+		{"taken", "test", "ADMIN", webauth.ErrUsernameTaken},
+		{"tooLong", "test", "1234567890123456789012345678901", webauth.ErrValueTooLong},
+		{"caseOnly", "test", "Test", nil},
+		{"rename", "Test", "renamed", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := store.RenameUser(tc.username, tc.newUsername)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("RenameUser(%q, %q) = %v, want %v", tc.username, tc.newUsername, err, tc.wantErr)
+			}
+		})
+	}
+
+	if exists, _ := store.UserExists("test"); exists {
+		t.Errorf("old username still exists")
+	}
+
+	user, err := store.UserForLoginToken(token.Value)
+	if err != nil || user.Username != "renamed" || user.ID != before.ID {
+		t.Errorf("UserForLoginToken() = %+v, %v, want renamed user with id %q", user, err, before.ID)
+	}
+	if user.LastLoginTime.IsZero() {
+		t.Errorf("login history not kept")
+	}
+
+	prefs, err := store.EmailPrefs("renamed")
+	if err != nil || prefs[webauth.EmailDigest] {
+		t.Errorf("EmailPrefs() = %v, %v, want digest disabled", prefs, err)
+	}
+
+	if username, err := store.UsernameForIdentity("google", "sub"); username != "renamed" {
+		t.Errorf("UsernameForIdentity() = %q, %v, want %q", username, err, "renamed")
+	}
+}
+
+func TestMemStoreBulkUsers(t *testing.T) {
+	store := StoreForTest(t)
+
+	token, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if err := store.LinkIdentity("google", "sub", "confirmed"); err != nil {
+		t.Fatalf("LinkIdentity() failed: %v", err)
+	}
+
+	results, err := store.DisableUsers([]string{"test", "missing"})
+	if err != nil {
+		t.Fatalf("DisableUsers() failed: %v", err)
+	}
+	want := []webauth.BulkResult{{Username: "test"}, {Username: "missing", Err: webauth.ErrUserNotFound}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("DisableUsers() = %v, want %v", results, want)
+	}
+	if user, _ := store.UserForName("test"); !user.Disabled {
+		t.Errorf("user not disabled")
+	}
+	if _, err := store.UserForLoginToken(token.Value); !errors.Is(err, webauth.ErrUserLoginTokenNotFound) {
+		t.Errorf("UserForLoginToken() after disable = %v, want %v", err, webauth.ErrUserLoginTokenNotFound)
+	}
+
+	confirmed, err := store.UserForName("confirmed")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+	store.WriteEvent(webauth.EventLogin, true, "confirmed", "")
+
+	results, err = store.DeleteUsers([]string{"confirmed"})
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("DeleteUsers() = %v, %v, want success", results, err)
+	}
+	pseudonym := webauth.Pseudonym(confirmed.ID)
+	if results[0].Pseudonym != pseudonym || !strings.HasPrefix(pseudonym, webauth.PseudonymPrefix) {
+		t.Errorf("DeleteUsers() pseudonym = %q, want %q", results[0].Pseudonym, pseudonym)
+	}
+	if events := eventsOf(t, store, pseudonym); len(events) != 1 {
+		t.Errorf("events of pseudonym = %+v, want the login event", events)
+	}
+	if events := eventsOf(t, store, "confirmed"); len(events) != 0 {
+		t.Errorf("events of deleted user = %+v, want none", events)
+	}
+	if exists, _ := store.UserExists("confirmed"); exists {
+		t.Errorf("deleted user still exists")
+	}
+	if _, err := store.UsernameForIdentity("google", "sub"); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("UsernameForIdentity() after delete = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+}
+
+func TestMemStorePrefs(t *testing.T) {
+	store := StoreForTest(t)
+
+	if _, err := store.Pref("test", "a"); !errors.Is(err, webauth.ErrPrefNotFound) {
+		t.Errorf("Pref() = %v, want %v", err, webauth.ErrPrefNotFound)
+	}
+	if err := store.SetPref("missing", "a", "1"); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("SetPref() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+
+	for _, name := range []string{"view:b", "view:a", "other"} {
+		if err := store.SetPref("test", name, "1"); err != nil {
+			t.Fatalf("SetPref(%q) failed: %v", name, err)
+		}
+	}
+	if err := store.SetPref("test", "view:a", "2"); err != nil {
+		t.Fatalf("SetPref() replace failed: %v", err)
+	}
+
+	if got, err := store.Pref("TEST", "view:a"); got != "2" || err != nil {
+		t.Errorf("Pref() = %q, %v, want %q", got, err, "2")
+	}
+
+	names, err := store.PrefNames("test", "view:")
+	if err != nil || !reflect.DeepEqual(names, []string{"view:a", "view:b"}) {
+		t.Errorf("PrefNames() = %q, %v, want [view:a view:b]", names, err)
+	}
+
+	if err := store.DeletePref("test", "view:a"); err != nil {
+		t.Fatalf("DeletePref() failed: %v", err)
+	}
+	if _, err := store.Pref("test", "view:a"); !errors.Is(err, webauth.ErrPrefNotFound) {
+		t.Errorf("Pref() after delete = %v, want %v", err, webauth.ErrPrefNotFound)
+	}
+}
+
+func TestMemStoreRateLimits(t *testing.T) {
+	store := StoreForTest(t)
+
+	w1 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	w2 := w1.Add(time.Minute)
+
+	counts := []struct {
+		key    string
+		window time.Time
+		want   int
+	}{
+		{"ip:a", w1, 1},
+		{"ip:a", w1, 2},
+		{"ip:b", w1, 1},
+		{"ip:b", w2, 1},
+		{"ip:a", w2, 1},
+		{"ip:b", w2, 2},
+	}
+	for _, c := range counts {
+		got, err := store.CountRequest(c.key, c.window)
+		if err != nil {
+			t.Fatalf("CountRequest(%q) failed: %v", c.key, err)
+		}
+		if got != c.want {
+			t.Errorf("CountRequest(%q, %v) = %d, want %d", c.key, c.window, got, c.want)
+		}
+	}
+
+	got, err := store.RateLimitUsage(w1)
+	if err != nil {
+		t.Fatalf("RateLimitUsage failed: %v", err)
+	}
+	want := []webauth.RateLimitUsage{
+		{Key: "ip:a", Window: w1, Requests: 2},
+		{Key: "ip:b", Window: w2, Requests: 2},
+		{Key: "ip:a", Window: w2, Requests: 1},
+		{Key: "ip:b", Window: w1, Requests: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RateLimitUsage() = %v, want %v", got, want)
+	}
+
+	// Counts for the first window are removed by a purge.
+	if n, err := store.PurgeRateLimits(w2); n != 2 || err != nil {
+		t.Errorf("PurgeRateLimits() = %d, %v, want 2", n, err)
+	}
+	if got, _ := store.RateLimitUsage(w1); len(got) != 2 {
+		t.Errorf("RateLimitUsage() after purge = %v, want 2 counts", got)
+	}
+
+	if _, err := store.CountRequest(strings.Repeat("k", webauth.MaxRateLimitKeyLen+1), w2); !errors.Is(err, webauth.ErrValueTooLong) {
+		t.Errorf("CountRequest() for long key = %v, want %v", err, webauth.ErrValueTooLong)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bnixon67/webapp/webauth/migrations"
+)
+
+// migrationDialect returns the migrations directory for the dialect of db.
+func (db *AuthDB) migrationDialect() string {
+	if db.Dialect == "" {
+		return string(DialectMySQL)
+	}
+
+	return string(db.Dialect)
+}
+
+// Migrate applies the pending schema migrations to db and returns them.
+func (db *AuthDB) Migrate(ctx context.Context) ([]migrations.Migration, error) {
+	if db == nil || db.DB == nil {
+		return nil, ErrInvalidDB
+	}
+
+	ran, err := migrations.Apply(ctx, db.DB, db.migrationDialect())
+	for _, m := range ran {
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	if err != nil {
+		return ran, fmt.Errorf("Migrate: %w", err)
+	}
+
+	return ran, nil
+}
+
+// MigrationStatus returns whether each schema migration is applied to db.
+func (db *AuthDB) MigrationStatus(ctx context.Context) ([]migrations.Status, error) {
+	if db == nil || db.DB == nil {
+		return nil, ErrInvalidDB
+	}
+
+	return migrations.Statuses(ctx, db.DB, db.migrationDialect())
+}
+
+// CheckSchema returns a *migrations.MismatchError if the migrations
+// applied to db are not those of the binary.
+func (db *AuthDB) CheckSchema(ctx context.Context) error {
+	if db == nil || db.DB == nil {
+		return ErrInvalidDB
+	}
+
+	return migrations.Check(ctx, db.DB, db.migrationDialect())
+}
+
+// OpenDB opens the database described by cfg with InitDB. If cfg.Migrate
+// is set, the pending migrations are applied. Otherwise, a warning is
+// logged if any are pending.
+func OpenDB(cfg ConfigSQL) (*AuthDB, error) {
+	db, err := InitDB(cfg.DriverName, cfg.DataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	if cfg.Migrate {
+		if _, err := db.Migrate(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
+	}
+
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		slog.Warn("failed to get migration status", "err", err)
+	} else if n := migrations.Pending(status); n > 0 {
+		slog.Warn("database has pending migrations", "pending", n)
+	}
+
+	return db, nil
+}
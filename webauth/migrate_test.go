@@ -0,0 +1,54 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webauth/migrations"
+)
+
+func TestMigrateInvalidDB(t *testing.T) {
+	var db *webauth.AuthDB
+
+	if _, err := db.Migrate(context.Background()); !errors.Is(err, webauth.ErrInvalidDB) {
+		t.Errorf("Migrate() error = %v, want %v", err, webauth.ErrInvalidDB)
+	}
+	if _, err := db.MigrationStatus(context.Background()); !errors.Is(err, webauth.ErrInvalidDB) {
+		t.Errorf("MigrationStatus() error = %v, want %v", err, webauth.ErrInvalidDB)
+	}
+	if err := db.CheckSchema(context.Background()); !errors.Is(err, webauth.ErrInvalidDB) {
+		t.Errorf("CheckSchema() error = %v, want %v", err, webauth.ErrInvalidDB)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := DBForTest(t)
+	ctx := context.Background()
+
+	// The test database was created from the current schema, so applying
+	// the migrations upgrades it in place.
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus() failed: %v", err)
+	}
+	if n := migrations.Pending(status); n != 0 {
+		t.Errorf("Pending() = %d after Migrate(), want 0", n)
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema() after Migrate() = %v, want nil", err)
+	}
+
+	ran, err := db.Migrate(ctx)
+	if err != nil || len(ran) != 0 {
+		t.Errorf("Migrate() again = %v, %v, want none", ran, err)
+	}
+}
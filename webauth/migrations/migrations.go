@@ -0,0 +1,367 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package migrations applies the versioned SQL migrations that create and
+// upgrade the webauth database.
+//
+// Migrations are embedded SQL files named NNNN_name.sql in a directory for
+// each dialect: mysql, postgres, and sqlite. The applied versions are
+// recorded in the schema_migrations table. The first migration uses
+// CREATE TABLE IF NOT EXISTS, so a database created from the files in
+// webauth/sql is upgraded in place.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	ErrUnknownDialect = errors.New("unknown dialect")
+	ErrInvalidName    = errors.New("invalid migration name")
+	ErrUnknownVersion = errors.New("database has unknown migration")
+)
+
+// Migration is a versioned change to the schema.
+type Migration struct {
+	Version int    // Version orders the migrations, starting at 1.
+	Name    string // Name describes the migration.
+	SQL     string // SQL has statements separated by semicolons.
+}
+
+// Status is a Migration and whether it has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // AppliedAt is the zero time if not Applied.
+}
+
+// Load returns the migrations for dialect, sorted by version.
+func Load(dialect string) ([]Migration, error) {
+	return load(files, dialect)
+}
+
+// load returns the migrations in directory dialect of fsys.
+func load(fsys fs.FS, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDialect, dialect)
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version < 1 || name == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, e.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dialect, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(b)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("%w: duplicate version %d", ErrInvalidName, migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Statements returns the statements in m, without lines that start with
+// "--". Comments must not contain a semicolon.
+func (m Migration) Statements() []string {
+	var stmts []string
+
+	for _, s := range strings.Split(m.SQL, ";") {
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				lines = append(lines, line)
+			}
+		}
+
+		if s = strings.TrimSpace(strings.Join(lines, "\n")); s != "" {
+			stmts = append(stmts, s)
+		}
+	}
+
+	return stmts
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version integer NOT NULL,
+  name varchar(100) NOT NULL,
+  applied timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (version)
+)`
+
+// placeholders returns the placeholders for n parameters in dialect.
+func placeholders(dialect string, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		if dialect == "postgres" {
+			p[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			p[i] = "?"
+		}
+	}
+
+	return strings.Join(p, ", ")
+}
+
+// applied returns the time each version was applied to db.
+func applied(ctx context.Context, db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.ExecContext(ctx, createTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version int
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+
+	return versions, rows.Err()
+}
+
+// Apply applies the migrations for dialect that have not been applied to
+// db, in order, and returns them. Each migration is applied in its own
+// transaction, though MySQL commits after each DDL statement.
+func Apply(ctx context.Context, db *sql.DB, dialect string) ([]Migration, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return apply(ctx, db, dialect, migrations)
+}
+
+// apply applies the pending migrations to db.
+func apply(ctx context.Context, db *sql.DB, dialect string, migrations []Migration) ([]Migration, error) {
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	if err := checkKnown(done, migrations); err != nil {
+		return nil, err
+	}
+
+	insert := "INSERT INTO schema_migrations(version, name) VALUES (" + placeholders(dialect, 2) + ")"
+
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+
+		if err := applyOne(ctx, db, m, insert); err != nil {
+			return ran, fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+
+	return ran, nil
+}
+
+// checkKnown returns an error if a version in done is not in migrations,
+// e.g., if the database was migrated by a newer release.
+func checkKnown(done map[int]time.Time, migrations []Migration) error {
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+
+	for v := range done {
+		if !known[v] {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, v)
+		}
+	}
+
+	return nil
+}
+
+// applyOne runs the statements of m and records it with insert.
+func applyOne(ctx context.Context, db *sql.DB, m Migration, insert string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.Statements() {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, insert, m.Version, m.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Statuses returns the status of each migration for dialect in db.
+func Statuses(ctx context.Context, db *sql.DB, dialect string) ([]Status, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses(ctx, db, migrations)
+}
+
+// statuses returns the status of migrations in db.
+func statuses(ctx context.Context, db *sql.DB, migrations []Migration) ([]Status, error) {
+	done, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make([]Status, len(migrations))
+	for i, m := range migrations {
+		at, ok := done[m.Version]
+		s[i] = Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at}
+	}
+
+	return s, nil
+}
+
+// Pending returns the number of statuses that are not applied.
+func Pending(statuses []Status) int {
+	n := 0
+	for _, s := range statuses {
+		if !s.Applied {
+			n++
+		}
+	}
+
+	return n
+}
+
+// ErrSchemaMismatch is returned by Check if the migrations applied to a
+// database are not those of the binary.
+var ErrSchemaMismatch = errors.New("database schema does not match")
+
+// MismatchError is the difference between the migrations applied to a
+// database and those embedded in the binary. It is ErrSchemaMismatch.
+type MismatchError struct {
+	Dialect string
+	Pending []int // Pending versions of the binary are not applied to the database.
+	Unknown []int // Unknown versions applied to the database are not in the binary.
+}
+
+func (e *MismatchError) Error() string {
+	var diffs []string
+	if len(e.Pending) > 0 {
+		diffs = append(diffs, fmt.Sprintf("pending migrations %v", e.Pending))
+	}
+	if len(e.Unknown) > 0 {
+		diffs = append(diffs, fmt.Sprintf("unknown migrations %v", e.Unknown))
+	}
+
+	return ErrSchemaMismatch.Error() + ": " + strings.Join(diffs, ", ")
+}
+
+// Is returns true if target is ErrSchemaMismatch.
+func (e *MismatchError) Is(target error) bool {
+	return target == ErrSchemaMismatch
+}
+
+// Remedy returns how an operator fixes the mismatch.
+func (e *MismatchError) Remedy() string {
+	if len(e.Unknown) > 0 {
+		return "the database was migrated by a newer release, so deploy that release or restore the database from a backup"
+	}
+
+	return "restart with SQL.Migrate set to true to apply the pending migrations, or apply them from webauth/migrations/" + e.Dialect
+}
+
+// Check returns a *MismatchError if the migrations applied to db are not
+// those for dialect, such as if a release was deployed without migrating
+// the database, or nil if they match.
+func Check(ctx context.Context, db *sql.DB, dialect string) error {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return err
+	}
+
+	err = check(ctx, db, migrations)
+	var e *MismatchError
+	if errors.As(err, &e) {
+		e.Dialect = dialect
+	}
+
+	return err
+}
+
+// check returns a *MismatchError if the migrations applied to db are not
+// migrations.
+func check(ctx context.Context, db *sql.DB, migrations []Migration) error {
+	done, err := applied(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	e := &MismatchError{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		if _, ok := done[m.Version]; !ok {
+			e.Pending = append(e.Pending, m.Version)
+		}
+	}
+	for v := range done {
+		if !known[v] {
+			e.Unknown = append(e.Unknown, v)
+		}
+	}
+	sort.Ints(e.Unknown)
+
+	if len(e.Pending) == 0 && len(e.Unknown) == 0 {
+		return nil
+	}
+
+	return e
+}
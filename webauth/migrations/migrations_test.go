@@ -0,0 +1,364 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeState is the state of a fake database that records statements and
+// the schema_migrations table.
+type fakeState struct {
+	mu      sync.Mutex
+	applied map[int64]time.Time
+	execs   []string
+	failOn  string // failOn fails statements that contain it.
+}
+
+func newFakeDB(t *testing.T, applied ...int64) (*sql.DB, *fakeState) {
+	st := &fakeState{applied: make(map[int64]time.Time)}
+	for _, v := range applied {
+		st.applied[v] = time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	db := sql.OpenDB(fakeConnector{st})
+	t.Cleanup(func() { db.Close() })
+
+	return db, st
+}
+
+type fakeConnector struct{ st *fakeState }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{st: c.st}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return nil }
+
+// fakeConn buffers changes in a transaction until it is committed.
+type fakeConn struct {
+	st      *fakeState
+	pending map[int64]time.Time
+	execs   []string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.pending = make(map[int64]time.Time)
+	c.execs = nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.st.mu.Lock()
+	defer c.st.mu.Unlock()
+
+	for v, at := range c.pending {
+		c.st.applied[v] = at
+	}
+	c.st.execs = append(c.st.execs, c.execs...)
+	c.pending, c.execs = nil, nil
+
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending, c.execs = nil, nil
+	return nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	c := s.c
+
+	if c.st.failOn != "" && strings.Contains(s.query, c.st.failOn) {
+		return nil, errors.New("fake failure")
+	}
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(s.query, "INSERT INTO schema_migrations"):
+		c.pending[args[0].(int64)] = time.Now()
+	case c.pending != nil:
+		c.execs = append(c.execs, s.query)
+	default:
+		c.st.mu.Lock()
+		c.st.execs = append(c.st.execs, s.query)
+		c.st.mu.Unlock()
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.query != "SELECT version, applied FROM schema_migrations" {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+
+	s.c.st.mu.Lock()
+	defer s.c.st.mu.Unlock()
+
+	rows := &fakeRows{}
+	for v, at := range s.c.st.applied {
+		rows.values = append(rows.values, []driver.Value{v, at})
+	}
+
+	return rows, nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "applied"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
+
+// testMigrations returns two migrations, the second with two statements.
+func testMigrations(t *testing.T) []Migration {
+	fsys := fstest.MapFS{
+		"mysql/0001_initial.sql":    {Data: []byte("CREATE TABLE a (x int);\n")},
+		"mysql/0002_add_b.sql":      {Data: []byte("CREATE TABLE b (x int);\nCREATE INDEX b_x ON b (x);\n")},
+		"mysql/README":              {Data: []byte("ignored")},
+		"postgres/0001_initial.sql": {Data: []byte("CREATE TABLE a (x int);\n")},
+	}
+
+	m, err := load(fsys, "mysql")
+	if err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+
+	return m
+}
+
+func versions(migrations []Migration) []int {
+	var v []int
+	for _, m := range migrations {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+func TestLoadEmbedded(t *testing.T) {
+	var want []Migration
+
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		got, err := Load(dialect)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", dialect, err)
+		}
+		if len(got) == 0 || got[0].Version != 1 || got[0].Name != "initial" {
+			t.Fatalf("Load(%q) first migration = %+v, want 0001_initial", dialect, got)
+		}
+
+		for _, table := range []string{"users", "tokens", "events", "email_prefs", "email_bounces", "incidents", "user_identities"} {
+			if !strings.Contains(got[0].SQL, "EXISTS "+table+" (") && !strings.Contains(got[0].SQL, "EXISTS `"+table+"` (") {
+				t.Errorf("Load(%q) initial migration missing table %q", dialect, table)
+			}
+		}
+
+		// Each dialect must have the same migrations.
+		if want == nil {
+			want = got
+			continue
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Load(%q) has %d migrations, want %d", dialect, len(got), len(want))
+		}
+		for i := range got {
+			if got[i].Version != want[i].Version || got[i].Name != want[i].Name {
+				t.Errorf("Load(%q)[%d] = %04d_%s, want %04d_%s", dialect, i,
+					got[i].Version, got[i].Name, want[i].Version, want[i].Name)
+			}
+		}
+	}
+
+	if _, err := Load("oracle"); !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("Load(oracle) error = %v, want %v", err, ErrUnknownDialect)
+	}
+}
+
+func TestLoadInvalidName(t *testing.T) {
+	for _, name := range []string{"initial.sql", "0_initial.sql", "x1_initial.sql", "0001_.sql"} {
+		fsys := fstest.MapFS{"mysql/" + name: {Data: []byte("SELECT 1;")}}
+		if _, err := load(fsys, "mysql"); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("load(%q) error = %v, want %v", name, err, ErrInvalidName)
+		}
+	}
+
+	fsys := fstest.MapFS{
+		"mysql/0001_a.sql": {Data: []byte("SELECT 1;")},
+		"mysql/0001_b.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := load(fsys, "mysql"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("load(duplicate) error = %v, want %v", err, ErrInvalidName)
+	}
+}
+
+func TestApplyNewDatabase(t *testing.T) {
+	db, st := newFakeDB(t)
+	migrations := testMigrations(t)
+
+	ran, err := apply(context.Background(), db, "mysql", migrations)
+	if err != nil {
+		t.Fatalf("apply() failed: %v", err)
+	}
+	if got := versions(ran); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("apply() ran %v, want [1 2]", got)
+	}
+	if len(st.execs) != 3 {
+		t.Errorf("apply() ran statements %q, want 3", st.execs)
+	}
+
+	// Applying again does nothing.
+	ran, err = apply(context.Background(), db, "mysql", migrations)
+	if err != nil || len(ran) != 0 {
+		t.Errorf("apply() again = %v, %v, want none", versions(ran), err)
+	}
+}
+
+func TestApplyUpgrade(t *testing.T) {
+	// A database at version 1, e.g., created from the current schema.
+	db, st := newFakeDB(t, 1)
+
+	ran, err := apply(context.Background(), db, "mysql", testMigrations(t))
+	if err != nil {
+		t.Fatalf("apply() failed: %v", err)
+	}
+	if got := versions(ran); len(got) != 1 || got[0] != 2 {
+		t.Errorf("apply() ran %v, want [2]", got)
+	}
+	if len(st.execs) != 2 || !strings.HasPrefix(st.execs[0], "CREATE TABLE b") {
+		t.Errorf("apply() ran statements %q, want those of 0002", st.execs)
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	db, st := newFakeDB(t)
+	st.failOn = "CREATE INDEX"
+
+	ran, err := apply(context.Background(), db, "mysql", testMigrations(t))
+	if err == nil || !strings.Contains(err.Error(), "0002_add_b") {
+		t.Fatalf("apply() error = %v, want failure of 0002_add_b", err)
+	}
+	if got := versions(ran); len(got) != 1 || got[0] != 1 {
+		t.Errorf("apply() ran %v, want [1]", got)
+	}
+	if _, ok := st.applied[2]; ok {
+		t.Errorf("failed migration recorded as applied")
+	}
+}
+
+func TestApplyUnknownVersion(t *testing.T) {
+	db, _ := newFakeDB(t, 1, 99)
+
+	_, err := apply(context.Background(), db, "mysql", testMigrations(t))
+	if !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("apply() error = %v, want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	db, _ := newFakeDB(t, 1)
+
+	got, err := statuses(context.Background(), db, testMigrations(t))
+	if err != nil {
+		t.Fatalf("statuses() failed: %v", err)
+	}
+
+	if len(got) != 2 || !got[0].Applied || got[0].AppliedAt.IsZero() || got[1].Applied {
+		t.Errorf("statuses() = %+v, want 1 applied and 2 pending", got)
+	}
+	if n := Pending(got); n != 1 {
+		t.Errorf("Pending() = %d, want 1", n)
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	if got := placeholders("postgres", 2); got != "$1, $2" {
+		t.Errorf("placeholders(postgres) = %q, want %q", got, "$1, $2")
+	}
+	if got := placeholders("mysql", 2); got != "?, ?" {
+		t.Errorf("placeholders(mysql) = %q, want %q", got, "?, ?")
+	}
+}
+
+func TestStatements(t *testing.T) {
+	m := Migration{SQL: "-- comment\nCREATE TABLE a (x int);\n\n-- another\n  -- indented\nDROP TABLE b;\n-- trailing\n"}
+
+	got := m.Statements()
+	if len(got) != 2 || got[0] != "CREATE TABLE a (x int)" || got[1] != "DROP TABLE b" {
+		t.Errorf("Statements() = %q, want two statements without comments", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int64
+		pending []int
+		unknown []int
+	}{
+		{"current", []int64{1, 2}, nil, nil},
+		{"behind", []int64{1}, []int{2}, nil},
+		{"new", nil, []int{1, 2}, nil},
+		{"ahead", []int64{1, 2, 4, 3}, nil, []int{3, 4}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := newFakeDB(t, tc.applied...)
+
+			err := check(context.Background(), db, testMigrations(t))
+			if tc.pending == nil && tc.unknown == nil {
+				if err != nil {
+					t.Fatalf("check() = %v, want nil", err)
+				}
+				return
+			}
+
+			var e *MismatchError
+			if !errors.As(err, &e) || !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("check() = %v, want %v", err, ErrSchemaMismatch)
+			}
+			if !reflect.DeepEqual(e.Pending, tc.pending) || !reflect.DeepEqual(e.Unknown, tc.unknown) {
+				t.Errorf("check() = pending %v unknown %v, want %v %v", e.Pending, e.Unknown, tc.pending, tc.unknown)
+			}
+			if e.Remedy() == "" {
+				t.Error("Remedy() is empty")
+			}
+		})
+	}
+}
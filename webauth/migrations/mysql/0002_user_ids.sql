@@ -0,0 +1,26 @@
+-- Give each user a stable id and use it, rather than the username, to
+-- reference users so they can be renamed. Events keep the username at the
+-- time of the event along with the id.
+
+ALTER TABLE `users` ADD COLUMN `id` char(36) NULL FIRST;
+UPDATE `users` SET `id` = UUID();
+ALTER TABLE `users` MODIFY `id` char(36) NOT NULL, ADD UNIQUE KEY `id` (`id`);
+
+ALTER TABLE `tokens` ADD COLUMN `user_id` char(36) NULL AFTER `kind`;
+UPDATE `tokens` JOIN `users` ON `tokens`.`username` = `users`.`username` SET `tokens`.`user_id` = `users`.`id`;
+DELETE FROM `tokens` WHERE `user_id` IS NULL;
+ALTER TABLE `tokens` DROP COLUMN `username`, MODIFY `user_id` char(36) NOT NULL, ADD KEY `user_id` (`user_id`);
+
+ALTER TABLE `email_prefs` ADD COLUMN `user_id` char(36) NULL FIRST;
+UPDATE `email_prefs` JOIN `users` ON `email_prefs`.`username` = `users`.`username` SET `email_prefs`.`user_id` = `users`.`id`;
+DELETE FROM `email_prefs` WHERE `user_id` IS NULL;
+ALTER TABLE `email_prefs` DROP PRIMARY KEY, DROP COLUMN `username`, MODIFY `user_id` char(36) NOT NULL, ADD PRIMARY KEY (`user_id`,`category`);
+
+ALTER TABLE `user_identities` ADD COLUMN `user_id` char(36) NULL AFTER `subject`;
+UPDATE `user_identities` JOIN `users` ON `user_identities`.`username` = `users`.`username` SET `user_identities`.`user_id` = `users`.`id`;
+DELETE FROM `user_identities` WHERE `user_id` IS NULL;
+ALTER TABLE `user_identities` DROP COLUMN `username`, MODIFY `user_id` char(36) NOT NULL, ADD KEY `user_id` (`user_id`);
+
+ALTER TABLE `events` ADD COLUMN `user_id` char(36) NULL AFTER `username`;
+UPDATE `events` JOIN `users` ON `events`.`username` = `users`.`username` SET `events`.`user_id` = `users`.`id`;
+ALTER TABLE `events` ADD KEY `user_id` (`user_id`);
@@ -0,0 +1,8 @@
+-- Store named preferences of each user, such as saved table views.
+
+CREATE TABLE `user_prefs` (
+  `user_id` char(36) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `value` varchar(1000) NOT NULL,
+  PRIMARY KEY (`user_id`,`name`)
+);
@@ -0,0 +1,9 @@
+-- Store single-use nonces of sensitive forms, so a captured submission
+-- cannot be replayed.
+
+CREATE TABLE `form_nonces` (
+  `hashedValue` char(64) NOT NULL,
+  `form` varchar(30) NOT NULL,
+  `expires` timestamp NOT NULL,
+  PRIMARY KEY (`hashedValue`)
+);
@@ -0,0 +1,11 @@
+-- Count Content Security Policy violations reported by browsers by
+-- directive and blocked URI.
+
+CREATE TABLE `csp_reports` (
+  `directive` varchar(100) NOT NULL,
+  `blocked_uri` varchar(255) NOT NULL,
+  `reports` int NOT NULL,
+  `first_seen` timestamp NOT NULL,
+  `last_seen` timestamp NOT NULL,
+  PRIMARY KEY (`directive`,`blocked_uri`)
+);
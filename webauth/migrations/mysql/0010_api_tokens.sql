@@ -0,0 +1,8 @@
+-- Name API tokens and limit them to scopes. The id identifies a token to
+-- its user without revealing the value.
+
+ALTER TABLE `tokens`
+  ADD COLUMN `id` char(36) NULL,
+  ADD COLUMN `name` varchar(50) NOT NULL DEFAULT "",
+  ADD COLUMN `scopes` varchar(255) NOT NULL DEFAULT "",
+  ADD UNIQUE KEY `id` (`id`);
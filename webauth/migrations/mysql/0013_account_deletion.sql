@@ -0,0 +1,4 @@
+-- Schedule the deletion of an account requested by its user. The account
+-- is purged after a grace period in which the user can cancel.
+
+ALTER TABLE `users` ADD COLUMN `delete_after` datetime NULL;
@@ -0,0 +1,16 @@
+-- Record audited actions with their actor, target, client, and result.
+
+CREATE TABLE `audit_log` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `created` timestamp(6) NOT NULL DEFAULT current_timestamp(6),
+  `actor` varchar(30) NOT NULL DEFAULT "",
+  `action` varchar(30) NOT NULL,
+  `target` varchar(255) NOT NULL DEFAULT "",
+  `ip` varchar(45) NOT NULL DEFAULT "",
+  `user_agent` varchar(255) NOT NULL DEFAULT "",
+  `result` varchar(10) NOT NULL,
+  `metadata` text,
+  PRIMARY KEY (`id`),
+  KEY `created` (`created`),
+  KEY `actor` (`actor`)
+);
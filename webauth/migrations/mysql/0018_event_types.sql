@@ -0,0 +1,54 @@
+-- Classify events by type, with their details as JSON, so that they can be
+-- filtered without parsing the message. The type of existing events is set
+-- from their message where it is known. Their details are left empty.
+
+ALTER TABLE `events` ADD COLUMN `type` varchar(30) NOT NULL DEFAULT '';
+ALTER TABLE `events` ADD COLUMN `details` text NULL;
+CREATE INDEX `events_type` ON `events` (`type`);
+
+UPDATE `events` SET `type` = 'login.password' WHERE `name` = 'login' AND `succeeded` = true AND `message` = 'logged in user' AND `type` = '';
+UPDATE `events` SET `type` = 'login.magic' WHERE `name` = 'login' AND `succeeded` = true AND `message` = 'login with magic link' AND `type` = '';
+UPDATE `events` SET `type` = 'login.oauth' WHERE `name` = 'login' AND `succeeded` = true AND `message` LIKE 'login with %' AND `type` = '';
+UPDATE `events` SET `type` = 'login.magic_failed' WHERE `name` = 'login' AND `succeeded` = false AND `message` LIKE 'magic link: %' AND `type` = '';
+UPDATE `events` SET `type` = 'geo' WHERE `name` IN ('login', 'register') AND `succeeded` = false AND `message` LIKE '% by rule % from %' AND `type` = '';
+UPDATE `events` SET `type` = 'risk' WHERE `name` IN ('login', 'register') AND `succeeded` = false AND `message` LIKE '% by risk score %' AND `type` = '';
+UPDATE `events` SET `type` = 'login.failed' WHERE `name` = 'login' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'logout' WHERE `name` = 'logout' AND `succeeded` = true AND `message` = 'logged out user' AND `type` = '';
+UPDATE `events` SET `type` = 'register.user' WHERE `name` = 'register' AND `succeeded` = true AND `message` = 'registered user' AND `type` = '';
+UPDATE `events` SET `type` = 'register.oauth' WHERE `name` = 'register' AND `succeeded` = true AND `message` LIKE 'registered with %' AND `type` = '';
+UPDATE `events` SET `type` = 'register.username_exists' WHERE `name` = 'register' AND `succeeded` = false AND `message` = 'user name already exists' AND `type` = '';
+UPDATE `events` SET `type` = 'register.email_exists' WHERE `name` = 'register' AND `succeeded` = false AND `message` LIKE 'email already exists: %' AND `type` = '';
+UPDATE `events` SET `type` = 'register.breached' WHERE `name` = 'register' AND `succeeded` = false AND `message` = 'breached password' AND `type` = '';
+UPDATE `events` SET `type` = 'register.failed' WHERE `name` = 'register' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'confirmed' WHERE `name` = 'confirmed' AND `succeeded` = true AND `message` = 'success' AND `type` = '';
+UPDATE `events` SET `type` = 'resend.sent' WHERE `name` = 'resend' AND `succeeded` = true AND `message` = 'sent confirm token' AND `type` = '';
+UPDATE `events` SET `type` = 'resend.failed' WHERE `name` = 'resend' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'reset_pass.succeeded' WHERE `name` = 'reset_pass' AND `succeeded` = true AND `message` = 'success' AND `type` = '';
+UPDATE `events` SET `type` = 'reset_pass.breached' WHERE `name` = 'reset_pass' AND `succeeded` = false AND `message` = 'breached password' AND `type` = '';
+UPDATE `events` SET `type` = 'reset_pass.nonce' WHERE `name` = 'reset_pass' AND `succeeded` = false AND `message` = 'invalid form nonce' AND `type` = '';
+UPDATE `events` SET `type` = 'reset_pass.used' WHERE `name` = 'reset_pass' AND `succeeded` = false AND `message` = 'reset token already used' AND `type` = '';
+UPDATE `events` SET `type` = 'rename.admin' WHERE `name` = 'rename' AND `succeeded` = true AND `message` LIKE 'renamed from % by %' AND `type` = '';
+UPDATE `events` SET `type` = 'rename.self' WHERE `name` = 'rename' AND `succeeded` = true AND `message` LIKE 'changed from %' AND `type` = '';
+UPDATE `events` SET `type` = 'disable.admin' WHERE `name` = 'disable' AND `succeeded` = true AND `message` LIKE 'disable by %' AND `type` = '';
+UPDATE `events` SET `type` = 'delete.admin' WHERE `name` = 'delete' AND `succeeded` = true AND `message` LIKE 'delete by %' AND `type` = '';
+UPDATE `events` SET `type` = 'delete.scheduled' WHERE `name` = 'delete' AND `succeeded` = true AND `message` LIKE 'deletion scheduled for %' AND `type` = '';
+UPDATE `events` SET `type` = 'delete.canceled' WHERE `name` = 'delete' AND `succeeded` = true AND `message` = 'deletion canceled' AND `type` = '';
+UPDATE `events` SET `type` = 'delete.purged' WHERE `name` = 'delete' AND `succeeded` = true AND `message` = 'account deleted at user request' AND `type` = '';
+UPDATE `events` SET `type` = 'api_token.created' WHERE `name` = 'api_token' AND `succeeded` = true AND `message` LIKE 'created %' AND `type` = '';
+UPDATE `events` SET `type` = 'api_token.revoked' WHERE `name` = 'api_token' AND `succeeded` = true AND `message` LIKE 'revoked %' AND `type` = '';
+UPDATE `events` SET `type` = 'refresh.reused' WHERE `name` = 'refresh' AND `succeeded` = false AND `message` = 'refresh token reused, sessions revoked' AND `type` = '';
+UPDATE `events` SET `type` = 'refresh.failed' WHERE `name` = 'refresh' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'email_pref.saved' WHERE `name` = 'email_pref' AND `succeeded` = true AND `message` = 'saved email preferences' AND `type` = '';
+UPDATE `events` SET `type` = 'email_pref.unsubscribed' WHERE `name` = 'email_pref' AND `succeeded` = true AND `message` LIKE 'unsubscribed from %' AND `type` = '';
+UPDATE `events` SET `type` = 'bounce' WHERE `name` = 'bounce' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'incident.created' WHERE `name` = 'incident' AND `succeeded` = true AND `message` LIKE 'created %' AND `type` = '';
+UPDATE `events` SET `type` = 'incident.resolved' WHERE `name` = 'incident' AND `succeeded` = true AND `message` LIKE 'resolved %' AND `type` = '';
+UPDATE `events` SET `type` = 'oauth.email_exists' WHERE `name` = 'oauth' AND `succeeded` = false AND `message` LIKE '%: email exists: %' AND `type` = '';
+UPDATE `events` SET `type` = 'oauth.failed' WHERE `name` = 'oauth' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'oauth.linked' WHERE `name` = 'oauth' AND `succeeded` = true AND `message` LIKE 'linked %' AND `type` = '';
+UPDATE `events` SET `type` = 'panic' WHERE `name` = 'panic' AND `succeeded` = false AND `type` = '';
+UPDATE `events` SET `type` = 'profile.name' WHERE `name` = 'profile' AND `succeeded` = true AND `message` = 'full name changed' AND `type` = '';
+UPDATE `events` SET `type` = 'profile.email_exists' WHERE `name` = 'profile' AND `succeeded` = false AND `message` LIKE 'email already exists: %' AND `type` = '';
+UPDATE `events` SET `type` = 'profile.email_requested' WHERE `name` = 'profile' AND `succeeded` = true AND `message` LIKE 'email change requested: %' AND `type` = '';
+UPDATE `events` SET `type` = 'profile.email_changed' WHERE `name` = 'profile' AND `succeeded` = true AND `message` LIKE 'email changed to %' AND `type` = '';
+UPDATE `events` SET `type` = 'screen' WHERE `name` = 'screen' AND `succeeded` = false AND `type` = '';
@@ -0,0 +1,6 @@
+-- Give each event a unique, time-sortable id, so that it can be referenced
+-- across instances. Existing events have no id.
+
+ALTER TABLE `events`
+  ADD COLUMN `id` char(36) NULL FIRST,
+  ADD UNIQUE KEY `id` (`id`);
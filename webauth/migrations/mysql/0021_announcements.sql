@@ -0,0 +1,14 @@
+-- Schedule announcements to be published on a live stream topic at a set
+-- time, such as a warning that maintenance is about to start.
+
+CREATE TABLE IF NOT EXISTS `announcements` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `topic` varchar(30) NOT NULL,
+  `message` varchar(255) NOT NULL,
+  `publish_at` datetime NOT NULL,
+  `created` timestamp NOT NULL DEFAULT current_timestamp(),
+  `sent` datetime NULL DEFAULT NULL,
+  `canceled` datetime NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `publish_at` (`publish_at`)
+);
@@ -0,0 +1,9 @@
+-- Store values of a login session on the server, such as the state of a
+-- multi-step form, keyed by the hashed value of its login token.
+
+CREATE TABLE IF NOT EXISTS `session_values` (
+  `hashedValue` binary(64) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `value` varchar(4000) NOT NULL,
+  PRIMARY KEY (`hashedValue`,`name`)
+);
@@ -0,0 +1,4 @@
+-- Index the message of events for the admin search, which matches words
+-- that start with the terms.
+
+ALTER TABLE `events` ADD FULLTEXT INDEX `events_message` (`message`);
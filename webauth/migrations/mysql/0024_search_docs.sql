@@ -0,0 +1,12 @@
+-- Index documents, such as events, for full-text search. The body is
+-- matched with a FULLTEXT index, and documents are found by kind and time.
+
+CREATE TABLE IF NOT EXISTS `search_docs` (
+  `kind` varchar(20) NOT NULL,
+  `id` varchar(64) NOT NULL,
+  `body` text NOT NULL,
+  `created` timestamp(6) NOT NULL DEFAULT current_timestamp(6),
+  PRIMARY KEY (`kind`, `id`),
+  KEY `kind_created` (`kind`, `created`),
+  FULLTEXT KEY `body` (`body`)
+);
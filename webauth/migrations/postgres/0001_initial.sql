@@ -0,0 +1,64 @@
+CREATE TABLE IF NOT EXISTS users (
+  username varchar(30) NOT NULL,
+  fullName varchar(70) NOT NULL,
+  email varchar(256) NOT NULL,
+  hashedPassword char(60) NOT NULL,
+  admin boolean NOT NULL DEFAULT false,
+  confirmed boolean NOT NULL DEFAULT false,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (username),
+  CONSTRAINT email UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+  hashedValue char(64) NOT NULL,
+  expires timestamptz NOT NULL,
+  kind varchar(7) NOT NULL,
+  username varchar(30) NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (hashedValue)
+);
+
+CREATE TABLE IF NOT EXISTS events (
+  name varchar(10) NOT NULL,
+  succeeded boolean NOT NULL,
+  username varchar(30) NOT NULL,
+  message varchar(255) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (created, name, username)
+);
+
+CREATE TABLE IF NOT EXISTS email_prefs (
+  username varchar(30) NOT NULL,
+  category varchar(10) NOT NULL,
+  enabled boolean NOT NULL DEFAULT true,
+  updated timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (username, category)
+);
+
+CREATE TABLE IF NOT EXISTS email_bounces (
+  email varchar(256) NOT NULL,
+  kind varchar(10) NOT NULL,
+  reason varchar(255) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT clock_timestamp(),
+  PRIMARY KEY (email, created)
+);
+CREATE INDEX IF NOT EXISTS email_bounces_kind ON email_bounces (kind);
+
+CREATE TABLE IF NOT EXISTS incidents (
+  id integer GENERATED BY DEFAULT AS IDENTITY,
+  title varchar(100) NOT NULL,
+  message varchar(1000) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  resolved timestamptz NULL DEFAULT NULL,
+  PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  provider varchar(30) NOT NULL,
+  subject varchar(255) NOT NULL,
+  username varchar(30) NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS user_identities_username ON user_identities (username);
@@ -0,0 +1,33 @@
+-- Give each user a stable id and use it, rather than the username, to
+-- reference users so they can be renamed. Events keep the username at the
+-- time of the event along with the id.
+
+ALTER TABLE users ADD COLUMN id char(36);
+UPDATE users SET id = gen_random_uuid()::text;
+ALTER TABLE users ALTER COLUMN id SET NOT NULL;
+CREATE UNIQUE INDEX users_id ON users (id);
+
+ALTER TABLE tokens ADD COLUMN user_id char(36);
+UPDATE tokens SET user_id = users.id FROM users WHERE tokens.username = users.username;
+DELETE FROM tokens WHERE user_id IS NULL;
+ALTER TABLE tokens DROP COLUMN username;
+ALTER TABLE tokens ALTER COLUMN user_id SET NOT NULL;
+CREATE INDEX tokens_user_id ON tokens (user_id);
+
+ALTER TABLE email_prefs ADD COLUMN user_id char(36);
+UPDATE email_prefs SET user_id = users.id FROM users WHERE email_prefs.username = users.username;
+DELETE FROM email_prefs WHERE user_id IS NULL;
+ALTER TABLE email_prefs DROP COLUMN username;
+ALTER TABLE email_prefs ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE email_prefs ADD PRIMARY KEY (user_id, category);
+
+ALTER TABLE user_identities ADD COLUMN user_id char(36);
+UPDATE user_identities SET user_id = users.id FROM users WHERE user_identities.username = users.username;
+DELETE FROM user_identities WHERE user_id IS NULL;
+ALTER TABLE user_identities DROP COLUMN username;
+ALTER TABLE user_identities ALTER COLUMN user_id SET NOT NULL;
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
+
+ALTER TABLE events ADD COLUMN user_id char(36);
+UPDATE events SET user_id = users.id FROM users WHERE events.username = users.username;
+CREATE INDEX events_user_id ON events (user_id);
@@ -0,0 +1,9 @@
+-- Record the previous usernames of each user.
+
+CREATE TABLE username_history (
+  user_id char(36) NOT NULL,
+  username varchar(30) NOT NULL,
+  changed timestamptz NOT NULL,
+  PRIMARY KEY (user_id, changed, username)
+);
+CREATE INDEX username_history_username ON username_history (username);
@@ -0,0 +1,3 @@
+-- Allow an admin to disable a user without deleting them.
+
+ALTER TABLE users ADD COLUMN disabled boolean NOT NULL DEFAULT false;
@@ -0,0 +1,9 @@
+-- Count the requests of each rate limit key, such as a user or address,
+-- in fixed windows.
+
+CREATE TABLE rate_limits (
+  quota_key varchar(255) NOT NULL,
+  window_start timestamptz NOT NULL,
+  requests int NOT NULL,
+  PRIMARY KEY (quota_key, window_start)
+);
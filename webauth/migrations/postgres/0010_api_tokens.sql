@@ -0,0 +1,7 @@
+-- Name API tokens and limit them to scopes. The id identifies a token to
+-- its user without revealing the value.
+
+ALTER TABLE tokens ADD COLUMN id char(36);
+ALTER TABLE tokens ADD COLUMN name varchar(50) NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN scopes varchar(255) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX tokens_id ON tokens (id);
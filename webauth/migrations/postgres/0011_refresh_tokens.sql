@@ -0,0 +1,4 @@
+-- Remember whether the cookies of a refresh token persist, so that they
+-- persist the same way when the token is rotated.
+
+ALTER TABLE tokens ADD COLUMN remember boolean NOT NULL DEFAULT false;
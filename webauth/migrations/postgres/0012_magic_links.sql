@@ -0,0 +1,3 @@
+-- Widen the token kind for longer kinds, such as magiclink.
+
+ALTER TABLE tokens ALTER COLUMN kind TYPE varchar(10);
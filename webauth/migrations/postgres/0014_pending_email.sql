@@ -0,0 +1,4 @@
+-- Keep a new email of a user until it is confirmed, so the current email
+-- is used until then.
+
+ALTER TABLE users ADD COLUMN pending_email varchar(256) NULL;
@@ -0,0 +1,14 @@
+-- Summarize account activity by week and month. The counts of a period are
+-- recomputed from the events until the period is complete.
+
+CREATE TABLE reports (
+  period varchar(5) NOT NULL,
+  period_start timestamptz NOT NULL,
+  period_end timestamptz NOT NULL,
+  registrations int NOT NULL,
+  confirmations int NOT NULL,
+  logins int NOT NULL,
+  resets int NOT NULL,
+  complete boolean NOT NULL DEFAULT false,
+  PRIMARY KEY (period, period_start)
+);
@@ -0,0 +1,15 @@
+-- Record audited actions with their actor, target, client, and result.
+
+CREATE TABLE audit_log (
+  id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  actor varchar(30) NOT NULL DEFAULT '',
+  action varchar(30) NOT NULL,
+  target varchar(255) NOT NULL DEFAULT '',
+  ip varchar(45) NOT NULL DEFAULT '',
+  user_agent varchar(255) NOT NULL DEFAULT '',
+  result varchar(10) NOT NULL,
+  metadata text
+);
+CREATE INDEX audit_log_created ON audit_log (created);
+CREATE INDEX audit_log_actor ON audit_log (actor);
@@ -0,0 +1,14 @@
+-- Schedule announcements to be published on a live stream topic at a set
+-- time, such as a warning that maintenance is about to start.
+
+CREATE TABLE IF NOT EXISTS announcements (
+  id integer GENERATED BY DEFAULT AS IDENTITY,
+  topic varchar(30) NOT NULL,
+  message varchar(255) NOT NULL,
+  publish_at timestamptz NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  sent timestamptz NULL DEFAULT NULL,
+  canceled timestamptz NULL DEFAULT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX announcements_publish_at ON announcements (publish_at);
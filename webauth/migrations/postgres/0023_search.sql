@@ -0,0 +1,4 @@
+-- Index the message of events for the admin search, which matches words
+-- that start with the terms.
+
+CREATE INDEX events_message ON events USING GIN (to_tsvector('simple', message));
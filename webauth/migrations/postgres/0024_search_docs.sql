@@ -0,0 +1,12 @@
+-- Index documents, such as events, for full-text search. The body is
+-- matched with a GIN index, and documents are found by kind and time.
+
+CREATE TABLE IF NOT EXISTS search_docs (
+  kind varchar(20) NOT NULL,
+  id varchar(64) NOT NULL,
+  body text NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (kind, id)
+);
+CREATE INDEX search_docs_kind_created ON search_docs (kind, created);
+CREATE INDEX search_docs_body ON search_docs USING GIN (to_tsvector('simple', body));
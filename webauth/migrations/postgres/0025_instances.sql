@@ -0,0 +1,12 @@
+-- Register the running instances of the app, each of which records a
+-- heartbeat periodically, to elect the leader that runs shared jobs.
+
+CREATE TABLE IF NOT EXISTS instances (
+  id varchar(64) NOT NULL,
+  host varchar(255) NOT NULL,
+  version varchar(64) NOT NULL,
+  started timestamptz NOT NULL,
+  heartbeat timestamptz NOT NULL,
+  PRIMARY KEY (id)
+);
+CREATE INDEX instances_heartbeat ON instances (heartbeat);
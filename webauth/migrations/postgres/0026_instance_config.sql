@@ -0,0 +1,4 @@
+-- Record a hash of the config of each instance, to warn when instances
+-- run with different configs, such as during a partial rollout.
+
+ALTER TABLE instances ADD COLUMN config_hash varchar(64) NOT NULL DEFAULT '';
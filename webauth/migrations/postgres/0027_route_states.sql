@@ -0,0 +1,12 @@
+-- Save the states of routes set at runtime by admins, which disable a
+-- route or send a share of its requests to a canary handler.
+
+CREATE TABLE IF NOT EXISTS route_states (
+  pattern varchar(255) NOT NULL,
+  disabled boolean NOT NULL DEFAULT false,
+  message varchar(255) NOT NULL DEFAULT '',
+  canary int NOT NULL DEFAULT 0,
+  updated_by varchar(30) NOT NULL,
+  updated timestamptz NOT NULL,
+  PRIMARY KEY (pattern)
+);
@@ -0,0 +1,6 @@
+-- Record the request and the field changes of audited admin actions, to
+-- show the history of each user, route, or other entity.
+
+ALTER TABLE audit_log ADD COLUMN request_id varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN changes text;
+CREATE INDEX audit_log_target ON audit_log (target);
@@ -0,0 +1,65 @@
+CREATE TABLE IF NOT EXISTS users (
+  username varchar(30) NOT NULL COLLATE NOCASE,
+  fullName varchar(70) NOT NULL,
+  email varchar(256) NOT NULL COLLATE NOCASE,
+  hashedPassword char(60) NOT NULL,
+  admin boolean NOT NULL DEFAULT false,
+  confirmed boolean NOT NULL DEFAULT false,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (username),
+  UNIQUE (email)
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+  hashedValue char(64) NOT NULL,
+  expires datetime NOT NULL,
+  kind varchar(7) NOT NULL,
+  username varchar(30) NOT NULL COLLATE NOCASE,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (hashedValue)
+);
+
+CREATE TABLE IF NOT EXISTS events (
+  name varchar(10) NOT NULL,
+  succeeded boolean NOT NULL,
+  username varchar(30) NOT NULL COLLATE NOCASE,
+  message varchar(255) NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (created, name, username)
+);
+
+CREATE TABLE IF NOT EXISTS email_prefs (
+  username varchar(30) NOT NULL COLLATE NOCASE,
+  category varchar(10) NOT NULL,
+  enabled boolean NOT NULL DEFAULT true,
+  updated timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (username, category)
+);
+
+CREATE TABLE IF NOT EXISTS email_bounces (
+  email varchar(256) NOT NULL COLLATE NOCASE,
+  kind varchar(10) NOT NULL,
+  reason varchar(255) NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (email, created)
+);
+
+CREATE INDEX IF NOT EXISTS email_bounces_kind ON email_bounces (kind);
+
+CREATE TABLE IF NOT EXISTS incidents (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  title varchar(100) NOT NULL,
+  message varchar(1000) NOT NULL DEFAULT '',
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  resolved timestamp NULL DEFAULT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  provider varchar(30) NOT NULL,
+  subject varchar(255) NOT NULL,
+  username varchar(30) NOT NULL COLLATE NOCASE,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_username ON user_identities (username);
@@ -0,0 +1,54 @@
+-- Give each user a stable id and use it, rather than the username, to
+-- reference users so they can be renamed. Events keep the username at the
+-- time of the event along with the id. SQLite cannot drop a key column, so
+-- the tables are rebuilt.
+
+ALTER TABLE users ADD COLUMN id char(36);
+UPDATE users SET id = lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6)));
+CREATE UNIQUE INDEX users_id ON users (id);
+
+CREATE TABLE tokens_new (
+  hashedValue char(64) NOT NULL,
+  expires datetime NOT NULL,
+  kind varchar(7) NOT NULL,
+  user_id char(36) NOT NULL,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (hashedValue)
+);
+INSERT INTO tokens_new (hashedValue, expires, kind, user_id, created)
+  SELECT tokens.hashedValue, tokens.expires, tokens.kind, users.id, tokens.created
+  FROM tokens JOIN users ON tokens.username = users.username;
+DROP TABLE tokens;
+ALTER TABLE tokens_new RENAME TO tokens;
+CREATE INDEX tokens_user_id ON tokens (user_id);
+
+CREATE TABLE email_prefs_new (
+  user_id char(36) NOT NULL,
+  category varchar(10) NOT NULL,
+  enabled boolean NOT NULL DEFAULT true,
+  updated timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (user_id, category)
+);
+INSERT INTO email_prefs_new (user_id, category, enabled, updated)
+  SELECT users.id, email_prefs.category, email_prefs.enabled, email_prefs.updated
+  FROM email_prefs JOIN users ON email_prefs.username = users.username;
+DROP TABLE email_prefs;
+ALTER TABLE email_prefs_new RENAME TO email_prefs;
+
+CREATE TABLE user_identities_new (
+  provider varchar(30) NOT NULL,
+  subject varchar(255) NOT NULL,
+  user_id char(36) NOT NULL,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  PRIMARY KEY (provider, subject)
+);
+INSERT INTO user_identities_new (provider, subject, user_id, created)
+  SELECT user_identities.provider, user_identities.subject, users.id, user_identities.created
+  FROM user_identities JOIN users ON user_identities.username = users.username;
+DROP TABLE user_identities;
+ALTER TABLE user_identities_new RENAME TO user_identities;
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
+
+ALTER TABLE events ADD COLUMN user_id char(36);
+UPDATE events SET user_id = (SELECT id FROM users WHERE users.username = events.username);
+CREATE INDEX events_user_id ON events (user_id);
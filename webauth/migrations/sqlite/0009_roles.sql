@@ -0,0 +1,26 @@
+-- Grant permissions to users with roles. The admin role has all
+-- permissions and is granted to the existing admins. The admin column is
+-- kept for compatibility.
+
+CREATE TABLE roles (
+  name varchar(30) NOT NULL,
+  description varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (name)
+);
+
+CREATE TABLE role_permissions (
+  role_name varchar(30) NOT NULL,
+  permission varchar(50) NOT NULL,
+  PRIMARY KEY (role_name, permission)
+);
+
+CREATE TABLE user_roles (
+  user_id char(36) NOT NULL,
+  role_name varchar(30) NOT NULL,
+  PRIMARY KEY (user_id, role_name)
+);
+CREATE INDEX user_roles_role_name ON user_roles (role_name);
+
+INSERT INTO roles (name, description) VALUES ('admin', 'All permissions');
+INSERT INTO role_permissions (role_name, permission) VALUES ('admin', '*');
+INSERT INTO user_roles (user_id, role_name) SELECT id, 'admin' FROM users WHERE admin = true;
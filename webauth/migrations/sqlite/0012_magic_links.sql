@@ -0,0 +1,2 @@
+-- Widen the token kind for longer kinds, such as magiclink. SQLite does
+-- not enforce the length of varchar, so there is nothing to change.
@@ -0,0 +1,4 @@
+-- Record when each login token was last used, so that idle sessions can
+-- be shown to their user and removed.
+
+ALTER TABLE tokens ADD COLUMN last_active datetime;
@@ -0,0 +1,5 @@
+-- Record when each refresh token was spent, so that it can be used again
+-- briefly by concurrent requests, such as from other tabs, before a reuse
+-- revokes the sessions of the user.
+
+ALTER TABLE tokens ADD COLUMN spent datetime;
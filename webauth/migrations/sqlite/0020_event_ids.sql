@@ -0,0 +1,5 @@
+-- Give each event a unique, time-sortable id, so that it can be referenced
+-- across instances. Existing events have no id.
+
+ALTER TABLE events ADD COLUMN id char(36);
+CREATE UNIQUE INDEX events_id ON events (id);
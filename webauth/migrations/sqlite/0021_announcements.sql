@@ -0,0 +1,13 @@
+-- Schedule announcements to be published on a live stream topic at a set
+-- time, such as a warning that maintenance is about to start.
+
+CREATE TABLE IF NOT EXISTS announcements (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  topic varchar(30) NOT NULL,
+  message varchar(255) NOT NULL,
+  publish_at datetime NOT NULL,
+  created timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  sent datetime NULL DEFAULT NULL,
+  canceled datetime NULL DEFAULT NULL
+);
+CREATE INDEX announcements_publish_at ON announcements (publish_at);
@@ -0,0 +1,4 @@
+-- The admin search matches the message of recent events with LIKE, which
+-- is bounded by the created column that starts the primary key. An FTS5
+-- table would need triggers, which the migration statements cannot have,
+-- so there is nothing to change.
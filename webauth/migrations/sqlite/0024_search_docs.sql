@@ -0,0 +1,10 @@
+-- Index documents, such as events, for full-text search. The body is
+-- matched with FTS5, which the SQLite driver must include. The kind, id,
+-- and created columns are stored but not indexed as text.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS search_docs USING fts5(
+  kind UNINDEXED,
+  id UNINDEXED,
+  body,
+  created UNINDEXED
+);
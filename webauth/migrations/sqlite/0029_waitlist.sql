@@ -0,0 +1,3 @@
+-- Hold new users for admin approval while the waitlist is enabled.
+
+ALTER TABLE users ADD COLUMN waitlisted boolean NOT NULL DEFAULT false;
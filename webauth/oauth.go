@@ -0,0 +1,472 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth provider kinds.
+const (
+	OAuthKindOIDC   = "oidc"   // OpenID Connect with discovery.
+	OAuthKindGitHub = "github" // GitHub OAuth app.
+)
+
+// GoogleIssuer is used as the Issuer of a provider named "google" if one
+// is not provided.
+const GoogleIssuer = "https://accounts.google.com"
+
+// ConfigOAuth holds settings for an OpenID Connect or GitHub login provider.
+type ConfigOAuth struct {
+	Kind         string   // Kind is "oidc" (default) or "github".
+	Issuer       string   // Issuer URL used for OIDC discovery.
+	ClientID     string   // ClientID registered with the provider.
+	ClientSecret string   // ClientSecret registered with the provider.
+	Scopes       []string // Scopes requested in addition to the defaults.
+	Label        string   // Label of the login button, defaults to the name.
+}
+
+// RedactedConfigOAuth is a copy of ConfigOAuth to hide sensitive information.
+type RedactedConfigOAuth ConfigOAuth
+
+// redact creates a copy of ConfigOAuth with the client secret redacted.
+func (c ConfigOAuth) redact() RedactedConfigOAuth {
+	r := RedactedConfigOAuth(c)
+	if r.ClientSecret != "" {
+		r.ClientSecret = "[REDACTED]"
+	}
+	return r
+}
+
+// MarshalJSON redacts sensitive information when marshalling to JSON.
+func (c ConfigOAuth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.redact())
+}
+
+// String returns a string for ConfigOAuth with sensitive data redacted.
+func (c ConfigOAuth) String() string {
+	return fmt.Sprintf("%+v", c.redact())
+}
+
+// OAuthProvider describes a login provider shown on the login page.
+type OAuthProvider struct {
+	Name  string // Name is the key in Config.OAuth.
+	Label string // Label is the text of the login button.
+}
+
+// OAuthIdentity is a user identity asserted by a provider.
+type OAuthIdentity struct {
+	Provider      string // Provider is the name of the provider.
+	Subject       string // Subject is the stable ID of the user at the provider.
+	Email         string
+	EmailVerified bool
+	Name          string
+	Login         string // Login is the preferred username, if any.
+}
+
+var (
+	ErrOAuthConfig    = errors.New("invalid oauth provider")
+	ErrOAuthDiscovery = errors.New("oauth discovery failed")
+	ErrOAuthExchange  = errors.New("oauth code exchange failed")
+	ErrOAuthIDToken   = errors.New("invalid id token")
+	ErrOAuthIdentity  = errors.New("oauth identity failed")
+)
+
+// oauthEndpoints are the provider URLs used during login.
+type oauthEndpoints struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+}
+
+// githubEndpoints are the endpoints of a GitHub OAuth app. UserInfoURL is
+// also the base of the emails endpoint.
+var githubEndpoints = oauthEndpoints{
+	AuthURL:     "https://github.com/login/oauth/authorize",
+	TokenURL:    "https://github.com/login/oauth/access_token",
+	UserInfoURL: "https://api.github.com/user",
+}
+
+// oauthClient is used for requests to providers.
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// oauthProvider is a configured provider with its discovered endpoints.
+type oauthProvider struct {
+	name      string
+	cfg       ConfigOAuth
+	mu        sync.Mutex
+	endpoints *oauthEndpoints
+}
+
+// newOAuthProviders validates cfg and returns the providers by name.
+func newOAuthProviders(cfg map[string]ConfigOAuth) (map[string]*oauthProvider, error) {
+	providers := make(map[string]*oauthProvider, len(cfg))
+
+	for name, c := range cfg {
+		if c.Kind == "" {
+			c.Kind = OAuthKindOIDC
+		}
+		if c.Kind == OAuthKindOIDC && c.Issuer == "" && name == "google" {
+			c.Issuer = GoogleIssuer
+		}
+		if c.Label == "" {
+			c.Label = name
+		}
+
+		switch {
+		case c.Kind != OAuthKindOIDC && c.Kind != OAuthKindGitHub:
+			return nil, fmt.Errorf("%w %q: unknown kind %q", ErrOAuthConfig, name, c.Kind)
+		case c.ClientID == "":
+			return nil, fmt.Errorf("%w %q: missing ClientID", ErrOAuthConfig, name)
+		case c.Kind == OAuthKindOIDC && c.Issuer == "":
+			return nil, fmt.Errorf("%w %q: missing Issuer", ErrOAuthConfig, name)
+		}
+
+		providers[name] = &oauthProvider{name: name, cfg: c}
+	}
+
+	return providers, nil
+}
+
+// OAuthProviders returns the configured login providers sorted by name.
+func (app *AuthApp) OAuthProviders() []OAuthProvider {
+	var list []OAuthProvider
+	for name, p := range app.oauth {
+		list = append(list, OAuthProvider{Name: name, Label: p.cfg.Label})
+	}
+
+	slices.SortFunc(list, func(a, b OAuthProvider) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+// scopes returns the scopes to request from the provider.
+func (p *oauthProvider) scopes() []string {
+	scopes := []string{"openid", "email", "profile"}
+	if p.cfg.Kind == OAuthKindGitHub {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return append(scopes, p.cfg.Scopes...)
+}
+
+// discover returns the endpoints of the provider. OIDC endpoints are read
+// from the issuer's discovery document on first use and then cached.
+func (p *oauthProvider) discover(ctx context.Context) (oauthEndpoints, error) {
+	if p.cfg.Kind == OAuthKindGitHub {
+		return githubEndpoints, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.endpoints != nil {
+		return *p.endpoints, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+
+	var ep oauthEndpoints
+	err := oauthGetJSON(ctx, issuer+"/.well-known/openid-configuration", "", &ep)
+	if err != nil {
+		return oauthEndpoints{}, fmt.Errorf("%w: %v", ErrOAuthDiscovery, err)
+	}
+
+	if strings.TrimSuffix(ep.Issuer, "/") != issuer {
+		return oauthEndpoints{}, fmt.Errorf("%w: issuer %q does not match %q",
+			ErrOAuthDiscovery, ep.Issuer, p.cfg.Issuer)
+	}
+	if ep.AuthURL == "" || ep.TokenURL == "" {
+		return oauthEndpoints{}, fmt.Errorf("%w: missing endpoints", ErrOAuthDiscovery)
+	}
+
+	p.endpoints = &ep
+
+	return ep, nil
+}
+
+// randomURLString returns a random string that is safe to use unescaped
+// in a URL, including as a PKCE code verifier.
+func randomURLString(r io.Reader) (string, error) {
+	s, err := RandomStringFrom(r, 32)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(s, "="), nil
+}
+
+// pkceChallenge returns the S256 code challenge for verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oauthRedirectURI returns the callback URL registered with providers.
+func (app *AuthApp) oauthRedirectURI() string {
+	return strings.TrimSuffix(app.Cfg.Auth.BaseURL, "/") + "/oauth/callback"
+}
+
+// authCodeURL returns the URL that starts the authorization code flow.
+func (app *AuthApp) authCodeURL(p *oauthProvider, ep oauthEndpoints, st oauthState) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {app.oauthRedirectURI()},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {st.State},
+		"code_challenge":        {pkceChallenge(st.Verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if p.cfg.Kind == OAuthKindOIDC {
+		q.Set("nonce", st.Nonce)
+	}
+
+	sep := "?"
+	if strings.Contains(ep.AuthURL, "?") {
+		sep = "&"
+	}
+
+	return ep.AuthURL + sep + q.Encode()
+}
+
+// oauthToken is the response of a token endpoint.
+type oauthToken struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchange exchanges an authorization code for tokens.
+func (app *AuthApp) exchange(ctx context.Context, p *oauthProvider, ep oauthEndpoints, code, verifier string) (oauthToken, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {app.oauthRedirectURI()},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("%w: %v", ErrOAuthExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var token oauthToken
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("%w: %s: %v", ErrOAuthExchange, resp.Status, err)
+	}
+	if token.Error != "" {
+		return oauthToken{}, fmt.Errorf("%w: %s: %s", ErrOAuthExchange, token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return oauthToken{}, fmt.Errorf("%w: %s", ErrOAuthExchange, resp.Status)
+	}
+
+	return token, nil
+}
+
+// oauthGetJSON decodes the JSON response of a GET request to rawURL. If
+// accessToken is not empty, it is sent as a bearer token.
+func oauthGetJSON(ctx context.Context, rawURL, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// audience is the aud claim, which may be a string or an array.
+type audience []string
+
+// UnmarshalJSON accepts a single string or an array of strings.
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// idTokenClaims are the ID token claims used by webauth.
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	Expires           int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// parseIDToken returns the claims of a JWT without verifying its signature.
+// This is permitted by OpenID Connect Core 3.1.3.7 since the token was
+// received directly from the token endpoint over TLS.
+func parseIDToken(raw string) (idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return idTokenClaims{}, fmt.Errorf("%w: malformed", ErrOAuthIDToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return idTokenClaims{}, fmt.Errorf("%w: %v", ErrOAuthIDToken, err)
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return idTokenClaims{}, fmt.Errorf("%w: %v", ErrOAuthIDToken, err)
+	}
+
+	return claims, nil
+}
+
+// validate checks the claims were issued for this client and login.
+func (c idTokenClaims) validate(issuer, clientID, nonce string, now time.Time) error {
+	switch {
+	case c.Issuer != issuer:
+		return fmt.Errorf("%w: issuer %q", ErrOAuthIDToken, c.Issuer)
+	case !slices.Contains(c.Audience, clientID):
+		return fmt.Errorf("%w: audience %v", ErrOAuthIDToken, c.Audience)
+	case now.Unix() >= c.Expires:
+		return fmt.Errorf("%w: expired", ErrOAuthIDToken)
+	case c.Nonce != nonce:
+		return fmt.Errorf("%w: nonce mismatch", ErrOAuthIDToken)
+	case c.Subject == "":
+		return fmt.Errorf("%w: missing subject", ErrOAuthIDToken)
+	}
+
+	return nil
+}
+
+// identity returns the identity of the user that authorized the token.
+func (p *oauthProvider) identity(ctx context.Context, ep oauthEndpoints, token oauthToken, nonce string, now time.Time) (OAuthIdentity, error) {
+	if p.cfg.Kind == OAuthKindGitHub {
+		return p.githubIdentity(ctx, ep, token)
+	}
+
+	claims, err := parseIDToken(token.IDToken)
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+	err = claims.validate(ep.Issuer, p.cfg.ClientID, nonce, now)
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	// Some providers only return the email from the userinfo endpoint.
+	if claims.Email == "" && ep.UserInfoURL != "" {
+		var info idTokenClaims
+		err := oauthGetJSON(ctx, ep.UserInfoURL, token.AccessToken, &info)
+		if err != nil {
+			return OAuthIdentity{}, fmt.Errorf("%w: %v", ErrOAuthIdentity, err)
+		}
+		if info.Subject == claims.Subject {
+			claims.Email = info.Email
+			claims.EmailVerified = info.EmailVerified
+			if claims.Name == "" {
+				claims.Name = info.Name
+			}
+		}
+	}
+
+	return OAuthIdentity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Login:         claims.PreferredUsername,
+	}, nil
+}
+
+// githubIdentity returns the identity of a GitHub user, using the primary
+// verified email if the user has one.
+func (p *oauthProvider) githubIdentity(ctx context.Context, ep oauthEndpoints, token oauthToken) (OAuthIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	err := oauthGetJSON(ctx, ep.UserInfoURL, token.AccessToken, &user)
+	if err != nil {
+		return OAuthIdentity{}, fmt.Errorf("%w: %v", ErrOAuthIdentity, err)
+	}
+	if user.ID == 0 {
+		return OAuthIdentity{}, fmt.Errorf("%w: missing id", ErrOAuthIdentity)
+	}
+
+	id := OAuthIdentity{
+		Provider: p.name,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Email:    user.Email,
+		Name:     user.Name,
+		Login:    user.Login,
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	err = oauthGetJSON(ctx, ep.UserInfoURL+"/emails", token.AccessToken, &emails)
+	if err != nil {
+		return OAuthIdentity{}, fmt.Errorf("%w: %v", ErrOAuthIdentity, err)
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			id.Email, id.EmailVerified = e.Email, true
+			break
+		}
+	}
+
+	return id, nil
+}
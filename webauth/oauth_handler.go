@@ -0,0 +1,347 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// OAuthCallbackTmpl is the name of the OAuth callback HTML template.
+const OAuthCallbackTmpl = "oauth_callback.html"
+
+// OAuthStateCookieName is the name of the cookie that holds the state of
+// a login in progress.
+const OAuthStateCookieName = "oauth_state"
+
+const (
+	MsgOAuthDenied      = "Sign in was cancelled or denied."
+	MsgOAuthFailed      = "Unable to sign in with the provider."
+	MsgOAuthEmailExists = "An account already uses this email. Login with your password and then link the provider from your account."
+)
+
+// OAuthCallbackPageData contains data passed to the HTML template.
+type OAuthCallbackPageData struct {
+	CommonData
+	Message  string
+	Redirect string // Redirect is the page to go to after a login.
+}
+
+// oauthState is the state of a login, saved in a signed cookie between
+// the login and callback requests.
+type oauthState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Redirect string `json:"r"`
+	Link     string `json:"l,omitempty"` // Link is the user to link to.
+}
+
+// stateCookie returns a signed cookie that holds st. SameSite is Lax
+// since the cookie must be sent on the redirect back from the provider,
+// as set in signedCookies.
+func (app *AuthApp) stateCookie(st oauthState) (*http.Cookie, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	return app.newSignedCookie(OAuthStateCookieName, payload), nil
+}
+
+var ErrOAuthState = errors.New("invalid oauth state")
+
+// stateFromCookie returns the state saved in value by stateCookie.
+func (app *AuthApp) stateFromCookie(value string) (oauthState, error) {
+	payload, _, err := app.signedCookieValue(OAuthStateCookieName, value)
+	if err != nil {
+		return oauthState{}, ErrOAuthState
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return oauthState{}, ErrOAuthState
+	}
+
+	var st oauthState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return oauthState{}, ErrOAuthState
+	}
+
+	return st, nil
+}
+
+// OAuthLoginHandler starts a login with the provider named in the provider
+// query parameter. If link is set, the provider is linked to the logged in
+// user instead.
+func (app *AuthApp) OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	name := r.URL.Query().Get("provider")
+	logger = logger.With(slog.String("provider", name))
+
+	p, ok := app.oauth[name]
+	if !ok {
+		logger.Warn("unknown provider")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	// The provider authenticates the user, so only blocks apply.
+	if app.geoRestrict(logger, r, EventOAuth, "", false) == GeoBlock {
+		webutil.Error(w, r, http.StatusForbidden, "", "")
+		return
+	}
+
+	redirect := r.URL.Query().Get("r")
+	if redirect == "" || !webutil.IsLocalSafeURL(redirect) {
+		redirect = "/"
+	}
+	st := oauthState{Provider: name, Redirect: redirect}
+
+	if r.URL.Query().Get("link") != "" {
+		user, err := app.UserFromRequest(w, r)
+		if err != nil {
+			logger.Error("failed to get user", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+		if user.Username == "" {
+			logger.Warn("link without login")
+			webutil.Error(w, r, http.StatusUnauthorized, "", "")
+			return
+		}
+		st.Link = user.Username
+	}
+
+	ep, err := p.discover(r.Context())
+	if err != nil {
+		logger.Error("failed to discover endpoints", "err", err)
+		webutil.Error(w, r, http.StatusBadGateway, "", "")
+		return
+	}
+
+	for _, v := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		*v, err = randomURLString(app.Rand)
+		if err != nil {
+			logger.Error("failed to generate state", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	cookie, err := app.stateCookie(st)
+	if err != nil {
+		logger.Error("failed to create state cookie", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	http.SetCookie(w, cookie)
+
+	logger.Info("redirect to provider", slog.String("link", st.Link))
+	http.Redirect(w, r, app.authCodeURL(p, ep, st), http.StatusSeeOther)
+}
+
+// OAuthCallbackHandler completes a login started by OAuthLoginHandler.
+//
+// A user is found by the identity linked to the provider. If no user is
+// linked and the login was started to link the provider, it is linked to
+// that user. Otherwise, a new user is registered, unless the email is
+// already used by another account, which must be linked while logged in.
+func (app *AuthApp) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	value, err := CookieValue(r, OAuthStateCookieName)
+	if err != nil {
+		logger.Error("failed to get state cookie", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	// The state can only be used once.
+	http.SetCookie(w, &http.Cookie{
+		Name:   OAuthStateCookieName,
+		Path:   "/oauth/",
+		MaxAge: -1,
+	})
+
+	st, err := app.stateFromCookie(value)
+	query := r.URL.Query()
+	if err != nil || subtle.ConstantTimeCompare([]byte(st.State), []byte(query.Get("state"))) != 1 {
+		logger.Warn("invalid state", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	logger = logger.With(slog.String("provider", st.Provider))
+
+	p, ok := app.oauth[st.Provider]
+	if !ok {
+		logger.Warn("unknown provider")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	if e := query.Get("error"); e != "" {
+		logger.Warn("provider returned error", "error", e,
+			"description", query.Get("error_description"))
+		app.RenderPage(w, r, logger, OAuthCallbackTmpl,
+			&OAuthCallbackPageData{Message: MsgOAuthDenied})
+		return
+	}
+
+	id, err := app.oauthIdentity(r, p, st, query.Get("code"))
+	if err != nil {
+		logger.Error("failed to get identity", "err", err)
+		app.DB.RecordEvent(NewEvent(TypeOAuthFailed, st.Link, EventDetails{"provider": st.Provider, "error": err.Error()}))
+		app.RenderPage(w, r, logger, OAuthCallbackTmpl,
+			&OAuthCallbackPageData{Message: MsgOAuthFailed})
+		return
+	}
+
+	logger = logger.With(slog.String("subject", id.Subject), slog.String("email", id.Email))
+
+	username, msg, err := app.userForIdentity(id, st.Link)
+	if err != nil {
+		logger.Error("failed to get user for identity", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	if msg != "" {
+		logger.Warn("identity not linked", "message", msg)
+		app.DB.RecordEvent(NewEvent(TypeOAuthEmailExists, "", EventDetails{"provider": st.Provider, "email": id.Email}))
+		app.RenderPage(w, r, logger, OAuthCallbackTmpl,
+			&OAuthCallbackPageData{Message: msg})
+		return
+	}
+
+	token, err := app.CreateLoginToken(username)
+	if errors.Is(err, ErrUserDisabled) {
+		logger.Warn("user disabled", slog.String("username", username))
+		app.DB.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+	if errors.Is(err, ErrUserWaitlisted) {
+		logger.Warn("user waitlisted", slog.String("username", username))
+		app.DB.RecordEvent(ErrorEvent(TypeLoginFailed, username, err))
+		app.RenderPage(w, r, logger, OAuthCallbackTmpl,
+			&OAuthCallbackPageData{Message: MsgUserWaitlisted})
+		return
+	}
+	if err != nil {
+		logger.Error("failed to create login token", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	s, err := app.newSession(token, true)
+	if err != nil {
+		logger.Error("failed to create session", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	app.setSessionCookies(w, s)
+
+	app.DB.RecordEvent(NewEvent(TypeLoginOAuth, username, EventDetails{"provider": st.Provider}))
+	logger.Info("logged in", slog.String("username", username))
+
+	// The login cookie is SameSite=Strict, so it is not sent if the
+	// callback redirects, since the navigation started at the provider.
+	// Render a page that refreshes to the redirect instead.
+	app.RenderPage(w, r, logger, OAuthCallbackTmpl,
+		&OAuthCallbackPageData{Redirect: st.Redirect})
+}
+
+// oauthIdentity exchanges code and returns the identity of the user.
+func (app *AuthApp) oauthIdentity(r *http.Request, p *oauthProvider, st oauthState, code string) (OAuthIdentity, error) {
+	if code == "" {
+		return OAuthIdentity{}, ErrOAuthExchange
+	}
+
+	ep, err := p.discover(r.Context())
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	token, err := app.exchange(r.Context(), p, ep, code, st.Verifier)
+	if err != nil {
+		return OAuthIdentity{}, err
+	}
+
+	return p.identity(r.Context(), ep, token, st.Nonce, app.Clock.Now())
+}
+
+// userForIdentity returns the username for id, linking or registering a
+// user if needed. If the user cannot login, a message is returned instead.
+func (app *AuthApp) userForIdentity(id OAuthIdentity, link string) (string, string, error) {
+	username, err := app.DB.UsernameForIdentity(id.Provider, id.Subject)
+	if err == nil {
+		return username, "", nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return "", "", err
+	}
+
+	if link != "" {
+		err := app.DB.LinkIdentity(id.Provider, id.Subject, link)
+		if err != nil {
+			return "", "", err
+		}
+		app.DB.RecordEvent(NewEvent(TypeOAuthLinked, link, EventDetails{"provider": id.Provider}))
+		return link, "", nil
+	}
+
+	if id.Email == "" {
+		return "", MsgOAuthFailed, nil
+	}
+
+	// Don't take over an existing account based on the email alone.
+	exists, err := app.DB.EmailExists(id.Email)
+	if err != nil {
+		return "", "", err
+	}
+	if exists {
+		return "", MsgOAuthEmailExists, nil
+	}
+
+	want := id.Login
+	if want == "" {
+		want, _, _ = strings.Cut(id.Email, "@")
+	}
+	username, err = app.AvailableUsername(want)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = app.DB.CreateUserForIdentity(id, username)
+	if err != nil {
+		return "", "", err
+	}
+	app.DB.RecordEvent(NewEvent(TypeRegisterOAuth, username, EventDetails{"provider": id.Provider}))
+	if app.Cfg.Waitlist.Enabled {
+		app.DB.RecordEvent(NewEvent(TypeWaitlistAdded, username, nil))
+	}
+
+	return username, "", nil
+}
@@ -0,0 +1,336 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// fakeProvider is an OpenID Connect provider that issues an ID token for
+// subject with the nonce of the last authorization request.
+type fakeProvider struct {
+	*httptest.Server
+	subject string
+	email   string
+	nonce   string
+}
+
+func newFakeProvider(t *testing.T, subject, email string) *fakeProvider {
+	p := &fakeProvider{subject: subject, email: email}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/auth",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good" || r.PostFormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims, _ := json.Marshal(map[string]any{
+			"iss":            p.URL,
+			"sub":            p.subject,
+			"aud":            "client",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          p.nonce,
+			"email":          p.email,
+			"email_verified": true,
+			"name":           "OAuth User",
+		})
+		idToken := "e30." + base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"id_token":     idToken,
+		})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func oauthApp(t *testing.T, p *fakeProvider) *webauth.AuthApp {
+	return AppWithoutDBForTest(t, func(cfg *webauth.Config) {
+		cfg.OAuth = map[string]webauth.ConfigOAuth{
+			"test": {Issuer: p.URL, ClientID: "client", ClientSecret: "secret"},
+		}
+	})
+}
+
+// startOAuthLogin calls OAuthLoginHandler and returns the state cookie and
+// the provider authorization URL.
+func startOAuthLogin(t *testing.T, app *webauth.AuthApp, p *fakeProvider) (*http.Cookie, *url.URL) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/oauth/login?provider=test&r=/user", nil)
+	app.OAuthLoginHandler(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("OAuthLoginHandler() status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid Location: %v", err)
+	}
+	p.nonce = u.Query().Get("nonce")
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != webauth.OAuthStateCookieName {
+		t.Fatalf("OAuthLoginHandler() cookies = %v, want state cookie", cookies)
+	}
+
+	return cookies[0], u
+}
+
+func oauthCallbackBody(t *testing.T, data webauth.OAuthCallbackPageData) string {
+	tmplFile := filepath.Join(assets.AssetPath(), "tmpl", webauth.OAuthCallbackTmpl)
+
+	tmpl, err := template.New(filepath.Base(tmplFile)).Funcs(tmplFuncsForTest).ParseFiles(tmplFile)
+	if err != nil {
+		t.Fatalf("could not parse template file '%s': %v", tmplFile, err)
+	}
+
+	var body bytes.Buffer
+	tmpl.Execute(&body, data)
+
+	return body.String()
+}
+
+func TestOAuthLoginHandler(t *testing.T) {
+	p := newFakeProvider(t, "subject", "oauth@email")
+	app := oauthApp(t, p)
+
+	cookie, u := startOAuthLogin(t, app, p)
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != p.URL+"/auth" {
+		t.Errorf("authorization endpoint = %q, want %q", got, p.URL+"/auth")
+	}
+
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          app.Cfg.Auth.BaseURL + "/oauth/callback",
+		"scope":                 "openid email profile",
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	for _, k := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(k) == "" {
+			t.Errorf("missing %s", k)
+		}
+	}
+
+	if cookie.SameSite != http.SameSiteLaxMode || !cookie.HttpOnly || !cookie.Secure {
+		t.Errorf("state cookie = %+v, want Lax, HttpOnly, and Secure", cookie)
+	}
+
+	webhandler.TestHandler(t, app.OAuthLoginHandler, []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/oauth/login?provider=test",
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "POST Method Not Allowed\n",
+		},
+		{
+			Name:          "unknownProvider",
+			Target:        "/oauth/login?provider=unknown",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusNotFound,
+			WantBody:      "Error: Not Found\n",
+		},
+	})
+}
+
+func TestOAuthCallbackHandlerFailures(t *testing.T) {
+	p := newFakeProvider(t, "subject", "oauth@email")
+	app := oauthApp(t, p)
+
+	cookie, u := startOAuthLogin(t, app, p)
+	state := url.QueryEscape(u.Query().Get("state"))
+	tampered := *cookie
+	tampered.Value = "x" + cookie.Value
+
+	// The state cookie is always cleared.
+	cleared := []http.Cookie{{
+		Name:   webauth.OAuthStateCookieName,
+		Path:   "/oauth/",
+		MaxAge: -1,
+		Raw:    webauth.OAuthStateCookieName + "=; Path=/oauth/; Max-Age=0",
+	}}
+
+	webhandler.TestHandler(t, app.OAuthCallbackHandler, []webhandler.TestCase{
+		{
+			Name:          "missingCookie",
+			Target:        "/oauth/callback?state=" + state + "&code=good",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusBadRequest,
+			WantCookies:   cleared,
+			WantBody:      "Error: Bad Request\n",
+		},
+		{
+			Name:           "tamperedCookie",
+			Target:         "/oauth/callback?state=" + state + "&code=good",
+			RequestMethod:  http.MethodGet,
+			RequestCookies: []http.Cookie{tampered},
+			WantStatus:     http.StatusBadRequest,
+			WantCookies:    cleared,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:           "wrongState",
+			Target:         "/oauth/callback?state=wrong&code=good",
+			RequestMethod:  http.MethodGet,
+			RequestCookies: []http.Cookie{*cookie},
+			WantStatus:     http.StatusBadRequest,
+			WantCookies:    cleared,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:           "denied",
+			Target:         "/oauth/callback?state=" + state + "&error=access_denied",
+			RequestMethod:  http.MethodGet,
+			RequestCookies: []http.Cookie{*cookie},
+			WantStatus:     http.StatusOK,
+			WantCookies:    cleared,
+			WantBody: oauthCallbackBody(t, webauth.OAuthCallbackPageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Message:    webauth.MsgOAuthDenied,
+			}),
+		},
+		{
+			Name:           "badCode",
+			Target:         "/oauth/callback?state=" + state + "&code=bad",
+			RequestMethod:  http.MethodGet,
+			RequestCookies: []http.Cookie{*cookie},
+			WantStatus:     http.StatusOK,
+			WantCookies:    cleared,
+			WantBody: oauthCallbackBody(t, webauth.OAuthCallbackPageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Message:    webauth.MsgOAuthFailed,
+			}),
+		},
+	})
+
+	// An ID token for another login is rejected.
+	p.nonce = "other"
+	webhandler.TestHandler(t, app.OAuthCallbackHandler, []webhandler.TestCase{
+		{
+			Name:           "wrongNonce",
+			Target:         "/oauth/callback?state=" + state + "&code=good",
+			RequestMethod:  http.MethodGet,
+			RequestCookies: []http.Cookie{*cookie},
+			WantStatus:     http.StatusOK,
+			WantCookies:    cleared,
+			WantBody: oauthCallbackBody(t, webauth.OAuthCallbackPageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+				Message:    webauth.MsgOAuthFailed,
+			}),
+		},
+	})
+}
+
+func TestOAuthCallbackHandler(t *testing.T) {
+	dbApp := AppForTest(t)
+
+	subject := time.Now().Format("20060102150405.000000")
+	p := newFakeProvider(t, subject, "oauth"+subject+"@email")
+
+	cfg := dbApp.Cfg
+	cfg.OAuth = map[string]webauth.ConfigOAuth{
+		"test": {Issuer: p.URL, ClientID: "client"},
+	}
+	app, err := webauth.NewApp(
+		webapp.WithName(cfg.App.Name),
+		webapp.WithTemplate(dbApp.Tmpl),
+		webauth.WithConfig(cfg),
+		webauth.WithDB(dbApp.DB),
+	)
+	if err != nil {
+		t.Fatalf("NewApp() failed: %v", err)
+	}
+
+	// Login twice to check the second login uses the registered user.
+	for i := 0; i < 2; i++ {
+		cookie, u := startOAuthLogin(t, app, p)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet,
+			"/oauth/callback?code=good&state="+url.QueryEscape(u.Query().Get("state")), nil)
+		r.AddCookie(cookie)
+		app.OAuthCallbackHandler(w, r)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `url=/user`) {
+			t.Fatalf("OAuthCallbackHandler() = %d %q, want refresh to /user", w.Code, w.Body.String())
+		}
+
+		var login *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == webauth.LoginTokenCookieName {
+				login = c
+			}
+		}
+		if login == nil {
+			t.Fatalf("OAuthCallbackHandler() did not set login cookie")
+		}
+		if login.Path != "/" {
+			t.Errorf("login cookie path = %q, want %q", login.Path, "/")
+		}
+
+		user, err := app.DB.UserForLoginToken(login.Value)
+		if err != nil {
+			t.Fatalf("UserForLoginToken() failed: %v", err)
+		}
+		if user.Email != p.email || !user.Confirmed {
+			t.Errorf("user = %+v, want confirmed user with email %q", user, p.email)
+		}
+
+		got, err := app.DB.UsernameForIdentity("test", subject)
+		if err != nil || got != user.Username {
+			t.Errorf("UsernameForIdentity() = %q, %v, want %q", got, err, user.Username)
+		}
+	}
+}
+
+func TestNewAppInvalidOAuth(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to created config: %v", err)
+	}
+	cfg.OAuth = map[string]webauth.ConfigOAuth{"google": {ClientSecret: "secret"}}
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
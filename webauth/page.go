@@ -4,20 +4,32 @@
 package webauth
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
 
 // PageData is an interface that all page data structs must implement.
 type PageData interface {
 	SetDefaultTitle(appName string)
+	SetCSRFToken(token string)
+	SetCSPNonce(nonce string)
+	SetNav(nav *webhandler.Nav)
+	SetPrinter(p *i18n.Printer)
 }
 
 // CommonData holds common fields for page data.
 type CommonData struct {
-	Title string
+	Title     string
+	CSRFToken string          // CSRFToken is included in forms with CSRFField.
+	CSPNonce  string          // CSPNonce is added to inline scripts with NonceAttr.
+	Nav       *webhandler.Nav // Nav has the breadcrumbs and menus of the page.
+	Printer   *i18n.Printer   // Printer translates with T, as {{T .Printer "text"}}.
+	Lang      string          // Lang is the language of Printer, for the lang attribute.
 }
 
 // SetDefaultTitle ensures that the Title of CommonPageData is not empty.
@@ -28,15 +40,50 @@ func (c *CommonData) SetDefaultTitle(appName string) {
 	}
 }
 
+// SetCSRFToken sets the CSRF token of CommonData.
+func (c *CommonData) SetCSRFToken(token string) {
+	c.CSRFToken = token
+}
+
+// SetCSPNonce sets the Content-Security-Policy nonce of CommonData.
+func (c *CommonData) SetCSPNonce(nonce string) {
+	c.CSPNonce = nonce
+}
+
+// SetNav sets the navigation of CommonData.
+func (c *CommonData) SetNav(nav *webhandler.Nav) {
+	c.Nav = nav
+}
+
+// SetPrinter sets the Printer of CommonData and its language.
+func (c *CommonData) SetPrinter(p *i18n.Printer) {
+	c.Printer, c.Lang = p, p.Lang()
+}
+
 // RenderPage renders a web page using the specified template and data.
+// The CSRF token, CSP nonce, navigation, and Printer for r are added to
+// data.
+// Since pages can have user data and the token, caches are told not to
+// store them.
 //
 // If the page cannot be rendered, http.StatusInternalServerError is
 // set and the caller should ensure no further writes are done to w.
-func (app *AuthApp) RenderPage(w http.ResponseWriter, logger *slog.Logger, templateName string, data PageData) {
+func (app *AuthApp) RenderPage(w http.ResponseWriter, r *http.Request, logger *slog.Logger, templateName string, data PageData) {
 	data.SetDefaultTitle(app.Cfg.App.Name)
+	data.SetCSRFToken(webhandler.CSRFToken(r.Context()))
+	data.SetCSPNonce(webhandler.CSPNonce(r.Context()))
+	data.SetNav(webhandler.NavFromContext(r.Context()))
+	data.SetPrinter(app.Printer(r.Context()))
+	webutil.SetNoCacheHeaders(w)
 
 	err := webutil.RenderTemplateOrError(app.Tmpl, w, templateName, data)
 	if err != nil {
 		logger.Error("unable to render template", "err", err)
 	}
 }
+
+// Printer returns the Printer of the language of ctx, as set by the
+// Middleware of the Catalog.
+func (app *AuthApp) Printer(ctx context.Context) *i18n.Printer {
+	return app.Catalog.Printer(i18n.Language(ctx))
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestRenderPageNav(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET /user", app.UserGetHandler, webhandler.RouteLogin(), webhandler.RouteTitle("Account"))
+	mux.HandleFunc("/profile", app.ProfileHandler, webhandler.RouteLogin(),
+		webhandler.RouteTitle("Profile"), webhandler.RouteParent("/user"))
+	mux.HandleFunc("/users", app.UsersHandler, webhandler.RoutePermissions(string(webauth.PermViewUsers)),
+		webhandler.RouteTitle("Users"))
+	mux.HandleFunc("/admin/search", app.AdminSearchHandler, webhandler.RoutePermissions(string(webauth.PermViewUsers)),
+		webhandler.RouteTitle("Search"))
+
+	get := func(token, target string) string {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	testToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+	body := get(testToken.Value, "/profile")
+	if !strings.Contains(body, `<li><a href="/user">Account</a></li>`) ||
+		!strings.Contains(body, `<li aria-current="page">Profile</li>`) {
+		t.Errorf("profile page missing breadcrumbs")
+	}
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	body = get(adminToken.Value, "/admin/search")
+	if !strings.Contains(body, `<a href="/users">Users</a>`) ||
+		!strings.Contains(body, `<a href="/admin/search" aria-current="page">Search</a>`) {
+		t.Errorf("search page missing menu")
+	}
+}
+
+func TestPageMethods(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	handlers := map[string]http.HandlerFunc{
+		"AccountDeleteHandler": app.AccountDeleteHandler,
+		"AnnouncementsHandler": app.AnnouncementsHandler,
+		"APIRoutesHandler":     app.APIRoutesHandler,
+		"EmailPrefsHandler":    app.EmailPrefsHandler,
+		"MagicHandler":         app.MagicHandler,
+		"ProfileHandler":       app.ProfileHandler,
+		"TokensHandler":        app.TokensHandler,
+		"UnsubscribeHandler":   app.UnsubscribeHandler,
+		"UsernameHandler":      app.UsernameHandler,
+		"WaitlistHandler":      app.WaitlistHandler,
+	}
+
+	const wantAllow = "GET, HEAD, POST, OPTIONS"
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodOptions, "/", nil))
+			if w.Code != http.StatusNoContent || w.Header().Get("Allow") != wantAllow {
+				t.Errorf("OPTIONS = %d %q, want %d %q", w.Code, w.Header().Get("Allow"), http.StatusNoContent, wantAllow)
+			}
+
+			w = httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPut, "/", nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("PUT = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+			}
+		})
+	}
+}
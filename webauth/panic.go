@@ -0,0 +1,157 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// StackHashLen is the number of hex characters of a stack hash.
+const StackHashLen = 12
+
+// MaxRecentPanics is the number of panics shown on the events page.
+const MaxRecentPanics = 10
+
+// StackHash returns a short hash of stack that identifies where a panic
+// occurred. Goroutine IDs, arguments, and program counter offsets are
+// ignored, so the same panic has the same hash across requests.
+func StackHash(stack []byte) string {
+	h := sha256.New()
+
+	scanner := bufio.NewScanner(bytes.NewReader(stack))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+
+		line, _, _ = strings.Cut(line, " +0x")
+		if !strings.HasPrefix(line, "\t") {
+			if i := strings.LastIndex(line, "("); i > 0 {
+				line = line[:i]
+			}
+		}
+
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:StackHashLen]
+}
+
+// RecordPanic is a webhandler.PanicFunc that writes a panic event with the
+// request path, the logged in user, if any, and the stack hash.
+func (app *AuthApp) RecordPanic(r *http.Request, v any, stack []byte) {
+	// Don't use UserFromRequest, since it may write a cookie.
+	var username string
+	if token, _, err := app.loginCookieToken(r); err == nil && token != "" {
+		if user, err := app.DB.UserForLoginToken(token); err == nil {
+			username = user.Username
+		}
+	}
+
+	app.DB.RecordEvent(NewEvent(TypePanic, username, EventDetails{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"stack":  StackHash(stack),
+		"value":  fmt.Sprint(v),
+	}))
+}
+
+// RecentPanics returns up to n panic events from events, which are
+// assumed to be sorted newest first.
+func RecentPanics(events []Event, n int) []Event {
+	var panics []Event
+	for _, e := range events {
+		if len(panics) == n {
+			break
+		}
+		if e.Name == EventPanic {
+			panics = append(panics, e)
+		}
+	}
+
+	return panics
+}
+
+// ErrorTmpl is the template of the page shown after an error or a panic.
+const ErrorTmpl = "error.html"
+
+// ErrorPageData contains data to render the error template.
+type ErrorPageData struct {
+	CommonData
+	RequestID string           // RequestID identifies the request in the logs.
+	Problem   *webutil.Problem // Problem is the error, or nil after a panic.
+}
+
+// PanicPage is a webhandler.PanicResponder that shows the error template
+// with the request ID, so users can report it. Requests for the API, or
+// that want JSON, get the JSON of webhandler.RespondToPanicWithJSON
+// instead. If
+// the template cannot be rendered, a plain error is returned.
+func (app *AuthApp) PanicPage(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, APIPrefix+"/") || webutil.WantsJSON(r) {
+		webhandler.RespondToPanicWithJSON(w, r)
+		return
+	}
+
+	if err := app.renderError(w, r, http.StatusInternalServerError, nil); err != nil {
+		webhandler.RequestLogger(r).Error("unable to render template", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+	}
+}
+
+// ErrorPage is a webutil.ErrorPage that shows p with the error template.
+// Requests for the API get p as application/problem+json instead.
+func (app *AuthApp) ErrorPage(w http.ResponseWriter, r *http.Request, p webutil.Problem) error {
+	if strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+		return webutil.WriteProblem(w, p)
+	}
+
+	return app.renderError(w, r, p.Status, &p)
+}
+
+// errNoTemplates is returned to render a page without templates.
+var errNoTemplates = errors.New("no templates")
+
+// renderError responds with status and the error template for p, or for a
+// panic if p is nil. Nothing is written if it returns an error.
+func (app *AuthApp) renderError(w http.ResponseWriter, r *http.Request, status int, p *webutil.Problem) error {
+	if app.Tmpl == nil {
+		return errNoTemplates
+	}
+
+	data := ErrorPageData{
+		CommonData: CommonData{
+			Title:    app.Cfg.App.Name,
+			CSPNonce: webhandler.CSPNonce(r.Context()),
+		},
+		RequestID: webhandler.RequestID(r.Context()),
+		Problem:   p,
+	}
+	data.SetPrinter(app.Printer(r.Context()))
+
+	// Render to a buffer, since the status must be set before the body.
+	var buf bytes.Buffer
+	if err := app.Tmpl.ExecuteTemplate(&buf, ErrorTmpl, data); err != nil {
+		return err
+	}
+
+	webutil.SetNoCacheHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// stackAt returns the stack of the caller, so calls from the same line
+// have the same stack.
+func stackAt() []byte {
+	return debug.Stack()
+}
+
+func TestStackHash(t *testing.T) {
+	var stacks [][]byte
+	for i := 0; i < 2; i++ {
+		stacks = append(stacks, stackAt())
+	}
+	other := stackAt()
+
+	a, b, c := webauth.StackHash(stacks[0]), webauth.StackHash(stacks[1]), webauth.StackHash(other)
+	if len(a) != webauth.StackHashLen {
+		t.Errorf("len(StackHash()) = %d, want %d", len(a), webauth.StackHashLen)
+	}
+	if a != b {
+		t.Errorf("StackHash() differs for same location: %q != %q", a, b)
+	}
+	if a == c {
+		t.Errorf("StackHash() same for different locations: %q", a)
+	}
+}
+
+func TestRecentPanics(t *testing.T) {
+	events := []webauth.Event{
+		{Name: webauth.EventPanic, Message: "1"},
+		{Name: webauth.EventLogin},
+		{Name: webauth.EventPanic, Message: "2"},
+		{Name: webauth.EventPanic, Message: "3"},
+	}
+
+	got := webauth.RecentPanics(events, 2)
+	if len(got) != 2 || got[0].Message != "1" || got[1].Message != "2" {
+		t.Errorf("RecentPanics() = %+v, want panics 1 and 2", got)
+	}
+}
+
+func TestRecordPanic(t *testing.T) {
+	app := AppForTest(t)
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+	app.RecordPanic(r, "boom", stackAt())
+
+	events, err := app.DB.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() failed: %v", err)
+	}
+
+	panics := webauth.RecentPanics(events, 1)
+	if len(panics) != 1 || panics[0].Username != "test" {
+		t.Fatalf("RecentPanics() = %+v, want panic for test", panics)
+	}
+}
+
+func TestPanicPage(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	h := webhandler.NewUUIDRequestIDMiddleware(webhandler.RecoverWithResponse(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			panic("boom")
+		}), app.PanicPage))
+
+	tests := []struct {
+		name, target, accept string
+		wantType, wantBody   string
+	}{
+		{"page", "/page", "text/html", "text/html; charset=utf-8", "Something went wrong"},
+		{"api", webauth.APIPrefix + "/users", "", "application/json", `"error":"Internal Server Error"`},
+		{"accept json", "/page", "application/json", "application/json", `"requestID":"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			r.Header.Set("Accept", tc.accept)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tc.wantType)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, tc.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tc.wantBody)
+			}
+			if reqID := rec.Header().Get("X-Request-ID"); reqID == "" || !strings.Contains(body, reqID) {
+				t.Errorf("body = %q, want request ID %q", body, reqID)
+			}
+		})
+	}
+}
+
+func TestErrorPage(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	h := webutil.WithErrorPage(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webutil.Error(w, r, http.StatusConflict, "taken", "That name is taken.")
+	}), app.ErrorPage)
+
+	tests := []struct {
+		name, target, accept string
+		wantType, wantBody   string
+	}{
+		{"page", "/page", "text/html", "text/html; charset=utf-8", "<h1>Conflict</h1>"},
+		{"api", webauth.APIPrefix + "/users", "", webutil.ProblemContentType, `"code":"taken"`},
+		{"accept problem", "/page", webutil.ProblemContentType, webutil.ProblemContentType, `"detail":"That name is taken."`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			r.Header.Set("Accept", tc.accept)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusConflict {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusConflict)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tc.wantType)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tc.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tc.wantBody)
+			}
+		})
+	}
+}
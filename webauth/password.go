@@ -0,0 +1,237 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes passwords for storage. Hashes are checked with
+// comparePasswords, which accepts any supported format, so a hasher can
+// be changed without invalidating existing passwords.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+
+	// NeedsRehash returns true if hashedPassword was not created by
+	// Hash with the current algorithm and parameters.
+	NeedsRehash(hashedPassword string) bool
+}
+
+// BcryptHasher is a PasswordHasher that uses bcrypt.
+type BcryptHasher struct {
+	Cost int // Cost is the bcrypt cost. If zero, bcrypt.DefaultCost is used.
+}
+
+// cost returns the cost of h or the default.
+func (h BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+// Hash returns the bcrypt hash of password.
+func (h BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// NeedsRehash returns true if hashedPassword is not a bcrypt hash with
+// the cost of h.
+func (h BcryptHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != h.cost()
+}
+
+// Argon2idHasher is a PasswordHasher that uses argon2id. Zero values use
+// the defaults, which follow the OWASP recommendation.
+type Argon2idHasher struct {
+	Time    uint32    // Time is the number of passes. Default 1.
+	Memory  uint32    // Memory is in KiB. Default 64 MiB.
+	Threads uint8     // Threads is the degree of parallelism. Default 4.
+	Rand    io.Reader // Rand is used for salts. If nil, crypto/rand is used.
+}
+
+// Sizes of the argon2id salt and key in bytes.
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// argon2Params are the parameters of an argon2id hash.
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// params returns the parameters of h with the defaults applied.
+func (h Argon2idHasher) params() argon2Params {
+	p := argon2Params{time: h.Time, memory: h.Memory, threads: h.Threads}
+	if p.time == 0 {
+		p.time = 1
+	}
+	if p.memory == 0 {
+		p.memory = 64 * 1024
+	}
+	if p.threads == 0 {
+		p.threads = 4
+	}
+	return p
+}
+
+// argon2Prefix starts the encoded argon2id hashes.
+const argon2Prefix = "$argon2id$"
+
+// Hash returns the argon2id hash of password encoded in the PHC string
+// format, e.g., $argon2id$v=19$m=65536,t=1,p=4$salt$key.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	r := h.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return "", err
+	}
+
+	p := h.params()
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix,
+		argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// NeedsRehash returns true if hashedPassword is not an argon2id hash with
+// the parameters of h.
+func (h Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	p, _, _, err := decodeArgon2id(hashedPassword)
+	return err != nil || p != h.params()
+}
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// decodeArgon2id returns the parameters, salt, and key of an encoded
+// argon2id hash.
+func decodeArgon2id(hashedPassword string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+
+	parts := strings.Split(strings.TrimPrefix(hashedPassword, argon2Prefix), "$")
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) || len(parts) != 4 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	_, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
+
+// comparePasswords compares the hashed password with the given password.
+// The hash can be bcrypt or argon2id.
+func comparePasswords(hashedPassword, password string) error {
+	if !strings.HasPrefix(hashedPassword, argon2Prefix) {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPassword, err)
+		}
+		return nil
+	}
+
+	p, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPassword, err)
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return fmt.Errorf("%w: hash mismatch", ErrInvalidPassword)
+	}
+
+	return nil
+}
+
+// PasswordComparer is implemented by a PasswordHasher that compares
+// passwords with their hashes itself, e.g., to count the comparisons in
+// tests. Other hashers compare by the algorithm of the hash.
+type PasswordComparer interface {
+	Compare(hashedPassword, password string) error
+}
+
+// comparePasswordsWith compares password with hashedPassword using h if it
+// is a PasswordComparer, or else comparePasswords.
+func comparePasswordsWith(h PasswordHasher, hashedPassword, password string) error {
+	if c, ok := h.(PasswordComparer); ok {
+		return c.Compare(hashedPassword, password)
+	}
+
+	return comparePasswords(hashedPassword, password)
+}
+
+// hasherOrDefault returns h, or a BcryptHasher with the default cost if h
+// is nil.
+func hasherOrDefault(h PasswordHasher) PasswordHasher {
+	if h == nil {
+		return BcryptHasher{}
+	}
+	return h
+}
+
+// ConfigPassword holds the algorithm and parameters used to hash new
+// passwords. Existing passwords are rehashed when a user logs in.
+type ConfigPassword struct {
+	Algorithm     string // "bcrypt" (default) or "argon2id".
+	BcryptCost    int    // Cost for bcrypt. Default bcrypt.DefaultCost.
+	Argon2Time    uint32 // Passes for argon2id. Default 1.
+	Argon2Memory  uint32 // Memory in KiB for argon2id. Default 65536.
+	Argon2Threads uint8  // Parallelism for argon2id. Default 4.
+}
+
+// Hasher returns the PasswordHasher for c.
+func (c ConfigPassword) Hasher() (PasswordHasher, error) {
+	switch c.Algorithm {
+	case "", "bcrypt":
+		if c.BcryptCost != 0 && (c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost) {
+			return nil, fmt.Errorf("invalid Password.BcryptCost %d", c.BcryptCost)
+		}
+		return BcryptHasher{Cost: c.BcryptCost}, nil
+	case "argon2id":
+		return Argon2idHasher{Time: c.Argon2Time, Memory: c.Argon2Memory, Threads: c.Argon2Threads}, nil
+	}
+
+	return nil, fmt.Errorf("unknown Password.Algorithm %q", c.Algorithm)
+}
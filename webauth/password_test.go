@@ -0,0 +1,145 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	bcryptHasher := webauth.BcryptHasher{Cost: 4}
+	argon2Hasher := webauth.Argon2idHasher{Time: 1, Memory: 1024, Threads: 1}
+
+	tests := []struct {
+		name   string
+		hasher webauth.PasswordHasher
+		other  webauth.PasswordHasher // other uses different parameters.
+		prefix string
+	}{
+		{"bcrypt", bcryptHasher, webauth.BcryptHasher{Cost: 5}, "$2a$04$"},
+		{"argon2id", argon2Hasher, webauth.Argon2idHasher{Time: 2, Memory: 1024, Threads: 1}, "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+
+	store := StoreForTest(t)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hashedPassword, err := tc.hasher.Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash() failed: %v", err)
+			}
+			if !strings.HasPrefix(hashedPassword, tc.prefix) {
+				t.Errorf("Hash() = %q, want prefix %q", hashedPassword, tc.prefix)
+			}
+
+			if err := store.SetHashedPassword("test", hashedPassword); err != nil {
+				t.Fatalf("SetHashedPassword() failed: %v", err)
+			}
+			if err := store.CheckPassword("test", "secret"); err != nil {
+				t.Errorf("CheckPassword() = %v, want nil", err)
+			}
+			if err := store.CheckPassword("test", "wrong"); !errors.Is(err, webauth.ErrInvalidPassword) {
+				t.Errorf("CheckPassword() for wrong password = %v, want %v", err, webauth.ErrInvalidPassword)
+			}
+
+			if tc.hasher.NeedsRehash(hashedPassword) {
+				t.Error("NeedsRehash() = true for own hash")
+			}
+			if !tc.other.NeedsRehash(hashedPassword) {
+				t.Error("NeedsRehash() = false for different parameters")
+			}
+		})
+	}
+
+	// Each hasher needs to rehash the hashes of the other.
+	b, _ := bcryptHasher.Hash("secret")
+	a, _ := argon2Hasher.Hash("secret")
+	if !argon2Hasher.NeedsRehash(b) || !bcryptHasher.NeedsRehash(a) {
+		t.Error("NeedsRehash() = false for hash of other algorithm")
+	}
+
+	for _, invalid := range []string{"", "$argon2id$", "$argon2id$v=19$m=x$salt$key", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if err := store.SetHashedPassword("test", invalid); err != nil {
+			t.Fatalf("SetHashedPassword() failed: %v", err)
+		}
+		if err := store.CheckPassword("test", "secret"); !errors.Is(err, webauth.ErrInvalidPassword) {
+			t.Errorf("CheckPassword() for hash %q = %v, want %v", invalid, err, webauth.ErrInvalidPassword)
+		}
+	}
+}
+
+func TestConfigPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     webauth.ConfigPassword
+		want    webauth.PasswordHasher
+		wantErr bool
+	}{
+		{"default", webauth.ConfigPassword{}, webauth.BcryptHasher{}, false},
+		{"bcryptCost", webauth.ConfigPassword{Algorithm: "bcrypt", BcryptCost: 12}, webauth.BcryptHasher{Cost: 12}, false},
+		{"bcryptInvalidCost", webauth.ConfigPassword{BcryptCost: 99}, nil, true},
+		{"argon2id", webauth.ConfigPassword{Algorithm: "argon2id", Argon2Memory: 19456, Argon2Time: 2}, webauth.Argon2idHasher{Time: 2, Memory: 19456}, false},
+		{"unknown", webauth.ConfigPassword{Algorithm: "md5"}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.cfg.Hasher()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Hasher() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Hasher() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginUserRehash(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Auth.Password = webauth.ConfigPassword{Algorithm: "argon2id", Argon2Memory: 1024, Argon2Threads: 1}
+	}}, webauth.WithDB(store))
+
+	before, err := store.HashedPassword("test")
+	if err != nil {
+		t.Fatalf("HashedPassword() failed: %v", err)
+	}
+	if !app.Hasher.NeedsRehash(before) {
+		t.Fatalf("test user already has an argon2id hash")
+	}
+
+	if _, err := app.LoginUser("test", "password"); err != nil {
+		t.Fatalf("LoginUser() failed: %v", err)
+	}
+
+	after, err := store.HashedPassword("test")
+	if err != nil {
+		t.Fatalf("HashedPassword() failed: %v", err)
+	}
+	if app.Hasher.NeedsRehash(after) {
+		t.Errorf("password not rehashed after login, got %q", after)
+	}
+
+	// The user can still login with the new hash.
+	if _, err := app.LoginUser("test", "password"); err != nil {
+		t.Errorf("LoginUser() after rehash failed: %v", err)
+	}
+
+	// New users are registered with the configured hasher.
+	if err := store.RegisterUser("new", "New User", "new@email", "password"); err != nil {
+		t.Fatalf("RegisterUser() failed: %v", err)
+	}
+	hashed, err := store.HashedPassword("new")
+	if err != nil {
+		t.Fatalf("HashedPassword() failed: %v", err)
+	}
+	if app.Hasher.NeedsRehash(hashed) {
+		t.Errorf("new user not hashed with argon2id, got %q", hashed)
+	}
+}
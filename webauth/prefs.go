@@ -0,0 +1,118 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Maximum lengths of a preference, matching the SQL schema.
+const (
+	MaxPrefNameLen  = 100
+	MaxPrefValueLen = 1000
+)
+
+var ErrPrefNotFound = errors.New("preference not found")
+
+// Pref returns the value of the preference name for username.
+//
+// If not found, ErrPrefNotFound is returned.
+func (db *AuthDB) Pref(username, name string) (string, error) {
+	if db == nil {
+		return "", ErrInvalidDB
+	}
+
+	var value string
+
+	qry := `SELECT value FROM user_prefs WHERE user_id = (SELECT id FROM users WHERE username = ?) AND name = ?`
+	err := db.QueryRow(qry, username, name).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrPrefNotFound
+		}
+		return "", err
+	}
+
+	return value, nil
+}
+
+// SetPref saves value as the preference name for username, replacing any
+// previous value.
+func (db *AuthDB) SetPref(username, name, value string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	if len(name) > MaxPrefNameLen || len(value) > MaxPrefValueLen {
+		return ErrValueTooLong
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(db.Rebind("DELETE FROM user_prefs WHERE user_id = (SELECT id FROM users WHERE username = ?) AND name = ?"), username, name)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(db.Rebind("INSERT INTO user_prefs(user_id, name, value) SELECT id, ?, ? FROM users WHERE username = ?"), name, value, username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrUserNotFound
+	}
+
+	return tx.Commit()
+}
+
+// DeletePref deletes the preference name for username, if it exists.
+func (db *AuthDB) DeletePref(username, name string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	_, err := db.Exec("DELETE FROM user_prefs WHERE user_id = (SELECT id FROM users WHERE username = ?) AND name = ?", username, name)
+	return err
+}
+
+// PrefNames returns the sorted names of the preferences for username that
+// start with prefix.
+func (db *AuthDB) PrefNames(username, prefix string) ([]string, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	// Filter by prefix here, instead of with LIKE, so that prefix does
+	// not need to be escaped.
+	qry := `SELECT name FROM user_prefs WHERE user_id = (SELECT id FROM users WHERE username = ?) ORDER BY name`
+	rows, err := db.Query(qry, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	return names, rows.Err()
+}
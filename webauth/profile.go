@@ -0,0 +1,224 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	EmailTokenKind    = "email"
+	EmailTokenSize    = 32
+	EmailTokenExpires = "1h"
+)
+
+var (
+	ErrFullNameInvalid    = errors.New("invalid full name")
+	ErrEmailInvalid       = errors.New("invalid email")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrEmailTokenNotFound = errors.New("email token not found")
+	ErrEmailTokenExpired  = errors.New("email token expired")
+	ErrEmailTokenUser     = errors.New("email token for another user")
+	ErrNoPendingEmail     = errors.New("no pending email")
+)
+
+// UpdateUserFullName changes the full name of username.
+func (db *AuthDB) UpdateUserFullName(username, fullName string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	return db.updateUser(username, "fullName = ?", fullName)
+}
+
+// UpdateUserEmail changes the email of username to email, which is
+// confirmed, and clears a pending email.
+func (db *AuthDB) UpdateUserEmail(username, email string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	return db.updateUser(username, "email = ?, confirmed = true, pending_email = NULL", email)
+}
+
+// SetPendingEmail saves email as the new email of username until it is
+// confirmed with UpdateUserEmail. An empty email clears it.
+func (db *AuthDB) SetPendingEmail(username, email string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	return db.updateUser(username, "pending_email = ?", sql.NullString{String: email, Valid: email != ""})
+}
+
+// PendingEmail returns the email of username waiting to be confirmed, or
+// "" if there is none.
+func (db *AuthDB) PendingEmail(username string) (string, error) {
+	if db == nil {
+		return "", ErrInvalidDB
+	}
+
+	var pending sql.NullString
+	err := db.QueryRow("SELECT pending_email FROM users WHERE username = ?", username).Scan(&pending)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return pending.String, nil
+}
+
+// updateUser sets the columns of username with set and args. The user is
+// checked first, since MySQL does not count rows that are not changed.
+func (db *AuthDB) updateUser(username, set string, args ...any) error {
+	return db.WithTx(func(tx *Tx) error {
+		var id string
+		err := tx.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET "+set+" WHERE id = ?", append(args, id)...)
+		return err
+	})
+}
+
+// UsernameForEmailToken returns the username for an email token.
+//
+// If token is not found, ErrEmailTokenNotFound is returned.
+//
+// If token is expired, ErrEmailTokenExpired is returned and token is removed.
+func (db *AuthDB) UsernameForEmailToken(tokenValue string) (string, error) {
+	var username string
+	var expires time.Time
+
+	qry := `SELECT users.username, tokens.expires FROM tokens JOIN users ON tokens.user_id = users.id WHERE kind = ? AND hashedValue = ? LIMIT 1`
+	err := db.QueryRow(qry, EmailTokenKind, Hash(tokenValue)).Scan(&username, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrEmailTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Check if token is expired.
+	if expires.Before(db.now()) {
+		db.RemoveToken(EmailTokenKind, tokenValue)
+		return "", ErrEmailTokenExpired
+	}
+
+	return username, nil
+}
+
+// Template for the email to confirm a new email.
+const emailChangeTemplate = `
+To confirm {{.Email}} as the email of your {{.Title}} account, please visit {{.BaseURL}}/profile?etoken={{.Token.Value}} by {{.Token.Expires.Format "January 2, 2006 3:04 PM MST"}}.
+
+You can ignore this message if you did not request to change your email.
+`
+
+// UpdateProfile changes the full name of user to fullName and, if email
+// differs from the current email, emails a link to confirm it. The email
+// of user is not changed until it is confirmed with ConfirmEmailChange.
+// It returns true if a link was sent.
+func (app *AuthApp) UpdateProfile(ctx context.Context, user User, fullName, email string) (bool, error) {
+	if fullName == "" || len(fullName) > maxFullNameLen {
+		return false, ErrFullNameInvalid
+	}
+	if len(email) > maxEmailLen || !strings.Contains(email, "@") {
+		return false, ErrEmailInvalid
+	}
+
+	if fullName != user.FullName {
+		if err := app.DB.UpdateUserFullName(user.Username, fullName); err != nil {
+			return false, err
+		}
+		app.DB.RecordEvent(NewEvent(TypeProfileName, user.Username, nil))
+	}
+
+	if strings.EqualFold(email, user.Email) {
+		return false, nil
+	}
+
+	exists, err := app.DB.EmailExists(email)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		app.DB.RecordEvent(NewEvent(TypeProfileEmailExists, user.Username, EventDetails{"email": email}))
+		return false, ErrEmailTaken
+	}
+
+	if err := app.DB.SetPendingEmail(user.Username, email); err != nil {
+		return false, err
+	}
+
+	token, err := app.DB.CreateToken(EmailTokenKind, user.Username, EmailTokenSize, EmailTokenExpires)
+	if err != nil {
+		return false, err
+	}
+
+	body, err := app.emailBody(ctx, "email_change", emailChangeTemplate,
+		emailData{Token: token, Email: email, Title: app.Cfg.App.Name, BaseURL: app.Cfg.Auth.BaseURL})
+	if err != nil {
+		return false, err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeProfileEmailRequested, user.Username, EventDetails{"email": email}))
+
+	subj := app.Printer(ctx).T("%s confirm email change", app.Cfg.App.Name)
+	return true, app.sendEmail(ctx, email, subj, body, nil)
+}
+
+// ConfirmEmailChange uses the email token value of user to change their
+// email to the pending email and returns it. The token must belong to
+// user, as for ConfirmDeletion.
+func (app *AuthApp) ConfirmEmailChange(user User, value string) (string, error) {
+	username, err := app.DB.UsernameForEmailToken(value)
+	if err != nil {
+		return "", err
+	}
+	if username != user.Username {
+		return "", ErrEmailTokenUser
+	}
+
+	email, err := app.DB.PendingEmail(username)
+	if err != nil {
+		return "", err
+	}
+	if email == "" {
+		return "", ErrNoPendingEmail
+	}
+
+	if err := app.DB.RemoveToken(EmailTokenKind, value); err != nil {
+		return "", err
+	}
+
+	// The email could have been registered since the change was requested.
+	exists, err := app.DB.EmailExists(email)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		app.DB.RecordEvent(NewEvent(TypeProfileEmailExists, username, EventDetails{"email": email}))
+		return "", ErrEmailTaken
+	}
+
+	if err := app.DB.UpdateUserEmail(username, email); err != nil {
+		return "", err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeProfileEmailChanged, username, EventDetails{"email": email}))
+
+	return email, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const ProfileTmpl = "profile.html"
+
+// Messages displayed to the user for a profile change.
+const (
+	MsgProfileSaved     = "Your profile was saved."
+	MsgProfileEmailSent = "Please check your email for a link to confirm your new email."
+	MsgFullNameInvalid  = "Please provide a full name of up to 70 characters."
+	MsgEmailInvalid     = "Please provide a valid email."
+	MsgEmailChanged     = "Your email was changed."
+	MsgEmailInvalidLink = "The link to confirm your email is invalid, expired, or for another user."
+)
+
+// ProfilePageData contains data to render the profile template.
+type ProfilePageData struct {
+	CommonData
+	User         User
+	PendingEmail string // PendingEmail is a new email to confirm.
+	Token        string // Token is the token of a link to confirm.
+	Message      string
+}
+
+// ProfileHandler handles /profile requests of the logged in user to change
+// their full name and email.
+//
+// A POST changes the full name and, for a new email, sends a link to
+// confirm it to the new email. The email is changed only once confirmed.
+// A GET with the token of the link shows a button to confirm, as for
+// AccountDeleteHandler.
+func (app *AuthApp) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.profileGet, Post: app.profilePost}.ServeHTTP(w, r)
+}
+
+// profileGet serves the profile or, with the token of the link, the
+// button to confirm the new email.
+func (app *AuthApp) profileGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.profileData(w, r, logger)
+	if !ok {
+		return
+	}
+	logger = logger.With("username", data.User.Username)
+
+	data.Token = r.URL.Query().Get("etoken")
+
+	app.renderProfile(w, r, logger, data)
+}
+
+// profilePost confirms the new email or changes the profile.
+func (app *AuthApp) profilePost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	data, ok := app.profileData(w, r, logger)
+	if !ok {
+		return
+	}
+	user := data.User
+	logger = logger.With("username", user.Username)
+
+	if r.PostFormValue("etoken") != "" {
+		email, err := app.ConfirmEmailChange(user, r.PostFormValue("etoken"))
+		switch {
+		case errors.Is(err, ErrEmailTokenNotFound),
+			errors.Is(err, ErrEmailTokenExpired),
+			errors.Is(err, ErrEmailTokenUser),
+			errors.Is(err, ErrNoPendingEmail):
+			logger.Warn("invalid token", "err", err)
+			data.Message = MsgEmailInvalidLink
+		case errors.Is(err, ErrEmailTaken):
+			data.Message = MsgEmailExists
+		case err != nil:
+			logger.Error("failed to change email", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		default:
+			logger.Info("changed email", "email", email)
+			data.User.Email = email
+			data.User.Confirmed = true
+			data.Message = MsgEmailChanged
+		}
+
+		app.renderProfile(w, r, logger, data)
+		return
+	}
+
+	fullName := strings.TrimSpace(r.PostFormValue("fullName"))
+	email := strings.TrimSpace(r.PostFormValue("email"))
+
+	sent, err := app.UpdateProfile(r.Context(), user, fullName, email)
+	switch {
+	case errors.Is(err, ErrFullNameInvalid):
+		data.Message = MsgFullNameInvalid
+	case errors.Is(err, ErrEmailInvalid):
+		data.Message = MsgEmailInvalid
+	case errors.Is(err, ErrEmailTaken):
+		data.User.FullName = fullName
+		data.Message = MsgEmailExists
+	case err != nil && !errors.Is(err, ErrEmailSuppressed):
+		logger.Error("failed to update profile", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	case sent:
+		logger.Info("requested email change", "email", email)
+		data.User.FullName = fullName
+		data.Message = MsgProfileEmailSent
+	default:
+		logger.Info("saved profile")
+		data.User.FullName = fullName
+		data.Message = MsgProfileSaved
+	}
+
+	app.renderProfile(w, r, logger, data)
+}
+
+// profileData returns the data of the profile page of the logged in user.
+// If the user cannot be found, an error is written, and if the user is
+// not logged in, the page is rendered, and false is returned.
+func (app *AuthApp) profileData(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (ProfilePageData, bool) {
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return ProfilePageData{}, false
+	}
+
+	data := ProfilePageData{User: user}
+	if user.Username == "" {
+		app.RenderPage(w, r, logger, ProfileTmpl, &data)
+		return ProfilePageData{}, false
+	}
+
+	return data, true
+}
+
+// renderProfile renders the profile page of data with the pending email
+// of the user.
+func (app *AuthApp) renderProfile(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data ProfilePageData) {
+	var err error
+	data.PendingEmail, err = app.DB.PendingEmail(data.User.Username)
+	if err != nil {
+		logger.Error("failed to get pending email", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.RenderPage(w, r, logger, ProfileTmpl, &data)
+
+	logger.Info("done")
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestMemStoreUpdateUser(t *testing.T) {
+	store := StoreForTest(t)
+
+	if err := store.UpdateUserFullName("missing", "Name"); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("UpdateUserFullName() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+	if err := store.UpdateUserFullName("test", "New Name"); err != nil {
+		t.Fatalf("UpdateUserFullName() failed: %v", err)
+	}
+
+	if err := store.SetPendingEmail("unconfirmed", "new@email"); err != nil {
+		t.Fatalf("SetPendingEmail() failed: %v", err)
+	}
+	if email, err := store.PendingEmail("unconfirmed"); err != nil || email != "new@email" {
+		t.Errorf("PendingEmail() = %q, %v, want new@email", email, err)
+	}
+
+	if err := store.UpdateUserEmail("unconfirmed", "admin@email"); !errors.Is(err, webauth.ErrEmailTaken) {
+		t.Errorf("UpdateUserEmail() to email of other user = %v, want %v", err, webauth.ErrEmailTaken)
+	}
+	if err := store.UpdateUserEmail("unconfirmed", "new@email"); err != nil {
+		t.Fatalf("UpdateUserEmail() failed: %v", err)
+	}
+
+	user, err := store.UserForName("unconfirmed")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+	if user.Email != "new@email" || !user.Confirmed {
+		t.Errorf("user = %+v, want confirmed new@email", user)
+	}
+	if email, _ := store.PendingEmail("unconfirmed"); email != "" {
+		t.Errorf("PendingEmail() after UpdateUserEmail() = %q, want none", email)
+	}
+}
+
+func TestProfileHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	request := func(method, target string, data url.Values) string {
+		w := requestAs(app.ProfileHandler, login.Value, method, target, data.Encode())
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s status = %d, want %d", method, target, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name     string
+		fullName string
+		email    string
+		want     string
+	}{
+		{"missingFullName", "", "test@email", webauth.MsgFullNameInvalid},
+		{"invalidEmail", "Test User", "email", webauth.MsgEmailInvalid},
+		{"emailExists", "Test User", "admin@email", webauth.MsgEmailExists},
+		{"fullName", "Tess User", "test@email", webauth.MsgProfileSaved},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := request(http.MethodPost, "/profile", url.Values{"fullName": {tc.fullName}, "email": {tc.email}})
+			if !strings.Contains(body, tc.want) {
+				t.Errorf("got %q, expected %q in body", body, tc.want)
+			}
+		})
+	}
+
+	if user, _ := store.UserForName("test"); user.FullName != "Tess User" {
+		t.Errorf("FullName = %q, want %q", user.FullName, "Tess User")
+	}
+
+	// The email is not changed until it is confirmed.
+	body := request(http.MethodPost, "/profile", url.Values{"fullName": {"Tess User"}, "email": {"tess@email"}})
+	if !strings.Contains(body, webauth.MsgProfileEmailSent) {
+		t.Errorf("got %q, expected %q in body", body, webauth.MsgProfileEmailSent)
+	}
+	if user, _ := store.UserForName("test"); user.Email != "test@email" {
+		t.Errorf("Email before confirm = %q, want test@email", user.Email)
+	}
+
+	other, err := store.CreateToken(webauth.EmailTokenKind, "admin", webauth.EmailTokenSize, webauth.EmailTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if body := request(http.MethodPost, "/profile", url.Values{"etoken": {other.Value}}); !strings.Contains(body, webauth.MsgEmailInvalidLink) {
+		t.Errorf("token of other user got %q, expected %q in body", body, webauth.MsgEmailInvalidLink)
+	}
+
+	token, err := store.CreateToken(webauth.EmailTokenKind, "test", webauth.EmailTokenSize, webauth.EmailTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if body := request(http.MethodGet, "/profile?etoken="+url.QueryEscape(token.Value), nil); !strings.Contains(body, `id="confirm"`) {
+		t.Errorf("link got %q, want confirm button", body)
+	}
+	if body := request(http.MethodPost, "/profile", url.Values{"etoken": {token.Value}}); !strings.Contains(body, webauth.MsgEmailChanged) {
+		t.Errorf("confirm got %q, expected %q in body", body, webauth.MsgEmailChanged)
+	}
+	if user, _ := store.UserForName("test"); user.Email != "tess@email" {
+		t.Errorf("Email after confirm = %q, want tess@email", user.Email)
+	}
+
+	// The token can only be used once.
+	if body := request(http.MethodPost, "/profile", url.Values{"etoken": {token.Value}}); !strings.Contains(body, webauth.MsgEmailInvalidLink) {
+		t.Errorf("reused token got %q, expected %q in body", body, webauth.MsgEmailInvalidLink)
+	}
+}
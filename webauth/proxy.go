@@ -0,0 +1,25 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// ConfigProxy holds settings for reverse proxies in front of the app.
+type ConfigProxy struct {
+	// Trusted are the IPs or CIDRs of reverse proxies whose Forwarded,
+	// X-Forwarded-For, and X-Real-IP headers are trusted to find the
+	// client. Headers of other connections are ignored.
+	Trusted []string
+}
+
+// RealIP returns middleware that finds the IP of the client, which is
+// used for logging, rate limits, location restrictions, and events, using
+// the proxies in Proxy.Trusted.
+func (app *AuthApp) RealIP(next http.Handler) http.Handler {
+	return webhandler.RealIP(next, app.trustedProxies)
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withTrustedProxies returns a config modifier that sets Proxy.Trusted.
+func withTrustedProxies(trusted ...string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Proxy.Trusted = trusted
+	}
+}
+
+func TestRealIPGeo(t *testing.T) {
+	app := newAppForTest(t,
+		[]func(*webauth.Config){
+			withGeo(webauth.ConfigGeo{Block: []string{"CN"}}),
+			withTrustedProxies("10.0.0.0/8"),
+		},
+		webauth.WithDB(StoreForTest(t)), webauth.WithGeoLocator(geoForTest))
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantBlocked  bool
+	}{
+		{"direct", "192.0.2.1:1234", "", true},
+		{"proxied", "10.0.0.1:1234", "192.0.2.1", true},
+		{"proxiedAllowed", "10.0.0.1:1234", "203.0.113.1", false},
+		// The header is not trusted from other addresses.
+		{"spoofed", "192.0.2.1:1234", "203.0.113.1", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := url.Values{"username": {"test"}, "password": {"password"}}
+			r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(data.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+
+			app.RealIP(http.HandlerFunc(app.LoginPostHandler)).ServeHTTP(w, r)
+
+			if blocked := strings.Contains(w.Body.String(), webauth.MsgGeoBlocked); blocked != tc.wantBlocked {
+				t.Errorf("blocked = %v, want %v", blocked, tc.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestConfigProxyInvalid(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	withTrustedProxies("10.0.0.0/40")(cfg)
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
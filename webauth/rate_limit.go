@@ -0,0 +1,218 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// ConfigRateLimit holds the quota of API requests for each rate limit key.
+// A zero Limit means API requests are not limited.
+type ConfigRateLimit struct {
+	Limit  int    // Limit is the number of requests allowed per Window.
+	Window string // Window is a duration string, such as "1h".
+}
+
+// rateLimit is the parsed ConfigRateLimit.
+type rateLimit struct {
+	limit  int
+	window time.Duration
+}
+
+// parse returns the limit and window of c.
+func (c ConfigRateLimit) parse() (rateLimit, error) {
+	if c.Limit < 0 {
+		return rateLimit{}, fmt.Errorf("negative RateLimit.Limit %d", c.Limit)
+	}
+	if c.Limit == 0 {
+		return rateLimit{}, nil
+	}
+
+	window, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return rateLimit{}, fmt.Errorf("invalid RateLimit.Window: %w", err)
+	}
+	if window < time.Second {
+		return rateLimit{}, fmt.Errorf("RateLimit.Window %q less than 1s", c.Window)
+	}
+
+	return rateLimit{limit: c.Limit, window: window}, nil
+}
+
+// RateLimitUsage is the number of requests counted for a rate limit key
+// in the window that starts at Window.
+type RateLimitUsage struct {
+	Key      string
+	Window   time.Time
+	Requests int
+}
+
+// MaxRateLimitKeyLen is the maximum length of a rate limit key, matching
+// the SQL schema.
+const MaxRateLimitKeyLen = 255
+
+// RateLimitHistory is how long the counts of a window are kept after it
+// starts, so that recent usage can be shown to admins.
+const RateLimitHistory = 24 * time.Hour
+
+// CountRequest adds a request for key in the window that starts at window
+// and returns the number of requests in it. Counts for earlier windows are
+// kept until removed by PurgeRateLimits.
+func (db *AuthDB) CountRequest(key string, window time.Time) (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	if len(key) > MaxRateLimitKeyLen {
+		return 0, ErrValueTooLong
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := db.Dialect.bindArgs([]any{key, window})
+
+	// Concurrent requests for a new window must not both insert it.
+	qry := "INSERT INTO rate_limits(quota_key, window_start, requests) VALUES (?, ?, 1)" +
+		db.Dialect.onConflict("quota_key, window_start", "requests = rate_limits.requests + 1")
+	if _, err = tx.Exec(db.Rebind(qry), args...); err != nil {
+		return 0, err
+	}
+
+	var requests int
+	err = tx.QueryRow(db.Rebind("SELECT requests FROM rate_limits WHERE quota_key = ? AND window_start = ?"), args...).Scan(&requests)
+	if err != nil {
+		return 0, err
+	}
+
+	return requests, tx.Commit()
+}
+
+// PurgeRateLimits removes the counts of windows that start before before
+// and returns the number removed.
+func (db *AuthDB) PurgeRateLimits(before time.Time) (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	result, err := db.Exec("DELETE FROM rate_limits WHERE window_start < ?", before)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+// RateLimitUsage returns the usage of each key in windows that start at
+// or after since, with the most requests first.
+func (db *AuthDB) RateLimitUsage(since time.Time) ([]RateLimitUsage, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT quota_key, window_start, requests FROM rate_limits WHERE window_start >= ? ORDER BY requests DESC, quota_key`
+	rows, err := db.Query(qry, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usage []RateLimitUsage
+	for rows.Next() {
+		var u RateLimitUsage
+		if err := rows.Scan(&u.Key, &u.Window, &u.Requests); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+
+	return usage, rows.Err()
+}
+
+// rateLimitWindow returns the start of the window that contains now.
+func (app *AuthApp) rateLimitWindow(now time.Time) time.Time {
+	return now.UTC().Truncate(app.rateLimit.window)
+}
+
+// rateLimitKey returns the key that r is counted against, which is the
+// key of a verified signature, the user of the login token, if valid, or
+// the client address.
+func (app *AuthApp) rateLimitKey(r *http.Request) string {
+	if id, ok := webhandler.SignatureKeyID(r.Context()); ok {
+		return "key:" + id
+	}
+
+	if token, _, err := app.loginCookieToken(r); err == nil && token != "" {
+		user, err := app.DB.UserForLoginTokenContext(r.Context(), token)
+		if err == nil {
+			return "user:" + user.Username
+		}
+	}
+
+	return "ip:" + remoteHost(r)
+}
+
+// remoteHost returns the host of the connection of r, or the client found
+// by RealIP from the headers of a trusted proxy. Unlike headers set by the
+// client, it cannot be spoofed to avoid a limit.
+func remoteHost(r *http.Request) string {
+	if ip, ok := webutil.ClientIPFromContext(r.Context()); ok {
+		return ip.String()
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+// APIQuota is a webhandler.QuotaFunc that counts requests to the API
+// prefixes of Config.Deadline against Config.RateLimit. Other requests
+// are not limited.
+func (app *AuthApp) APIQuota(r *http.Request) (webhandler.Quota, bool, error) {
+	if app.rateLimit.limit == 0 || !app.isAPIRequest(r) {
+		return webhandler.Quota{}, false, nil
+	}
+
+	window := app.rateLimitWindow(app.Clock.Now())
+	requests, err := app.DB.CountRequest(app.rateLimitKey(r), window)
+	if err != nil {
+		return webhandler.Quota{}, false, err
+	}
+
+	return webhandler.Quota{
+		Limit:     app.rateLimit.limit,
+		Remaining: app.rateLimit.limit - requests,
+		Reset:     window.Add(app.rateLimit.window),
+	}, true, nil
+}
+
+// isAPIRequest returns true if the path of r has an API prefix.
+func (app *AuthApp) isAPIRequest(r *http.Request) bool {
+	for _, prefix := range app.timeouts.apiPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RateLimit returns middleware that limits API requests handled by next
+// using APIQuota.
+func (app *AuthApp) RateLimit(next http.Handler) http.Handler {
+	return webhandler.RateLimit(next, app.APIQuota)
+}
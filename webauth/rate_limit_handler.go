@@ -0,0 +1,81 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// RateLimitRow is the usage of a rate limit key in a window.
+type RateLimitRow struct {
+	RateLimitUsage
+	Remaining int       // Remaining is the number of requests left.
+	Reset     time.Time // Reset is when the window ends.
+}
+
+// RateLimitsPageData contains data passed to the HTML template.
+type RateLimitsPageData struct {
+	CommonData
+	User   User
+	Limit  int           // Limit is the number of requests allowed per Window.
+	Window time.Duration // Window is zero if API requests are not limited.
+	Usage  []RateLimitRow
+}
+
+// RateLimitsHandler shows an admin the API requests of each rate limit key
+// in the windows of the last RateLimitHistory.
+func (app *AuthApp) RateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	if !user.Can(PermViewRateLimits) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	data := &RateLimitsPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Limit:      app.rateLimit.limit,
+		Window:     app.rateLimit.window,
+	}
+
+	if data.Limit > 0 {
+		since := app.Clock.Now().Add(-RateLimitHistory)
+
+		usage, err := app.DB.RateLimitUsage(since)
+		if err != nil {
+			logger.Error("failed to get rate limit usage", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		for _, u := range usage {
+			data.Usage = append(data.Usage, RateLimitRow{
+				RateLimitUsage: u,
+				Remaining:      max(data.Limit-u.Requests, 0),
+				Reset:          u.Window.Add(data.Window),
+			})
+		}
+	}
+
+	app.RenderPage(w, r, logger, "ratelimits.html", data)
+
+	logger.Info("done")
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withRateLimit returns a func to set the rate limit of a Config.
+func withRateLimit(limit int, window string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.RateLimit = webauth.ConfigRateLimit{Limit: limit, Window: window}
+	}
+}
+
+func TestConfigRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		window  string
+		wantErr bool
+	}{
+		{"disabled", 0, "", false},
+		{"valid", 10, "1m", false},
+		{"negative", -1, "1m", true},
+		{"missingWindow", 10, "", true},
+		{"shortWindow", 10, "10ms", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			withRateLimit(tc.limit, tc.window)(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if tc.wantErr != errors.Is(err, webauth.ErrInvalidConfig) {
+				t.Errorf("NewApp() = %v, want ErrInvalidConfig %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIQuota(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC))
+	app := newAppForTest(t, []func(*webauth.Config){withRateLimit(2, "1m")},
+		webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	reset := time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		target        string
+		addr          string
+		realIP        string
+		token         string
+		wantOK        bool
+		wantRemaining int
+	}{
+		{"page", "/login", "192.0.2.1:1234", "", "", false, 0},
+		{"first", "/api/test", "192.0.2.1:1234", "", "", true, 1},
+		{"otherPort", "/api/test", "192.0.2.1:5678", "", "", true, 0},
+		{"exceeded", "/api/test", "192.0.2.1:1234", "", "", true, -1},
+		// The header is set by the client, so cannot avoid the limit.
+		{"spoofedHeader", "/api/test", "192.0.2.1:1234", "192.0.2.3", "", true, -2},
+		{"otherAddr", "/api/test", "192.0.2.2:1234", "", "", true, 1},
+		{"user", "/api/test", "192.0.2.1:1234", "", token.Value, true, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			r.RemoteAddr = tc.addr
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			if tc.token != "" {
+				r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: tc.token})
+			}
+
+			q, ok, err := app.APIQuota(r)
+			if err != nil {
+				t.Fatalf("APIQuota() failed: %v", err)
+			}
+			if ok != tc.wantOK {
+				t.Fatalf("APIQuota() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if q.Limit != 2 || q.Remaining != tc.wantRemaining || !q.Reset.Equal(reset) {
+				t.Errorf("APIQuota() = %+v, want Limit 2, Remaining %d, Reset %v", q, tc.wantRemaining, reset)
+			}
+		})
+	}
+
+	// A new window resets the count.
+	clock.Advance(time.Minute)
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	q, _, err := app.APIQuota(r)
+	if err != nil {
+		t.Fatalf("APIQuota() failed: %v", err)
+	}
+	if q.Remaining != 1 {
+		t.Errorf("APIQuota() in new window Remaining = %d, want 1", q.Remaining)
+	}
+}
+
+func TestRateLimitsHandler(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){withRateLimit(5, "1h")},
+		webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	// Count a request to show.
+	r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if _, _, err := app.APIQuota(r); err != nil {
+		t.Fatalf("APIQuota() failed: %v", err)
+	}
+
+	w := requestAs(app.RateLimitsHandler, userToken.Value, http.MethodGet, "/ratelimits", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status for user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = requestAs(app.RateLimitsHandler, adminToken.Value, http.MethodGet, "/ratelimits", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status for admin = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"5 requests per 1h0m0s", "<td>ip:192.0.2.1</td>", `<td style="text-align:right">4</td>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q", want)
+		}
+	}
+}
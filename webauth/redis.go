@@ -0,0 +1,260 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webredis"
+)
+
+// redisStore is an AuthStore that keeps session values, rate limits, and
+// locks in Redis, so they are shared by the instances of an app without
+// writes to the database. Logins are still checked with the database.
+type redisStore struct {
+	AuthStore
+	redis   *webredis.Client
+	clock   Clock
+	expires time.Duration // expires is how long session values are kept.
+}
+
+// newRedisStore returns db wrapped to keep state in redis. Session values
+// expire after expires, the longest a login can last.
+func newRedisStore(db AuthStore, redis *webredis.Client, clock Clock, expires time.Duration) *redisStore {
+	return &redisStore{AuthStore: db, redis: redis, clock: clock, expires: expires}
+}
+
+// valuesKey returns the key of the hash of the values of loginToken.
+func (s *redisStore) valuesKey(loginToken string) string {
+	return s.redis.Key("session:" + Hash(loginToken))
+}
+
+// loginActive returns true if loginToken is a current login token.
+func (s *redisStore) loginActive(loginToken string) (bool, error) {
+	_, err := s.UserForLoginToken(loginToken)
+	if errors.Is(err, ErrUserLoginTokenNotFound) || errors.Is(err, ErrUserLoginTokenExpired) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// SessionValue returns the value of key in the session of loginToken.
+//
+// If not found, or the login token is expired, ErrSessionValueNotFound is
+// returned.
+func (s *redisStore) SessionValue(loginToken, key string) (string, error) {
+	value, err := s.redis.String(context.Background(), "HGET", s.valuesKey(loginToken), key)
+	if errors.Is(err, webredis.ErrNil) {
+		return "", ErrSessionValueNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	active, err := s.loginActive(loginToken)
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return "", ErrSessionValueNotFound
+	}
+
+	return value, nil
+}
+
+// SetSessionValue saves value as key in the session of loginToken,
+// replacing any previous value.
+//
+// ErrNoSession is returned if loginToken is not a current login token,
+// and ErrTooManySessionValues if the session has MaxSessionValues other
+// keys.
+func (s *redisStore) SetSessionValue(loginToken, key, value string) error {
+	if len(key) > MaxSessionKeyLen || len(value) > MaxSessionValueLen {
+		return ErrValueTooLong
+	}
+
+	active, err := s.loginActive(loginToken)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrNoSession
+	}
+
+	ctx := context.Background()
+	hash := s.valuesKey(loginToken)
+
+	exists, err := s.redis.Int(ctx, "HEXISTS", hash, key)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		n, err := s.redis.Int(ctx, "HLEN", hash)
+		if err != nil {
+			return err
+		}
+		if n >= MaxSessionValues {
+			return ErrTooManySessionValues
+		}
+	}
+
+	if _, err := s.redis.Do(ctx, "HSET", hash, key, value); err != nil {
+		return err
+	}
+
+	_, err = s.redis.Do(ctx, "PEXPIRE", hash, strconv.FormatInt(s.expires.Milliseconds(), 10))
+	return err
+}
+
+// DeleteSessionValue deletes key from the session of loginToken, if it
+// exists.
+func (s *redisStore) DeleteSessionValue(loginToken, key string) error {
+	_, err := s.redis.Do(context.Background(), "HDEL", s.valuesKey(loginToken), key)
+	return err
+}
+
+// PurgeSessionValues deletes the values of sessions whose login token was
+// removed from the database, such as values saved before Redis was used.
+// Values in Redis expire on their own.
+func (s *redisStore) PurgeSessionValues() (int, error) {
+	return s.AuthStore.PurgeSessionValues()
+}
+
+// rateLimitPrefix is the start of the keys of rate limit counts, which are
+// followed by the Unix time of the window and the key of the rate limit.
+const rateLimitPrefix = "ratelimit:"
+
+// CountRequest adds a request for key in the window that starts at window
+// and returns the number of requests in it. Counts expire RateLimitHistory
+// after the window starts, or are removed earlier by PurgeRateLimits.
+func (s *redisStore) CountRequest(key string, window time.Time) (int, error) {
+	if len(key) > MaxRateLimitKeyLen {
+		return 0, ErrValueTooLong
+	}
+
+	ctx := context.Background()
+	counter := s.redis.Key(rateLimitPrefix + strconv.FormatInt(window.Unix(), 10) + ":" + key)
+
+	n, err := s.redis.Int(ctx, "INCR", counter)
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 1 {
+		ttl := max(window.Add(RateLimitHistory).Sub(s.clock.Now()), time.Second)
+		_, err = s.redis.Do(ctx, "PEXPIRE", counter, strconv.FormatInt(ttl.Milliseconds(), 10))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(n), nil
+}
+
+// rateLimits returns the rate limits of the windows for which keep returns
+// true, without their requests, and the names of their counters.
+func (s *redisStore) rateLimits(ctx context.Context, keep func(window time.Time) bool) ([]RateLimitUsage, []string, error) {
+	prefix := s.redis.Key(rateLimitPrefix)
+
+	counters, err := s.redis.Keys(ctx, prefix+"*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		usage []RateLimitUsage
+		kept  []string
+	)
+	for _, counter := range counters {
+		unix, key, ok := strings.Cut(strings.TrimPrefix(counter, prefix), ":")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			continue
+		}
+		window := time.Unix(sec, 0).UTC()
+		if keep(window) {
+			usage = append(usage, RateLimitUsage{Key: key, Window: window})
+			kept = append(kept, counter)
+		}
+	}
+
+	return usage, kept, nil
+}
+
+// PurgeRateLimits removes the counts of windows that start before before
+// and returns the number removed.
+func (s *redisStore) PurgeRateLimits(before time.Time) (int, error) {
+	ctx := context.Background()
+
+	_, counters, err := s.rateLimits(ctx, func(window time.Time) bool { return window.Before(before) })
+	if err != nil || len(counters) == 0 {
+		return 0, err
+	}
+
+	n, err := s.redis.Int(ctx, append([]string{"DEL"}, counters...)...)
+
+	return int(n), err
+}
+
+// RateLimitUsage returns the usage of each key in windows that start at
+// or after since, with the most requests first.
+func (s *redisStore) RateLimitUsage(since time.Time) ([]RateLimitUsage, error) {
+	ctx := context.Background()
+
+	usage, counters, err := s.rateLimits(ctx, func(window time.Time) bool { return !window.Before(since) })
+	if err != nil || len(counters) == 0 {
+		return nil, err
+	}
+
+	requests, err := s.redis.Strings(ctx, append([]string{"MGET"}, counters...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) != len(usage) {
+		return nil, fmt.Errorf("MGET returned %d of %d counts", len(requests), len(usage))
+	}
+
+	// Counts that expired since they were found are left out.
+	var found []RateLimitUsage
+	for i, u := range usage {
+		if requests[i] == "" {
+			continue
+		}
+		if u.Requests, err = strconv.Atoi(requests[i]); err != nil {
+			return nil, fmt.Errorf("invalid count of %s: %w", counters[i], err)
+		}
+		found = append(found, u)
+	}
+
+	slices.SortFunc(found, func(a, b RateLimitUsage) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Key, b.Key))
+	})
+
+	return found, nil
+}
+
+// TryLock acquires the lock of name for ttl in Redis and returns true, or
+// returns false if another instance holds it.
+func (s *redisStore) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return s.redis.TryLock(ctx, name, ttl)
+}
+
+// RunBroker relays the messages of app.Live between the instances of the
+// app through Redis until ctx is done, if Config.Redis is set.
+func (app *AuthApp) RunBroker(ctx context.Context) {
+	if app.broker != nil {
+		app.broker.Run(ctx)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webredis"
+	"github.com/bnixon67/webapp/webredis/redistest"
+	"github.com/bnixon67/webapp/websse"
+)
+
+// redisForTest returns a Redis server that is closed when the test ends,
+// and a function to use it in the config of an app.
+func redisForTest(t *testing.T) (*redistest.Server, func(*webauth.Config)) {
+	t.Helper()
+
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s, func(cfg *webauth.Config) {
+		cfg.Redis = webredis.Config{Addr: s.Addr(), Prefix: "test:", Timeout: "1s"}
+	}
+}
+
+func TestRedisSessionValues(t *testing.T) {
+	_, useRedis := redisForTest(t)
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){useRedis}, webauth.WithDB(store))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	if err := app.DB.SetSessionValue(token.Value, "step", "2"); err != nil {
+		t.Fatalf("SetSessionValue() failed: %v", err)
+	}
+	if got, err := app.DB.SessionValue(token.Value, "step"); err != nil || got != "2" {
+		t.Errorf("SessionValue() = %q, %v, want %q, nil", got, err, "2")
+	}
+
+	// The value is kept in Redis rather than the database.
+	if _, err := store.SessionValue(token.Value, "step"); !errors.Is(err, webauth.ErrSessionValueNotFound) {
+		t.Errorf("database SessionValue() error = %v, want %v", err, webauth.ErrSessionValueNotFound)
+	}
+
+	if err := app.DB.SetSessionValue("unknown", "step", "1"); !errors.Is(err, webauth.ErrNoSession) {
+		t.Errorf("SetSessionValue() of unknown login error = %v, want %v", err, webauth.ErrNoSession)
+	}
+
+	for i := 1; i < webauth.MaxSessionValues; i++ {
+		if err := app.DB.SetSessionValue(token.Value, string(rune('a'+i)), "v"); err != nil {
+			t.Fatalf("SetSessionValue() failed: %v", err)
+		}
+	}
+	if err := app.DB.SetSessionValue(token.Value, "more", "v"); !errors.Is(err, webauth.ErrTooManySessionValues) {
+		t.Errorf("SetSessionValue() error = %v, want %v", err, webauth.ErrTooManySessionValues)
+	}
+
+	if err := app.DB.DeleteSessionValue(token.Value, "step"); err != nil {
+		t.Fatalf("DeleteSessionValue() failed: %v", err)
+	}
+	if _, err := app.DB.SessionValue(token.Value, "step"); !errors.Is(err, webauth.ErrSessionValueNotFound) {
+		t.Errorf("SessionValue() after delete error = %v, want %v", err, webauth.ErrSessionValueNotFound)
+	}
+
+	// Values of a removed login are not found.
+	if err := app.DB.RemoveToken(webauth.LoginTokenKind, token.Value); err != nil {
+		t.Fatalf("RemoveToken() failed: %v", err)
+	}
+	if _, err := app.DB.SessionValue(token.Value, "b"); !errors.Is(err, webauth.ErrSessionValueNotFound) {
+		t.Errorf("SessionValue() after logout error = %v, want %v", err, webauth.ErrSessionValueNotFound)
+	}
+}
+
+func TestRedisRateLimits(t *testing.T) {
+	_, useRedis := redisForTest(t)
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+	app := newAppForTest(t, []func(*webauth.Config){useRedis}, webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	earlier := clock.Now().Add(-time.Hour)
+	window := clock.Now()
+
+	count := func(key string, window time.Time, want int) {
+		t.Helper()
+		got, err := app.DB.CountRequest(key, window)
+		if err != nil || got != want {
+			t.Errorf("CountRequest(%q) = %d, %v, want %d, nil", key, got, err, want)
+		}
+	}
+	count("user:a", earlier, 1)
+	count("user:a", window, 1)
+	count("user:a", window, 2)
+	count("user:a", window, 3)
+	count("user:b", window, 1)
+
+	usage, err := app.DB.RateLimitUsage(window)
+	if err != nil {
+		t.Fatalf("RateLimitUsage() failed: %v", err)
+	}
+	want := []webauth.RateLimitUsage{
+		{Key: "user:a", Window: window, Requests: 3},
+		{Key: "user:b", Window: window, Requests: 1},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("RateLimitUsage() = %v, want %v", usage, want)
+	}
+	for i := range want {
+		if usage[i].Key != want[i].Key || !usage[i].Window.Equal(want[i].Window) || usage[i].Requests != want[i].Requests {
+			t.Errorf("RateLimitUsage()[%d] = %v, want %v", i, usage[i], want[i])
+		}
+	}
+
+	n, err := app.DB.PurgeRateLimits(window)
+	if err != nil || n != 1 {
+		t.Errorf("PurgeRateLimits() = %d, %v, want 1, nil", n, err)
+	}
+	usage, err = app.DB.RateLimitUsage(earlier)
+	if err != nil || len(usage) != 2 {
+		t.Errorf("RateLimitUsage() after purge = %v, %v, want 2 keys", usage, err)
+	}
+}
+
+func TestRedisSessionCache(t *testing.T) {
+	_, useRedis := redisForTest(t)
+	useCache := func(cfg *webauth.Config) { cfg.Cache.Sessions = "1m" }
+
+	// Two instances share the database and Redis.
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){useRedis, useCache}, webauth.WithDB(store))
+	other := newAppForTest(t, []func(*webauth.Config){useRedis, useCache}, webauth.WithDB(store))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	username := func(app *webauth.AuthApp) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+		user, err := app.UserFromRequest(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("UserFromRequest() failed: %v", err)
+		}
+		return user.Username
+	}
+
+	if got := username(other); got != "test" {
+		t.Fatalf("username = %q, want %q", got, "test")
+	}
+
+	// A logout on one instance is seen at once by the other.
+	requestAs(app.LogoutHandler, token.Value, http.MethodGet, "/logout", "")
+	if got := username(other); got != "" {
+		t.Errorf("username = %q after logout on other instance, want empty", got)
+	}
+}
+
+func TestRedisCheck(t *testing.T) {
+	s, useRedis := redisForTest(t)
+	live := websse.NewServer()
+	live.Run()
+	defer live.Close()
+
+	app := newAppForTest(t, []func(*webauth.Config){useRedis}, webauth.WithDB(StoreForTest(t)), webauth.WithLive(live))
+
+	redisHealthy := func() bool {
+		for _, result := range app.Checks.Run(context.Background()) {
+			if result.Name == "redis" {
+				return result.Healthy
+			}
+		}
+		t.Fatal("no redis check")
+		return false
+	}
+
+	if !redisHealthy() {
+		t.Error("redis check is not healthy")
+	}
+
+	s.Close()
+	if redisHealthy() {
+		t.Error("redis check is healthy after server closed")
+	}
+}
+
+func TestConfigRedisInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*webauth.Config)
+	}{
+		{"timeout", func(c *webauth.Config) { c.Redis = webredis.Config{Addr: "localhost:6379", Timeout: "soon"} }},
+		{"poolSize", func(c *webauth.Config) { c.Redis = webredis.Config{Addr: "localhost:6379", PoolSize: -1} }},
+		{"db", func(c *webauth.Config) { c.Redis = webredis.Config{Addr: "localhost:6379", DB: -1} }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			tc.modify(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, webauth.ErrInvalidConfig) {
+				t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+			}
+		})
+	}
+}
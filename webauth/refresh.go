@@ -0,0 +1,389 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	RefreshTokenKind       = "refresh"
+	RefreshTokenSize       = 32
+	RefreshTokenCookieName = "refresh"
+)
+
+// spentRefreshTokenKind is the kind of a refresh token that was used. It
+// is kept until it expires to detect reuse.
+const spentRefreshTokenKind = "spent"
+
+// RefreshReuseGrace is how long a spent refresh token can still be used.
+// Concurrent requests with the same refresh cookie, such as from other
+// tabs or a reconnecting event stream, are not treated as a reuse.
+const RefreshReuseGrace = 30 * time.Second
+
+// APIRefreshPath is the path of APIRefreshHandler. It is exempt from CSRF,
+// like APILoginPath.
+const APIRefreshPath = APIPrefix + "/refresh"
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+// RefreshToken is a refresh token returned by UseRefreshToken.
+type RefreshToken struct {
+	Username string
+	Remember bool // Remember is true if the cookies persist.
+	Expires  time.Time
+
+	// Spent is true if the token was spent by another request within
+	// RefreshReuseGrace, which was given the next refresh token.
+	Spent bool
+}
+
+// session is a login token and the refresh token, if enabled, that renews
+// it.
+type session struct {
+	login    Token
+	refresh  Token
+	remember bool
+}
+
+// CreateRefreshToken creates and saves a refresh token for username that
+// expires at expires. Remember is saved with the token so that the
+// cookies of the next refresh token persist the same way.
+func (db *AuthDB) CreateRefreshToken(username string, remember bool, expires time.Time) (Token, error) {
+	if db == nil {
+		return Token{}, ErrInvalidDB
+	}
+
+	value, err := RandomStringFrom(randReader(db.Rand), RefreshTokenSize)
+	if err != nil {
+		return Token{}, err
+	}
+
+	qry := `INSERT INTO tokens (hashedValue, expires, kind, user_id, remember) SELECT ?, ?, ?, users.id, ? FROM users WHERE username = ?`
+	result, err := db.Exec(qry, Hash(value), expires, RefreshTokenKind, remember, username)
+	if err != nil {
+		return Token{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return Token{}, err
+	}
+	if rows != 1 {
+		return Token{}, ErrUserNotFound
+	}
+
+	return Token{Value: value, Expires: expires, Kind: RefreshTokenKind}, nil
+}
+
+// UseRefreshToken spends the refresh token with value, so that it cannot
+// be used again after RefreshReuseGrace, and returns it. A token used
+// again within RefreshReuseGrace is returned with Spent set.
+// ErrRefreshTokenReused is returned, with the token, if it was spent
+// before then.
+func (db *AuthDB) UseRefreshToken(value string) (RefreshToken, error) {
+	if db == nil {
+		return RefreshToken{}, ErrInvalidDB
+	}
+
+	var (
+		rt    RefreshToken
+		kind  string
+		spent sql.NullTime
+	)
+
+	hashedValue := Hash(value)
+	now := db.now()
+
+	qry := `SELECT tokens.kind, expires, remember, spent, username FROM tokens INNER JOIN users ON users.id = tokens.user_id WHERE hashedValue = ? AND tokens.kind IN (?, ?) LIMIT 1`
+	err := db.QueryRow(qry, hashedValue, RefreshTokenKind, spentRefreshTokenKind).Scan(&kind, &rt.Expires, &rt.Remember, &spent, &rt.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	if kind == spentRefreshTokenKind {
+		if spent.Valid && now.Sub(spent.Time) < RefreshReuseGrace {
+			rt.Spent = true
+			return rt, nil
+		}
+		return rt, ErrRefreshTokenReused
+	}
+	if rt.Expires.Before(now) {
+		return RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	// Only one request can spend the token. Another that raced it is
+	// within the grace period.
+	qry = `UPDATE tokens SET kind = ?, spent = ? WHERE kind = ? AND hashedValue = ?`
+	_, err = db.Exec(qry, spentRefreshTokenKind, now, RefreshTokenKind, hashedValue)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return rt, nil
+}
+
+// RevokeSessions removes the login and refresh tokens of username.
+func (db *AuthDB) RevokeSessions(username string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	qry := `DELETE FROM tokens WHERE kind IN (?, ?, ?) AND user_id IN (SELECT id FROM users WHERE username = ?)`
+	_, err := db.Exec(qry, LoginTokenKind, RefreshTokenKind, spentRefreshTokenKind, username)
+
+	return err
+}
+
+// newSession returns a session for the login token of a user that just
+// logged in, with a refresh token if enabled.
+func (app *AuthApp) newSession(login Token, remember bool) (session, error) {
+	s := session{login: login, remember: remember}
+	if app.refreshExpires == 0 {
+		return s, nil
+	}
+
+	user, err := app.DB.UserForLoginToken(login.Value)
+	if err != nil {
+		return session{}, err
+	}
+
+	s.refresh, err = app.DB.CreateRefreshToken(user.Username, remember, app.Clock.Now().Add(app.refreshExpires))
+	if err != nil {
+		return session{}, err
+	}
+
+	return s, nil
+}
+
+// refreshSession spends the refresh token value and returns a new session
+// with a new refresh token that expires later, so the session slides. If
+// a spent token is used again after RefreshReuseGrace, it may have been
+// stolen, so all sessions of the user are revoked.
+//
+// A token used again within RefreshReuseGrace, e.g., by a concurrent
+// request, only gets a login token. The request that spent it was given
+// the next refresh token, so another is not issued.
+func (app *AuthApp) refreshSession(value string) (session, error) {
+	rt, err := app.DB.UseRefreshToken(value)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := app.DB.RevokeSessions(rt.Username); err != nil {
+			return session{}, err
+		}
+		app.DB.RecordEvent(NewEvent(TypeRefreshReused, rt.Username, nil))
+		return session{}, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return session{}, err
+	}
+
+	login, err := app.CreateLoginToken(rt.Username)
+	if err != nil {
+		app.DB.RecordEvent(ErrorEvent(TypeRefreshFailed, rt.Username, err))
+		return session{}, err
+	}
+
+	if rt.Spent {
+		return session{login: login, remember: rt.Remember}, nil
+	}
+
+	refresh, err := app.DB.CreateRefreshToken(rt.Username, rt.Remember, app.Clock.Now().Add(app.refreshExpires))
+	if err != nil {
+		return session{}, err
+	}
+
+	return session{login: login, refresh: refresh, remember: rt.Remember}, nil
+}
+
+// setSessionCookies sets the login cookie and the refresh cookie, if s has
+// a refresh token. The refresh cookie is sent to every path, so that
+// RefreshSession can renew the session of any request.
+func (app *AuthApp) setSessionCookies(w http.ResponseWriter, s session) {
+	http.SetCookie(w, app.loginCookie(s.login, s.remember))
+
+	if s.refresh.Value == "" {
+		return
+	}
+
+	c := &http.Cookie{
+		Name:     app.refreshCookieName(),
+		Value:    app.cookies.encode(s.refresh.Value),
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if s.remember {
+		c.Expires = s.refresh.Expires
+	}
+	http.SetCookie(w, c)
+}
+
+// clearRefreshCookie removes the refresh cookie.
+func (app *AuthApp) clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   app.refreshCookieName(),
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+		Secure: app.Cfg.Security.Hardened,
+	})
+}
+
+// refreshCookieToken returns the refresh token of the refresh cookie of r,
+// or an empty string if there is none or it is not in an accepted format.
+func (app *AuthApp) refreshCookieToken(r *http.Request) string {
+	value, err := CookieValue(r, app.refreshCookieName())
+	if err != nil || value == "" {
+		return ""
+	}
+
+	token, _, err := app.cookies.decode(value)
+	if err != nil {
+		return ""
+	}
+
+	return token
+}
+
+// loginFresh returns true if the login token of r is valid for more than
+// half of LoginExpires, so it does not need to be refreshed.
+func (app *AuthApp) loginFresh(r *http.Request) bool {
+	token, _, err := app.loginCookieToken(r)
+	if errors.Is(err, ErrCookieTooNew) {
+		// Leave the session to the newer instance that wrote it.
+		return true
+	}
+	if err != nil || token == "" {
+		return false
+	}
+
+	t, err := app.DB.TokenForFingerprint(TokenFingerprint(token))
+	if err != nil || t.Kind != LoginTokenKind {
+		return false
+	}
+
+	return t.Expires.Sub(app.Clock.Now()) > app.loginExpires/2
+}
+
+// withLoginCookie returns a copy of r with the login cookie, named name,
+// replaced by value, so that handlers see a refreshed login.
+func withLoginCookie(r *http.Request, name, value string) *http.Request {
+	cookies := r.Cookies()
+
+	r = r.Clone(r.Context())
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+
+	return r
+}
+
+// RefreshSession is middleware that renews the login of a request with a
+// refresh cookie if the login token is missing, expired, or past half of
+// its lifetime. The refresh token is rotated, so a session slides as long
+// as it is used within Config.Auth.RefreshExpires. It does nothing if
+// refresh tokens are not enabled.
+func (app *AuthApp) RefreshSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.refreshExpires == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		refresh := app.refreshCookieToken(r)
+		if refresh == "" || app.loginFresh(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger := webhandler.RequestLoggerWithFuncName(r)
+
+		s, err := app.refreshSession(refresh)
+		if err != nil {
+			logger.Warn("failed to refresh session", "err", err)
+			app.clearRefreshCookie(w)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app.setSessionCookies(w, s)
+		logger.Debug("refreshed session")
+
+		next.ServeHTTP(w, withLoginCookie(r, app.loginCookieName(), app.cookies.encode(s.login.Value)))
+	})
+}
+
+// APIRefreshHandler spends the refresh token of a JSON body and responds
+// with a new login token and refresh token as JSON. The refresh token is
+// left out if the token was spent by a concurrent request, which has the
+// next one.
+func (app *AuthApp) APIRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	if app.refreshExpires == 0 {
+		logger.Warn("refresh tokens not enabled")
+		respondAPIError(w, logger, http.StatusNotFound, "")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		logger.Warn("invalid content type", "type", mediaType)
+		respondAPIError(w, logger, http.StatusUnsupportedMediaType, "")
+		return
+	}
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	err := json.NewDecoder(io.LimitReader(r.Body, maxAPIBodyLen)).Decode(&body)
+	if err != nil || body.RefreshToken == "" {
+		logger.Warn("invalid JSON", "err", err)
+		respondAPIError(w, logger, http.StatusBadRequest, "")
+		return
+	}
+
+	s, err := app.refreshSession(body.RefreshToken)
+	switch {
+	case errors.Is(err, ErrRefreshTokenNotFound),
+		errors.Is(err, ErrRefreshTokenExpired),
+		errors.Is(err, ErrRefreshTokenReused),
+		errors.Is(err, ErrUserDisabled):
+		logger.Warn("invalid refresh token", "err", err)
+		respondAPIError(w, logger, http.StatusUnauthorized, "")
+		return
+	case err != nil:
+		logger.Error("failed to refresh session", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return
+	}
+
+	respondAPILogin(w, logger, s)
+}
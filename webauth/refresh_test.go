@@ -0,0 +1,261 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withRefreshExpires returns a config modifier that enables refresh tokens.
+func withRefreshExpires(d string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.RefreshExpires = d
+	}
+}
+
+func TestMemStoreRefreshToken(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	store.SetClock(clock)
+
+	token, err := store.CreateRefreshToken("test", true, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() failed: %v", err)
+	}
+	if _, err := store.CreateRefreshToken("missing", true, clock.Now()); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("CreateRefreshToken() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+
+	rt, err := store.UseRefreshToken(token.Value)
+	if err != nil || rt.Username != "test" || !rt.Remember {
+		t.Errorf("UseRefreshToken() = %+v, %v, want test and remember", rt, err)
+	}
+
+	// A concurrent request can use the spent token for a short time.
+	rt, err = store.UseRefreshToken(token.Value)
+	if err != nil || rt.Username != "test" || !rt.Spent {
+		t.Errorf("UseRefreshToken() within grace = %+v, %v, want test spent", rt, err)
+	}
+
+	clock.Advance(webauth.RefreshReuseGrace)
+	rt, err = store.UseRefreshToken(token.Value)
+	if !errors.Is(err, webauth.ErrRefreshTokenReused) || rt.Username != "test" {
+		t.Errorf("UseRefreshToken() again = %+v, %v, want test and %v", rt, err, webauth.ErrRefreshTokenReused)
+	}
+
+	if _, err := store.UseRefreshToken("missing"); !errors.Is(err, webauth.ErrRefreshTokenNotFound) {
+		t.Errorf("UseRefreshToken() for missing token = %v, want %v", err, webauth.ErrRefreshTokenNotFound)
+	}
+
+	token, err = store.CreateRefreshToken("test", false, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() failed: %v", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if _, err := store.UseRefreshToken(token.Value); !errors.Is(err, webauth.ErrRefreshTokenExpired) {
+		t.Errorf("UseRefreshToken() after expires = %v, want %v", err, webauth.ErrRefreshTokenExpired)
+	}
+
+	login, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	other, err := store.CreateToken(webauth.LoginTokenKind, "admin", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if err := store.RevokeSessions("test"); err != nil {
+		t.Fatalf("RevokeSessions() failed: %v", err)
+	}
+	if _, err := store.UserForLoginToken(login.Value); !errors.Is(err, webauth.ErrUserLoginTokenNotFound) {
+		t.Errorf("UserForLoginToken() after revoke = %v, want %v", err, webauth.ErrUserLoginTokenNotFound)
+	}
+	if _, err := store.UserForLoginToken(other.Value); err != nil {
+		t.Errorf("UserForLoginToken() of other user = %v, want nil", err)
+	}
+}
+
+// sessionCookies returns the login and refresh cookies in cookies.
+func sessionCookies(cookies []*http.Cookie) (login, refresh *http.Cookie) {
+	for _, c := range cookies {
+		switch c.Name {
+		case webauth.LoginTokenCookieName:
+			login = c
+		case webauth.RefreshTokenCookieName:
+			refresh = c
+		}
+	}
+	return login, refresh
+}
+
+func TestRefreshSession(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	app := newAppForTest(t, []func(*webauth.Config){withRefreshExpires("720h")},
+		webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=test&password=password&remember=on"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	app.LoginPostHandler(w, r)
+
+	login, refresh := sessionCookies(w.Result().Cookies())
+	if login == nil || refresh == nil || refresh.Path != "/" || refresh.Expires.IsZero() {
+		t.Fatalf("cookies = %v, want login and persistent refresh cookies", w.Result().Cookies())
+	}
+
+	// request serves r with the cookies and returns the user seen by the
+	// handler and the response.
+	request := func(cookies ...*http.Cookie) (string, *httptest.ResponseRecorder) {
+		var username string
+		h := app.RefreshSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := app.UserFromRequest(w, r)
+			if err != nil {
+				t.Errorf("UserFromRequest() failed: %v", err)
+			}
+			username = user.Username
+		}))
+
+		// The cookies are set for the whole site from any path.
+		r := httptest.NewRequest(http.MethodGet, "/account/export", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return username, w
+	}
+
+	// A fresh login is not refreshed.
+	if got, w := request(login, refresh); got != "test" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("fresh login = %q, %v, want test without cookies", got, w.Result().Cookies())
+	}
+
+	// A login near expiry is refreshed, and the handler sees the new login.
+	clock.Advance(47 * time.Hour)
+	got, w := request(login, refresh)
+	newLogin, newRefresh := sessionCookies(w.Result().Cookies())
+	if got != "test" || newLogin == nil || newRefresh == nil || newRefresh.Value == refresh.Value {
+		t.Fatalf("near expiry = %q, %v, want test with new cookies", got, w.Result().Cookies())
+	}
+	if newLogin.Path != "/" || newRefresh.Path != "/" {
+		t.Errorf("cookie paths = %q and %q, want /", newLogin.Path, newRefresh.Path)
+	}
+
+	// A concurrent request with the spent refresh token, such as from
+	// another tab, gets a login too, and does not revoke the session. It
+	// does not get a refresh token, so the session has one successor.
+	got, w = request(login, refresh)
+	otherLogin, otherRefresh := sessionCookies(w.Result().Cookies())
+	if got != "test" || otherLogin == nil || otherRefresh != nil {
+		t.Errorf("concurrent refresh = %q, %v, want test with only a login cookie", got, w.Result().Cookies())
+	}
+
+	// The session slides past the expiry of the first login.
+	clock.Advance(2 * time.Hour)
+	if got, _ := request(login); got != "" {
+		t.Errorf("expired login without refresh = %q, want no user", got)
+	}
+	if got, _ := request(newLogin, newRefresh); got != "test" {
+		t.Errorf("new login = %q, want test", got)
+	}
+
+	// Reusing the spent refresh token revokes all sessions.
+	got, w = request(refresh)
+	if got != "" {
+		t.Errorf("reused refresh token = %q, want no user", got)
+	}
+	if _, c := sessionCookies(w.Result().Cookies()); c == nil || c.MaxAge >= 0 {
+		t.Errorf("cookies = %v, want refresh cookie removed", w.Result().Cookies())
+	}
+	if got, _ := request(newLogin, newRefresh); got != "" {
+		t.Errorf("session after reuse = %q, want no user", got)
+	}
+}
+
+func TestAPIRefreshHandler(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	app := newAppForTest(t, []func(*webauth.Config){withRefreshExpires("720h")},
+		webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	w := apiRequest(app.APILoginHandler, http.MethodPost, webauth.APILoginPath, "", "application/json", `{"username":"test","password":"password"}`)
+	var login struct {
+		Token          string
+		RefreshToken   string
+		RefreshExpires time.Time
+	}
+	decodeJSON(t, w, &login)
+	if login.RefreshToken == "" || login.RefreshExpires.IsZero() {
+		t.Fatalf("login = %q, want refresh token", w.Body)
+	}
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return apiRequest(app.APIRefreshHandler, http.MethodPost, webauth.APIRefreshPath, "", "application/json", `{"refreshToken":"`+token+`"}`)
+	}
+
+	w = refresh(login.RefreshToken)
+	var got struct {
+		Token        string
+		RefreshToken string
+	}
+	decodeJSON(t, w, &got)
+	if w.Code != http.StatusOK || got.Token == "" || got.RefreshToken == "" || got.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh = %d %q, want new tokens", w.Code, w.Body)
+	}
+	if _, err := app.DB.UserForLoginToken(got.Token); err != nil {
+		t.Errorf("refreshed login token not valid: %v", err)
+	}
+
+	w = refresh(login.RefreshToken)
+	var concurrent struct {
+		Token        string
+		RefreshToken string
+	}
+	decodeJSON(t, w, &concurrent)
+	if w.Code != http.StatusOK || concurrent.Token == "" || concurrent.RefreshToken != "" {
+		t.Errorf("concurrent refresh = %d %q, want a login token only", w.Code, w.Body)
+	}
+
+	clock.Advance(webauth.RefreshReuseGrace)
+	if w := refresh(login.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := refresh(got.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Refresh tokens are not issued or accepted unless enabled.
+	disabled := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+	w = apiRequest(disabled.APILoginHandler, http.MethodPost, webauth.APILoginPath, "", "application/json", `{"username":"test","password":"password"}`)
+	if strings.Contains(w.Body.String(), "refreshToken") {
+		t.Errorf("login without refresh = %q, want no refresh token", w.Body)
+	}
+	w = apiRequest(disabled.APIRefreshHandler, http.MethodPost, webauth.APIRefreshPath, "", "application/json", `{"refreshToken":"x"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("refresh when disabled status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestConfigRefreshExpires(t *testing.T) {
+	for _, d := range []string{"x", "1h"} {
+		cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		withRefreshExpires(d)(cfg)
+
+		_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+		if !errors.Is(err, webauth.ErrInvalidConfig) {
+			t.Errorf("NewApp() with RefreshExpires %q error = %v, want %v", d, err, webauth.ErrInvalidConfig)
+		}
+	}
+}
@@ -4,11 +4,12 @@
 package webauth
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/bnixon67/webapp/audit"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
@@ -24,28 +25,22 @@ const (
 // RegisterPageData contains data passed to the HTML template.
 type RegisterPageData struct {
 	CommonData
-	Message string
+	Message       string
+	BreachWarning bool // BreachWarning asks to confirm a breached password.
 }
 
 // RegisterHandler handles requests to register a user.
 func (app *AuthApp) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.registerGet, Post: app.registerPost}.ServeHTTP(w, r)
+}
+
+// registerGet serves the registration form.
+func (app *AuthApp) registerGet(w http.ResponseWriter, r *http.Request) {
 	// Get logger with request info and function name.
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
-	// Check if the HTTP method is valid.
-	if !webutil.CheckAllowedMethods(w, r, http.MethodGet, http.MethodPost) {
-		logger.Error("invalid method")
-		return
-	}
-
-	switch r.Method {
-	case http.MethodGet:
-		app.RenderPage(w, logger, "register.html", &RegisterPageData{})
-		logger.Info("done")
-
-	case http.MethodPost:
-		app.registerPost(w, r)
-	}
+	app.RenderPage(w, r, logger, "register.html", &RegisterPageData{})
+	logger.Info("done")
 }
 
 // registerPost handles POST of the registration form.
@@ -74,46 +69,83 @@ func (app *AuthApp) registerPost(w http.ResponseWriter, r *http.Request) {
 	// Check for missing values.
 	if IsEmpty(username, fullName, email, password1, password2) {
 		logger.Warn("missing values")
-		app.RenderPage(w, logger, "register.html",
+		app.RenderPage(w, r, logger, "register.html",
 			&RegisterPageData{Message: MsgMissingRequired})
 		return
 	}
 
+	// Check that registration is allowed from the location of the client.
+	if app.geoRestrict(logger, r, EventRegister, username, false) == GeoBlock {
+		app.RenderPage(w, r, logger, "register.html",
+			&RegisterPageData{Message: MsgGeoBlocked})
+		return
+	}
+
+	// Check that the risk of the registration is acceptable.
+	if app.assessRisk(logger, r, EventRegister, username, false) == RiskDeny {
+		app.RenderPage(w, r, logger, "register.html",
+			&RegisterPageData{Message: MsgRiskDenied})
+		return
+	}
+
 	// Check that password match.
 	if password1 != password2 {
 		logger.Warn("passwords do not match")
-		app.RenderPage(w, logger, "register.html",
+		app.RenderPage(w, r, logger, "register.html",
 			&RegisterPageData{Message: MsgPasswordsDifferent})
 		return
 	}
 
-	// Check that username doesn't already exist.
+	// Check that username doesn't already exist. If accounts are
+	// concealed, an existing username or email is handled after the
+	// checks that also apply to new accounts.
+	conceal := app.Cfg.Auth.ConcealAccounts
 	userExists, err := app.DB.UserExists(username)
 	if err != nil {
 		logger.Error("UserExists failed", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 	if userExists {
 		logger.Warn("user name already exists")
-		app.DB.WriteEvent(EventRegister, false, username, "user name already exists")
-		app.RenderPage(w, logger, "register.html",
-			&RegisterPageData{Message: MsgUsernameExists})
-		return
+		app.DB.RecordEvent(NewEvent(TypeRegisterUsernameExists, username, nil))
+		if !conceal {
+			app.RenderPage(w, r, logger, "register.html",
+				&RegisterPageData{Message: MsgUsernameExists})
+			return
+		}
 	}
 
 	// Check that email doesn't already exist.
 	emailExists, err := app.DB.EmailExists(email)
 	if err != nil {
 		logger.Error("EmailExists failed")
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 	if emailExists {
 		logger.Warn("email already exists")
-		app.DB.WriteEvent(EventRegister, false, username, "email already exists: "+email)
-		app.RenderPage(w, logger, "register.html",
-			&RegisterPageData{Message: MsgEmailExists})
+		app.DB.RecordEvent(NewEvent(TypeRegisterEmailExists, username, EventDetails{"email": email}))
+		if !conceal {
+			app.RenderPage(w, r, logger, "register.html",
+				&RegisterPageData{Message: MsgEmailExists})
+			return
+		}
+	}
+
+	// Check that password is not known from a data breach.
+	msg, warn := app.breachMessage(r.Context(), logger, password1, r.PostFormValue("breachAck") == "yes")
+	if msg != "" {
+		if !warn {
+			app.DB.RecordEvent(NewEvent(TypeRegisterBreached, username, nil))
+		}
+		app.RenderPage(w, r, logger, "register.html",
+			&RegisterPageData{Message: msg, BreachWarning: warn})
+		return
+	}
+
+	if userExists || emailExists {
+		app.registerExisting(w, r, logger, username, email, password1, emailExists)
 		return
 	}
 
@@ -121,17 +153,22 @@ func (app *AuthApp) registerPost(w http.ResponseWriter, r *http.Request) {
 	err = app.DB.RegisterUser(username, fullName, email, password1)
 	if err != nil {
 		logger.Error("RegisterUser failed", "err", err)
-		app.DB.WriteEvent(EventRegister, false, username, err.Error())
-		app.RenderPage(w, logger, "register.html",
+		app.DB.RecordEvent(ErrorEvent(TypeRegisterFailed, username, err))
+		app.RenderPage(w, r, logger, "register.html",
 			&RegisterPageData{Message: MsgRegisterFailed})
 		return
 	}
 
 	// Registration successful
 	logger.Info("registered user")
-	app.DB.WriteEvent(EventRegister, true, username, "registered user")
+	app.DB.RecordEvent(NewEvent(TypeRegisterUser, username, nil))
+	app.Audit(r, audit.Entry{Actor: username, Action: AuditRegister, Target: username, Result: audit.Success})
+	if app.Cfg.Waitlist.Enabled {
+		logger.Info("waitlisted user")
+		app.DB.RecordEvent(NewEvent(TypeWaitlistAdded, username, nil))
+	}
 
-	err = app.sendRegistrationEmail(username, fullName, email)
+	err = app.sendRegistrationEmail(r.Context(), username, fullName, email)
 	if err != nil {
 		logger.Error("unable to send registration email", "err", err)
 	}
@@ -146,47 +183,43 @@ Thank you for registering for {{.Title}}. Your username is {{.Username}}.
 
 Please visit {{.BaseURL}}/confirm?ctoken={{.Token.Value}} by {{.Token.Expires.Format "January 2, 2006 3:04 PM MST"}} to confirm your account.
 
-You can ignore this message if you did not register for an account.
+{{if .Waitlisted}}Your account is waiting for approval. You will get another email once it is approved.
+
+{{end}}You can ignore this message if you did not register for an account.
 `
 
 type registrationData struct {
-	FullName string
-	Username string
-	Title    string
-	BaseURL  string
-	Token    Token
+	FullName   string
+	Username   string
+	Title      string
+	BaseURL    string
+	Token      Token
+	Waitlisted bool
 }
 
-func (app *AuthApp) sendRegistrationEmail(username, fullName, email string) error {
+func (app *AuthApp) sendRegistrationEmail(ctx context.Context, username, fullName, email string) error {
 	// Create and save a confirm email token.
-	token, err := app.DB.CreateConfirmEmailToken(username)
+	token, err := app.CreateConfirmEmailToken(username)
 	if err != nil {
 		slog.Error("failed to create confirm email token",
 			"err", err, "username", username)
 		return err
 	}
 
-	subj := fmt.Sprintf("%s registration", app.Cfg.App.Name)
+	subj := app.Printer(ctx).T("%s registration", app.Cfg.App.Name)
 
 	data := registrationData{
-		FullName: fullName,
-		Username: username,
-		Title:    app.Cfg.App.Name,
-		BaseURL:  app.Cfg.Auth.BaseURL,
-		Token:    token,
-	}
-	body, err := emailBody("register", registrationEmailTmpl, data)
-	if err != nil {
-		return err
+		FullName:   fullName,
+		Username:   username,
+		Title:      app.Cfg.App.Name,
+		BaseURL:    app.Cfg.Auth.BaseURL,
+		Token:      token,
+		Waitlisted: app.Cfg.Waitlist.Enabled,
 	}
-
-	err = app.Cfg.SMTP.SendMessage(app.Cfg.EmailFrom, []string{email}, subj, body)
+	body, err := app.emailBody(ctx, "register", registrationEmailTmpl, data)
 	if err != nil {
 		return err
 	}
 
-	slog.Info("sent email", slog.Group("email",
-		slog.String("to", email), slog.String("subject", subj)))
-
-	return nil
+	return app.sendEmail(ctx, email, subj, body, nil)
 }
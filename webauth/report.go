@@ -0,0 +1,298 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ReportPeriod is the length of the periods summarized by a Report.
+type ReportPeriod string
+
+const (
+	ReportWeek  ReportPeriod = "week"  // Weeks start on Monday, in UTC.
+	ReportMonth ReportPeriod = "month" // Months start on the first, in UTC.
+)
+
+// ReportPeriods are the periods of the reports.
+var ReportPeriods = []ReportPeriod{ReportWeek, ReportMonth}
+
+var (
+	ErrReportNotFound      = errors.New("report not found")
+	ErrReportPeriodUnknown = errors.New("unknown report period")
+)
+
+// Report summarizes the account activity of a period. The counts are of
+// the successful events in [Start, End).
+type Report struct {
+	Period        ReportPeriod
+	Start         time.Time
+	End           time.Time
+	Registrations int
+	Confirmations int
+	Logins        int
+	Resets        int
+	Complete      bool // Complete is true once the period has ended.
+}
+
+// ParseReportPeriod returns the ReportPeriod named s, or ReportWeek if s
+// is empty.
+func ParseReportPeriod(s string) (ReportPeriod, error) {
+	switch ReportPeriod(s) {
+	case "", ReportWeek:
+		return ReportWeek, nil
+	case ReportMonth:
+		return ReportMonth, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrReportPeriodUnknown, s)
+}
+
+// Bounds returns the start and end of the period p that includes t.
+func (p ReportPeriod) Bounds(t time.Time) (start, end time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	if p == ReportMonth {
+		start = day.AddDate(0, 0, 1-day.Day())
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	// Weekday is 0 for Sunday, so weeks that start on Monday are offset.
+	start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	return start, start.AddDate(0, 0, 7)
+}
+
+// EventCounts returns the number of successful events of each name created
+// in [since, until).
+func (db *AuthDB) EventCounts(since, until time.Time) (map[EventName]int, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT name, COUNT(*) FROM events WHERE succeeded = true AND created >= ? AND created < ? GROUP BY name`
+	rows, err := db.Query(qry, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[EventName]int)
+	for rows.Next() {
+		var name EventName
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return nil, err
+		}
+		counts[name] = n
+	}
+
+	return counts, rows.Err()
+}
+
+// SaveReport saves r, replacing the report of the same period and start.
+func (db *AuthDB) SaveReport(r Report) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := db.Dialect.bindArgs([]any{r.Period, r.Start, r.End, r.Registrations, r.Confirmations, r.Logins, r.Resets, r.Complete})
+
+	_, err = tx.Exec(db.Rebind("DELETE FROM reports WHERE period = ? AND period_start = ?"), args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(db.Rebind("INSERT INTO reports(period, period_start, period_end, registrations, confirmations, logins, resets, complete) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"), args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// reportColumns are the columns of a Report, in the order of scanReport.
+const reportColumns = `period, period_start, period_end, registrations, confirmations, logins, resets, complete`
+
+// scanReport scans a row of reportColumns.
+func scanReport(row interface{ Scan(...any) error }) (Report, error) {
+	var r Report
+	err := row.Scan(&r.Period, &r.Start, &r.End, &r.Registrations, &r.Confirmations, &r.Logins, &r.Resets, &r.Complete)
+	return r, err
+}
+
+// Report returns the report of period that starts at start, or
+// ErrReportNotFound.
+func (db *AuthDB) Report(period ReportPeriod, start time.Time) (Report, error) {
+	if db == nil {
+		return Report{}, ErrInvalidDB
+	}
+
+	qry := `SELECT ` + reportColumns + ` FROM reports WHERE period = ? AND period_start = ?`
+	r, err := scanReport(db.QueryRow(qry, period, start))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+
+	return r, err
+}
+
+// Reports returns the reports of period, the newest first.
+func (db *AuthDB) Reports(period ReportPeriod) ([]Report, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT ` + reportColumns + ` FROM reports WHERE period = ? ORDER BY period_start DESC`
+	rows, err := db.Query(qry, period)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+
+	return reports, rows.Err()
+}
+
+// BuildReport returns the report of the period that includes t, counted
+// from the events.
+func (app *AuthApp) BuildReport(period ReportPeriod, t time.Time) (Report, error) {
+	start, end := period.Bounds(t)
+
+	counts, err := app.DB.EventCounts(start, end)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Report{
+		Period:        period,
+		Start:         start,
+		End:           end,
+		Registrations: counts[EventRegister],
+		Confirmations: counts[EventConfirmed],
+		Logins:        counts[EventLogin],
+		Resets:        counts[EventResetPass],
+		Complete:      !app.Clock.Now().Before(end),
+	}, nil
+}
+
+// RefreshReports saves the reports of the current period and of the
+// previous period of each ReportPeriod. Once the previous period is
+// complete, its report is saved a last time and emailed to the users with
+// PermViewReports, who can unsubscribe from the EmailDigest category.
+func (app *AuthApp) RefreshReports(ctx context.Context) error {
+	now := app.Clock.Now()
+
+	for _, period := range ReportPeriods {
+		start, _ := period.Bounds(now)
+		prevStart, _ := period.Bounds(start.Add(-time.Nanosecond))
+
+		// A complete report does not change, so it is saved once.
+		prev, err := app.DB.Report(period, prevStart)
+		if err != nil && !errors.Is(err, ErrReportNotFound) {
+			return err
+		}
+		if !prev.Complete {
+			prev, err = app.BuildReport(period, prevStart)
+			if err != nil {
+				return err
+			}
+			if err := app.DB.SaveReport(prev); err != nil {
+				return err
+			}
+			if err := app.EmailReport(ctx, prev); err != nil {
+				return err
+			}
+		}
+
+		current, err := app.BuildReport(period, now)
+		if err != nil {
+			return err
+		}
+		if err := app.DB.SaveReport(current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Template for the email with a report.
+const emailReportTemplate = `
+{{.Title}} account activity for the {{.Period}} of {{.Start.Format "January 2, 2006"}}:
+
+{{.Counts}}
+View the reports at {{.BaseURL}}/reports?period={{.Period}}.
+`
+
+// EmailReport emails r to the users with PermViewReports, unless they
+// unsubscribed from the EmailDigest category.
+func (app *AuthApp) EmailReport(ctx context.Context, r Report) error {
+	users, err := app.DB.GetUsers()
+	if err != nil {
+		return err
+	}
+
+	var counts strings.Builder
+	tw := tabwriter.NewWriter(&counts, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Registrations\t%d\t\n", r.Registrations)
+	fmt.Fprintf(tw, "Confirmations\t%d\t\n", r.Confirmations)
+	fmt.Fprintf(tw, "Logins\t%d\t\n", r.Logins)
+	fmt.Fprintf(tw, "Password resets\t%d\t\n", r.Resets)
+	tw.Flush()
+
+	body, err := app.emailBody(ctx, "report", emailReportTemplate, struct {
+		Title, BaseURL, Counts string
+		Period                 ReportPeriod
+		Start                  time.Time
+	}{app.Cfg.App.Name, app.Cfg.Auth.BaseURL, counts.String(), r.Period, r.Start})
+	if err != nil {
+		return err
+	}
+
+	subj := app.Printer(ctx).T("%s %sly report", app.Cfg.App.Name, r.Period)
+
+	for _, user := range users {
+		if user.Disabled {
+			continue
+		}
+
+		roles, err := app.DB.UserRoles(user.Username)
+		if err != nil {
+			return err
+		}
+		user.setRoles(roles)
+		if !user.Can(PermViewReports) {
+			continue
+		}
+
+		err = app.SendUserEmail(ctx, EmailDigest, user, subj, body)
+		if err != nil && !errors.Is(err, ErrEmailSuppressed) {
+			slog.Error("failed to email report", "username", user.Username, "err", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const ReportsTmpl = "reports.html"
+
+// ReportsPageData contains data passed to the HTML template.
+type ReportsPageData struct {
+	CommonData
+	User    User
+	Period  ReportPeriod
+	Periods []ReportPeriod
+	Reports []Report
+}
+
+// userReports returns the reports of the period in r for a user with
+// PermViewReports, or responds with an error and returns false.
+func (app *AuthApp) userReports(w http.ResponseWriter, r *http.Request) (User, ReportPeriod, []Report, bool) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return User{}, "", nil, false
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return User{}, "", nil, false
+	}
+	if !user.Can(PermViewReports) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return User{}, "", nil, false
+	}
+
+	period, err := ParseReportPeriod(r.URL.Query().Get("period"))
+	if errors.Is(err, ErrReportPeriodUnknown) {
+		logger.Warn("invalid period", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return User{}, "", nil, false
+	}
+
+	reports, err := app.DB.Reports(period)
+	if err != nil {
+		logger.Error("failed to get reports", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return User{}, "", nil, false
+	}
+
+	return user, period, reports, true
+}
+
+// ReportsHandler shows a user with PermViewReports the weekly or monthly
+// account activity reports, by the period query parameter.
+func (app *AuthApp) ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, period, reports, ok := app.userReports(w, r)
+	if !ok {
+		return
+	}
+
+	app.RenderPage(w, r, logger, ReportsTmpl,
+		&ReportsPageData{
+			CommonData: CommonData{Title: app.Cfg.App.Name},
+			User:       user,
+			Period:     period,
+			Periods:    ReportPeriods,
+			Reports:    reports,
+		})
+
+	logger.Info("done")
+}
+
+// ReportsCSVHandler responds with the reports of ReportsHandler in the
+// format of webutil.Export, CSV by default.
+func (app *AuthApp) ReportsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	_, period, reports, ok := app.userReports(w, r)
+	if !ok {
+		return
+	}
+
+	err := webutil.Export(w, r, "reports-"+string(period), reports)
+	if err != nil {
+		logger.Error("failed to export reports", "err", err)
+		return
+	}
+
+	logger.Info("done")
+}
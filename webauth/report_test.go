@@ -0,0 +1,133 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestReportPeriodBounds(t *testing.T) {
+	// Wednesday, March 13, 2024.
+	tm := time.Date(2024, time.March, 13, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		period     webauth.ReportPeriod
+		t          time.Time
+		start, end time.Time
+	}{
+		{webauth.ReportWeek, tm, time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC)},
+		{webauth.ReportWeek, time.Date(2024, time.March, 17, 23, 0, 0, 0, time.UTC), time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC)},
+		{webauth.ReportWeek, time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC), time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)},
+		{webauth.ReportMonth, tm, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{webauth.ReportMonth, time.Date(2024, time.December, 31, 23, 0, 0, 0, time.UTC), time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		start, end := tc.period.Bounds(tc.t)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s Bounds(%v) = %v, %v, want %v, %v", tc.period, tc.t, start, end, tc.start, tc.end)
+		}
+	}
+}
+
+func TestRefreshReports(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, time.March, 13, 12, 0, 0, 0, time.UTC))
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	lastWeek := time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)
+	for _, e := range []webauth.Event{
+		{Name: webauth.EventRegister, Succeeded: true, Created: lastWeek},
+		{Name: webauth.EventLogin, Succeeded: true, Created: lastWeek},
+		{Name: webauth.EventLogin, Succeeded: false, Created: lastWeek},
+		{Name: webauth.EventLogin, Succeeded: true, Created: clock.Now()},
+		{Name: webauth.EventResetPass, Succeeded: true, Created: clock.Now()},
+	} {
+		store.AddEvent(e)
+	}
+
+	if err := app.RefreshReports(context.Background()); err != nil {
+		t.Fatalf("RefreshReports() failed: %v", err)
+	}
+
+	weeks, err := store.Reports(webauth.ReportWeek)
+	if err != nil || len(weeks) != 2 {
+		t.Fatalf("Reports(week) = %+v, %v, want 2 reports", weeks, err)
+	}
+	if got := weeks[0]; got.Complete || got.Logins != 1 || got.Resets != 1 {
+		t.Errorf("current week = %+v, want 1 login and 1 reset in progress", got)
+	}
+	if got := weeks[1]; !got.Complete || got.Registrations != 1 || got.Logins != 1 {
+		t.Errorf("last week = %+v, want 1 registration and 1 login complete", got)
+	}
+
+	months, err := store.Reports(webauth.ReportMonth)
+	if err != nil || len(months) != 2 {
+		t.Fatalf("Reports(month) = %+v, %v, want 2 reports", months, err)
+	}
+	if got := months[0]; got.Logins != 2 || got.Registrations != 1 {
+		t.Errorf("current month = %+v, want 2 logins and 1 registration", got)
+	}
+
+	// The current week is complete once the next week starts.
+	clock.Advance(7 * 24 * time.Hour)
+	if err := app.RefreshReports(context.Background()); err != nil {
+		t.Fatalf("RefreshReports() failed: %v", err)
+	}
+	weeks, _ = store.Reports(webauth.ReportWeek)
+	if len(weeks) != 3 || !weeks[1].Complete {
+		t.Errorf("Reports(week) = %+v, want 3 reports with the previous complete", weeks)
+	}
+}
+
+func TestReportsHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	if err := app.RefreshReports(context.Background()); err != nil {
+		t.Fatalf("RefreshReports() failed: %v", err)
+	}
+
+	admin, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	user, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		token   string
+		target  string
+		status  int
+		want    string
+	}{
+		{"notAuthorized", app.ReportsHandler, user.Value, "/reports", http.StatusUnauthorized, ""},
+		{"week", app.ReportsHandler, admin.Value, "/reports", http.StatusOK, "(in progress)"},
+		{"month", app.ReportsHandler, admin.Value, "/reports?period=month", http.StatusOK, `href="/reportscsv?period=month"`},
+		{"unknownPeriod", app.ReportsHandler, admin.Value, "/reports?period=day", http.StatusBadRequest, ""},
+		{"csv", app.ReportsCSVHandler, admin.Value, "/reportscsv?period=week", http.StatusOK, "Period,Start,End,Registrations"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(tc.handler, tc.token, http.MethodGet, tc.target, "")
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d", w.Code, tc.status)
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("got %q, expected %q in body", w.Body, tc.want)
+			}
+		})
+	}
+}
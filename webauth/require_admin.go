@@ -0,0 +1,15 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"net/http"
+)
+
+// RequireAdmin returns a handler that calls next only if the request is
+// from a logged in admin user. Otherwise, it responds with
+// http.StatusUnauthorized.
+func (app *AuthApp) RequireAdmin(next http.Handler) http.Handler {
+	return app.RequireRole(next, RoleAdmin)
+}
@@ -4,48 +4,54 @@
 package webauth
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/i18n"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // ResetPageData contains data passed to the HTML template.
 type ResetPageData struct {
-	Title      string
-	Message    string
-	ResetToken string
+	Title         string
+	Message       string
+	ResetToken    string
+	CSRFToken     string
+	FormNonce     string        // FormNonce prevents replay of the form.
+	BreachWarning bool          // BreachWarning asks to confirm a breached password.
+	Printer       *i18n.Printer // Printer translates the page.
 }
 
 // ResetHandler handles /reset requests.
 func (app *AuthApp) ResetHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{
+		Get:  app.resetGet,
+		Post: func(w http.ResponseWriter, r *http.Request) { app.resetPost(w, r, "reset.html") },
+	}.ServeHTTP(w, r)
+}
+
+// resetGet serves the form to reset a password with the token in the
+// rtoken query value.
+func (app *AuthApp) resetGet(w http.ResponseWriter, r *http.Request) {
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
-	// Check if the HTTP method is valid.
-	if !webutil.CheckAllowedMethods(w, r, http.MethodGet, http.MethodPost) {
-		logger.Error("invalid method")
+	err := webutil.RenderTemplateOrError(app.Tmpl, w, "reset.html",
+		ResetPageData{
+			Title:      app.Cfg.App.Name,
+			CSRFToken:  webhandler.CSRFToken(r.Context()),
+			Printer:    app.Printer(r.Context()),
+			ResetToken: r.URL.Query().Get("rtoken"),
+			FormNonce:  app.newFormNonce(logger, FormReset),
+		})
+	if err != nil {
+		logger.Error("unable to RenderTemplate", "err", err)
 		return
 	}
-
-	switch r.Method {
-	case http.MethodGet:
-		err := webutil.RenderTemplateOrError(app.Tmpl, w, "reset.html",
-			ResetPageData{
-				Title:      app.Cfg.App.Name,
-				ResetToken: r.URL.Query().Get("rtoken"),
-			})
-		if err != nil {
-			logger.Error("unable to RenderTemplate", "err", err)
-			return
-		}
-		logger.Info("ResetHandler")
-
-	case http.MethodPost:
-		app.resetPost(w, r, "reset.html")
-	}
+	logger.Info("ResetHandler")
 }
 
 // resetPost is called for the POST method of the RegisterHandler.
@@ -56,6 +62,7 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 	resetToken := strings.TrimSpace(r.PostFormValue("rtoken"))
 	password1 := strings.TrimSpace(r.PostFormValue("password1"))
 	password2 := strings.TrimSpace(r.PostFormValue("password2"))
+	nonce := r.PostFormValue(FormNonceFieldName)
 
 	// check for missing values
 	// redundant given client side required fields, but good practice
@@ -71,8 +78,11 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
 			ResetPageData{
 				Title:      app.Cfg.App.Name,
+				CSRFToken:  webhandler.CSRFToken(r.Context()),
+				Printer:    app.Printer(r.Context()),
 				Message:    msg,
 				ResetToken: r.URL.Query().Get("rtoken"),
+				FormNonce:  nonce,
 			})
 		if err != nil {
 			logger.Error("unable to RenderTemplate", "err", err)
@@ -89,8 +99,11 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
 			ResetPageData{
 				Title:      app.Cfg.App.Name,
+				CSRFToken:  webhandler.CSRFToken(r.Context()),
+				Printer:    app.Printer(r.Context()),
 				Message:    msg,
 				ResetToken: r.URL.Query().Get("rtoken"),
+				FormNonce:  nonce,
 			})
 		if err != nil {
 			logger.Error("unable to RenderTemplate", "err", err)
@@ -111,8 +124,11 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
 			ResetPageData{
 				Title:      app.Cfg.App.Name,
+				CSRFToken:  webhandler.CSRFToken(r.Context()),
+				Printer:    app.Printer(r.Context()),
 				Message:    msg,
 				ResetToken: r.URL.Query().Get("rtoken"),
+				FormNonce:  nonce,
 			})
 		if err != nil {
 			logger.Error("failed to RenderTemplate", "err", err)
@@ -121,14 +137,58 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 		return
 	}
 
+	// check that password is not known from a data breach
+	msg, warn := app.breachMessage(r.Context(), logger, password1, r.PostFormValue("breachAck") == "yes")
+	if msg != "" {
+		if !warn {
+			app.DB.RecordEvent(NewEvent(TypeResetBreached, username, nil))
+		}
+		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
+			ResetPageData{
+				Title:         app.Cfg.App.Name,
+				CSRFToken:     webhandler.CSRFToken(r.Context()),
+				Printer:       app.Printer(r.Context()),
+				Message:       msg,
+				ResetToken:    resetToken,
+				FormNonce:     nonce,
+				BreachWarning: warn,
+			})
+		if err != nil {
+			logger.Error("unable to RenderTemplate", "err", err)
+			return
+		}
+		return
+	}
+
+	// use the form nonce, so the request cannot be replayed
+	err = app.DB.UseFormNonce(FormReset, nonce)
+	if err != nil {
+		logger.Warn("invalid form nonce", "username", username, "err", err)
+		app.DB.RecordEvent(NewEvent(TypeResetNonce, username, nil))
+		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
+			ResetPageData{
+				Title:      app.Cfg.App.Name,
+				CSRFToken:  webhandler.CSRFToken(r.Context()),
+				Printer:    app.Printer(r.Context()),
+				Message:    MsgFormNonceInvalid,
+				ResetToken: resetToken,
+				FormNonce:  app.newFormNonce(logger, FormReset),
+			})
+		if err != nil {
+			logger.Error("unable to RenderTemplate", "err", err)
+			return
+		}
+		return
+	}
+
 	// hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password1), bcrypt.DefaultCost)
+	hashedPassword, err := app.Hasher.Hash(password1)
 	if err != nil {
 		msg := "Cannot hash password"
-		logger.Error("failed bcrypt.GenerateFromPassword",
+		logger.Error("failed to hash password",
 			"username", username, "err", err)
 		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
-			ResetPageData{Title: app.Cfg.App.Name, Message: msg})
+			ResetPageData{Title: app.Cfg.App.Name, Message: msg, CSRFToken: webhandler.CSRFToken(r.Context()), Printer: app.Printer(r.Context())})
 		if err != nil {
 			logger.Error("unable to RenderTemplate", "err", err)
 			return
@@ -136,19 +196,33 @@ func (app *AuthApp) resetPost(w http.ResponseWriter, r *http.Request, tmplFileNa
 		return
 	}
 
-	// store the user and hashed password
-	_, err = app.DB.Exec("UPDATE users SET hashedPassword = ? WHERE username = ?", string(hashedPassword), username)
+	// Replace the password and use the reset token, so it cannot be reused.
+	err = app.DB.ResetPassword(username, resetToken, hashedPassword)
+	if errors.Is(err, ErrTokenNotFound) {
+		logger.Warn("reset token already used", "username", username)
+		app.DB.RecordEvent(NewEvent(TypeResetUsed, username, nil))
+		err := webutil.RenderTemplateOrError(app.Tmpl, w, tmplFileName,
+			ResetPageData{
+				Title:     app.Cfg.App.Name,
+				CSRFToken: webhandler.CSRFToken(r.Context()),
+				Printer:   app.Printer(r.Context()),
+				Message:   "Please provide a valid Reset Token",
+			})
+		if err != nil {
+			logger.Error("unable to RenderTemplate", "err", err)
+		}
+		return
+	}
 	if err != nil {
 		logger.Error("update password failed",
 			"username", username, "err", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	// TODO: don't allow reuse of the reset token if successful
-
 	// register successful
 	logger.Info("successful password reset", "username", username)
-	app.DB.WriteEvent(EventResetPass, true, username, "success")
+	app.DB.RecordEvent(NewEvent(TypeResetPass, username, nil))
+	app.Audit(r, audit.Entry{Actor: username, Action: AuditResetPassword, Target: username, Result: audit.Success})
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
@@ -4,6 +4,7 @@
 package webauth_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -90,3 +91,45 @@ func TestResetHandlerPostMismatchedPassword(t *testing.T) {
 		t.Errorf("got body %q, expected %q in body", w.Body, expectedInBody)
 	}
 }
+
+func TestResetPasswordSingleUse(t *testing.T) {
+	store := StoreForTest(t)
+
+	token, err := store.CreateToken("reset", "test", webauth.ResetTokenSize, webauth.ResetTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	other, err := store.CreateToken("reset", "test", webauth.ResetTokenSize, webauth.ResetTokenExpires)
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	hashed, err := webauth.BcryptHasher{Cost: 4}.Hash("new password")
+	if err != nil {
+		t.Fatalf("Hash() failed: %v", err)
+	}
+
+	// A reset token of another user is rejected.
+	err = store.ResetPassword("admin", token.Value, hashed)
+	if !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("ResetPassword() for another user = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+
+	if err := store.ResetPassword("test", token.Value, hashed); err != nil {
+		t.Fatalf("ResetPassword() failed: %v", err)
+	}
+	if err := store.CheckPassword("test", "new password"); err != nil {
+		t.Errorf("password not changed: %v", err)
+	}
+
+	// The used token and the other outstanding token are removed.
+	for _, value := range []string{token.Value, other.Value} {
+		err = store.ResetPassword("test", value, "replayed")
+		if !errors.Is(err, webauth.ErrTokenNotFound) {
+			t.Errorf("ResetPassword() reuse = %v, want %v", err, webauth.ErrTokenNotFound)
+		}
+	}
+	if err := store.CheckPassword("test", "new password"); err != nil {
+		t.Errorf("password changed by reused token: %v", err)
+	}
+}
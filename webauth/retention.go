@@ -0,0 +1,196 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionCategory is a category of data removed once it is older than
+// its retention period.
+type RetentionCategory string
+
+const (
+	RetainEvents    RetentionCategory = "events"    // Events, such as logins.
+	RetainEmails    RetentionCategory = "emails"    // Soft email bounces.
+	RetainAnalytics RetentionCategory = "analytics" // Anonymous CSP reports.
+	RetainAudit     RetentionCategory = "audit"     // The audit log.
+)
+
+// RetentionCategories are the categories of data with a retention period.
+var RetentionCategories = []RetentionCategory{RetainEvents, RetainEmails, RetainAnalytics, RetainAudit}
+
+// Default retention periods used if not provided in the config.
+const (
+	DefaultRetainEvents    = "180d"
+	DefaultRetainEmails    = "30d"
+	DefaultRetainAnalytics = "90d"
+	DefaultRetainAudit     = "365d"
+)
+
+// ConfigRetention holds the retention periods of each category of data.
+// A period is a duration string or a number of days, such as "180d". A
+// period of "0" keeps the data forever.
+type ConfigRetention struct {
+	Events    string // Events, such as logins.
+	Emails    string // Soft email bounces. Others are kept forever.
+	Analytics string // Anonymous CSP reports.
+	Audit     string // The audit log.
+	DryRun    bool   // Only report what would be purged.
+}
+
+// parseRetention parses a retention period, which is a duration string or
+// a number of days with a "d" suffix.
+func parseRetention(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// periods returns the validated retention periods of c by category,
+// using defaults for missing values.
+func (c ConfigRetention) periods() (map[RetentionCategory]time.Duration, error) {
+	periods := make(map[RetentionCategory]time.Duration)
+
+	for category, s := range map[RetentionCategory]string{
+		RetainEvents:    cmp.Or(c.Events, DefaultRetainEvents),
+		RetainEmails:    cmp.Or(c.Emails, DefaultRetainEmails),
+		RetainAnalytics: cmp.Or(c.Analytics, DefaultRetainAnalytics),
+		RetainAudit:     cmp.Or(c.Audit, DefaultRetainAudit),
+	} {
+		d, err := parseRetention(s)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("negative Retention.%s %q", category, s)
+		}
+		periods[category] = d
+	}
+
+	return periods, nil
+}
+
+// RetentionResult is the data of a category older than its retention
+// period, which was purged unless DryRun.
+type RetentionResult struct {
+	Category RetentionCategory
+	Cutoff   time.Time // Cutoff is the time before which data is purged.
+	Rows     int       // Rows is the number of rows purged or to purge.
+	DryRun   bool
+}
+
+// retentionTable is the table and time column of a category, and a
+// condition that must also be true for rows to expire.
+type retentionTable struct {
+	table, column string
+	where         string
+	args          []any
+}
+
+// retentionTables are the tables of each category. Hard bounces and
+// complaints are kept to suppress email to the address.
+var retentionTables = map[RetentionCategory]retentionTable{
+	RetainEvents: {table: "events", column: "created"},
+	RetainEmails: {
+		table: "email_bounces", column: "created",
+		where: " AND kind NOT IN (?, ?)", args: []any{BounceHard, BounceComplaint},
+	},
+	RetainAnalytics: {table: "csp_reports", column: "last_seen"},
+	RetainAudit:     {table: "audit_log", column: "created"},
+}
+
+// query returns the statement starting with verb, such as "DELETE", and
+// its args for the rows of t older than cutoff.
+func (t retentionTable) query(verb string, cutoff time.Time) (string, []any) {
+	qry := verb + " FROM " + t.table + " WHERE " + t.column + " < ?" + t.where
+	return qry, append([]any{cutoff}, t.args...)
+}
+
+// CountExpired returns the number of rows of category older than cutoff.
+func (db *AuthDB) CountExpired(category RetentionCategory, cutoff time.Time) (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	t, ok := retentionTables[category]
+	if !ok {
+		return 0, fmt.Errorf("unknown retention category %q", category)
+	}
+
+	var n int
+	qry, args := t.query("SELECT COUNT(*)", cutoff)
+	err := db.QueryRow(qry, args...).Scan(&n)
+
+	return n, err
+}
+
+// PurgeExpired deletes the rows of category older than cutoff and returns
+// the number deleted.
+func (db *AuthDB) PurgeExpired(category RetentionCategory, cutoff time.Time) (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	t, ok := retentionTables[category]
+	if !ok {
+		return 0, fmt.Errorf("unknown retention category %q", category)
+	}
+
+	qry, args := t.query("DELETE", cutoff)
+	result, err := db.Exec(qry, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+// EnforceRetention purges the data of each category older than its
+// Config.Retention period and returns what was purged. If dryRun or
+// Config.Retention.DryRun is true, the data is only counted.
+func (app *AuthApp) EnforceRetention(dryRun bool) ([]RetentionResult, error) {
+	dryRun = dryRun || app.Cfg.Retention.DryRun
+	now := app.Clock.Now()
+
+	var results []RetentionResult
+	for _, category := range RetentionCategories {
+		period := app.retention[category]
+		if period == 0 {
+			continue
+		}
+
+		r := RetentionResult{Category: category, Cutoff: now.Add(-period), DryRun: dryRun}
+
+		var err error
+		if dryRun {
+			r.Rows, err = app.DB.CountExpired(category, r.Cutoff)
+		} else {
+			r.Rows, err = app.DB.PurgeExpired(category, r.Cutoff)
+		}
+		if err != nil {
+			return results, fmt.Errorf("retention of %s: %w", category, err)
+		}
+
+		slog.Info("enforced retention",
+			"category", category, "cutoff", r.Cutoff, "rows", r.Rows, "dryRun", dryRun)
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
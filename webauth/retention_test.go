@@ -0,0 +1,130 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestConfigRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention webauth.ConfigRetention
+		wantErr   error
+	}{
+		{name: "defaults"},
+		{name: "days", retention: webauth.ConfigRetention{Events: "365d", Emails: "0", Analytics: "720h"}},
+		{name: "invalidDays", retention: webauth.ConfigRetention{Events: "xd"}, wantErr: webauth.ErrInvalidConfig},
+		{name: "invalidDuration", retention: webauth.ConfigRetention{Emails: "x"}, wantErr: webauth.ErrInvalidConfig},
+		{name: "negative", retention: webauth.ConfigRetention{Analytics: "-1d"}, wantErr: webauth.ErrInvalidConfig},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			cfg.Retention = tc.retention
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	start := time.Now()
+	clock := webauth.NewFakeClock(start)
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){
+		func(cfg *webauth.Config) {
+			cfg.Retention = webauth.ConfigRetention{Events: "10d", Emails: "5d", Analytics: "0", Audit: "0"}
+		},
+	}, webauth.WithDB(store), webauth.WithClock(clock))
+
+	// The test data has events older than the retention period.
+	oldEvents, err := store.CountExpired(webauth.RetainEvents, start.Add(-10*24*time.Hour))
+	if err != nil {
+		t.Fatalf("CountExpired() failed: %v", err)
+	}
+	oldEvents++
+
+	store.AddEvent(webauth.Event{Name: webauth.EventLogin, Created: start.Add(-11 * 24 * time.Hour)})
+	store.AddEvent(webauth.Event{Name: webauth.EventLogin, Created: start.Add(-9 * 24 * time.Hour)})
+	store.RecordCSPViolation("script-src", "https://evil.example", start.Add(-365*24*time.Hour))
+
+	clock.Set(start.Add(-6 * 24 * time.Hour))
+	store.RecordBounce(webauth.Bounce{Email: "old@email", Kind: webauth.BounceSoft})
+	store.RecordBounce(webauth.Bounce{Email: "hard@email", Kind: webauth.BounceHard})
+	store.RecordBounce(webauth.Bounce{Email: "complaint@email", Kind: webauth.BounceComplaint})
+	clock.Set(start)
+	store.RecordBounce(webauth.Bounce{Email: "new@email", Kind: webauth.BounceHard})
+
+	events, _ := store.GetEvents()
+	wantEvents := len(events) - oldEvents
+
+	dryRun, err := app.EnforceRetention(true)
+	if err != nil {
+		t.Fatalf("EnforceRetention(true) failed: %v", err)
+	}
+	if len(dryRun) != 2 || dryRun[0].Category != webauth.RetainEvents || dryRun[0].Rows != oldEvents ||
+		dryRun[1].Category != webauth.RetainEmails || dryRun[1].Rows != 1 || !dryRun[0].DryRun {
+		t.Errorf("EnforceRetention(true) = %+v, want %d events and 1 email to purge", dryRun, oldEvents)
+	}
+	if events, _ := store.GetEvents(); len(events) != wantEvents+oldEvents {
+		t.Errorf("dry run removed events")
+	}
+
+	purged, err := app.EnforceRetention(false)
+	if err != nil {
+		t.Fatalf("EnforceRetention(false) failed: %v", err)
+	}
+	if len(purged) != 2 || purged[0].Rows != oldEvents || purged[1].Rows != 1 || purged[0].DryRun {
+		t.Errorf("EnforceRetention(false) = %+v, want %d events and 1 email purged", purged, oldEvents)
+	}
+	if events, _ := store.GetEvents(); len(events) != wantEvents {
+		t.Errorf("events after purge = %d, want %d", len(events), wantEvents)
+	}
+	if kinds, _ := store.BounceKinds(); kinds["old@email"] != "" {
+		t.Error("soft bounce older than retention was kept")
+	}
+	// Hard bounces and complaints are kept to suppress email.
+	for _, email := range []string{"hard@email", "complaint@email"} {
+		if suppressed, _ := store.EmailSuppressed(email); !suppressed {
+			t.Errorf("EmailSuppressed(%q) = false after purge, want true", email)
+		}
+	}
+	if reports, _ := store.CSPReports(); len(reports) != 1 {
+		t.Errorf("CSPReports() = %v, want report kept forever", reports)
+	}
+}
+
+func TestMaintenanceTasks(t *testing.T) {
+	names := func(app *webauth.AuthApp) []string {
+		var names []string
+		for _, task := range app.MaintenanceTasks() {
+			names = append(names, task.Name)
+		}
+		return names
+	}
+
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+	if got := names(app); !slices.Equal(got, []string{"idle sessions", "session values", "rate limits", "reports", "retention"}) {
+		t.Errorf("MaintenanceTasks() = %v, want [idle sessions session values rate limits reports retention]", got)
+	}
+
+	app = newAppForTest(t, []func(*webauth.Config){withDeleteGrace("24h")}, webauth.WithDB(StoreForTest(t)))
+	if got := names(app); !slices.Equal(got, []string{"account purge", "idle sessions", "session values", "rate limits", "reports", "retention"}) {
+		t.Errorf("MaintenanceTasks() = %v, want [account purge idle sessions session values rate limits reports retention]", got)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+)
+
+// MsgRiskDenied is shown for a login or registration refused by its risk.
+const MsgRiskDenied = "Sorry, this request cannot be completed. Please try again later."
+
+// RiskInput is the request to login or register that is scored by a
+// RiskScorer.
+type RiskInput struct {
+	Request  *http.Request
+	Event    EventName // Event is EventLogin or EventRegister.
+	Username string    // Username is the user, as entered.
+	History  []Event   // History is the events of the user, newest first.
+	Now      time.Time
+}
+
+// RiskScore is the score of a RiskInput, with the reasons for it.
+type RiskScore struct {
+	Score   int
+	Reasons []string
+}
+
+// RiskScorer scores how likely a login or registration is to be automated
+// or abusive. The scores of Config.Risk decide whether the request is
+// allowed, challenged, or denied.
+type RiskScorer interface {
+	Score(in RiskInput) (RiskScore, error)
+}
+
+// RiskScorerFunc is an adapter to use a function as a RiskScorer.
+type RiskScorerFunc func(in RiskInput) (RiskScore, error)
+
+// Score calls f(in).
+func (f RiskScorerFunc) Score(in RiskInput) (RiskScore, error) {
+	return f(in)
+}
+
+// WithRiskScorer returns an Option to set the RiskScorer used by
+// Config.Risk, instead of a HeuristicRiskScorer.
+func WithRiskScorer(s RiskScorer) Option {
+	return func(a *AuthApp) {
+		a.Risk = s
+	}
+}
+
+// ScoreFailedLogin is the score of each failed login of a user since its
+// last successful login, within the window of a HeuristicRiskScorer.
+const ScoreFailedLogin = 10
+
+// HeuristicRiskScorer is the default RiskScorer. The score is the sum of
+// the scores of the Screeners for the request and ScoreFailedLogin for
+// each recent failed login of the user.
+type HeuristicRiskScorer struct {
+	Screeners []Screener    // Screeners score the request metadata.
+	Window    time.Duration // Window of the failed logins counted.
+}
+
+// Score returns the score of in.
+func (h HeuristicRiskScorer) Score(in RiskInput) (RiskScore, error) {
+	var s RiskScore
+
+	for _, screener := range h.Screeners {
+		score, reason := screener.Screen(in.Request)
+		if score > 0 {
+			s.Score += score
+			s.Reasons = append(s.Reasons, reason)
+		}
+	}
+
+	var failures int
+	for _, e := range in.History {
+		if e.Name != EventLogin || e.Created.Before(in.Now.Add(-h.Window)) {
+			continue
+		}
+		if e.Succeeded {
+			break
+		}
+		failures++
+	}
+	if failures > 0 {
+		s.Score += failures * ScoreFailedLogin
+		s.Reasons = append(s.Reasons, fmt.Sprintf("%d failed logins", failures))
+	}
+
+	return s, nil
+}
+
+// RiskDecision is the action taken for a login or registration by its
+// risk score.
+type RiskDecision string
+
+const (
+	RiskAllow     RiskDecision = ""          // Allow the request.
+	RiskChallenge RiskDecision = "challenge" // Require a login link sent by email.
+	RiskDeny      RiskDecision = "deny"      // Refuse the request.
+)
+
+// ConfigRisk holds the risk scores of logins and registrations that are
+// challenged or denied. A challenged login must use a login link sent to
+// the email of the user, so Challenge requires Auth.MagicExpires, and, like
+// Config.Geo, registrations are not challenged. The default scorer uses the
+// screeners of Config.Screen, even for paths that Screen does not screen.
+type ConfigRisk struct {
+	Challenge int    // Challenge is the score challenged, or 0 to never challenge.
+	Deny      int    // Deny is the score denied, or 0 to never deny.
+	Window    string // Window of failed logins scored by default. Default 1h.
+}
+
+// riskPolicy is the parsed ConfigRisk.
+type riskPolicy struct {
+	challenge int
+	deny      int
+	window    time.Duration
+}
+
+// parse returns the riskPolicy of c, or nil if requests are not scored.
+func (c ConfigRisk) parse() (*riskPolicy, error) {
+	if c.Challenge < 0 {
+		return nil, fmt.Errorf("negative Risk.Challenge %d", c.Challenge)
+	}
+	if c.Deny < 0 {
+		return nil, fmt.Errorf("negative Risk.Deny %d", c.Deny)
+	}
+	if c.Challenge != 0 && c.Deny != 0 && c.Challenge >= c.Deny {
+		return nil, fmt.Errorf("Risk.Challenge %d not less than Risk.Deny %d", c.Challenge, c.Deny)
+	}
+
+	p := &riskPolicy{challenge: c.Challenge, deny: c.Deny, window: time.Hour}
+	if c.Window != "" {
+		var err error
+		p.window, err = time.ParseDuration(c.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Risk.Window: %w", err)
+		}
+		if p.window <= 0 {
+			return nil, fmt.Errorf("Risk.Window %q not positive", c.Window)
+		}
+	}
+
+	if p.challenge == 0 && p.deny == 0 {
+		return nil, nil
+	}
+
+	return p, nil
+}
+
+// decide returns the decision of p for score.
+func (p *riskPolicy) decide(score int) RiskDecision {
+	switch {
+	case p.deny > 0 && score >= p.deny:
+		return RiskDeny
+	case p.challenge > 0 && score >= p.challenge:
+		return RiskChallenge
+	}
+	return RiskAllow
+}
+
+// assessRisk returns the decision of Config.Risk for the request r to login
+// or register, by event, as username. Unless challenge is true, challenges
+// are allowed. A request that is not allowed is logged with its score and
+// recorded as a failed event. If the request cannot be scored, it is
+// allowed.
+func (app *AuthApp) assessRisk(logger *slog.Logger, r *http.Request, event EventName, username string, challenge bool) RiskDecision {
+	if app.risk == nil {
+		return RiskAllow
+	}
+
+	in := RiskInput{Request: r, Event: event, Username: username, Now: app.Clock.Now()}
+	if username != "" {
+		if name, err := app.ResolveUsername(username); err == nil {
+			in.History, err = app.DB.EventsForUser(name)
+			if err != nil {
+				logger.Error("failed to get events for risk", "err", err)
+				return RiskAllow
+			}
+		}
+	}
+
+	s, err := app.Risk.Score(in)
+	if err != nil {
+		logger.Error("failed to score risk", "err", err)
+		return RiskAllow
+	}
+
+	decision := app.risk.decide(s.Score)
+	if decision == RiskAllow || (decision == RiskChallenge && !challenge) {
+		return RiskAllow
+	}
+
+	reasons := strings.Join(s.Reasons, ", ")
+	logger.Warn("risky request", "score", s.Score, "reasons", s.Reasons, "decision", decision, "event", event)
+
+	app.DB.RecordEvent(NewEvent(TypeRiskRestricted, username, EventDetails{
+		"decision": string(decision),
+		"score":    fmt.Sprint(s.Score),
+		"reasons":  reasons,
+	}).Named(event))
+	app.Audit(r, audit.Entry{
+		Actor:    username,
+		Action:   string(event),
+		Result:   audit.Denied,
+		Metadata: audit.Metadata{"risk": string(decision), "score": fmt.Sprint(s.Score), "reasons": reasons},
+	})
+
+	return decision
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withRisk returns a config modifier that sets the risk scores.
+func withRisk(risk webauth.ConfigRisk) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Risk = risk
+	}
+}
+
+func TestConfigRisk(t *testing.T) {
+	tests := []struct {
+		name    string
+		risk    webauth.ConfigRisk
+		magic   string
+		wantErr error
+	}{
+		{name: "empty"},
+		{name: "deny", risk: webauth.ConfigRisk{Deny: 100, Window: "30m"}},
+		{name: "challenge", risk: webauth.ConfigRisk{Challenge: 50, Deny: 100}, magic: "15m"},
+		{name: "challengeNoMagic", risk: webauth.ConfigRisk{Challenge: 50}, wantErr: webauth.ErrInvalidConfig},
+		{name: "challengeNotLess", risk: webauth.ConfigRisk{Challenge: 100, Deny: 100}, magic: "15m", wantErr: webauth.ErrInvalidConfig},
+		{name: "negative", risk: webauth.ConfigRisk{Deny: -1}, wantErr: webauth.ErrInvalidConfig},
+		{name: "badWindow", risk: webauth.ConfigRisk{Deny: 100, Window: "soon"}, wantErr: webauth.ErrInvalidConfig},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("LoadConfigFromJSON() failed: %v", err)
+			}
+			cfg.Risk = tc.risk
+			cfg.Auth.MagicExpires = tc.magic
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeuristicRiskScorer(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	scorer := webauth.HeuristicRiskScorer{
+		Screeners: []webauth.Screener{webauth.ScreenerFunc(func(r *http.Request) (int, string) {
+			if r.UserAgent() == "" {
+				return 30, "no user agent"
+			}
+			return 0, ""
+		})},
+		Window: time.Hour,
+	}
+	history := []webauth.Event{
+		{Name: webauth.EventLogin, Created: now.Add(-time.Minute)},
+		{Name: webauth.EventRegister, Created: now.Add(-2 * time.Minute)},
+		{Name: webauth.EventLogin, Created: now.Add(-3 * time.Minute)},
+		{Name: webauth.EventLogin, Succeeded: true, Created: now.Add(-4 * time.Minute)},
+		{Name: webauth.EventLogin, Created: now.Add(-5 * time.Minute)},
+	}
+	old := []webauth.Event{{Name: webauth.EventLogin, Created: now.Add(-2 * time.Hour)}}
+
+	tests := []struct {
+		name    string
+		ua      string
+		history []webauth.Event
+		want    webauth.RiskScore
+	}{
+		{"clean", "Mozilla/5.0", nil, webauth.RiskScore{}},
+		{"screened", "", nil, webauth.RiskScore{Score: 30, Reasons: []string{"no user agent"}}},
+		{"failures", "Mozilla/5.0", history, webauth.RiskScore{Score: 2 * webauth.ScoreFailedLogin, Reasons: []string{"2 failed logins"}}},
+		{"oldFailures", "Mozilla/5.0", old, webauth.RiskScore{}},
+		{"both", "", history, webauth.RiskScore{Score: 30 + 2*webauth.ScoreFailedLogin, Reasons: []string{"no user agent", "2 failed logins"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			r.Header.Set("User-Agent", tc.ua)
+
+			got, err := scorer.Score(webauth.RiskInput{Request: r, Event: webauth.EventLogin, History: tc.history, Now: now})
+			if err != nil {
+				t.Fatalf("Score() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Score() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRiskLogin(t *testing.T) {
+	store := StoreForTest(t)
+	// The score is the X-Score header.
+	scorer := webauth.RiskScorerFunc(func(in webauth.RiskInput) (webauth.RiskScore, error) {
+		score, _ := strconv.Atoi(in.Request.Header.Get("X-Score"))
+		return webauth.RiskScore{Score: score, Reasons: []string{"header"}}, nil
+	})
+	app := newAppForTest(t,
+		[]func(*webauth.Config){withMagicExpires("15m"), withRisk(webauth.ConfigRisk{Challenge: 50, Deny: 100})},
+		webauth.WithDB(store), webauth.WithRiskScorer(scorer))
+
+	serve := func(handler http.HandlerFunc, target, score string, data url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(data.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Score", score)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	login := url.Values{"username": {"test"}, "password": {"password"}}
+	tests := []struct {
+		name    string
+		score   string
+		wantMsg string // wantMsg is empty if the login succeeds.
+	}{
+		{"allowed", "10", ""},
+		{"challenged", "50", webauth.MsgGeoChallenge},
+		{"denied", "100", webauth.MsgRiskDenied},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(app.LoginPostHandler, "/login", tc.score, login)
+			if tc.wantMsg == "" {
+				if w.Code != http.StatusSeeOther {
+					t.Errorf("got status %d, want %d", w.Code, http.StatusSeeOther)
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), tc.wantMsg) {
+				t.Errorf("got body %q, expected %q in body", w.Body, tc.wantMsg)
+			}
+			if w.Header().Get("Set-Cookie") != "" {
+				t.Errorf("risky login set cookie %q", w.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+
+	// Registrations are denied, but not challenged.
+	register := url.Values{
+		"username":  {"new"},
+		"fullName":  {"New User"},
+		"email":     {"new@email"},
+		"password1": {"password"},
+		"password2": {"password"},
+	}
+	w := serve(app.RegisterHandler, "/register", "100", register)
+	if !strings.Contains(w.Body.String(), webauth.MsgRiskDenied) {
+		t.Errorf("got body %q, expected %q in body", w.Body, webauth.MsgRiskDenied)
+	}
+	if exists, _ := app.DB.UserExists("new"); exists {
+		t.Error("user registered with denied risk")
+	}
+	serve(app.RegisterHandler, "/register", "50", register)
+	if exists, _ := app.DB.UserExists("new"); !exists {
+		t.Error("user not registered with challenged risk")
+	}
+
+	// Each decision is recorded with its score.
+	events, err := store.EventsForUser("test")
+	if err != nil {
+		t.Fatalf("EventsForUser() failed: %v", err)
+	}
+	var risky []string
+	for _, e := range events {
+		if strings.Contains(e.Message, " by risk score ") {
+			risky = append(risky, e.Message)
+		}
+	}
+	want := []string{"deny by risk score 100: header", "challenge by risk score 50: header"}
+	if !reflect.DeepEqual(risky, want) {
+		t.Errorf("events = %q, want %q", risky, want)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Permission allows a user to view or change part of the app.
+type Permission string
+
+// Permissions checked by the handlers. PermAll grants every permission.
+const (
+	PermAll                 Permission = "*"
+	PermViewEvents          Permission = "events:view"
+	PermViewUsers           Permission = "users:view"
+	PermManageUsers         Permission = "users:manage"
+	PermManageIncidents     Permission = "incidents:manage"
+	PermManageAnnouncements Permission = "announcements:manage"
+	PermViewRateLimits      Permission = "ratelimits:view"
+	PermViewCSPReports      Permission = "cspreports:view"
+	PermViewReports         Permission = "reports:view"
+	PermViewAudit           Permission = "audit:view"
+	PermViewInstances       Permission = "instances:view"
+	PermManageRoutes        Permission = "routes:manage"
+)
+
+// RoleAdmin is the built-in role with PermAll. Users with IsAdmin set
+// have this role, even if it was not granted.
+const RoleAdmin = "admin"
+
+// Maximum lengths of role values, matching the SQL schema.
+const (
+	MaxRoleNameLen        = 30
+	MaxRoleDescriptionLen = 255
+	MaxPermissionLen      = 50
+)
+
+// Role is a named set of permissions granted to users.
+type Role struct {
+	Name        string
+	Description string
+	Permissions []Permission
+}
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// HasRole returns true if u was granted the role name. Admins have
+// RoleAdmin.
+func (u User) HasRole(name string) bool {
+	if name == RoleAdmin && u.IsAdmin {
+		return true
+	}
+	return slices.Contains(u.Roles, name)
+}
+
+// Can returns true if a role of u grants perm or PermAll. Admins have all
+// permissions.
+func (u User) Can(perm Permission) bool {
+	if u.IsAdmin {
+		return true
+	}
+	return slices.Contains(u.Permissions, perm) || slices.Contains(u.Permissions, PermAll)
+}
+
+// CanAccess returns true if u meets the access requirements declared for
+// route, so templates can show only the routes of menus that u can use.
+func (u User) CanAccess(route webhandler.Route) bool {
+	if route.Login && u.Username == "" {
+		return false
+	}
+	if len(route.Roles) > 0 && !slices.ContainsFunc(route.Roles, u.HasRole) {
+		return false
+	}
+	for _, perm := range route.Permissions {
+		if !u.Can(Permission(perm)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setRoles sets the roles and permissions of u from roles. IsAdmin is set
+// if u has RoleAdmin, so code that checks IsAdmin keeps working.
+func (u *User) setRoles(roles []Role) {
+	u.Roles, u.Permissions = nil, nil
+	for _, role := range roles {
+		u.Roles = append(u.Roles, role.Name)
+		for _, perm := range role.Permissions {
+			if !slices.Contains(u.Permissions, perm) {
+				u.Permissions = append(u.Permissions, perm)
+			}
+		}
+	}
+
+	if slices.Contains(u.Roles, RoleAdmin) {
+		u.IsAdmin = true
+	}
+}
+
+// validRole returns an error if role has no name or a value is too long.
+func validRole(role Role) error {
+	if role.Name == "" {
+		return ErrRoleNotFound
+	}
+	if len(role.Name) > MaxRoleNameLen || len(role.Description) > MaxRoleDescriptionLen {
+		return ErrValueTooLong
+	}
+	for _, perm := range role.Permissions {
+		if len(perm) > MaxPermissionLen {
+			return ErrValueTooLong
+		}
+	}
+	return nil
+}
+
+// scanRoles returns the roles in rows of name, description, and a
+// permission, which can be NULL, ordered by name.
+func scanRoles(rows *sql.Rows) ([]Role, error) {
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var (
+			name, description string
+			perm              sql.NullString
+		)
+		if err := rows.Scan(&name, &description, &perm); err != nil {
+			return nil, err
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, Role{Name: name, Description: description})
+		}
+		if perm.Valid {
+			role := &roles[len(roles)-1]
+			role.Permissions = append(role.Permissions, Permission(perm.String))
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+// Roles returns all roles ordered by name.
+func (db *AuthDB) Roles() ([]Role, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT r.name, r.description, p.permission FROM roles r LEFT JOIN role_permissions p ON p.role_name = r.name ORDER BY r.name, p.permission`
+	rows, err := db.Query(qry)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRoles(rows)
+}
+
+// UserRoles returns the roles granted to username ordered by name.
+func (db *AuthDB) UserRoles(username string) ([]Role, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT r.name, r.description, p.permission FROM users u JOIN user_roles ur ON ur.user_id = u.id JOIN roles r ON r.name = ur.role_name LEFT JOIN role_permissions p ON p.role_name = r.name WHERE u.username = ? ORDER BY r.name, p.permission`
+	rows, err := db.Query(qry, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRoles(rows)
+}
+
+// SaveRole creates role or replaces the description and permissions of
+// the role with the same name.
+func (db *AuthDB) SaveRole(role Role) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	if err := validRole(role); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(db.Rebind("UPDATE roles SET description = ? WHERE name = ?"), role.Description, role.Name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		_, err = tx.Exec(db.Rebind("INSERT INTO roles(name, description) VALUES (?, ?)"), role.Name, role.Description)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(db.Rebind("DELETE FROM role_permissions WHERE role_name = ?"), role.Name)
+	if err != nil {
+		return err
+	}
+
+	perms := slices.Clone(role.Permissions)
+	slices.Sort(perms)
+	for _, perm := range slices.Compact(perms) {
+		_, err = tx.Exec(db.Rebind("INSERT INTO role_permissions(role_name, permission) VALUES (?, ?)"), role.Name, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRole deletes the role name and revokes it from all users.
+func (db *AuthDB) DeleteRole(name string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, qry := range []string{
+		"DELETE FROM user_roles WHERE role_name = ?",
+		"DELETE FROM role_permissions WHERE role_name = ?",
+	} {
+		if _, err := tx.Exec(db.Rebind(qry), name); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(db.Rebind("DELETE FROM roles WHERE name = ?"), name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrRoleNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GrantRole grants the role name to username. Granting a role the user
+// already has is not an error.
+func (db *AuthDB) GrantRole(username, name string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(db.Rebind("SELECT id FROM users WHERE username = ?"), username).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var roles int
+	err = tx.QueryRow(db.Rebind("SELECT COUNT(*) FROM roles WHERE name = ?"), name).Scan(&roles)
+	if err != nil {
+		return err
+	}
+	if roles == 0 {
+		return ErrRoleNotFound
+	}
+
+	_, err = tx.Exec(db.Rebind("DELETE FROM user_roles WHERE user_id = ? AND role_name = ?"), id, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(db.Rebind("INSERT INTO user_roles(user_id, role_name) VALUES (?, ?)"), id, name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeRole revokes the role name from username. It returns
+// ErrRoleNotFound if the user does not have the role.
+func (db *AuthDB) RevokeRole(username, name string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	qry := "DELETE FROM user_roles WHERE role_name = ? AND user_id = (SELECT id FROM users WHERE username = ?)"
+	result, err := db.Exec(qry, name, username)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// RequireRole returns a handler that calls next only if the request is
+// from a logged in user with one of roles. Otherwise, it responds with
+// http.StatusUnauthorized.
+func (app *AuthApp) RequireRole(next http.Handler, roles ...string) http.Handler {
+	return app.requireUser(next, func(u User) bool {
+		return slices.ContainsFunc(roles, u.HasRole)
+	})
+}
+
+// RequirePermission returns a handler that calls next only if the request
+// is from a logged in user with perm. Otherwise, it responds with
+// http.StatusUnauthorized.
+func (app *AuthApp) RequirePermission(next http.Handler, perm Permission) http.Handler {
+	return app.requireUser(next, func(u User) bool {
+		return u.Can(perm)
+	})
+}
+
+// requireUser returns a handler that calls next only if the request is
+// from a user allowed by allow.
+func (app *AuthApp) requireUser(next http.Handler, allow func(User) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := webhandler.RequestLoggerWithFuncName(r)
+
+		user, err := app.UserFromRequest(w, r)
+		if err != nil {
+			logger.Error("failed to get user", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		if user.Username == "" || !allow(user) {
+			logger.Warn("user not authorized", "user", user)
+			if user.Username != "" {
+				app.Audit(r, audit.Entry{Actor: user.Username, Action: AuditAccessDenied, Target: r.URL.Path, Result: audit.Denied})
+			}
+			webutil.Error(w, r, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
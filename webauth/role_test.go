@@ -0,0 +1,206 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUserCan(t *testing.T) {
+	admin := webauth.User{IsAdmin: true}
+	if !admin.Can(webauth.PermViewEvents) || !admin.HasRole(webauth.RoleAdmin) {
+		t.Errorf("IsAdmin user does not have admin role and all permissions")
+	}
+
+	var user webauth.User
+	if user.Can(webauth.PermViewEvents) || user.HasRole(webauth.RoleAdmin) {
+		t.Errorf("user without roles has a role or permission")
+	}
+}
+
+func TestMemStoreRoles(t *testing.T) {
+	store := StoreForTest(t)
+
+	viewer := webauth.Role{
+		Name:        "viewer",
+		Description: "View events",
+		Permissions: []webauth.Permission{webauth.PermViewEvents},
+	}
+	if err := store.SaveRole(viewer); err != nil {
+		t.Fatalf("SaveRole() failed: %v", err)
+	}
+
+	roles, err := store.Roles()
+	if err != nil {
+		t.Fatalf("Roles() failed: %v", err)
+	}
+	want := []webauth.Role{
+		{Name: "admin", Description: "All permissions", Permissions: []webauth.Permission{webauth.PermAll}},
+		viewer,
+	}
+	if diff := cmp.Diff(want, roles); diff != "" {
+		t.Errorf("Roles() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := store.GrantRole("test", "missing"); !errors.Is(err, webauth.ErrRoleNotFound) {
+		t.Errorf("GrantRole() for missing role = %v, want %v", err, webauth.ErrRoleNotFound)
+	}
+	if err := store.GrantRole("missing", "viewer"); !errors.Is(err, webauth.ErrUserNotFound) {
+		t.Errorf("GrantRole() for missing user = %v, want %v", err, webauth.ErrUserNotFound)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := store.GrantRole("test", "viewer"); err != nil {
+			t.Fatalf("GrantRole() failed: %v", err)
+		}
+	}
+
+	roles, err = store.UserRoles("test")
+	if err != nil {
+		t.Fatalf("UserRoles() failed: %v", err)
+	}
+	if diff := cmp.Diff([]webauth.Role{viewer}, roles); diff != "" {
+		t.Errorf("UserRoles() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := store.RevokeRole("test", "viewer"); err != nil {
+		t.Errorf("RevokeRole() = %v, want nil", err)
+	}
+	if err := store.RevokeRole("test", "viewer"); !errors.Is(err, webauth.ErrRoleNotFound) {
+		t.Errorf("RevokeRole() again = %v, want %v", err, webauth.ErrRoleNotFound)
+	}
+
+	if err := store.GrantRole("test", "viewer"); err != nil {
+		t.Fatalf("GrantRole() failed: %v", err)
+	}
+	if err := store.DeleteRole("viewer"); err != nil {
+		t.Errorf("DeleteRole() = %v, want nil", err)
+	}
+	roles, err = store.UserRoles("test")
+	if err != nil || len(roles) != 0 {
+		t.Errorf("UserRoles() after DeleteRole = %v, %v, want none", roles, err)
+	}
+	if err := store.DeleteRole("viewer"); !errors.Is(err, webauth.ErrRoleNotFound) {
+		t.Errorf("DeleteRole() again = %v, want %v", err, webauth.ErrRoleNotFound)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	err := store.SaveRole(webauth.Role{
+		Name:        "auditor",
+		Permissions: []webauth.Permission{webauth.PermViewEvents},
+	})
+	if err != nil {
+		t.Fatalf("SaveRole() failed: %v", err)
+	}
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	if w := requestAs(app.EventsCSVHandler, token.Value, http.MethodGet, "/eventscsv", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("EventsCSVHandler() without role status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if err := store.GrantRole("test", "auditor"); err != nil {
+		t.Fatalf("GrantRole() failed: %v", err)
+	}
+
+	if w := requestAs(app.EventsCSVHandler, token.Value, http.MethodGet, "/eventscsv", ""); w.Code != http.StatusOK {
+		t.Errorf("EventsCSVHandler() with role status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := requestAs(app.RateLimitsHandler, token.Value, http.MethodGet, "/ratelimits", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("RateLimitsHandler() with role status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	if err := store.SaveRole(webauth.Role{Name: "support"}); err != nil {
+		t.Fatalf("SaveRole() failed: %v", err)
+	}
+	if err := store.GrantRole("test", "support"); err != nil {
+		t.Fatalf("GrantRole() failed: %v", err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		user    string
+		want    int
+	}{
+		{"role", app.RequireRole(ok, "support"), "test", http.StatusOK},
+		{"other role", app.RequireRole(ok, "support"), "admin", http.StatusUnauthorized},
+		{"any role", app.RequireRole(ok, "support", webauth.RoleAdmin), "admin", http.StatusOK},
+		{"admin", app.RequireAdmin(ok), "admin", http.StatusOK},
+		{"not admin", app.RequireAdmin(ok), "test", http.StatusUnauthorized},
+		{"permission", app.RequirePermission(ok, webauth.PermViewUsers), "admin", http.StatusOK},
+		{"no permission", app.RequirePermission(ok, webauth.PermViewUsers), "test", http.StatusUnauthorized},
+		{"no user", app.RequireRole(ok, "support"), "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.user != "" {
+				token, err := app.LoginUser(tc.user, "password")
+				if err != nil {
+					t.Fatalf("could not login %s: %v", tc.user, err)
+				}
+				r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+			}
+
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, r)
+
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestUserCanAccess(t *testing.T) {
+	var (
+		anonymous webauth.User
+		user      = webauth.User{Username: "test"}
+		admin     = webauth.User{Username: "admin", IsAdmin: true}
+	)
+
+	tests := []struct {
+		name  string
+		route webhandler.Route
+		want  []bool // want is for anonymous, user, and admin.
+	}{
+		{"public", webhandler.Route{}, []bool{true, true, true}},
+		{"login", webhandler.Route{Login: true}, []bool{false, true, true}},
+		{"role", webhandler.Route{Login: true, Roles: []string{webauth.RoleAdmin}}, []bool{false, false, true}},
+		{"permission", webhandler.Route{Login: true, Permissions: []string{string(webauth.PermViewUsers)}}, []bool{false, false, true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, u := range []webauth.User{anonymous, user, admin} {
+				if got := u.CanAccess(tc.route); got != tc.want[i] {
+					t.Errorf("CanAccess() for %q = %v, want %v", u.Username, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// RouteInventory returns the routes of mux with the rate limit of
+// Config.RateLimit added to the routes with an API prefix, since the
+// RateLimit middleware applies it by path instead of by route.
+func (app *AuthApp) RouteInventory(mux *webhandler.Mux) []webhandler.Route {
+	routes := mux.Routes()
+	if app.rateLimit.limit == 0 {
+		return routes
+	}
+
+	limit := formatRateLimit(app.rateLimit.limit, app.rateLimit.window)
+	for i, route := range routes {
+		if route.RateLimit != "" {
+			continue
+		}
+		for _, prefix := range app.timeouts.apiPrefixes {
+			if strings.HasPrefix(route.Path, prefix) {
+				routes[i].RateLimit = limit
+				break
+			}
+		}
+	}
+
+	return routes
+}
+
+// CSPReportRateLimit returns the rate limit of CSPReportQuota for the
+// route inventory.
+func (app *AuthApp) CSPReportRateLimit() string {
+	return formatRateLimit(app.cspReportLimit, app.cspReportWindow())
+}
+
+// formatRateLimit returns limit requests per window, such as "100/1h",
+// without the zero units of time.Duration.String.
+func formatRateLimit(limit int, window time.Duration) string {
+	s := window.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return strconv.Itoa(limit) + "/" + s
+}
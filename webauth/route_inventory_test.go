@@ -0,0 +1,45 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestRouteInventory(t *testing.T) {
+	app := AppWithoutDBForTest(t, func(cfg *webauth.Config) {
+		cfg.RateLimit = webauth.ConfigRateLimit{Limit: 100, Window: "1h"}
+		cfg.Debug.Enabled = true
+	})
+
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET "+webauth.APIPrefix+"/users", noop)
+	mux.HandleFunc("POST "+webauth.CSPReportPath, noop, webhandler.RouteRateLimit(app.CSPReportRateLimit()))
+	mux.HandleFunc("/login", noop)
+	app.AddDebugRoutes(mux)
+
+	got := make(map[string]webhandler.Route)
+	for _, route := range app.RouteInventory(mux) {
+		got[route.Path] = route
+	}
+
+	if r := got[webauth.APIPrefix+"/users"]; r.RateLimit != "100/1h" {
+		t.Errorf("API route RateLimit = %q, want %q", r.RateLimit, "100/1h")
+	}
+	if r := got[webauth.CSPReportPath]; r.RateLimit != "100/1h" {
+		t.Errorf("CSP report RateLimit = %q, want %q", r.RateLimit, "100/1h")
+	}
+	if r := got["/login"]; r.RateLimit != "" {
+		t.Errorf("login RateLimit = %q, want none", r.RateLimit)
+	}
+	if r := got["/debug/vars"]; !r.Login || len(r.Roles) != 1 || r.Roles[0] != webauth.RoleAdmin {
+		t.Errorf("debug route = %+v, want %s role", r, webauth.RoleAdmin)
+	}
+}
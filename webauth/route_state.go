@@ -0,0 +1,416 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// routeStateRefresh is how often the route states are read from the
+// store, so a change on one instance is applied by the others.
+const routeStateRefresh = 5 * time.Second
+
+// MaxRouteStateMessageLen is the maximum length of the message of a
+// RouteState, matching the SQL schema.
+const MaxRouteStateMessageLen = 255
+
+// RouteState is the state of a route set by an admin, which disables the
+// route or sends a share of its requests to its canary handler.
+type RouteState struct {
+	Pattern   string // Pattern is that of the route in the Mux.
+	Disabled  bool   // Disabled routes respond with the error template.
+	Message   string // Message tells users why the route is disabled.
+	Canary    int    // Canary is the percent of requests sent to the canary handler.
+	UpdatedBy string
+	Updated   time.Time
+}
+
+// ErrRouteStateInvalid is returned by SetRouteState for a state that the
+// route cannot have.
+var ErrRouteStateInvalid = errors.New("invalid route state")
+
+// protectedRoutePaths are the paths of the routes that cannot be disabled
+// or canaried, so that admins can still login and undo a route state.
+var protectedRoutePaths = []string{"/login", APILoginPath, APIPrefix + "/routes"}
+
+// isProtectedRoute returns true if the route with pattern is protected.
+func isProtectedRoute(pattern string) bool {
+	path := pattern
+	if _, p, ok := strings.Cut(pattern, " "); ok {
+		path = strings.TrimSpace(p)
+	}
+
+	return slices.Contains(protectedRoutePaths, path)
+}
+
+// routeStates are the route states of the store, refreshed every
+// routeStateRefresh, and the Mux with the routes.
+type routeStates struct {
+	mu      sync.Mutex
+	mux     *webhandler.Mux
+	loading bool                  // loading is true while states are read.
+	gen     int                   // gen is incremented by SetRouteState.
+	loaded  time.Time             // loaded is when states were read.
+	states  map[string]RouteState // states are by pattern.
+}
+
+// ManageRoutes applies the route states of the store to the routes of mux
+// and allows SetRouteState to change them. Call it once the routes are
+// added, before mux serves requests.
+func (app *AuthApp) ManageRoutes(mux *webhandler.Mux) {
+	app.routes.mu.Lock()
+	app.routes.mux = mux
+	app.routes.mu.Unlock()
+
+	mux.SetRouteStates(app)
+}
+
+// RouteState returns the state of the route with pattern, so AuthApp is
+// webhandler.RouteStates. If the states cannot be read, the last states
+// read are used. Routes not in app.SchemaExempt are disabled if the schema
+// of the database does not match. Protected routes, such as login, are
+// always enabled.
+func (app *AuthApp) RouteState(pattern string) webhandler.RouteState {
+	if app.schemaErr != nil && !app.schemaExempt(pattern) {
+		return webhandler.RouteState{Disabled: true, Message: schemaUnavailable}
+	}
+	if isProtectedRoute(pattern) {
+		return webhandler.RouteState{}
+	}
+
+	rs := app.routes
+	rs.mu.Lock()
+	now := app.Clock.Now()
+	refresh := !rs.loading && (rs.states == nil || now.Sub(rs.loaded) >= routeStateRefresh)
+	if refresh {
+		rs.loading, rs.loaded = true, now
+	}
+	gen := rs.gen
+	rs.mu.Unlock()
+
+	// Read the states without the lock, so other requests use the last
+	// states read rather than wait for the store.
+	if refresh {
+		states, err := app.DB.RouteStates()
+		if err != nil {
+			slog.Error("failed to read route states", "err", err)
+		}
+
+		rs.mu.Lock()
+		rs.loading = false
+		// Keep the states of SetRouteState made during the read.
+		if err == nil && gen == rs.gen {
+			rs.states = make(map[string]RouteState, len(states))
+			for _, s := range states {
+				rs.states[s.Pattern] = s
+			}
+		}
+		rs.mu.Unlock()
+	}
+
+	rs.mu.Lock()
+	s := rs.states[pattern]
+	rs.mu.Unlock()
+
+	return webhandler.RouteState{Disabled: s.Disabled, Message: s.Message, Canary: s.Canary}
+}
+
+// route returns the route of the managed Mux with pattern.
+func (app *AuthApp) route(pattern string) (webhandler.Route, bool) {
+	app.routes.mu.Lock()
+	mux := app.routes.mux
+	app.routes.mu.Unlock()
+
+	if mux == nil {
+		return webhandler.Route{}, false
+	}
+	for _, route := range mux.Routes() {
+		if route.Pattern == pattern {
+			return route, true
+		}
+	}
+
+	return webhandler.Route{}, false
+}
+
+// SetRouteState saves s as the state of its route, set by user, and
+// applies it to this instance at once. A state that neither disables the
+// route nor has a canary is removed. ErrRouteStateInvalid is returned if
+// the route is not in the Mux of ManageRoutes or is protected, the canary
+// is not a percent, or the route has no canary handler for it.
+func (app *AuthApp) SetRouteState(r *http.Request, user User, s RouteState) error {
+	route, ok := app.route(s.Pattern)
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: unknown route %q", ErrRouteStateInvalid, s.Pattern)
+	case (s.Disabled || s.Canary > 0) && isProtectedRoute(s.Pattern):
+		return fmt.Errorf("%w: route %q is protected", ErrRouteStateInvalid, s.Pattern)
+	case s.Canary < 0 || s.Canary > 100:
+		return fmt.Errorf("%w: canary %d is not a percent", ErrRouteStateInvalid, s.Canary)
+	case s.Canary > 0 && !route.Canary:
+		return fmt.Errorf("%w: route %q has no canary handler", ErrRouteStateInvalid, s.Pattern)
+	case len(s.Message) > MaxRouteStateMessageLen:
+		return fmt.Errorf("%w: message longer than %d", ErrRouteStateInvalid, MaxRouteStateMessageLen)
+	}
+
+	s.UpdatedBy, s.Updated = user.Username, app.Clock.Now().UTC()
+
+	states, err := app.DB.RouteStates()
+	if err != nil {
+		return err
+	}
+	var before auditedRoute
+	for _, prev := range states {
+		if prev.Pattern == s.Pattern {
+			before = auditedRouteOf(prev)
+		}
+	}
+
+	if s.Disabled || s.Canary > 0 {
+		err = app.DB.SetRouteState(s)
+	} else {
+		err = app.DB.RemoveRouteState(s.Pattern)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Apply the state to this instance without waiting for a refresh.
+	rs := app.routes
+	rs.mu.Lock()
+	if rs.states == nil {
+		rs.states = make(map[string]RouteState)
+	}
+	if s.Disabled || s.Canary > 0 {
+		rs.states[s.Pattern] = s
+	} else {
+		delete(rs.states, s.Pattern)
+	}
+	rs.gen++
+	rs.mu.Unlock()
+
+	app.Audit(r, audit.Entry{
+		Actor:  user.Username,
+		Action: AuditRouteState,
+		Target: s.Pattern,
+		Result: audit.Success,
+		Metadata: audit.Metadata{
+			"disabled": strconv.FormatBool(s.Disabled),
+			"canary":   strconv.Itoa(s.Canary),
+		},
+		Changes: auditChanges(before, auditedRouteOf(s)),
+	})
+
+	return nil
+}
+
+// auditedRoute is the state of a route in the Changes of audit entries.
+type auditedRoute struct {
+	Disabled bool   `json:"disabled"`
+	Message  string `json:"message"`
+	Canary   int    `json:"canary"`
+}
+
+// auditedRouteOf returns the audited state of s.
+func auditedRouteOf(s RouteState) auditedRoute {
+	return auditedRoute{Disabled: s.Disabled, Message: s.Message, Canary: s.Canary}
+}
+
+// apiRoute is the JSON form of a route and its state.
+type apiRoute struct {
+	Pattern   string     `json:"pattern"`
+	HasCanary bool       `json:"hasCanary"`
+	Disabled  bool       `json:"disabled"`
+	Message   string     `json:"message,omitempty"`
+	Canary    int        `json:"canary"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	Updated   *time.Time `json:"updated,omitempty"`
+}
+
+// apiRoutes is the JSON form of the routes.
+type apiRoutes struct {
+	Routes []apiRoute `json:"routes"`
+}
+
+// APIRoutesHandler responds to GET with the routes of the Mux of
+// ManageRoutes and their states as JSON. A POST of a JSON route state,
+// with the pattern, disabled, message, and canary of apiRoute, sets the
+// state of a route. It requires PermManageRoutes.
+func (app *AuthApp) APIRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.apiRoutesGet, Post: app.apiRoutesPost}.ServeHTTP(w, r)
+}
+
+// apiRoutesGet responds with the routes and their states.
+func (app *AuthApp) apiRoutesGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if _, ok := app.apiRoutesUser(w, r, logger); !ok {
+		return
+	}
+
+	app.respondRoutes(w, logger)
+}
+
+// apiRoutesPost sets the state of a route and responds with the routes
+// and their states.
+func (app *AuthApp) apiRoutesPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, ok := app.apiRoutesUser(w, r, logger)
+	if !ok {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		logger.Warn("invalid content type", "type", mediaType)
+		respondAPIError(w, logger, http.StatusUnsupportedMediaType, "")
+		return
+	}
+
+	var body apiRoute
+	err := json.NewDecoder(io.LimitReader(r.Body, maxAPIBodyLen)).Decode(&body)
+	if err != nil {
+		logger.Warn("invalid JSON", "err", err)
+		respondAPIError(w, logger, http.StatusBadRequest, "")
+		return
+	}
+
+	err = app.SetRouteState(r, user, RouteState{
+		Pattern:  body.Pattern,
+		Disabled: body.Disabled,
+		Message:  body.Message,
+		Canary:   body.Canary,
+	})
+	switch {
+	case errors.Is(err, ErrRouteStateInvalid):
+		logger.Warn("invalid route state", "err", err)
+		respondAPIError(w, logger, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		logger.Error("failed to set route state", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return
+	}
+	logger.Info("set route state", "pattern", body.Pattern, "disabled", body.Disabled, "canary", body.Canary)
+
+	app.respondRoutes(w, logger)
+}
+
+// apiRoutesUser returns the user of the API request r if they can manage
+// routes. If not, an error is written and false is returned.
+func (app *AuthApp) apiRoutesUser(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (User, bool) {
+	user, ok := app.apiUser(w, r, logger)
+	if !ok {
+		return User{}, false
+	}
+
+	if !user.Can(PermManageRoutes) {
+		logger.Warn("user not authorized", "user", user)
+		respondAPIError(w, logger, http.StatusForbidden, "")
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// respondRoutes responds with the routes of the Mux of ManageRoutes and
+// their states as JSON.
+func (app *AuthApp) respondRoutes(w http.ResponseWriter, logger *slog.Logger) {
+	states, err := app.DB.RouteStates()
+	if err != nil {
+		logger.Error("failed to get route states", "err", err)
+		respondAPIError(w, logger, http.StatusInternalServerError, "")
+		return
+	}
+	byPattern := make(map[string]RouteState, len(states))
+	for _, s := range states {
+		byPattern[s.Pattern] = s
+	}
+
+	app.routes.mu.Lock()
+	mux := app.routes.mux
+	app.routes.mu.Unlock()
+
+	data := apiRoutes{Routes: []apiRoute{}}
+	if mux != nil {
+		for _, route := range mux.Routes() {
+			ar := apiRoute{Pattern: route.Pattern, HasCanary: route.Canary}
+			if s, ok := byPattern[route.Pattern]; ok {
+				ar.Disabled, ar.Message, ar.Canary = s.Disabled, s.Message, s.Canary
+				ar.UpdatedBy, ar.Updated = s.UpdatedBy, &s.Updated
+			}
+			data.Routes = append(data.Routes, ar)
+		}
+	}
+
+	respondAPI(w, logger, data)
+}
+
+// SetRouteState saves s, replacing the state of its route.
+func (db *AuthDB) SetRouteState(s RouteState) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	return db.WithTx(func(tx *Tx) error {
+		if _, err := tx.Exec("DELETE FROM route_states WHERE pattern = ?", s.Pattern); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec("INSERT INTO route_states(pattern, disabled, message, canary, updated_by, updated) VALUES (?, ?, ?, ?, ?, ?)",
+			s.Pattern, s.Disabled, s.Message, s.Canary, s.UpdatedBy, s.Updated)
+
+		return err
+	})
+}
+
+// RouteStates returns the saved route states ordered by pattern.
+func (db *AuthDB) RouteStates() ([]RouteState, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	rows, err := db.Query("SELECT pattern, disabled, message, canary, updated_by, updated FROM route_states ORDER BY pattern")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []RouteState
+	for rows.Next() {
+		var s RouteState
+		if err := rows.Scan(&s.Pattern, &s.Disabled, &s.Message, &s.Canary, &s.UpdatedBy, &s.Updated); err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+
+	return states, rows.Err()
+}
+
+// RemoveRouteState removes the state of the route with pattern.
+func (db *AuthDB) RemoveRouteState(pattern string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	_, err := db.Exec("DELETE FROM route_states WHERE pattern = ?", pattern)
+
+	return err
+}
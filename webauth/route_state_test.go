@@ -0,0 +1,180 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestAPIRoutesHandler(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	text := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, s)
+		}
+	}
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET /page", text("old"), webhandler.RouteCanary(text("new")))
+	mux.HandleFunc("GET /other", text("other"))
+	mux.HandleFunc("GET /login", text("login"))
+	mux.HandleFunc(webauth.APIPrefix+"/routes", app.APIRoutesHandler)
+	app.ManageRoutes(mux)
+
+	admin, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	test, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	get := func(target string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Body.String()
+	}
+	set := func(bearer, body string) *httptest.ResponseRecorder {
+		return apiRequest(app.APIRoutesHandler, http.MethodPost, "/api/v1/routes", bearer, "application/json", body)
+	}
+
+	if w := set(test.Value, `{"pattern":"GET /page","disabled":true}`); w.Code != http.StatusForbidden {
+		t.Errorf("status without permission = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	for _, body := range []string{
+		`{"pattern":"GET /missing","disabled":true}`,
+		`{"pattern":"GET /other","canary":10}`,
+		`{"pattern":"GET /page","canary":101}`,
+		`{"pattern":"GET /login","disabled":true}`,
+		`{"pattern":"/api/v1/routes","disabled":true}`,
+	} {
+		if w := set(admin.Value, body); w.Code != http.StatusBadRequest {
+			t.Errorf("status for %s = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w := set(admin.Value, `{"pattern":"GET /other","disabled":true,"message":"Back soon."}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if got := get("/other"); !strings.Contains(got, "Back soon.") {
+		t.Errorf("body of disabled route = %q, want message", got)
+	}
+
+	if w := set(admin.Value, `{"pattern":"GET /page","canary":100}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if got := get("/page"); got != "new" {
+		t.Errorf("body of canary route = %q, want %q", got, "new")
+	}
+
+	var got struct {
+		Routes []struct {
+			Pattern   string
+			HasCanary bool
+			Disabled  bool
+			Canary    int
+			UpdatedBy string
+		}
+	}
+	decodeJSON(t, apiRequest(app.APIRoutesHandler, http.MethodGet, "/api/v1/routes", admin.Value, "", ""), &got)
+	if len(got.Routes) != 4 || !got.Routes[2].Disabled || got.Routes[3].Canary != 100 || !got.Routes[3].HasCanary || got.Routes[3].UpdatedBy != "admin" {
+		t.Errorf("routes = %+v, want /other disabled and /page canary", got.Routes)
+	}
+
+	// A state without a change is removed.
+	set(admin.Value, `{"pattern":"GET /other"}`)
+	set(admin.Value, `{"pattern":"GET /page"}`)
+	if got := get("/other") + get("/page"); got != "otherold" {
+		t.Errorf("bodies after reset = %q, want %q", got, "otherold")
+	}
+
+	entries, _, _ := store.AuditEntries(audit.Filter{Action: webauth.AuditRouteState, Target: "GET /page"})
+	want := audit.Changes{{Field: "canary", Before: "100", After: "0"}}
+	if len(entries) != 2 || !reflect.DeepEqual(entries[0].Changes, want) {
+		t.Errorf("AuditEntries() = %+v, want newest with changes %+v", entries, want)
+	}
+}
+
+// blockingRouteStore is an AuthStore whose RouteStates sends to reading
+// and waits for block.
+type blockingRouteStore struct {
+	webauth.AuthStore
+	reading chan struct{}
+	block   chan struct{}
+}
+
+func (s blockingRouteStore) RouteStates() ([]webauth.RouteState, error) {
+	s.reading <- struct{}{}
+	<-s.block
+	return s.AuthStore.RouteStates()
+}
+
+func TestRouteStateProtected(t *testing.T) {
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	// A state saved for a protected route, e.g., before it was protected,
+	// is ignored.
+	if err := store.SetRouteState(webauth.RouteState{Pattern: "POST /login", Disabled: true}); err != nil {
+		t.Fatalf("SetRouteState() failed: %v", err)
+	}
+	if err := store.SetRouteState(webauth.RouteState{Pattern: "GET /page", Disabled: true}); err != nil {
+		t.Fatalf("SetRouteState() failed: %v", err)
+	}
+
+	if got := app.RouteState("POST /login"); got.Disabled {
+		t.Errorf("RouteState() of login = %+v, want enabled", got)
+	}
+	if got := app.RouteState("GET /page"); !got.Disabled {
+		t.Errorf("RouteState() of page = %+v, want disabled", got)
+	}
+}
+
+func TestRouteStateRefresh(t *testing.T) {
+	store := blockingRouteStore{
+		AuthStore: StoreForTest(t),
+		reading:   make(chan struct{}),
+		block:     make(chan struct{}),
+	}
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	// The first request reads the states and waits for the store.
+	refreshed := make(chan struct{})
+	go func() {
+		app.RouteState("GET /page")
+		close(refreshed)
+	}()
+	<-store.reading
+
+	// Other requests neither wait for the read nor read again.
+	done := make(chan struct{})
+	go func() {
+		app.RouteState("GET /other")
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("RouteState() waited for the read of another request")
+	}
+
+	close(store.block)
+	<-refreshed
+}
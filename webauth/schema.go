@@ -0,0 +1,80 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth/migrations"
+)
+
+// DefaultSchemaExempt are the paths served if the schema of the database
+// does not match the binary, so that health checks and the status page
+// report the mismatch.
+var DefaultSchemaExempt = []string{"/healthz", "/readyz", "/status"}
+
+// schemaCheckTimeout limits the schema check of NewApp.
+const schemaCheckTimeout = 10 * time.Second
+
+// schemaUnavailable is the message of routes disabled by a schema mismatch.
+const schemaUnavailable = "This service is unavailable until its database is upgraded."
+
+// schemaChecker is a datastore with a versioned schema, such as AuthDB.
+type schemaChecker interface {
+	CheckSchema(ctx context.Context) error
+}
+
+// checkSchema sets app.schemaErr if the schema of app.DB does not match
+// the migrations of the binary. Only the routes of app.SchemaExempt are
+// then served by a Mux managed by app, so that a release deployed
+// without migrating the database cannot corrupt it.
+//
+// The schema is not checked if the database is unavailable, which is
+// reported by the database check.
+func (app *AuthApp) checkSchema() {
+	if app.SchemaExempt == nil {
+		app.SchemaExempt = slices.Clone(DefaultSchemaExempt)
+	}
+
+	sc, ok := app.DB.(schemaChecker)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaCheckTimeout)
+	defer cancel()
+
+	err := sc.CheckSchema(ctx)
+	var mismatch *migrations.MismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		slog.Error("database schema does not match, serving only "+strings.Join(app.SchemaExempt, " "),
+			"err", err, "remedy", mismatch.Remedy())
+		app.schemaErr = err
+	case err != nil:
+		slog.Warn("failed to check database schema", "err", err)
+	}
+}
+
+// SchemaError returns the schema mismatch of the database found when app
+// was created, or nil. It is the "schema" check of app.Checks.
+func (app *AuthApp) SchemaError(ctx context.Context) error {
+	return app.schemaErr
+}
+
+// schemaExempt returns true if the route with pattern, such as
+// "GET /status", is served despite a schema mismatch.
+func (app *AuthApp) schemaExempt(pattern string) bool {
+	_, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		path = pattern
+	}
+
+	return slices.Contains(app.SchemaExempt, path)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webauth/migrations"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// schemaStore is a MemStore with the schema mismatch err.
+type schemaStore struct {
+	*webauth.MemStore
+	err error
+}
+
+func (s schemaStore) CheckSchema(ctx context.Context) error {
+	return s.err
+}
+
+func TestSchemaMismatch(t *testing.T) {
+	mismatch := &migrations.MismatchError{Dialect: "mysql", Pending: []int{28}}
+
+	tests := []struct {
+		name      string
+		err       error
+		loginCode int
+	}{
+		{"match", nil, http.StatusOK},
+		{"mismatch", mismatch, http.StatusServiceUnavailable},
+		{"unavailable", errors.New("connection refused"), http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newAppForTest(t, nil, webauth.WithDB(schemaStore{StoreForTest(t), tc.err}))
+
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			mux := webhandler.NewMux()
+			mux.Handle("GET /login", ok)
+			mux.Handle("/healthz", ok)
+			mux.HandleFunc("/status", app.StatusHandler)
+			app.ManageRoutes(mux)
+
+			serve := func(target string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+				return w
+			}
+
+			if w := serve("/login"); w.Code != tc.loginCode {
+				t.Errorf("status of /login = %d, want %d", w.Code, tc.loginCode)
+			}
+			if w := serve("/healthz"); w.Code != http.StatusOK {
+				t.Errorf("status of /healthz = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			w := serve("/status?format=json")
+			if w.Code != http.StatusOK {
+				t.Errorf("status of /status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if !strings.Contains(w.Body.String(), `"name":"schema"`) {
+				t.Errorf("status has no schema component: %s", w.Body)
+			}
+			schemaHealthy := !strings.Contains(w.Body.String(), `{"name":"schema","healthy":false}`)
+			if want := tc.err != mismatch; schemaHealthy != want {
+				t.Errorf("schema healthy = %v, want %v: %s", schemaHealthy, want, w.Body)
+			}
+
+			wantErr := error(nil)
+			if tc.err == mismatch {
+				wantErr = migrations.ErrSchemaMismatch
+			}
+			if err := app.SchemaError(context.Background()); !errors.Is(err, wantErr) {
+				t.Errorf("SchemaError() = %v, want %v", err, wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Screener scores how suspicious a request is, e.g., by its headers. The
+// scores of the screeners of an AuthApp are added together.
+type Screener interface {
+	// Screen returns the score of r, or zero if r is not suspicious, and
+	// the reason for a positive score.
+	Screen(r *http.Request) (score int, reason string)
+}
+
+// ScreenerFunc is an adapter to use a function as a Screener.
+type ScreenerFunc func(r *http.Request) (int, string)
+
+// Screen calls f(r).
+func (f ScreenerFunc) Screen(r *http.Request) (int, string) {
+	return f(r)
+}
+
+// WithScreener returns an Option to add s to the screeners of the paths
+// of Config.Screen, after those of the config.
+func WithScreener(s Screener) Option {
+	return func(a *AuthApp) {
+		a.Screeners = append(a.Screeners, s)
+	}
+}
+
+// TLSFingerprinter returns the TLS fingerprint of the client of a request,
+// such as a JA3 hash, for Config.Screen.Fingerprints. The fingerprint is
+// computed from the TLS ClientHello, which net/http does not expose, so it
+// is usually set in a header by a proxy or recorded by the GetConfigForClient
+// function of a tls.Config.
+type TLSFingerprinter interface {
+	// Fingerprint returns the fingerprint of r, or "" if it is not known.
+	Fingerprint(r *http.Request) string
+}
+
+// TLSFingerprinterFunc is an adapter to use a function as a
+// TLSFingerprinter.
+type TLSFingerprinterFunc func(r *http.Request) string
+
+// Fingerprint calls f(r).
+func (f TLSFingerprinterFunc) Fingerprint(r *http.Request) string {
+	return f(r)
+}
+
+// WithTLSFingerprinter returns an Option to set the TLSFingerprinter used
+// by Config.Screen.Fingerprints.
+func WithTLSFingerprinter(f TLSFingerprinter) Option {
+	return func(a *AuthApp) {
+		a.Fingerprinter = f
+	}
+}
+
+// Scores of the screeners of Config.Screen.
+const (
+	ScoreUserAgent   = 50  // The User-Agent is missing or matches a pattern.
+	ScoreNoAccept    = 25  // The Accept header is missing.
+	ScoreFingerprint = 100 // The TLS fingerprint is listed.
+)
+
+// DefaultScreenPaths are the paths screened if Config.Screen.Paths is
+// empty, which are those that accept credentials or send email.
+var DefaultScreenPaths = []string{
+	"/login", "/register", "/forgot", "/reset", "/magic", "/confirm_request", APILoginPath,
+}
+
+// ConfigScreen holds the screening of requests to the login and other
+// endpoints that attract abuse. Requests are scored by the screeners in
+// the config and those added by WithScreener. Each request with a positive
+// score is recorded as an event and is refused if its score is at least
+// Block. Otherwise, it is counted against Limit in the windows of
+// Config.RateLimit, so Limit requires Config.RateLimit.
+type ConfigScreen struct {
+	Paths        []string // Paths to screen. If empty, DefaultScreenPaths.
+	UserAgents   []string // UserAgents are regexps of suspicious User-Agents.
+	NoAccept     bool     // NoAccept scores requests without an Accept header.
+	Fingerprints []string // Fingerprints are suspicious TLS fingerprints.
+	Block        int      // Block is the score refused, or 0 to never refuse.
+	Limit        int      // Limit of suspicious requests per client, or 0 for none.
+}
+
+// screenPolicy is the parsed ConfigScreen.
+type screenPolicy struct {
+	paths     []string
+	screeners []Screener
+	block     int
+	limit     int
+}
+
+// parse returns the screenPolicy of c, with the fingerprints of c found by
+// fingerprinter and the extra screeners.
+func (c ConfigScreen) parse(fingerprinter TLSFingerprinter, extra []Screener) (*screenPolicy, error) {
+	if c.Block < 0 {
+		return nil, fmt.Errorf("negative Screen.Block %d", c.Block)
+	}
+	if c.Limit < 0 {
+		return nil, fmt.Errorf("negative Screen.Limit %d", c.Limit)
+	}
+
+	p := &screenPolicy{
+		paths: c.Paths,
+		block: c.Block,
+		limit: c.Limit,
+	}
+	if len(p.paths) == 0 {
+		p.paths = DefaultScreenPaths
+	}
+
+	if len(c.UserAgents) != 0 {
+		patterns := make([]*regexp.Regexp, 0, len(c.UserAgents))
+		for _, s := range c.UserAgents {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Screen.UserAgents %q: %w", s, err)
+			}
+			patterns = append(patterns, re)
+		}
+		p.screeners = append(p.screeners, userAgentScreener(patterns))
+	}
+
+	if c.NoAccept {
+		p.screeners = append(p.screeners, ScreenerFunc(screenNoAccept))
+	}
+
+	if len(c.Fingerprints) != 0 {
+		if fingerprinter == nil {
+			return nil, fmt.Errorf("Screen.Fingerprints without a TLSFingerprinter")
+		}
+		p.screeners = append(p.screeners, fingerprintScreener(fingerprinter, c.Fingerprints))
+	}
+
+	p.screeners = append(p.screeners, extra...)
+
+	return p, nil
+}
+
+// userAgentScreener returns a Screener that scores requests without a
+// User-Agent or with one that matches a pattern.
+func userAgentScreener(patterns []*regexp.Regexp) Screener {
+	return ScreenerFunc(func(r *http.Request) (int, string) {
+		ua := r.UserAgent()
+		if ua == "" {
+			return ScoreUserAgent, "no user agent"
+		}
+		for _, re := range patterns {
+			if re.MatchString(ua) {
+				return ScoreUserAgent, "user agent matches " + re.String()
+			}
+		}
+		return 0, ""
+	})
+}
+
+// screenNoAccept scores requests without an Accept header, which browsers
+// always send.
+func screenNoAccept(r *http.Request) (int, string) {
+	if r.Header.Get("Accept") == "" {
+		return ScoreNoAccept, "no accept header"
+	}
+	return 0, ""
+}
+
+// fingerprintScreener returns a Screener that scores requests with one of
+// the TLS fingerprints found by f.
+func fingerprintScreener(f TLSFingerprinter, fingerprints []string) Screener {
+	return ScreenerFunc(func(r *http.Request) (int, string) {
+		fp := f.Fingerprint(r)
+		if fp != "" && slices.Contains(fingerprints, fp) {
+			return ScoreFingerprint, "tls fingerprint " + fp
+		}
+		return 0, ""
+	})
+}
+
+// ScreenRequest returns the total score of r by the screeners of
+// Config.Screen and the reasons for it.
+func (app *AuthApp) ScreenRequest(r *http.Request) (int, []string) {
+	if app.screen == nil {
+		return 0, nil
+	}
+
+	var (
+		total   int
+		reasons []string
+	)
+	for _, s := range app.screen.screeners {
+		score, reason := s.Screen(r)
+		if score > 0 {
+			total += score
+			reasons = append(reasons, reason)
+		}
+	}
+
+	return total, reasons
+}
+
+// isScreened returns true if the path of r is screened.
+func (app *AuthApp) isScreened(r *http.Request) bool {
+	return app.screen != nil && len(app.screen.screeners) != 0 &&
+		slices.Contains(app.screen.paths, r.URL.Path)
+}
+
+// screenQuota is a webhandler.QuotaFunc that counts suspicious requests
+// against Config.Screen.Limit by client address in the windows of
+// Config.RateLimit.
+func (app *AuthApp) screenQuota(r *http.Request) (webhandler.Quota, bool, error) {
+	if app.screen.limit == 0 {
+		return webhandler.Quota{}, false, nil
+	}
+
+	window := app.rateLimitWindow(app.Clock.Now())
+	requests, err := app.DB.CountRequest("screen:"+remoteHost(r), window)
+	if err != nil {
+		return webhandler.Quota{}, false, err
+	}
+
+	return webhandler.Quota{
+		Limit:     app.screen.limit,
+		Remaining: app.screen.limit - requests,
+		Reset:     window.Add(app.rateLimit.window),
+	}, true, nil
+}
+
+// Screen returns middleware that screens requests to the paths of
+// Config.Screen before next. A suspicious request is logged and recorded
+// as an event, and is refused with http.StatusForbidden if its score is at
+// least Config.Screen.Block. Otherwise, it is counted against
+// Config.Screen.Limit.
+func (app *AuthApp) Screen(next http.Handler) http.Handler {
+	limited := http.Handler(next)
+	if app.screen != nil {
+		limited = webhandler.RateLimit(next, app.screenQuota)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isScreened(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		score, reasons := app.ScreenRequest(r)
+		if score == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		blocked := app.screen.block > 0 && score >= app.screen.block
+
+		webhandler.RequestLogger(r).Warn("suspicious request",
+			"score", score, "reasons", reasons, "blocked", blocked)
+
+		app.DB.RecordEvent(NewEvent(TypeScreen, "", EventDetails{
+			"score":   strconv.Itoa(score),
+			"path":    r.URL.Path,
+			"reasons": strings.Join(reasons, ", "),
+		}))
+
+		if blocked {
+			app.Audit(r, audit.Entry{
+				Action:   AuditScreen,
+				Target:   r.URL.Path,
+				Result:   audit.Denied,
+				Metadata: audit.Metadata{"score": fmt.Sprint(score), "reasons": strings.Join(reasons, ", ")},
+			})
+			webutil.Error(w, r, http.StatusForbidden, "", "")
+			return
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withScreen returns a config modifier that sets the request screening
+// and an API rate limit for its windows.
+func withScreen(screen webauth.ConfigScreen) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Screen = screen
+		cfg.RateLimit = webauth.ConfigRateLimit{Limit: 100, Window: "1h"}
+	}
+}
+
+func TestConfigScreen(t *testing.T) {
+	tests := []struct {
+		name          string
+		screen        webauth.ConfigScreen
+		rateLimit     webauth.ConfigRateLimit
+		fingerprinter webauth.TLSFingerprinter
+		wantErr       error
+	}{
+		{name: "empty"},
+		{name: "userAgents", screen: webauth.ConfigScreen{UserAgents: []string{"(?i)curl|python"}, Block: 50}},
+		{name: "badUserAgent", screen: webauth.ConfigScreen{UserAgents: []string{"("}}, wantErr: webauth.ErrInvalidConfig},
+		{name: "negativeBlock", screen: webauth.ConfigScreen{Block: -1}, wantErr: webauth.ErrInvalidConfig},
+		{name: "limit", screen: webauth.ConfigScreen{NoAccept: true, Limit: 5}, rateLimit: webauth.ConfigRateLimit{Limit: 10, Window: "1m"}},
+		{name: "limitNoRateLimit", screen: webauth.ConfigScreen{NoAccept: true, Limit: 5}, wantErr: webauth.ErrInvalidConfig},
+		{name: "negativeLimit", screen: webauth.ConfigScreen{Limit: -1}, wantErr: webauth.ErrInvalidConfig},
+		{
+			name:          "fingerprints",
+			screen:        webauth.ConfigScreen{Fingerprints: []string{"abc"}},
+			fingerprinter: webauth.TLSFingerprinterFunc(func(*http.Request) string { return "" }),
+		},
+		{name: "fingerprintsNoFingerprinter", screen: webauth.ConfigScreen{Fingerprints: []string{"abc"}}, wantErr: webauth.ErrInvalidConfig},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("LoadConfigFromJSON() failed: %v", err)
+			}
+			cfg.Screen = tc.screen
+			cfg.RateLimit = tc.rateLimit
+
+			opts := []interface{}{webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg)}
+			if tc.fingerprinter != nil {
+				opts = append(opts, webauth.WithTLSFingerprinter(tc.fingerprinter))
+			}
+
+			_, err = webauth.NewApp(opts...)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScreen(t *testing.T) {
+	store := StoreForTest(t)
+	fingerprinter := webauth.TLSFingerprinterFunc(func(r *http.Request) string {
+		return r.Header.Get("X-JA3")
+	})
+	custom := webauth.ScreenerFunc(func(r *http.Request) (int, string) {
+		if r.URL.Query().Has("bot") {
+			return 10, "bot query"
+		}
+		return 0, ""
+	})
+	app := newAppForTest(t,
+		[]func(*webauth.Config){withScreen(webauth.ConfigScreen{
+			UserAgents:   []string{"(?i)sqlmap"},
+			NoAccept:     true,
+			Fingerprints: []string{"bad-ja3"},
+			Block:        webauth.ScoreUserAgent,
+			Limit:        2,
+		})},
+		webauth.WithDB(store), webauth.WithTLSFingerprinter(fingerprinter), webauth.WithScreener(custom))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := app.Screen(next)
+
+	serve := func(target, addr string, header http.Header) int {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		r.RemoteAddr = addr + ":1234"
+		r.Header = header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	browser := http.Header{"User-Agent": {"Mozilla/5.0"}, "Accept": {"text/html"}}
+
+	tests := []struct {
+		name   string
+		target string
+		addr   string
+		header http.Header
+		want   int
+	}{
+		{"browser", "/login", "203.0.113.1", browser, http.StatusNoContent},
+		{"notScreened", "/status", "203.0.113.2", http.Header{}, http.StatusNoContent},
+		{"userAgent", "/login", "203.0.113.3", http.Header{"User-Agent": {"sqlmap/1.7"}, "Accept": {"*/*"}}, http.StatusForbidden},
+		{"noUserAgent", "/register", "203.0.113.3", http.Header{"Accept": {"*/*"}}, http.StatusForbidden},
+		{"fingerprint", "/login", "203.0.113.3", http.Header{"User-Agent": {"Mozilla/5.0"}, "Accept": {"*/*"}, "X-Ja3": {"bad-ja3"}}, http.StatusForbidden},
+		{"custom", "/login?bot", "203.0.113.4", browser, http.StatusNoContent},
+		{"noAccept", "/login", "203.0.113.4", http.Header{"User-Agent": {"Mozilla/5.0"}}, http.StatusNoContent},
+		{"limited", "/login", "203.0.113.4", http.Header{"User-Agent": {"Mozilla/5.0"}}, http.StatusTooManyRequests},
+		{"limitedClean", "/login", "203.0.113.4", browser, http.StatusNoContent},
+	}
+
+	for _, tc := range tests {
+		if got := serve(tc.target, tc.addr, tc.header); got != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// Each suspicious request is recorded as an event.
+	events, err := store.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() failed: %v", err)
+	}
+	var screened []string
+	for _, e := range events {
+		if e.Name == webauth.EventScreen {
+			screened = append(screened, e.Message)
+		}
+	}
+	if len(screened) != 6 {
+		t.Errorf("screen events = %q, want 6", screened)
+	}
+	if !containsPrefix(screened, "score 10 at /login: bot query") {
+		t.Errorf("screen events = %q, want custom screener", screened)
+	}
+
+	// Blocked requests are audited.
+	entries, _, err := store.AuditEntries(audit.Filter{Action: webauth.AuditScreen, Result: audit.Denied})
+	if err != nil {
+		t.Fatalf("AuditEntries() failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("AuditEntries() = %+v, want 3 blocked requests", entries)
+	}
+}
+
+// containsPrefix returns true if a string of s starts with prefix.
+func containsPrefix(s []string, prefix string) bool {
+	for _, v := range s {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+	return false
+}
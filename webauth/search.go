@@ -0,0 +1,398 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	SearchTmpl = "admin_search.html"
+
+	SearchLimit        = 20                  // SearchLimit is the maximum results of each kind.
+	SearchEventsWindow = 30 * 24 * time.Hour // SearchEventsWindow is how far back events are searched.
+	MaxSearchTerms     = 5                   // MaxSearchTerms is the number of words of a query used.
+)
+
+// SearchStore searches users and events for the admin search. A user
+// matches if each term is in the username, full name, or email, and an
+// event matches if each term is in the message. Users are returned with
+// exact and prefix matches of the username first, and events newest
+// first.
+type SearchStore interface {
+	SearchUsers(terms []string, limit int) ([]User, error)
+	SearchEvents(terms []string, since time.Time, limit int) ([]Event, error)
+
+	// EventsSince and EventsByID read events for a SearchIndex.
+	EventsSince(since time.Time, limit int) ([]Event, error)
+	EventsByID(ids []string) ([]Event, error)
+}
+
+// SearchKind is the kind of a SearchResult.
+type SearchKind string
+
+const (
+	SearchUser  SearchKind = "user"
+	SearchEvent SearchKind = "event"
+)
+
+// SearchResult is a user or event that matches a search.
+type SearchResult struct {
+	Kind  SearchKind
+	User  User  // User is set if Kind is SearchUser.
+	Event Event // Event is set if Kind is SearchEvent.
+	Score int   // Score ranks the result; higher is better.
+}
+
+// SearchTerms returns the lowercase words of q, up to MaxSearchTerms.
+func SearchTerms(q string) []string {
+	terms := strings.Fields(strings.ToLower(q))
+
+	return terms[:min(len(terms), MaxSearchTerms)]
+}
+
+// Search returns the users, and the recent events if events is true, that
+// match the terms of q, ranked by score. Users rank before events of the
+// same score, and events by recency. Events are found with the search
+// index if Config.Search.Index is true.
+func (app *AuthApp) Search(ctx context.Context, q string, events bool) ([]SearchResult, error) {
+	terms := SearchTerms(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	users, err := app.DB.SearchUsers(terms, SearchLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(users))
+	for _, u := range users {
+		results = append(results, SearchResult{Kind: SearchUser, User: u, Score: userScore(u, terms)})
+	}
+
+	if events {
+		since := app.Clock.Now().Add(-SearchEventsWindow)
+
+		var found []Event
+		if app.Cfg.Search.Index {
+			found, err = app.searchIndexedEvents(ctx, terms, since)
+		} else {
+			found, err = app.DB.SearchEvents(terms, since, SearchLimit)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range found {
+			results = append(results, SearchResult{Kind: SearchEvent, Event: e, Score: eventScore(e, terms)})
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if a.Kind != b.Kind {
+			return strings.Compare(string(b.Kind), string(a.Kind)) // Users first.
+		}
+		return b.Event.Created.Compare(a.Event.Created)
+	})
+
+	return results, nil
+}
+
+// userScore returns the score of u for terms. A term scores by the best
+// field it matches: the whole username, the whole email, the start of the
+// username or email, the start of a word of the full name, or elsewhere.
+func userScore(u User, terms []string) int {
+	username := strings.ToLower(u.Username)
+	email := strings.ToLower(u.Email)
+	fullName := strings.ToLower(u.FullName)
+
+	var score int
+	for _, term := range terms {
+		switch {
+		case username == term:
+			score += 100
+		case email == term:
+			score += 90
+		case strings.HasPrefix(username, term):
+			score += 60
+		case strings.HasPrefix(email, term):
+			score += 50
+		case hasWordPrefix(fullName, term):
+			score += 40
+		default:
+			score += 20
+		}
+	}
+
+	return score
+}
+
+// eventScore returns the score of e for terms, which is less than that of
+// users, so people are found before what happened to them. Events of a
+// user named by a term score higher.
+func eventScore(e Event, terms []string) int {
+	message := strings.ToLower(e.Message)
+
+	var score int
+	for _, term := range terms {
+		if hasWordPrefix(message, term) {
+			score += 15
+		} else {
+			score += 10
+		}
+		if strings.EqualFold(e.Username, term) {
+			score += 5
+		}
+	}
+
+	return score
+}
+
+// hasWordPrefix returns true if a word of s starts with prefix.
+func hasWordPrefix(s, prefix string) bool {
+	for _, word := range strings.FieldsFunc(s, notWordRune) {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notWordRune returns true if r is not part of a word for full-text
+// search.
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// SearchUsers returns up to limit users that match each of terms.
+func (db *AuthDB) SearchUsers(terms []string, limit int) ([]User, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var (
+		conds []string
+		args  []any
+	)
+	for _, term := range terms {
+		pattern := "%" + likeEscape.Replace(term) + "%"
+		conds = append(conds, "(LOWER(username) LIKE ? ESCAPE '!' OR LOWER(fullName) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!')")
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	// Rank the username of the first term, so the best matches are not
+	// cut by the limit.
+	order := " ORDER BY CASE WHEN LOWER(username) = ? THEN 0 WHEN LOWER(username) LIKE ? ESCAPE '!' THEN 1 ELSE 2 END, username LIMIT " + strconv.Itoa(limit)
+	args = append(args, terms[0], likeEscape.Replace(terms[0])+"%")
+
+	rows, err := db.Query("SELECT id, username, fullName, email, admin, disabled, created FROM users WHERE "+strings.Join(conds, " AND ")+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Disabled, &user.Created)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SearchEvents returns up to limit events created since since whose
+// message matches each of terms, newest first. MySQL and PostgreSQL use
+// the full-text index of the message, which matches words that start with
+// the terms. SQLite matches the terms anywhere in the message of the
+// recent events.
+func (db *AuthDB) SearchEvents(terms []string, since time.Time, limit int) ([]Event, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	match, args := db.Dialect.matchMessage(terms)
+	if match == "" {
+		return nil, nil
+	}
+
+	qry := "SELECT " + eventColumns + " FROM events WHERE created >= ? AND " + match +
+		" ORDER BY created DESC LIMIT " + strconv.Itoa(limit)
+
+	return db.scanEvents(qry, append([]any{since}, args...)...)
+}
+
+// matchMessage returns the condition that the message of an event matches
+// each of terms, and its arguments, or an empty condition if no terms can
+// be matched.
+func (d Dialect) matchMessage(terms []string) (string, []any) {
+	if d == DialectSQLite {
+		var conds []string
+		var args []any
+		for _, term := range terms {
+			conds = append(conds, "LOWER(message) LIKE ? ESCAPE '!'")
+			args = append(args, "%"+likeEscape.Replace(term)+"%")
+		}
+		return strings.Join(conds, " AND "), args
+	}
+
+	words := fullTextWords(terms)
+	if len(words) == 0 {
+		return "", nil
+	}
+
+	if d == DialectPostgres {
+		for i, w := range words {
+			words[i] = w + ":*"
+		}
+		return "to_tsvector('simple', message) @@ to_tsquery('simple', ?)", []any{strings.Join(words, " & ")}
+	}
+
+	for i, w := range words {
+		words[i] = "+" + w + "*"
+	}
+	return "MATCH (message) AGAINST (? IN BOOLEAN MODE)", []any{strings.Join(words, " ")}
+}
+
+// SearchUsers returns up to limit users that match each of terms.
+func (m *MemStore) SearchUsers(terms []string, limit int) ([]User, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	users, err := m.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	users = slices.DeleteFunc(users, func(u User) bool {
+		fields := strings.ToLower(u.Username + "\n" + u.FullName + "\n" + u.Email)
+		for _, term := range terms {
+			if !strings.Contains(fields, term) {
+				return true
+			}
+		}
+		return false
+	})
+
+	// rank orders users like the ORDER BY of AuthDB.SearchUsers.
+	rank := func(u User) int {
+		username := strings.ToLower(u.Username)
+		switch {
+		case username == terms[0]:
+			return 0
+		case strings.HasPrefix(username, terms[0]):
+			return 1
+		}
+		return 2
+	}
+	slices.SortStableFunc(users, func(a, b User) int {
+		if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+	})
+
+	return users[:min(limit, len(users))], nil
+}
+
+// SearchEvents returns up to limit events created since since whose
+// message contains each of terms, newest first.
+func (m *MemStore) SearchEvents(terms []string, since time.Time, limit int) ([]Event, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.sortedEvents(func(e memEvent) bool {
+		if e.Created.Before(since) {
+			return false
+		}
+		message := strings.ToLower(e.Message)
+		for _, term := range terms {
+			if !strings.Contains(message, term) {
+				return false
+			}
+		}
+		return true
+	})
+
+	return events[:min(limit, len(events))], nil
+}
+
+// SearchPageData contains data to render the search template.
+type SearchPageData struct {
+	CommonData
+	User    User
+	Query   string
+	Results []SearchResult
+	Events  bool // Events is true if events were searched.
+}
+
+// AdminSearchHandler searches users and, for users that can view them,
+// recent events for the q parameter, and shows the ranked results.
+func (app *AuthApp) AdminSearchHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	if !user.Can(PermViewUsers) {
+		logger.Warn("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	events := user.Can(PermViewEvents)
+
+	results, err := app.Search(r.Context(), q, events)
+	if err != nil {
+		logger.Error("failed to search", "q", q, "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := &SearchPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Query:      q,
+		Results:    results,
+		Events:     events,
+	}
+
+	app.RenderPage(w, r, logger, SearchTmpl, data)
+
+	logger.Info("done", "q", q, "results", len(results))
+}
@@ -0,0 +1,515 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchDoc is a document in a SearchIndex, such as an event or a page of
+// the app.
+type SearchDoc struct {
+	Kind    SearchKind // Kind groups documents, such as SearchEvent.
+	ID      string     // ID is unique within Kind.
+	Text    string     // Text is the searched text.
+	Created time.Time  // Created bounds searches by SearchQuery.Since.
+}
+
+// SearchQuery selects documents of a SearchIndex.
+type SearchQuery struct {
+	Kind  SearchKind // Kind of the documents.
+	Terms []string   // Terms are lowercase words, each of which must match.
+	Since time.Time  // Since excludes documents created before, if set.
+	Limit int        // Limit is the maximum documents, or SearchLimit if zero.
+}
+
+// SearchHit is a document that matches a SearchQuery.
+type SearchHit struct {
+	Kind SearchKind
+	ID   string
+	Rank float64 // Rank orders hits; higher is better.
+}
+
+// SearchIndex is a full-text index of documents. A term matches the words
+// of the text that start with it, and hits are returned best first.
+//
+// AuthDB indexes documents in the search_docs table, which is an FTS5
+// table on SQLite, and has a FULLTEXT index on MySQL and a GIN index on
+// PostgreSQL. SQLite drivers must be built with FTS5, which
+// modernc.org/sqlite is, and mattn/go-sqlite3 is with the sqlite_fts5
+// build tag.
+type SearchIndex interface {
+	// IndexDocs adds docs, replacing those with the same Kind and ID.
+	IndexDocs(ctx context.Context, docs ...SearchDoc) error
+
+	// DeleteDocs removes the documents of kind with ids.
+	DeleteDocs(ctx context.Context, kind SearchKind, ids ...string) error
+
+	// SearchDocs returns the documents that match q.
+	SearchDocs(ctx context.Context, q SearchQuery) ([]SearchHit, error)
+
+	// LastIndexed returns when the newest document of kind was created,
+	// or the zero time if there are none.
+	LastIndexed(ctx context.Context, kind SearchKind) (time.Time, error)
+}
+
+// ConfigSearch holds settings for the full-text search index.
+type ConfigSearch struct {
+	// Index enables the background indexer of events, and the admin
+	// search of events with the index instead of the events table.
+	Index bool
+
+	// Interval is how often new events are indexed, such as "30s". If
+	// empty, DefaultSearchIndexInterval is used.
+	Interval string
+}
+
+const (
+	// DefaultSearchIndexInterval is how often new events are indexed if
+	// Config.Search.Interval is empty.
+	DefaultSearchIndexInterval = time.Minute
+
+	// SearchIndexBatch is the maximum events indexed at once.
+	SearchIndexBatch = 500
+)
+
+// parse returns the interval of c.
+func (c ConfigSearch) parse() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultSearchIndexInterval, nil
+	}
+
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid Search.Interval %q", c.Interval)
+	}
+
+	return d, nil
+}
+
+// IndexEvents adds the events created since the newest indexed event to
+// the search index, up to SearchIndexBatch, and returns the number added.
+// Events created at the same time as the newest indexed event are indexed
+// again, so none are missed. Events without an ID are not indexed.
+func (app *AuthApp) IndexEvents(ctx context.Context) (int, error) {
+	since, err := app.DB.LastIndexed(ctx, SearchEvent)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := app.DB.EventsSince(since, SearchIndexBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	docs := make([]SearchDoc, 0, len(events))
+	for _, e := range events {
+		if e.ID == "" {
+			continue
+		}
+		docs = append(docs, SearchDoc{
+			Kind:    SearchEvent,
+			ID:      e.ID,
+			Text:    e.Username + " " + e.Message,
+			Created: e.Created,
+		})
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	return len(docs), app.DB.IndexDocs(ctx, docs...)
+}
+
+// RunSearchIndexer indexes new events every Config.Search.Interval until
+// ctx is done, if Config.Search.Index is true. A full batch is followed
+// by another at once, to catch up after a restart.
+func (app *AuthApp) RunSearchIndexer(ctx context.Context) {
+	if !app.Cfg.Search.Index {
+		return
+	}
+
+	ticker := time.NewTicker(app.searchInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.IndexEvents(ctx)
+		if err != nil {
+			slog.Error("failed to index events", "err", err)
+		}
+
+		if err != nil || n < SearchIndexBatch {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// searchIndexedEvents returns the events created since since that match
+// terms in the search index, best first.
+func (app *AuthApp) searchIndexedEvents(ctx context.Context, terms []string, since time.Time) ([]Event, error) {
+	hits, err := app.DB.SearchDocs(ctx, SearchQuery{Kind: SearchEvent, Terms: terms, Since: since})
+	if err != nil || len(hits) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+
+	events, err := app.DB.EventsByID(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the order of the hits.
+	slices.SortStableFunc(events, func(a, b Event) int {
+		return cmp.Compare(slices.Index(ids, a.ID), slices.Index(ids, b.ID))
+	})
+
+	return events, nil
+}
+
+// fullTextWords returns the words of terms with only letters and digits,
+// so they cannot contain operators of full-text query syntax.
+func fullTextWords(terms []string) []string {
+	var words []string
+	for _, term := range terms {
+		words = append(words, strings.FieldsFunc(term, notWordRune)...)
+	}
+
+	return words
+}
+
+// fullTextQuery returns the condition that the body of a document in
+// search_docs matches each of words, the expression that ranks it, and
+// the arguments of the rank and then the condition.
+func (d Dialect) fullTextQuery(words []string) (match, rank string, args []any) {
+	q := make([]string, len(words))
+
+	switch d {
+	case DialectSQLite:
+		for i, w := range words {
+			q[i] = `"` + w + `"*`
+		}
+		// bm25 is lower for better matches.
+		return "search_docs MATCH ?", "-bm25(search_docs)", []any{strings.Join(q, " AND ")}
+
+	case DialectPostgres:
+		for i, w := range words {
+			q[i] = w + ":*"
+		}
+		query := strings.Join(q, " & ")
+		return "to_tsvector('simple', body) @@ to_tsquery('simple', ?)",
+			"ts_rank(to_tsvector('simple', body), to_tsquery('simple', ?))",
+			[]any{query, query}
+
+	default:
+		for i, w := range words {
+			q[i] = "+" + w + "*"
+		}
+		query := strings.Join(q, " ")
+		return "MATCH (body) AGAINST (? IN BOOLEAN MODE)",
+			"MATCH (body) AGAINST (? IN BOOLEAN MODE)",
+			[]any{query, query}
+	}
+}
+
+// IndexDocs adds docs to the search_docs table, replacing those with the
+// same Kind and ID.
+func (db *AuthDB) IndexDocs(ctx context.Context, docs ...SearchDoc) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// An FTS5 table has no primary key to upsert on, so each document is
+	// deleted and inserted.
+	for _, doc := range docs {
+		_, err = tx.ExecContext(ctx, db.Rebind("DELETE FROM search_docs WHERE kind = ? AND id = ?"), doc.Kind, doc.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, db.Rebind("INSERT INTO search_docs(kind, id, body, created) VALUES (?, ?, ?, ?)"),
+			db.Dialect.bindArgs([]any{doc.Kind, doc.ID, doc.Text, doc.Created})...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteDocs removes the documents of kind with ids from the search_docs
+// table.
+func (db *AuthDB) DeleteDocs(ctx context.Context, kind SearchKind, ids ...string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []any{kind}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	qry := "DELETE FROM search_docs WHERE kind = ? AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	_, err := db.ExecContext(ctx, qry, args...)
+
+	return err
+}
+
+// SearchDocs returns the documents of the search_docs table that match q,
+// best first.
+func (db *AuthDB) SearchDocs(ctx context.Context, q SearchQuery) ([]SearchHit, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	words := fullTextWords(q.Terms)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = SearchLimit
+	}
+
+	match, rank, args := db.Dialect.fullTextQuery(words)
+
+	qry := "SELECT id, " + rank + " AS score FROM search_docs WHERE " + match +
+		" AND kind = ? AND created >= ? ORDER BY score DESC, created DESC LIMIT " + strconv.Itoa(limit)
+	args = append(args, q.Kind, q.Since)
+
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		hit := SearchHit{Kind: q.Kind}
+		if err := rows.Scan(&hit.ID, &hit.Rank); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// LastIndexed returns when the newest document of kind in the search_docs
+// table was created, or the zero time if there are none.
+func (db *AuthDB) LastIndexed(ctx context.Context, kind SearchKind) (time.Time, error) {
+	if db == nil {
+		return time.Time{}, ErrInvalidDB
+	}
+
+	var last any
+	err := db.QueryRowContext(ctx, "SELECT MAX(created) FROM search_docs WHERE kind = ?", kind).Scan(&last)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// FTS5 columns have no type, so SQLite returns the time as text.
+	switch v := last.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return time.ParseInLocation(sqliteTimeFormat, v, time.UTC)
+	case []byte:
+		return time.ParseInLocation(sqliteTimeFormat, string(v), time.UTC)
+	}
+
+	return time.Time{}, nil
+}
+
+// EventsSince returns up to limit events created at or after since,
+// oldest first.
+func (db *AuthDB) EventsSince(since time.Time, limit int) ([]Event, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := "SELECT " + eventColumns + " FROM events WHERE created >= ? ORDER BY created LIMIT " + strconv.Itoa(limit)
+
+	return db.scanEvents(qry, since)
+}
+
+// EventsByID returns the events with ids, in no order.
+func (db *AuthDB) EventsByID(ids []string) ([]Event, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	qry := "SELECT " + eventColumns + " FROM events WHERE id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+
+	return db.scanEvents(qry, args...)
+}
+
+// memDocKey is the key of a document in a MemStore.
+type memDocKey struct {
+	kind SearchKind
+	id   string
+}
+
+// IndexDocs adds docs, replacing those with the same Kind and ID.
+func (m *MemStore) IndexDocs(_ context.Context, docs ...SearchDoc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.docs == nil {
+		m.docs = make(map[memDocKey]SearchDoc)
+	}
+	for _, doc := range docs {
+		m.docs[memDocKey{doc.Kind, doc.ID}] = doc
+	}
+
+	return nil
+}
+
+// DeleteDocs removes the documents of kind with ids.
+func (m *MemStore) DeleteDocs(_ context.Context, kind SearchKind, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		delete(m.docs, memDocKey{kind, id})
+	}
+
+	return nil
+}
+
+// SearchDocs returns the documents that match q, ranked by the number of
+// words that start with a term.
+func (m *MemStore) SearchDocs(_ context.Context, q SearchQuery) ([]SearchHit, error) {
+	terms := fullTextWords(q.Terms)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = SearchLimit
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	type hit struct {
+		SearchHit
+		created time.Time
+	}
+	var hits []hit
+
+	for _, doc := range m.docs {
+		if doc.Kind != q.Kind || doc.Created.Before(q.Since) {
+			continue
+		}
+
+		words := strings.FieldsFunc(strings.ToLower(doc.Text), notWordRune)
+		var rank float64
+		for _, term := range terms {
+			n := 0
+			for _, w := range words {
+				if strings.HasPrefix(w, term) {
+					n++
+				}
+			}
+			if n == 0 {
+				rank = 0
+				break
+			}
+			rank += float64(n)
+		}
+		if rank > 0 {
+			hits = append(hits, hit{SearchHit{doc.Kind, doc.ID, rank}, doc.Created})
+		}
+	}
+
+	slices.SortFunc(hits, func(a, b hit) int {
+		if c := cmp.Compare(b.Rank, a.Rank); c != 0 {
+			return c
+		}
+		return b.created.Compare(a.created)
+	})
+
+	result := make([]SearchHit, 0, min(limit, len(hits)))
+	for _, h := range hits[:min(limit, len(hits))] {
+		result = append(result, h.SearchHit)
+	}
+
+	return result, nil
+}
+
+// LastIndexed returns when the newest document of kind was created, or
+// the zero time if there are none.
+func (m *MemStore) LastIndexed(_ context.Context, kind SearchKind) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var last time.Time
+	for _, doc := range m.docs {
+		if doc.Kind == kind && doc.Created.After(last) {
+			last = doc.Created
+		}
+	}
+
+	return last, nil
+}
+
+// EventsSince returns up to limit events created at or after since,
+// oldest first.
+func (m *MemStore) EventsSince(since time.Time, limit int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := m.sortedEvents(func(e memEvent) bool {
+		return !e.Created.Before(since)
+	})
+	slices.Reverse(events)
+
+	return events[:min(limit, len(events))], nil
+}
+
+// EventsByID returns the events with ids, in no order.
+func (m *MemStore) EventsByID(ids []string) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedEvents(func(e memEvent) bool {
+		return e.ID != "" && slices.Contains(ids, e.ID)
+	}), nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// testSearchIndex tests the SearchIndex of store, which must not have
+// documents of the kind "test".
+func testSearchIndex(t *testing.T, store webauth.AuthStore) {
+	ctx := context.Background()
+	const kind webauth.SearchKind = "test"
+	now := time.Now().UTC().Truncate(time.Second)
+
+	docs := []webauth.SearchDoc{
+		{Kind: kind, ID: "1", Text: "password reset requested", Created: now.Add(-3 * time.Hour)},
+		{Kind: kind, ID: "2", Text: "password changed, password strong", Created: now.Add(-2 * time.Hour)},
+		{Kind: kind, ID: "3", Text: "logged in", Created: now.Add(-time.Hour)},
+		{Kind: kind, ID: "4", Text: "password expired", Created: now.Add(-48 * time.Hour)},
+	}
+	if err := store.IndexDocs(ctx, docs...); err != nil {
+		t.Fatalf("IndexDocs() error = %v", err)
+	}
+	t.Cleanup(func() { store.DeleteDocs(ctx, kind, "1", "2", "3", "4") })
+
+	// Replace a document.
+	docs[2].Text = "logged out"
+	if err := store.IndexDocs(ctx, docs[2]); err != nil {
+		t.Fatalf("IndexDocs() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		terms []string
+		since time.Time
+		want  []string
+	}{
+		{"prefix", []string{"pass"}, now.Add(-24 * time.Hour), []string{"2", "1"}},
+		{"all", []string{"pass", "reset"}, time.Time{}, []string{"1"}},
+		{"replaced", []string{"out"}, time.Time{}, []string{"3"}},
+		{"old", []string{"expired"}, now.Add(-24 * time.Hour), nil},
+		{"operators", []string{`"*+-`}, time.Time{}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			hits, err := store.SearchDocs(ctx, webauth.SearchQuery{Kind: kind, Terms: tc.terms, Since: tc.since})
+			if err != nil {
+				t.Fatalf("SearchDocs() error = %v", err)
+			}
+
+			var got []string
+			for _, h := range hits {
+				got = append(got, h.ID)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SearchDocs(%q) = %q, want %q", tc.terms, got, tc.want)
+			}
+		})
+	}
+
+	last, err := store.LastIndexed(ctx, kind)
+	if err != nil || !last.Equal(docs[2].Created) {
+		t.Errorf("LastIndexed() = %v, %v, want %v", last, err, docs[2].Created)
+	}
+
+	if err := store.DeleteDocs(ctx, kind, "1"); err != nil {
+		t.Fatalf("DeleteDocs() error = %v", err)
+	}
+	hits, err := store.SearchDocs(ctx, webauth.SearchQuery{Kind: kind, Terms: []string{"reset"}})
+	if err != nil || len(hits) != 0 {
+		t.Errorf("SearchDocs() after delete = %v, %v, want none", hits, err)
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	testSearchIndex(t, webauth.NewMemStore())
+}
+
+func TestSearchIndexDB(t *testing.T) {
+	testSearchIndex(t, DBForTest(t))
+}
+
+func TestIndexEvents(t *testing.T) {
+	store := StoreForTest(t)
+	store.AddEvent(webauth.Event{
+		ID:       "01",
+		Name:     webauth.EventLogin,
+		Username: "test",
+		Message:  "account locked after failures",
+		Created:  time.Now(),
+	})
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		cfg.Search.Index = true
+	}}, webauth.WithDB(store))
+
+	ctx := context.Background()
+
+	// Events are not found until they are indexed.
+	results, err := app.Search(ctx, "locked", true)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("Search() before indexing = %+v, %v, want none", results, err)
+	}
+
+	n, err := app.IndexEvents(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("IndexEvents() = %d, %v, want 1 event with an ID", n, err)
+	}
+
+	results, err = app.Search(ctx, "locked", true)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Kind != webauth.SearchEvent || results[0].Event.ID != "01" {
+		t.Errorf("Search() = %+v, want indexed event", results)
+	}
+
+	// Indexing again only adds the events at or after the newest.
+	if n, err = app.IndexEvents(ctx); err != nil || n != 1 {
+		t.Errorf("IndexEvents() again = %d, %v, want 1", n, err)
+	}
+}
+
+func TestConfigSearchInvalid(t *testing.T) {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	cfg.Search.Interval = "often"
+
+	_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+	if !errors.Is(err, webauth.ErrInvalidConfig) {
+		t.Errorf("NewApp() error = %v, want %v", err, webauth.ErrInvalidConfig)
+	}
+}
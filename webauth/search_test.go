@@ -0,0 +1,165 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", []string{}},
+		{"  Admin  ", []string{"admin"}},
+		{"a b c d e f g", []string{"a", "b", "c", "d", "e"}},
+	}
+
+	for _, tc := range tests {
+		if got := webauth.SearchTerms(tc.q); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SearchTerms(%q) = %q, want %q", tc.q, got, tc.want)
+		}
+	}
+}
+
+// testSearchStore tests the SearchStore of store, which has the test data.
+func testSearchStore(t *testing.T, store webauth.AuthStore) {
+	tests := []struct {
+		name  string
+		terms []string
+		want  []string
+	}{
+		{"exactFirst", []string{"confirmed"}, []string{"confirmed", "unconfirmed"}},
+		{"fullName", []string{"expired", "token"}, []string{"expired"}},
+		{"email", []string{"admin@"}, []string{"admin"}},
+		{"wildcard", []string{"%"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			users, err := store.SearchUsers(tc.terms, webauth.SearchLimit)
+			if err != nil {
+				t.Fatalf("SearchUsers() error = %v", err)
+			}
+
+			var got []string
+			for _, u := range users {
+				got = append(got, u.Username)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SearchUsers(%q) = %q, want %q", tc.terms, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchStore(t *testing.T) {
+	testSearchStore(t, StoreForTest(t))
+}
+
+func TestSearchStoreDB(t *testing.T) {
+	testSearchStore(t, DBForTest(t))
+}
+
+func TestMemStoreSearchEvents(t *testing.T) {
+	store := webauth.NewMemStore()
+	now := time.Now()
+	messages := []struct {
+		message string
+		age     time.Duration
+	}{
+		{"password reset requested", time.Hour},
+		{"password changed", 2 * time.Hour},
+		{"password changed long ago", 60 * 24 * time.Hour},
+		{"logged in", time.Minute},
+	}
+	for _, m := range messages {
+		store.AddEvent(webauth.Event{Name: webauth.EventLogin, Message: m.message, Created: now.Add(-m.age)})
+	}
+
+	events, err := store.SearchEvents([]string{"password"}, now.Add(-webauth.SearchEventsWindow), 1)
+	if err != nil {
+		t.Fatalf("SearchEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Message != "password reset requested" {
+		t.Errorf("SearchEvents() = %+v, want newest password event", events)
+	}
+
+	events, err = store.SearchEvents([]string{"password", "changed"}, now.Add(-webauth.SearchEventsWindow), webauth.SearchLimit)
+	if err != nil {
+		t.Fatalf("SearchEvents() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Message != "password changed" {
+		t.Errorf("SearchEvents() = %+v, want recent event with both terms", events)
+	}
+}
+
+func TestAdminSearchHandler(t *testing.T) {
+	store := StoreForTest(t)
+	store.AddEvent(webauth.Event{
+		Name:     webauth.EventLogin,
+		Username: "confirmed",
+		Message:  "confirmed user locked out",
+		Created:  time.Now(),
+	})
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	testToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login test: %v", err)
+	}
+
+	w := requestAs(app.AdminSearchHandler, testToken.Value, http.MethodGet, "/admin/search?q=admin", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status for non-admin = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = requestAs(app.AdminSearchHandler, adminToken.Value, http.MethodGet, "/admin/search?q=Confirmed", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+
+	// The exact username ranks first, then the other user, then the event.
+	exact := strings.Index(body, `<a href="/users?q=confirmed">`)
+	other := strings.Index(body, `<a href="/users?q=unconfirmed">`)
+	event := strings.Index(body, "confirmed user locked out")
+	if exact < 0 || other < 0 || event < 0 || !(exact < other && other < event) {
+		t.Errorf("results not ranked: exact %d, other %d, event %d", exact, other, event)
+	}
+
+	w = requestAs(app.AdminSearchHandler, adminToken.Value, http.MethodGet, "/admin/search?q=nobody", "")
+	if !strings.Contains(w.Body.String(), "No results") {
+		t.Errorf("body missing no results message")
+	}
+}
+
+func TestAdminSearchRank(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	results, err := app.Search(context.Background(), "test", false)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) == 0 || results[0].User.Username != "test" || results[0].Kind != webauth.SearchUser {
+		t.Fatalf("Search() = %+v, want user test first", results)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results not sorted by score: %+v", results)
+		}
+	}
+}
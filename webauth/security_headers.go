@@ -0,0 +1,128 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// referrerPolicies are the valid values of Security.ReferrerPolicy.
+var referrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
+}
+
+// FrameOptionsNone omits X-Frame-Options, such as when the frame-ancestors
+// directive of Content-Security-Policy is used instead.
+const FrameOptionsNone = "none"
+
+// headerToken returns an error if s cannot be a directive, source, or
+// feature of a header, since it would change the other parts of the header.
+func headerToken(field, s string) error {
+	if s == "" || strings.ContainsAny(s, ";,\"\r\n\t ") {
+		return fmt.Errorf("invalid %s %q", field, s)
+	}
+	return nil
+}
+
+// securityHeaders returns the security headers of c and csp, which are
+// those of webhandler.DefaultSecurityHeaders with the changes of the
+// config. Violations of the CSP are reported to CSPReportPath.
+func (c ConfigSecurity) securityHeaders(csp ConfigCSP) (*webhandler.SecurityHeaders, error) {
+	h := webhandler.DefaultSecurityHeaders().CSPReport(CSPReportPath)
+
+	// Sort the directives, so the header does not change between runs.
+	names := make([]string, 0, len(csp.Directives))
+	for name := range csp.Directives {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := headerToken("CSP directive", name); err != nil {
+			return nil, err
+		}
+		for _, src := range csp.Directives[name] {
+			if err := headerToken("CSP source", src); err != nil {
+				return nil, err
+			}
+		}
+		h.CSP(name, csp.Directives[name]...)
+	}
+
+	switch {
+	case c.HSTSMaxAge != "":
+		maxAge, err := time.ParseDuration(c.HSTSMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Security.HSTSMaxAge: %w", err)
+		}
+		if maxAge <= 0 {
+			return nil, fmt.Errorf("non-positive Security.HSTSMaxAge %q", c.HSTSMaxAge)
+		}
+		if c.HSTSPreload && maxAge < webhandler.HSTSPreloadMaxAge {
+			return nil, fmt.Errorf("Security.HSTSMaxAge %q is less than %v required for preload", c.HSTSMaxAge, webhandler.HSTSPreloadMaxAge)
+		}
+		h.HSTS(maxAge, c.HSTSPreload)
+	case c.HSTSPreload:
+		return nil, fmt.Errorf("Security.HSTSPreload requires Security.HSTSMaxAge")
+	case c.Hardened:
+		h.HSTS(webhandler.HSTSPreloadMaxAge, true)
+	}
+
+	if c.ReferrerPolicy != "" && !slices.Contains(referrerPolicies, c.ReferrerPolicy) {
+		return nil, fmt.Errorf("invalid Security.ReferrerPolicy %q", c.ReferrerPolicy)
+	}
+	h.ReferrerPolicy(c.ReferrerPolicy)
+
+	features := make([]string, 0, len(c.PermissionsPolicy))
+	for feature := range c.PermissionsPolicy {
+		features = append(features, feature)
+	}
+	slices.Sort(features)
+
+	for _, feature := range features {
+		if err := headerToken("Permissions-Policy feature", feature); err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(feature, "=()") {
+			return nil, fmt.Errorf("invalid Permissions-Policy feature %q", feature)
+		}
+		for _, origin := range c.PermissionsPolicy[feature] {
+			if err := headerToken("Permissions-Policy origin", origin); err != nil {
+				return nil, err
+			}
+		}
+		h.PermissionsPolicy(feature, c.PermissionsPolicy[feature]...)
+	}
+
+	switch strings.ToUpper(c.FrameOptions) {
+	case "":
+	case webhandler.FrameDeny, webhandler.FrameSameOrigin:
+		h.FrameOptions(strings.ToUpper(c.FrameOptions))
+	case strings.ToUpper(FrameOptionsNone):
+		h.FrameOptions("")
+	default:
+		return nil, fmt.Errorf("invalid Security.FrameOptions %q", c.FrameOptions)
+	}
+
+	return h, nil
+}
+
+// SecurityHeaders is middleware that sets the security headers of
+// Config.Security and Config.CSP on responses.
+func (app *AuthApp) SecurityHeaders(next http.Handler) http.Handler {
+	return app.headers.Handler(next)
+}
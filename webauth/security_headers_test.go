@@ -0,0 +1,93 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	app := AppWithoutDBForTest(t, func(cfg *webauth.Config) {
+		cfg.CSP.Directives = map[string][]string{
+			"script-src": {"'self'", webhandler.CSPNonceSource},
+			"style-src":  {"'self'"},
+		}
+		cfg.Security.HSTSMaxAge = "8760h"
+		cfg.Security.HSTSPreload = true
+		cfg.Security.ReferrerPolicy = "same-origin"
+		cfg.Security.PermissionsPolicy = map[string][]string{
+			"camera":      {},
+			"geolocation": {"self"},
+		}
+		cfg.Security.FrameOptions = "sameorigin"
+	})
+
+	var nonce string
+	h := app.SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = webhandler.CSPNonce(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if nonce == "" {
+		t.Fatal("CSPNonce() is empty")
+	}
+
+	want := map[string]string{
+		"Content-Security-Policy":   "default-src 'self'; style-src 'self'; script-src 'self' 'nonce-" + nonce + "'; report-uri " + webauth.CSPReportPath + "; report-to " + webhandler.CSPReportGroup,
+		"Strict-Transport-Security": "max-age=31536000; includeSubDomains; preload",
+		"Referrer-Policy":           "same-origin",
+		"Permissions-Policy":        "camera=(), geolocation=(self)",
+		"X-Frame-Options":           "SAMEORIGIN",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSecurityHeadersInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*webauth.Config)
+		want   string
+	}{
+		{"directive", func(c *webauth.Config) { c.CSP.Directives = map[string][]string{"script-src; x": {"'self'"}} }, "CSP directive"},
+		{"source", func(c *webauth.Config) { c.CSP.Directives = map[string][]string{"script-src": {"'self'; x"}} }, "CSP source"},
+		{"maxAge", func(c *webauth.Config) { c.Security.HSTSMaxAge = "1 year" }, "HSTSMaxAge"},
+		{"preload", func(c *webauth.Config) { c.Security.HSTSMaxAge, c.Security.HSTSPreload = "1h", true }, "preload"},
+		{"preloadNoMaxAge", func(c *webauth.Config) { c.Security.HSTSPreload = true }, "HSTSPreload"},
+		{"referrer", func(c *webauth.Config) { c.Security.ReferrerPolicy = "never" }, "ReferrerPolicy"},
+		{"feature", func(c *webauth.Config) { c.Security.PermissionsPolicy = map[string][]string{"camera=*": nil} }, "feature"},
+		{"frame", func(c *webauth.Config) { c.Security.FrameOptions = "ALLOW-FROM x" }, "FrameOptions"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			tc.modify(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, webauth.ErrInvalidConfig) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("NewApp() error = %v, want %v with %q", err, webauth.ErrInvalidConfig, tc.want)
+			}
+		})
+	}
+}
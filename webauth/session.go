@@ -0,0 +1,231 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// SessionsTmpl is the name of the sessions HTML template.
+const SessionsTmpl = "sessions.html"
+
+// sessionActivity holds the last activity of login tokens until it is
+// saved, so that requests do not write to the datastore. It is safe for
+// concurrent use.
+type sessionActivity struct {
+	mu   sync.Mutex
+	last map[string]time.Time // last activity by hashed login token.
+}
+
+// record sets the last activity of the login token with hashedValue.
+func (a *sessionActivity) record(hashedValue string, when time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.last == nil {
+		a.last = make(map[string]time.Time)
+	}
+	a.last[hashedValue] = when
+}
+
+// take returns the activity recorded since it was last called.
+func (a *sessionActivity) take() map[string]time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	last := a.last
+	a.last = nil
+	return last
+}
+
+// pending returns the activity of hashedValue that is not yet saved.
+func (a *sessionActivity) pending(hashedValue string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	when, ok := a.last[hashedValue]
+	return when, ok
+}
+
+// SetLastActive saves the last activity of login tokens, by their hashed
+// value, in one transaction. Tokens that no longer exist are ignored.
+func (db *AuthDB) SetLastActive(lastActive map[string]time.Time) error {
+	return db.WithTx(func(tx *Tx) error {
+		for hashedValue, when := range lastActive {
+			_, err := tx.Exec("UPDATE tokens SET last_active = ? WHERE kind = ? AND hashedValue = ?", when, LoginTokenKind, hashedValue)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveIdleSessions removes the login tokens not used since cutoff, and
+// the refresh tokens issued before cutoff of users without a login token
+// used since cutoff, and returns the number removed. A login token that
+// was never used is idle since it was created.
+func (db *AuthDB) RemoveIdleSessions(cutoff time.Time) (int, error) {
+	var removed int64
+
+	err := db.WithTx(func(tx *Tx) error {
+		// The refresh tokens are removed first, while the login tokens
+		// that keep them are still there. The subquery is wrapped so
+		// that MySQL allows it to read the table being deleted from.
+		qry := `DELETE FROM tokens WHERE kind = ? AND created < ? AND user_id NOT IN (SELECT user_id FROM (SELECT user_id FROM tokens WHERE kind = ? AND COALESCE(last_active, created) >= ?) active)`
+		result, err := tx.Exec(qry, RefreshTokenKind, cutoff, LoginTokenKind, cutoff)
+		if err != nil {
+			return err
+		}
+		refresh, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		qry = `DELETE FROM tokens WHERE kind = ? AND COALESCE(last_active, created) < ?`
+		result, err = tx.Exec(qry, LoginTokenKind, cutoff)
+		if err != nil {
+			return err
+		}
+		login, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		removed = refresh + login
+		return nil
+	})
+
+	return int(removed), err
+}
+
+// FlushSessionActivity saves the last activity of the login tokens used
+// since it was last called.
+func (app *AuthApp) FlushSessionActivity() error {
+	last := app.activity.take()
+	if len(last) == 0 {
+		return nil
+	}
+
+	return app.DB.SetLastActive(last)
+}
+
+// SweepIdleSessions saves the activity of sessions and removes those idle
+// longer than Auth.SessionIdle, regardless of when they expire. It returns
+// the number of tokens removed, which is zero if idle sessions are kept.
+func (app *AuthApp) SweepIdleSessions() (int, error) {
+	if err := app.FlushSessionActivity(); err != nil {
+		return 0, err
+	}
+
+	if app.sessionIdle == 0 {
+		return 0, nil
+	}
+
+	cutoff := app.Clock.Now().Add(-app.sessionIdle)
+	n, err := app.DB.RemoveIdleSessions(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		slog.Info("removed idle sessions", "tokens", n, "cutoff", cutoff)
+	}
+
+	return n, nil
+}
+
+// SessionInfo is a login session of a user shown on the sessions page.
+type SessionInfo struct {
+	Fingerprint string
+	Created     time.Time
+	Expires     time.Time
+	LastActive  time.Time // LastActive is zero if the session was not used.
+	Current     bool      // Current is true for the session of the request.
+}
+
+// sessions returns the unexpired login sessions of username, newest first.
+// The session with the login token current is marked. The activity that
+// is not yet saved is included.
+func (app *AuthApp) sessions(username, current string) ([]SessionInfo, error) {
+	tokens, err := app.DB.Tokens(username)
+	if err != nil {
+		return nil, err
+	}
+
+	now := app.Clock.Now()
+
+	var sessions []SessionInfo
+	for _, t := range tokens {
+		if t.Kind != LoginTokenKind || t.Expires.Before(now) {
+			continue
+		}
+
+		s := SessionInfo{
+			Fingerprint: t.Fingerprint,
+			Created:     t.Created,
+			Expires:     t.Expires,
+			LastActive:  t.LastActive,
+			Current:     current != "" && t.hashedValue == Hash(current),
+		}
+		if when, ok := app.activity.pending(t.hashedValue); ok && when.After(s.LastActive) {
+			s.LastActive = when
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, nil
+}
+
+// SessionsPageData contains data passed to the HTML template.
+type SessionsPageData struct {
+	CommonData
+	User     User
+	Sessions []SessionInfo
+	Idle     time.Duration // Idle is how long sessions are kept unused, or zero.
+}
+
+// SessionsHandler shows the login sessions of the logged in user, with
+// when each was last active.
+func (app *AuthApp) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := SessionsPageData{
+		CommonData: CommonData{Title: app.Cfg.App.Name},
+		User:       user,
+		Idle:       app.sessionIdle,
+	}
+
+	if user.Username != "" {
+		current, _, _ := app.loginCookieToken(r)
+
+		data.Sessions, err = app.sessions(user.Username, current)
+		if err != nil {
+			logger.Error("failed to get sessions", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	app.RenderPage(w, r, logger, SessionsTmpl, &data)
+
+	logger.Info("done")
+}
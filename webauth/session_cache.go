@@ -0,0 +1,188 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/bnixon67/webapp/webcache"
+)
+
+// sessionCacheStore is an AuthStore that removes the sessions of users
+// from the session cache when their auth state changes, e.g., they are
+// disabled, renamed, or granted a role, so the change is seen at once
+// rather than when the cache expires.
+type sessionCacheStore struct {
+	AuthStore
+	sessions webcache.Store[string, User]
+}
+
+// newSessionCacheStore returns db wrapped to remove changed users from
+// sessions.
+func newSessionCacheStore(db AuthStore, sessions webcache.Store[string, User]) *sessionCacheStore {
+	return &sessionCacheStore{AuthStore: db, sessions: sessions}
+}
+
+// CheckSchema checks the schema of the wrapped store, if it has one.
+func (s *sessionCacheStore) CheckSchema(ctx context.Context) error {
+	if sc, ok := s.AuthStore.(schemaChecker); ok {
+		return sc.CheckSchema(ctx)
+	}
+	return nil
+}
+
+// forgetUsers calls change and removes the sessions of usernames from the
+// cache. The sessions are found first, since change may remove their
+// tokens. If they cannot be found, all sessions are removed.
+func (s *sessionCacheStore) forgetUsers(usernames []string, change func() error) error {
+	var hashes []string
+	var err error
+	for _, username := range usernames {
+		var tokens []TokenInfo
+		tokens, err = s.AuthStore.Tokens(username)
+		if err != nil {
+			break
+		}
+		for _, t := range tokens {
+			if t.Kind == LoginTokenKind {
+				hashes = append(hashes, t.hashedValue)
+			}
+		}
+	}
+
+	changeErr := change()
+
+	if err != nil {
+		s.sessions.Clear()
+		return changeErr
+	}
+	for _, hash := range hashes {
+		s.sessions.Delete(hash)
+	}
+
+	return changeErr
+}
+
+// forgetBulk is forgetUsers for a change of usernames in bulk.
+func (s *sessionCacheStore) forgetBulk(usernames []string, change func([]string) ([]BulkResult, error)) ([]BulkResult, error) {
+	var results []BulkResult
+	err := s.forgetUsers(usernames, func() error {
+		var err error
+		results, err = change(usernames)
+		return err
+	})
+
+	return results, err
+}
+
+// ResetPassword resets the password of username and forgets their sessions.
+func (s *sessionCacheStore) ResetPassword(username, resetToken, hashedPassword string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.ResetPassword(username, resetToken, hashedPassword)
+	})
+}
+
+// ConfirmUser confirms username and forgets their sessions.
+func (s *sessionCacheStore) ConfirmUser(username, ctoken string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.ConfirmUser(username, ctoken)
+	})
+}
+
+// RenameUser renames username and forgets their sessions.
+func (s *sessionCacheStore) RenameUser(username, newUsername string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.RenameUser(username, newUsername)
+	})
+}
+
+// DisableUsers disables usernames and forgets their sessions.
+func (s *sessionCacheStore) DisableUsers(usernames []string) ([]BulkResult, error) {
+	return s.forgetBulk(usernames, s.AuthStore.DisableUsers)
+}
+
+// DeleteUsers deletes usernames and forgets their sessions.
+func (s *sessionCacheStore) DeleteUsers(usernames []string) ([]BulkResult, error) {
+	return s.forgetBulk(usernames, s.AuthStore.DeleteUsers)
+}
+
+// UpdateUserFullName updates the full name of username and forgets their
+// sessions.
+func (s *sessionCacheStore) UpdateUserFullName(username, fullName string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.UpdateUserFullName(username, fullName)
+	})
+}
+
+// UpdateUserEmail updates the email of username and forgets their sessions.
+func (s *sessionCacheStore) UpdateUserEmail(username, email string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.UpdateUserEmail(username, email)
+	})
+}
+
+// RemoveTokenForFingerprint removes the token of fingerprint and forgets
+// its session.
+func (s *sessionCacheStore) RemoveTokenForFingerprint(fingerprint string) error {
+	t, err := s.AuthStore.TokenForFingerprint(fingerprint)
+	if err == nil && t.Kind == LoginTokenKind {
+		defer s.sessions.Delete(t.hashedValue)
+	}
+
+	return s.AuthStore.RemoveTokenForFingerprint(fingerprint)
+}
+
+// RemoveIdleSessions removes the idle sessions and forgets all sessions if
+// any were removed.
+func (s *sessionCacheStore) RemoveIdleSessions(cutoff time.Time) (int, error) {
+	n, err := s.AuthStore.RemoveIdleSessions(cutoff)
+	if n > 0 {
+		s.sessions.Clear()
+	}
+
+	return n, err
+}
+
+// SaveRole saves role and forgets all sessions, since any user may have it.
+func (s *sessionCacheStore) SaveRole(role Role) error {
+	defer s.sessions.Clear()
+	return s.AuthStore.SaveRole(role)
+}
+
+// DeleteRole deletes the role name and forgets all sessions, since any user
+// may have it.
+func (s *sessionCacheStore) DeleteRole(name string) error {
+	defer s.sessions.Clear()
+	return s.AuthStore.DeleteRole(name)
+}
+
+// GrantRole grants the role name to username and forgets their sessions.
+func (s *sessionCacheStore) GrantRole(username, name string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.GrantRole(username, name)
+	})
+}
+
+// RevokeRole revokes the role name from username and forgets their
+// sessions.
+func (s *sessionCacheStore) RevokeRole(username, name string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.RevokeRole(username, name)
+	})
+}
+
+// RevokeSessions revokes the sessions of username and forgets them.
+func (s *sessionCacheStore) RevokeSessions(username string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.RevokeSessions(username)
+	})
+}
+
+// PurgeUser purges username and forgets their sessions.
+func (s *sessionCacheStore) PurgeUser(username string) error {
+	return s.forgetUsers([]string{username}, func() error {
+		return s.AuthStore.PurgeUser(username)
+	})
+}
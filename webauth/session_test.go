@@ -0,0 +1,117 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withSessionIdle returns a config modifier that sets how long sessions
+// are kept unused.
+func withSessionIdle(d string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.SessionIdle = d
+	}
+}
+
+func TestSweepIdleSessions(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	app := newAppForTest(t, []func(*webauth.Config){withSessionIdle("1h")},
+		webauth.WithDB(store), webauth.WithClock(clock))
+
+	active, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+	if _, err := app.LoginUser("test", "password"); err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	// Only the first session is used before the window passes.
+	clock.Advance(45 * time.Minute)
+	requestAs(app.SessionsHandler, active.Value, http.MethodGet, "/sessions", "")
+	clock.Advance(30 * time.Minute)
+
+	n, err := app.SweepIdleSessions()
+	if err != nil {
+		t.Fatalf("SweepIdleSessions() failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("SweepIdleSessions() = %d, want 1", n)
+	}
+
+	tokens, err := store.Tokens("test")
+	if err != nil {
+		t.Fatalf("Tokens() failed: %v", err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("got %d tokens, want 1", len(tokens))
+	}
+	if want := clock.Now().Add(-30 * time.Minute); !tokens[0].LastActive.Equal(want) {
+		t.Errorf("LastActive = %v, want %v", tokens[0].LastActive, want)
+	}
+
+	// The used session is removed once it is idle too.
+	clock.Advance(time.Hour)
+	if n, err := app.SweepIdleSessions(); n != 1 || err != nil {
+		t.Errorf("SweepIdleSessions() = %d, %v, want 1", n, err)
+	}
+}
+
+func TestSweepIdleSessionsKept(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Now())
+	store := StoreForTest(t)
+	app := newAppForTest(t, nil, webauth.WithDB(store), webauth.WithClock(clock))
+
+	if _, err := app.LoginUser("test", "password"); err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if n, err := app.SweepIdleSessions(); n != 0 || err != nil {
+		t.Errorf("SweepIdleSessions() = %d, %v, want 0", n, err)
+	}
+}
+
+func TestSessionsHandler(t *testing.T) {
+	app := newAppForTest(t, []func(*webauth.Config){withSessionIdle("1h")},
+		webauth.WithDB(StoreForTest(t)))
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"loggedIn", login.Value, "This session"},
+		{"loggedOut", "", "You must"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(app.SessionsHandler, tc.token, http.MethodGet, "/sessions", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("got body %q, expected %q in body", w.Body, tc.want)
+			}
+		})
+	}
+
+	w := requestAs(app.SessionsHandler, login.Value, http.MethodPost, "/sessions", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Limits of the values of a session, matching the SQL schema.
+const (
+	MaxSessionKeyLen   = 100
+	MaxSessionValueLen = 4000
+	MaxSessionValues   = 20 // MaxSessionValues is the most keys a session can have.
+)
+
+var (
+	ErrNoSession              = errors.New("no session")
+	ErrSessionValueNotFound   = errors.New("session value not found")
+	ErrTooManySessionValues   = errors.New("too many session values")
+	ErrSessionValueNotEncoded = errors.New("session value cannot be encoded")
+)
+
+// SessionValue returns the value of key in the session of loginToken.
+//
+// If not found, or the login token is expired, ErrSessionValueNotFound is
+// returned.
+func (db *AuthDB) SessionValue(loginToken, key string) (string, error) {
+	if db == nil {
+		return "", ErrInvalidDB
+	}
+
+	var value string
+
+	qry := `SELECT session_values.value FROM session_values INNER JOIN tokens ON tokens.hashedValue = session_values.hashedValue WHERE tokens.kind = ? AND tokens.hashedValue = ? AND tokens.expires > ? AND session_values.name = ?`
+	err := db.QueryRow(qry, LoginTokenKind, Hash(loginToken), db.now(), key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrSessionValueNotFound
+		}
+		return "", err
+	}
+
+	return value, nil
+}
+
+// SetSessionValue saves value as key in the session of loginToken,
+// replacing any previous value.
+//
+// ErrNoSession is returned if loginToken is not a current login token,
+// and ErrTooManySessionValues if the session has MaxSessionValues other
+// keys.
+func (db *AuthDB) SetSessionValue(loginToken, key, value string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	if len(key) > MaxSessionKeyLen || len(value) > MaxSessionValueLen {
+		return ErrValueTooLong
+	}
+
+	hashedValue := Hash(loginToken)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(db.Rebind("DELETE FROM session_values WHERE hashedValue = ? AND name = ?"), hashedValue, key)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	err = tx.QueryRow(db.Rebind("SELECT COUNT(*) FROM session_values WHERE hashedValue = ?"), hashedValue).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n >= MaxSessionValues {
+		return ErrTooManySessionValues
+	}
+
+	qry := "INSERT INTO session_values(hashedValue, name, value) SELECT hashedValue, ?, ? FROM tokens WHERE kind = ? AND hashedValue = ? AND expires > ?"
+	result, err := tx.Exec(db.Rebind(qry), key, value, LoginTokenKind, hashedValue, db.now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrNoSession
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSessionValue deletes key from the session of loginToken, if it
+// exists.
+func (db *AuthDB) DeleteSessionValue(loginToken, key string) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	_, err := db.Exec("DELETE FROM session_values WHERE hashedValue = ? AND name = ?", Hash(loginToken), key)
+	return err
+}
+
+// PurgeSessionValues deletes the values of sessions whose login token was
+// removed, and returns the number deleted.
+func (db *AuthDB) PurgeSessionValues() (int, error) {
+	if db == nil {
+		return 0, ErrInvalidDB
+	}
+
+	qry := "DELETE FROM session_values WHERE hashedValue NOT IN (SELECT hashedValue FROM tokens WHERE kind = ?)"
+	result, err := db.Exec(qry, LoginTokenKind)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Session is the server-side storage of a login session, which keeps the
+// state of multi-step flows, such as wizards, out of cookies. Values are
+// encoded as JSON and kept until the session ends. Since they are keyed
+// by the login token, values do not carry over when RefreshSession renews
+// the login, so they suit short flows rather than long-lived state.
+//
+// A nil Session has no values and returns ErrNoSession from Set.
+type Session struct {
+	store      SessionStore
+	loginToken string
+}
+
+type sessionKey struct{}
+
+// SessionFromContext returns the Session added by SessionValues, or nil if
+// the request has no login.
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// SessionValues is middleware that adds the Session of the login cookie,
+// if any, to the request context, for handlers to get with
+// SessionFromContext. The login is checked when a value is used, so
+// requests that do not use the Session do not query the store.
+func (app *AuthApp) SessionValues(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loginToken, _, err := app.loginCookieToken(r)
+		if err != nil || loginToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s := &Session{store: app.DB, loginToken: loginToken}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey{}, s)))
+	})
+}
+
+// Session returns the Session of r, from SessionValues if it was used, or
+// nil if r has no login cookie.
+func (app *AuthApp) Session(r *http.Request) *Session {
+	if s := SessionFromContext(r.Context()); s != nil {
+		return s
+	}
+
+	loginToken, _, err := app.loginCookieToken(r)
+	if err != nil || loginToken == "" {
+		return nil
+	}
+
+	return &Session{store: app.DB, loginToken: loginToken}
+}
+
+// Get decodes the value of key into v, which must be a pointer.
+//
+// If not found, ErrSessionValueNotFound is returned.
+func (s *Session) Get(key string, v any) error {
+	if s == nil {
+		return ErrSessionValueNotFound
+	}
+
+	value, err := s.store.SessionValue(s.loginToken, key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(value), v)
+}
+
+// Set saves v, encoded as JSON, as the value of key.
+func (s *Session) Set(key string, v any) error {
+	if s == nil {
+		return ErrNoSession
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSessionValueNotEncoded, err)
+	}
+
+	return s.store.SetSessionValue(s.loginToken, key, string(value))
+}
+
+// Delete deletes the value of key, if it exists.
+func (s *Session) Delete(key string) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.store.DeleteSessionValue(s.loginToken, key)
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestSessionStore(t *testing.T) {
+	// The SQL store is tested only if there is a test database.
+	t.Run("sql", func(t *testing.T) {
+		testSessionStore(t, DBForTest(t))
+	})
+	t.Run("memory", func(t *testing.T) {
+		testSessionStore(t, StoreForTest(t))
+	})
+}
+
+// testSessionStore tests that store keeps the values of each session
+// until its login token is removed.
+func testSessionStore(t *testing.T, store webauth.AuthStore) {
+	login, err := store.CreateToken(webauth.LoginTokenKind, "test", 32, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	other, err := store.CreateToken(webauth.LoginTokenKind, "test", 32, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	expired, err := store.CreateToken(webauth.LoginTokenKind, "test", 32, "-1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	if err := store.SetSessionValue(login.Value, "step", "1"); err != nil {
+		t.Fatalf("SetSessionValue() failed: %v", err)
+	}
+	if err := store.SetSessionValue(login.Value, "step", "2"); err != nil {
+		t.Fatalf("SetSessionValue() again failed: %v", err)
+	}
+	if got, err := store.SessionValue(login.Value, "step"); got != "2" || err != nil {
+		t.Errorf("SessionValue() = %q, %v, want 2", got, err)
+	}
+	if _, err := store.SessionValue(other.Value, "step"); !errors.Is(err, webauth.ErrSessionValueNotFound) {
+		t.Errorf("SessionValue() of other session = %v, want %v", err, webauth.ErrSessionValueNotFound)
+	}
+
+	if err := store.SetSessionValue(expired.Value, "step", "1"); !errors.Is(err, webauth.ErrNoSession) {
+		t.Errorf("SetSessionValue() of expired login = %v, want %v", err, webauth.ErrNoSession)
+	}
+	if err := store.SetSessionValue("not a token", "step", "1"); !errors.Is(err, webauth.ErrNoSession) {
+		t.Errorf("SetSessionValue() of unknown login = %v, want %v", err, webauth.ErrNoSession)
+	}
+	if err := store.SetSessionValue(login.Value, "step", strings.Repeat("x", webauth.MaxSessionValueLen+1)); !errors.Is(err, webauth.ErrValueTooLong) {
+		t.Errorf("SetSessionValue() of long value = %v, want %v", err, webauth.ErrValueTooLong)
+	}
+
+	for i := 1; i < webauth.MaxSessionValues; i++ {
+		if err := store.SetSessionValue(login.Value, fmt.Sprint("key", i), "v"); err != nil {
+			t.Fatalf("SetSessionValue() of key %d failed: %v", i, err)
+		}
+	}
+	if err := store.SetSessionValue(login.Value, "full", "v"); !errors.Is(err, webauth.ErrTooManySessionValues) {
+		t.Errorf("SetSessionValue() of full session = %v, want %v", err, webauth.ErrTooManySessionValues)
+	}
+	if err := store.SetSessionValue(login.Value, "step", "3"); err != nil {
+		t.Errorf("SetSessionValue() of existing key in full session = %v", err)
+	}
+
+	if err := store.DeleteSessionValue(login.Value, "step"); err != nil {
+		t.Fatalf("DeleteSessionValue() failed: %v", err)
+	}
+	if _, err := store.SessionValue(login.Value, "step"); !errors.Is(err, webauth.ErrSessionValueNotFound) {
+		t.Errorf("SessionValue() after delete = %v, want %v", err, webauth.ErrSessionValueNotFound)
+	}
+
+	if n, err := store.PurgeSessionValues(); n != 0 || err != nil {
+		t.Errorf("PurgeSessionValues() = %d, %v, want 0", n, err)
+	}
+	if err := store.RemoveToken(webauth.LoginTokenKind, login.Value); err != nil {
+		t.Fatalf("RemoveToken() failed: %v", err)
+	}
+	if n, err := store.PurgeSessionValues(); n != webauth.MaxSessionValues-1 || err != nil {
+		t.Errorf("PurgeSessionValues() = %d, %v, want %d", n, err, webauth.MaxSessionValues-1)
+	}
+}
+
+func TestSessionValues(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	type wizard struct {
+		Step  int
+		Email string
+	}
+
+	// h saves a wizard on POST and writes the saved wizard on GET.
+	h := app.SessionValues(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := webauth.SessionFromContext(r.Context())
+
+		if r.Method == http.MethodPost {
+			if err := s.Set("wizard", wizard{Step: 2, Email: "test@example.com"}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		var got wizard
+		if err := s.Get("wizard", &got); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "%d %s", got.Step, got.Email)
+	}))
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"notSaved", token.Value, http.MethodGet, http.StatusNotFound, webauth.ErrSessionValueNotFound.Error() + "\n"},
+		{"save", token.Value, http.MethodPost, http.StatusOK, ""},
+		{"saved", token.Value, http.MethodGet, http.StatusOK, "2 test@example.com"},
+		{"noLogin", "", http.MethodPost, http.StatusInternalServerError, webauth.ErrNoSession.Error() + "\n"},
+		{"invalidLogin", "invalid", http.MethodPost, http.StatusInternalServerError, webauth.ErrNoSession.Error() + "\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(h.ServeHTTP, tc.token, tc.method, "/wizard", "")
+			if w.Code != tc.wantStatus || w.Body.String() != tc.wantBody {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Body, tc.wantStatus, tc.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SigningKeySize is the size of the random signing key used if one is not
+// provided in the config.
+const SigningKeySize = 32
+
+// signingKeyIDSep separates the id of a signing key from the signature.
+// It is not used by base64.RawURLEncoding.
+const signingKeyIDSep = "~"
+
+// sign returns a URL safe HMAC-SHA256 signature of the values using key.
+// Each value is length prefixed to avoid ambiguous concatenation.
+func sign(key []byte, values ...string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, v := range values {
+		var n [8]byte
+		for i, l := 0, uint64(len(v)); i < len(n); i++ {
+			n[i] = byte(l >> (8 * i))
+		}
+		mac.Write(n[:])
+		mac.Write([]byte(v))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature returns true if sig is a valid signature of the values
+// using key. The comparison is done in constant time.
+func validSignature(key []byte, sig string, values ...string) bool {
+	return hmac.Equal([]byte(sig), []byte(sign(key, values...)))
+}
+
+// signingKeys are the keys used to sign values. Signatures are tagged with
+// the id of the key, so that retired keys still verify the signatures
+// made before a rotation.
+type signingKeys struct {
+	id     string            // id is the key used to sign, if not empty.
+	keys   map[string][]byte // keys by id, including retired keys.
+	legacy []byte            // legacy verifies signatures without an id.
+}
+
+var (
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrSigningKeyID      = errors.New("invalid signing key id")
+	ErrSigningKeyMissing = errors.New("missing signing key")
+)
+
+// signingKeyIDRE matches a valid signing key id.
+var signingKeyIDRE = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// signingKeys returns the parsed SigningKey, SigningKeyID, and SigningKeys.
+// If no key is configured, a random key is generated from r.
+func (c ConfigAuth) signingKeys(r io.Reader) (signingKeys, error) {
+	k := signingKeys{id: c.SigningKeyID}
+	if c.SigningKey != "" {
+		k.legacy = []byte(c.SigningKey)
+	}
+
+	if len(c.SigningKeys) != 0 {
+		k.keys = make(map[string][]byte, len(c.SigningKeys))
+		for id, key := range c.SigningKeys {
+			if !signingKeyIDRE.MatchString(id) {
+				return signingKeys{}, fmt.Errorf("%w: %q", ErrSigningKeyID, id)
+			}
+			if key == "" {
+				return signingKeys{}, fmt.Errorf("%w: %q", ErrSigningKeyMissing, id)
+			}
+			k.keys[id] = []byte(key)
+		}
+	}
+
+	switch {
+	case k.id != "" && k.keys[k.id] == nil:
+		return signingKeys{}, fmt.Errorf("%w: %q not in SigningKeys", ErrSigningKeyMissing, k.id)
+	case k.id == "" && k.keys != nil:
+		return signingKeys{}, fmt.Errorf("%w: SigningKeyID is required with SigningKeys", ErrSigningKeyID)
+	case k.id == "" && k.legacy == nil:
+		key, err := RandomStringFrom(r, SigningKeySize)
+		if err != nil {
+			return signingKeys{}, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		k.legacy = []byte(key)
+	}
+
+	return k, nil
+}
+
+// sign returns a signature of the values using the current key.
+func (k signingKeys) sign(values ...string) string {
+	if k.id == "" {
+		return sign(k.legacy, values...)
+	}
+
+	return k.id + signingKeyIDSep + sign(k.keys[k.id], values...)
+}
+
+// verify returns true if sig is a valid signature of the values and
+// whether it was made with the current key.
+func (k signingKeys) verify(sig string, values ...string) (valid, current bool) {
+	id, s, tagged := strings.Cut(sig, signingKeyIDSep)
+	if !tagged {
+		return k.legacy != nil && validSignature(k.legacy, sig, values...), k.id == ""
+	}
+
+	key, ok := k.keys[id]
+	if !ok {
+		return false, false
+	}
+
+	return validSignature(key, s, values...), id == k.id
+}
+
+// Sign returns a signature of the values using the app signing key.
+func (app *AuthApp) Sign(values ...string) string {
+	return app.signingKeys.sign(values...)
+}
+
+// ValidSignature returns true if sig is a valid signature of the values
+// using the app signing key or a retired key.
+func (app *AuthApp) ValidSignature(sig string, values ...string) bool {
+	valid, _ := app.signingKeys.verify(sig, values...)
+	return valid
+}
+
+// signedCookie describes a cookie with a signed value, so that it can be
+// re-issued if signed with a retired key.
+type signedCookie struct {
+	purpose string      // purpose is signed with the value.
+	attrs   http.Cookie // attrs are the attributes of the cookie.
+}
+
+// signedCookies are the cookies created by newSignedCookie, by name.
+var signedCookies = map[string]signedCookie{
+	OAuthStateCookieName: {
+		purpose: "oauth",
+		attrs: http.Cookie{
+			Path:     "/oauth/",
+			MaxAge:   600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	},
+}
+
+// newSignedCookie returns the named cookie from signedCookies with value
+// and its signature.
+func (app *AuthApp) newSignedCookie(name, value string) *http.Cookie {
+	sc := signedCookies[name]
+
+	c := sc.attrs
+	c.Name = name
+	c.Value = app.cookies.encode(value + "." + app.Sign(sc.purpose, value))
+
+	return &c
+}
+
+// signedCookieValue returns the value of the named signed cookie from the
+// cookie value v and whether it is in the current format and signed with
+// the current key. An error is returned if the signature is not valid or
+// the format is not accepted.
+func (app *AuthApp) signedCookieValue(name, v string) (string, bool, error) {
+	v, version, err := app.cookies.decode(v)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, sig, ok := strings.Cut(v, ".")
+	if !ok {
+		return "", false, ErrInvalidSignature
+	}
+
+	valid, current := app.signingKeys.verify(sig, signedCookies[name].purpose, value)
+	if !valid {
+		return "", false, ErrInvalidSignature
+	}
+
+	return value, current && !app.cookies.reissue(version), nil
+}
+
+// ReissueSignedCookies is middleware that re-issues signed cookies of the
+// request that were signed with a retired key or are in an older format,
+// so that a key or format can be removed once it has been retired longer
+// than the cookies last.
+func (app *AuthApp) ReissueSignedCookies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range r.Cookies() {
+			if _, ok := signedCookies[c.Name]; !ok {
+				continue
+			}
+
+			value, current, err := app.signedCookieValue(c.Name, c.Value)
+			if err != nil || current {
+				continue
+			}
+
+			http.SetCookie(w, app.newSignedCookie(c.Name, value))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RotateSigningKey adds a new signing key generated from r to the JSON
+// config in data and makes it the current key. The id of the new key is
+// based on now. The previous keys are kept to verify existing signatures.
+// The updated config is returned with the id of the new key.
+func RotateSigningKey(data []byte, r io.Reader, now time.Time) ([]byte, string, error) {
+	cfg, auth, keys, err := signingKeysFromJSON(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id := now.UTC().Format("20060102T150405")
+	if _, ok := keys[id]; ok {
+		return nil, "", fmt.Errorf("%w: %q already exists", ErrSigningKeyID, id)
+	}
+
+	key, err := RandomStringFrom(r, SigningKeySize)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	keys[id] = key
+
+	auth["SigningKeyID"], _ = json.Marshal(id)
+	data, err = signingKeysToJSON(cfg, auth, keys)
+	return data, id, err
+}
+
+// RemoveSigningKey removes the retired signing key id from the JSON config
+// in data and returns the updated config. Signatures made with the key are
+// no longer valid, so it should only be removed after the signed values
+// have expired or been re-issued.
+func RemoveSigningKey(data []byte, id string) ([]byte, error) {
+	cfg, auth, keys, err := signingKeysFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var current string
+	if raw, ok := auth["SigningKeyID"]; ok {
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrConfigParse, err)
+		}
+	}
+
+	if _, ok := keys[id]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrSigningKeyMissing, id)
+	}
+	if id == current {
+		return nil, fmt.Errorf("%w: %q is the current key", ErrSigningKeyID, id)
+	}
+	delete(keys, id)
+
+	return signingKeysToJSON(cfg, auth, keys)
+}
+
+// SigningKeyIDs returns the ids of the signing keys in the JSON config in
+// data, sorted, and the id of the current key.
+func SigningKeyIDs(data []byte) ([]string, string, error) {
+	var cfg struct{ Auth ConfigAuth }
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrConfigParse, err)
+	}
+
+	ids := make([]string, 0, len(cfg.Auth.SigningKeys))
+	for id := range cfg.Auth.SigningKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, cfg.Auth.SigningKeyID, nil
+}
+
+// signingKeysFromJSON returns the JSON config in data, its Auth section,
+// and the SigningKeys. The other settings are kept as is, since a
+// Config is redacted when marshaled.
+func signingKeysFromJSON(data []byte) (cfg, auth map[string]json.RawMessage, keys map[string]string, err error) {
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrConfigParse, err)
+	}
+	if raw, ok := cfg["Auth"]; ok {
+		if err := json.Unmarshal(raw, &auth); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrConfigParse, err)
+		}
+	}
+	if auth == nil {
+		auth = make(map[string]json.RawMessage)
+	}
+	if raw, ok := auth["SigningKeys"]; ok {
+		if err := json.Unmarshal(raw, &keys); err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: %v", ErrConfigParse, err)
+		}
+	}
+	if keys == nil {
+		keys = make(map[string]string)
+	}
+
+	return cfg, auth, keys, nil
+}
+
+// signingKeysToJSON returns the JSON config with keys as the SigningKeys.
+func signingKeysToJSON(cfg, auth map[string]json.RawMessage, keys map[string]string) ([]byte, error) {
+	var err error
+	if auth["SigningKeys"], err = json.Marshal(keys); err != nil {
+		return nil, err
+	}
+	if cfg["Auth"], err = json.Marshal(auth); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(cfg, "", "  ")
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// withSigningKeys returns a config modifier that sets the signing keys.
+func withSigningKeys(legacy, id string, keys map[string]string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Auth.SigningKey = legacy
+		cfg.Auth.SigningKeyID = id
+		cfg.Auth.SigningKeys = keys
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	legacy := AppWithoutDBForTest(t, withSigningKeys("old", "", nil))
+	first := AppWithoutDBForTest(t, withSigningKeys("old", "a", map[string]string{"a": "key-a"}))
+	second := AppWithoutDBForTest(t, withSigningKeys("", "b", map[string]string{"a": "key-a", "b": "key-b"}))
+
+	legacySig := legacy.Sign("test", "value")
+	firstSig := first.Sign("test", "value")
+	if !strings.HasPrefix(firstSig, "a~") {
+		t.Errorf("Sign() = %q, want prefix %q", firstSig, "a~")
+	}
+
+	tests := []struct {
+		name string
+		app  *webauth.AuthApp
+		sig  string
+		want bool
+	}{
+		{"legacy with legacy", legacy, legacySig, true},
+		{"legacy with first", first, legacySig, true},
+		{"legacy with second", second, legacySig, false},
+		{"first with first", first, firstSig, true},
+		{"first with second", second, firstSig, true},
+		{"first with legacy", legacy, firstSig, false},
+		{"unknown key", second, "c~" + strings.TrimPrefix(firstSig, "a~"), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.app.ValidSignature(tc.sig, "test", "value"); got != tc.want {
+				t.Errorf("ValidSignature(%q) = %v, want %v", tc.sig, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSigningKeysInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		keys map[string]string
+		want error
+	}{
+		{"missing current", "b", map[string]string{"a": "key-a"}, webauth.ErrSigningKeyMissing},
+		{"missing id", "", map[string]string{"a": "key-a"}, webauth.ErrSigningKeyID},
+		{"empty key", "a", map[string]string{"a": ""}, webauth.ErrSigningKeyMissing},
+		{"invalid id", "a~b", map[string]string{"a~b": "key"}, webauth.ErrSigningKeyID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			withSigningKeys("", tc.id, tc.keys)(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if !errors.Is(err, webauth.ErrInvalidConfig) || !strings.Contains(err.Error(), tc.want.Error()) {
+				t.Errorf("NewApp() error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReissueSignedCookies(t *testing.T) {
+	p := newFakeProvider(t, "subject", "oauth@example.com")
+	provider := func(cfg *webauth.Config) {
+		cfg.OAuth = map[string]webauth.ConfigOAuth{
+			"test": {Issuer: p.URL, ClientID: "client", ClientSecret: "secret"},
+		}
+	}
+	first := AppWithoutDBForTest(t, provider, withSigningKeys("", "a", map[string]string{"a": "key-a"}))
+	second := AppWithoutDBForTest(t, provider, withSigningKeys("", "b", map[string]string{"a": "key-a", "b": "key-b"}))
+
+	cookie, _ := startOAuthLogin(t, first, p)
+
+	reissue := func(app *webauth.AuthApp, c *http.Cookie) []*http.Cookie {
+		r := httptest.NewRequest(http.MethodGet, "/oauth/callback", nil)
+		r.AddCookie(c)
+		w := httptest.NewRecorder()
+		app.ReissueSignedCookies(http.NotFoundHandler()).ServeHTTP(w, r)
+		return w.Result().Cookies()
+	}
+
+	// A cookie signed with the current key is not re-issued.
+	if got := reissue(first, cookie); len(got) != 0 {
+		t.Errorf("cookies with current key = %v, want none", got)
+	}
+
+	got := reissue(second, cookie)
+	if len(got) != 1 || !strings.Contains(got[0].Value, ".b~") {
+		t.Fatalf("cookies with retired key = %v, want cookie signed with b", got)
+	}
+	if got[0].Path != "/oauth/" || !got[0].HttpOnly || !got[0].Secure {
+		t.Errorf("cookie = %v, want attributes of state cookie", got[0])
+	}
+	if got := reissue(second, got[0]); len(got) != 0 {
+		t.Errorf("cookies after reissue = %v, want none", got)
+	}
+
+	// A cookie with an invalid signature is left to the handler.
+	cookie.Value += "x"
+	if got := reissue(second, cookie); len(got) != 0 {
+		t.Errorf("cookies with invalid signature = %v, want none", got)
+	}
+}
+
+func TestRotateSigningKey(t *testing.T) {
+	data := []byte(`{"App":{"Name":"test"},"Auth":{"SigningKey":"old","BaseURL":"http://localhost"}}`)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	data, id, err := webauth.RotateSigningKey(data, strings.NewReader(strings.Repeat("x", webauth.SigningKeySize)), now)
+	if err != nil {
+		t.Fatalf("RotateSigningKey() failed: %v", err)
+	}
+	if id != "20240102T030405" {
+		t.Errorf("RotateSigningKey() id = %q, want %q", id, "20240102T030405")
+	}
+
+	var cfg webauth.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("invalid config %s: %v", data, err)
+	}
+	if cfg.App.Name != "test" || cfg.Auth.SigningKey != "old" || cfg.Auth.SigningKeyID != id || cfg.Auth.SigningKeys[id] == "" {
+		t.Errorf("RotateSigningKey() config = %s", data)
+	}
+
+	if _, _, err := webauth.RotateSigningKey(data, strings.NewReader(strings.Repeat("x", webauth.SigningKeySize)), now); !errors.Is(err, webauth.ErrSigningKeyID) {
+		t.Errorf("RotateSigningKey() twice = %v, want %v", err, webauth.ErrSigningKeyID)
+	}
+
+	data, next, err := webauth.RotateSigningKey(data, strings.NewReader(strings.Repeat("y", webauth.SigningKeySize)), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("RotateSigningKey() failed: %v", err)
+	}
+
+	ids, current, err := webauth.SigningKeyIDs(data)
+	if err != nil || len(ids) != 2 || current != next {
+		t.Errorf("SigningKeyIDs() = %q, %q, %v, want 2 keys and %q", ids, current, err, next)
+	}
+
+	if _, err := webauth.RemoveSigningKey(data, next); !errors.Is(err, webauth.ErrSigningKeyID) {
+		t.Errorf("RemoveSigningKey() of current key = %v, want %v", err, webauth.ErrSigningKeyID)
+	}
+	if _, err := webauth.RemoveSigningKey(data, "missing"); !errors.Is(err, webauth.ErrSigningKeyMissing) {
+		t.Errorf("RemoveSigningKey() of missing key = %v, want %v", err, webauth.ErrSigningKeyMissing)
+	}
+
+	data, err = webauth.RemoveSigningKey(data, id)
+	if err != nil {
+		t.Fatalf("RemoveSigningKey() failed: %v", err)
+	}
+	if ids, _, _ := webauth.SigningKeyIDs(data); len(ids) != 1 || ids[0] != next {
+		t.Errorf("SigningKeyIDs() after remove = %q, want %q", ids, next)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// ConfigSignature holds the keys of API clients that sign requests, as
+// described by webhandler.SignatureVerifier.
+type ConfigSignature struct {
+	Keys    map[string]string                // Keys are the secrets by key id.
+	Clients map[string]ConfigSignatureClient // Clients are the users of the keys by key id.
+	MaxSkew string                           // Duration string of the allowed clock skew.
+}
+
+// ConfigSignatureClient is the user that an API client acts as when it
+// signs a request. Like an API token, the client only has the permissions
+// of its scopes that the user can grant.
+type ConfigSignatureClient struct {
+	Username string       // Username is the user of the signed requests.
+	Scopes   []Permission // Scopes are the permissions of the client.
+}
+
+// verifier returns the SignatureVerifier for c, or nil if c has no keys.
+func (c ConfigSignature) verifier(clock Clock) (*webhandler.SignatureVerifier, error) {
+	for id, client := range c.Clients {
+		if _, ok := c.Keys[id]; !ok {
+			return nil, fmt.Errorf("Signature.Clients %q has no key", id)
+		}
+		if client.Username == "" {
+			return nil, fmt.Errorf("Signature.Clients %q has no username", id)
+		}
+		for _, scope := range client.Scopes {
+			if !slices.Contains(APIScopes, scope) {
+				return nil, fmt.Errorf("Signature.Clients %q has invalid scope %q", id, scope)
+			}
+		}
+	}
+
+	if len(c.Keys) == 0 {
+		return nil, nil
+	}
+
+	v := webhandler.NewSignatureVerifier(func(id string) ([]byte, bool) {
+		secret, ok := c.Keys[id]
+		return []byte(secret), ok && secret != ""
+	})
+	v.Now = clock.Now
+
+	if c.MaxSkew != "" {
+		d, err := time.ParseDuration(c.MaxSkew)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Signature.MaxSkew: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("Signature.MaxSkew %q not positive", c.MaxSkew)
+		}
+		v.MaxSkew = d
+	}
+
+	return v, nil
+}
+
+// VerifySignature returns middleware that verifies signed requests to the
+// API prefixes of Config.Deadline using the keys in Config.Signature.
+// Requests with an invalid signature are rejected. Unsigned requests are
+// passed to next, so clients can authenticate in other ways.
+func (app *AuthApp) VerifySignature(next http.Handler) http.Handler {
+	signed := webhandler.RequireSignature(next, app.signatures)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.signatures == nil || !app.isAPIRequest(r) || !webhandler.IsSigned(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		signed.ServeHTTP(w, r)
+	})
+}
+
+// signatureUser returns the user of the client that signed the request of
+// ctx, limited to the scopes of the client. If the request was not signed
+// by a key of Config.Signature.Clients, or the user is not found or
+// disabled, an empty user is returned.
+func (app *AuthApp) signatureUser(ctx context.Context) (User, error) {
+	id, ok := webhandler.SignatureKeyID(ctx)
+	if !ok {
+		return User{}, nil
+	}
+	client, ok := app.Cfg.Signature.Clients[id]
+	if !ok {
+		return User{}, nil
+	}
+
+	user, err := app.DB.UserForName(client.Username)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, nil
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if user.Disabled {
+		return User{}, nil
+	}
+
+	roles, err := app.DB.UserRoles(user.Username)
+	if err != nil {
+		return User{}, err
+	}
+	user.setRoles(roles)
+
+	// Limit the user to the scopes of the client it can grant.
+	var perms []Permission
+	for _, scope := range client.Scopes {
+		if user.canGrant(scope) {
+			perms = append(perms, scope)
+		}
+	}
+	user.IsAdmin, user.Roles, user.Permissions = false, nil, perms
+
+	return user, nil
+}
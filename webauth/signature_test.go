@@ -0,0 +1,162 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// withSignature returns a func to set the signature keys of a Config.
+func withSignature(keys map[string]string, maxSkew string) func(*webauth.Config) {
+	return func(cfg *webauth.Config) {
+		cfg.Signature = webauth.ConfigSignature{Keys: keys, MaxSkew: maxSkew}
+	}
+}
+
+func TestConfigSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSkew string
+		wantErr bool
+	}{
+		{"default", "", false},
+		{"valid", "1m", false},
+		{"invalid", "soon", true},
+		{"negative", "-1m", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			withSignature(map[string]string{"client": "secret"}, tc.maxSkew)(cfg)
+
+			_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+			if tc.wantErr != errors.Is(err, webauth.ErrInvalidConfig) {
+				t.Errorf("NewApp() = %v, want ErrInvalidConfig %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	clients := map[string]webauth.ConfigSignatureClient{
+		"missing":  {Username: "test"},
+		"noUser":   {},
+		"badScope": {Username: "test", Scopes: []webauth.Permission{"nope"}},
+	}
+	for id, client := range clients {
+		cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		cfg.Signature = webauth.ConfigSignature{
+			Keys:    map[string]string{"noUser": "secret", "badScope": "secret"},
+			Clients: map[string]webauth.ConfigSignatureClient{id: client},
+		}
+
+		_, err = webauth.NewApp(webapp.WithName(cfg.App.Name), webauth.WithConfig(*cfg))
+		if !errors.Is(err, webauth.ErrInvalidConfig) {
+			t.Errorf("NewApp() with client %q = %v, want ErrInvalidConfig", id, err)
+		}
+	}
+
+	cfg := webauth.Config{Signature: webauth.ConfigSignature{Keys: map[string]string{"client": "secret"}}}
+	if s := cfg.String(); strings.Contains(s, "secret") || !strings.Contains(s, "client:[REDACTED]") {
+		t.Errorf("String() = %q, want key redacted", s)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	app := newAppForTest(t, []func(*webauth.Config){withSignature(map[string]string{"client": "secret"}, "")},
+		webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := webhandler.SignatureKeyID(r.Context())
+		w.Write([]byte("key=" + id))
+	})
+	h := app.VerifySignature(app.CSRF(next))
+
+	signed := func(target, secret, nonce string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader("body"))
+		webhandler.SignRequest(r, []byte("body"), "client", []byte(secret), nonce, clock.Now())
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		r          *http.Request
+		wantStatus int
+		wantBody   string
+	}{
+		{"signed", signed("/api/test", "secret", "n1"), http.StatusOK, "key=client"},
+		{"replay", signed("/api/test", "secret", "n1"), http.StatusUnauthorized, ""},
+		{"invalid", signed("/api/test", "wrong", "n2"), http.StatusUnauthorized, ""},
+		{"unsignedNeedsCSRF", httptest.NewRequest(http.MethodPost, "/api/test", nil), http.StatusForbidden, ""},
+		{"notAPI", signed("/users/bulk", "secret", "n3"), http.StatusForbidden, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestSignatureClient(t *testing.T) {
+	clock := webauth.NewFakeClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	keys := map[string]string{"admin": "secret", "user": "secret", "other": "secret"}
+	app := newAppForTest(t, []func(*webauth.Config){func(cfg *webauth.Config) {
+		withSignature(keys, "")(cfg)
+		cfg.Signature.Clients = map[string]webauth.ConfigSignatureClient{
+			"admin": {Username: "admin", Scopes: []webauth.Permission{webauth.PermViewEvents}},
+			"user":  {Username: "test", Scopes: []webauth.Permission{webauth.PermViewEvents}},
+		}
+	}}, webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	h := app.VerifySignature(http.HandlerFunc(app.APIEventsHandler))
+
+	tests := []struct {
+		name       string
+		keyID      string
+		wantStatus int
+	}{
+		{"admin", "admin", http.StatusOK},
+		{"scopeNotGranted", "user", http.StatusForbidden},
+		{"noClient", "other", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The signature is the only credential of the request.
+			r := httptest.NewRequest(http.MethodGet, webauth.APIPrefix+"/events", nil)
+			webhandler.SignRequest(r, nil, tc.keyID, []byte("secret"), tc.name, clock.Now())
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.wantStatus, w.Body)
+			}
+		})
+	}
+}
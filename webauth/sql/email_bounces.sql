@@ -0,0 +1,8 @@
+CREATE TABLE `email_bounces` (
+  `email` varchar(256) NOT NULL,
+  `kind` varchar(10) NOT NULL,
+  `reason` varchar(255) NOT NULL DEFAULT "",
+  `created` timestamp(6) NOT NULL DEFAULT current_timestamp(6),
+  PRIMARY KEY (`email`,`created`),
+  KEY `kind` (`kind`)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE `email_prefs` (
+  `username` varchar(30) NOT NULL,
+  `category` varchar(10) NOT NULL,
+  `enabled` boolean NOT NULL DEFAULT true,
+  `updated` timestamp NOT NULL DEFAULT current_timestamp() ON UPDATE current_timestamp(),
+  PRIMARY KEY (`username`,`category`)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE `incidents` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `title` varchar(100) NOT NULL,
+  `message` varchar(1000) NOT NULL DEFAULT "",
+  `created` timestamp NOT NULL DEFAULT current_timestamp(),
+  `resolved` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`id`)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE email_bounces (
+  email varchar(256) NOT NULL,
+  kind varchar(10) NOT NULL,
+  reason varchar(255) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT clock_timestamp(),
+  PRIMARY KEY (email, created)
+);
+CREATE INDEX email_bounces_kind ON email_bounces (kind);
@@ -0,0 +1,7 @@
+CREATE TABLE email_prefs (
+  username varchar(30) NOT NULL,
+  category varchar(10) NOT NULL,
+  enabled boolean NOT NULL DEFAULT true,
+  updated timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (username, category)
+);
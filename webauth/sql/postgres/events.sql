@@ -0,0 +1,8 @@
+CREATE TABLE events (
+  name varchar(10) NOT NULL,
+  succeeded boolean NOT NULL,
+  username varchar(30) NOT NULL,
+  message varchar(255) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (created, name, username)
+);
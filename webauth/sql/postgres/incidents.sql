@@ -0,0 +1,8 @@
+CREATE TABLE incidents (
+  id integer GENERATED BY DEFAULT AS IDENTITY,
+  title varchar(100) NOT NULL,
+  message varchar(1000) NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  resolved timestamptz NULL DEFAULT NULL,
+  PRIMARY KEY (id)
+);
@@ -0,0 +1,5 @@
+CREATE USER weblogin PASSWORD 'password';
+CREATE DATABASE weblogin OWNER weblogin;
+
+CREATE USER weblogin_test PASSWORD 'password';
+CREATE DATABASE weblogin_test OWNER weblogin_test;
@@ -0,0 +1,55 @@
+-- The tables are created with the initial schema and upgraded by the
+-- migrations when the tests run.
+DROP TABLE IF EXISTS schema_migrations;
+
+DROP TABLE IF EXISTS users;
+\ir users.sql
+
+INSERT INTO users(username, fullName, email, hashedPassword)
+VALUES ('test', 'Test User', 'test@email', '$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O');
+
+INSERT INTO users(username, fullName, email, hashedPassword, admin)
+VALUES ('admin', 'Admin User', 'admin@email', '$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O', true);
+
+INSERT INTO users(username, fullName, email, hashedPassword, admin, confirmed)
+VALUES ('unconfirmed', 'Unconfirmed User', 'unconfirmed@email', '$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O', true, false);
+
+INSERT INTO users(username, fullName, email, hashedPassword, admin, confirmed)
+VALUES ('confirmed', 'Unconfirmed User', 'confirmed@email', '$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O', true, true);
+
+INSERT INTO users(username, fullName, email, hashedPassword, admin, confirmed)
+VALUES ('expired', 'Expired Confirm Token', 'expired@email', '$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O', true, true);
+
+DROP TABLE IF EXISTS tokens;
+\ir tokens.sql
+
+DROP TABLE IF EXISTS email_prefs;
+\ir email_prefs.sql
+
+DROP TABLE IF EXISTS email_bounces;
+\ir email_bounces.sql
+
+DROP TABLE IF EXISTS user_identities;
+\ir user_identities.sql
+
+DROP TABLE IF EXISTS incidents;
+\ir incidents.sql
+
+DROP TABLE IF EXISTS events;
+\ir events.sql
+
+INSERT INTO events(username, created, name, succeeded)
+VALUES
+('test1', '2023-01-15 01:00:00', 'login', true),
+
+('test2', '2023-01-15 01:00:00', 'login', true),
+('test2', '2023-01-15 02:00:00', 'login', true),
+
+('test3', '2023-01-15 03:00:00', 'login', true),
+('test3', '2023-01-15 02:00:00', 'login', true),
+('test3', '2023-01-15 01:00:00', 'login', true),
+
+('test4', '2023-01-15 01:00:00', 'login', true),
+('test4', '2023-01-15 04:00:00', 'login', true),
+('test4', '2023-01-15 02:00:00', 'login', true),
+('test4', '2023-01-15 03:00:00', 'login', true);
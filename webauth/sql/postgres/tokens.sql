@@ -0,0 +1,8 @@
+CREATE TABLE tokens (
+  hashedValue char(64) NOT NULL,
+  expires timestamptz NOT NULL,
+  kind varchar(7) NOT NULL,
+  username varchar(30) NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (hashedValue)
+);
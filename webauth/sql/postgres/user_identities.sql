@@ -0,0 +1,8 @@
+CREATE TABLE user_identities (
+  provider varchar(30) NOT NULL,
+  subject varchar(255) NOT NULL,
+  username varchar(30) NOT NULL,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (provider, subject)
+);
+CREATE INDEX user_identities_username ON user_identities (username);
@@ -0,0 +1,11 @@
+CREATE TABLE users (
+  username varchar(30) NOT NULL,
+  fullName varchar(70) NOT NULL,
+  email varchar(256) NOT NULL,
+  hashedPassword char(60) NOT NULL,
+  admin boolean NOT NULL DEFAULT false,
+  confirmed boolean NOT NULL DEFAULT false,
+  created timestamptz NOT NULL DEFAULT current_timestamp,
+  PRIMARY KEY (username),
+  CONSTRAINT email UNIQUE (email)
+);
@@ -1,3 +1,7 @@
+-- The tables are created with the initial schema and upgraded by the
+-- migrations when the tests run.
+DROP TABLE IF EXISTS schema_migrations;
+
 DROP TABLE IF EXISTS users;
 source users.sql;
 
@@ -19,6 +23,18 @@ VALUES ('expired', 'Expired Confirm Token', 'expired@email', '$2a$10$2bLycFqUmc6
 DROP TABLE IF EXISTS tokens;
 source tokens.sql;
 
+DROP TABLE IF EXISTS email_prefs;
+source email_prefs.sql;
+
+DROP TABLE IF EXISTS email_bounces;
+source email_bounces.sql;
+
+DROP TABLE IF EXISTS user_identities;
+source user_identities.sql;
+
+DROP TABLE IF EXISTS incidents;
+source incidents.sql;
+
 DROP TABLE IF EXISTS events;
 source events.sql;
 
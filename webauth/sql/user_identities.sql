@@ -0,0 +1,8 @@
+CREATE TABLE `user_identities` (
+  `provider` varchar(30) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `username` varchar(30) NOT NULL,
+  `created` timestamp NOT NULL DEFAULT current_timestamp(),
+  PRIMARY KEY (`provider`,`subject`),
+  KEY `username` (`username`)
+);
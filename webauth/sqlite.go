@@ -0,0 +1,64 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sqliteTimeFormat matches the default timestamps in the SQLite migrations,
+// so times compare correctly as text.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
+
+// sqliteDSN returns the data source name to open for dsn. A dsn that is a
+// file path or file: URI has its directory created if needed. In-memory
+// databases are returned as is.
+func sqliteDSN(dsn string) (string, error) {
+	if dsn == "" {
+		return "", fmt.Errorf("empty SQLite data source name")
+	}
+
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		return dsn, nil
+	}
+
+	path := strings.TrimPrefix(dsn, "file:")
+	path, _, _ = strings.Cut(path, "?")
+	if path == "" {
+		return "", fmt.Errorf("no path in SQLite data source name %q", dsn)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", err
+	}
+
+	return dsn, nil
+}
+
+// sqliteArgs returns args with times converted to text in UTC, since SQLite
+// compares times as text.
+func sqliteArgs(args []any) []any {
+	var converted []any
+
+	for i, arg := range args {
+		t, ok := arg.(time.Time)
+		if !ok {
+			continue
+		}
+		if converted == nil {
+			converted = append([]any(nil), args...)
+		}
+		converted[i] = t.UTC().Format(sqliteTimeFormat)
+	}
+
+	if converted == nil {
+		return args
+	}
+
+	return converted
+}
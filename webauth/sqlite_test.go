@@ -0,0 +1,67 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSqliteDSN(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		dsn     string
+		wantDir string
+		wantErr bool
+	}{
+		{name: "memory", dsn: ":memory:"},
+		{name: "memoryURI", dsn: "file:test?mode=memory&cache=shared"},
+		{name: "path", dsn: filepath.Join(dir, "a", "webauth.db"), wantDir: filepath.Join(dir, "a")},
+		{name: "uri", dsn: "file:" + filepath.Join(dir, "b", "webauth.db") + "?_pragma=busy_timeout(5000)", wantDir: filepath.Join(dir, "b")},
+		{name: "empty", dsn: "", wantErr: true},
+		{name: "noPath", dsn: "file:?cache=shared", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := sqliteDSN(tc.dsn)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("sqliteDSN(%q) error = %v, wantErr %v", tc.dsn, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got != tc.dsn {
+				t.Errorf("sqliteDSN(%q) = %q, want unchanged", tc.dsn, got)
+			}
+			if tc.wantDir != "" {
+				if fi, err := os.Stat(tc.wantDir); err != nil || !fi.IsDir() {
+					t.Errorf("sqliteDSN(%q) did not create %q: %v", tc.dsn, tc.wantDir, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSqliteArgs(t *testing.T) {
+	loc := time.FixedZone("EST", -5*3600)
+	when := time.Date(2024, time.May, 1, 7, 0, 0, 123e6, loc)
+	args := []any{"user", when, 1}
+
+	got := sqliteArgs(args)
+
+	if got[1] != "2024-05-01 12:00:00.123" {
+		t.Errorf("sqliteArgs() time = %v, want %q", got[1], "2024-05-01 12:00:00.123")
+	}
+	if got[0] != "user" || got[2] != 1 {
+		t.Errorf("sqliteArgs() changed other args: %v", got)
+	}
+	if args[1] != when {
+		t.Errorf("sqliteArgs() modified its argument")
+	}
+}
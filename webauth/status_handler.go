@@ -0,0 +1,217 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webhealth"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	StatusTmpl        = "status.html"
+	StatusSummaryTmpl = "status_summary" // StatusSummaryTmpl is the cached fragment of the health of components.
+)
+
+// IncidentHistory is how long resolved incidents are shown on the status page.
+const IncidentHistory = 14 * 24 * time.Hour
+
+// StatusPageData contains data to render the status template.
+type StatusPageData struct {
+	CommonData
+	User      User
+	Summary   template.HTML // Summary is StatusSummaryTmpl rendered with StatusSummaryData.
+	Incidents []Incident
+}
+
+// StatusSummaryData contains data to render the status summary fragment.
+type StatusSummaryData struct {
+	Healthy    bool
+	Components []webhealth.Result
+}
+
+// statusComponent is the JSON form of a webhealth.Result. Errors are not
+// included since the status page is public.
+type statusComponent struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+}
+
+// statusIncident is the JSON form of an Incident.
+type statusIncident struct {
+	Title    string     `json:"title"`
+	Message  string     `json:"message"`
+	Created  time.Time  `json:"created"`
+	Resolved *time.Time `json:"resolved,omitempty"`
+}
+
+// statusJSON is the JSON form of the status page.
+type statusJSON struct {
+	Healthy    bool              `json:"healthy"`
+	Components []statusComponent `json:"components"`
+	Incidents  []statusIncident  `json:"incidents"`
+}
+
+// StatusHandler shows the health of each component from app.Checks and
+// recent incidents. The status is returned as JSON if requested.
+func (app *AuthApp) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
+		logger.Error("invalid method")
+		return
+	}
+
+	incidents, err := app.DB.RecentIncidents(app.Clock.Now().Add(-IncidentHistory))
+	if err != nil {
+		logger.Error("failed to get incidents", "err", err)
+	}
+
+	if webutil.WantsJSON(r) {
+		results := app.runChecks(r.Context(), logger)
+		data := statusJSON{
+			Healthy:    webhealth.Healthy(results),
+			Components: []statusComponent{},
+			Incidents:  []statusIncident{},
+		}
+		for _, result := range results {
+			data.Components = append(data.Components,
+				statusComponent{Name: result.Name, Healthy: result.Healthy})
+		}
+		for _, i := range incidents {
+			si := statusIncident{Title: i.Title, Message: i.Message, Created: i.Created}
+			if i.Resolved.Valid {
+				si.Resolved = &i.Resolved.Time
+			}
+			data.Incidents = append(data.Incidents, si)
+		}
+
+		err := webutil.RespondWithJSON(w, http.StatusOK, data)
+		if err != nil {
+			logger.Error("failed to write JSON", "err", err)
+		}
+		return
+	}
+
+	// The status page is public, so a missing user is not an error.
+	user, _ := app.UserFromRequest(w, r)
+
+	// The health of components is the same for all users, so it is
+	// cached to not run the checks for each request.
+	summary, err := app.Fragment(r.Context(), StatusSummaryTmpl, "", func(ctx context.Context) (any, error) {
+		results := app.runChecks(ctx, logger)
+		return StatusSummaryData{Healthy: webhealth.Healthy(results), Components: results}, nil
+	})
+	if err != nil {
+		logger.Error("failed to render summary", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.RenderPage(w, r, logger, StatusTmpl, &StatusPageData{
+		User:      user,
+		Summary:   summary,
+		Incidents: incidents,
+	})
+
+	logger.Info("done")
+}
+
+// runChecks returns the results of app.Checks, logging the unhealthy
+// components.
+func (app *AuthApp) runChecks(ctx context.Context, logger *slog.Logger) []webhealth.Result {
+	results := app.Checks.Run(ctx)
+	for _, result := range results {
+		if !result.Healthy {
+			logger.Warn("unhealthy", "name", result.Name, "err", result.Err)
+		}
+	}
+
+	return results
+}
+
+// StatusIncidentHandler allows admins to create and resolve incidents.
+// The "action" form value is either "create", with "title" and "message",
+// or "resolve", with "id".
+func (app *AuthApp) StatusIncidentHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	if !user.Can(PermManageIncidents) {
+		logger.Error("user not authorized", "user", user)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "create":
+		title := strings.TrimSpace(r.PostFormValue("title"))
+		message := strings.TrimSpace(r.PostFormValue("message"))
+		if title == "" {
+			logger.Warn("missing title")
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+
+		err = app.DB.CreateIncident(title, message)
+		if err != nil {
+			logger.Error("failed to create incident", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		app.DB.RecordEvent(NewEvent(TypeIncidentCreated, user.Username, EventDetails{"title": title}))
+
+	case "resolve":
+		id, err := strconv.ParseInt(r.PostFormValue("id"), 10, 64)
+		if err != nil {
+			logger.Warn("invalid id", "err", err)
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+
+		err = app.DB.ResolveIncident(id)
+		if errors.Is(err, ErrIncidentNotFound) {
+			logger.Warn("incident not found", "id", id)
+			webutil.Error(w, r, http.StatusNotFound, "", "")
+			return
+		}
+		if err != nil {
+			logger.Error("failed to resolve incident", "err", err, "id", id)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		app.DB.RecordEvent(NewEvent(TypeIncidentResolved, user.Username, EventDetails{"id": strconv.FormatInt(id, 10)}))
+
+	default:
+		logger.Warn("invalid action")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	http.Redirect(w, r, "/status", http.StatusSeeOther)
+
+	logger.Info("done")
+}
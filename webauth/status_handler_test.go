@@ -0,0 +1,162 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	htmltemplate "html/template"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webhealth"
+)
+
+func statusBody(t *testing.T, data webauth.StatusPageData, summary webauth.StatusSummaryData) string {
+	// Get path to template file.
+	assetDir := assets.AssetPath()
+	tmplFile := filepath.Join(assetDir, "tmpl", webauth.StatusTmpl)
+
+	// Parse the template file, checking for errors.
+	tmpl, err := template.New(filepath.Base(tmplFile)).Funcs(tmplFuncsForTest).ParseFiles(tmplFile)
+	if err != nil {
+		t.Fatalf("could not parse template file '%s': %v", tmplFile, err)
+	}
+
+	// Render the summary fragment, which the page includes.
+	var fragment bytes.Buffer
+	tmpl.ExecuteTemplate(&fragment, webauth.StatusSummaryTmpl, summary)
+	data.Summary = htmltemplate.HTML(fragment.String())
+
+	// Create a buffer to store the rendered HTML.
+	var body bytes.Buffer
+
+	// Execute the template with the data and write result to the buffer.
+	tmpl.Execute(&body, data)
+
+	return body.String()
+}
+
+func TestStatusHandler(t *testing.T) {
+	app := AppWithoutDBForTest(t)
+
+	errDown := errors.New("down")
+
+	app.Checks = &webhealth.Checks{}
+	app.Checks.Add("database", webhealth.CheckerFunc(func(context.Context) error { return nil }))
+	app.Checks.Add("email", webhealth.CheckerFunc(func(context.Context) error { return errDown }))
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/status",
+			RequestMethod: http.MethodPost,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "POST Method Not Allowed\n",
+		},
+		{
+			Name:          "json",
+			Target:        "/status?format=json",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusOK,
+			WantBody:      `{"healthy":false,"components":[{"name":"database","healthy":true},{"name":"email","healthy":false}],"incidents":[]}` + "\n",
+		},
+		{
+			Name:          "html",
+			Target:        "/status",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusOK,
+			WantBody: statusBody(t, webauth.StatusPageData{
+				CommonData: webauth.CommonData{Title: app.Cfg.App.Name},
+			}, webauth.StatusSummaryData{
+				Components: []webhealth.Result{
+					{Name: "database", Healthy: true},
+					{Name: "email", Healthy: false},
+				},
+			}),
+		},
+	}
+
+	webhandler.TestHandler(t, app.StatusHandler, tests)
+}
+
+func TestStatusIncidentHandler(t *testing.T) {
+	app := AppForTest(t)
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	adminCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: adminToken.Value}}
+	userCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: userToken.Value}}
+
+	tests := []webhandler.TestCase{
+		{
+			Name:           "notAdmin",
+			Target:         "/status/incidents",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: userCookie,
+			RequestBody:    "action=create&title=outage",
+			WantStatus:     http.StatusUnauthorized,
+			WantBody:       "Error: Unauthorized\n",
+		},
+		{
+			Name:           "missingTitle",
+			Target:         "/status/incidents",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "action=create",
+			WantStatus:     http.StatusBadRequest,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:           "create",
+			Target:         "/status/incidents",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "action=create&title=outage&message=investigating",
+			WantStatus:     http.StatusSeeOther,
+		},
+		{
+			Name:           "resolveMissing",
+			Target:         "/status/incidents",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "action=resolve&id=999999",
+			WantStatus:     http.StatusNotFound,
+			WantBody:       "Error: Not Found\n",
+		},
+	}
+
+	webhandler.TestHandler(t, app.StatusIncidentHandler, tests)
+
+	incidents, err := app.DB.RecentIncidents(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("RecentIncidents() failed: %v", err)
+	}
+	if len(incidents) == 0 || incidents[0].Title != "outage" || incidents[0].Resolved.Valid {
+		t.Fatalf("RecentIncidents() = %+v, want open outage first", incidents)
+	}
+
+	if err := app.DB.ResolveIncident(incidents[0].ID); err != nil {
+		t.Errorf("ResolveIncident() failed: %v", err)
+	}
+}
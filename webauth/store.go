@@ -0,0 +1,251 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+)
+
+// UserStore stores users and their hashed passwords.
+type UserStore interface {
+	UserForName(username string) (User, error)
+	UserExists(username string) (bool, error)
+	EmailExists(email string) (bool, error)
+	UsernameForEmail(email string) (string, error)
+	HashedPassword(username string) (string, error)
+	SetHashedPassword(username, hashedPassword string) error
+	ResetPassword(username, resetToken, hashedPassword string) error
+	CheckPassword(username, password string) error
+	RegisterUser(username, fullName, email, password string) error
+	BootstrapAdmin(username, fullName, email, password string) (bool, error)
+	ConfirmUser(username, ctoken string) error
+	GetUsers() ([]User, error)
+	ListUsers(q ListQuery) ([]User, int, error)
+	RenameUser(username, newUsername string) error
+	UsernameHistory(username string) ([]UsernameChange, error)
+	UsernameForOldName(oldName string, since time.Time) (string, error)
+	DisableUsers(usernames []string) ([]BulkResult, error)
+	DeleteUsers(usernames []string) ([]BulkResult, error)
+	UpdateUserFullName(username, fullName string) error
+	UpdateUserEmail(username, email string) error
+	SetPendingEmail(username, email string) error
+	PendingEmail(username string) (string, error)
+}
+
+// TokenStore stores hashed tokens, such as login and confirm tokens.
+type TokenStore interface {
+	CreateToken(kind, username string, size int, duration string) (Token, error)
+	RemoveToken(kind, value string) error
+	UserForLoginToken(loginToken string) (User, error)
+	UserForLoginTokenContext(ctx context.Context, loginToken string) (User, error)
+	UsernameForResetToken(tokenValue string) (string, error)
+	UsernameForConfirmToken(tokenValue string) (string, error)
+	UsernameForMagicToken(tokenValue string) (string, error)
+	UsernameForDeleteToken(tokenValue string) (string, error)
+	UsernameForEmailToken(tokenValue string) (string, error)
+	Tokens(username string) ([]TokenInfo, error)
+	TokenForFingerprint(fingerprint string) (TokenInfo, error)
+	RemoveTokenForFingerprint(fingerprint string) error
+	SetLastActive(lastActive map[string]time.Time) error
+	RemoveIdleSessions(cutoff time.Time) (int, error)
+}
+
+// SessionStore stores the values of login sessions.
+type SessionStore interface {
+	SessionValue(loginToken, key string) (string, error)
+	SetSessionValue(loginToken, key, value string) error
+	DeleteSessionValue(loginToken, key string) error
+	PurgeSessionValues() (int, error)
+}
+
+// EventStore stores events, such as logins.
+type EventStore interface {
+	WriteEvent(name EventName, succeeded bool, username, message string) error
+	RecordEvent(e Event) error
+	GetEvents() ([]Event, error)
+	ListEvents(q ListQuery) ([]Event, int, error)
+	EventsNamed(name EventName, limit int) ([]Event, error)
+	EventsForUser(username string) ([]Event, error)
+	LastLoginForUser(username string) (time.Time, string, error)
+	ResendCount(username string, since time.Time) (int, time.Time, error)
+}
+
+// EmailStore stores email preferences and bounces.
+type EmailStore interface {
+	EmailPrefs(username string) (EmailPrefs, error)
+	SetEmailPref(username string, category EmailCategory, enabled bool) error
+	RecordBounce(b Bounce) error
+	EmailSuppressed(email string) (bool, error)
+	BounceKinds() (map[string]BounceKind, error)
+}
+
+// IncidentStore stores status page incidents.
+type IncidentStore interface {
+	CreateIncident(title, message string) error
+	ResolveIncident(id int64) error
+	RecentIncidents(since time.Time) ([]Incident, error)
+}
+
+// AnnouncementStore stores announcements scheduled for live stream topics.
+type AnnouncementStore interface {
+	ScheduleAnnouncement(topic, message string, publishAt time.Time) error
+	CancelAnnouncement(id int64) error
+	MarkAnnouncementSent(id int64) error
+	Announcements(since time.Time) ([]Announcement, error)
+	DueAnnouncements(now time.Time) ([]Announcement, error)
+}
+
+// IdentityStore stores links between users and OAuth identities.
+type IdentityStore interface {
+	UsernameForIdentity(provider, subject string) (string, error)
+	LinkIdentity(provider, subject, username string) error
+	CreateUserForIdentity(id OAuthIdentity, username string) error
+}
+
+// PrefStore stores named preferences of users.
+type PrefStore interface {
+	Pref(username, name string) (string, error)
+	SetPref(username, name, value string) error
+	DeletePref(username, name string) error
+	PrefNames(username, prefix string) ([]string, error)
+}
+
+// RateLimitStore counts requests for rate limits.
+type RateLimitStore interface {
+	CountRequest(key string, window time.Time) (int, error)
+	RateLimitUsage(since time.Time) ([]RateLimitUsage, error)
+	PurgeRateLimits(before time.Time) (int, error)
+}
+
+// FormNonceStore stores single-use nonces of sensitive forms.
+type FormNonceStore interface {
+	CreateFormNonce(form string, duration time.Duration) (string, error)
+	UseFormNonce(form, value string) error
+}
+
+// CSPReportStore stores Content Security Policy violations.
+type CSPReportStore interface {
+	RecordCSPViolation(directive, blockedURI string, when time.Time) error
+	CSPReports() ([]CSPReport, error)
+}
+
+// RoleStore stores roles, their permissions, and the users granted them.
+type RoleStore interface {
+	Roles() ([]Role, error)
+	UserRoles(username string) ([]Role, error)
+	SaveRole(role Role) error
+	DeleteRole(name string) error
+	GrantRole(username, name string) error
+	RevokeRole(username, name string) error
+}
+
+// APITokenStore stores named API tokens with scopes.
+type APITokenStore interface {
+	CreateAPIToken(username, name string, scopes []Permission, expires time.Time) (Token, error)
+	APITokens(username string) ([]APIToken, error)
+	RevokeAPIToken(username, id string) error
+	UserForAPIToken(ctx context.Context, value string) (User, []Permission, error)
+}
+
+// RefreshTokenStore stores refresh tokens, which are spent when used.
+type RefreshTokenStore interface {
+	CreateRefreshToken(username string, remember bool, expires time.Time) (Token, error)
+	UseRefreshToken(value string) (RefreshToken, error)
+	RevokeSessions(username string) error
+}
+
+// AccountDeletionStore schedules and purges accounts deleted by their
+// users.
+type AccountDeletionStore interface {
+	ScheduleDeletion(username string, at time.Time) error
+	DeletionScheduled(username string) (time.Time, error)
+	DueDeletions(now time.Time) ([]string, error)
+	PurgeUser(username string) error
+}
+
+// ReportStore stores the reports of account activity.
+type ReportStore interface {
+	EventCounts(since, until time.Time) (map[EventName]int, error)
+	SaveReport(r Report) error
+	Report(period ReportPeriod, start time.Time) (Report, error)
+	Reports(period ReportPeriod) ([]Report, error)
+}
+
+// RetentionStore removes data older than its retention period.
+type RetentionStore interface {
+	CountExpired(category RetentionCategory, cutoff time.Time) (int, error)
+	PurgeExpired(category RetentionCategory, cutoff time.Time) (int, error)
+}
+
+// InstanceStore is the registry of the running instances of an app.
+type InstanceStore interface {
+	Heartbeat(inst Instance) error
+	Instances(since time.Time) ([]Instance, error)
+	RemoveInstance(id string) error
+	PurgeInstances(before time.Time) (int, error)
+}
+
+// RouteStateStore saves the states of routes set by admins.
+type RouteStateStore interface {
+	SetRouteState(s RouteState) error
+	RouteStates() ([]RouteState, error)
+	RemoveRouteState(pattern string) error
+}
+
+// WaitlistStore stores the users held for approval by the waitlist.
+type WaitlistStore interface {
+	WaitlistedUsers() ([]User, error)
+	ApproveUsers(usernames []string) ([]BulkResult, error)
+}
+
+// LockStore grants locks shared by the instances of an app, so that a
+// scheduled job runs on only one of them.
+type LockStore interface {
+	// TryLock acquires the lock of name for ttl and returns true, or
+	// returns false if another holds it. A lock is only released when
+	// its ttl expires.
+	TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error)
+}
+
+// AuthStore is the datastore used by an AuthApp. AuthDB is the SQL
+// implementation and MemStore keeps data in memory, e.g., for tests.
+type AuthStore interface {
+	UserStore
+	TokenStore
+	SessionStore
+	EventStore
+	EmailStore
+	IncidentStore
+	AnnouncementStore
+	IdentityStore
+	PrefStore
+	RateLimitStore
+	FormNonceStore
+	CSPReportStore
+	RoleStore
+	APITokenStore
+	RefreshTokenStore
+	AccountDeletionStore
+	ReportStore
+	RetentionStore
+	LockStore
+	InstanceStore
+	RouteStateStore
+	SearchStore
+	SearchIndex
+	WaitlistStore
+	audit.Store
+
+	// PingContext verifies the datastore is available.
+	PingContext(ctx context.Context) error
+}
+
+// Verify the implementations satisfy AuthStore.
+var (
+	_ AuthStore = (*AuthDB)(nil)
+	_ AuthStore = (*MemStore)(nil)
+)
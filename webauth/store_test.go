@@ -0,0 +1,323 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+	_ "modernc.org/sqlite"
+)
+
+// storesForTest returns the implementations of AuthStore, each empty and
+// using clock: a MemStore and an AuthDB with an in-memory SQLite
+// database, which needs no database server.
+func storesForTest(t *testing.T, clock webauth.Clock) map[string]webauth.AuthStore {
+	t.Helper()
+
+	mem := webauth.NewMemStore()
+	mem.SetClock(clock)
+
+	db, err := webauth.InitDB("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to init SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetClock(clock)
+
+	return map[string]webauth.AuthStore{"MemStore": mem, "AuthDB": db}
+}
+
+// testStores runs test against each of storesForTest, so the
+// implementations of AuthStore behave the same.
+func testStores(t *testing.T, test func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock)) {
+	for _, name := range []string{"MemStore", "AuthDB"} {
+		t.Run(name, func(t *testing.T) {
+			clock := webauth.NewFakeClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+			test(t, storesForTest(t, clock)[name], clock)
+		})
+	}
+}
+
+// registerForTest registers the users in usernames with the password
+// "password".
+func registerForTest(t *testing.T, store webauth.AuthStore, usernames ...string) {
+	t.Helper()
+
+	for _, username := range usernames {
+		err := store.RegisterUser(username, "Full "+username, username+"@email", "password")
+		if err != nil {
+			t.Fatalf("RegisterUser(%q) failed: %v", username, err)
+		}
+	}
+}
+
+func TestStoreUsers(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, _ *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		for _, tc := range []struct{ username, email string }{
+			{"USER", "other@email"},
+			{"other", "user@email"},
+		} {
+			err := store.RegisterUser(tc.username, "Full Name", tc.email, "password")
+			if !errors.Is(err, webauth.ErrDuplicateKey) {
+				t.Errorf("RegisterUser(%q, %q) = %v, want %v", tc.username, tc.email, err, webauth.ErrDuplicateKey)
+			}
+		}
+
+		user, err := store.UserForName("user")
+		if err != nil || user.Username != "user" || user.Email != "user@email" || user.FullName != "Full user" {
+			t.Errorf("UserForName() = %+v, %v, want user", user, err)
+		}
+		if _, err := store.UserForName("missing"); !errors.Is(err, webauth.ErrUserNotFound) {
+			t.Errorf("UserForName(missing) = %v, want %v", err, webauth.ErrUserNotFound)
+		}
+
+		if ok, err := store.UserExists("user"); !ok || err != nil {
+			t.Errorf("UserExists() = %v, %v, want true", ok, err)
+		}
+		if ok, err := store.EmailExists("user@email"); !ok || err != nil {
+			t.Errorf("EmailExists() = %v, %v, want true", ok, err)
+		}
+		if username, err := store.UsernameForEmail("user@email"); username != "user" || err != nil {
+			t.Errorf("UsernameForEmail() = %q, %v, want user", username, err)
+		}
+
+		if err := store.CheckPassword("user", "password"); err != nil {
+			t.Errorf("CheckPassword() = %v, want nil", err)
+		}
+		if err := store.CheckPassword("user", "wrong"); err == nil {
+			t.Error("CheckPassword(wrong) = nil, want error")
+		}
+
+		if err := store.UpdateUserFullName("user", "New Name"); err != nil {
+			t.Fatalf("UpdateUserFullName() failed: %v", err)
+		}
+		if user, _ := store.UserForName("user"); user.FullName != "New Name" {
+			t.Errorf("FullName = %q, want %q", user.FullName, "New Name")
+		}
+	})
+}
+
+func TestStoreBulkUsers(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, _ *webauth.FakeClock) {
+		registerForTest(t, store, "a", "b")
+
+		results, err := store.DisableUsers([]string{"a", "missing"})
+		if err != nil {
+			t.Fatalf("DisableUsers() failed: %v", err)
+		}
+		if len(results) != 2 || results[0].Err != nil || !errors.Is(results[1].Err, webauth.ErrUserNotFound) {
+			t.Errorf("DisableUsers() = %+v, want a disabled and missing not found", results)
+		}
+		if user, _ := store.UserForName("a"); !user.Disabled {
+			t.Error("user a not disabled")
+		}
+		if user, _ := store.UserForName("b"); user.Disabled {
+			t.Error("user b disabled")
+		}
+	})
+}
+
+func TestStoreLoginTokens(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		token, err := store.CreateToken(webauth.LoginTokenKind, "user", webauth.LoginTokenSize, "1h")
+		if err != nil {
+			t.Fatalf("CreateToken() failed: %v", err)
+		}
+
+		user, err := store.UserForLoginToken(token.Value)
+		if err != nil || user.Username != "user" {
+			t.Errorf("UserForLoginToken() = %q, %v, want user", user.Username, err)
+		}
+		if _, err := store.UserForLoginToken("missing"); !errors.Is(err, webauth.ErrUserLoginTokenNotFound) {
+			t.Errorf("UserForLoginToken(missing) = %v, want %v", err, webauth.ErrUserLoginTokenNotFound)
+		}
+
+		clock.Advance(time.Hour + time.Second)
+		if _, err := store.UserForLoginToken(token.Value); !errors.Is(err, webauth.ErrUserLoginTokenExpired) {
+			t.Errorf("UserForLoginToken(expired) = %v, want %v", err, webauth.ErrUserLoginTokenExpired)
+		}
+	})
+}
+
+func TestStoreRefreshTokens(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		token, err := store.CreateRefreshToken("user", true, clock.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() failed: %v", err)
+		}
+
+		rt, err := store.UseRefreshToken(token.Value)
+		if err != nil || rt.Username != "user" || !rt.Remember {
+			t.Errorf("UseRefreshToken() = %+v, %v, want user remembered", rt, err)
+		}
+		if _, err := store.UseRefreshToken("missing"); !errors.Is(err, webauth.ErrRefreshTokenNotFound) {
+			t.Errorf("UseRefreshToken(missing) = %v, want %v", err, webauth.ErrRefreshTokenNotFound)
+		}
+
+		expired, err := store.CreateRefreshToken("user", false, clock.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() failed: %v", err)
+		}
+		clock.Advance(time.Hour)
+		if _, err := store.UseRefreshToken(expired.Value); !errors.Is(err, webauth.ErrRefreshTokenExpired) {
+			t.Errorf("UseRefreshToken(expired) = %v, want %v", err, webauth.ErrRefreshTokenExpired)
+		}
+	})
+}
+
+func TestStoreEvents(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, _ *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		if err := store.WriteEvent(webauth.EventLogin, true, "user", "ok"); err != nil {
+			t.Fatalf("WriteEvent() failed: %v", err)
+		}
+		if err := store.WriteEvent(webauth.EventLogin, false, "other", "bad"); err != nil {
+			t.Fatalf("WriteEvent() failed: %v", err)
+		}
+
+		events, err := store.EventsForUser("user")
+		if err != nil || len(events) != 1 || events[0].Message != "ok" || !events[0].Succeeded {
+			t.Errorf("EventsForUser() = %+v, %v, want the login of user", events, err)
+		}
+	})
+}
+
+func TestStorePrefs(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, _ *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		if _, err := store.Pref("user", "theme"); !errors.Is(err, webauth.ErrPrefNotFound) {
+			t.Errorf("Pref(missing) = %v, want %v", err, webauth.ErrPrefNotFound)
+		}
+
+		for _, value := range []string{"dark", "light"} {
+			if err := store.SetPref("user", "theme", value); err != nil {
+				t.Fatalf("SetPref() failed: %v", err)
+			}
+			if got, err := store.Pref("user", "theme"); got != value || err != nil {
+				t.Errorf("Pref() = %q, %v, want %q", got, err, value)
+			}
+		}
+
+		if err := store.DeletePref("user", "theme"); err != nil {
+			t.Fatalf("DeletePref() failed: %v", err)
+		}
+		if _, err := store.Pref("user", "theme"); !errors.Is(err, webauth.ErrPrefNotFound) {
+			t.Errorf("Pref(deleted) = %v, want %v", err, webauth.ErrPrefNotFound)
+		}
+	})
+}
+
+func TestStoreRoles(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, _ *webauth.FakeClock) {
+		registerForTest(t, store, "user")
+
+		role := webauth.Role{Name: "viewer", Permissions: []webauth.Permission{webauth.PermViewUsers, webauth.PermViewEvents}}
+		if err := store.SaveRole(role); err != nil {
+			t.Fatalf("SaveRole() failed: %v", err)
+		}
+		if err := store.GrantRole("user", "viewer"); err != nil {
+			t.Fatalf("GrantRole() failed: %v", err)
+		}
+		if err := store.GrantRole("user", "missing"); !errors.Is(err, webauth.ErrRoleNotFound) {
+			t.Errorf("GrantRole(missing) = %v, want %v", err, webauth.ErrRoleNotFound)
+		}
+
+		roles, err := store.UserRoles("user")
+		want := []webauth.Permission{webauth.PermViewEvents, webauth.PermViewUsers}
+		if err != nil || len(roles) != 1 || roles[0].Name != "viewer" || !slices.Equal(roles[0].Permissions, want) {
+			t.Errorf("UserRoles() = %+v, %v, want viewer with %v", roles, err, want)
+		}
+	})
+}
+
+func TestStoreFormNonces(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock) {
+		nonce, err := store.CreateFormNonce("form", time.Minute)
+		if err != nil {
+			t.Fatalf("CreateFormNonce() failed: %v", err)
+		}
+
+		if err := store.UseFormNonce("other", nonce); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+			t.Errorf("UseFormNonce(other form) = %v, want %v", err, webauth.ErrFormNonceInvalid)
+		}
+		if err := store.UseFormNonce("form", nonce); err != nil {
+			t.Errorf("UseFormNonce() = %v, want nil", err)
+		}
+		if err := store.UseFormNonce("form", nonce); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+			t.Errorf("UseFormNonce(used) = %v, want %v", err, webauth.ErrFormNonceInvalid)
+		}
+
+		expired, err := store.CreateFormNonce("form", time.Minute)
+		if err != nil {
+			t.Fatalf("CreateFormNonce() failed: %v", err)
+		}
+		clock.Advance(time.Minute)
+		if err := store.UseFormNonce("form", expired); !errors.Is(err, webauth.ErrFormNonceInvalid) {
+			t.Errorf("UseFormNonce(expired) = %v, want %v", err, webauth.ErrFormNonceInvalid)
+		}
+	})
+}
+
+func TestStoreRouteStates(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock) {
+		states := []webauth.RouteState{
+			{Pattern: "GET /b", Canary: 10, UpdatedBy: "admin", Updated: clock.Now()},
+			{Pattern: "GET /a", Disabled: true, Message: "Back soon.", UpdatedBy: "admin", Updated: clock.Now()},
+		}
+		for _, s := range states {
+			if err := store.SetRouteState(s); err != nil {
+				t.Fatalf("SetRouteState() failed: %v", err)
+			}
+		}
+		if err := store.RemoveRouteState("GET /b"); err != nil {
+			t.Fatalf("RemoveRouteState() failed: %v", err)
+		}
+
+		got, err := store.RouteStates()
+		if err != nil || len(got) != 1 || got[0].Pattern != "GET /a" || !got[0].Disabled || got[0].Message != "Back soon." {
+			t.Errorf("RouteStates() = %+v, %v, want GET /a disabled", got, err)
+		}
+	})
+}
+
+func TestStoreWaitlist(t *testing.T) {
+	testStores(t, func(t *testing.T, store webauth.AuthStore, clock *webauth.FakeClock) {
+		registerForTest(t, store, "before")
+		store.(interface{ SetWaitlist(bool) }).SetWaitlist(true)
+		registerForTest(t, store, "first")
+		clock.Advance(time.Minute)
+		registerForTest(t, store, "second")
+
+		users, err := store.WaitlistedUsers()
+		if err != nil || len(users) != 2 || users[0].Username != "first" || users[1].Username != "second" {
+			t.Fatalf("WaitlistedUsers() = %+v, %v, want first and second", users, err)
+		}
+
+		results, err := store.ApproveUsers([]string{"first", "before", "missing"})
+		if err != nil {
+			t.Fatalf("ApproveUsers() failed: %v", err)
+		}
+		if len(results) != 3 || results[0].Err != nil ||
+			!errors.Is(results[1].Err, webauth.ErrNotWaitlisted) || !errors.Is(results[2].Err, webauth.ErrUserNotFound) {
+			t.Errorf("ApproveUsers() = %+v, want first approved", results)
+		}
+
+		users, err = store.WaitlistedUsers()
+		if err != nil || len(users) != 1 || users[0].Username != "second" {
+			t.Errorf("WaitlistedUsers() = %+v, %v, want second", users, err)
+		}
+	})
+}
@@ -0,0 +1,444 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// TableColumn is a column of an admin table.
+type TableColumn struct {
+	Name  string // Name identifies the column in a TableView.
+	Label string // Label is shown to the user.
+}
+
+// Table is an admin table that can be shown with a TableView.
+type Table struct {
+	Name    string     // Name identifies the table in saved view names.
+	Path    string     // Path of the page that shows the table.
+	Perm    Permission // Perm is required to view the table.
+	Columns []TableColumn
+
+	// SQL maps the names of the columns kept in the datastore to their
+	// SQL columns. Only these columns can be sorted by.
+	SQL map[string]string
+
+	// Search are the names of the text columns matched by a filter.
+	Search []string
+
+	// Order is the SQL order of rows not sorted by a column.
+	Order string
+}
+
+// Tables that can be shown with a TableView.
+var (
+	UsersTable = Table{
+		Name: "users",
+		Path: "/users",
+		Perm: PermViewUsers,
+		Columns: []TableColumn{
+			{"username", "User Name"},
+			{"fullName", "Full Name"},
+			{"email", "Email"},
+			{"emailStatus", "Email Status"},
+			{"admin", "IsAdmin"},
+			{"disabled", "Disabled"},
+			{"created", "Created"},
+		},
+		SQL: map[string]string{
+			"username": "username",
+			"fullName": "fullName",
+			"email":    "email",
+			"admin":    "admin",
+			"disabled": "disabled",
+			"created":  "created",
+		},
+		Search: []string{"username", "fullName", "email"},
+		Order:  "username",
+	}
+	EventsTable = Table{
+		Name: "events",
+		Path: "/events",
+		Perm: PermViewEvents,
+		Columns: []TableColumn{
+			{"name", "Name"},
+			{"type", "Type"},
+			{"succeeded", "Succeeded"},
+			{"username", "Username"},
+			{"message", "Message"},
+			{"created", "Created"},
+		},
+		SQL: map[string]string{
+			"name":      "name",
+			"type":      "type",
+			"succeeded": "succeeded",
+			"username":  "username",
+			"message":   "message",
+			"created":   "created",
+		},
+		Search: []string{"name", "type", "username", "message"},
+		Order:  "created DESC",
+	}
+)
+
+// TablePageSize is the number of rows on each page of a Table.
+const TablePageSize = 50
+
+// tables are the tables by name.
+var tables = map[string]Table{
+	UsersTable.Name:  UsersTable,
+	EventsTable.Name: EventsTable,
+}
+
+// URL returns the path of t with query, if any.
+func (t Table) URL(query string) string {
+	if query == "" {
+		return t.Path
+	}
+	return t.Path + "?" + query
+}
+
+// HasColumn returns true if t has a column with name.
+func (t Table) HasColumn(name string) bool {
+	return slices.ContainsFunc(t.Columns, func(c TableColumn) bool {
+		return c.Name == name
+	})
+}
+
+// Sortable returns true if t can be sorted by the column with name.
+func (t Table) Sortable(name string) bool {
+	_, ok := t.SQL[name]
+	return ok
+}
+
+// TableView is a filter, sort order, and set of columns used to show a
+// Table. It is encoded in the URL query, so a view can be shared as a link.
+type TableView struct {
+	Filter  string   // Filter shows rows with a text value that contains it.
+	Sort    string   // Sort is the name of the column to sort by.
+	Desc    bool     // Desc sorts in descending order.
+	Columns []string // Columns to show. If empty, all are shown.
+	Page    int      // Page of rows to show, from 1. It is not saved.
+}
+
+// ParseView returns the TableView for t from the URL query q, ignoring
+// unknown columns.
+func (t Table) ParseView(q url.Values) TableView {
+	v := TableView{Filter: strings.TrimSpace(q.Get("q"))}
+
+	if sort := q.Get("sort"); t.Sortable(sort) {
+		v.Sort = sort
+	}
+	if page, err := strconv.Atoi(q.Get("page")); err == nil && page > 1 {
+		v.Page = page
+	}
+	v.Desc, _ = strconv.ParseBool(q.Get("desc"))
+
+	for _, cols := range q["cols"] {
+		for _, col := range strings.Split(cols, ",") {
+			if t.HasColumn(col) && !slices.Contains(v.Columns, col) {
+				v.Columns = append(v.Columns, col)
+			}
+		}
+	}
+
+	return v
+}
+
+// Query returns v encoded as a URL query, without the leading "?".
+func (v TableView) Query() string {
+	q := url.Values{}
+	if v.Filter != "" {
+		q.Set("q", v.Filter)
+	}
+	if v.Sort != "" {
+		q.Set("sort", v.Sort)
+	}
+	if v.Desc {
+		q.Set("desc", "true")
+	}
+	if len(v.Columns) > 0 {
+		q.Set("cols", strings.Join(v.Columns, ","))
+	}
+
+	return q.Encode()
+}
+
+// Show returns true if the column with name is shown.
+func (v TableView) Show(name string) bool {
+	return len(v.Columns) == 0 || slices.Contains(v.Columns, name)
+}
+
+// PageQuery returns the query of page of v, without the leading "?".
+func (v TableView) PageQuery(page int) string {
+	query := v.Query()
+	if page <= 1 {
+		return query
+	}
+	if query != "" {
+		query += "&"
+	}
+	return query + "page=" + strconv.Itoa(page)
+}
+
+// ListQuery returns the query for the rows of the page of v.
+func (v TableView) ListQuery() ListQuery {
+	return ListQuery{
+		Search: v.Filter,
+		Sort:   v.Sort,
+		Desc:   v.Desc,
+		Limit:  TablePageSize,
+		Offset: (max(v.Page, 1) - 1) * TablePageSize,
+	}
+}
+
+// ListQuery selects the rows of a Table from the datastore.
+type ListQuery struct {
+	Search string // Search matches rows with a Search column that contains it.
+	Sort   string // Sort is the name of a column in Table.SQL.
+	Desc   bool   // Desc sorts in descending order.
+	Limit  int    // Limit is the number of rows, or 0 for all.
+	Offset int    // Offset is the number of rows to skip.
+}
+
+// likeEscape escapes the wildcards of s for a LIKE pattern with the
+// escape character "!", which is the same in each Dialect.
+var likeEscape = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// sqlClauses returns the WHERE and ORDER BY clauses of q for t, with the
+// arguments of the WHERE clause. Unknown sort columns use t.Order.
+func (t Table) sqlClauses(q ListQuery) (where string, args []any, order string) {
+	if q.Search != "" {
+		pattern := "%" + likeEscape.Replace(strings.ToLower(q.Search)) + "%"
+
+		conds := make([]string, 0, len(t.Search))
+		for _, col := range t.Search {
+			conds = append(conds, "LOWER("+t.SQL[col]+") LIKE ? ESCAPE '!'")
+			args = append(args, pattern)
+		}
+		where = " WHERE " + strings.Join(conds, " OR ")
+	}
+
+	order = " ORDER BY " + t.Order
+	if col, ok := t.SQL[q.Sort]; ok {
+		order = " ORDER BY " + col
+		if q.Desc {
+			order += " DESC"
+		}
+	}
+
+	if q.Limit > 0 {
+		order += " LIMIT " + strconv.Itoa(q.Limit) + " OFFSET " + strconv.Itoa(max(q.Offset, 0))
+	}
+
+	return where, args, order
+}
+
+// listRows returns the page of rows of t selected by q and the number of
+// rows that match. The value of a column for a row is returned by value.
+// The rows are in the default order of t. It is used by MemStore, like
+// sqlClauses is used by AuthDB.
+func listRows[T any](t Table, q ListQuery, rows []T, value func(row T, col string) string) ([]T, int) {
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		rows = slices.DeleteFunc(slices.Clone(rows), func(row T) bool {
+			for _, col := range t.Search {
+				if strings.Contains(strings.ToLower(value(row, col)), search) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+
+	if t.Sortable(q.Sort) {
+		rows = slices.Clone(rows)
+		slices.SortStableFunc(rows, func(a, b T) int {
+			n := cmp.Compare(value(a, q.Sort), value(b, q.Sort))
+			if q.Desc {
+				return -n
+			}
+			return n
+		})
+	}
+
+	total := len(rows)
+	if q.Limit > 0 {
+		start := min(max(q.Offset, 0), total)
+		rows = rows[start:min(start+q.Limit, total)]
+	}
+
+	return rows, total
+}
+
+// sortableTime is the format of times compared by listRows, which sorts
+// in time order.
+const sortableTime = "2006-01-02 15:04:05"
+
+// ViewData contains data to render the controls of a TableView.
+type ViewData struct {
+	Table     Table
+	View      TableView
+	Saved     []string // Saved are the names of the saved views.
+	CSRFToken string   // CSRFToken is for the form to save a view.
+	Live      bool     // Live is true if new rows are added by the page.
+	LiveMax   int      // LiveMax is the number of rows the page can add.
+	Total     int      // Total is the number of rows that match the view.
+}
+
+// Show returns true if the column with name is shown.
+func (d ViewData) Show(name string) bool {
+	return d.View.Show(name)
+}
+
+// Page returns the page of rows shown, from 1.
+func (d ViewData) Page() int {
+	return max(d.View.Page, 1)
+}
+
+// Pages returns the number of pages of rows, at least 1.
+func (d ViewData) Pages() int {
+	return max((d.Total+TablePageSize-1)/TablePageSize, 1)
+}
+
+// PrevURL returns the URL of the previous page, or "" if there is none.
+func (d ViewData) PrevURL() string {
+	if d.Page() <= 1 {
+		return ""
+	}
+	return d.Table.URL(d.View.PageQuery(d.Page() - 1))
+}
+
+// NextURL returns the URL of the next page, or "" if there is none.
+func (d ViewData) NextURL() string {
+	if d.Page() >= d.Pages() {
+		return ""
+	}
+	return d.Table.URL(d.View.PageQuery(d.Page() + 1))
+}
+
+// viewPrefPrefix returns the prefix of the preference names of the saved
+// views for t.
+func viewPrefPrefix(t Table) string {
+	return "view:" + t.Name + ":"
+}
+
+// MaxViewNameLen is the maximum length of the name of a saved view.
+const MaxViewNameLen = 50
+
+var ErrViewNotFound = errors.New("view not found")
+
+// viewData returns the view of t for the request r by admin. If the view
+// query parameter names a saved view, the query of that view is returned
+// instead, and the caller should redirect to it.
+func (app *AuthApp) viewData(r *http.Request, admin User, t Table) (ViewData, string, error) {
+	prefix := viewPrefPrefix(t)
+
+	if name := r.URL.Query().Get("view"); name != "" {
+		query, err := app.DB.Pref(admin.Username, prefix+name)
+		if errors.Is(err, ErrPrefNotFound) {
+			return ViewData{}, "", ErrViewNotFound
+		}
+		return ViewData{}, query, err
+	}
+
+	names, err := app.DB.PrefNames(admin.Username, prefix)
+	if err != nil {
+		return ViewData{}, "", err
+	}
+	for i := range names {
+		names[i] = strings.TrimPrefix(names[i], prefix)
+	}
+
+	return ViewData{
+		Table:     t,
+		View:      t.ParseView(r.URL.Query()),
+		Saved:     names,
+		CSRFToken: webhandler.CSRFToken(r.Context()),
+		Live:      app.Live != nil,
+		LiveMax:   MaxLiveRows,
+	}, "", nil
+}
+
+// SavedViewHandler saves or deletes a named view of the table in the path
+// for the admin making the request. The request must be a POST with the
+// action ("save" or "delete"), name, and the view query.
+func (app *AuthApp) SavedViewHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	// Check if the HTTP method is valid.
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	admin, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	t, ok := tables[r.PathValue("table")]
+	if !ok {
+		logger.Warn("unknown table", "table", r.PathValue("table"))
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	}
+
+	if !admin.Can(t.Perm) {
+		logger.Error("user not authorized", "user", admin)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	action := r.PostFormValue("action")
+	logger = logger.With("table", t.Name, "name", name, "action", action)
+
+	if name == "" || len(name) > MaxViewNameLen {
+		logger.Warn("invalid view name")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	// Parse the query to only save a valid view.
+	q, err := url.ParseQuery(r.PostFormValue("view"))
+	if err != nil {
+		logger.Warn("invalid view", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+	query := t.ParseView(q).Query()
+
+	switch action {
+	case "save":
+		err = app.DB.SetPref(admin.Username, viewPrefPrefix(t)+name, query)
+	case "delete":
+		err = app.DB.DeletePref(admin.Username, viewPrefPrefix(t)+name)
+		query = ""
+	default:
+		logger.Warn("invalid action")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+	if err != nil {
+		logger.Error("failed to update saved view", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	http.Redirect(w, r, t.URL(query), http.StatusSeeOther)
+
+	logger.Info("done")
+}
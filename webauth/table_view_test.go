@@ -0,0 +1,244 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestParseView(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  webauth.TableView
+		enc   string
+	}{
+		{"empty", "", webauth.TableView{}, ""},
+		{
+			name:  "all",
+			query: "q=+admin+&sort=email&desc=1&cols=email&cols=username,created",
+			want: webauth.TableView{
+				Filter: "admin", Sort: "email", Desc: true,
+				Columns: []string{"email", "username", "created"},
+			},
+			enc: "cols=email%2Cusername%2Ccreated&desc=true&q=admin&sort=email",
+		},
+		{
+			name:  "unknownColumns",
+			query: "sort=password&cols=password,email,email",
+			want:  webauth.TableView{Columns: []string{"email"}},
+			enc:   "cols=email",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tc.query)
+
+			got := webauth.UsersTable.ParseView(q)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseView(%q) = %+v, want %+v", tc.query, got, tc.want)
+			}
+			if enc := got.Query(); enc != tc.enc {
+				t.Errorf("Query() = %q, want %q", enc, tc.enc)
+			}
+		})
+	}
+}
+
+func TestTableViewShow(t *testing.T) {
+	all := webauth.TableView{}
+	if !all.Show("email") {
+		t.Errorf("Show() = false for view without columns, want true")
+	}
+
+	some := webauth.TableView{Columns: []string{"username"}}
+	if !some.Show("username") || some.Show("email") {
+		t.Errorf("Show() does not match columns %q", some.Columns)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	store := StoreForTest(t)
+
+	tests := []struct {
+		name      string
+		q         webauth.ListQuery
+		want      []string
+		wantTotal int
+	}{
+		{"all", webauth.ListQuery{}, []string{"admin", "confirmed", "expired", "test", "unconfirmed"}, 5},
+		{"page", webauth.ListQuery{Limit: 2, Offset: 2}, []string{"expired", "test"}, 5},
+		{"pastEnd", webauth.ListQuery{Limit: 2, Offset: 10}, nil, 5},
+		{"search", webauth.ListQuery{Search: "CONFIRMED"}, []string{"confirmed", "unconfirmed"}, 2},
+		{"sortDesc", webauth.ListQuery{Sort: "email", Desc: true, Limit: 2}, []string{"unconfirmed", "test"}, 5},
+		{"unsortable", webauth.ListQuery{Sort: "emailStatus", Limit: 1}, []string{"admin"}, 5},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			users, total, err := store.ListUsers(tc.q)
+			if err != nil {
+				t.Fatalf("ListUsers() error = %v", err)
+			}
+
+			var got []string
+			for _, u := range users {
+				got = append(got, u.Username)
+			}
+			if !reflect.DeepEqual(got, tc.want) || total != tc.wantTotal {
+				t.Errorf("ListUsers() = %q, %d, want %q, %d", got, total, tc.want, tc.wantTotal)
+			}
+		})
+	}
+}
+
+func TestUsersHandlerPages(t *testing.T) {
+	store := StoreForTest(t)
+	for i := range webauth.TablePageSize {
+		name := fmt.Sprintf("user%02d", i)
+		u := webauth.User{Username: name, Email: name + "@email"}
+		if err := store.AddUser(u, TestPasswordHash); err != nil {
+			t.Fatalf("failed to add user: %v", err)
+		}
+	}
+	app := newAppForTest(t, nil, webauth.WithDB(store))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+
+	w := requestAs(app.UsersHandler, adminToken.Value, http.MethodGet, "/users?sort=username", "")
+	body := w.Body.String()
+	if !strings.Contains(body, "Page 1 of 2") || !strings.Contains(body, `href="/users?sort=username&amp;page=2"`) {
+		t.Errorf("first page missing link to next page")
+	}
+	if strings.Contains(body, "<td>user45</td>") {
+		t.Errorf("first page shows user from second page")
+	}
+
+	w = requestAs(app.UsersHandler, adminToken.Value, http.MethodGet, "/users?sort=username&page=2", "")
+	body = w.Body.String()
+	if !strings.Contains(body, "<td>user45</td>") || strings.Contains(body, "<td>admin</td>") {
+		t.Errorf("second page does not show the remaining users")
+	}
+	if !strings.Contains(body, `href="/users?sort=username"`) {
+		t.Errorf("second page missing link to previous page")
+	}
+}
+
+// getAs requests target from h as the user with token.
+func requestAs(h http.HandlerFunc, token, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token})
+	w := httptest.NewRecorder()
+
+	h(w, r)
+
+	return w
+}
+
+func TestUsersHandlerView(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+
+	w := requestAs(app.UsersHandler, adminToken.Value, http.MethodGet, "/users?q=CONFIRMED&sort=username&desc=true&cols=username", "")
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Filter matches confirmed and unconfirmed, sorted descending.
+	un := strings.Index(body, "<td>unconfirmed</td>")
+	c := strings.Index(body, "<td>confirmed</td>")
+	if un < 0 || c < 0 || un > c {
+		t.Errorf("filtered users missing or not sorted descending")
+	}
+	if strings.Contains(body, "<td>test</td>") {
+		t.Errorf("filter did not remove test user")
+	}
+	if strings.Contains(body, "<td>confirmed@email</td>") {
+		t.Errorf("hidden email column shown")
+	}
+}
+
+func TestSavedViewHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	view := url.QueryEscape("q=fail&sort=created&cols=name,bogus")
+	tests := []struct {
+		name         string
+		token        string
+		target       string
+		body         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"notAdmin", userToken.Value, "/views/events", "action=save&name=x&view=" + view, http.StatusUnauthorized, ""},
+		{"unknownTable", adminToken.Value, "/views/secrets", "action=save&name=x&view=" + view, http.StatusNotFound, ""},
+		{"missingName", adminToken.Value, "/views/events", "action=save&name=+&view=" + view, http.StatusBadRequest, ""},
+		{"invalidAction", adminToken.Value, "/views/events", "action=share&name=x&view=" + view, http.StatusBadRequest, ""},
+		{"save", adminToken.Value, "/views/events", "action=save&name=failures&view=" + view, http.StatusSeeOther, "/events?cols=name&q=fail&sort=created"},
+		{"saveOther", adminToken.Value, "/views/events", "action=save&name=all&view=", http.StatusSeeOther, "/events"},
+		{"delete", adminToken.Value, "/views/events", "action=delete&name=all", http.StatusSeeOther, "/events"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /views/{table}", app.SavedViewHandler)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := requestAs(mux.ServeHTTP, tc.token, http.MethodPost, tc.target, tc.body)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tc.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tc.wantLocation)
+			}
+		})
+	}
+
+	// The saved view is listed and opens its URL.
+	w := requestAs(app.EventsHandler, adminToken.Value, http.MethodGet, "/events", "")
+	if !strings.Contains(w.Body.String(), `<option value="failures">failures</option>`) {
+		t.Errorf("saved view not listed")
+	}
+	if strings.Contains(w.Body.String(), `<option value="all">`) {
+		t.Errorf("deleted view listed")
+	}
+
+	w = requestAs(app.EventsHandler, adminToken.Value, http.MethodGet, "/events?view=failures", "")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/events?cols=name&q=fail&sort=created" {
+		t.Errorf("open view = %d %q, want redirect to view", w.Code, w.Header().Get("Location"))
+	}
+
+	w = requestAs(app.EventsHandler, adminToken.Value, http.MethodGet, "/events?view=missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("open missing view status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
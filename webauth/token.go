@@ -5,9 +5,11 @@ package webauth
 
 import (
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -32,7 +34,7 @@ func (db *AuthDB) CreateToken(kind, username string, size int, duration string)
 
 	token := Token{Kind: kind}
 
-	token.Value, err = GenerateRandomString(size)
+	token.Value, err = RandomStringFrom(randReader(db.Rand), size)
 	if err != nil {
 		return Token{}, err
 	}
@@ -41,16 +43,16 @@ func (db *AuthDB) CreateToken(kind, username string, size int, duration string)
 	if err != nil {
 		return Token{}, err
 	}
-	token.Expires = time.Now().Add(d)
+	token.Expires = db.now().Add(d)
 	slog.Debug("SaveNewToken",
 		"duration", duration, "d", d.String(), "expires", token.Expires.String())
 
 	// hash the token to avoid reuse if database is compromised
 	hashedValue := Hash(token.Value)
 
-	// Insert token into database but ensure username exists.
-	qry := `INSERT INTO tokens (hashedValue, expires, kind, username) SELECT ?, ?, ?, ? FROM users WHERE EXISTS (SELECT 1 FROM users WHERE username = ?) LIMIT 1`
-	result, err := db.Exec(qry, hashedValue, token.Expires, kind, username, username)
+	// Insert token into database for the id of username, if it exists.
+	qry := `INSERT INTO tokens (hashedValue, expires, kind, user_id) SELECT ?, ?, ?, id FROM users WHERE username = ?`
+	result, err := db.Exec(qry, hashedValue, token.Expires, kind, username)
 	if err != nil {
 		return Token{}, err
 	}
@@ -89,3 +91,145 @@ func (db *AuthDB) RemoveToken(kind, value string) error {
 
 	return nil
 }
+
+// TokenFingerprintLen is the length of a token fingerprint.
+const TokenFingerprintLen = 16
+
+// MinTokenFingerprintLen is the shortest prefix of a fingerprint accepted
+// by TokenForFingerprint.
+const MinTokenFingerprintLen = 8
+
+var ErrTokenAmbiguous = errors.New("token fingerprint matches more than one token")
+
+// TokenFingerprint returns the fingerprint of the token with value, which
+// is the start of its hash. The fingerprint identifies a token in logs and
+// support requests without revealing the value.
+func TokenFingerprint(value string) string {
+	return Hash(value)[:TokenFingerprintLen]
+}
+
+// IsTokenFingerprint returns true if s could be the prefix of a
+// fingerprint accepted by TokenForFingerprint.
+func IsTokenFingerprint(s string) bool {
+	if len(s) < MinTokenFingerprintLen || len(s) > TokenFingerprintLen {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenInfo describes a saved token without its value.
+type TokenInfo struct {
+	Fingerprint string
+	Kind        string
+	Username    string
+	Name        string // Name is only set for API tokens.
+	Expires     time.Time
+	Created     time.Time
+	LastActive  time.Time // LastActive is zero if the token was not used.
+
+	hashedValue string
+}
+
+// scanTokenInfos returns the tokens in rows of hashed value, kind,
+// username, name, expires, created, and last active.
+func scanTokenInfos(rows *sql.Rows) ([]TokenInfo, error) {
+	defer rows.Close()
+
+	var tokens []TokenInfo
+	for rows.Next() {
+		var (
+			t          TokenInfo
+			lastActive sql.NullTime
+		)
+		if err := rows.Scan(&t.hashedValue, &t.Kind, &t.Username, &t.Name, &t.Expires, &t.Created, &lastActive); err != nil {
+			return nil, err
+		}
+		t.LastActive = lastActive.Time
+		t.Fingerprint = t.hashedValue[:TokenFingerprintLen]
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Tokens returns the tokens of username, or of all users if username is
+// empty, with the newest first.
+func (db *AuthDB) Tokens(username string) ([]TokenInfo, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT t.hashedValue, t.kind, u.username, t.name, t.expires, t.created, t.last_active FROM tokens t JOIN users u ON u.id = t.user_id WHERE ? = '' OR u.username = ? ORDER BY t.created DESC, t.hashedValue`
+	rows, err := db.Query(qry, username, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanTokenInfos(rows)
+}
+
+// TokenForFingerprint returns the token whose fingerprint starts with
+// fingerprint. It returns ErrTokenAmbiguous if more than one token
+// matches.
+func (db *AuthDB) TokenForFingerprint(fingerprint string) (TokenInfo, error) {
+	if db == nil {
+		return TokenInfo{}, ErrInvalidDB
+	}
+
+	if !IsTokenFingerprint(fingerprint) {
+		return TokenInfo{}, ErrTokenNotFound
+	}
+
+	qry := `SELECT t.hashedValue, t.kind, u.username, t.name, t.expires, t.created, t.last_active FROM tokens t JOIN users u ON u.id = t.user_id WHERE t.hashedValue LIKE ? LIMIT 2`
+	rows, err := db.Query(qry, fingerprint+"%")
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	tokens, err := scanTokenInfos(rows)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	return oneToken(tokens)
+}
+
+// oneToken returns the only token in tokens.
+func oneToken(tokens []TokenInfo) (TokenInfo, error) {
+	switch len(tokens) {
+	case 0:
+		return TokenInfo{}, ErrTokenNotFound
+	case 1:
+		return tokens[0], nil
+	}
+	return TokenInfo{}, ErrTokenAmbiguous
+}
+
+// RemoveTokenForFingerprint removes the token returned by
+// TokenForFingerprint.
+func (db *AuthDB) RemoveTokenForFingerprint(fingerprint string) error {
+	t, err := db.TokenForFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec("DELETE FROM tokens WHERE hashedValue = ?", t.hashedValue)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestIsTokenFingerprint(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"0123abcd", true},
+		{"0123456789abcdef", true},
+		{"0123abc", false},
+		{"0123456789abcdef0", false},
+		{"0123ABCD", false},
+		{"0123abcg", false},
+	}
+
+	for _, tc := range tests {
+		if got := webauth.IsTokenFingerprint(tc.s); got != tc.want {
+			t.Errorf("IsTokenFingerprint(%q) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestMemStoreTokenFingerprint(t *testing.T) {
+	store := StoreForTest(t)
+
+	login, err := store.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1h")
+	if err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+	if _, err := store.CreateToken(webauth.LoginTokenKind, "admin", webauth.LoginTokenSize, "1h"); err != nil {
+		t.Fatalf("CreateToken() failed: %v", err)
+	}
+
+	tokens, err := store.Tokens("test")
+	if err != nil {
+		t.Fatalf("Tokens() failed: %v", err)
+	}
+	fp := webauth.TokenFingerprint(login.Value)
+	if len(tokens) != 1 || tokens[0].Fingerprint != fp || tokens[0].Username != "test" || tokens[0].Kind != webauth.LoginTokenKind {
+		t.Fatalf("Tokens() = %+v, want login token %s of test", tokens, fp)
+	}
+
+	all, err := store.Tokens("")
+	if err != nil || len(all) != 2 {
+		t.Errorf("Tokens() for all users = %d tokens, %v, want 2", len(all), err)
+	}
+
+	got, err := store.TokenForFingerprint(fp[:webauth.MinTokenFingerprintLen])
+	if err != nil || got.Fingerprint != fp {
+		t.Errorf("TokenForFingerprint() = %+v, %v, want %s", got, err, fp)
+	}
+	if _, err := store.TokenForFingerprint(fp[:webauth.MinTokenFingerprintLen-1]); !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("TokenForFingerprint() for short prefix = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+
+	if err := store.RemoveTokenForFingerprint(fp); err != nil {
+		t.Errorf("RemoveTokenForFingerprint() = %v, want nil", err)
+	}
+	if _, err := store.UserForLoginToken(login.Value); err == nil {
+		t.Errorf("UserForLoginToken() succeeded for removed token")
+	}
+	if err := store.RemoveTokenForFingerprint(fp); !errors.Is(err, webauth.ErrTokenNotFound) {
+		t.Errorf("RemoveTokenForFingerprint() again = %v, want %v", err, webauth.ErrTokenNotFound)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+)
+
+// Tx is a transaction of an AuthDB. Like AuthDB, its queries and their
+// arguments are rebound for the dialect of the AuthDB.
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+// Exec executes a query without returning any rows.
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.Rebind(query), tx.dialect.bindArgs(args)...)
+}
+
+// Query executes a query that returns rows.
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.Rebind(query), tx.dialect.bindArgs(args)...)
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.Rebind(query), tx.dialect.bindArgs(args)...)
+}
+
+// WithTx calls fn within a transaction, so that the queries of fn are
+// applied together or not at all. The transaction is committed if fn
+// returns nil and is rolled back if fn returns an error or panics.
+func (db *AuthDB) WithTx(fn func(tx *Tx) error) error {
+	if db == nil {
+		return ErrInvalidDB
+	}
+
+	sqlTx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	if err := fn(&Tx{Tx: sqlTx, dialect: db.Dialect}); err != nil {
+		return err
+	}
+
+	return sqlTx.Commit()
+}
@@ -4,36 +4,43 @@
 package webauth
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents in the application.
 type User struct {
+	ID              string // ID identifies the user, even if renamed.
 	Username        string
 	FullName        string
 	Email           string
 	IsAdmin         bool
 	Confirmed       bool
+	Disabled        bool // Disabled users cannot login.
+	Waitlisted      bool // Waitlisted users cannot login until approved.
 	Created         time.Time
 	LastLoginTime   time.Time
-	LastLoginResult string // TODO: implement as bool?
+	LastLoginResult string       // TODO: implement as bool?
+	Roles           []string     // Roles granted, set by UserFromRequest.
+	Permissions     []Permission // Permissions of Roles, set by UserFromRequest.
 }
 
 // LogValue implements slog.LogValuer to group User fields in log output.
 func (u User) LogValue() slog.Value {
 	return slog.GroupValue(
+		slog.String("ID", u.ID),
 		slog.String("Username", u.Username),
 		slog.String("Fullname", u.FullName),
 		slog.String("Email", u.Email),
 		slog.Bool("IsAdmin", u.IsAdmin),
 		slog.Bool("Confirmed", u.Confirmed),
+		slog.Bool("Disabled", u.Disabled),
+		slog.Bool("Waitlisted", u.Waitlisted),
 		slog.Time("Created", u.Created),
 		slog.Time("LastLoginTime", u.LastLoginTime),
 		slog.String("LastLoginResult", u.LastLoginResult),
@@ -50,12 +57,20 @@ var (
 	ErrConfirmTokenExpired       = errors.New("confirm token expired")
 	ErrUserGetLastLoginFailed    = errors.New("failed to get user last login")
 	ErrMissingConfirmToken       = errors.New("empty confirm token")
+	ErrUserDisabled              = errors.New("user disabled")
+	ErrUserWaitlisted            = errors.New("user waitlisted")
 )
 
 var EmptyUser User // EmptyUser is a empty User used when returning a error.
 
 // UserForLoginToken returns a user for the given loginToken.
 func (db *AuthDB) UserForLoginToken(loginToken string) (User, error) {
+	return db.UserForLoginTokenContext(context.Background(), loginToken)
+}
+
+// UserForLoginTokenContext is like UserForLoginToken but the query is
+// canceled if ctx is done.
+func (db *AuthDB) UserForLoginTokenContext(ctx context.Context, loginToken string) (User, error) {
 	var (
 		expires time.Time
 		user    User
@@ -67,22 +82,22 @@ func (db *AuthDB) UserForLoginToken(loginToken string) (User, error) {
 		return EmptyUser, ErrInvalidDB
 	}
 
-	qry := `SELECT users.username, fullName, email, expires, admin, confirmed, users.created FROM users INNER JOIN tokens ON users.username=tokens.username WHERE tokens.kind = ? AND hashedValue=? LIMIT 1`
-	result := db.QueryRow(qry, LoginTokenKind, hashedValue)
-	err := result.Scan(&user.Username, &user.FullName, &user.Email, &expires, &user.IsAdmin, &user.Confirmed, &user.Created)
+	qry := `SELECT users.id, users.username, fullName, email, expires, admin, confirmed, users.created FROM users INNER JOIN tokens ON users.id=tokens.user_id WHERE tokens.kind = ? AND hashedValue=? LIMIT 1`
+	result := db.QueryRowContext(ctx, qry, LoginTokenKind, hashedValue)
+	err := result.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &expires, &user.IsAdmin, &user.Confirmed, &user.Created)
 	if err != nil {
 		// Return custom error if login not found
 		if errors.Is(err, sql.ErrNoRows) {
 			slog.Warn("unexpected",
 				"err", ErrUserLoginTokenNotFound,
-				"loginToken", loginToken)
+				"fingerprint", TokenFingerprint(loginToken))
 			return EmptyUser, ErrUserLoginTokenNotFound
 		}
 		return EmptyUser, err
 	}
 
 	// Check if login token is expired.
-	if expires.Before(time.Now()) {
+	if expires.Before(db.now()) {
 		slog.Warn("unexpected",
 			slog.Any("err", ErrUserLoginTokenExpired),
 			slog.Time("expires", expires),
@@ -92,7 +107,7 @@ func (db *AuthDB) UserForLoginToken(loginToken string) (User, error) {
 		err := db.RemoveToken(LoginTokenKind, loginToken)
 		if err != nil {
 			slog.Error("failed to remove login token",
-				"loginToken", loginToken, "err", err)
+				"fingerprint", TokenFingerprint(loginToken), "err", err)
 		}
 
 		return EmptyUser, ErrUserLoginTokenExpired
@@ -110,9 +125,9 @@ func (db *AuthDB) UserForLoginToken(loginToken string) (User, error) {
 func (db *AuthDB) UserForName(username string) (User, error) {
 	var user User
 
-	qry := `SELECT username, fullName, email, admin FROM users WHERE username=? LIMIT 1`
+	qry := `SELECT id, username, fullName, email, admin, confirmed, disabled, waitlisted FROM users WHERE username=? LIMIT 1`
 	result := db.QueryRow(qry, username)
-	err := result.Scan(&user.Username, &user.FullName, &user.Email, &user.IsAdmin)
+	err := result.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Confirmed, &user.Disabled, &user.Waitlisted)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return EmptyUser, ErrUserNotFound
@@ -159,7 +174,7 @@ func (db *AuthDB) UsernameForResetToken(tokenValue string) (string, error) {
 	var expires time.Time
 	hashedValue := Hash(tokenValue)
 
-	qry := `SELECT username, expires FROM tokens WHERE kind="reset" AND hashedValue=?`
+	qry := `SELECT users.username, tokens.expires FROM tokens JOIN users ON tokens.user_id = users.id WHERE kind='reset' AND hashedValue=?`
 	row := db.QueryRow(qry, hashedValue)
 	err := row.Scan(&username, &expires)
 	if err != nil {
@@ -170,7 +185,7 @@ func (db *AuthDB) UsernameForResetToken(tokenValue string) (string, error) {
 	}
 
 	// check if token is expired
-	if expires.Before(time.Now()) {
+	if expires.Before(db.now()) {
 		db.RemoveToken("reset", tokenValue)
 		return "", ErrResetPasswordTokenExpired
 	}
@@ -194,7 +209,7 @@ func (db *AuthDB) UsernameForConfirmToken(tokenValue string) (string, error) {
 	var expires time.Time
 	hashedValue := Hash(tokenValue)
 
-	qry := `SELECT tokens.username, tokens.expires FROM tokens JOIN users ON tokens.username = users.username WHERE kind="confirm" AND hashedValue=? LIMIT 1`
+	qry := `SELECT users.username, tokens.expires FROM tokens JOIN users ON tokens.user_id = users.id WHERE kind='confirm' AND hashedValue=? LIMIT 1`
 	row := db.QueryRow(qry, hashedValue)
 	err := row.Scan(&username, &expires)
 	if err != nil {
@@ -205,7 +220,7 @@ func (db *AuthDB) UsernameForConfirmToken(tokenValue string) (string, error) {
 	}
 
 	// Check if token is expired.
-	if expires.Before(time.Now()) {
+	if expires.Before(db.now()) {
 		db.RemoveToken("confirm", tokenValue)
 		return "", ErrConfirmTokenExpired
 	}
@@ -231,14 +246,6 @@ func (db *AuthDB) HashedPassword(username string) (string, error) {
 	return hashedPassword, nil
 }
 
-// comparePasswords compares the hashed password with the given password.
-func comparePasswords(hashedPassword, password string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidPassword, err)
-	}
-	return nil
-}
-
 // CheckPassword validates the password for a user.
 func (db *AuthDB) CheckPassword(username, password string) error {
 	if db == nil {
@@ -250,7 +257,7 @@ func (db *AuthDB) CheckPassword(username, password string) error {
 		return err
 	}
 
-	if err := comparePasswords(hashedPassword, password); err != nil {
+	if err := comparePasswordsWith(db.Hasher, hashedPassword, password); err != nil {
 		return err
 	}
 
@@ -258,57 +265,210 @@ func (db *AuthDB) CheckPassword(username, password string) error {
 }
 
 // RegisterUser registers a user with the given values.
-// Returns nil on success or an error on failure.
+// Returns ErrDuplicateKey if the username or email is taken, or another
+// error on failure.
 func (db *AuthDB) RegisterUser(username, fullName, email, password string) error {
 	// hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hasherOrDefault(db.Hasher).Hash(password)
 	if err != nil {
 		return err
 	}
 
-	// store the user and hashed password
-	_, err = db.Exec("INSERT INTO users(username, hashedPassword, fullName, email) VALUES (?, ?, ?, ?)",
-		username, hashedPassword, fullName, email)
+	id, err := db.newID()
 	if err != nil {
 		return err
 	}
 
+	// store the user and hashed password
+	_, err = db.Exec("INSERT INTO users(id, username, hashedPassword, fullName, email, waitlisted) VALUES (?, ?, ?, ?, ?, ?)",
+		id, username, hashedPassword, fullName, email, db.Waitlist)
+	if err != nil {
+		return db.Dialect.duplicateKey(err)
+	}
+
 	return nil
 }
 
+// BootstrapAdmin registers a confirmed admin with the given values, if
+// there are no users, and returns true, or returns false if there are.
+func (db *AuthDB) BootstrapAdmin(username, fullName, email, password string) (bool, error) {
+	hashedPassword, err := hasherOrDefault(db.Hasher).Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	id, err := db.newID()
+	if err != nil {
+		return false, err
+	}
+
+	created := false
+	err = db.WithTx(func(tx *Tx) error {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		_, err := tx.Exec("INSERT INTO users(id, username, hashedPassword, fullName, email, admin, confirmed) VALUES (?, ?, ?, ?, ?, true, true)",
+			id, username, hashedPassword, fullName, email)
+		created = err == nil
+		return err
+	})
+
+	return created, err
+}
+
+var ErrUsernameTaken = errors.New("username already exists")
+
+// RenameUser changes username to newUsername and records the old username
+// in the username history. Tokens, email preferences, identities, and
+// events refer to the user by ID, so they are kept.
+//
+// If username does not exist, ErrUserNotFound is returned. If newUsername
+// belongs to another user, ErrUsernameTaken is returned.
+func (db *AuthDB) RenameUser(username, newUsername string) error {
+	return db.WithTx(func(tx *Tx) error {
+		const qry = "SELECT id, username FROM users WHERE username = ?"
+
+		var id, oldUsername string
+		err := tx.QueryRow(qry, username).Scan(&id, &oldUsername)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		// Allow a change in case only, which matches the same user.
+		var otherID, otherUsername string
+		err = tx.QueryRow(qry, newUsername).Scan(&otherID, &otherUsername)
+		if err == nil && otherID != id {
+			return ErrUsernameTaken
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET username = ? WHERE id = ?", newUsername, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO username_history(user_id, username, changed) VALUES (?, ?, ?)", id, oldUsername, db.now())
+		return err
+	})
+}
+
+// SetHashedPassword replaces the hashed password for username.
+func (db *AuthDB) SetHashedPassword(username, hashedPassword string) error {
+	_, err := db.Exec("UPDATE users SET hashedPassword = ? WHERE username = ?", hashedPassword, username)
+	return err
+}
+
+// ResetPassword replaces the hashed password for username with the reset
+// token resetToken, in one transaction. The token is removed, so that it
+// cannot be used again, along with the other reset tokens of username.
+//
+// If resetToken is not an unexpired reset token of username, e.g., it was
+// already used, ErrTokenNotFound is returned and the password is kept.
+func (db *AuthDB) ResetPassword(username, resetToken, hashedPassword string) error {
+	return db.WithTx(func(tx *Tx) error {
+		id, err := db.useToken(tx, "reset", username, resetToken)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET hashedPassword = ? WHERE id = ?", hashedPassword, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM tokens WHERE kind = 'reset' AND user_id = ?", id)
+		return err
+	})
+}
+
+// useToken removes the unexpired token of kind with value for username
+// within tx and returns the id of username. If the token is not found,
+// e.g., it was already used, ErrTokenNotFound is returned.
+func (db *AuthDB) useToken(tx *Tx, kind, username, value string) (string, error) {
+	var id string
+	err := tx.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	result, err := tx.Exec("DELETE FROM tokens WHERE kind = ? AND hashedValue = ? AND user_id = ? AND expires >= ?", kind, Hash(value), id, db.now())
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if rows != 1 {
+		return "", ErrTokenNotFound
+	}
+
+	return id, nil
+}
+
 // LastLoginForUser retrieves the last login time and result for a given username.  It returns zero values in case of no previous login.
 func (db *AuthDB) LastLoginForUser(username string) (time.Time, string, error) {
 	var lastLogin time.Time
-	var success string
+	var succeeded bool
 
 	if db == nil {
-		return lastLogin, success, errors.New("invalid db")
+		return lastLogin, "", errors.New("invalid db")
 	}
 
 	// get the second row, if it exists, since first row is current login
-	qry := `SELECT created, succeeded FROM events WHERE username = ? AND name = ? ORDER BY created DESC LIMIT 1 OFFSET 1`
-	row := db.QueryRow(qry, username, EventLogin)
-	err := row.Scan(&lastLogin, &success)
+	qry := `SELECT created, succeeded FROM events WHERE ` + eventsForUser + ` AND name = ? ORDER BY created DESC LIMIT 1 OFFSET 1`
+	row := db.QueryRow(qry, username, username, EventLogin)
+	err := row.Scan(&lastLogin, &succeeded)
 	if err != nil {
 		// ignore ErrNoRows since there may not be a last login
 		if errors.Is(err, sql.ErrNoRows) {
-			return lastLogin, success, nil
+			return lastLogin, "", nil
 		}
-		return lastLogin, success, err
+		return lastLogin, "", err
+	}
+
+	// Use the same result for all dialects, which scan booleans differently.
+	success := "0"
+	if succeeded {
+		success = "1"
 	}
 
 	return lastLogin, success, nil
 }
 
+// LoginTokenCookieName is the name of the login cookie, after
+// HostCookiePrefix if Security.Hardened is set.
 const LoginTokenCookieName = "login"
 
 // UserFromRequest returns the user for the login token cookie in the request.
 // If the login token is invalid or expired, the cookie is removed and
-// an empty user returned.
-func (db *AuthDB) UserFromRequest(w http.ResponseWriter, r *http.Request) (User, error) {
+// an empty user returned. A cookie in an older format is re-issued in the
+// current format, or removed if the format is no longer accepted.
+func (app *AuthApp) UserFromRequest(w http.ResponseWriter, r *http.Request) (User, error) {
 	// Get value of the login token cookie from the request.
-	loginToken, err := CookieValue(r, LoginTokenCookieName)
-	if err != nil {
+	loginToken, version, err := app.loginCookieToken(r)
+	switch {
+	case errors.Is(err, ErrCookieTooNew):
+		// Keep the cookie for the newer instance that wrote it.
+		return User{}, nil
+	case errors.Is(err, ErrCookieTooOld):
+		app.clearLoginCookie(w)
+		return User{}, nil
+	case err != nil:
 		return User{}, err
 	}
 
@@ -317,15 +477,16 @@ func (db *AuthDB) UserFromRequest(w http.ResponseWriter, r *http.Request) (User,
 		return User{}, err
 	}
 
-	// Get user associated with the login token.
-	user, err := db.UserForLoginToken(loginToken)
+	// Get user associated with the login token, with their roles.
+	user, err := app.sessionUser(r.Context(), loginToken)
 	if err != nil {
+		// Keep the cookie if the request deadline expired.
+		if r.Context().Err() != nil {
+			return User{}, err
+		}
+
 		// Clear cookie if login is invalid or expired token.
-		http.SetCookie(w, &http.Cookie{
-			Name:   LoginTokenCookieName,
-			Value:  "",
-			MaxAge: -1,
-		})
+		app.clearLoginCookie(w)
 
 		// Ignore login not found or expired errors.
 		if errors.Is(err, ErrUserLoginTokenNotFound) || errors.Is(err, ErrUserLoginTokenExpired) {
@@ -335,21 +496,31 @@ func (db *AuthDB) UserFromRequest(w http.ResponseWriter, r *http.Request) (User,
 		return User{}, err
 	}
 
-	return user, err
+	// Record the activity of the session, saved later in a batch.
+	app.activity.record(Hash(loginToken), app.Clock.Now())
+
+	// Upgrade the cookie if it is in an older format.
+	if app.cookies.reissue(version) {
+		if err := app.reissueLoginCookie(w, loginToken); err != nil {
+			return User{}, err
+		}
+	}
+
+	return user, nil
 }
 
-// ConfirmUser updates database to indicate user confirmed their email.
+// ConfirmUser updates database to indicate user confirmed their email and
+// removes the confirm token ctoken, in one transaction. If ctoken is not an
+// unexpired confirm token of username, ErrTokenNotFound is returned and
+// the user is not confirmed.
 func (db *AuthDB) ConfirmUser(username, ctoken string) error {
-	const qry = "UPDATE users SET confirmed = true WHERE username = ? AND confirmed = false"
-	_, err := db.Exec(qry, username)
-	if err != nil {
-		return err
-	}
+	return db.WithTx(func(tx *Tx) error {
+		id, err := db.useToken(tx, "confirm", username, ctoken)
+		if err != nil {
+			return err
+		}
 
-	err = db.RemoveToken("confirm", ctoken)
-	if err != nil {
+		_, err = tx.Exec("UPDATE users SET confirmed = true WHERE id = ?", id)
 		return err
-	}
-
-	return nil
+	})
 }
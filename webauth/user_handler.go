@@ -12,9 +12,12 @@ import (
 
 // UserPageData contains data passed to the HTML template.
 type UserPageData struct {
-	Title   string
-	Message string
-	User    User
+	Title     string
+	Message   string
+	User      User
+	Providers []OAuthProvider // Providers can be linked to the user.
+
+	DeleteEnabled bool // DeleteEnabled is true if users can delete their account.
 }
 
 // UserGetHandler shows user information.
@@ -24,22 +27,22 @@ func (app *AuthApp) UserGetHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the HTTP method is valid.
 	if r.Method != http.MethodGet {
-		webutil.RespondWithError(w, http.StatusMethodNotAllowed)
+		webutil.Error(w, r, http.StatusMethodNotAllowed, "", "")
 		logger.Error("invalid method")
 		return
 	}
 
 	// Attempt to get the user from the request.
-	user, err := app.DB.UserFromRequest(w, r)
+	user, err := app.UserFromRequest(w, r)
 	if err != nil {
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		logger.Error("failed to get user from request", "err", err)
 		return
 	}
 
 	// Render the template with the data.
 	err = webutil.RenderTemplateOrError(app.Tmpl, w, "user.html",
-		UserPageData{Message: "", User: user, Title: app.Cfg.App.Name})
+		UserPageData{Message: "", User: user, Title: app.Cfg.App.Name, Providers: app.OAuthProviders(), DeleteEnabled: app.deleteGrace > 0})
 	if err != nil {
 		logger.Error("failed to render template", "err", err)
 		return
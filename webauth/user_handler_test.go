@@ -21,7 +21,7 @@ func userBody(data webauth.UserPageData) string {
 	tmplFile := filepath.Join(assetDir, "tmpl", "user.html")
 
 	// Parse the HTML template from a file.
-	tmpl := template.Must(template.ParseFiles(tmplFile))
+	tmpl := template.Must(template.New(filepath.Base(tmplFile)).Funcs(tmplFuncsForTest).ParseFiles(tmplFile))
 
 	// Create a buffer to store the rendered HTML.
 	var body bytes.Buffer
@@ -79,8 +79,9 @@ func TestUserGetHandler(t *testing.T) {
 			WantCookies: []http.Cookie{
 				{
 					Name:   "login",
+					Path:   "/",
 					MaxAge: -1,
-					Raw:    "login=; Max-Age=0",
+					Raw:    "login=; Path=/; Max-Age=0",
 				},
 			},
 		},
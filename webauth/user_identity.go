@@ -0,0 +1,133 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxUsernameLen is the maximum length of a username, as defined by the
+// users table.
+const MaxUsernameLen = 30
+
+var ErrUsernameUnavailable = errors.New("no username available")
+
+// UsernameForIdentity returns the username linked to the subject at
+// provider.
+//
+// If not found, ErrUserNotFound is returned.
+func (db *AuthDB) UsernameForIdentity(provider, subject string) (string, error) {
+	var username string
+
+	const qry = "SELECT users.username FROM user_identities JOIN users ON user_identities.user_id = users.id WHERE provider = ? AND subject = ?"
+	err := db.QueryRow(qry, provider, subject).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+
+	return username, nil
+}
+
+// LinkIdentity links the subject at provider to username.
+//
+// If username does not exist, ErrUserNotFound is returned, and if the
+// subject is already linked, ErrDuplicateKey.
+func (db *AuthDB) LinkIdentity(provider, subject, username string) error {
+	const qry = "INSERT INTO user_identities(provider, subject, user_id) SELECT ?, ?, id FROM users WHERE username = ?"
+	result, err := db.Exec(qry, provider, subject, username)
+	if err != nil {
+		return db.Dialect.duplicateKey(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CreateUserForIdentity registers username for id and links id to it. The
+// user is given a random password, so they can only login with the provider
+// until they reset it. The user is confirmed if the provider verified the
+// email.
+func (db *AuthDB) CreateUserForIdentity(id OAuthIdentity, username string) error {
+	password, err := RandomStringFrom(randReader(db.Rand), 32)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hasherOrDefault(db.Hasher).Hash(password)
+	if err != nil {
+		return err
+	}
+
+	userID, err := db.newID()
+	if err != nil {
+		return err
+	}
+
+	fullName := id.Name
+	if fullName == "" {
+		fullName = username
+	}
+
+	return db.WithTx(func(tx *Tx) error {
+		_, err := tx.Exec("INSERT INTO users(id, username, hashedPassword, fullName, email, confirmed, waitlisted) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			userID, username, hashedPassword, fullName, id.Email, id.EmailVerified, db.Waitlist)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO user_identities(provider, subject, user_id) VALUES (?, ?, ?)",
+			id.Provider, id.Subject, userID)
+		return err
+	})
+}
+
+// AvailableUsername returns a username, based on want, that is not in use.
+// Characters other than letters, digits, '.', '-', and '_' are removed and
+// a number is appended if needed.
+func (app *AuthApp) AvailableUsername(want string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".-_", r)) {
+			return r
+		}
+		return -1
+	}, want)
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > MaxUsernameLen-3 {
+		base = base[:MaxUsernameLen-3]
+	}
+
+	for n := 1; n < 1000; n++ {
+		username := base
+		if n > 1 {
+			username += strconv.Itoa(n)
+		}
+
+		exists, err := app.DB.UserExists(username)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUsernameUnavailable, want)
+}
@@ -92,7 +92,7 @@ func TestUserFromRequest(t *testing.T) {
 
 			w := httptest.NewRecorder()
 
-			gotUser, gotErr := app.DB.UserFromRequest(w, req)
+			gotUser, gotErr := app.UserFromRequest(w, req)
 
 			// Validate the returned user and error.
 			if !reflect.DeepEqual(gotUser, tt.wantUser) {
@@ -108,21 +108,22 @@ func TestUserFromRequest(t *testing.T) {
 }
 
 func TestUserForLoginToken(t *testing.T) {
-	app := AppForTest(t)
+	clock := webauth.NewFakeClock(time.Now())
+	app := AppWithClockForTest(t, clock)
 	db := app.DB
 
-	validToken, err := app.LoginUser("test", "password")
+	expiredToken, err := db.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "1m")
 	if err != nil {
-		t.Fatalf("could not login user to get login token")
+		t.Fatalf("could not create login token: %v", err)
 	}
+	clock.Advance(time.Minute + time.Second)
 
-	validUser, err := app.DB.UserForLoginToken(validToken.Value)
+	validToken, err := app.LoginUser("test", "password")
 	if err != nil {
-		t.Fatalf("could not get user")
+		t.Fatalf("could not login user to get login token")
 	}
 
-	expiredToken, err := db.CreateToken(webauth.LoginTokenKind, "test", webauth.LoginTokenSize, "0s")
-
+	validUser, err := app.DB.UserForLoginToken(validToken.Value)
 	if err != nil {
 		t.Fatalf("could not get user")
 	}
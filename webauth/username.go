@@ -0,0 +1,211 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Default username change limits used if not provided in the config.
+const (
+	DefaultUsernameCooldown = "720h" // Minimum time between changes.
+	DefaultUsernameGrace    = "0s"   // Old usernames are not redirected.
+)
+
+var (
+	ErrUsernameInvalid  = errors.New("invalid username")
+	ErrUsernameReserved = errors.New("username reserved")
+	ErrUsernameCooldown = errors.New("username change cooldown active")
+)
+
+// UsernameChange is a previous username of a user.
+type UsernameChange struct {
+	Username string    // Username is the previous username.
+	Changed  time.Time // Changed is when the username was changed.
+}
+
+// UsernamePolicy defines when a user can change their username.
+type UsernamePolicy struct {
+	Cooldown time.Duration // Minimum time between changes.
+	Grace    time.Duration // Time an old username refers to the user.
+	Reserved []string      // Usernames that cannot be chosen.
+}
+
+// UsernamePolicy returns the username change policy from the config, using
+// defaults for missing values. An error is returned for invalid values.
+func (c ConfigAuth) UsernamePolicy() (UsernamePolicy, error) {
+	cooldown := c.UsernameCooldown
+	if cooldown == "" {
+		cooldown = DefaultUsernameCooldown
+	}
+
+	d, err := time.ParseDuration(cooldown)
+	if err != nil {
+		return UsernamePolicy{}, err
+	}
+	if d < 0 {
+		return UsernamePolicy{}, fmt.Errorf("negative UsernameCooldown %q", cooldown)
+	}
+
+	grace := c.UsernameGrace
+	if grace == "" {
+		grace = DefaultUsernameGrace
+	}
+
+	g, err := time.ParseDuration(grace)
+	if err != nil {
+		return UsernamePolicy{}, err
+	}
+	if g < 0 {
+		return UsernamePolicy{}, fmt.Errorf("negative UsernameGrace %q", grace)
+	}
+
+	return UsernamePolicy{Cooldown: d, Grace: g, Reserved: c.ReservedUsernames}, nil
+}
+
+// Check returns an error if username cannot be chosen at now by a user
+// whose most recent change was at last.
+func (p UsernamePolicy) Check(username string, last, now time.Time) error {
+	if username == "" || len(username) > MaxUsernameLen || strings.ContainsFunc(username, isSpace) {
+		return ErrUsernameInvalid
+	}
+
+	for _, r := range p.Reserved {
+		if strings.EqualFold(r, username) {
+			return ErrUsernameReserved
+		}
+	}
+
+	if !last.IsZero() && now.Sub(last) < p.Cooldown {
+		return ErrUsernameCooldown
+	}
+
+	return nil
+}
+
+// isSpace reports whether r is a space, which is not allowed in a username.
+func isSpace(r rune) bool {
+	return strings.ContainsRune(" \t\r\n", r)
+}
+
+// ChangeUsername changes the username of user to newUsername, subject to
+// the UsernamePolicy. A username is not available if it belongs to another
+// user or was changed by another user within the grace period.
+func (app *AuthApp) ChangeUsername(user User, newUsername string) error {
+	policy, err := app.Cfg.Auth.UsernamePolicy()
+	if err != nil {
+		return err
+	}
+
+	history, err := app.DB.UsernameHistory(user.Username)
+	if err != nil {
+		return err
+	}
+
+	var last time.Time
+	if len(history) > 0 {
+		last = history[0].Changed
+	}
+
+	now := app.Clock.Now()
+	if err := policy.Check(newUsername, last, now); err != nil {
+		return err
+	}
+
+	if policy.Grace > 0 {
+		owner, err := app.DB.UsernameForOldName(newUsername, now.Add(-policy.Grace))
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		if err == nil && !strings.EqualFold(owner, user.Username) {
+			return ErrUsernameTaken
+		}
+	}
+
+	if err := app.DB.RenameUser(user.Username, newUsername); err != nil {
+		return err
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeRenameSelf, newUsername, EventDetails{"from": user.Username}))
+
+	return nil
+}
+
+// ResolveUsername returns the current username for username. If username
+// does not exist but was changed within the grace period of the
+// UsernamePolicy, the new username is returned. Otherwise, username is
+// returned unchanged.
+func (app *AuthApp) ResolveUsername(username string) (string, error) {
+	exists, err := app.DB.UserExists(username)
+	if err != nil || exists {
+		return username, err
+	}
+
+	policy, err := app.Cfg.Auth.UsernamePolicy()
+	if err != nil || policy.Grace == 0 {
+		return username, err
+	}
+
+	current, err := app.DB.UsernameForOldName(username, app.Clock.Now().Add(-policy.Grace))
+	if errors.Is(err, ErrUserNotFound) {
+		return username, nil
+	}
+	if err != nil {
+		return username, err
+	}
+
+	return current, nil
+}
+
+// UsernameHistory returns the previous usernames of username, newest first.
+func (db *AuthDB) UsernameHistory(username string) ([]UsernameChange, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT username, changed FROM username_history WHERE user_id = (SELECT id FROM users WHERE username = ?) ORDER BY changed DESC`
+	rows, err := db.Query(qry, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []UsernameChange
+	for rows.Next() {
+		var c UsernameChange
+		if err := rows.Scan(&c.Username, &c.Changed); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
+
+// UsernameForOldName returns the current username of the user who most
+// recently changed from oldName after since.
+//
+// If not found, ErrUserNotFound is returned.
+func (db *AuthDB) UsernameForOldName(oldName string, since time.Time) (string, error) {
+	if db == nil {
+		return "", ErrInvalidDB
+	}
+
+	var username string
+
+	qry := `SELECT users.username FROM username_history JOIN users ON username_history.user_id = users.id WHERE username_history.username = ? AND changed > ? ORDER BY changed DESC LIMIT 1`
+	err := db.QueryRow(qry, oldName, since).Scan(&username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+
+	return username, nil
+}
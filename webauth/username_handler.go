@@ -0,0 +1,113 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const UsernameTmpl = "username.html"
+
+// Messages displayed to the user for a username change.
+const (
+	MsgUsernameChanged  = "Your username was changed."
+	MsgUsernameInvalid  = "Usernames must be 1 to 30 characters without spaces."
+	MsgUsernameReserved = "That username is reserved."
+	MsgUsernameCooldown = "Your username was changed recently. Please try again later."
+	MsgUsernameFailed   = "Unable to change your username."
+)
+
+// UsernamePageData contains data to render the username template.
+type UsernamePageData struct {
+	CommonData
+	User    User
+	History []UsernameChange // History has the previous usernames.
+	Message string
+}
+
+// UsernameHandler handles requests to view or change the username of the
+// logged in user.
+func (app *AuthApp) UsernameHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.usernameGet, Post: app.usernamePost}.ServeHTTP(w, r)
+}
+
+// usernameGet serves the page to change the username.
+func (app *AuthApp) usernameGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.renderUsername(w, r, logger, UsernamePageData{User: user})
+}
+
+// usernamePost changes the username of the logged in user.
+func (app *AuthApp) usernamePost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	user, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	data := UsernamePageData{User: user}
+	if user.Username == "" {
+		app.renderUsername(w, r, logger, data)
+		return
+	}
+
+	newUsername := strings.TrimSpace(r.PostFormValue("username"))
+	logger = logger.With("username", user.Username, "newUsername", newUsername)
+
+	err = app.ChangeUsername(user, newUsername)
+	switch {
+	case err == nil:
+		logger.Info("changed username")
+		data.User.Username = newUsername
+		data.Message = MsgUsernameChanged
+	case errors.Is(err, ErrUsernameInvalid):
+		data.Message = MsgUsernameInvalid
+	case errors.Is(err, ErrUsernameReserved):
+		data.Message = MsgUsernameReserved
+	case errors.Is(err, ErrUsernameTaken):
+		data.Message = MsgUsernameExists
+	case errors.Is(err, ErrUsernameCooldown):
+		data.Message = MsgUsernameCooldown
+	default:
+		logger.Error("failed to change username", "err", err)
+		data.Message = MsgUsernameFailed
+	}
+
+	app.renderUsername(w, r, logger, data)
+}
+
+// renderUsername renders the username page of data with the history of
+// the user, if logged in.
+func (app *AuthApp) renderUsername(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data UsernamePageData) {
+	if data.User.Username != "" {
+		var err error
+		data.History, err = app.DB.UsernameHistory(data.User.Username)
+		if err != nil {
+			logger.Error("failed to get username history", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	app.RenderPage(w, r, logger, UsernameTmpl, &data)
+
+	logger.Info("done")
+}
@@ -0,0 +1,260 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestConfigUsernamePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     webauth.ConfigAuth
+		want    webauth.UsernamePolicy
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			cfg:  webauth.ConfigAuth{},
+			want: webauth.UsernamePolicy{Cooldown: 720 * time.Hour},
+		},
+		{
+			name: "configured",
+			cfg: webauth.ConfigAuth{
+				UsernameCooldown:  "24h",
+				UsernameGrace:     "168h",
+				ReservedUsernames: []string{"root"},
+			},
+			want: webauth.UsernamePolicy{
+				Cooldown: 24 * time.Hour,
+				Grace:    168 * time.Hour,
+				Reserved: []string{"root"},
+			},
+		},
+		{
+			name:    "invalidCooldown",
+			cfg:     webauth.ConfigAuth{UsernameCooldown: "foo"},
+			wantErr: true,
+		},
+		{
+			name:    "negativeGrace",
+			cfg:     webauth.ConfigAuth{UsernameGrace: "-1h"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.cfg.UsernamePolicy()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("UsernamePolicy() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("UsernamePolicy() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUsernamePolicyCheck(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	policy := webauth.UsernamePolicy{Cooldown: time.Hour, Reserved: []string{"root"}}
+
+	tests := []struct {
+		name     string
+		username string
+		last     time.Time
+		wantErr  error
+	}{
+		{"valid", "new", time.Time{}, nil},
+		{"afterCooldown", "new", now.Add(-time.Hour), nil},
+		{"duringCooldown", "new", now.Add(-time.Minute), webauth.ErrUsernameCooldown},
+		{"empty", "", time.Time{}, webauth.ErrUsernameInvalid},
+		{"space", "a b", time.Time{}, webauth.ErrUsernameInvalid},
+		{"tooLong", strings.Repeat("a", webauth.MaxUsernameLen+1), time.Time{}, webauth.ErrUsernameInvalid},
+		{"reserved", "Root", time.Time{}, webauth.ErrUsernameReserved},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.Check(tc.username, tc.last, now)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Check(%q, %v, %v) = %v, want %v",
+					tc.username, tc.last, now, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// appForUsernameTest returns an App with the test data, a FakeClock, and a
+// one day cooldown and grace period.
+func appForUsernameTest(t *testing.T) (*webauth.AuthApp, *webauth.FakeClock) {
+	clock := webauth.NewFakeClock(time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC))
+
+	app := newAppForTest(t,
+		[]func(*webauth.Config){func(cfg *webauth.Config) {
+			cfg.Auth.UsernameCooldown = "24h"
+			cfg.Auth.UsernameGrace = "24h"
+			cfg.Auth.ReservedUsernames = []string{"root"}
+		}},
+		webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+
+	return app, clock
+}
+
+func TestChangeUsername(t *testing.T) {
+	app, clock := appForUsernameTest(t)
+
+	user, err := app.DB.UserForName("test")
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+
+	if err := app.ChangeUsername(user, "root"); !errors.Is(err, webauth.ErrUsernameReserved) {
+		t.Errorf("ChangeUsername(root) = %v, want %v", err, webauth.ErrUsernameReserved)
+	}
+	if err := app.ChangeUsername(user, "admin"); !errors.Is(err, webauth.ErrUsernameTaken) {
+		t.Errorf("ChangeUsername(admin) = %v, want %v", err, webauth.ErrUsernameTaken)
+	}
+
+	if err := app.ChangeUsername(user, "first"); err != nil {
+		t.Fatalf("ChangeUsername(first) failed: %v", err)
+	}
+	user.Username = "first"
+
+	// The cooldown applies to the next change.
+	clock.Advance(time.Hour)
+	if err := app.ChangeUsername(user, "second"); !errors.Is(err, webauth.ErrUsernameCooldown) {
+		t.Errorf("ChangeUsername() during cooldown = %v, want %v", err, webauth.ErrUsernameCooldown)
+	}
+
+	// The old username is held for the user during the grace period.
+	other, _ := app.DB.UserForName("confirmed")
+	if err := app.ChangeUsername(other, "test"); !errors.Is(err, webauth.ErrUsernameTaken) {
+		t.Errorf("ChangeUsername() to old username = %v, want %v", err, webauth.ErrUsernameTaken)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if err := app.ChangeUsername(user, "second"); err != nil {
+		t.Fatalf("ChangeUsername(second) failed: %v", err)
+	}
+
+	history, err := app.DB.UsernameHistory("second")
+	if err != nil {
+		t.Fatalf("UsernameHistory() failed: %v", err)
+	}
+	if len(history) != 2 || history[0].Username != "first" || history[1].Username != "test" {
+		t.Errorf("UsernameHistory() = %+v, want first and test", history)
+	}
+	if !history[0].Changed.Equal(clock.Now()) {
+		t.Errorf("UsernameHistory()[0].Changed = %v, want %v", history[0].Changed, clock.Now())
+	}
+}
+
+func TestResolveUsername(t *testing.T) {
+	app, clock := appForUsernameTest(t)
+
+	user, _ := app.DB.UserForName("test")
+	if err := app.ChangeUsername(user, "renamed"); err != nil {
+		t.Fatalf("ChangeUsername() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		advance  time.Duration
+		want     string
+	}{
+		{"current", "renamed", 0, "renamed"},
+		{"old", "test", 0, "renamed"},
+		{"oldCase", "TEST", 0, "renamed"},
+		{"unknown", "missing", 0, "missing"},
+		{"afterGrace", "test", 25 * time.Hour, "test"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clock.Advance(tc.advance)
+
+			got, err := app.ResolveUsername(tc.username)
+			if err != nil || got != tc.want {
+				t.Errorf("ResolveUsername(%q) = %q, %v, want %q", tc.username, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginUserOldUsername(t *testing.T) {
+	app, _ := appForUsernameTest(t)
+
+	user, _ := app.DB.UserForName("test")
+	if err := app.ChangeUsername(user, "renamed"); err != nil {
+		t.Fatalf("ChangeUsername() failed: %v", err)
+	}
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("LoginUser() with old username failed: %v", err)
+	}
+
+	got, err := app.DB.UserForLoginToken(token.Value)
+	if err != nil || got.Username != "renamed" {
+		t.Errorf("UserForLoginToken() = %q, %v, want %q", got.Username, err, "renamed")
+	}
+}
+
+func TestUsernameHandler(t *testing.T) {
+	app, _ := appForUsernameTest(t)
+
+	token, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		newUsername string
+		wantMsg     string
+		wantName    string
+	}{
+		{"reserved", "root", webauth.MsgUsernameReserved, "test"},
+		{"taken", "admin", webauth.MsgUsernameExists, "test"},
+		{"invalid", "a b", webauth.MsgUsernameInvalid, "test"},
+		{"changed", "renamed", webauth.MsgUsernameChanged, "renamed"},
+		{"cooldown", "again", webauth.MsgUsernameCooldown, "renamed"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := url.Values{"username": {tc.newUsername}}.Encode()
+			r := httptest.NewRequest(http.MethodPost, "/username", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token.Value})
+			w := httptest.NewRecorder()
+
+			app.UsernameHandler(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+			}
+			if !strings.Contains(w.Body.String(), tc.wantMsg) {
+				t.Errorf("body does not contain %q", tc.wantMsg)
+			}
+
+			user, err := app.DB.UserForLoginToken(token.Value)
+			if err != nil || user.Username != tc.wantName {
+				t.Errorf("username = %q, %v, want %q", user.Username, err, tc.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BulkResult is the result of a bulk action for one user.
+type BulkResult struct {
+	Username  string
+	Pseudonym string // Pseudonym replaces Username in the events of a deleted user.
+	Err       error  // Err is nil if the action succeeded for the user.
+}
+
+// PseudonymPrefix starts the pseudonym of a deleted user.
+const PseudonymPrefix = "deleted-"
+
+// Pseudonym returns the stable pseudonym that replaces the username of the
+// user with id in their events once the user is deleted. It is derived from
+// the id, which is random, so it does not reveal the username but still
+// groups the events of the user.
+func Pseudonym(id string) string {
+	return PseudonymPrefix + Hash(id)[:12]
+}
+
+// DisableUsers disables each user in usernames and removes their tokens,
+// which logs them out, in a single transaction.
+//
+// A user that is not found is reported with ErrUserNotFound in the results
+// and the others are still disabled. Any other error rolls back the batch.
+func (db *AuthDB) DisableUsers(usernames []string) ([]BulkResult, error) {
+	return db.bulkUsers(usernames, execUserStmts(
+		"DELETE FROM tokens WHERE user_id = ?",
+		"UPDATE users SET disabled = true WHERE id = ?",
+	))
+}
+
+// DeleteUsers deletes each user in usernames and the data linked to them
+// in a single transaction. Events are kept to preserve statistics, but
+// the username is replaced by the Pseudonym of the user, which is returned
+// in the results, and their messages and details, which may hold personal
+// data, are removed. The username and email of the user are also replaced
+// by the Pseudonym in the details and messages of other events, and their
+// current and previous usernames as the actor or target of audit entries.
+//
+// Results are reported like DisableUsers.
+func (db *AuthDB) DeleteUsers(usernames []string) ([]BulkResult, error) {
+	deleteUser := execUserStmts(deleteUserStmts...)
+
+	return db.bulkUsers(usernames, func(tx *Tx, id string, result *BulkResult) error {
+		result.Pseudonym = Pseudonym(id)
+		if err := pseudonymizeEvents(tx, id, result.Pseudonym); err != nil {
+			return err
+		}
+		if err := pseudonymizeAudit(tx, id, result.Pseudonym); err != nil {
+			return err
+		}
+		return deleteUser(tx, id, result)
+	})
+}
+
+// userNamesQuery selects the current and previous usernames of a user,
+// given their id twice.
+const userNamesQuery = "SELECT username FROM users WHERE id = ? UNION SELECT username FROM username_history WHERE user_id = ?"
+
+// pseudonymizeEvents replaces the personal data of the user with id in
+// events by pseudonym within tx. It must be called before username_history
+// is deleted.
+func pseudonymizeEvents(tx *Tx, id, pseudonym string) error {
+	var email string
+	err := tx.QueryRow("SELECT email FROM users WHERE id = ?", id).Scan(&email)
+	if err != nil {
+		return err
+	}
+	values, err := queryStrings(tx, userNamesQuery, id, id)
+	if err != nil {
+		return err
+	}
+	if email != "" {
+		values = append(values, email)
+	}
+
+	_, err = tx.Exec("UPDATE events SET username = ?, message = '', details = NULL WHERE user_id = ?", pseudonym, id)
+	if err != nil {
+		return err
+	}
+
+	// Rewrite the details and messages of other events that refer to the
+	// user. Details are JSON, so match whole values.
+	conds := make([]string, len(values))
+	args := make([]any, len(values))
+	for i, v := range values {
+		conds[i] = "details LIKE ? ESCAPE '!'"
+		args[i] = "%" + likeEscape.Replace(detailValue(v)) + "%"
+	}
+	rows, err := tx.Query("SELECT DISTINCT type, details FROM events WHERE "+strings.Join(conds, " OR "), args...)
+	if err != nil {
+		return err
+	}
+	var events []Event
+	var stored []string // stored are the details of events as saved.
+	for rows.Next() {
+		var e Event
+		var details string
+		if err := rows.Scan(&e.Type, &details); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+			rows.Close()
+			return fmt.Errorf("invalid details: %w", err)
+		}
+		events = append(events, e)
+		stored = append(stored, details)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, e := range events {
+		e, ok := e.replaceDetails(pseudonym, values...)
+		if !ok {
+			continue
+		}
+		_, err = tx.Exec("UPDATE events SET message = ?, details = ? WHERE type = ? AND details = ?",
+			e.Message, e.Details.String(), e.Type, stored[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Usernames are too short to find in the messages of events without
+	// details, but emails are not.
+	if email != "" {
+		_, err = tx.Exec("UPDATE events SET message = REPLACE(message, ?, ?) WHERE details IS NULL AND message LIKE ? ESCAPE '!'",
+			email, pseudonym, "%"+likeEscape.Replace(email)+"%")
+	}
+
+	return err
+}
+
+// pseudonymizeAudit replaces the current and previous usernames of the
+// user with id as the actor or target of audit entries by pseudonym within
+// tx. It must be called before username_history is deleted.
+func pseudonymizeAudit(tx *Tx, id, pseudonym string) error {
+	for _, col := range []string{"actor", "target"} {
+		_, err := tx.Exec("UPDATE audit_log SET "+col+" = ? WHERE "+col+" IN ("+userNamesQuery+")", pseudonym, id, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryStrings returns the single column of the rows of qry within tx.
+func queryStrings(tx *Tx, qry string, args ...any) ([]string, error) {
+	rows, err := tx.Query(qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+// detailValue returns v as it appears as a value in EventDetails.String.
+func detailValue(v string) string {
+	b, _ := json.Marshal(v)
+	return ":" + string(b)
+}
+
+// deleteUserStmts delete a user, given their id, and the data linked to
+// them, except events.
+var deleteUserStmts = []string{
+	"DELETE FROM tokens WHERE user_id = ?",
+	"DELETE FROM email_prefs WHERE user_id = ?",
+	"DELETE FROM user_identities WHERE user_id = ?",
+	"DELETE FROM username_history WHERE user_id = ?",
+	"DELETE FROM user_prefs WHERE user_id = ?",
+	"DELETE FROM user_roles WHERE user_id = ?",
+	"DELETE FROM users WHERE id = ?",
+}
+
+// execUserStmts returns a function for bulkUsers that executes stmts, which
+// take the user id as the only argument.
+func execUserStmts(stmts ...string) func(*Tx, string, *BulkResult) error {
+	return func(tx *Tx, id string, _ *BulkResult) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// bulkUsers calls fn with the user id and result of each user in usernames
+// within a transaction.
+func (db *AuthDB) bulkUsers(usernames []string, fn func(tx *Tx, id string, result *BulkResult) error) ([]BulkResult, error) {
+	results := make([]BulkResult, 0, len(usernames))
+
+	err := db.WithTx(func(tx *Tx) error {
+		for _, username := range usernames {
+			var id string
+			err := tx.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+			if errors.Is(err, sql.ErrNoRows) {
+				results = append(results, BulkResult{Username: username, Err: ErrUserNotFound})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			result := BulkResult{Username: username}
+			if err := fn(tx, id, &result); err != nil {
+				return err
+			}
+
+			results = append(results, result)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
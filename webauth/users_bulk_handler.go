@@ -0,0 +1,275 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/csv"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const UsersBulkTmpl = "users_bulk.html"
+
+// BulkAction is an action applied to the users selected on the users page.
+type BulkAction string
+
+const (
+	BulkRemind  BulkAction = "remind"  // Resend a confirmation to each user.
+	BulkDisable BulkAction = "disable" // Disable and logout each user.
+	BulkDelete  BulkAction = "delete"  // Delete each user.
+	BulkExport  BulkAction = "export"  // Download the users as a CSV file.
+)
+
+// Valid returns true if a is a known BulkAction.
+func (a BulkAction) Valid() bool {
+	switch a {
+	case BulkRemind, BulkDisable, BulkDelete, BulkExport:
+		return true
+	}
+	return false
+}
+
+// ErrBulkSelf is the result if an admin selects themselves to be disabled
+// or deleted.
+var ErrBulkSelf = errors.New("cannot apply to yourself")
+
+// UsersBulkPageData contains data to render the users bulk template.
+type UsersBulkPageData struct {
+	CommonData
+	User      User
+	Action    BulkAction
+	Usernames []string     // Usernames selected, shown to confirm the action.
+	Results   []BulkResult // Results for each user, once confirmed.
+	FormNonce string       // FormNonce prevents replay of a delete.
+	Message   string
+}
+
+// UsersBulkHandler applies an action to the users selected on the users
+// page. The request must be a POST from an admin with the action and one
+// or more username form values.
+//
+// An export is returned immediately. Other actions are only applied if the
+// confirm form value is "yes", otherwise a page to confirm the action is
+// shown. The result for each user is shown once the action is applied.
+// A delete is confirmed with a single-use form nonce, so it cannot be
+// replayed.
+func (app *AuthApp) UsersBulkHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	// Check if the HTTP method is valid.
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	admin, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	if !admin.Can(PermManageUsers) {
+		logger.Error("user not authorized", "user", admin)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logger.Warn("failed to parse form", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	action := BulkAction(r.PostFormValue("action"))
+	usernames := uniqueUsernames(r.PostForm["username"])
+	logger = logger.With("action", action, "usernames", usernames)
+
+	if !action.Valid() || len(usernames) == 0 {
+		logger.Warn("invalid bulk request")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	if action == BulkExport {
+		app.exportUsers(w, r, usernames)
+		return
+	}
+
+	data := UsersBulkPageData{User: admin, Action: action, Usernames: usernames}
+
+	confirmed := r.PostFormValue("confirm") == "yes"
+	if confirmed && action == BulkDelete {
+		err = app.DB.UseFormNonce(FormBulkDelete, r.PostFormValue(FormNonceFieldName))
+		if err != nil {
+			logger.Warn("invalid form nonce", "err", err)
+			data.Message = MsgFormNonceInvalid
+			confirmed = false
+		}
+	}
+
+	if confirmed {
+		data.Results, err = app.applyBulkAction(r, admin, action, usernames)
+		if err != nil {
+			logger.Error("failed bulk action", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+	}
+
+	if data.Results == nil && action == BulkDelete {
+		data.FormNonce = app.newFormNonce(logger, FormBulkDelete)
+	}
+
+	app.RenderPage(w, r, logger, UsersBulkTmpl, &data)
+
+	logger.Info("done")
+}
+
+// uniqueUsernames returns the non-empty usernames without duplicates,
+// ignoring case, in the order given.
+func uniqueUsernames(usernames []string) []string {
+	seen := make(map[string]bool)
+
+	var unique []string
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		lower := strings.ToLower(username)
+		if username == "" || seen[lower] {
+			continue
+		}
+		seen[lower] = true
+		unique = append(unique, username)
+	}
+
+	return unique
+}
+
+// applyBulkAction applies action to usernames and returns the result for
+// each, in the same order. An admin cannot disable or delete themselves.
+func (app *AuthApp) applyBulkAction(r *http.Request, admin User, action BulkAction, usernames []string) ([]BulkResult, error) {
+	if action == BulkRemind {
+		results := make([]BulkResult, 0, len(usernames))
+		for _, username := range usernames {
+			user, err := app.DB.UserForName(username)
+			if err == nil {
+				_, err = app.resendConfirm(r.Context(), user)
+			}
+			results = append(results, BulkResult{Username: username, Err: err})
+		}
+		return results, nil
+	}
+
+	var others []string
+	for _, username := range usernames {
+		if !strings.EqualFold(username, admin.Username) {
+			others = append(others, username)
+		}
+	}
+
+	// The state of each user before the action is recorded in its audit
+	// entry.
+	before := make(map[string]auditedUser, len(others))
+	for _, username := range others {
+		if user, err := app.DB.UserForName(username); err == nil {
+			before[strings.ToLower(username)] = auditedUserOf(user)
+		}
+	}
+
+	var (
+		applied []BulkResult
+		event   EventType
+		act     string
+		err     error
+	)
+	switch action {
+	case BulkDisable:
+		applied, err = app.DB.DisableUsers(others)
+		event, act = TypeDisableAdmin, AuditDisableUser
+	case BulkDelete:
+		applied, err = app.DB.DeleteUsers(others)
+		event, act = TypeDeleteAdmin, AuditDeleteUser
+	default:
+		return nil, errors.New("unsupported bulk action " + string(action))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]BulkResult, len(applied))
+	for _, result := range applied {
+		byName[strings.ToLower(result.Username)] = result
+		if result.Err == nil {
+			// A deleted user is recorded by their Pseudonym, as in their
+			// other events.
+			target := cmp.Or(result.Pseudonym, result.Username)
+			app.DB.RecordEvent(NewEvent(event, target, EventDetails{"admin": admin.Username}))
+			entry := audit.Entry{Actor: admin.Username, Action: act, Target: target, Result: audit.Success}
+			if state, ok := before[strings.ToLower(result.Username)]; ok {
+				// A deleted user has no state after.
+				var after any
+				if action == BulkDisable {
+					disabled := state
+					disabled.Disabled = true
+					after = disabled
+				}
+				entry.Changes = auditChanges(state, after)
+			}
+			app.Audit(r, entry)
+		}
+	}
+
+	results := make([]BulkResult, 0, len(usernames))
+	for _, username := range usernames {
+		result, ok := byName[strings.ToLower(username)]
+		if !ok {
+			result = BulkResult{Username: username, Err: ErrBulkSelf}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// exportUsers writes the users in usernames as a CSV file.
+func (app *AuthApp) exportUsers(w http.ResponseWriter, r *http.Request, usernames []string) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	users, err := app.DB.GetUsers()
+	if err != nil {
+		logger.Error("failed GetUsers", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	selected := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		selected[strings.ToLower(username)] = true
+	}
+
+	var export []User
+	for _, user := range users {
+		if selected[strings.ToLower(user.Username)] {
+			export = append(export, user)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment;filename=users.csv")
+
+	err = csv.SliceOfStructsToCSV(w, export)
+	if err != nil {
+		logger.Error("failed to convert struct to CSV", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	logger.Info("exported users", "count", len(export))
+}
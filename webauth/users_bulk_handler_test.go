@@ -0,0 +1,161 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestUsersBulkHandlerErrors(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	adminCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: adminToken.Value}}
+	userCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: userToken.Value}}
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/users/bulk",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "GET Method Not Allowed\n",
+		},
+		{
+			Name:           "notAdmin",
+			Target:         "/users/bulk",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: userCookie,
+			RequestBody:    "action=delete&username=admin",
+			WantStatus:     http.StatusUnauthorized,
+			WantBody:       "Error: Unauthorized\n",
+		},
+		{
+			Name:           "invalidAction",
+			Target:         "/users/bulk",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "action=promote&username=test",
+			WantStatus:     http.StatusBadRequest,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:           "noUsers",
+			Target:         "/users/bulk",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "action=disable&username=+",
+			WantStatus:     http.StatusBadRequest,
+			WantBody:       "Error: Bad Request\n",
+		},
+	}
+
+	webhandler.TestHandler(t, app.UsersBulkHandler, tests)
+}
+
+// postBulk posts body to the UsersBulkHandler as the user with token and
+// returns the response.
+func postBulk(t *testing.T, app *webauth.AuthApp, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/users/bulk", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token})
+	w := httptest.NewRecorder()
+
+	app.UsersBulkHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	return w
+}
+
+func TestUsersBulkHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+
+	// Without confirm, the action is only shown.
+	w := postBulk(t, app, adminToken.Value, "action=disable&username=test&username=TEST")
+	if body := w.Body.String(); !strings.Contains(body, `name="confirm" value="yes"`) || strings.Count(body, `name="username" value="test"`) != 1 {
+		t.Errorf("confirm page missing confirm or unique username:\n%s", body)
+	}
+	if user, _ := app.DB.UserForName("test"); user.Disabled {
+		t.Fatalf("user disabled without confirm")
+	}
+
+	w = postBulk(t, app, adminToken.Value, "action=disable&confirm=yes&username=test&username=missing&username=admin")
+	body := w.Body.String()
+	for _, want := range []string{"done", webauth.ErrUserNotFound.Error(), webauth.ErrBulkSelf.Error()} {
+		if !strings.Contains(body, want) {
+			t.Errorf("results missing %q:\n%s", want, body)
+		}
+	}
+	if user, _ := app.DB.UserForName("test"); !user.Disabled {
+		t.Errorf("user not disabled")
+	}
+	if _, err := app.LoginUser("test", "password"); !errors.Is(err, webauth.ErrUserDisabled) {
+		t.Errorf("LoginUser() for disabled user = %v, want %v", err, webauth.ErrUserDisabled)
+	}
+
+	w = postBulk(t, app, adminToken.Value, "action=remind&confirm=yes&username=confirmed")
+	if !strings.Contains(w.Body.String(), "user already confirmed") {
+		t.Errorf("remind result missing already confirmed:\n%s", w.Body.String())
+	}
+
+	w = postBulk(t, app, adminToken.Value, "action=export&username=unconfirmed&username=expired")
+	if got := w.Header().Get("Content-Type"); got != "text/csv" {
+		t.Errorf("export Content-Type = %q, want text/csv", got)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Errorf("export has %d lines, want header and 2 users:\n%s", len(lines), w.Body.String())
+	}
+
+	// A delete requires the nonce from the confirm page.
+	postBulk(t, app, adminToken.Value, "action=delete&confirm=yes&username=unconfirmed")
+	if exists, _ := app.DB.UserExists("unconfirmed"); !exists {
+		t.Fatalf("user deleted without form nonce")
+	}
+
+	w = postBulk(t, app, adminToken.Value, "action=delete&username=unconfirmed")
+	nonce := formNonce(t, w.Body.String())
+	confirm := "action=delete&confirm=yes&username=unconfirmed&formNonce=" + url.QueryEscape(nonce)
+
+	postBulk(t, app, adminToken.Value, confirm)
+	if exists, _ := app.DB.UserExists("unconfirmed"); exists {
+		t.Errorf("user not deleted")
+	}
+
+	// The confirmed delete cannot be replayed.
+	w = postBulk(t, app, adminToken.Value, confirm)
+	if !strings.Contains(w.Body.String(), webauth.MsgFormNonceInvalid) {
+		t.Errorf("replayed delete not rejected:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestDeleteUsersPersonalData(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testDeleteUsersPersonalData(t, StoreForTest(t))
+	})
+	// The SQL store is tested only if there is a test database.
+	t.Run("sql", func(t *testing.T) {
+		testDeleteUsersPersonalData(t, DBForTest(t))
+	})
+}
+
+// testDeleteUsersPersonalData tests that deleting a user removes their
+// username and email from the messages and details of all events.
+func testDeleteUsersPersonalData(t *testing.T, store webauth.AuthStore) {
+	// The username is unique so the test can be repeated on a database.
+	username := "pii" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	original := username
+	email := username + "@email"
+	if err := store.RegisterUser(username, "PII User", email, "password"); err != nil {
+		t.Fatalf("RegisterUser() failed: %v", err)
+	}
+	user, err := store.UserForName(username)
+	if err != nil {
+		t.Fatalf("UserForName() failed: %v", err)
+	}
+
+	events := []webauth.Event{
+		webauth.NewEvent(webauth.TypeProfileEmailChanged, username, webauth.EventDetails{"email": email}),
+		webauth.NewEvent(webauth.TypeRenameSelf, username, webauth.EventDetails{"from": "old" + username}),
+		// Events of other users that refer to the user.
+		webauth.NewEvent(webauth.TypeProfileEmailExists, "test", webauth.EventDetails{"email": email}),
+		webauth.NewEvent(webauth.TypeRenameAdmin, "test", webauth.EventDetails{"from": "old", "admin": username}),
+	}
+	for _, e := range events {
+		if err := store.RecordEvent(e); err != nil {
+			t.Fatalf("RecordEvent() failed: %v", err)
+		}
+	}
+	// Audit entries by and of the user, including by a previous username.
+	entries := []audit.Entry{
+		{Actor: username, Action: webauth.AuditLogin, Result: audit.Success},
+		{Actor: "admin", Action: webauth.AuditDeleteUser, Target: username, Result: audit.Success},
+	}
+	for _, e := range entries {
+		if err := store.RecordAudit(e); err != nil {
+			t.Fatalf("RecordAudit() failed: %v", err)
+		}
+	}
+	if err := store.RenameUser(username, username+"x"); err != nil {
+		t.Fatalf("RenameUser() failed: %v", err)
+	}
+	username += "x"
+
+	// A legacy event, without details, with the email in the message.
+	if err := store.WriteEvent(webauth.EventRegister, false, "test", "email already exists: "+email); err != nil {
+		t.Fatalf("WriteEvent() failed: %v", err)
+	}
+
+	results, err := store.DeleteUsers([]string{username})
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("DeleteUsers() = %v, %v, want success", results, err)
+	}
+	pseudonym := webauth.Pseudonym(user.ID)
+
+	all, err := store.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() failed: %v", err)
+	}
+	var own, others int
+	for _, e := range all {
+		text := e.Username + " " + e.Message + " " + e.Details.String()
+		if strings.Contains(text, original) {
+			t.Errorf("event %+v refers to deleted user", e)
+		}
+		switch {
+		case e.Username == pseudonym:
+			own++
+			if e.Message != "" || len(e.Details) != 0 {
+				t.Errorf("event %+v of deleted user has message or details", e)
+			}
+		case strings.Contains(text, pseudonym):
+			others++
+		}
+	}
+	if own != 2 || others != 3 {
+		t.Errorf("got %d events of and %d referring to %q, want 2 and 3", own, others, pseudonym)
+	}
+
+	got, _, err := store.AuditEntries(audit.Filter{Actor: pseudonym})
+	if err != nil || len(got) != 1 || got[0].Action != webauth.AuditLogin {
+		t.Errorf("AuditEntries() by pseudonym = %+v, %v, want the login", got, err)
+	}
+	got, _, err = store.AuditEntries(audit.Filter{Target: pseudonym})
+	if err != nil || len(got) != 1 || got[0].Action != webauth.AuditDeleteUser {
+		t.Errorf("AuditEntries() of pseudonym = %+v, %v, want the deletion", got, err)
+	}
+}
@@ -7,49 +7,120 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/bnixon67/webapp/csv"
+	"github.com/bnixon67/webapp/audit"
 	"github.com/bnixon67/webapp/webhandler"
 	"github.com/bnixon67/webapp/webutil"
 )
 
 // UsersPageData contains data passed to the HTML template.
 type UsersPageData struct {
-	Title   string
-	Message string
-	User    User
+	Title     string
+	Message   string
+	User      User
+	Users     []User
+	Bounces   map[string]BounceKind // Bounces maps username to bounce kind.
+	CSRFToken string
+	Views     ViewData // Views are the view controls, shown to an admin.
+}
+
+// userList is the users shown to a user. Users with PermViewUsers also
+// see the bounces and can change the view.
+type userList struct {
 	Users   []User
+	Bounces map[string]BounceKind // Bounces maps username to bounce kind.
+	Views   ViewData
+	Query   string // Query of a saved view to redirect to.
+}
+
+// listUsers returns the page of users shown to user for r. It is shared by
+// the HTML and JSON handlers. If r names a saved view, only the Query is set.
+func (app *AuthApp) listUsers(r *http.Request, user User) (userList, error) {
+	var (
+		list userList
+		err  error
+	)
+
+	if !user.Can(PermViewUsers) {
+		list.Views = ViewData{
+			Table: UsersTable,
+			View:  TableView{Page: UsersTable.ParseView(r.URL.Query()).Page},
+		}
+		list.Users, list.Views.Total, err = app.DB.ListUsers(list.Views.View.ListQuery())
+		if err != nil {
+			return userList{}, err
+		}
+		return list, nil
+	}
+
+	list.Views, list.Query, err = app.viewData(r, user, UsersTable)
+	if err != nil || list.Query != "" {
+		return userList{Query: list.Query}, err
+	}
+
+	list.Users, list.Views.Total, err = app.DB.ListUsers(list.Views.View.ListQuery())
+	if err != nil {
+		return userList{}, err
+	}
+
+	list.Bounces, err = userBounces(app.DB, list.Users)
+	if err != nil {
+		return userList{}, err
+	}
+
+	return list, nil
 }
 
-// UsersHandler shows a list of the current users.
+// UsersHandler shows a list of the current users. It responds with JSON,
+// like APIUsersHandler, if requested by the Accept header.
 func (app *AuthApp) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
+	if webutil.WantsJSON(r) {
+		app.APIUsersHandler(w, r)
+		return
+	}
+
 	// Check if the HTTP method is valid.
 	if !webutil.CheckAllowedMethods(w, r, http.MethodGet) {
 		logger.Error("invalid method")
 		return
 	}
 
-	currentUser, err := app.DB.UserFromRequest(w, r)
+	currentUser, err := app.UserFromRequest(w, r)
 	if err != nil {
 		logger.Error("failed GetUser", "err", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	users, err := GetUsers(app.DB)
-	if err != nil {
-		logger.Error("failed GetUsers", "err", err)
+	list, err := app.listUsers(r, currentUser)
+	switch {
+	case errors.Is(err, ErrViewNotFound):
+		logger.Warn("saved view not found")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	case err != nil:
+		logger.Error("failed to list users", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	case list.Query != "":
+		http.Redirect(w, r, UsersTable.URL(list.Query), http.StatusFound)
+		return
 	}
 
 	// display page
 	err = webutil.RenderTemplateOrError(app.Tmpl, w, "users.html",
 		UsersPageData{
-			Title:   app.Cfg.App.Name,
-			Message: "",
-			User:    currentUser,
-			Users:   users,
+			Title:     app.Cfg.App.Name,
+			Message:   "",
+			User:      currentUser,
+			Users:     list.Users,
+			Bounces:   list.Bounces,
+			CSRFToken: webhandler.CSRFToken(r.Context()),
+			Views:     list.Views,
 		})
 	if err != nil {
 		logger.Error("failed to RenderTemplate", "err", err)
@@ -59,7 +130,8 @@ func (app *AuthApp) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("done")
 }
 
-// UsersCSVHandler provides list of the current users as a CSV file.
+// UsersCSVHandler provides list of the current users as a file in the format
+// of webutil.Export, CSV by default.
 func (app *AuthApp) UsersCSVHandler(w http.ResponseWriter, r *http.Request) {
 	logger := webhandler.RequestLoggerWithFuncName(r)
 
@@ -69,40 +141,35 @@ func (app *AuthApp) UsersCSVHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.DB.UserFromRequest(w, r)
+	user, err := app.UserFromRequest(w, r)
 	if err != nil {
 		logger.Error("failed GetUser", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	if !user.IsAdmin {
+	if !user.Can(PermViewUsers) {
 		logger.Error("user not authorized", "user", user)
-		webutil.RespondWithError(w, http.StatusUnauthorized)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
 		return
 	}
 
-	users, err := GetUsers(app.DB)
+	users, err := app.DB.GetUsers()
 	if err != nil {
 		logger.Error("failed GetUsers", "err", err)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", "attachment;filename=users.csv")
-
-	err = csv.SliceOfStructsToCSV(w, users)
+	err = webutil.Export(w, r, "users", users)
 	if err != nil {
-		logger.Error("failed to convert struct to CSV",
-			"err", err, "users", users)
-		webutil.RespondWithError(w, http.StatusInternalServerError)
+		logger.Error("failed to export users", "err", err)
 		return
 	}
 }
 
 // GetUsers returns a list of all users.
-func GetUsers(db *AuthDB) ([]User, error) {
+func (db *AuthDB) GetUsers() ([]User, error) {
 	var users []User
 	var err error
 
@@ -111,7 +178,7 @@ func GetUsers(db *AuthDB) ([]User, error) {
 		return users, errors.New("invalid db")
 	}
 
-	qry := `SELECT username, fullName, email, admin, created FROM users`
+	qry := `SELECT id, username, fullName, email, admin, disabled, created FROM users`
 
 	rows, err := db.Query(qry)
 	if err != nil {
@@ -124,7 +191,7 @@ func GetUsers(db *AuthDB) ([]User, error) {
 	for rows.Next() {
 		var user User
 
-		err = rows.Scan(&user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Created)
+		err = rows.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Disabled, &user.Created)
 		if err != nil {
 			slog.Error("failed rows.Scan", "err", err)
 		}
@@ -138,3 +205,145 @@ func GetUsers(db *AuthDB) ([]User, error) {
 
 	return users, err
 }
+
+// ListUsers returns the users selected by q, in the order of UsersTable
+// by default, and the number of users that match.
+func (db *AuthDB) ListUsers(q ListQuery) ([]User, int, error) {
+	if db == nil {
+		return nil, 0, ErrInvalidDB
+	}
+
+	where, args, order := UsersTable.sqlClauses(q)
+
+	var total int
+	err := db.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT id, username, fullName, email, admin, disabled, created FROM users"+where+order, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.IsAdmin, &user.Disabled, &user.Created)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// userColumn returns a function that returns the value of a column of
+// UsersTable for a user, using bounces for the email status.
+func userColumn(bounces map[string]BounceKind) func(User, string) string {
+	return func(u User, col string) string {
+		switch col {
+		case "username":
+			return u.Username
+		case "fullName":
+			return u.FullName
+		case "email":
+			return u.Email
+		case "emailStatus":
+			return string(bounces[u.Username])
+		case "admin":
+			return strconv.FormatBool(u.IsAdmin)
+		case "disabled":
+			return strconv.FormatBool(u.Disabled)
+		case "created":
+			return u.Created.Format(sortableTime)
+		}
+		return ""
+	}
+}
+
+// userBounces returns the bounce kind for each user whose email address
+// has a recorded bounce or complaint, keyed by username.
+func userBounces(db EmailStore, users []User) (map[string]BounceKind, error) {
+	kinds, err := db.BounceKinds()
+	if err != nil {
+		return nil, err
+	}
+
+	bounces := make(map[string]BounceKind)
+	for _, user := range users {
+		if kind, ok := kinds[normalizeEmail(user.Email)]; ok {
+			bounces[user.Username] = kind
+		}
+	}
+
+	return bounces, nil
+}
+
+// RenameUserHandler changes the username of a user. The request must be a
+// POST from an admin with the username and newUsername form values. The
+// history of the user is kept, since it refers to the user by ID.
+func (app *AuthApp) RenameUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	// Check if the HTTP method is valid.
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	admin, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	if !admin.Can(PermManageUsers) {
+		logger.Error("user not authorized", "user", admin)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	username := strings.TrimSpace(r.PostFormValue("username"))
+	newUsername := strings.TrimSpace(r.PostFormValue("newUsername"))
+	logger = logger.With("username", username, "newUsername", newUsername)
+
+	if IsEmpty(username, newUsername) || len(newUsername) > MaxUsernameLen {
+		logger.Warn("invalid username")
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	err = app.DB.RenameUser(username, newUsername)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		logger.Warn("user not found")
+		webutil.Error(w, r, http.StatusNotFound, "", "")
+		return
+	case errors.Is(err, ErrUsernameTaken):
+		logger.Warn("username taken")
+		webutil.Error(w, r, http.StatusConflict, "", "")
+		return
+	case err != nil:
+		logger.Error("failed to rename user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.DB.RecordEvent(NewEvent(TypeRenameAdmin, newUsername, EventDetails{"from": username, "admin": admin.Username}))
+	app.Audit(r, audit.Entry{
+		Actor:    admin.Username,
+		Action:   AuditRenameUser,
+		Target:   newUsername,
+		Result:   audit.Success,
+		Metadata: audit.Metadata{"from": username},
+		Changes:  auditChanges(map[string]string{"username": username}, map[string]string{"username": newUsername}),
+	})
+
+	http.Redirect(w, r, "/users", http.StatusSeeOther)
+
+	logger.Info("done")
+}
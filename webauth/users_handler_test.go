@@ -5,6 +5,7 @@ package webauth_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"path/filepath"
 	"testing"
@@ -14,24 +15,21 @@ import (
 	"github.com/bnixon67/webapp/csv"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/webhandler"
-	"github.com/bnixon67/webapp/webutil"
 )
 
 func usersBody(t *testing.T, data webauth.UsersPageData) string {
 	tmplName := "users.html"
 
-	// Initialize FuncMap with the custom function.
-	funcMap := template.FuncMap{"ToTimeZone": webutil.ToTimeZone}
-
 	// Directly include the name of the template in New for clarity.
-	tmpl := template.New(tmplName).Funcs(funcMap)
+	tmpl := template.New(tmplName).Funcs(tmplFuncsForTest)
 
 	// Get path to template file.
 	assetDir := assets.AssetPath()
 	tmplFile := filepath.Join(assetDir, "tmpl", tmplName)
+	viewFile := filepath.Join(assetDir, "tmpl", "table_view.html")
 
-	// Parse the template file, checking for errors.
-	tmpl, err := tmpl.ParseFiles(tmplFile)
+	// Parse the template files, checking for errors.
+	tmpl, err := tmpl.ParseFiles(tmplFile, viewFile)
 	if err != nil {
 		t.Fatalf("could not parse template file '%s': %v", tmplFile, err)
 	}
@@ -66,7 +64,7 @@ func TestUsersHandler(t *testing.T) {
 		t.Fatalf("could not get user")
 	}
 
-	users, err := webauth.GetUsers(app.DB)
+	users, err := app.DB.GetUsers()
 	if err != nil {
 		t.Fatalf("failed GetUsers: %v", err)
 	}
@@ -99,7 +97,7 @@ func TestUsersHandler(t *testing.T) {
 			WantBody: usersBody(t, webauth.UsersPageData{
 				Title: app.Cfg.App.Name,
 			}),
-			WantCookies: []http.Cookie{http.Cookie{Name: "login", MaxAge: -1, Raw: "login=; Max-Age=0"}},
+			WantCookies: []http.Cookie{http.Cookie{Name: "login", Path: "/", MaxAge: -1, Raw: "login=; Path=/; Max-Age=0"}},
 		},
 		{
 			Name:          "Valid GET Request with Good Login Token - Non Admin",
@@ -123,6 +121,7 @@ func TestUsersHandler(t *testing.T) {
 			WantStatus: http.StatusOK,
 			WantBody: usersBody(t, webauth.UsersPageData{
 				Title: app.Cfg.App.Name, User: admin, Users: users,
+				Views: webauth.ViewData{Table: webauth.UsersTable},
 			}),
 		},
 	}
@@ -144,7 +143,7 @@ func TestUsersCSVHandler(t *testing.T) {
 		t.Fatalf("could not login user to get login token")
 	}
 
-	events, err := webauth.GetUsers(app.DB)
+	events, err := app.DB.GetUsers()
 	if err != nil {
 		t.Fatalf("failed GetUsers: %v", err)
 	}
@@ -153,6 +152,10 @@ func TestUsersCSVHandler(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed SliceOfStructsToCSV: %v", err)
 	}
+	usersJSON, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("failed to marshal users: %v", err)
+	}
 
 	tests := []webhandler.TestCase{
 		{
@@ -178,7 +181,7 @@ func TestUsersCSVHandler(t *testing.T) {
 			},
 			WantStatus:  http.StatusUnauthorized,
 			WantBody:    "Error: Unauthorized\n",
-			WantCookies: []http.Cookie{http.Cookie{Name: "login", MaxAge: -1, Raw: "login=; Max-Age=0"}},
+			WantCookies: []http.Cookie{http.Cookie{Name: "login", Path: "/", MaxAge: -1, Raw: "login=; Path=/; Max-Age=0"}},
 		},
 		{
 			Name:          "Valid GET Request with Good Login Token - Non Admin",
@@ -200,8 +203,117 @@ func TestUsersCSVHandler(t *testing.T) {
 			WantStatus: http.StatusOK,
 			WantBody:   eventsBody.String(),
 		},
+		{
+			Name:          "Valid GET Request for JSON",
+			Target:        "/userscsv?format=json",
+			RequestMethod: http.MethodGet,
+			RequestCookies: []http.Cookie{
+				{Name: webauth.LoginTokenCookieName, Value: adminToken.Value},
+			},
+			WantStatus: http.StatusOK,
+			WantBody:   string(usersJSON) + "\n",
+		},
+		{
+			Name:          "Unknown Format",
+			Target:        "/userscsv?format=pdf",
+			RequestMethod: http.MethodGet,
+			RequestCookies: []http.Cookie{
+				{Name: webauth.LoginTokenCookieName, Value: adminToken.Value},
+			},
+			WantStatus: http.StatusBadRequest,
+			WantBody:   "Error: Bad Request\n",
+		},
 	}
 
 	// Test the handler using the utility function.
 	webhandler.TestHandler(t, app.UsersCSVHandler, tests)
 }
+
+func TestRenameUserHandler(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	adminCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: adminToken.Value}}
+	userCookie := []http.Cookie{{Name: webauth.LoginTokenCookieName, Value: userToken.Value}}
+
+	tests := []webhandler.TestCase{
+		{
+			Name:          "invalidMethod",
+			Target:        "/users/rename",
+			RequestMethod: http.MethodGet,
+			WantStatus:    http.StatusMethodNotAllowed,
+			WantBody:      "GET Method Not Allowed\n",
+		},
+		{
+			Name:           "notAdmin",
+			Target:         "/users/rename",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: userCookie,
+			RequestBody:    "username=test&newUsername=other",
+			WantStatus:     http.StatusUnauthorized,
+			WantBody:       "Error: Unauthorized\n",
+		},
+		{
+			Name:           "missingNewUsername",
+			Target:         "/users/rename",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "username=test&newUsername=+",
+			WantStatus:     http.StatusBadRequest,
+			WantBody:       "Error: Bad Request\n",
+		},
+		{
+			Name:           "notFound",
+			Target:         "/users/rename",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "username=missing&newUsername=other",
+			WantStatus:     http.StatusNotFound,
+			WantBody:       "Error: Not Found\n",
+		},
+		{
+			Name:           "taken",
+			Target:         "/users/rename",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "username=test&newUsername=confirmed",
+			WantStatus:     http.StatusConflict,
+			WantBody:       "Error: Conflict\n",
+		},
+		{
+			Name:           "rename",
+			Target:         "/users/rename",
+			RequestMethod:  http.MethodPost,
+			RequestHeaders: header,
+			RequestCookies: adminCookie,
+			RequestBody:    "username=test&newUsername=renamed",
+			WantStatus:     http.StatusSeeOther,
+		},
+	}
+
+	webhandler.TestHandler(t, app.RenameUserHandler, tests)
+
+	// The renamed user is still logged in.
+	user, err := app.DB.UserForLoginToken(userToken.Value)
+	if err != nil || user.Username != "renamed" {
+		t.Errorf("UserForLoginToken() = %q, %v, want %q", user.Username, err, "renamed")
+	}
+
+	events, err := app.DB.GetEvents()
+	if err != nil || len(events) == 0 || events[0].Name != webauth.EventRename || events[0].Username != "renamed" {
+		t.Errorf("GetEvents() = %+v, %v, want rename event first", events, err)
+	}
+}
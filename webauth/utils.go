@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"io"
 	"net/http"
 )
 
@@ -14,6 +15,12 @@ var ErrInvalidLength = errors.New("invalid length")
 
 // GenerateRandomString returns a URL safe base64 encoded string of n random bytes.
 func GenerateRandomString(n int) (string, error) {
+	return RandomStringFrom(rand.Reader, n)
+}
+
+// RandomStringFrom is like GenerateRandomString but reads the n bytes from
+// r, e.g., a webtest.SeqReader for reproducible tokens in tests.
+func RandomStringFrom(r io.Reader, n int) (string, error) {
 	if n < 0 {
 		return "", ErrInvalidLength
 	}
@@ -22,7 +29,7 @@ func GenerateRandomString(n int) (string, error) {
 	b := make([]byte, n)
 
 	// get b random bytes
-	_, err := rand.Read(b)
+	_, err := io.ReadFull(r, b)
 	if err != nil {
 		return "", err
 	}
@@ -31,6 +38,15 @@ func GenerateRandomString(n int) (string, error) {
 	return base64.URLEncoding.EncodeToString(b), err
 }
 
+// randReader returns r or crypto/rand.Reader if r is nil.
+func randReader(r io.Reader) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+
+	return r
+}
+
 var ErrRequestNil = errors.New("request is nil")
 
 // CookieValue returns the named cookie value provided in the request or an empty string if not found.
@@ -8,7 +8,10 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/bnixon67/webapp/webtest"
 )
 
 func TestGenerateRandomString(t *testing.T) {
@@ -47,6 +50,23 @@ func TestGenerateRandomString(t *testing.T) {
 	}
 }
 
+func TestRandomStringFrom(t *testing.T) {
+	got, err := RandomStringFrom(webtest.NewSeqReader(0), 3)
+	if err != nil {
+		t.Fatalf("RandomStringFrom() failed: %v", err)
+	}
+
+	want := base64.URLEncoding.EncodeToString([]byte{0, 1, 2})
+	if got != want {
+		t.Errorf("RandomStringFrom() = %q, want %q", got, want)
+	}
+
+	_, err = RandomStringFrom(strings.NewReader("a"), 2)
+	if err == nil {
+		t.Errorf("RandomStringFrom() with short reader succeeded, want error")
+	}
+}
+
 func TestGetCookieValue(t *testing.T) {
 	cases := []struct {
 		request    bool
@@ -0,0 +1,183 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/audit"
+)
+
+// DefaultWaitlistCohort is the number of users approved by a cohort
+// release, if ConfigWaitlist.Cohort is not set.
+const DefaultWaitlistCohort = 10
+
+// ConfigWaitlist holds new users for approval by an admin, e.g., for a
+// soft launch. Users still register and confirm their email while they
+// are waitlisted, but cannot login until approved, one by one or in
+// cohorts of the oldest registrations.
+type ConfigWaitlist struct {
+	Enabled bool // Enabled waitlists the users who register.
+	Cohort  int  // Cohort is the number of users of a release, or DefaultWaitlistCohort if zero.
+}
+
+// cohort returns the number of users approved by a cohort release.
+func (c ConfigWaitlist) cohort() int {
+	if c.Cohort <= 0 {
+		return DefaultWaitlistCohort
+	}
+	return c.Cohort
+}
+
+// ErrNotWaitlisted is the result of approving a user who is not waitlisted.
+var ErrNotWaitlisted = errors.New("user not waitlisted")
+
+// WaitlistedUsers returns the users held for approval, oldest first. Only
+// the id, username, full name, email, confirmed, and created fields are
+// set.
+func (db *AuthDB) WaitlistedUsers() ([]User, error) {
+	if db == nil {
+		return nil, ErrInvalidDB
+	}
+
+	qry := `SELECT id, username, fullName, email, confirmed, created FROM users WHERE waitlisted = true ORDER BY created, username`
+	rows, err := db.Query(qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user := User{Waitlisted: true}
+		err := rows.Scan(&user.ID, &user.Username, &user.FullName, &user.Email, &user.Confirmed, &user.Created)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// ApproveUsers approves each waitlisted user in usernames, so they can
+// login, in a single transaction.
+//
+// A user that is not found is reported with ErrUserNotFound and a user
+// that is not waitlisted with ErrNotWaitlisted in the results, and the
+// others are still approved. Any other error rolls back the batch.
+func (db *AuthDB) ApproveUsers(usernames []string) ([]BulkResult, error) {
+	return db.bulkUsers(usernames, func(tx *Tx, id string, result *BulkResult) error {
+		res, err := tx.Exec("UPDATE users SET waitlisted = false WHERE id = ? AND waitlisted = true", id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			result.Err = ErrNotWaitlisted
+		}
+		return nil
+	})
+}
+
+// approveUsers approves the waitlisted users in usernames for admin and
+// returns the result for each. The approval of each user is recorded as
+// an event of type event and in the audit log, and the user is emailed
+// that they can login.
+func (app *AuthApp) approveUsers(r *http.Request, admin User, usernames []string, event EventType) ([]BulkResult, error) {
+	// The users are looked up first for their audit entries and emails.
+	before := make(map[string]User, len(usernames))
+	for _, username := range usernames {
+		if user, err := app.DB.UserForName(username); err == nil {
+			before[strings.ToLower(username)] = user
+		}
+	}
+
+	results, err := app.DB.ApproveUsers(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		user, ok := before[strings.ToLower(result.Username)]
+		if result.Err != nil || !ok {
+			continue
+		}
+
+		app.DB.RecordEvent(NewEvent(event, user.Username, EventDetails{"admin": admin.Username}))
+
+		approved := user
+		approved.Waitlisted = false
+		app.Audit(r, audit.Entry{
+			Actor: admin.Username, Action: AuditApproveUser, Target: user.Username, Result: audit.Success,
+			Changes: auditChanges(auditedUserOf(user), auditedUserOf(approved)),
+		})
+
+		err := app.sendApprovalEmail(r.Context(), user)
+		if err != nil {
+			slog.Error("unable to send approval email", "err", err, "username", user.Username)
+		}
+	}
+
+	return results, nil
+}
+
+// releaseCohort approves the oldest waitlisted users, up to the cohort of
+// Config.Waitlist, for admin, like approveUsers.
+func (app *AuthApp) releaseCohort(r *http.Request, admin User) ([]BulkResult, error) {
+	users, err := app.DB.WaitlistedUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var usernames []string
+	for _, user := range users[:min(len(users), app.Cfg.Waitlist.cohort())] {
+		usernames = append(usernames, user.Username)
+	}
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	return app.approveUsers(r, admin, usernames, TypeWaitlistReleased)
+}
+
+const approvalEmailTmpl = `
+{{.FullName}},
+
+Your {{.Title}} account {{.Username}} has been approved.
+
+Please visit {{.BaseURL}}/login to login.
+`
+
+type approvalData struct {
+	FullName string
+	Username string
+	Title    string
+	BaseURL  string
+}
+
+// sendApprovalEmail emails user that their account has been approved.
+func (app *AuthApp) sendApprovalEmail(ctx context.Context, user User) error {
+	subj := app.Printer(ctx).T("%s account approved", app.Cfg.App.Name)
+
+	data := approvalData{
+		FullName: user.FullName,
+		Username: user.Username,
+		Title:    app.Cfg.App.Name,
+		BaseURL:  app.Cfg.Auth.BaseURL,
+	}
+	body, err := app.emailBody(ctx, "approval", approvalEmailTmpl, data)
+	if err != nil {
+		return err
+	}
+
+	return app.sendEmail(ctx, user.Email, subj, body, nil)
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const WaitlistTmpl = "waitlist.html"
+
+// WaitlistPageData contains data to render the waitlist template.
+type WaitlistPageData struct {
+	CommonData
+	User    User
+	Users   []User       // Users waitlisted, oldest first.
+	Cohort  int          // Cohort is the number of users of a release.
+	Results []BulkResult // Results for each user approved by the request.
+}
+
+// WaitlistHandler shows the users waiting for approval to an admin.
+//
+// A POST approves the users of the username form values or, if the
+// release form value is "cohort", the oldest waitlisted users up to the
+// cohort of Config.Waitlist. Each approved user is emailed and the result
+// for each user is shown above the remaining waitlist.
+func (app *AuthApp) WaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	webhandler.MethodHandler{Get: app.waitlistGet, Post: app.waitlistPost}.ServeHTTP(w, r)
+}
+
+// waitlistGet shows the waitlisted users.
+func (app *AuthApp) waitlistGet(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	admin, ok := app.waitlistAdmin(w, r, logger)
+	if !ok {
+		return
+	}
+
+	app.renderWaitlist(w, r, logger, WaitlistPageData{User: admin})
+}
+
+// waitlistPost approves waitlisted users and shows the results.
+func (app *AuthApp) waitlistPost(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	admin, ok := app.waitlistAdmin(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logger.Warn("failed to parse form", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	data := WaitlistPageData{User: admin}
+
+	var err error
+	if r.PostFormValue("release") == "cohort" {
+		data.Results, err = app.releaseCohort(r, admin)
+	} else {
+		usernames := uniqueUsernames(r.PostForm["username"])
+		if len(usernames) == 0 {
+			logger.Warn("no users to approve")
+			webutil.Error(w, r, http.StatusBadRequest, "", "")
+			return
+		}
+		data.Results, err = app.approveUsers(r, admin, usernames, TypeWaitlistApproved)
+	}
+	if err != nil {
+		logger.Error("failed to approve users", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	logger.Info("approved users", "results", len(data.Results))
+
+	app.renderWaitlist(w, r, logger, data)
+}
+
+// waitlistAdmin returns the logged in user if they can manage users. If
+// not, an error is written and false is returned.
+func (app *AuthApp) waitlistAdmin(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (User, bool) {
+	admin, err := app.UserFromRequest(w, r)
+	if err != nil {
+		logger.Error("failed to get user", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return User{}, false
+	}
+
+	if !admin.Can(PermManageUsers) {
+		logger.Error("user not authorized", "user", admin)
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return User{}, false
+	}
+
+	return admin, true
+}
+
+// renderWaitlist renders the waitlist page of data with the waitlisted
+// users.
+func (app *AuthApp) renderWaitlist(w http.ResponseWriter, r *http.Request, logger *slog.Logger, data WaitlistPageData) {
+	data.Cohort = app.Cfg.Waitlist.cohort()
+
+	var err error
+	data.Users, err = app.DB.WaitlistedUsers()
+	if err != nil {
+		logger.Error("failed WaitlistedUsers", "err", err)
+		webutil.Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+
+	app.RenderPage(w, r, logger, WaitlistTmpl, &data)
+}
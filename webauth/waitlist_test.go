@@ -0,0 +1,131 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/audit"
+	"github.com/bnixon67/webapp/webauth"
+)
+
+// waitlistAppForTest returns an app with the waitlist enabled and a
+// cohort of 2, using store.
+func waitlistAppForTest(t *testing.T, store webauth.AuthStore) *webauth.AuthApp {
+	t.Helper()
+
+	return newAppForTest(t,
+		[]func(*webauth.Config){func(cfg *webauth.Config) {
+			cfg.Waitlist = webauth.ConfigWaitlist{Enabled: true, Cohort: 2}
+		}},
+		webauth.WithDB(store))
+}
+
+func TestWaitlistRegister(t *testing.T) {
+	store := StoreForTest(t)
+	app := waitlistAppForTest(t, store)
+
+	err := app.DB.RegisterUser("new", "New User", "new@email", "password")
+	if err != nil {
+		t.Fatalf("RegisterUser() failed: %v", err)
+	}
+
+	user, err := store.UserForName("new")
+	if err != nil || !user.Waitlisted {
+		t.Errorf("UserForName() = %+v, %v, want waitlisted user", user, err)
+	}
+
+	if _, err := app.LoginUser("new", "password"); !errors.Is(err, webauth.ErrUserWaitlisted) {
+		t.Errorf("LoginUser() of waitlisted user = %v, want %v", err, webauth.ErrUserWaitlisted)
+	}
+
+	w := requestAs(app.LoginPostHandler, "", http.MethodPost, "/login", "username=new&password=password")
+	if !strings.Contains(w.Body.String(), webauth.MsgUserWaitlisted) {
+		t.Errorf("login = %q, want waitlisted message", w.Body)
+	}
+
+	// Users who registered before the waitlist can still login.
+	if _, err := app.LoginUser("test", "password"); err != nil {
+		t.Errorf("LoginUser() of existing user failed: %v", err)
+	}
+}
+
+func TestWaitlistHandler(t *testing.T) {
+	store := StoreForTest(t)
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for i, username := range []string{"w1", "w2", "w3"} {
+		u := webauth.User{
+			Username: username, FullName: username, Email: username + "@email",
+			Waitlisted: true, Created: start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := store.AddUser(u, TestPasswordHash); err != nil {
+			t.Fatalf("failed to add user %q: %v", username, err)
+		}
+	}
+	app := waitlistAppForTest(t, store)
+
+	adminToken, err := app.LoginUser("admin", "password")
+	if err != nil {
+		t.Fatalf("could not login admin: %v", err)
+	}
+	userToken, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login user: %v", err)
+	}
+
+	w := requestAs(app.WaitlistHandler, userToken.Value, http.MethodGet, "/waitlist", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status of user = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = requestAs(app.WaitlistHandler, adminToken.Value, http.MethodGet, "/waitlist", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "w1@email") {
+		t.Fatalf("GET = %d %q, want waitlisted users", w.Code, w.Body)
+	}
+
+	w = requestAs(app.WaitlistHandler, adminToken.Value, http.MethodPost, "/waitlist", "username=w3&username=test")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), webauth.ErrNotWaitlisted.Error()) {
+		t.Errorf("approve = %d %q, want result of test", w.Code, w.Body)
+	}
+
+	// The cohort releases the oldest users.
+	w = requestAs(app.WaitlistHandler, adminToken.Value, http.MethodPost, "/waitlist", "release=cohort")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "No users are waitlisted.") {
+		t.Errorf("release = %d %q, want empty waitlist", w.Code, w.Body)
+	}
+
+	if users, err := store.WaitlistedUsers(); err != nil || len(users) != 0 {
+		t.Errorf("WaitlistedUsers() = %+v, %v, want none", users, err)
+	}
+	for username, want := range map[string]webauth.EventType{
+		"w1": webauth.TypeWaitlistReleased,
+		"w2": webauth.TypeWaitlistReleased,
+		"w3": webauth.TypeWaitlistApproved,
+	} {
+		if _, err := app.LoginUser(username, "password"); err != nil {
+			t.Errorf("LoginUser(%q) of approved user failed: %v", username, err)
+		}
+
+		events, _ := store.EventsForUser(username)
+		found := false
+		for _, e := range events {
+			found = found || (e.Type == want && e.Details["admin"] == "admin")
+		}
+		if !found {
+			t.Errorf("events of %q = %+v, want %q by admin", username, events, want)
+		}
+	}
+
+	entries, total, err := store.AuditEntries(audit.Filter{Actor: "admin", Action: webauth.AuditApproveUser})
+	if err != nil || total != 3 {
+		t.Fatalf("AuditEntries() = %+v, %d, %v, want 3 entries", entries, total, err)
+	}
+	if got := entries[0].Changes.String(); !strings.Contains(got, "waitlisted") {
+		t.Errorf("Changes = %s, want waitlisted", got)
+	}
+}
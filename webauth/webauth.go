@@ -5,19 +5,73 @@
 package webauth
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/netip"
 	"time"
 
+	"github.com/bnixon67/webapp/i18n"
+	"github.com/bnixon67/webapp/notify"
 	"github.com/bnixon67/webapp/webapp"
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webhealth"
+	"github.com/bnixon67/webapp/webpages"
+	"github.com/bnixon67/webapp/webredis"
+	"github.com/bnixon67/webapp/websse"
 )
 
 // AuthApp extends the WebApp to support authentication.
 type AuthApp struct {
-	*webapp.WebApp         // Embedded WebApp
-	DB             *AuthDB // DB is the database connection.
+	*webapp.WebApp           // Embedded WebApp
+	DB             AuthStore // DB is the datastore.
 	Cfg            Config
+	Notifier       notify.Notifier                     // Notifier sends operational alerts.
+	Checks         *webhealth.Checks                   // Checks report component health, for /readyz.
+	LiveChecks     *webhealth.Checks                   // LiveChecks report the app is alive, for /healthz.
+	Clock          Clock                               // Clock provides the current time.
+	Rand           io.Reader                           // Rand is the source of random bytes.
+	Hasher         PasswordHasher                      // Hasher hashes new passwords.
+	Live           *websse.Server                      // Live publishes new rows to admin pages.
+	Redis          *webredis.Client                    // Redis keeps state shared by instances, if Config.Redis is set.
+	Geo            GeoLocator                          // Geo finds the country of clients for Config.Geo.
+	Fingerprinter  TLSFingerprinter                    // Fingerprinter finds TLS fingerprints for Config.Screen.
+	Screeners      []Screener                          // Screeners are added to those of Config.Screen.
+	Risk           RiskScorer                          // Risk scores logins and registrations for Config.Risk.
+	Pages          *webpages.Pages                     // Pages are the Markdown pages of Config.Pages, if any.
+	CORS           *webhandler.CORSPolicy              // CORS is the policy of Config.CORS, if any.
+	Catalog        *i18n.Catalog                       // Catalog translates pages and emails.
+	SchemaExempt   []string                            // SchemaExempt are the paths served if the database schema does not match.
+	schemaErr      error                               // schemaErr is the schema mismatch found by NewApp, if any.
+	signingKeys    signingKeys                         // signingKeys are used to sign URLs.
+	debugAllow     []netip.Prefix                      // debugAllow is parsed Debug.AllowIPs.
+	trustedProxies []netip.Prefix                      // trustedProxies is parsed Proxy.Trusted.
+	oauth          map[string]*oauthProvider           // oauth is the parsed Config.OAuth.
+	timeouts       requestTimeouts                     // timeouts is the parsed Config.Deadline.
+	rateLimit      rateLimit                           // rateLimit is the parsed Config.RateLimit.
+	signatures     *webhandler.SignatureVerifier       // signatures verifies Config.Signature keys.
+	breach         breachCheck                         // breach is the parsed Config.Auth.Breach.
+	cspReportLimit int                                 // cspReportLimit is the parsed Config.CSP.
+	cookies        cookieFormat                        // cookies is the parsed Config.Auth.Cookie.
+	searchInterval time.Duration                       // searchInterval is the parsed Config.Search.Interval.
+	headers        *webhandler.SecurityHeaders         // headers are the parsed Config.Security and Config.CSP.
+	caches         caches                              // caches are the parsed Config.Cache.
+	broker         *webredis.Broker                    // broker relays Live messages, if Config.Redis is set.
+	loginExpires   time.Duration                       // loginExpires is the parsed Config.Auth.LoginExpires.
+	refreshExpires time.Duration                       // refreshExpires is zero if refresh tokens are disabled.
+	magicExpires   time.Duration                       // magicExpires is zero if login links are disabled.
+	deleteGrace    time.Duration                       // deleteGrace is zero if account deletion is disabled.
+	sessionIdle    time.Duration                       // sessionIdle is zero if idle sessions are kept.
+	activity       *sessionActivity                    // activity of sessions not yet saved.
+	dummy          *dummyPassword                      // dummy is checked for unknown users.
+	retention      map[RetentionCategory]time.Duration // retention is the parsed Config.Retention.
+	geo            *geoPolicy                          // geo is the parsed Config.Geo.
+	screen         *screenPolicy                       // screen is the parsed Config.Screen.
+	risk           *riskPolicy                         // risk is the parsed Config.Risk.
+	registry       *instanceRegistry                   // registry has this instance in the registry.
+	routes         *routeStates                        // routes are the states of the managed routes.
 }
 
 // String returns a string representation of the AuthApp instance.
@@ -26,20 +80,66 @@ func (a *AuthApp) String() string {
 		return fmt.Sprintf("%v", nil)
 	}
 
-	return fmt.Sprintf("%+v", *a)
+	// Avoid exposing the signing keys.
+	c := *a
+	c.signingKeys = signingKeys{}
+
+	return fmt.Sprintf("%+v", c)
 }
 
 // Option is a function type used to apply configuration options to a AuthApp.
 // This follows the Option pattern from https://commandcenter.blogspot.com/2014/01/self-referential-functions-and-design.html and elsewhere.
 type Option func(*AuthApp)
 
-// WithDB returns an Option to set the DB for a AuthApp.
-func WithDB(db *AuthDB) Option {
+// WithDB returns an Option to set the datastore for a AuthApp, such as an
+// AuthDB or a MemStore.
+func WithDB(db AuthStore) Option {
 	return func(a *AuthApp) {
 		a.DB = db
 	}
 }
 
+// WithClock returns an Option to set the Clock for a AuthApp and its
+// datastore, e.g., to use a FakeClock in tests.
+func WithClock(c Clock) Option {
+	return func(a *AuthApp) {
+		a.Clock = c
+	}
+}
+
+// WithRand returns an Option to set the source of random bytes for a
+// AuthApp and its datastore. Tests can use a webtest.SeqReader to get
+// reproducible tokens. The default is crypto/rand.Reader.
+func WithRand(r io.Reader) Option {
+	return func(a *AuthApp) {
+		a.Rand = r
+	}
+}
+
+// WithPasswordHasher returns an Option to set the PasswordHasher for a
+// AuthApp and its datastore, instead of using Config.Auth.Password.
+func WithPasswordHasher(h PasswordHasher) Option {
+	return func(a *AuthApp) {
+		a.Hasher = h
+	}
+}
+
+// WithNotifier returns an Option to set the Notifier for a AuthApp,
+// instead of using the sinks in Config.
+func WithNotifier(n notify.Notifier) Option {
+	return func(a *AuthApp) {
+		a.Notifier = n
+	}
+}
+
+// WithCatalog returns an Option to set the Catalog that translates the
+// pages and emails of a AuthApp. The default has no translations.
+func WithCatalog(c *i18n.Catalog) Option {
+	return func(a *AuthApp) {
+		a.Catalog = c
+	}
+}
+
 // WithConfig returns an Option to set the Config for a AuthApp.
 func WithConfig(cfg Config) Option {
 	return func(a *AuthApp) {
@@ -52,7 +152,7 @@ var ErrInvalidConfig = errors.New("invalid config")
 // NewApp creates a new AuthApp with the given options and returns it.
 // These options can be either AuthApp or WebApp Options.
 func NewApp(options ...interface{}) (*AuthApp, error) {
-	authApp := &AuthApp{}
+	authApp := &AuthApp{activity: &sessionActivity{}, dummy: &dummyPassword{}, registry: &instanceRegistry{}, routes: &routeStates{}}
 
 	var webAppOpts []webapp.Option
 
@@ -78,6 +178,10 @@ func NewApp(options ...interface{}) (*AuthApp, error) {
 		return nil, fmt.Errorf("error initializing WebApp: %w", err)
 	}
 
+	// Check the schema of the database before it is wrapped by stores
+	// that do not have one.
+	authApp.checkSchema()
+
 	// Validate configuration.
 	missingFields, err := authApp.Cfg.MissingFields()
 	if err != nil {
@@ -88,11 +192,287 @@ func NewApp(options ...interface{}) (*AuthApp, error) {
 	}
 
 	// Validate login expiration duration.
-	_, err = time.ParseDuration(authApp.Cfg.Auth.LoginExpires)
+	authApp.loginExpires, err = time.ParseDuration(authApp.Cfg.Auth.LoginExpires)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
 	}
 
+	// Validate refresh token expiry, if enabled.
+	if authApp.Cfg.Auth.RefreshExpires != "" {
+		authApp.refreshExpires, err = time.ParseDuration(authApp.Cfg.Auth.RefreshExpires)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if authApp.refreshExpires <= authApp.loginExpires {
+			return nil, fmt.Errorf("%w: RefreshExpires %s is not longer than LoginExpires %s", ErrInvalidConfig, authApp.refreshExpires, authApp.loginExpires)
+		}
+	}
+
+	// Validate login link expiry, if enabled.
+	if authApp.Cfg.Auth.MagicExpires != "" {
+		authApp.magicExpires, err = time.ParseDuration(authApp.Cfg.Auth.MagicExpires)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if authApp.magicExpires <= 0 {
+			return nil, fmt.Errorf("%w: MagicExpires %s is not positive", ErrInvalidConfig, authApp.magicExpires)
+		}
+	}
+
+	// Validate account deletion grace period, if enabled.
+	if authApp.Cfg.Auth.DeleteGrace != "" {
+		authApp.deleteGrace, err = time.ParseDuration(authApp.Cfg.Auth.DeleteGrace)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if authApp.deleteGrace <= 0 {
+			return nil, fmt.Errorf("%w: DeleteGrace %s is not positive", ErrInvalidConfig, authApp.deleteGrace)
+		}
+	}
+
+	// Validate idle session limit, if enabled.
+	if authApp.Cfg.Auth.SessionIdle != "" {
+		authApp.sessionIdle, err = time.ParseDuration(authApp.Cfg.Auth.SessionIdle)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if authApp.sessionIdle <= 0 {
+			return nil, fmt.Errorf("%w: SessionIdle %s is not positive", ErrInvalidConfig, authApp.sessionIdle)
+		}
+	}
+
+	// Validate confirm resend limits.
+	_, err = authApp.Cfg.Auth.ResendLimit()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate username change policy.
+	_, err = authApp.Cfg.Auth.UsernamePolicy()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate password hashing, unless a hasher was given.
+	if authApp.Hasher == nil {
+		authApp.Hasher, err = authApp.Cfg.Auth.Password.Hasher()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	}
+
+	// Validate addresses allowed to access the debug handlers.
+	authApp.debugAllow, err = authApp.Cfg.Debug.Prefixes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate trusted proxies.
+	authApp.trustedProxies, err = webhandler.ParsePrefixes(authApp.Cfg.Proxy.Trusted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid Proxy.Trusted: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate cross-origin access.
+	authApp.CORS, err = authApp.Cfg.CORS.policy()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate security headers.
+	authApp.headers, err = authApp.Cfg.Security.securityHeaders(authApp.Cfg.CSP)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate the search index.
+	authApp.searchInterval, err = authApp.Cfg.Search.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate request deadlines.
+	authApp.timeouts, err = authApp.Cfg.Deadline.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate API rate limits.
+	authApp.rateLimit, err = authApp.Cfg.RateLimit.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate CSP report limits.
+	authApp.cspReportLimit, err = authApp.Cfg.CSP.reportLimit()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate retention periods.
+	authApp.retention, err = authApp.Cfg.Retention.periods()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate location restrictions, which challenge with login links.
+	authApp.geo, err = authApp.Cfg.Geo.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+	if authApp.geo.challenges() && authApp.magicExpires == 0 {
+		return nil, fmt.Errorf("%w: Geo challenge without Auth.MagicExpires", ErrInvalidConfig)
+	}
+
+	// Validate request screening, which uses the added screeners.
+	authApp.screen, err = authApp.Cfg.Screen.parse(authApp.Fingerprinter, authApp.Screeners)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+	if authApp.screen.limit != 0 && authApp.rateLimit.limit == 0 {
+		return nil, fmt.Errorf("%w: Screen.Limit without RateLimit", ErrInvalidConfig)
+	}
+
+	// Validate risk scoring, which challenges with login links.
+	authApp.risk, err = authApp.Cfg.Risk.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+	if authApp.risk != nil && authApp.risk.challenge != 0 && authApp.magicExpires == 0 {
+		return nil, fmt.Errorf("%w: Risk.Challenge without Auth.MagicExpires", ErrInvalidConfig)
+	}
+	if authApp.risk != nil && authApp.Risk == nil {
+		authApp.Risk = HeuristicRiskScorer{Screeners: authApp.screen.screeners, Window: authApp.risk.window}
+	}
+
+	// Validate cookie formats.
+	authApp.cookies, err = authApp.Cfg.Auth.Cookie.format()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Load the Markdown pages, if enabled.
+	if authApp.Cfg.Pages.Dir != "" {
+		authApp.Pages, err = webpages.Load(authApp.Cfg.Pages)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+	}
+
+	// Validate login providers.
+	authApp.oauth, err = newOAuthProviders(authApp.Cfg.OAuth)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Share the clock, random source, and password hasher with the
+	// datastore so tokens are created and expired consistently and
+	// passwords are hashed the same way.
+	if authApp.Clock == nil {
+		authApp.Clock = SystemClock{}
+	} else if s, ok := authApp.DB.(interface{ SetClock(Clock) }); ok {
+		s.SetClock(authApp.Clock)
+	}
+	if authApp.Catalog == nil {
+		authApp.Catalog = i18n.NewCatalog(i18n.DefaultLanguage)
+	}
+	if authApp.Rand == nil {
+		authApp.Rand = rand.Reader
+	} else if s, ok := authApp.DB.(interface{ SetRand(io.Reader) }); ok {
+		s.SetRand(authApp.Rand)
+	}
+	if s, ok := authApp.DB.(interface{ SetPasswordHasher(PasswordHasher) }); ok {
+		s.SetPasswordHasher(authApp.Hasher)
+	}
+	if s, ok := authApp.DB.(interface{ SetWaitlist(bool) }); ok {
+		s.SetWaitlist(authApp.Cfg.Waitlist.Enabled)
+	}
+
+	// Validate the breached password check, which uses the clock.
+	authApp.breach, err = authApp.Cfg.Auth.Breach.parse(authApp.Clock)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Validate keys of signed requests, which use the clock.
+	authApp.signatures, err = authApp.Cfg.Signature.verifier(authApp.Clock)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Keep session values, rate limits, and messages of the Live server
+	// in Redis, so they are shared by instances, if enabled.
+	if authApp.Cfg.Redis.Enabled() {
+		authApp.Redis, err = webredis.New(authApp.Cfg.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+		}
+		if authApp.DB != nil {
+			authApp.DB = newRedisStore(authApp.DB, authApp.Redis, authApp.Clock, authApp.loginExpires)
+		}
+		if authApp.Live != nil {
+			authApp.broker = webredis.NewBroker(authApp.Redis, authApp.Live, "live")
+		}
+	}
+
+	// Validate the caches, which use the clock and Redis.
+	authApp.caches, err = authApp.Cfg.Cache.parse(authApp.Clock, authApp.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Forget the cached sessions of users whose auth state changes.
+	if authApp.caches.sessions != nil && authApp.DB != nil {
+		authApp.DB = newSessionCacheStore(authApp.DB, authApp.caches.sessions)
+	}
+
+	// Publish new events and registrations to the admin pages.
+	if authApp.Live != nil && authApp.DB != nil {
+		authApp.DB = newLiveStore(authApp.DB, authApp.Live, authApp.publisher(), authApp.Clock, authApp.TimeZones)
+	}
+
+	// Publish scheduled announcements to their own topic.
+	if authApp.Live != nil {
+		authApp.Live.RegisterEvent(AnnouncementsEvent)
+	}
+
+	// Use the configured signing keys or generate a random one.
+	if authApp.Cfg.Auth.SigningKey == "" && len(authApp.Cfg.Auth.SigningKeys) == 0 {
+		slog.Warn("no SigningKey in config, signed URLs will not survive a restart")
+	}
+	authApp.signingKeys, err = authApp.Cfg.Auth.signingKeys(authApp.Rand)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	// Send operational alerts to the configured sinks.
+	if authApp.Notifier == nil {
+		authApp.Notifier = authApp.Cfg.Notify.Notifier(authApp.Cfg.SMTP, authApp.Cfg.EmailFrom)
+	}
+
+	// Check the health of the database and SMTP server. Apps can add
+	// checks for other components, such as a websse.Server.
+	authApp.Checks = &webhealth.Checks{}
+	if authApp.DB != nil {
+		authApp.Checks.Add("database", webhealth.CheckerFunc(authApp.DB.PingContext))
+	}
+	if _, ok := authApp.DB.(schemaChecker); ok {
+		authApp.Checks.Add("schema", webhealth.CheckerFunc(authApp.SchemaError))
+	}
+	authApp.Checks.Add("email", webhealth.SMTPChecker(authApp.Cfg.SMTP))
+	if authApp.Live != nil {
+		authApp.Checks.Add("live", authApp.Live)
+	}
+	if authApp.Redis != nil {
+		authApp.Checks.Add("redis", authApp.Redis)
+	}
+	authApp.Checks.Add("templates", webhealth.TemplateChecker(authApp.Tmpl))
+
+	// The app is alive if it can render pages. Dependencies are left to
+	// Checks, so that an outage does not restart every instance.
+	authApp.LiveChecks = &webhealth.Checks{}
+	authApp.LiveChecks.Add("templates", webhealth.TemplateChecker(authApp.Tmpl))
+
 	slog.Debug("created new auth app",
 		slog.String("authApp", authApp.String()))
 
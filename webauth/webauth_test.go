@@ -4,14 +4,22 @@
 package webauth_test
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"text/template"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
+	"github.com/bnixon67/webapp/assets"
+	"github.com/bnixon67/webapp/i18n"
 	"github.com/bnixon67/webapp/webapp"
 	"github.com/bnixon67/webapp/webauth"
 	"github.com/bnixon67/webapp/weblog"
+	"github.com/bnixon67/webapp/webtest"
 	"github.com/bnixon67/webapp/webutil"
 )
 
@@ -68,6 +76,25 @@ func TestNewApp(t *testing.T) {
 	}
 }
 
+func TestWithRand(t *testing.T) {
+	loginToken := func() string {
+		app := newAppForTest(t, nil,
+			webauth.WithDB(StoreForTest(t)),
+			webauth.WithRand(webtest.NewSeqReader(1)))
+
+		token, err := app.CreateLoginToken("test")
+		if err != nil {
+			t.Fatalf("CreateLoginToken() failed: %v", err)
+		}
+		return token.Value
+	}
+
+	first, second := loginToken(), loginToken()
+	if first != second {
+		t.Errorf("tokens differ with the same random source: %q and %q", first, second)
+	}
+}
+
 // global to provide a singleton app.
 var app *webauth.AuthApp //nolint
 
@@ -86,28 +113,17 @@ func AppForTest(t *testing.T) *webauth.AuthApp {
 			t.Fatalf("failed to initialize logging: %v", err)
 		}
 
-		// Define the custom function
-		funcMap := template.FuncMap{
-			"ToTimeZone": webutil.ToTimeZone,
-			"Join":       webutil.Join,
-		}
-
 		// Initialize templates
-		tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern, funcMap)
+		tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern, tmplFuncsForTest)
 		if err != nil {
 			t.Fatalf("failed to init templates: %v", err)
 		}
 
-		db, err := webauth.InitDB(cfg.SQL.DriverName, cfg.SQL.DataSourceName)
-		if err != nil {
-			t.Fatalf("failed to init db: %v", err)
-		}
-
 		app, err = webauth.NewApp(
 			webapp.WithTemplate(tmpl),
 			webapp.WithName(cfg.App.Name),
 			webauth.WithConfig(*cfg),
-			webauth.WithDB(db),
+			webauth.WithDB(StoreForTest(t)),
 		)
 		if err != nil {
 			app = nil
@@ -118,3 +134,154 @@ func AppForTest(t *testing.T) *webauth.AuthApp {
 
 	return app
 }
+
+// DBForTest returns an AuthDB for the SQL database in the test config,
+// loaded with sql/test_db.sql. The WEBAUTH_TEST_DRIVER and WEBAUTH_TEST_DSN
+// environment variables override the config, e.g., to test with Postgres
+// using sql/postgres/test_db.sql. The test is skipped if it is unavailable.
+func DBForTest(t *testing.T) *webauth.AuthDB {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to created config: %v", err)
+	}
+
+	driverName, dataSourceName := cfg.SQL.DriverName, cfg.SQL.DataSourceName
+	if v := os.Getenv("WEBAUTH_TEST_DRIVER"); v != "" {
+		driverName = v
+	}
+	if v := os.Getenv("WEBAUTH_TEST_DSN"); v != "" {
+		dataSourceName = v
+	}
+
+	db, err := webauth.InitDB(driverName, dataSourceName)
+	if err != nil {
+		t.Skipf("skipping, no test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// Upgrade the schema created by sql/test_db.sql.
+	if _, err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// TestPasswordHash is the hash of "password" for the users in StoreForTest.
+const TestPasswordHash = "$2a$10$2bLycFqUmc6m6iLkaeUgKOGwzekGd9IoAPMbXRNNuJ8Sv9ItgV29O"
+
+// StoreForTest returns a MemStore with the same data as sql/test_db.sql.
+func StoreForTest(t *testing.T) *webauth.MemStore {
+	store := webauth.NewMemStore()
+
+	users := []webauth.User{
+		{Username: "test", FullName: "Test User", Email: "test@email"},
+		{Username: "admin", FullName: "Admin User", Email: "admin@email", IsAdmin: true},
+		{Username: "unconfirmed", FullName: "Unconfirmed User", Email: "unconfirmed@email", IsAdmin: true},
+		{Username: "confirmed", FullName: "Unconfirmed User", Email: "confirmed@email", IsAdmin: true, Confirmed: true},
+		{Username: "expired", FullName: "Expired Confirm Token", Email: "expired@email", IsAdmin: true, Confirmed: true},
+	}
+	for _, u := range users {
+		if err := store.AddUser(u, TestPasswordHash); err != nil {
+			t.Fatalf("failed to add user %q: %v", u.Username, err)
+		}
+	}
+
+	logins := []struct {
+		username string
+		hour     int
+	}{
+		{"test1", 1},
+		{"test2", 1}, {"test2", 2},
+		{"test3", 3}, {"test3", 2}, {"test3", 1},
+		{"test4", 1}, {"test4", 4}, {"test4", 2}, {"test4", 3},
+	}
+	for _, l := range logins {
+		store.AddEvent(webauth.Event{
+			Name:      webauth.EventLogin,
+			Succeeded: true,
+			Username:  l.username,
+			Created:   time.Date(2023, time.January, 15, l.hour, 0, 0, 0, time.UTC),
+		})
+	}
+
+	return store
+}
+
+// tzForTest converts the times of templates in tests.
+var tzForTest, _ = webutil.NewTimeZones("", nil)
+
+// tmplFuncsForTest are the functions used by templates, to parse templates
+// in tests.
+var tmplFuncsForTest = template.FuncMap{
+	"ToTimeZone":   tzForTest.ToTimeZone,
+	"LocalTime":    tzForTest.LocalTime,
+	"RelativeTime": tzForTest.RelativeTime,
+	"Join":         webutil.Join,
+	"CSRFField":    webutil.CSRFField,
+	"NonceAttr":    webutil.NonceAttr,
+	"T":            i18n.T,
+}
+
+// renderForTest returns the template name of the assets executed with
+// data, in its layout if it extends one, to compare with the body of a
+// response.
+func renderForTest(name string, data any) string {
+	pattern := filepath.Join(assets.AssetPath(), "tmpl", "*.html")
+	tmpl, err := webutil.TemplatesWithFuncs(pattern, tmplFuncsForTest)
+	if err != nil {
+		return err.Error()
+	}
+
+	var body bytes.Buffer
+	tmpl.ExecuteTemplate(&body, name, data)
+
+	return body.String()
+}
+
+// AppWithoutDBForTest is a helper function that returns an App with an
+// empty MemStore, used to test functions that do not depend on test data.
+// Each function in modify is applied to the config before the App is created.
+func AppWithoutDBForTest(t *testing.T, modify ...func(*webauth.Config)) *webauth.AuthApp {
+	return newAppForTest(t, modify, webauth.WithDB(webauth.NewMemStore()))
+}
+
+// AppWithClockForTest is a helper function that returns a new App with the
+// test data in StoreForTest and the given clock, used to test expiration.
+func AppWithClockForTest(t *testing.T, clock webauth.Clock) *webauth.AuthApp {
+	return newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)), webauth.WithClock(clock))
+}
+
+// newAppForTest returns an App created with opts and the test config,
+// after applying each function in modify to the config.
+func newAppForTest(t *testing.T, modify []func(*webauth.Config), opts ...webauth.Option) *webauth.AuthApp {
+	cfg, err := webauth.LoadConfigFromJSON(TestConfigFile)
+	if err != nil {
+		t.Fatalf("failed to created config: %v", err)
+	}
+
+	for _, m := range modify {
+		m(cfg)
+	}
+
+	tmpl, err := webutil.TemplatesWithFuncs(cfg.App.TmplPattern, tmplFuncsForTest)
+	if err != nil {
+		t.Fatalf("failed to init templates: %v", err)
+	}
+
+	options := []interface{}{
+		webapp.WithTemplate(tmpl),
+		webapp.WithName(cfg.App.Name),
+		webauth.WithConfig(*cfg),
+	}
+	for _, opt := range opts {
+		options = append(options, opt)
+	}
+
+	a, err := webauth.NewApp(options...)
+	if err != nil {
+		t.Fatalf("cannot create NewApp, %v", err)
+	}
+
+	return a
+}
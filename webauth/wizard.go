@@ -0,0 +1,115 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Wizard actions, sent as the "action" form value of a POST.
+const (
+	WizardNext = "next" // WizardNext validates the step and moves forward.
+	WizardBack = "back" // WizardBack moves to the previous step.
+)
+
+// WizardStep is a step of a Wizard.
+type WizardStep struct {
+	Name string
+
+	// Validate checks the form values of the step in r and saves them in
+	// values for later steps. The error it returns is shown to the user,
+	// who stays on the step. If nil, the step has no values.
+	Validate func(r *http.Request, values map[string]string) error
+}
+
+// Wizard is a multi-step form, such as a confirmation or enrollment flow.
+// Its state is saved in the Session, so the user can go back and forth
+// between steps and resume after an interruption.
+type Wizard struct {
+	Name  string // Name is unique among the wizards of a session.
+	Steps []WizardStep
+}
+
+// WizardState is the state of a Wizard for a session.
+type WizardState struct {
+	Step   int               `json:"step"`   // Step is the index of the current step.
+	Values map[string]string `json:"values"` // Values are saved by Validate.
+
+	Name  string `json:"-"` // Name is the name of the current step.
+	Error string `json:"-"` // Error is why the values of the step are invalid.
+	Done  bool   `json:"-"` // Done is true once the last step is valid.
+}
+
+// key returns the session key of the state of wz.
+func (wz *Wizard) key() string {
+	return "wizard:" + wz.Name
+}
+
+// Load returns the saved state of wz in s, or the first step if there is
+// none.
+func (wz *Wizard) Load(s *Session) (WizardState, error) {
+	var state WizardState
+
+	err := s.Get(wz.key(), &state)
+	if err != nil && !errors.Is(err, ErrSessionValueNotFound) {
+		return WizardState{}, err
+	}
+
+	// Start over if the steps changed since the state was saved.
+	if state.Step < 0 || state.Step >= len(wz.Steps) {
+		state = WizardState{}
+	}
+	state.Name = wz.Steps[state.Step].Name
+
+	return state, nil
+}
+
+// Handle loads the state of wz from s and applies the action of a POST
+// request, saving the new state. When the last step is valid, the state
+// is Done with the Values of all the steps, and is removed from s.
+//
+// The returned error is from s, not from validation.
+func (wz *Wizard) Handle(r *http.Request, s *Session) (WizardState, error) {
+	state, err := wz.Load(s)
+	if err != nil || r.Method != http.MethodPost {
+		return state, err
+	}
+
+	switch r.PostFormValue("action") {
+	case WizardBack:
+		if state.Step > 0 {
+			state.Step--
+		}
+
+	case WizardNext:
+		if state.Values == nil {
+			state.Values = make(map[string]string)
+		}
+		if validate := wz.Steps[state.Step].Validate; validate != nil {
+			if err := validate(r, state.Values); err != nil {
+				state.Error = err.Error()
+				return state, nil
+			}
+		}
+
+		if state.Step == len(wz.Steps)-1 {
+			state.Done = true
+			return state, wz.Reset(s)
+		}
+		state.Step++
+
+	default:
+		return state, nil
+	}
+
+	state.Name = wz.Steps[state.Step].Name
+
+	return state, s.Set(wz.key(), state)
+}
+
+// Reset removes the state of wz from s, so it starts at the first step.
+func (wz *Wizard) Reset(s *Session) error {
+	return s.Delete(wz.key())
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webauth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webauth"
+)
+
+func TestWizard(t *testing.T) {
+	app := newAppForTest(t, nil, webauth.WithDB(StoreForTest(t)))
+
+	login, err := app.LoginUser("test", "password")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	errNoEmail := errors.New("email is required")
+	wizard := &webauth.Wizard{
+		Name: "enroll",
+		Steps: []webauth.WizardStep{
+			{Name: "email", Validate: func(r *http.Request, values map[string]string) error {
+				if r.PostFormValue("email") == "" {
+					return errNoEmail
+				}
+				values["email"] = r.PostFormValue("email")
+				return nil
+			}},
+			{Name: "code", Validate: func(r *http.Request, values map[string]string) error {
+				values["code"] = r.PostFormValue("code")
+				return nil
+			}},
+		},
+	}
+
+	// handle applies the action of a request with form data to wizard.
+	handle := func(token, method string, data url.Values) (webauth.WizardState, error) {
+		r := httptest.NewRequest(method, "/enroll", strings.NewReader(data.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: webauth.LoginTokenCookieName, Value: token})
+		return wizard.Handle(r, app.Session(r))
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		data      url.Values
+		wantStep  string
+		wantError string
+		wantDone  bool
+	}{
+		{"start", http.MethodGet, nil, "email", "", false},
+		{"invalid", http.MethodPost, url.Values{"action": {"next"}}, "email", errNoEmail.Error(), false},
+		{"valid", http.MethodPost, url.Values{"action": {"next"}, "email": {"test@example.com"}}, "code", "", false},
+		{"resume", http.MethodGet, nil, "code", "", false},
+		{"unknownAction", http.MethodPost, url.Values{"action": {"skip"}}, "code", "", false},
+		{"back", http.MethodPost, url.Values{"action": {"back"}}, "email", "", false},
+		{"backAtStart", http.MethodPost, url.Values{"action": {"back"}}, "email", "", false},
+		{"next", http.MethodPost, url.Values{"action": {"next"}, "email": {"new@example.com"}}, "code", "", false},
+		{"done", http.MethodPost, url.Values{"action": {"next"}, "code": {"123456"}}, "code", "", true},
+		{"restart", http.MethodGet, nil, "email", "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state, err := handle(login.Value, tc.method, tc.data)
+			if err != nil {
+				t.Fatalf("Handle() failed: %v", err)
+			}
+			if state.Name != tc.wantStep || state.Error != tc.wantError || state.Done != tc.wantDone {
+				t.Errorf("Handle() = %+v, want step %q, error %q, done %v", state, tc.wantStep, tc.wantError, tc.wantDone)
+			}
+			if tc.wantDone && (state.Values["email"] != "new@example.com" || state.Values["code"] != "123456") {
+				t.Errorf("Values = %v, want values of every step", state.Values)
+			}
+		})
+	}
+
+	// A request without a login can see the first step, but not advance.
+	state, err := handle("", http.MethodGet, nil)
+	if err != nil || state.Name != "email" {
+		t.Errorf("Handle() without login = %+v, %v, want first step", state, err)
+	}
+	_, err = handle("", http.MethodPost, url.Values{"action": {"next"}, "email": {"test@example.com"}})
+	if !errors.Is(err, webauth.ErrNoSession) {
+		t.Errorf("Handle() next without login = %v, want %v", err, webauth.ErrNoSession)
+	}
+}
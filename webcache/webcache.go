@@ -0,0 +1,306 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webcache provides an in-memory cache of values by key that
+// expire after a TTL and are evicted, least recently used first, when the
+// cache is full. Values are loaded once for concurrent callers with
+// GetOrLoad.
+//
+// The Stats of caches created WithMetrics are published with expvar under
+// "webcache", so they are visible at /debug/vars.
+package webcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics holds the Stats of each cache with a name.
+var metrics = expvar.NewMap("webcache")
+
+// ErrLoadPanicked is returned to callers of GetOrLoad that waited for a
+// load that panicked.
+var ErrLoadPanicked = errors.New("webcache: load panicked")
+
+// Stats are the counts of the use of a Cache.
+type Stats struct {
+	Hits        int64 // Hits are lookups that found a value.
+	Misses      int64 // Misses are lookups that did not find a value.
+	Loads       int64 // Loads are the calls of a load function by GetOrLoad.
+	LoadErrors  int64 // LoadErrors are loads that returned an error.
+	Evictions   int64 // Evictions are values removed to make room.
+	Expirations int64 // Expirations are values removed after their TTL.
+	Len         int   // Len is the number of values.
+}
+
+// Option configures a Cache.
+type Option func(*options)
+
+// options are the settings of a Cache.
+type options struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	name       string
+}
+
+// WithTTL returns an Option to set how long values are cached. If ttl is
+// zero or negative, values do not expire.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithMaxEntries returns an Option to set the number of values cached,
+// after which the least recently used value is evicted. If n is zero or
+// negative, the number of values is not limited.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		o.maxEntries = n
+	}
+}
+
+// WithNow returns an Option to set the source of the current time used to
+// expire values, e.g., for tests.
+func WithNow(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// WithMetrics returns an Option to publish the Stats of the cache with
+// expvar as name under "webcache". A later cache with the same name
+// replaces the earlier one.
+func WithMetrics(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// entry is a cached value.
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time // expires is zero if the value does not expire.
+}
+
+// call is a load of GetOrLoad in progress.
+type call[V any] struct {
+	done   chan struct{} // done is closed when the load returns.
+	value  V
+	err    error
+	forget bool // forget is true if the key was deleted during the load.
+}
+
+// Store is a cache of values of type V by keys of type K. It is
+// implemented by Cache, and by caches shared by instances of an app, such
+// as those of webredis.
+type Store[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+	Clear()
+	GetOrLoad(ctx context.Context, key K, load func(context.Context) (V, error)) (V, error)
+}
+
+// Cache is a TTL and LRU cache of values of type V by keys of type K. It
+// is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	opts options
+
+	mu    sync.Mutex
+	ll    *list.List // ll has the entries, most recently used first.
+	items map[K]*list.Element
+	calls map[K]*call[V] // calls are the loads in progress by key.
+	stats Stats
+}
+
+// New returns a Cache with the given options.
+func New[K comparable, V any](opts ...Option) *Cache[K, V] {
+	c := &Cache[K, V]{
+		opts:  options{now: time.Now},
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+		calls: make(map[K]*call[V]),
+	}
+
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+
+	if c.opts.name != "" {
+		metrics.Set(c.opts.name, expvar.Func(func() any { return c.Stats() }))
+	}
+
+	return c
+}
+
+// get returns the unexpired value of key and counts the lookup. The
+// caller must hold c.mu.
+func (c *Cache[K, V]) get(key K) (V, bool) {
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		if e.expires.IsZero() || c.opts.now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.stats.Hits++
+			return e.value, true
+		}
+
+		c.remove(el)
+		c.stats.Expirations++
+	}
+
+	c.stats.Misses++
+
+	var zero V
+	return zero, false
+}
+
+// Get returns the value of key, and true if it was found and not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.get(key)
+}
+
+// set caches value for key. The caller must hold c.mu.
+func (c *Cache[K, V]) set(key K, value V) {
+	var expires time.Time
+	if c.opts.ttl > 0 {
+		expires = c.opts.now().Add(c.opts.ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	for c.opts.maxEntries > 0 && c.ll.Len() > c.opts.maxEntries {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Set caches value for key, replacing any value it had.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value)
+}
+
+// remove removes the entry of el. The caller must hold c.mu.
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
+
+// Delete removes the value of key. A load of key in progress is not
+// cached, so a value that changed during the load is not kept.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if call, ok := c.calls[key]; ok {
+		call.forget = true
+		delete(c.calls, key)
+	}
+}
+
+// Clear removes all values, and loads in progress are not cached.
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.items)
+	for key, call := range c.calls {
+		call.forget = true
+		delete(c.calls, key)
+	}
+}
+
+// Len returns the number of values, including expired values that are not
+// yet removed.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Stats returns the counts of the use of c.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Len = c.ll.Len()
+
+	return stats
+}
+
+// GetOrLoad returns the value of key, calling load to get and cache it if
+// it is not cached. Concurrent calls for the same key wait for a single
+// load and share its result. Errors are returned but not cached.
+//
+// load is called with the ctx of the first caller. Other callers stop
+// waiting if their ctx is done and return its error.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, load func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if value, ok := c.get(key); ok {
+		c.mu.Unlock()
+		return value, nil
+	}
+
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-cl.done:
+			return cl.value, cl.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.stats.Loads++
+	c.mu.Unlock()
+
+	// Finish the call even if load panics, so waiters do not block.
+	defer func() {
+		c.mu.Lock()
+		if cl.err != nil {
+			c.stats.LoadErrors++
+		} else if !cl.forget {
+			c.set(key, cl.value)
+		}
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+		c.mu.Unlock()
+
+		close(cl.done)
+	}()
+
+	cl.err = ErrLoadPanicked
+	cl.value, cl.err = load(ctx)
+
+	return cl.value, cl.err
+}
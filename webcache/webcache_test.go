@@ -0,0 +1,182 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webcache_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webcache"
+)
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := webcache.New[string, int](webcache.WithTTL(time.Minute),
+		webcache.WithNow(func() time.Time { return now }))
+
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Get() = %d, %v, want 1, true", v, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if v, ok := c.Get("a"); ok {
+		t.Errorf("Get() = %d, %v after TTL, want not found", v, ok)
+	}
+
+	want := webcache.Stats{Hits: 1, Misses: 1, Expirations: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := webcache.New[string, int](webcache.WithMaxEntries(2))
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // a is now more recently used than b.
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if got := c.Stats(); got.Evictions != 1 || got.Len != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction and 2 values", got)
+	}
+
+	c.Delete("a")
+	c.Clear()
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d after Clear, want 0", c.Len())
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c := webcache.New[string, int]()
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(context.Background(), "k", load)
+			if err != nil || v != 42 {
+				t.Errorf("GetOrLoad() = %d, %v, want 42, nil", v, err)
+			}
+		}()
+	}
+
+	// Wait for the load to start before releasing it.
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("load called %d times, want 1", got)
+	}
+	if v, ok := c.Get("k"); !ok || v != 42 {
+		t.Errorf("Get() = %d, %v, want 42, true", v, ok)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	c := webcache.New[string, int]()
+
+	errLoad := errors.New("load failed")
+	_, err := c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) {
+		return 0, errLoad
+	})
+	if !errors.Is(err, errLoad) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, errLoad)
+	}
+	if _, ok := c.Get("k"); ok {
+		t.Error("error was cached")
+	}
+	if got := c.Stats(); got.Loads != 1 || got.LoadErrors != 1 {
+		t.Errorf("Stats() = %+v, want 1 load with an error", got)
+	}
+}
+
+func TestGetOrLoadDeleted(t *testing.T) {
+	c := webcache.New[string, int]()
+
+	c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) {
+		c.Delete("k") // The value changed during the load.
+		return 1, nil
+	})
+
+	if _, ok := c.Get("k"); ok {
+		t.Error("value loaded before Delete was cached")
+	}
+}
+
+func TestGetOrLoadContext(t *testing.T) {
+	c := webcache.New[string, int]()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	defer close(release)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetOrLoad(ctx, "k", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestGetOrLoadPanic(t *testing.T) {
+	c := webcache.New[string, int]()
+
+	func() {
+		defer func() { recover() }()
+		c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) {
+			panic("boom")
+		})
+	}()
+
+	// The key is not stuck in a load.
+	v, err := c.GetOrLoad(context.Background(), "k", func(context.Context) (int, error) {
+		return 2, nil
+	})
+	if err != nil || v != 2 {
+		t.Errorf("GetOrLoad() = %d, %v, want 2, nil", v, err)
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	c := webcache.New[string, int](webcache.WithMetrics("test"))
+	c.Get("missing")
+
+	metrics := expvar.Get("webcache").(*expvar.Map)
+	if got, want := metrics.Get("test").String(), `{"Hits":0,"Misses":1,"Loads":0,"LoadErrors":0,"Evictions":0,"Expirations":0,"Len":0}`; got != want {
+		t.Errorf("metrics = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+var (
+	ErrBearerMissing = errors.New("bearer token missing")
+	ErrBearerInvalid = errors.New("invalid bearer token")
+)
+
+// Bearer is the subject authenticated by a bearer token and the scopes
+// the token grants.
+type Bearer struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope returns true if b grants scope.
+func (b Bearer) HasScope(scope string) bool {
+	return slices.Contains(b.Scopes, scope)
+}
+
+// BearerFunc returns the Bearer authenticated by token. It returns
+// ErrBearerInvalid, or an error that wraps it, if the token is not valid.
+// Other errors are treated as server errors.
+type BearerFunc func(ctx context.Context, token string) (Bearer, error)
+
+// bearerKeyType is a custom type to avoid collisions in context values.
+type bearerKeyType struct{}
+
+// bearerKey is used to store/retrieve the Bearer from a context.
+var bearerKey = bearerKeyType{}
+
+// BearerFromContext returns the Bearer of the request with ctx, if it was
+// authenticated by BearerAuth.
+func BearerFromContext(ctx context.Context) (Bearer, bool) {
+	b, ok := ctx.Value(bearerKey).(Bearer)
+	return b, ok
+}
+
+// BearerToken returns the token of the Authorization header of r, or ""
+// if r does not have a bearer token.
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// BearerAuth returns middleware that calls next only if the request has
+// a bearer token authenticated by auth, as described by RFC 6750.
+// Otherwise, it responds with http.StatusUnauthorized. The Bearer is
+// available to next from BearerFromContext.
+func BearerAuth(next http.Handler, auth BearerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := RequestLogger(r)
+
+		token := BearerToken(r)
+		if token == "" {
+			logger.Warn("bearer not authenticated", "err", ErrBearerMissing)
+			w.Header().Set("WWW-Authenticate", `Bearer`)
+			webutil.Error(w, r, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		b, err := auth(r.Context(), token)
+		if errors.Is(err, ErrBearerInvalid) {
+			logger.Warn("bearer not authenticated", "err", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			webutil.Error(w, r, http.StatusUnauthorized, "", "")
+			return
+		}
+		if err != nil {
+			logger.Error("failed to authenticate bearer", "err", err)
+			webutil.Error(w, r, http.StatusInternalServerError, "", "")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), bearerKey, b)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope returns middleware that calls next only if the request was
+// authenticated by BearerAuth with a token that grants scope. Otherwise,
+// it responds with http.StatusForbidden.
+func RequireScope(next http.Handler, scope string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := BearerFromContext(r.Context())
+		if !ok || !b.HasScope(scope) {
+			RequestLogger(r).Warn("bearer missing scope", "scope", scope)
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			webutil.Error(w, r, http.StatusForbidden, "", "")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
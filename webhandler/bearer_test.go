@@ -0,0 +1,88 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestBearerAuth(t *testing.T) {
+	auth := func(ctx context.Context, token string) (webhandler.Bearer, error) {
+		switch token {
+		case "good":
+			return webhandler.Bearer{Subject: "alice", Scopes: []string{"read"}}, nil
+		case "broken":
+			return webhandler.Bearer{}, errors.New("database down")
+		}
+		return webhandler.Bearer{}, fmt.Errorf("%w: unknown", webhandler.ErrBearerInvalid)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := webhandler.BearerFromContext(r.Context())
+		w.Write([]byte(b.Subject))
+	})
+	h := webhandler.BearerAuth(next, auth)
+	read := webhandler.BearerAuth(webhandler.RequireScope(next, "read"), auth)
+	write := webhandler.BearerAuth(webhandler.RequireScope(next, "write"), auth)
+
+	tests := []struct {
+		name          string
+		h             http.Handler
+		authorization string
+		wantStatus    int
+		wantBody      string
+		wantChallenge string
+	}{
+		{"valid", h, "Bearer good", http.StatusOK, "alice", ""},
+		{"lower case scheme", h, "bearer good", http.StatusOK, "alice", ""},
+		{"missing", h, "", http.StatusUnauthorized, "", "Bearer"},
+		{"basic", h, "Basic Zm9vOmJhcg==", http.StatusUnauthorized, "", "Bearer"},
+		{"invalid", h, "Bearer bad", http.StatusUnauthorized, "", `Bearer error="invalid_token"`},
+		{"error", h, "Bearer broken", http.StatusInternalServerError, "", ""},
+		{"scope", read, "Bearer good", http.StatusOK, "alice", ""},
+		{"missing scope", write, "Bearer good", http.StatusForbidden, "", `Bearer error="insufficient_scope", scope="write"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			tc.h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tc.wantBody)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tc.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tc.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(""))
+	if got := webhandler.BearerToken(r); got != "" {
+		t.Errorf("BearerToken() without header = %q, want empty", got)
+	}
+
+	r.Header.Set("Authorization", "Bearer  abc ")
+	if got := webhandler.BearerToken(r); got != "abc" {
+		t.Errorf("BearerToken() = %q, want %q", got, "abc")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// CORSPolicy is the Cross-Origin Resource Sharing policy of routes, which
+// allows browser apps on other origins to call them.
+type CORSPolicy struct {
+	// Origins are the allowed origins, such as "https://app.example.com".
+	// An origin of "https://*.example.com" allows the subdomains of
+	// example.com, and "*" allows any origin.
+	Origins []string
+
+	// Methods are the allowed methods. If empty, GET, HEAD, and POST are
+	// allowed.
+	Methods []string
+
+	// Headers are the allowed request headers beyond those always allowed
+	// by browsers. "*" allows any header.
+	Headers []string
+
+	// ExposedHeaders are the response headers that scripts can read
+	// beyond those always exposed by browsers.
+	ExposedHeaders []string
+
+	// Credentials allows requests with cookies and Authorization headers.
+	// The origin of the request is then returned instead of "*".
+	Credentials bool
+
+	// MaxAge is how long browsers can cache the result of a preflight
+	// request. If zero, browsers use their default of a few seconds.
+	MaxAge time.Duration
+}
+
+// defaultCORSMethods are the methods allowed if CORSPolicy.Methods is empty.
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// AllowsOrigin returns true if origin is allowed by p.
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	for _, o := range p.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+
+		// Match a subdomain wildcard, such as "https://*.example.com".
+		scheme, host, ok := strings.Cut(o, "://*.")
+		if !ok {
+			continue
+		}
+		prefix := strings.ToLower(scheme + "://")
+		lower := strings.ToLower(origin)
+		if strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, "."+strings.ToLower(host)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// methods returns the methods allowed by p.
+func (p *CORSPolicy) methods() []string {
+	if len(p.Methods) == 0 {
+		return defaultCORSMethods
+	}
+
+	return p.Methods
+}
+
+// allowsHeaders returns true if each of the comma-separated headers is
+// allowed by p.
+func (p *CORSPolicy) allowsHeaders(headers string) bool {
+	if slices.Contains(p.Headers, "*") {
+		return true
+	}
+
+	for _, h := range strings.Split(headers, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !slices.ContainsFunc(p.Headers, func(allowed string) bool {
+			return strings.EqualFold(allowed, h)
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// varies returns true if responses depend on the origin of the request,
+// so caches must not share them between origins.
+func (p *CORSPolicy) varies() bool {
+	return p.Credentials || !slices.Contains(p.Origins, "*")
+}
+
+// allowOrigin sets the headers of w that allow the origin of r.
+func (p *CORSPolicy) allowOrigin(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+
+	if p.varies() {
+		h.Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+
+	if p.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// IsPreflight returns true if r is a CORS preflight request, which asks
+// if a cross-origin request is allowed before the browser sends it.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflight responds to the preflight request r. The request is allowed
+// if its origin, method, and headers are allowed, and is otherwise
+// forbidden.
+func (p *CORSPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers := r.Header.Get("Access-Control-Request-Headers")
+
+	if !p.AllowsOrigin(r.Header.Get("Origin")) ||
+		!slices.Contains(p.methods(), method) ||
+		!p.allowsHeaders(headers) {
+		webutil.Error(w, r, http.StatusForbidden, "", "")
+		return
+	}
+
+	p.allowOrigin(w, r)
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.methods(), ", "))
+	if headers != "" {
+		// Echo the requested headers, since "*" is not allowed with
+		// credentials.
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(p.MaxAge.Seconds()), 10))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CORS returns middleware that applies policy to requests. Preflight
+// requests are answered without calling next, and other requests from an
+// allowed origin are passed to next with headers that let the browser
+// read the response. Requests from other origins are passed to next
+// without the headers, so the browser blocks the response. If policy is
+// nil, next is returned.
+func CORS(next http.Handler, policy *CORSPolicy) http.Handler {
+	if policy == nil {
+		return next
+	}
+
+	exposed := strings.Join(policy.ExposedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsPreflight(r) {
+			policy.preflight(w, r)
+			return
+		}
+
+		if policy.varies() {
+			w.Header().Add("Vary", "Origin")
+		}
+		if policy.AllowsOrigin(r.Header.Get("Origin")) {
+			policy.allowOrigin(w, r)
+			if exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestCORSPolicyAllowsOrigin(t *testing.T) {
+	p := &webhandler.CORSPolicy{Origins: []string{"https://app.example.com", "https://*.example.org"}}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://a.example.org", false},
+		{"https://evilexample.org", false},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		if got := p.AllowsOrigin(tc.origin); got != tc.want {
+			t.Errorf("AllowsOrigin(%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	next := textHandler("data")
+
+	credentials := &webhandler.CORSPolicy{
+		Origins:        []string{"https://app.example.com"},
+		Methods:        []string{http.MethodGet, http.MethodPost},
+		Headers:        []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		Credentials:    true,
+		MaxAge:         time.Hour,
+	}
+	public := &webhandler.CORSPolicy{Origins: []string{"*"}}
+
+	tests := []struct {
+		name        string
+		policy      *webhandler.CORSPolicy
+		method      string
+		header      map[string]string
+		wantStatus  int
+		wantBody    string
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "simple",
+			policy:     credentials,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantBody:   "data",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:       "otherOrigin",
+			policy:     credentials,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://evil.example.com"},
+			wantStatus: http.StatusOK,
+			wantBody:   "data",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "Origin",
+			},
+		},
+		{
+			name:       "public",
+			policy:     public,
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://any.example.com"},
+			wantStatus: http.StatusOK,
+			wantBody:   "data",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Vary":                             "",
+			},
+		},
+		{
+			name:   "preflight",
+			policy: credentials,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     "GET, POST",
+				"Access-Control-Allow-Headers":     "content-type, authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "3600",
+			},
+		},
+		{
+			name:   "preflightMethod",
+			policy: credentials,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantStatus:  http.StatusForbidden,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflightHeader",
+			policy: credentials,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "preflightOrigin",
+			policy: credentials,
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "optionsNotPreflight",
+			policy:     credentials,
+			method:     http.MethodOptions,
+			wantStatus: http.StatusOK,
+			wantBody:   "data",
+		},
+		{
+			name:       "nilPolicy",
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantBody:   "data",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/api", nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			webhandler.CORS(next, tc.policy).ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tc.wantBody)
+			}
+			for k, want := range tc.wantHeaders {
+				if got := w.Header().Get(k); got != want {
+					t.Errorf("header %s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMuxRouteCORS(t *testing.T) {
+	policy := &webhandler.CORSPolicy{Origins: []string{"https://app.example.com"}}
+
+	mux := webhandler.NewMux()
+	mux.Handle("GET /api/items", textHandler("items"), webhandler.RouteCORS(policy))
+	mux.Handle("POST /api/items", textHandler("added"), webhandler.RouteCORS(policy))
+	mux.Handle("GET /private", textHandler("private"), webhandler.RouteCORS(nil))
+
+	if routes := mux.Routes(); !routes[0].CORS || routes[2].CORS {
+		t.Errorf("Routes() = %+v, want CORS only for /api/items", routes)
+	}
+
+	// The preflight request for the path is answered by the Mux.
+	r := httptest.NewRequest(http.MethodOptions, "/api/items", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("preflight = %d %v, want %d with allowed origin", w.Code, w.Header(), http.StatusNoContent)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/items", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Body.String() != "added" || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("POST = %q %v, want added with allowed origin", w.Body, w.Header())
+	}
+
+	r = httptest.NewRequest(http.MethodOptions, "/private", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("preflight without CORS = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Content types of Content Security Policy violation reports.
+const (
+	CSPReportContentType = "application/csp-report"   // Sent for report-uri.
+	ReportsContentType   = "application/reports+json" // Sent for report-to.
+)
+
+// MaxCSPReportLen is the maximum size of a violation report body.
+const MaxCSPReportLen = 64 << 10
+
+// CSPViolation is a Content Security Policy violation reported by a
+// browser.
+type CSPViolation struct {
+	DocumentURI string // DocumentURI is the page that violated the policy.
+	Directive   string // Directive is the effective directive violated.
+	BlockedURI  string // BlockedURI is the resource that was blocked.
+	Disposition string // Disposition is "enforce" or "report".
+}
+
+// cspReport is the body sent for the report-uri directive.
+type cspReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// report is a report of the Reporting API sent for the report-to
+// directive.
+type report struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+var ErrCSPReport = errors.New("invalid CSP report")
+
+// ParseCSPReport returns the violations in the body of r, which can be
+// sent for either the report-uri or report-to directive. Reports of other
+// types sent to the same endpoint are ignored.
+func ParseCSPReport(r *http.Request) ([]CSPViolation, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, ErrCSPReport
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxCSPReportLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxCSPReportLen {
+		return nil, ErrCSPReport
+	}
+
+	switch mediaType {
+	case CSPReportContentType, "application/json":
+		var rep cspReport
+		if err := json.Unmarshal(body, &rep); err != nil {
+			return nil, ErrCSPReport
+		}
+
+		directive := rep.Report.EffectiveDirective
+		if directive == "" {
+			directive = rep.Report.ViolatedDirective
+		}
+		if directive == "" {
+			return nil, ErrCSPReport
+		}
+
+		return []CSPViolation{{
+			DocumentURI: rep.Report.DocumentURI,
+			Directive:   directive,
+			BlockedURI:  rep.Report.BlockedURI,
+			Disposition: rep.Report.Disposition,
+		}}, nil
+
+	case ReportsContentType:
+		var reports []report
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, ErrCSPReport
+		}
+
+		var violations []CSPViolation
+		for _, rep := range reports {
+			if rep.Type != "csp-violation" || rep.Body.EffectiveDirective == "" {
+				continue
+			}
+			violations = append(violations, CSPViolation{
+				DocumentURI: rep.Body.DocumentURL,
+				Directive:   rep.Body.EffectiveDirective,
+				BlockedURI:  rep.Body.BlockedURL,
+				Disposition: rep.Body.Disposition,
+			})
+		}
+
+		return violations, nil
+	}
+
+	return nil, ErrCSPReport
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestParseCSPReport(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []webhandler.CSPViolation
+		wantErr     error
+	}{
+		{
+			name:        "reportURI",
+			contentType: "application/csp-report",
+			body:        `{"csp-report":{"document-uri":"https://example.com/","violated-directive":"script-src-elem","blocked-uri":"https://evil.example/x.js","disposition":"enforce"}}`,
+			want:        []webhandler.CSPViolation{{DocumentURI: "https://example.com/", Directive: "script-src-elem", BlockedURI: "https://evil.example/x.js", Disposition: "enforce"}},
+		},
+		{
+			name:        "reportURIEffective",
+			contentType: "application/csp-report; charset=utf-8",
+			body:        `{"csp-report":{"violated-directive":"style-src 'self'","effective-directive":"style-src","blocked-uri":"inline"}}`,
+			want:        []webhandler.CSPViolation{{Directive: "style-src", BlockedURI: "inline"}},
+		},
+		{
+			name:        "reportTo",
+			contentType: "application/reports+json",
+			body:        `[{"type":"csp-violation","body":{"documentURL":"https://example.com/","effectiveDirective":"img-src","blockedURL":"https://img.example/","disposition":"report"}},{"type":"deprecation","body":{}}]`,
+			want:        []webhandler.CSPViolation{{DocumentURI: "https://example.com/", Directive: "img-src", BlockedURI: "https://img.example/", Disposition: "report"}},
+		},
+		{
+			name:        "noDirective",
+			contentType: "application/csp-report",
+			body:        `{"csp-report":{}}`,
+			wantErr:     webhandler.ErrCSPReport,
+		},
+		{
+			name:        "invalidJSON",
+			contentType: "application/reports+json",
+			body:        `{`,
+			wantErr:     webhandler.ErrCSPReport,
+		},
+		{
+			name:        "contentType",
+			contentType: "text/plain",
+			body:        `{}`,
+			wantErr:     webhandler.ErrCSPReport,
+		},
+		{
+			name:        "tooLarge",
+			contentType: "application/csp-report",
+			body:        strings.Repeat(" ", webhandler.MaxCSPReportLen+1),
+			wantErr:     webhandler.ErrCSPReport,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+
+			got, err := webhandler.ParseCSPReport(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ParseCSPReport() error = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseCSPReport() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAddSecurityHeadersWithReport(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name          string
+		handler       http.Handler
+		wantCSP       string
+		wantEndpoints string
+	}{
+		{
+			name:    "noReport",
+			handler: webhandler.AddSecurityHeaders(next),
+			wantCSP: "default-src 'self'; style-src 'self' 'unsafe-inline'",
+		},
+		{
+			name:          "report",
+			handler:       webhandler.AddSecurityHeadersWithReport(next, "/csp-report"),
+			wantCSP:       "default-src 'self'; style-src 'self' 'unsafe-inline'; report-uri /csp-report; report-to csp-endpoint",
+			wantEndpoints: `csp-endpoint="/csp-report"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := w.Header().Get("Content-Security-Policy"); got != tc.wantCSP {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, tc.wantCSP)
+			}
+			if got := w.Header().Get("Reporting-Endpoints"); got != tc.wantEndpoints {
+				t.Errorf("Reporting-Endpoints = %q, want %q", got, tc.wantEndpoints)
+			}
+			if got := w.Header().Get("X-Frame-Options"); got != "DENY" {
+				t.Errorf("X-Frame-Options = %q, want %q", got, "DENY")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+const (
+	CSRFCookieName = "csrf"         // CSRFCookieName is the cookie with the token.
+	CSRFHeaderName = "X-CSRF-Token" // CSRFHeaderName can send the token instead of a form field.
+)
+
+// csrfTokenSize is the number of random bytes in a CSRF token.
+const csrfTokenSize = 32
+
+// csrfKeyType is a custom type to avoid collisions in context values.
+type csrfKeyType struct{}
+
+// csrfKey is used to store/retrieve the CSRF token from a context.
+var csrfKey = csrfKeyType{}
+
+// CSRF returns middleware that protects next from cross-site request
+// forgery. Each client is issued a random token in a cookie that lasts for
+// the browser session. Requests with a method other than GET, HEAD,
+// OPTIONS, or TRACE must include the same token in the webutil.CSRFFieldName
+// form field or the CSRFHeaderName header, otherwise the request is
+// rejected with http.StatusForbidden.
+//
+// The token is available to next from CSRFToken, so that it can be added to
+// forms with webutil.CSRFField. Requests with a path that starts with one of
+// exempt, such as webhooks authenticated by other means, are not checked.
+func CSRF(next http.Handler, exempt ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(CSRFCookieName); err == nil && validCSRFToken(c.Value) {
+			token = c.Value
+		}
+
+		if token == "" {
+			var err error
+			token, err = newCSRFToken()
+			if err != nil {
+				RequestLogger(r).Error("failed to create CSRF token", "err", err)
+				webutil.Error(w, r, http.StatusInternalServerError, "", "")
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     CSRFCookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		if !csrfSafeMethod(r.Method) && !hasPrefix(r.URL.Path, exempt) {
+			got := r.Header.Get(CSRFHeaderName)
+			if got == "" {
+				got = r.PostFormValue(webutil.CSRFFieldName)
+			}
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				RequestLogger(r).Warn("invalid CSRF token", "path", r.URL.Path)
+				webutil.Error(w, r, http.StatusForbidden, "", "")
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRFToken returns the CSRF token from ctx, which is set by the CSRF
+// middleware. If there is no token, an empty string is returned.
+func CSRFToken(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if token, ok := ctx.Value(csrfKey).(string); ok {
+		return token
+	}
+
+	return ""
+}
+
+// newCSRFToken returns a new random CSRF token.
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validCSRFToken returns true if token has the form of a CSRF token.
+func validCSRFToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && len(b) == csrfTokenSize
+}
+
+// csrfSafeMethod returns true if method does not change state, so it is not
+// checked for a CSRF token.
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// hasPrefix returns true if path starts with any of prefixes.
+func hasPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
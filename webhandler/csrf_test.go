@@ -0,0 +1,105 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// csrfHandler returns a handler protected by CSRF that writes the token.
+func csrfHandler() http.Handler {
+	return webhandler.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(webhandler.CSRFToken(r.Context())))
+	}), "/webhook/")
+}
+
+// csrfCookie gets a CSRF cookie from h.
+func csrfCookie(t *testing.T, h http.Handler) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == webhandler.CSRFCookieName {
+			if c.Value != rec.Body.String() {
+				t.Fatalf("cookie %q does not match token %q", c.Value, rec.Body.String())
+			}
+			if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+				t.Errorf("cookie attributes = %+v, want HttpOnly, Secure, and SameSite=Lax", c)
+			}
+			return c
+		}
+	}
+
+	t.Fatal("no CSRF cookie set")
+	return nil
+}
+
+func TestCSRF(t *testing.T) {
+	h := csrfHandler()
+	cookie := csrfCookie(t, h)
+	other := csrfCookie(t, h)
+
+	if cookie.Value == other.Value {
+		t.Fatalf("tokens are not unique")
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		cookie     *http.Cookie
+		form       string
+		header     string
+		wantStatus int
+	}{
+		{"get", http.MethodGet, "/", cookie, "", "", http.StatusOK},
+		{"postForm", http.MethodPost, "/", cookie, cookie.Value, "", http.StatusOK},
+		{"postHeader", http.MethodPost, "/", cookie, "", cookie.Value, http.StatusOK},
+		{"postMissing", http.MethodPost, "/", cookie, "", "", http.StatusForbidden},
+		{"postWrong", http.MethodPost, "/", cookie, other.Value, "", http.StatusForbidden},
+		{"postNoCookie", http.MethodPost, "/", nil, cookie.Value, "", http.StatusForbidden},
+		{"deleteMissing", http.MethodDelete, "/", cookie, "", "", http.StatusForbidden},
+		{"exempt", http.MethodPost, "/webhook/bounce", nil, "", "", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := url.Values{webutil.CSRFFieldName: {tc.form}}.Encode()
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+			if tc.header != "" {
+				r.Header.Set(webhandler.CSRFHeaderName, tc.header)
+			}
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK && tc.cookie != nil && rec.Body.String() != tc.cookie.Value {
+				t.Errorf("CSRFToken() = %q, want %q", rec.Body.String(), tc.cookie.Value)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenWithoutMiddleware(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := webhandler.CSRFToken(r.Context()); got != "" {
+		t.Errorf("CSRFToken() = %q, want empty", got)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// TimeoutFunc returns the time allowed to handle r. If it is zero or less,
+// the request has no deadline.
+type TimeoutFunc func(r *http.Request) time.Duration
+
+// Deadline returns middleware that sets a deadline on the request context
+// using timeoutFor, so that database, SMTP, and HTTP calls made with the
+// context are canceled when it expires.
+//
+// If next has not written a response when the deadline expires, Deadline
+// responds with http.StatusGatewayTimeout and any later writes by next
+// fail with http.ErrHandlerTimeout. Unlike http.TimeoutHandler, responses
+// are not buffered.
+func Deadline(next http.Handler, timeoutFor TimeoutFunc) http.Handler {
+	return deadline(next, timeoutFor, http.StatusGatewayTimeout)
+}
+
+// Timeout returns middleware that gives each request d to be handled, like
+// Deadline, but responds with http.StatusServiceUnavailable if it expires,
+// as http.TimeoutHandler does. If d is zero or less, requests have no
+// deadline.
+//
+// Long-lived routes of a Mux, such as event streams, can be exempted with
+// RouteTimeout(NoTimeout) by using Mux.Timeout instead.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return deadline(next, func(*http.Request) time.Duration { return d }, http.StatusServiceUnavailable)
+	}
+}
+
+// deadline is Deadline that responds with status if the deadline expires.
+func deadline(next http.Handler, timeoutFor TimeoutFunc, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := timeoutFor(r)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		dw := &deadlineWriter{w: w, h: w.Header().Clone()}
+		done := make(chan struct{})
+		panicChan := make(chan any, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					// Keep the stack of next, which is lost once the
+					// panic is raised again in the other goroutine.
+					if err, ok := p.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+						p = &handlerPanic{value: p, stack: debug.Stack()}
+					}
+					panicChan <- p
+				}
+			}()
+			next.ServeHTTP(dw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			// Re-panic in this goroutine so it can be recovered, by
+			// Recover with the stack of next.
+			panic(p)
+		case <-done:
+		case <-ctx.Done():
+			dw.mu.Lock()
+			defer dw.mu.Unlock()
+
+			dw.timedOut = true
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && !dw.wroteHeader {
+				RequestLogger(r).Error("request deadline exceeded",
+					"timeout", timeout.String())
+				webutil.Error(w, r, status, "", "")
+			}
+		}
+	})
+}
+
+// handlerPanic is a panic of a handler run in another goroutine by
+// Deadline, with the stack of the handler. Recover reports its value and
+// stack.
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+// String returns the panic value, for a panic that is not recovered.
+func (p *handlerPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// deadlineWriter is an http.ResponseWriter that stops writing to w once
+// the deadline expires. The handler has its own header map, so it does not
+// race with the timeout response.
+type deadlineWriter struct {
+	w           http.ResponseWriter
+	h           http.Header
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Header returns the header map that is sent by WriteHeader.
+func (dw *deadlineWriter) Header() http.Header {
+	return dw.h
+}
+
+// WriteHeader writes the header and status code unless the deadline
+// expired.
+func (dw *deadlineWriter) WriteHeader(statusCode int) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	dw.writeHeader(statusCode)
+}
+
+// writeHeader is WriteHeader with dw.mu held.
+func (dw *deadlineWriter) writeHeader(statusCode int) {
+	if dw.timedOut || dw.wroteHeader {
+		return
+	}
+	dw.wroteHeader = true
+
+	dst := dw.w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range dw.h {
+		dst[k] = v
+	}
+	dw.w.WriteHeader(statusCode)
+}
+
+// Write writes b unless the deadline expired.
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	if dw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	dw.writeHeader(http.StatusOK)
+
+	return dw.w.Write(b)
+}
+
+// Flush sends the buffered data to the client unless the deadline
+// expired, so streaming still works behind Deadline.
+func (dw *deadlineWriter) Flush() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	if dw.timedOut {
+		return
+	}
+	dw.writeHeader(http.StatusOK)
+
+	http.NewResponseController(dw.w).Flush()
+}
+
+// Unwrap returns the http.ResponseWriter of dw, for http.ResponseController.
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter {
+	return dw.w
+}
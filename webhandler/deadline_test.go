@@ -0,0 +1,180 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestDeadline(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:    "fast",
+			timeout: time.Second,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Context().Deadline(); !ok {
+					t.Error("request context has no deadline")
+				}
+				w.Header().Set("X-Test", "yes")
+				w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:    "noTimeout",
+			timeout: 0,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Context().Deadline(); ok {
+					t.Error("request context has deadline")
+				}
+				w.Write([]byte("ok"))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:    "respectsContext",
+			timeout: 10 * time.Millisecond,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				w.Write([]byte("late"))
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "Error: Gateway Timeout\n",
+		},
+		{
+			name:    "ignoresContext",
+			timeout: 10 * time.Millisecond,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-release
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   "Error: Gateway Timeout\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := webhandler.Deadline(tc.handler, func(*http.Request) time.Duration {
+				return tc.timeout
+			})
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if rec.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tc.wantBody)
+			}
+			if tc.name == "fast" && rec.Header().Get("X-Test") != "yes" {
+				t.Errorf("header X-Test not written")
+			}
+		})
+	}
+}
+
+// panicAtFirst and panicAtSecond panic with v from different functions,
+// so their stacks differ.
+func panicAtFirst(v any)  { panic(v) }
+func panicAtSecond(v any) { panic(v) }
+
+func TestDeadlinePanic(t *testing.T) {
+	var (
+		values []any
+		stacks []string
+	)
+	onPanic := func(r *http.Request, v any, stack []byte) {
+		values = append(values, v)
+		stacks = append(stacks, string(stack))
+	}
+
+	h := webhandler.Recover(webhandler.Deadline(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/first" {
+				panicAtFirst("first")
+			}
+			panicAtSecond("second")
+		}),
+		func(*http.Request) time.Duration { return time.Second },
+	), onPanic)
+
+	for _, target := range []string{"/first", "/second"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status of %s = %d, want %d", target, rec.Code, http.StatusInternalServerError)
+		}
+	}
+
+	// The value and stack are those of the handler, not of the re-panic.
+	if len(values) != 2 || values[0] != "first" || values[1] != "second" {
+		t.Fatalf("panic values = %v, want [first second]", values)
+	}
+	if !strings.Contains(stacks[0], "panicAtFirst") || !strings.Contains(stacks[1], "panicAtSecond") {
+		t.Errorf("stacks do not have the handler functions:\n%s\n%s", stacks[0], stacks[1])
+	}
+}
+
+func TestDeadlineFlush(t *testing.T) {
+	h := webhandler.Deadline(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("event"))
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Errorf("Flush() = %v", err)
+			}
+		}),
+		func(*http.Request) time.Duration { return time.Second },
+	)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !rec.Flushed {
+		t.Error("response not flushed")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	rec := httptest.NewRecorder()
+	webhandler.Timeout(10*time.Millisecond)(slow).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("request context has deadline")
+		}
+	})
+	rec = httptest.NewRecorder()
+	webhandler.Timeout(0)(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
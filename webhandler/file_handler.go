@@ -4,31 +4,47 @@
 package webhandler
 
 import (
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
+
+	"github.com/bnixon67/webapp/webutil"
 )
 
 // FileHandler returns a HTTP handler that serves a specified file from the
-// provided name. This handler uses http.ServeFile to serve the file directly.
+// provided name. The file is served like a file of webutil.StaticHandler,
+// with support for Range, HEAD, and conditional requests.
 //
 // If the file specified by name does not exist or is not accessible, the
 // handler logs the error and returns an HTTP 404 (Not Found) response for
 // all incoming requests.
 func FileHandler(name string) http.HandlerFunc {
-	// Check if the file exists and is accessible.
-	if _, err := os.Stat(name); err != nil {
+	return FSFileHandler(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+}
+
+// FSFileHandler returns a handler that serves the file name of fsys, such
+// as "css/pico.min.css" of an embed.FS, like FileHandler serves a file on
+// disk.
+func FSFileHandler(fsys fs.FS, name string) http.HandlerFunc {
+	if _, err := fs.Stat(fsys, name); err != nil {
 		slog.Error("file check failed",
 			slog.String("filePath", name),
 			slog.String("error", err.Error()))
 
-		// Return a handler that issues an HTTP 404 response.
 		return func(w http.ResponseWriter, r *http.Request) {
 			http.NotFound(w, r)
 		}
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, name)
-	}
+	return webutil.NewStaticHandler(fsys, "").File(name)
+}
+
+// FSHandler returns a handler that serves the files of fsys, such as an
+// embed.FS of bundled assets, by the path of the request, as a
+// webutil.StaticHandler does. Use http.StripPrefix to serve fsys under a
+// prefix. Directories are not listed.
+func FSHandler(fsys fs.FS) http.Handler {
+	return webutil.NewStaticHandler(fsys, "")
 }
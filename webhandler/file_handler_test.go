@@ -0,0 +1,194 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestFSHandler(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	modTime := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	h := webhandler.FSHandler(fstest.MapFS{
+		"fonts/app.woff2": {Data: []byte(content), ModTime: modTime},
+	})
+
+	// Get the ETag.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fonts/app.woff2", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != content || etag == "" {
+		t.Fatalf("GET = %d %q with ETag %q, want %d %q with ETag", w.Code, w.Body, etag, http.StatusOK, content)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want %q", got, "bytes")
+	}
+
+	lastModified := modTime.Format(http.TimeFormat)
+
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		header       map[string]string
+		wantStatus   int
+		wantBody     string
+		wantHeader   string // wantHeader is "name: value".
+		wantNoHeader string
+	}{
+		{name: "head", method: http.MethodHead, wantStatus: http.StatusOK, wantHeader: "Content-Length: 20"},
+		{
+			name:       "range",
+			header:     map[string]string{"Range": "bytes=5-9"},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "56789",
+			wantHeader: "Content-Range: bytes 5-9/20",
+		},
+		{
+			name:       "suffixRange",
+			header:     map[string]string{"Range": "bytes=-3"},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "hij",
+		},
+		{
+			name:       "unsatisfiable",
+			header:     map[string]string{"Range": "bytes=30-40"},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+			wantHeader: "Content-Range: bytes */20",
+		},
+		{
+			name:       "ifRangeMatch",
+			header:     map[string]string{"Range": "bytes=0-1", "If-Range": etag},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "01",
+		},
+		{
+			name:       "ifRangeChanged",
+			header:     map[string]string{"Range": "bytes=0-1", "If-Range": `"old"`},
+			wantStatus: http.StatusOK,
+			wantBody:   content,
+		},
+		{
+			name:       "ifNoneMatch",
+			header:     map[string]string{"If-None-Match": etag},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "ifModifiedSince",
+			header:     map[string]string{"If-Modified-Since": lastModified},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "ifMatchFailed",
+			header:     map[string]string{"If-Match": `"old"`},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "ifUnmodifiedSinceFailed",
+			header:     map[string]string{"If-Unmodified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat)},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{name: "post", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantHeader: "Allow: GET, HEAD, OPTIONS"},
+		{name: "dir", target: "/fonts", wantStatus: http.StatusNotFound},
+		{name: "missing", target: "/fonts/other.woff2", wantStatus: http.StatusNotFound},
+		{name: "escape", target: "/../fonts/app.woff2", wantStatus: http.StatusOK, wantBody: content},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method, target := tc.method, tc.target
+			if method == "" {
+				method = http.MethodGet
+			}
+			if target == "" {
+				target = "/fonts/app.woff2"
+			}
+
+			r := httptest.NewRequest(method, target, nil)
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tc.wantBody)
+			}
+			if method == http.MethodHead && w.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q, want empty", w.Body)
+			}
+			if tc.wantHeader != "" {
+				name, value, _ := strings.Cut(tc.wantHeader, ": ")
+				if got := w.Header().Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestFileHandler(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "video.txt")
+	if err := os.WriteFile(name, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := webhandler.FileHandler(name)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/video.txt", nil))
+		return w
+	}
+
+	first := get().Header().Get("ETag")
+
+	// The ETag changes with the file.
+	if err := os.WriteFile(name, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := get()
+	if w.Body.String() != "second" || w.Header().Get("ETag") == first {
+		t.Errorf("after change = %q with ETag %q, want new content and ETag", w.Body, w.Header().Get("ETag"))
+	}
+
+	missing := webhandler.FileHandler(filepath.Join(t.TempDir(), "missing"))
+	w = httptest.NewRecorder()
+	missing(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing file status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestFSFileHandler(t *testing.T) {
+	h := webhandler.FSFileHandler(fstest.MapFS{"css/app.css": {Data: []byte("body{}")}}, "css/app.css")
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "/app.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" || w.Header().Get("ETag") == "" {
+		t.Errorf("GET = %d %q with ETag %q, want %d %q with ETag", w.Code, w.Body, w.Header().Get("ETag"), http.StatusOK, "body{}")
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/css", got)
+	}
+
+	missing := webhandler.FSFileHandler(fstest.MapFS{}, "css/app.css")
+	w = httptest.NewRecorder()
+	missing(w, httptest.NewRequest(http.MethodGet, "/app.css", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing file status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostRouter dispatches requests to a handler based on the host of the
+// request, so that one server can serve several apps, such as
+// auth.example.com and events.example.com.
+//
+// Hosts are matched without the port and case. A host of the form
+// *.example.com matches any subdomain of example.com, but not example.com
+// itself. Exact hosts are matched before wildcards, and longer wildcards
+// before shorter ones.
+type HostRouter struct {
+	hosts     map[string]http.Handler
+	wildcards map[string]http.Handler // Keyed by suffix, like .example.com.
+	fallback  http.Handler
+}
+
+// NewHostRouter returns a HostRouter that serves requests for unknown hosts
+// with fallback. If fallback is nil, they receive http.StatusNotFound.
+func NewHostRouter(fallback http.Handler) *HostRouter {
+	return &HostRouter{
+		hosts:     make(map[string]http.Handler),
+		wildcards: make(map[string]http.Handler),
+		fallback:  fallback,
+	}
+}
+
+// Handle registers h for host. The middleware is applied to h in order,
+// so the last middleware is the first to see the request, giving each host
+// its own middleware stack. Handle replaces any handler for the same host.
+func (hr *HostRouter) Handle(host string, h http.Handler, middleware ...func(http.Handler) http.Handler) {
+	for _, m := range middleware {
+		h = m(h)
+	}
+
+	host = normalizeHost(host)
+	if suffix, ok := strings.CutPrefix(host, "*"); ok {
+		hr.wildcards[suffix] = h
+		return
+	}
+	hr.hosts[host] = h
+}
+
+// Handler returns the handler for host, or nil if there is none and no
+// fallback.
+func (hr *HostRouter) Handler(host string) http.Handler {
+	host = normalizeHost(host)
+
+	if h, ok := hr.hosts[host]; ok {
+		return h
+	}
+
+	// Try each parent domain, from the longest to the shortest.
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		if h, ok := hr.wildcards[host[i:]]; ok {
+			return h
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	return hr.fallback
+}
+
+// ServeHTTP dispatches r to the handler for r.Host.
+func (hr *HostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := hr.Handler(r.Host)
+	if h == nil {
+		logger := RequestLoggerWithFuncName(r)
+		logger.Warn("unknown host", "host", r.Host)
+		http.NotFound(w, r)
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+// normalizeHost returns host in lower case without the port or a
+// trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
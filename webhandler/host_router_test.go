@@ -0,0 +1,90 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// textHandler returns a handler that responds with s.
+func textHandler(s string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, s)
+	})
+}
+
+// addHeader returns middleware that adds header to the response.
+func addHeader(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Middleware", header)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestHostRouter(t *testing.T) {
+	hr := webhandler.NewHostRouter(textHandler("default"))
+	hr.Handle("auth.example.com", textHandler("auth"), addHeader("inner"), addHeader("outer"))
+	hr.Handle("*.example.com", textHandler("wildcard"))
+	hr.Handle("*.events.example.com", textHandler("events"))
+
+	tests := []struct {
+		host       string
+		want       string
+		wantHeader []string
+	}{
+		{"auth.example.com", "auth", []string{"outer", "inner"}},
+		{"AUTH.example.com:8443", "auth", []string{"outer", "inner"}},
+		{"auth.example.com.", "auth", []string{"outer", "inner"}},
+		{"other.example.com", "wildcard", nil},
+		{"a.b.example.com", "wildcard", nil},
+		{"live.events.example.com", "events", nil},
+		{"example.com", "default", nil},
+		{"example.org", "default", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tc.host
+			w := httptest.NewRecorder()
+
+			hr.ServeHTTP(w, r)
+
+			if got := w.Body.String(); got != tc.want {
+				t.Errorf("body = %q, want %q", got, tc.want)
+			}
+			got := w.Header().Values("X-Middleware")
+			if len(got) != len(tc.wantHeader) {
+				t.Fatalf("middleware = %q, want %q", got, tc.wantHeader)
+			}
+			for i := range got {
+				if got[i] != tc.wantHeader[i] {
+					t.Errorf("middleware = %q, want %q", got, tc.wantHeader)
+				}
+			}
+		})
+	}
+}
+
+func TestHostRouterNoFallback(t *testing.T) {
+	hr := webhandler.NewHostRouter(nil)
+	hr.Handle("auth.example.com", textHandler("auth"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "other.example.com"
+	w := httptest.NewRecorder()
+
+	hr.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -56,3 +56,16 @@ func (lw *loggingResponseWriter) WriteHeader(statusCode int) {
 	lw.statusCode = statusCode
 	lw.ResponseWriter.WriteHeader(statusCode)
 }
+
+// Flush sends any buffered data to the client, so streaming responses,
+// such as server-sent events, work through LogRequest.
+func (lw *loggingResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController.
+func (lw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
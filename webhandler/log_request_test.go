@@ -54,3 +54,22 @@ func TestLogRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestLogRequestFlush(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/events", http.NoBody)
+	rec := httptest.NewRecorder()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("ResponseWriter is not an http.Flusher")
+		}
+		f.Flush()
+	})
+
+	webhandler.LogRequest(next).ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Error("response was not flushed")
+	}
+}
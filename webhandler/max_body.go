@@ -0,0 +1,37 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// MaxBodySize returns middleware that limits the size of request bodies
+// to n bytes. Requests that declare a larger Content-Length are refused
+// with http.StatusRequestEntityTooLarge without calling next. Otherwise,
+// reads by next beyond n bytes fail with an *http.MaxBytesError and the
+// connection is closed after the response. If n is zero or less, bodies
+// are not limited.
+func MaxBodySize(next http.Handler, n int64) http.Handler {
+	if n <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			RequestLogger(r).Warn("request body too large",
+				"contentLength", r.ContentLength, "limit", n)
+			webutil.Error(w, r, http.StatusRequestEntityTooLarge, "", "")
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
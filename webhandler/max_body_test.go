@@ -0,0 +1,59 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	// echo writes the body, or 413 if it is too large.
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.Write(b)
+	})
+
+	tests := []struct {
+		name          string
+		limit         int64
+		body          string
+		contentLength int64
+		wantStatus    int
+		wantBody      string
+	}{
+		{"underLimit", 5, "hello", 5, http.StatusOK, "hello"},
+		{"overContentLength", 4, "hello", 5, http.StatusRequestEntityTooLarge, "Error: Request Entity Too Large\n"},
+		{"overChunked", 4, "hello", -1, http.StatusRequestEntityTooLarge, ""},
+		{"unlimited", 0, "hello", 5, http.StatusOK, "hello"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			r.ContentLength = tc.contentLength
+			w := httptest.NewRecorder()
+
+			webhandler.MaxBodySize(echo, tc.limit).ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if got := w.Body.String(); got != tc.wantBody {
+				t.Errorf("body = %q, want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
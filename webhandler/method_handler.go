@@ -0,0 +1,86 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodHandler is an http.Handler that dispatches a request to the
+// handler of its method, so that handlers do not check the method and
+// then switch on it. A HEAD request is served by Get if Head is nil.
+//
+// A request with a method that has no handler gets the allowed methods in
+// the Allow header. An OPTIONS request gets http.StatusNoContent, and any
+// other is logged and gets http.StatusMethodNotAllowed.
+type MethodHandler struct {
+	Get    http.HandlerFunc
+	Head   http.HandlerFunc
+	Post   http.HandlerFunc
+	Put    http.HandlerFunc
+	Patch  http.HandlerFunc
+	Delete http.HandlerFunc
+}
+
+// dispatchMethods are the methods a MethodHandler dispatches, in the order
+// of the Allow header.
+var dispatchMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// handler returns the handler of method, or nil if there is none.
+func (h MethodHandler) handler(method string) http.HandlerFunc {
+	switch method {
+	case http.MethodGet:
+		return h.Get
+	case http.MethodHead:
+		if h.Head != nil {
+			return h.Head
+		}
+		return h.Get
+	case http.MethodPost:
+		return h.Post
+	case http.MethodPut:
+		return h.Put
+	case http.MethodPatch:
+		return h.Patch
+	case http.MethodDelete:
+		return h.Delete
+	}
+
+	return nil
+}
+
+// Allowed returns the methods that have a handler, and OPTIONS.
+func (h MethodHandler) Allowed() []string {
+	var allowed []string
+	for _, method := range dispatchMethods {
+		if h.handler(method) != nil {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return append(allowed, http.MethodOptions)
+}
+
+// ServeHTTP calls the handler of the method of r.
+func (h MethodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if next := h.handler(r.Method); next != nil {
+		next(w, r)
+		return
+	}
+
+	w.Header().Set("Allow", strings.Join(h.Allowed(), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	RequestLogger(r).Error("invalid method", "method", r.Method)
+
+	txt := r.Method + " " + http.StatusText(http.StatusMethodNotAllowed)
+	http.Error(w, txt, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMethodHandler(t *testing.T) {
+	// respond returns a handler that writes body.
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}
+	}
+
+	h := webhandler.MethodHandler{Get: respond("get"), Post: respond("post")}
+	withHead := webhandler.MethodHandler{Get: respond("get"), Head: respond("head"), Delete: respond("delete")}
+
+	tests := []struct {
+		name      string
+		handler   http.Handler
+		method    string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{"get", h, http.MethodGet, http.StatusOK, "get", ""},
+		{"post", h, http.MethodPost, http.StatusOK, "post", ""},
+		{"head uses get", h, http.MethodHead, http.StatusOK, "get", ""},
+		{"head", withHead, http.MethodHead, http.StatusOK, "head", ""},
+		{"delete", withHead, http.MethodDelete, http.StatusOK, "delete", ""},
+		{"not allowed", h, http.MethodPatch, http.StatusMethodNotAllowed, "PATCH Method Not Allowed\n", "GET, HEAD, POST, OPTIONS"},
+		{"not allowed other", withHead, http.MethodPost, http.StatusMethodNotAllowed, "POST Method Not Allowed\n", "GET, HEAD, DELETE, OPTIONS"},
+		{"options", h, http.MethodOptions, http.StatusNoContent, "", "GET, HEAD, POST, OPTIONS"},
+		{"empty", webhandler.MethodHandler{}, http.MethodGet, http.StatusMethodNotAllowed, "GET Method Not Allowed\n", "OPTIONS"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.handler.ServeHTTP(w, httptest.NewRequest(tc.method, "/", nil))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tc.wantBody)
+			}
+			if got := w.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tc.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Defaults of MirrorPolicy.
+const (
+	DefaultMirrorTimeout     = 10 * time.Second
+	DefaultMirrorMaxInFlight = 16
+)
+
+// MirrorHeader is set to "1" on mirrored requests, so the shadow can tell
+// them from real ones.
+const MirrorHeader = "X-Mirror"
+
+// mirrors counts the requests of Mirror, published with expvar as
+// "mirror": those sent to the shadow, those dropped because too many
+// were in flight, and those that failed.
+var mirrors = expvar.NewMap("mirror")
+
+// MirrorPolicy is how Mirror copies requests to a shadow handler, such as
+// a rewrite of a handler to compare with it under production traffic.
+type MirrorPolicy struct {
+	// Shadow serves the mirrored requests. Its responses are dropped.
+	// Use MirrorURL to mirror to another server.
+	Shadow http.Handler
+
+	// Percent of the read-only requests, those with GET or HEAD, that
+	// are mirrored. Other requests are never mirrored.
+	Percent int
+
+	// Timeout of each mirrored request, or DefaultMirrorTimeout if zero.
+	Timeout time.Duration
+
+	// MaxInFlight is the number of mirrored requests that can run at
+	// once, or DefaultMirrorMaxInFlight if zero. Requests beyond it are
+	// not mirrored, so a slow shadow does not pile up goroutines.
+	MaxInFlight int
+}
+
+// Mirror returns a handler that calls next and, in another goroutine,
+// sends a copy of a sampled Percent of the read-only requests to the
+// Shadow of policy. The response of next is not delayed or changed by the
+// shadow, and panics in the shadow are logged and recovered.
+//
+// The copy has the headers and context values of the request, without
+// its body or cancellation, and with MirrorHeader set. MirrorURL drops
+// its credentials before sending it to another server.
+func Mirror(next http.Handler, policy *MirrorPolicy) http.Handler {
+	timeout := policy.Timeout
+	if timeout == 0 {
+		timeout = DefaultMirrorTimeout
+	}
+	maxInFlight := policy.MaxInFlight
+	if maxInFlight == 0 {
+		maxInFlight = DefaultMirrorMaxInFlight
+	}
+	inFlight := make(chan struct{}, maxInFlight)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && rand.IntN(100) < policy.Percent {
+			select {
+			case inFlight <- struct{}{}:
+				mirrors.Add("sent", 1)
+				go func(r *http.Request) {
+					defer func() { <-inFlight }()
+					mirror(policy.Shadow, r, timeout)
+				}(mirrorRequest(r))
+			default:
+				mirrors.Add("dropped", 1)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mirrorRequest returns a copy of r to mirror.
+func mirrorRequest(r *http.Request) *http.Request {
+	m := r.Clone(context.WithoutCancel(r.Context()))
+	m.Body = http.NoBody
+	m.ContentLength = 0
+	m.Header.Set(MirrorHeader, "1")
+
+	return m
+}
+
+// mirror serves r with shadow within timeout and drops the response.
+func mirror(shadow http.Handler, r *http.Request, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	defer func() {
+		if v := recover(); v != nil {
+			mirrors.Add("failed", 1)
+			RequestLogger(r).Error("mirror panic", "panic", v, "stack", string(debug.Stack()))
+		}
+	}()
+
+	shadow.ServeHTTP(discardResponse{header: make(http.Header)}, r.WithContext(ctx))
+}
+
+// discardResponse is an http.ResponseWriter that drops the response.
+type discardResponse struct {
+	header http.Header
+}
+
+func (d discardResponse) Header() http.Header         { return d.header }
+func (d discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponse) WriteHeader(int)             {}
+
+// MirrorCredentialHeaders are the headers that MirrorURL drops from the
+// requests it sends, so the shadow server is not given the credentials of
+// users and services.
+var MirrorCredentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	SignatureHeader,
+	SignatureKeyHeader,
+	SignatureNonceHeader,
+}
+
+// MirrorURL returns a handler for MirrorPolicy.Shadow that sends requests
+// to the server at base, such as "http://users-v2.internal:8080", with
+// client, or http.DefaultClient if nil. The path and query of a request
+// are added to those of base, and its response is read and dropped.
+//
+// The MirrorCredentialHeaders are dropped, except those in allow, e.g.,
+// "Cookie" for a shadow that shares the sessions of the app.
+func MirrorURL(base *url.URL, client *http.Client, allow ...string) http.Handler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := base.JoinPath(r.URL.Path)
+		target.RawQuery = r.URL.RawQuery
+
+		out, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), nil)
+		if err != nil {
+			mirrors.Add("failed", 1)
+			RequestLogger(r).Warn("failed to create mirror request", "err", err)
+			return
+		}
+		out.Header = r.Header.Clone()
+		out.Header.Del("Connection")
+		for _, name := range MirrorCredentialHeaders {
+			if !slices.ContainsFunc(allow, func(a string) bool { return strings.EqualFold(a, name) }) {
+				out.Header.Del(name)
+			}
+		}
+
+		resp, err := client.Do(out)
+		if err != nil {
+			mirrors.Add("failed", 1)
+			RequestLogger(r).Warn("failed to mirror request", "url", target.Redacted(), "err", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		io.Copy(io.Discard, resp.Body)
+		RequestLogger(r).Debug("mirrored request", "url", target.Redacted(), "status", resp.StatusCode)
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMirror(t *testing.T) {
+	mirrored := make(chan *http.Request, 10)
+	shadow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- r
+		io.WriteString(w, "shadow")
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "primary")
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		percent int
+		want    bool
+	}{
+		{"get", http.MethodGet, 100, true},
+		{"head", http.MethodHead, 100, true},
+		{"post", http.MethodPost, 100, false},
+		{"not sampled", http.MethodGet, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := webhandler.Mirror(next, &webhandler.MirrorPolicy{Shadow: shadow, Percent: tc.percent})
+
+			r := httptest.NewRequest(tc.method, "/users?q=a", nil)
+			r.Header.Set("Accept", "text/html")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tc.method != http.MethodHead && w.Body.String() != "primary" {
+				t.Errorf("body = %q, want %q", w.Body, "primary")
+			}
+
+			select {
+			case m := <-mirrored:
+				if !tc.want {
+					t.Fatalf("request mirrored, want not")
+				}
+				if m.URL.String() != "/users?q=a" || m.Header.Get("Accept") != "text/html" || m.Header.Get(webhandler.MirrorHeader) != "1" {
+					t.Errorf("mirrored %s with headers %v, want copy of request", m.URL, m.Header)
+				}
+				if r.Header.Get(webhandler.MirrorHeader) != "" {
+					t.Error("mirror header set on original request")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tc.want {
+					t.Fatal("request not mirrored")
+				}
+			}
+		})
+	}
+}
+
+func TestMirrorMaxInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	shadow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	h := webhandler.Mirror(http.NotFoundHandler(), &webhandler.MirrorPolicy{Shadow: shadow, Percent: 100, MaxInFlight: 1})
+
+	for range 3 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	close(release)
+
+	<-started
+	select {
+	case <-started:
+		t.Error("mirrored more requests than MaxInFlight")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Method + " " + r.URL.String() + " " + r.Header.Get(webhandler.MirrorHeader)
+		io.WriteString(w, "dropped")
+	}))
+	defer srv.Close()
+
+	base, err := url.Parse(srv.URL + "/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := webhandler.Mirror(http.NotFoundHandler(), &webhandler.MirrorPolicy{
+		Shadow:  webhandler.MirrorURL(base, srv.Client()),
+		Percent: 100,
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events?page=2", nil))
+
+	select {
+	case req := <-got:
+		if want := "GET /v2/events?page=2 1"; req != want {
+			t.Errorf("mirrored request = %q, want %q", req, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request not mirrored")
+	}
+}
+
+func TestMirrorURLCredentials(t *testing.T) {
+	got := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header
+	}))
+	defer srv.Close()
+
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		allow []string
+		want  []string // want are the credential headers sent.
+	}{
+		{"default", nil, nil},
+		{"allowCookie", []string{"cookie"}, []string{"Cookie"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			r.Header.Set("Authorization", "Bearer secret")
+			r.Header.Set("Cookie", "login=secret")
+			r.Header.Set(webhandler.SignatureHeader, "sig")
+			r.Header.Set(webhandler.SignatureKeyHeader, "key")
+			r.Header.Set("Accept", "text/html")
+
+			webhandler.MirrorURL(base, srv.Client(), tc.allow...).ServeHTTP(httptest.NewRecorder(), r)
+
+			h := <-got
+			for _, name := range webhandler.MirrorCredentialHeaders {
+				sent := h.Get(name) != ""
+				if want := slices.Contains(tc.want, name); sent != want {
+					t.Errorf("header %s sent = %v, want %v", name, sent, want)
+				}
+			}
+			if h.Get("Accept") != "text/html" {
+				t.Errorf("Accept = %q, want %q", h.Get("Accept"), "text/html")
+			}
+		})
+	}
+}
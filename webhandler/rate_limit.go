@@ -0,0 +1,69 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Quota is the rate limit of a request after it is counted.
+type Quota struct {
+	Limit     int       // Limit is the number of requests allowed per window.
+	Remaining int       // Remaining is the number of requests left, or negative if exceeded.
+	Reset     time.Time // Reset is when the window ends.
+}
+
+// QuotaFunc counts r against its rate limit and returns the Quota. If r
+// is not rate limited, ok is false.
+type QuotaFunc func(r *http.Request) (q Quota, ok bool, err error)
+
+// Rate limit headers, as used by GitHub and others.
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// RateLimit returns middleware that counts each request with quotaFor and
+// adds the rate limit headers to the response. The reset header is the
+// end of the window in Unix seconds.
+//
+// If the quota is exceeded, RateLimit responds with
+// http.StatusTooManyRequests and a Retry-After header instead of calling
+// next. If quotaFor fails, the error is logged and next is called, so an
+// unavailable store does not block all requests.
+func RateLimit(next http.Handler, quotaFor QuotaFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q, ok, err := quotaFor(r)
+		if err != nil {
+			RequestLogger(r).Error("failed to get quota", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set(HeaderRateLimitLimit, strconv.Itoa(q.Limit))
+		h.Set(HeaderRateLimitRemaining, strconv.Itoa(max(q.Remaining, 0)))
+		h.Set(HeaderRateLimitReset, strconv.FormatInt(q.Reset.Unix(), 10))
+
+		if q.Remaining < 0 {
+			retry := int(time.Until(q.Reset).Seconds()) + 1
+			h.Set("Retry-After", strconv.Itoa(max(retry, 1)))
+			RequestLogger(r).Warn("rate limit exceeded",
+				"limit", q.Limit, "reset", q.Reset)
+			webutil.Error(w, r, http.StatusTooManyRequests, "", "")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Truncate(time.Second)
+	resetHeader := strconv.FormatInt(reset.Unix(), 10)
+
+	tests := []struct {
+		name          string
+		quota         webhandler.Quota
+		ok            bool
+		err           error
+		wantStatus    int
+		wantLimit     string
+		wantRemaining string
+		wantReset     string
+		wantRetry     bool
+	}{
+		{
+			name:       "notLimited",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "error",
+			ok:         true,
+			err:        errors.New("store failed"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "allowed",
+			quota:         webhandler.Quota{Limit: 10, Remaining: 3, Reset: reset},
+			ok:            true,
+			wantStatus:    http.StatusOK,
+			wantLimit:     "10",
+			wantRemaining: "3",
+			wantReset:     resetHeader,
+		},
+		{
+			name:          "last",
+			quota:         webhandler.Quota{Limit: 10, Remaining: 0, Reset: reset},
+			ok:            true,
+			wantStatus:    http.StatusOK,
+			wantLimit:     "10",
+			wantRemaining: "0",
+			wantReset:     resetHeader,
+		},
+		{
+			name:          "exceeded",
+			quota:         webhandler.Quota{Limit: 10, Remaining: -1, Reset: reset},
+			ok:            true,
+			wantStatus:    http.StatusTooManyRequests,
+			wantLimit:     "10",
+			wantRemaining: "0",
+			wantReset:     resetHeader,
+			wantRetry:     true,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			quotaFor := func(r *http.Request) (webhandler.Quota, bool, error) {
+				return tc.quota, tc.ok, tc.err
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/test", nil)
+			webhandler.RateLimit(next, quotaFor).ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+
+			for header, want := range map[string]string{
+				webhandler.HeaderRateLimitLimit:     tc.wantLimit,
+				webhandler.HeaderRateLimitRemaining: tc.wantRemaining,
+				webhandler.HeaderRateLimitReset:     tc.wantReset,
+			} {
+				if got := w.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+
+			if got := w.Header().Get("Retry-After") != ""; got != tc.wantRetry {
+				t.Errorf("Retry-After set = %v, want %v", got, tc.wantRetry)
+			}
+		})
+	}
+}
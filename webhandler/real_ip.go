@@ -0,0 +1,176 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// ParsePrefixes returns the IPs and CIDRs of list as prefixes. A single IP
+// is converted to a prefix that contains only that IP.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+
+	for _, s := range list {
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", s, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// RealIP returns middleware that finds the IP of the client and adds it
+// to the request context, for webutil.ClientIP and ClientAddr.
+//
+// If the connection is from a proxy in trusted, the client is found from
+// the Forwarded, X-Forwarded-For, or X-Real-IP header, in that order.
+// Since each proxy appends the address it received the request from, the
+// client is the last address that is not a trusted proxy. Otherwise, the
+// headers are ignored, since clients could spoof them, and the client is
+// the address of the connection.
+func RealIP(next http.Handler, trusted []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := realIP(r, trusted); ok {
+			r = r.WithContext(webutil.WithClientIP(r.Context(), ip))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientAddr returns the IP of the client of r, as found by RealIP, or
+// the IP of the connection if RealIP was not used.
+func ClientAddr(r *http.Request) (netip.Addr, error) {
+	if ip, ok := webutil.ClientIPFromContext(r.Context()); ok {
+		return ip, nil
+	}
+
+	return parseAddr(r.RemoteAddr)
+}
+
+// realIP returns the IP of the client of r, or false if the address of
+// the connection is not an IP.
+func realIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	peer, err := parseAddr(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	if !contains(trusted, peer) {
+		return peer, true
+	}
+
+	if hops := forwardedFor(r.Header.Values("Forwarded")); len(hops) > 0 {
+		return lastUntrusted(peer, hops, trusted), true
+	}
+
+	if hops := splitList(r.Header.Values("X-Forwarded-For")); len(hops) > 0 {
+		return lastUntrusted(peer, hops, trusted), true
+	}
+
+	if ip, err := parseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return ip, true
+	}
+
+	return peer, true
+}
+
+// lastUntrusted returns the last of hops that is not in trusted, which
+// were forwarded by peer. If a hop is not an IP, such as "unknown", the
+// hop after it is returned, since it cannot be followed further. If all
+// of hops are trusted, the first is returned.
+func lastUntrusted(peer netip.Addr, hops []string, trusted []netip.Prefix) netip.Addr {
+	ip := peer
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		ip = hop
+		if !contains(trusted, ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// forwardedFor returns the for parameters of the Forwarded header values,
+// as defined by RFC 7239. An element without one is returned as empty.
+func forwardedFor(values []string) []string {
+	var hops []string
+
+	for _, element := range splitList(values) {
+		var hop string
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+// splitList returns the elements of the comma separated header values.
+func splitList(values []string) []string {
+	var list []string
+
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				list = append(list, element)
+			}
+		}
+	}
+
+	return list
+}
+
+// parseAddr returns the IP of s, which is an IP or a host:port, with IPv6
+// addresses optionally in brackets.
+func parseAddr(s string) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap(), nil
+}
+
+// contains returns true if ip is in one of prefixes.
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := webhandler.ParsePrefixes([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct", "203.0.113.1:1234", nil, "203.0.113.1"},
+		{"spoofed", "203.0.113.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}, "X-Real-Ip": {"192.0.2.1"}}, "203.0.113.1"},
+		{"proxyNoHeader", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"realIP", "10.0.0.1:1234", http.Header{"X-Real-Ip": {"192.0.2.1"}}, "192.0.2.1"},
+		{"forwardedFor", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}}, "192.0.2.1"},
+		// The client can prepend addresses, so only the last untrusted hop counts.
+		{"forwardedForChain", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, 192.0.2.1, 10.0.0.2"}}, "192.0.2.1"},
+		{"forwardedForLines", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1", "192.0.2.1"}}, "192.0.2.1"},
+		{"allTrusted", "10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"forwarded", "[::1]:1234", http.Header{"Forwarded": {`for=198.51.100.1, for="[2001:db8::1]:4711";proto=https`}}, "2001:db8::1"},
+		{"forwardedPreferred", "10.0.0.1:1234", http.Header{"Forwarded": {"for=192.0.2.1"}, "X-Forwarded-For": {"198.51.100.1"}}, "192.0.2.1"},
+		{"forwardedUnknown", "10.0.0.1:1234", http.Header{"Forwarded": {"for=unknown, for=10.0.0.2"}}, "10.0.0.2"},
+		{"mapped", "[::ffff:10.0.0.1]:1234", http.Header{"X-Forwarded-For": {"192.0.2.1"}}, "192.0.2.1"},
+		{"invalidRemote", "unknown", http.Header{"X-Forwarded-For": {"192.0.2.1"}}, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				r.Header[k] = v
+			}
+
+			var got string
+			h := webhandler.RealIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ip, ok := webutil.ClientIPFromContext(r.Context()); ok {
+					got = ip.String()
+				}
+			}), trusted)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tc.want {
+				t.Errorf("client IP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	if got, err := webhandler.ClientAddr(r); err != nil || got != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("ClientAddr() = %v, %v, want 192.0.2.1", got, err)
+	}
+
+	ip := netip.MustParseAddr("203.0.113.1")
+	r = r.WithContext(webutil.WithClientIP(r.Context(), ip))
+	if got, err := webhandler.ClientAddr(r); err != nil || got != ip {
+		t.Errorf("ClientAddr() = %v, %v, want %v", got, err, ip)
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := webhandler.ParsePrefixes([]string{"10.1.2.3/8", "192.0.2.1", "::ffff:192.0.2.2"})
+	if err != nil {
+		t.Fatalf("ParsePrefixes() failed: %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("192.0.2.2/32"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePrefixes() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParsePrefixes()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	for _, s := range []string{"10.0.0.0/33", "proxy"} {
+		if _, err := webhandler.ParsePrefixes([]string{s}); err == nil {
+			t.Errorf("ParsePrefixes(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// panics counts the panics recovered by Recover, published with expvar
+// as "panics".
+var panics = expvar.NewInt("panics")
+
+// PanicFunc is called with the request, the recovered value, and the stack
+// trace of a panic in a handler.
+type PanicFunc func(r *http.Request, v any, stack []byte)
+
+// PanicResponder writes the response to r after a panic, such as an error
+// page. The status should be http.StatusInternalServerError.
+type PanicResponder func(w http.ResponseWriter, r *http.Request)
+
+// panicError is the JSON form of the response after a panic.
+type panicError struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// RespondToPanic is the default PanicResponder. It responds with
+// http.StatusInternalServerError and the request ID as JSON if the request
+// wants JSON, or as text otherwise.
+func RespondToPanic(w http.ResponseWriter, r *http.Request) {
+	if webutil.WantsJSON(r) {
+		RespondToPanicWithJSON(w, r)
+		return
+	}
+
+	webutil.Error(w, r, http.StatusInternalServerError, "", "")
+}
+
+// RespondToPanicWithJSON is a PanicResponder that responds with
+// http.StatusInternalServerError and the request ID as JSON.
+func RespondToPanicWithJSON(w http.ResponseWriter, r *http.Request) {
+	webutil.RespondWithJSON(w, http.StatusInternalServerError, panicError{
+		Error:     http.StatusText(http.StatusInternalServerError),
+		RequestID: RequestID(r.Context()),
+	})
+}
+
+// Recover returns middleware that recovers from a panic in next, logs it,
+// calls each onPanic, and responds with RespondToPanic.
+//
+// http.ErrAbortHandler is not recovered, since it is used to abort a
+// response on purpose.
+func Recover(next http.Handler, onPanic ...PanicFunc) http.Handler {
+	return RecoverWithResponse(next, RespondToPanic, onPanic...)
+}
+
+// RecoverWithResponse is like Recover, but responds with respond. The
+// panic is logged with the stack trace and request ID, and counted in the
+// "panics" expvar.
+//
+// If next wrote the header before the panic, the response cannot be
+// changed, so respond is not called and the partial response is ended.
+func RecoverWithResponse(next http.Handler, respond PanicResponder, onPanic ...PanicFunc) http.Handler {
+	if respond == nil {
+		respond = RespondToPanic
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			stack := debug.Stack()
+			if p, ok := v.(*handlerPanic); ok {
+				v, stack = p.value, p.stack
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			panics.Add(1)
+
+			RequestLogger(r).Error("recovered panic",
+				"panic", v, "stack", string(stack),
+				"wroteHeader", rw.wroteHeader)
+
+			for _, f := range onPanic {
+				f(r, v, stack)
+			}
+
+			if rw.wroteHeader {
+				return
+			}
+
+			// Drop the headers of the content that was not written.
+			for _, name := range panicDroppedHeaders {
+				w.Header().Del(name)
+			}
+
+			respond(w, r)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// panicDroppedHeaders are the headers of a response that do not apply to
+// the response after a panic.
+var panicDroppedHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+}
+
+// recoverResponseWriter is a wrapper around http.ResponseWriter that
+// records if the header was written.
+type recoverResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader records the header was written and delegates to the
+// original ResponseWriter.
+func (rw *recoverResponseWriter) WriteHeader(statusCode int) {
+	// Informational responses, such as 103 Early Hints, are not final.
+	if statusCode >= 200 {
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the header was written and delegates to the original
+// ResponseWriter.
+func (rw *recoverResponseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, so streaming responses
+// work through Recover.
+func (rw *recoverResponseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController.
+func (rw *recoverResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
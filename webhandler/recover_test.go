@@ -0,0 +1,116 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestRecover(t *testing.T) {
+	var got any
+	onPanic := func(r *http.Request, v any, stack []byte) {
+		if len(stack) == 0 {
+			t.Error("onPanic called without stack")
+		}
+		got = v
+	}
+
+	h := webhandler.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), onPanic)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if want := "Error: Internal Server Error\n"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+	if got != "boom" {
+		t.Errorf("onPanic value = %v, want %q", got, "boom")
+	}
+}
+
+func TestRecoverErrAbortHandler(t *testing.T) {
+	h := webhandler.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recover() = %v, want %v", v, http.ErrAbortHandler)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRecoverJSON(t *testing.T) {
+	h := webhandler.NewUUIDRequestIDMiddleware(webhandler.Recover(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	var got struct{ Error, RequestID string }
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if got.Error != "Internal Server Error" {
+		t.Errorf("error = %q, want %q", got.Error, "Internal Server Error")
+	}
+	if want := rec.Header().Get("X-Request-ID"); got.RequestID != want {
+		t.Errorf("requestID = %q, want %q", got.RequestID, want)
+	}
+}
+
+func TestRecoverAfterWrite(t *testing.T) {
+	var responded bool
+	h := webhandler.RecoverWithResponse(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("boom")
+	}), func(w http.ResponseWriter, r *http.Request) {
+		responded = true
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if responded {
+		t.Error("responder called after header was written")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body.String(), http.StatusOK, "partial")
+	}
+}
+
+func TestRecoverCountsPanics(t *testing.T) {
+	panics := expvar.Get("panics").(*expvar.Int)
+	before := panics.Value()
+
+	h := webhandler.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := panics.Value() - before; got != 1 {
+		t.Errorf("panics increased by %d, want 1", got)
+	}
+}
@@ -26,7 +26,7 @@ func RequestGetHandler(w http.ResponseWriter, r *http.Request) {
 	b, err := httputil.DumpRequest(r, true)
 	if err != nil {
 		errMsg := fmt.Sprintf("error dumping request: %v", err)
-		http.Error(w, errMsg, http.StatusInternalServerError)
+		webutil.Error(w, r, http.StatusInternalServerError, "", errMsg)
 		logger.Error("failed to dump request",
 			slog.String("error", err.Error()))
 		return
@@ -5,27 +5,30 @@ package webhandler
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"net/http"
 	"sync/atomic"
 
 	"github.com/bnixon67/webapp/util"
+	"github.com/bnixon67/webapp/webid"
 )
 
 // prefix is a random prefix for the request ID set at program startup.
-var prefix string = generateRandomPrefix()
+var prefix string = generateRandomPrefix(rand.Reader)
 
 // prefixLen is the length of the random request ID prefix.
 const prefixLen = 4
 
-// generateRandomPrefix creates a random string to be used as a prefix for
-// generating request IDs.
+// generateRandomPrefix creates a random string from rnd to be used as a
+// prefix for generating request IDs.
 //
 // If the random string generation fails, the function will panic.
-func generateRandomPrefix() string {
+func generateRandomPrefix(rnd io.Reader) string {
 	const lowerLetters = "abcdefghijklmnopqrstuvwxyz"
 
-	prefix, err := util.RandomStringFromCharset(lowerLetters, prefixLen)
+	prefix, err := util.RandomStringFromCharsetReader(rnd, lowerLetters, prefixLen)
 	if err != nil {
 		panic("failed to initialize request ID prefix: " + err.Error())
 	}
@@ -36,7 +39,7 @@ func generateRandomPrefix() string {
 // generateRequestID generates a unique request ID by concatenating a
 // pre-defined random prefix with the hexadecimal representation of an
 // atomically incremented counter.
-func generateRequestID(counter *uint32) string {
+func generateRequestID(prefix string, counter *uint32) string {
 	id := atomic.AddUint32(counter, 1)
 	return fmt.Sprintf("%s%08X", prefix, id)
 }
@@ -53,18 +56,57 @@ var reqIDKey = reqIDType{}
 //
 // It uses an atomic counter to ensure each ID is unique across all requests.
 func NewRequestIDMiddleware(next http.Handler) http.Handler {
-	var counter uint32 // Counter to generate unique IDs, persistent across requests.
+	return requestIDHandler(next, prefix)
+}
+
+// NewRequestIDMiddlewareWithRand returns middleware like
+// NewRequestIDMiddleware, except the request ID prefix is read from rnd
+// when the middleware is created instead of at program startup. Tests can
+// use a webtest.SeqReader to get reproducible request IDs.
+func NewRequestIDMiddlewareWithRand(rnd io.Reader) func(http.Handler) http.Handler {
+	prefix := generateRandomPrefix(rnd)
+
+	return func(next http.Handler) http.Handler {
+		return requestIDHandler(next, prefix)
+	}
+}
+
+// NewUUIDRequestIDMiddleware is like NewRequestIDMiddleware but request IDs
+// are UUIDv7s from webid, so they are unique across instances and restarts
+// and sort by time. If an ID cannot be generated, a counter ID is used.
+func NewUUIDRequestIDMiddleware(next http.Handler) http.Handler {
+	var counter uint32 // Counter for fallback IDs.
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqID := generateRequestID(&counter)
+		reqID, err := webid.NewString()
+		if err != nil {
+			reqID = generateRequestID(prefix, &counter)
+		}
+
+		serveWithRequestID(w, r, next, reqID)
+	})
+}
+
+// requestIDHandler assigns request IDs that start with prefix.
+func requestIDHandler(next http.Handler, prefix string) http.Handler {
+	var counter uint32 // Counter to generate unique IDs, persistent across requests.
 
-		w.Header().Set("X-Request-ID", reqID)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := generateRequestID(prefix, &counter)
 
-		ctx := context.WithValue(r.Context(), reqIDKey, reqID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		serveWithRequestID(w, r, next, reqID)
 	})
 }
 
+// serveWithRequestID sets the X-Request-ID header and adds reqID to the
+// request context before calling next.
+func serveWithRequestID(w http.ResponseWriter, r *http.Request, next http.Handler, reqID string) {
+	w.Header().Set("X-Request-ID", reqID)
+
+	ctx := context.WithValue(r.Context(), reqIDKey, reqID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // RequestID extracts the request ID from the provided context.
 //
 // If the context is nil or does not include a request ID, the function
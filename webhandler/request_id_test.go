@@ -0,0 +1,56 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webid"
+	"github.com/bnixon67/webapp/webtest"
+)
+
+func TestNewRequestIDMiddlewareWithRand(t *testing.T) {
+	requestIDs := func() []string {
+		var got []string
+		h := webhandler.NewRequestIDMiddlewareWithRand(webtest.NewSeqReader(0))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = append(got, webhandler.RequestID(r.Context()))
+			}))
+
+		for i := 0; i < 2; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+		return got
+	}
+
+	first, second := requestIDs(), requestIDs()
+
+	want := []string{"abcd00000001", "abcd00000002"}
+	for i := range want {
+		if first[i] != want[i] || second[i] != want[i] {
+			t.Errorf("request %d got IDs %q and %q, want %q", i, first[i], second[i], want[i])
+		}
+	}
+}
+
+func TestNewUUIDRequestIDMiddleware(t *testing.T) {
+	var got string
+	h := webhandler.NewUUIDRequestIDMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = webhandler.RequestID(r.Context())
+		}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if _, err := webid.Parse(got); err != nil {
+		t.Errorf("RequestID() = %q, want UUIDv7: %v", got, err)
+	}
+	if header := w.Header().Get("X-Request-ID"); header != got {
+		t.Errorf("X-Request-ID = %q, want %q", header, got)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Route describes a route registered with a Mux, for security reviews,
+// API documentation, and navigation. Access requirements and rate limits
+// are enforced by the handler or middleware, so they are declared when the
+// route is registered.
+type Route struct {
+	Pattern     string   `json:"pattern"`
+	Path        string   `json:"path"`                  // Path is the pattern without the method.
+	Methods     []string `json:"methods,omitempty"`     // Methods is empty if any method is allowed.
+	Login       bool     `json:"login,omitempty"`       // Login is true if a logged in user is required.
+	Roles       []string `json:"roles,omitempty"`       // Roles is the roles, any of which is required.
+	Permissions []string `json:"permissions,omitempty"` // Permissions is the permissions required.
+	RateLimit   string   `json:"rateLimit,omitempty"`   // RateLimit is the limit, such as "100/1h".
+	CORS        bool     `json:"cors,omitempty"`        // CORS is true if other origins are allowed.
+	Title       string   `json:"title,omitempty"`       // Title is shown in breadcrumbs and menus.
+	Parent      string   `json:"parent,omitempty"`      // Parent is the path of the parent route.
+	Icon        string   `json:"icon,omitempty"`        // Icon is shown in menus.
+	Timeout     string   `json:"timeout,omitempty"`     // Timeout overrides the deadline, or is "none".
+	Canary      bool     `json:"canary,omitempty"`      // Canary is true if the route has a canary handler.
+
+	cors    *CORSPolicy   // cors is the policy applied by the Mux.
+	timeout time.Duration // timeout is the declared timeout, or zero if none.
+	canary  http.Handler  // canary is the handler of RouteCanary.
+}
+
+// RouteOption declares a property of a Route that the Mux cannot see in
+// the pattern.
+type RouteOption func(*Route)
+
+// RouteMethods declares the methods allowed by a handler that checks the
+// method itself, instead of in the pattern.
+func RouteMethods(methods ...string) RouteOption {
+	return func(r *Route) {
+		r.Methods = append(r.Methods, methods...)
+	}
+}
+
+// RouteLogin declares that the route requires a logged in user.
+func RouteLogin() RouteOption {
+	return func(r *Route) {
+		r.Login = true
+	}
+}
+
+// RouteRoles declares that the route requires any of roles, which implies
+// a logged in user.
+func RouteRoles(roles ...string) RouteOption {
+	return func(r *Route) {
+		r.Login = true
+		r.Roles = append(r.Roles, roles...)
+	}
+}
+
+// RoutePermissions declares that the route requires perms, which implies
+// a logged in user.
+func RoutePermissions(perms ...string) RouteOption {
+	return func(r *Route) {
+		r.Login = true
+		r.Permissions = append(r.Permissions, perms...)
+	}
+}
+
+// RouteRateLimit declares the rate limit of the route, such as "100/1h".
+func RouteRateLimit(limit string) RouteOption {
+	return func(r *Route) {
+		r.RateLimit = limit
+	}
+}
+
+// RouteCORS applies policy to the route, so browser apps on the allowed
+// origins can call it. Unlike the other options, it is enforced by the
+// Mux, which wraps the handler with CORS and, if the pattern has a method,
+// also handles preflight requests for the path. If policy is nil, the
+// route is not changed.
+func RouteCORS(policy *CORSPolicy) RouteOption {
+	return func(r *Route) {
+		if policy != nil {
+			r.CORS = true
+			r.cors = policy
+		}
+	}
+}
+
+// methodNotAllowed responds to OPTIONS requests that are not preflight
+// requests.
+var methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	webutil.Error(w, r, http.StatusMethodNotAllowed, "", "")
+})
+
+// Mux is an http.ServeMux that records the registered routes, so that an
+// inventory of them can be generated with Routes.
+type Mux struct {
+	*http.ServeMux
+	routes    []Route
+	preflight map[string]bool          // preflight has the paths with an OPTIONS route.
+	timeouts  map[string]time.Duration // timeouts are those declared by pattern.
+	states    RouteStates              // states, if set, disable or canary routes.
+}
+
+// NewMux returns a new Mux.
+func NewMux() *Mux {
+	return &Mux{ServeMux: http.NewServeMux()}
+}
+
+// Handle registers h for pattern, like http.ServeMux.Handle, and records
+// the route with opts.
+func (m *Mux) Handle(pattern string, h http.Handler, opts ...RouteOption) {
+	r := newRoute(pattern, opts)
+	h = m.withState(h, r)
+
+	if r.cors != nil {
+		h = CORS(h, r.cors)
+
+		// Preflight requests use OPTIONS, which a pattern with another
+		// method does not match. The first policy of a path is used.
+		if r.Pattern != r.Path && !m.preflight[r.Path] {
+			if m.preflight == nil {
+				m.preflight = make(map[string]bool)
+			}
+			m.preflight[r.Path] = true
+			m.ServeMux.Handle(http.MethodOptions+" "+r.Path, CORS(methodNotAllowed, r.cors))
+		}
+	}
+
+	if r.timeout != 0 {
+		if m.timeouts == nil {
+			m.timeouts = make(map[string]time.Duration)
+		}
+		m.timeouts[pattern] = r.timeout
+	}
+
+	m.ServeMux.Handle(pattern, m.withNav(h, r))
+	m.routes = append(m.routes, r)
+}
+
+// HandleFunc registers h for pattern, like http.ServeMux.HandleFunc, and
+// records the route with opts.
+func (m *Mux) HandleFunc(pattern string, h func(http.ResponseWriter, *http.Request), opts ...RouteOption) {
+	m.Handle(pattern, http.HandlerFunc(h), opts...)
+}
+
+// Routes returns the registered routes sorted by path and pattern.
+func (m *Mux) Routes() []Route {
+	routes := make([]Route, len(m.routes))
+	copy(routes, m.routes)
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
+}
+
+// newRoute returns the route for pattern with opts applied. A method in
+// the pattern is used unless opts declare the methods. GET also matches
+// HEAD, as in http.ServeMux.
+func newRoute(pattern string, opts []RouteOption) Route {
+	r := Route{Pattern: pattern, Path: pattern}
+
+	if method, path, found := strings.Cut(pattern, " "); found {
+		r.Path = strings.TrimLeft(path, " \t")
+		r.Methods = []string{method}
+		if method == http.MethodGet {
+			r.Methods = append(r.Methods, http.MethodHead)
+		}
+	}
+
+	var declared Route
+	for _, opt := range opts {
+		opt(&declared)
+	}
+	if declared.Methods != nil {
+		r.Methods = declared.Methods
+	}
+	r.Login = declared.Login
+	r.Roles = declared.Roles
+	r.Permissions = declared.Permissions
+	r.RateLimit = declared.RateLimit
+	r.CORS = declared.CORS
+	r.cors = declared.cors
+	r.Title = declared.Title
+	r.Parent = declared.Parent
+	r.Icon = declared.Icon
+	r.Timeout = declared.Timeout
+	r.timeout = declared.timeout
+	r.Canary = declared.Canary
+	r.canary = declared.canary
+
+	return r
+}
+
+// WriteRoutes writes routes to w as indented JSON.
+func WriteRoutes(w io.Writer, routes []Route) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(routes)
+}
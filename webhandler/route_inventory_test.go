@@ -0,0 +1,51 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMuxRoutes(t *testing.T) {
+	mux := webhandler.NewMux()
+	mux.Handle("POST /users/{id}", textHandler("update"),
+		webhandler.RoutePermissions("users:manage"), webhandler.RouteRateLimit("10/1m"))
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {},
+		webhandler.RouteMethods(http.MethodGet, http.MethodPost))
+	mux.Handle("GET /users/{id}", textHandler("user"), webhandler.RouteRoles("admin"))
+	mux.Handle("/", textHandler("root"))
+
+	want := []webhandler.Route{
+		{Pattern: "/", Path: "/"},
+		{Pattern: "/login", Path: "/login", Methods: []string{"GET", "POST"}},
+		{Pattern: "GET /users/{id}", Path: "/users/{id}", Methods: []string{"GET", "HEAD"}, Login: true, Roles: []string{"admin"}},
+		{Pattern: "POST /users/{id}", Path: "/users/{id}", Methods: []string{"POST"}, Login: true, Permissions: []string{"users:manage"}, RateLimit: "10/1m"},
+	}
+	if got := mux.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// The routes are served like http.ServeMux.
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if w.Body.String() != "user" {
+		t.Errorf("got body %q, want %q", w.Body, "user")
+	}
+
+	var sb strings.Builder
+	if err := webhandler.WriteRoutes(&sb, want); err != nil {
+		t.Fatalf("WriteRoutes() failed: %v", err)
+	}
+	var got []webhandler.Route
+	if err := json.Unmarshal([]byte(sb.String()), &got); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("WriteRoutes() = %s, %v, want JSON of routes", sb.String(), err)
+	}
+}
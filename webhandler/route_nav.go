@@ -0,0 +1,133 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RouteTitle declares the title of the route in breadcrumbs and menus.
+// Routes without a title are not shown in either.
+func RouteTitle(title string) RouteOption {
+	return func(r *Route) {
+		r.Title = title
+	}
+}
+
+// RouteParent declares the path of the parent of the route in
+// breadcrumbs, and of the menu the route is in. Routes without a parent
+// are in the top menu.
+func RouteParent(path string) RouteOption {
+	return func(r *Route) {
+		r.Parent = path
+	}
+}
+
+// RouteIcon declares the icon of the route in menus, such as the name of
+// an icon in an icon font.
+func RouteIcon(icon string) RouteOption {
+	return func(r *Route) {
+		r.Icon = icon
+	}
+}
+
+// maxNavDepth limits the breadcrumbs, in case parents form a cycle.
+const maxNavDepth = 10
+
+// Nav is the navigation of a request: its route and the titled routes of
+// the Mux that served it, for breadcrumbs and menus.
+type Nav struct {
+	Route Route // Route is the route of the request.
+	mux   *Mux
+}
+
+// navKey is the context key of the Nav of a request.
+type navKey struct{}
+
+// NavFromContext returns the Nav of the request with ctx, or nil if the
+// request was not served by a Mux.
+func NavFromContext(ctx context.Context) *Nav {
+	nav, _ := ctx.Value(navKey{}).(*Nav)
+	return nav
+}
+
+// withNav returns h with the Nav for route added to the context of
+// requests.
+func (m *Mux) withNav(h http.Handler, route Route) http.Handler {
+	nav := &Nav{Route: route, mux: m}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), navKey{}, nav)))
+	})
+}
+
+// titled returns the first route with a title at path.
+func (m *Mux) titled(path string) (Route, bool) {
+	for _, r := range m.routes {
+		if r.Path == path && r.Title != "" {
+			return r, true
+		}
+	}
+
+	return Route{}, false
+}
+
+// Breadcrumbs returns the titled routes from the top of the parents of
+// the route of n to the route itself, which is last. It is empty if the
+// route has no title, or n is nil.
+func (n *Nav) Breadcrumbs() []Route {
+	if n == nil || n.Route.Title == "" {
+		return nil
+	}
+
+	crumbs := []Route{n.Route}
+	for parent := n.Route.Parent; parent != "" && len(crumbs) < maxNavDepth; {
+		r, ok := n.mux.titled(parent)
+		if !ok {
+			break
+		}
+		crumbs = append(crumbs, r)
+		parent = r.Parent
+	}
+	slices.Reverse(crumbs)
+
+	return crumbs
+}
+
+// Menu returns the titled routes with parent that can be requested with
+// GET, sorted by title. An empty parent returns the top menu. Templates
+// should only show the routes the user can access.
+func (n *Nav) Menu(parent string) []Route {
+	if n == nil {
+		return nil
+	}
+
+	var menu []Route
+	for _, r := range n.mux.routes {
+		if r.Title == "" || r.Parent != parent {
+			continue
+		}
+		if len(r.Methods) > 0 && !slices.Contains(r.Methods, http.MethodGet) {
+			continue
+		}
+		if slices.ContainsFunc(menu, func(m Route) bool { return m.Path == r.Path }) {
+			continue
+		}
+		menu = append(menu, r)
+	}
+	slices.SortStableFunc(menu, func(a, b Route) int {
+		return strings.Compare(a.Title, b.Title)
+	})
+
+	return menu
+}
+
+// Current returns true if r is the route of n or one of its parents, to
+// highlight it in menus.
+func (n *Nav) Current(r Route) bool {
+	return slices.ContainsFunc(n.Breadcrumbs(), func(c Route) bool { return c.Path == r.Path })
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestNav(t *testing.T) {
+	var nav *webhandler.Nav
+	capture := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nav = webhandler.NavFromContext(r.Context())
+		w.Write([]byte(r.PathValue("id")))
+	})
+
+	mux := webhandler.NewMux()
+	mux.Handle("GET /", capture, webhandler.RouteTitle("Home"))
+	mux.Handle("GET /users", capture, webhandler.RouteTitle("Users"), webhandler.RouteIcon("people"))
+	mux.Handle("GET /users/{id}", capture, webhandler.RouteTitle("User"), webhandler.RouteParent("/users"))
+	mux.Handle("POST /users/{id}", capture, webhandler.RouteTitle("Update User"), webhandler.RouteParent("/users"))
+	mux.Handle("GET /audit", capture, webhandler.RouteTitle("Audit"), webhandler.RouteParent("/users"))
+	mux.Handle("GET /untitled", capture)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if w.Body.String() != "42" {
+		t.Errorf("path value = %q, want %q", w.Body, "42")
+	}
+	if nav == nil {
+		t.Fatal("NavFromContext() = nil, want nav of route")
+	}
+
+	titles := func(routes []webhandler.Route) []string {
+		var got []string
+		for _, r := range routes {
+			got = append(got, r.Title)
+		}
+		return got
+	}
+
+	if got, want := titles(nav.Breadcrumbs()), []string{"Users", "User"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Breadcrumbs() = %q, want %q", got, want)
+	}
+	if got, want := titles(nav.Menu("")), []string{"Home", "Users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Menu(\"\") = %q, want %q", got, want)
+	}
+	if got, want := titles(nav.Menu("/users")), []string{"Audit", "User"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Menu(\"/users\") = %q, want %q", got, want)
+	}
+	if menu := nav.Menu(""); !nav.Current(menu[1]) || nav.Current(menu[0]) || menu[1].Icon != "people" {
+		t.Errorf("Current() of top menu %+v, want only Users", menu)
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/untitled", nil))
+	if crumbs := nav.Breadcrumbs(); crumbs != nil {
+		t.Errorf("Breadcrumbs() of untitled route = %+v, want nil", crumbs)
+	}
+
+	var none *webhandler.Nav
+	if none.Breadcrumbs() != nil || none.Menu("") != nil {
+		t.Errorf("nil Nav has breadcrumbs or menu")
+	}
+}
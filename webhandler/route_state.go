@@ -0,0 +1,65 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// RouteState is the state of a route that is set at runtime, such as to
+// take a broken page offline or to roll out a new version of a handler.
+type RouteState struct {
+	Disabled bool   // Disabled routes respond with http.StatusServiceUnavailable.
+	Message  string // Message tells users why the route is disabled.
+	Canary   int    // Canary is the percent of requests served by the canary handler.
+}
+
+// RouteStates returns the state of the route with pattern. It is called
+// for every request, so it should be fast.
+type RouteStates interface {
+	RouteState(pattern string) RouteState
+}
+
+// RouteCanary declares canary as another handler of the route, such as a
+// rewrite of it, to serve the percent of requests set by the RouteStates
+// of the Mux. Like the handler of the route, it is wrapped by the CORS of
+// the route, but not by other middleware.
+func RouteCanary(canary http.Handler) RouteOption {
+	return func(r *Route) {
+		r.Canary = canary != nil
+		r.canary = canary
+	}
+}
+
+// SetRouteStates sets the states of the routes of m. It must be called
+// before m serves requests.
+func (m *Mux) SetRouteStates(states RouteStates) {
+	m.states = states
+}
+
+// withState returns h, which disables route or sends a share of requests
+// to its canary handler according to the RouteStates of m.
+func (m *Mux) withState(h http.Handler, route Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.states == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		state := m.states.RouteState(route.Pattern)
+		switch {
+		case state.Disabled:
+			RequestLogger(r).Warn("route disabled", "pattern", route.Pattern)
+			webutil.Error(w, r, http.StatusServiceUnavailable, "route_disabled", state.Message)
+		case route.canary != nil && rand.IntN(100) < state.Canary:
+			RequestLogger(r).Debug("serving canary", "pattern", route.Pattern)
+			route.canary.ServeHTTP(w, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	})
+}
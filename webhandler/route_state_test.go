@@ -0,0 +1,75 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+// routeStates are the states of routes by pattern.
+type routeStates map[string]webhandler.RouteState
+
+func (s routeStates) RouteState(pattern string) webhandler.RouteState {
+	return s[pattern]
+}
+
+func TestRouteStates(t *testing.T) {
+	text := func(s string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, s)
+		}
+	}
+
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET /old", text("old"), webhandler.RouteCanary(text("new")))
+	mux.HandleFunc("GET /plain", text("plain"))
+	mux.HandleFunc("GET /off", text("off"))
+	mux.HandleFunc("GET /all", text("old"), webhandler.RouteCanary(text("new")))
+	mux.SetRouteStates(routeStates{
+		"GET /plain": {Canary: 100},
+		"GET /off":   {Disabled: true, Message: "Back soon."},
+		"GET /all":   {Canary: 100},
+	})
+
+	tests := []struct {
+		target   string
+		wantCode int
+		wantBody string
+	}{
+		{"/old", http.StatusOK, "old"},
+		{"/plain", http.StatusOK, "plain"},
+		{"/off", http.StatusServiceUnavailable, "Error: Service Unavailable\nBack soon.\n"},
+		{"/all", http.StatusOK, "new"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if got := w.Body.String(); got != tc.wantBody {
+				t.Errorf("body = %q, want %q", got, tc.wantBody)
+			}
+		})
+	}
+
+	var canaries []string
+	for _, route := range mux.Routes() {
+		if route.Canary {
+			canaries = append(canaries, route.Pattern)
+		}
+	}
+	if got := strings.Join(canaries, ", "); got != "GET /all, GET /old" {
+		t.Errorf("routes with canary = %q, want %q", got, "GET /all, GET /old")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+	"time"
+)
+
+// NoTimeout is the timeout of a route whose requests have no deadline,
+// such as an event stream that stays open.
+const NoTimeout time.Duration = -1
+
+// RouteTimeout declares the time allowed to handle requests of the route,
+// which overrides the timeout of Mux.Timeout and Mux.TimeoutFor. If d is
+// zero or less, such as NoTimeout, requests of the route have no deadline.
+func RouteTimeout(d time.Duration) RouteOption {
+	return func(r *Route) {
+		if d <= 0 {
+			r.Timeout, r.timeout = "none", NoTimeout
+			return
+		}
+		r.Timeout, r.timeout = d.String(), d
+	}
+}
+
+// TimeoutFor returns a TimeoutFunc for Deadline that returns the timeout
+// declared with RouteTimeout for the route of r, or that of fallback if
+// the route has none.
+func (m *Mux) TimeoutFor(fallback TimeoutFunc) TimeoutFunc {
+	return func(r *http.Request) time.Duration {
+		_, pattern := m.ServeMux.Handler(r)
+		if d, ok := m.timeouts[pattern]; ok {
+			return max(d, 0)
+		}
+
+		return fallback(r)
+	}
+}
+
+// Timeout is like the Timeout middleware, but routes of m declared with
+// RouteTimeout have their own timeout. The middleware can wrap m, or a
+// handler that wraps m.
+func (m *Mux) Timeout(d time.Duration) func(http.Handler) http.Handler {
+	timeoutFor := m.TimeoutFor(func(*http.Request) time.Duration { return d })
+
+	return func(next http.Handler) http.Handler {
+		return deadline(next, timeoutFor, http.StatusServiceUnavailable)
+	}
+}
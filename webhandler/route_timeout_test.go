@@ -0,0 +1,73 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestMuxTimeout(t *testing.T) {
+	// deadline reports the time left to handle the request, or -1 if it
+	// has no deadline.
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		d, ok := r.Context().Deadline()
+		if !ok {
+			w.Write([]byte("none"))
+			return
+		}
+		w.Write([]byte(time.Until(d).Round(time.Minute).String()))
+	}
+
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET /page", deadline)
+	mux.HandleFunc("GET /stream", deadline, webhandler.RouteTimeout(webhandler.NoTimeout))
+	mux.HandleFunc("GET /report", deadline, webhandler.RouteTimeout(5*time.Minute))
+
+	h := mux.Timeout(time.Minute)(mux)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/page", "1m0s"},
+		{"/stream", "none"},
+		{"/report", "5m0s"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if got := rec.Body.String(); got != tc.want {
+				t.Errorf("deadline = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMuxTimeoutFor(t *testing.T) {
+	mux := webhandler.NewMux()
+	mux.HandleFunc("GET /live", func(http.ResponseWriter, *http.Request) {}, webhandler.RouteTimeout(0))
+	mux.HandleFunc("GET /page", func(http.ResponseWriter, *http.Request) {})
+
+	timeoutFor := mux.TimeoutFor(func(*http.Request) time.Duration { return time.Second })
+
+	if got := timeoutFor(httptest.NewRequest(http.MethodGet, "/live", nil)); got != 0 {
+		t.Errorf("timeout of /live = %v, want 0", got)
+	}
+	if got := timeoutFor(httptest.NewRequest(http.MethodGet, "/page", nil)); got != time.Second {
+		t.Errorf("timeout of /page = %v, want %v", got, time.Second)
+	}
+
+	routes := mux.Routes()
+	if routes[0].Timeout != "none" || routes[1].Timeout != "" {
+		t.Errorf("route timeouts = %q, %q, want %q, %q", routes[0].Timeout, routes[1].Timeout, "none", "")
+	}
+}
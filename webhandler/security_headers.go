@@ -4,11 +4,295 @@
 package webhandler
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// CSPReportGroup is the name of the reporting endpoint of the report-to
+// directive set by AddSecurityHeadersWithReport.
+const CSPReportGroup = "csp-endpoint"
+
+// CSPNonceSource is a source of a Content-Security-Policy directive that is
+// replaced by the nonce of each request, such as in
+// CSP("script-src", "'self'", CSPNonceSource). Templates add the nonce to
+// inline scripts and styles with webutil.NonceAttr and CSPNonce.
+const CSPNonceSource = "'nonce'"
+
+// cspNonceSize is the number of random bytes in a CSP nonce.
+const cspNonceSize = 16
+
+// cspNonceKeyType is a custom type to avoid collisions in context values.
+type cspNonceKeyType struct{}
+
+// cspNonceKey is used to store/retrieve the CSP nonce from a context.
+var cspNonceKey = cspNonceKeyType{}
+
+// Frame options of SecurityHeaders.FrameOptions.
+const (
+	FrameDeny       = "DENY"       // FrameDeny prohibits embedding in any frame.
+	FrameSameOrigin = "SAMEORIGIN" // FrameSameOrigin allows frames of the same origin.
 )
 
+// cspDirective is a Content-Security-Policy directive and its sources.
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// permission is a feature of Permissions-Policy and its allowlist.
+type permission struct {
+	feature   string
+	allowlist []string
+}
+
+// SecurityHeaders builds middleware that sets security headers on
+// responses. Create one with NewSecurityHeaders or DefaultSecurityHeaders,
+// configure it with its methods, which return it for chaining, and then
+// call Handler:
+//
+//	h = webhandler.DefaultSecurityHeaders().
+//		CSP("script-src", "'self'", webhandler.CSPNonceSource).
+//		ReferrerPolicy("same-origin").
+//		PermissionsPolicy("camera").
+//		Handler(h)
+//
+// Changes after Handler is called do not apply to the handler it returned.
+type SecurityHeaders struct {
+	csp          []cspDirective
+	reportURI    string
+	hstsMaxAge   time.Duration
+	hstsPreload  bool
+	referrer     string
+	permissions  []permission
+	frameOptions string
+	headers      [][2]string // headers are other headers and their values.
+}
+
+// NewSecurityHeaders returns SecurityHeaders that only set
+// X-Content-Type-Options to nosniff, which disables MIME type sniffing to
+// mitigate MIME type confusion attacks.
+func NewSecurityHeaders() *SecurityHeaders {
+	return new(SecurityHeaders).Set("X-Content-Type-Options", "nosniff")
+}
+
+// DefaultSecurityHeaders returns the SecurityHeaders of AddSecurityHeaders.
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return NewSecurityHeaders().
+		CSP("default-src", "'self'").
+		CSP("style-src", "'self'", "'unsafe-inline'").
+		FrameOptions(FrameDeny).
+		Set("X-XSS-Protection", "1; mode=block")
+}
+
+// CSP sets the sources of the Content-Security-Policy directive, such as
+// "script-src", replacing any previous sources. Directives are in the
+// order first set. If sources is empty, the directive is removed. Sources
+// of CSPNonceSource are replaced by the nonce of each request.
+func (s *SecurityHeaders) CSP(directive string, sources ...string) *SecurityHeaders {
+	i := slices.IndexFunc(s.csp, func(d cspDirective) bool { return d.name == directive })
+
+	switch {
+	case len(sources) == 0 && i >= 0:
+		s.csp = slices.Delete(s.csp, i, i+1)
+	case len(sources) == 0:
+	case i >= 0:
+		s.csp[i].sources = slices.Clone(sources)
+	default:
+		s.csp = append(s.csp, cspDirective{name: directive, sources: slices.Clone(sources)})
+	}
+
+	return s
+}
+
+// CSPReport asks browsers to send Content-Security-Policy violations to
+// uri, using both the report-uri and report-to directives, which can be
+// parsed by ParseCSPReport. If uri is empty, violations are not reported.
+func (s *SecurityHeaders) CSPReport(uri string) *SecurityHeaders {
+	s.reportURI = uri
+	return s
+}
+
+// HSTS sets Strict-Transport-Security on responses to HTTPS requests, like
+// StrictTransportSecurity. If maxAge is zero, the header is not set.
+func (s *SecurityHeaders) HSTS(maxAge time.Duration, preload bool) *SecurityHeaders {
+	s.hstsMaxAge, s.hstsPreload = maxAge, preload
+	return s
+}
+
+// ReferrerPolicy sets Referrer-Policy, such as
+// "strict-origin-when-cross-origin". If policy is empty, the header is not
+// set.
+func (s *SecurityHeaders) ReferrerPolicy(policy string) *SecurityHeaders {
+	s.referrer = policy
+	return s
+}
+
+// PermissionsPolicy sets the allowlist of feature in Permissions-Policy,
+// replacing any previous allowlist. An empty allowlist disables the
+// feature, "self" allows the same origin, "*" allows any origin, and
+// other entries are origins, such as "https://maps.example.com".
+func (s *SecurityHeaders) PermissionsPolicy(feature string, allowlist ...string) *SecurityHeaders {
+	i := slices.IndexFunc(s.permissions, func(p permission) bool { return p.feature == feature })
+	if i >= 0 {
+		s.permissions[i].allowlist = slices.Clone(allowlist)
+	} else {
+		s.permissions = append(s.permissions, permission{feature: feature, allowlist: slices.Clone(allowlist)})
+	}
+
+	return s
+}
+
+// FrameOptions sets X-Frame-Options to FrameDeny or FrameSameOrigin. If
+// options is empty, the header is not set.
+func (s *SecurityHeaders) FrameOptions(options string) *SecurityHeaders {
+	s.frameOptions = options
+	return s
+}
+
+// Set sets the header name to value on responses, such as a header
+// without a method of its own.
+func (s *SecurityHeaders) Set(name, value string) *SecurityHeaders {
+	name = http.CanonicalHeaderKey(name)
+
+	i := slices.IndexFunc(s.headers, func(h [2]string) bool { return h[0] == name })
+	if i >= 0 {
+		s.headers[i][1] = value
+	} else {
+		s.headers = append(s.headers, [2]string{name, value})
+	}
+
+	return s
+}
+
+// ContentSecurityPolicy returns the Content-Security-Policy of s, with
+// CSPNonceSource not yet replaced by a nonce.
+func (s *SecurityHeaders) ContentSecurityPolicy() string {
+	directives := make([]string, 0, len(s.csp)+2)
+	for _, d := range s.csp {
+		directives = append(directives, d.name+" "+strings.Join(d.sources, " "))
+	}
+	if s.reportURI != "" {
+		directives = append(directives, "report-uri "+s.reportURI, "report-to "+CSPReportGroup)
+	}
+
+	return strings.Join(directives, "; ")
+}
+
+// permissionsPolicy returns the Permissions-Policy of s.
+func (s *SecurityHeaders) permissionsPolicy() string {
+	features := make([]string, 0, len(s.permissions))
+	for _, p := range s.permissions {
+		if len(p.allowlist) == 1 && p.allowlist[0] == "*" {
+			features = append(features, p.feature+"=*")
+			continue
+		}
+
+		allow := make([]string, 0, len(p.allowlist))
+		for _, a := range p.allowlist {
+			if a != "self" && a != "src" {
+				a = strconv.Quote(a)
+			}
+			allow = append(allow, a)
+		}
+		features = append(features, p.feature+"=("+strings.Join(allow, " ")+")")
+	}
+
+	return strings.Join(features, ", ")
+}
+
+// Handler returns middleware that sets the headers of s on responses from
+// next. If the Content-Security-Policy has CSPNonceSource, a new nonce is
+// added to the context of each request, which is returned by CSPNonce.
+func (s *SecurityHeaders) Handler(next http.Handler) http.Handler {
+	var headers [][2]string
+	csp := s.ContentSecurityPolicy()
+	if csp != "" {
+		headers = append(headers, [2]string{"Content-Security-Policy", csp})
+	}
+	if s.reportURI != "" {
+		headers = append(headers, [2]string{"Reporting-Endpoints", CSPReportGroup + `="` + s.reportURI + `"`})
+	}
+	if s.referrer != "" {
+		headers = append(headers, [2]string{"Referrer-Policy", s.referrer})
+	}
+	if pp := s.permissionsPolicy(); pp != "" {
+		headers = append(headers, [2]string{"Permissions-Policy", pp})
+	}
+	if s.frameOptions != "" {
+		headers = append(headers, [2]string{"X-Frame-Options", s.frameOptions})
+	}
+	headers = append(headers, s.headers...)
+
+	var hsts string
+	if s.hstsMaxAge > 0 {
+		hsts = hstsValue(s.hstsMaxAge, s.hstsPreload)
+	}
+
+	nonce := slices.ContainsFunc(s.csp, func(d cspDirective) bool {
+		return slices.Contains(d.sources, CSPNonceSource)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for _, kv := range headers {
+			h.Set(kv[0], kv[1])
+		}
+		if hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		if nonce {
+			value, err := newCSPNonce()
+			if err != nil {
+				RequestLogger(r).Error("failed to create CSP nonce", "err", err)
+				webutil.Error(w, r, http.StatusInternalServerError, "", "")
+				return
+			}
+
+			h.Set("Content-Security-Policy", strings.ReplaceAll(csp, CSPNonceSource, "'nonce-"+value+"'"))
+			r = r.WithContext(context.WithValue(r.Context(), cspNonceKey, value))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newCSPNonce returns a new random CSP nonce.
+func newCSPNonce() (string, error) {
+	b := make([]byte, cspNonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// CSPNonce returns the Content-Security-Policy nonce from ctx, which is
+// set by the Handler of SecurityHeaders with CSPNonceSource. If there is
+// no nonce, an empty string is returned.
+func CSPNonce(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	if nonce, ok := ctx.Value(cspNonceKey).(string); ok {
+		return nonce
+	}
+
+	return ""
+}
+
 // AddSecurityHeaders returns middleware that applies essential security
-// headers to HTTP responses to enhance web application security.
+// headers to HTTP responses to enhance web application security. Use
+// SecurityHeaders to configure the headers.
 //
 // It sets the following headers:
 //   - Content-Security-Policy: Restricts sources for default resource loading
@@ -22,12 +306,47 @@ import (
 //   - X-XSS-Protection: Enables browser-side XSS filters and configures
 //     them to block detected XSS attacks.
 func AddSecurityHeaders(next http.Handler) http.Handler {
+	return AddSecurityHeadersWithReport(next, "")
+}
+
+// AddSecurityHeadersWithReport is like AddSecurityHeaders, but browsers
+// also send Content-Security-Policy violations to reportURI, using both
+// the report-uri and report-to directives, which can be parsed by
+// ParseCSPReport. If reportURI is empty, violations are not reported.
+func AddSecurityHeadersWithReport(next http.Handler, reportURI string) http.Handler {
+	return DefaultSecurityHeaders().CSPReport(reportURI).Handler(next)
+}
+
+// HSTSPreloadMaxAge is the max-age required to be added to the HSTS preload
+// list of browsers.
+const HSTSPreloadMaxAge = 365 * 24 * time.Hour
+
+// hstsValue returns the Strict-Transport-Security header for maxAge and
+// preload.
+func hstsValue(maxAge time.Duration, preload bool) string {
+	hsts := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if preload {
+		hsts += "; includeSubDomains; preload"
+	}
+
+	return hsts
+}
+
+// StrictTransportSecurity returns middleware that sets the
+// Strict-Transport-Security header on responses to HTTPS requests, so
+// browsers only use HTTPS for the host during maxAge.
+//
+// If preload is true, subdomains are included and the host asks to be
+// added to the preload list of browsers, so maxAge should be at least
+// HSTSPreloadMaxAge. Browsers ignore the header over HTTP, so it is only
+// set if the request used TLS.
+func StrictTransportSecurity(next http.Handler, maxAge time.Duration, preload bool) http.Handler {
+	hsts := hstsValue(maxAge, preload)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; style-src 'self' 'unsafe-inline'")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -0,0 +1,108 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestStrictTransportSecurity(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		preload bool
+		tls     bool
+		want    string
+	}{
+		{"preload", webhandler.HSTSPreloadMaxAge, true, true, "max-age=31536000; includeSubDomains; preload"},
+		{"noPreload", time.Hour, false, true, "max-age=3600"},
+		{"http", webhandler.HSTSPreloadMaxAge, true, false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := webhandler.StrictTransportSecurity(http.NotFoundHandler(), tc.maxAge, tc.preload)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Strict-Transport-Security"); got != tc.want {
+				t.Errorf("Strict-Transport-Security = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersBuilder(t *testing.T) {
+	var nonce string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = webhandler.CSPNonce(r.Context())
+	})
+
+	h := webhandler.DefaultSecurityHeaders().
+		CSP("script-src", "'self'", webhandler.CSPNonceSource).
+		CSP("style-src").
+		HSTS(time.Hour, false).
+		ReferrerPolicy("no-referrer").
+		PermissionsPolicy("camera").
+		PermissionsPolicy("geolocation", "self", "https://maps.example.com").
+		PermissionsPolicy("fullscreen", "*").
+		FrameOptions("").
+		Set("x-xss-protection", "0").
+		Handler(next)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if nonce == "" {
+		t.Fatal("CSPNonce() is empty")
+	}
+
+	want := map[string]string{
+		"Content-Security-Policy":   "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'",
+		"Strict-Transport-Security": "max-age=3600",
+		"Referrer-Policy":           "no-referrer",
+		"Permissions-Policy":        `camera=(), geolocation=(self "https://maps.example.com"), fullscreen=*`,
+		"X-Frame-Options":           "",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Xss-Protection":          "0",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	// Each request has a new nonce.
+	first := nonce
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if nonce == first {
+		t.Errorf("CSPNonce() = %q for both requests", nonce)
+	}
+}
+
+func TestCSPNonceWithoutSource(t *testing.T) {
+	var nonce string
+	h := webhandler.DefaultSecurityHeaders().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = webhandler.CSPNonce(r.Context())
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if nonce != "" {
+		t.Errorf("CSPNonce() = %q, want empty", nonce)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Headers of a signed request. The Date header is also signed.
+const (
+	SignatureKeyHeader   = "X-Signature-Key"   // SignatureKeyHeader is the id of the key.
+	SignatureNonceHeader = "X-Signature-Nonce" // SignatureNonceHeader is unique per request.
+	SignatureHeader      = "X-Signature"       // SignatureHeader is the hex HMAC-SHA256.
+)
+
+// Defaults of a SignatureVerifier.
+const (
+	DefaultMaxSkew      = 5 * time.Minute
+	DefaultMaxSignedLen = 1 << 20
+)
+
+var (
+	ErrSignatureMissing = errors.New("signature missing")
+	ErrSignatureKey     = errors.New("unknown signature key")
+	ErrSignatureDate    = errors.New("signature date outside allowed skew")
+	ErrSignatureReplay  = errors.New("signature nonce already used")
+	ErrSignatureInvalid = errors.New("invalid signature")
+)
+
+// SecretFunc returns the secret of the key with id, or false if there is
+// no such key.
+type SecretFunc func(id string) ([]byte, bool)
+
+// SignatureVerifier verifies requests signed by SignRequest, as an
+// alternative to bearer keys for machine-to-machine clients.
+//
+// The signature is an HMAC-SHA256 of the method, path and query, Date
+// header, nonce, and SHA-256 of the body. Requests are rejected if the Date
+// differs from the current time by more than MaxSkew, or if the nonce was
+// already used by the key within MaxSkew, which prevents replays.
+type SignatureVerifier struct {
+	Secret  SecretFunc
+	MaxSkew time.Duration    // MaxSkew is the allowed clock skew.
+	MaxLen  int64            // MaxLen is the maximum size of a signed body.
+	Now     func() time.Time // Now returns the current time.
+
+	mu       sync.Mutex
+	nonces   map[string]time.Time // nonces are the expiration by key and nonce.
+	expiring []usedNonce          // expiring are the nonces in order of expiration.
+}
+
+// usedNonce is a nonce and when it can be used again.
+type usedNonce struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewSignatureVerifier returns a SignatureVerifier with the defaults that
+// gets secrets from secret.
+func NewSignatureVerifier(secret SecretFunc) *SignatureVerifier {
+	return &SignatureVerifier{
+		Secret:  secret,
+		MaxSkew: DefaultMaxSkew,
+		MaxLen:  DefaultMaxSignedLen,
+		Now:     time.Now,
+	}
+}
+
+// signatureKeyType is a custom type to avoid collisions in context values.
+type signatureKeyType struct{}
+
+// signatureKey is used to store/retrieve the key id from a context.
+var signatureKey = signatureKeyType{}
+
+// SignatureKeyID returns the id of the key that signed the request with
+// ctx, if the signature was verified by RequireSignature.
+func SignatureKeyID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(signatureKey).(string)
+	return id, ok
+}
+
+// IsSigned returns true if r has a signature, which may not be valid.
+func IsSigned(r *http.Request) bool {
+	return r.Header.Get(SignatureHeader) != ""
+}
+
+// signedString returns the string signed for a request.
+func signedString(method, uri, date, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + uri + "\n" + date + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])
+}
+
+// sign returns the hex HMAC-SHA256 of s with secret.
+func sign(secret []byte, s string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest signs r, which has the given body, with the key id and
+// secret. The nonce must be unique for each request, e.g., random.
+func SignRequest(r *http.Request, body []byte, id string, secret []byte, nonce string, now time.Time) {
+	date := now.UTC().Format(http.TimeFormat)
+
+	r.Header.Set("Date", date)
+	r.Header.Set(SignatureKeyHeader, id)
+	r.Header.Set(SignatureNonceHeader, nonce)
+	r.Header.Set(SignatureHeader, sign(secret, signedString(r.Method, r.URL.RequestURI(), date, nonce, body)))
+}
+
+// Verify checks the signature of r and returns the id of the key. The
+// body of r is read and replaced, so that it can be read again.
+func (v *SignatureVerifier) Verify(r *http.Request) (string, error) {
+	id := r.Header.Get(SignatureKeyHeader)
+	nonce := r.Header.Get(SignatureNonceHeader)
+	got := r.Header.Get(SignatureHeader)
+	date := r.Header.Get("Date")
+	if id == "" || nonce == "" || got == "" || date == "" {
+		return "", ErrSignatureMissing
+	}
+
+	secret, ok := v.Secret(id)
+	if !ok {
+		return "", ErrSignatureKey
+	}
+
+	t, err := http.ParseTime(date)
+	if err != nil {
+		return "", ErrSignatureDate
+	}
+	now := v.Now()
+	if skew := now.Sub(t).Abs(); skew > v.MaxSkew {
+		return "", ErrSignatureDate
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, v.MaxLen+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(body)) > v.MaxLen {
+		return "", ErrSignatureInvalid
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	want := sign(secret, signedString(r.Method, r.URL.RequestURI(), date, nonce, body))
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return "", ErrSignatureInvalid
+	}
+
+	// Only record the nonce of a valid signature, so that others cannot
+	// use up the nonces of a key.
+	if !v.useNonce(id+"\x00"+nonce, now) {
+		return "", ErrSignatureReplay
+	}
+
+	return id, nil
+}
+
+// useNonce records nonce and returns true if it was not already used.
+// The nonce is kept for twice MaxSkew, since a request can be dated up to
+// MaxSkew in the future. Nonces expire in the order they were used, so
+// only the expired ones at the front of the queue are removed.
+func (v *SignatureVerifier) useNonce(nonce string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.nonces == nil {
+		v.nonces = make(map[string]time.Time)
+	}
+
+	for len(v.expiring) > 0 && now.After(v.expiring[0].expires) {
+		n := v.expiring[0]
+		if v.nonces[n.nonce].Equal(n.expires) {
+			delete(v.nonces, n.nonce)
+		}
+		v.expiring = v.expiring[1:]
+	}
+
+	if expires, used := v.nonces[nonce]; used && !now.After(expires) {
+		return false
+	}
+	expires := now.Add(2 * v.MaxSkew)
+	v.nonces[nonce] = expires
+	v.expiring = append(v.expiring, usedNonce{nonce, expires})
+
+	return true
+}
+
+// RequireSignature returns middleware that calls next only if the request
+// is signed and verified by v. Otherwise, it responds with
+// http.StatusUnauthorized. The id of the key is available to next from
+// SignatureKeyID.
+func RequireSignature(next http.Handler, v *SignatureVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := v.Verify(r)
+		if err != nil {
+			RequestLogger(r).Warn("signature not verified", "err", err)
+			webutil.Error(w, r, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), signatureKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+)
+
+func TestRequireSignature(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	secret := []byte("secret")
+
+	v := webhandler.NewSignatureVerifier(func(id string) ([]byte, bool) {
+		return secret, id == "client"
+	})
+	v.Now = func() time.Time { return now }
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := webhandler.SignatureKeyID(r.Context())
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(id + ":" + string(body)))
+	})
+	h := webhandler.RequireSignature(next, v)
+
+	// request returns a request with body signed by id with secret at t,
+	// and then changed by modify, if not nil.
+	request := func(id string, secret []byte, nonce string, t time.Time, modify func(*http.Request)) *http.Request {
+		body := `{"a":1}`
+		r := httptest.NewRequest(http.MethodPost, "/api/test?x=1", strings.NewReader(body))
+		webhandler.SignRequest(r, []byte(body), id, secret, nonce, t)
+		if modify != nil {
+			modify(r)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name       string
+		r          *http.Request
+		wantStatus int
+		wantBody   string
+	}{
+		{"valid", request("client", secret, "n1", now, nil), http.StatusOK, `client:{"a":1}`},
+		{"replay", request("client", secret, "n1", now, nil), http.StatusUnauthorized, ""},
+		{"skewAllowed", request("client", secret, "n2", now.Add(-4*time.Minute), nil), http.StatusOK, `client:{"a":1}`},
+		{"tooOld", request("client", secret, "n3", now.Add(-6*time.Minute), nil), http.StatusUnauthorized, ""},
+		{"future", request("client", secret, "n4", now.Add(6*time.Minute), nil), http.StatusUnauthorized, ""},
+		{"unknownKey", request("other", secret, "n5", now, nil), http.StatusUnauthorized, ""},
+		{"wrongSecret", request("client", []byte("wrong"), "n6", now, nil), http.StatusUnauthorized, ""},
+		{"missing", request("client", secret, "n7", now, func(r *http.Request) {
+			r.Header.Del(webhandler.SignatureHeader)
+		}), http.StatusUnauthorized, ""},
+		{"changedBody", request("client", secret, "n8", now, func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"a":2}`))
+		}), http.StatusUnauthorized, ""},
+		{"changedPath", request("client", secret, "n9", now, func(r *http.Request) {
+			r.URL.RawQuery = "x=2"
+		}), http.StatusUnauthorized, ""},
+		{"changedNonce", request("client", secret, "n10", now, func(r *http.Request) {
+			r.Header.Set(webhandler.SignatureNonceHeader, "n11")
+		}), http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+
+	// A nonce can be used again after it expires.
+	now = now.Add(11 * time.Minute)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request("client", secret, "n1", now, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status for expired nonce = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRequireSignatureLiteral(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	secret := []byte("secret")
+
+	v := &webhandler.SignatureVerifier{
+		Secret:  func(id string) ([]byte, bool) { return secret, id == "client" },
+		MaxSkew: time.Minute,
+		MaxLen:  webhandler.DefaultMaxSignedLen,
+		Now:     func() time.Time { return now },
+	}
+	h := webhandler.RequireSignature(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), v)
+
+	serve := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/api/test", strings.NewReader("body"))
+		webhandler.SignRequest(r, []byte("body"), "client", secret, "nonce", now)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if got := serve(); got != http.StatusOK {
+		t.Errorf("first request: got status %d, want %d", got, http.StatusOK)
+	}
+	if got := serve(); got != http.StatusUnauthorized {
+		t.Errorf("replay: got status %d, want %d", got, http.StatusUnauthorized)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if got := serve(); got != http.StatusOK {
+		t.Errorf("after expiry: got status %d, want %d", got, http.StatusOK)
+	}
+}
@@ -42,7 +42,7 @@ func TestHandler(t *testing.T, handlerFunc http.HandlerFunc, testCases []TestCas
 			r := httptest.NewRequest(tc.RequestMethod, tc.Target, strings.NewReader(tc.RequestBody))
 
 			if len(tc.RequestHeaders) > 0 {
-				r.Header = tc.RequestHeaders
+				r.Header = tc.RequestHeaders.Clone()
 			}
 
 			for _, cookie := range tc.RequestCookies {
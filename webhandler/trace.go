@@ -0,0 +1,71 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/bnixon67/webapp/webtrace"
+)
+
+// patternHandler is implemented by http.ServeMux and Mux to return the
+// pattern that matches a request.
+type patternHandler interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// Trace returns middleware that starts a span with tracer for each request.
+// The span continues the trace of the traceparent header of the request,
+// if any, and is annotated with the request ID and, if next is a mux, the
+// route pattern. Handlers can start child spans, such as for database
+// queries and email sends, with webtrace.StartSpan and the request
+// context.
+//
+// Trace should be used within the request ID middleware, so that the
+// request ID is known.
+func Trace(next http.Handler, tracer webtrace.Tracer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := webtrace.ContextWithTracer(r.Context(), tracer)
+		if sc, ok := webtrace.Extract(r.Header); ok {
+			ctx = webtrace.ContextWithRemote(ctx, sc)
+		}
+
+		var route string
+		if mux, ok := next.(patternHandler); ok {
+			_, route = mux.Handler(r)
+		}
+
+		name := "HTTP " + r.Method
+		if route != "" {
+			name = route
+		}
+		ctx, span := tracer.Start(ctx, name)
+		defer span.End()
+
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		if route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		if reqID := RequestID(ctx); reqID != "" {
+			span.SetAttribute("request.id", reqID)
+		}
+
+		lw := newLoggingResponseWriter(w)
+		next.ServeHTTP(lw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", strconv.Itoa(lw.statusCode))
+		if lw.statusCode >= http.StatusInternalServerError {
+			span.SetError(statusError(lw.statusCode))
+		}
+	})
+}
+
+// statusError is the error of a span for a server error response.
+type statusError int
+
+func (e statusError) Error() string {
+	return strconv.Itoa(int(e)) + " " + http.StatusText(int(e))
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhandler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webtrace"
+)
+
+// recordingTracer is a Tracer that records the spans that it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+// recordedSpan is a span of a recordingTracer.
+type recordedSpan struct {
+	name   string
+	parent webtrace.SpanContext
+	sc     webtrace.SpanContext
+	attrs  map[string]string
+	err    error
+	ended  bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, webtrace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parent := webtrace.Parent(ctx)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]string{}}
+	span.sc.TraceID = parent.TraceID
+	if !parent.IsValid() {
+		span.sc.TraceID[0] = 1
+	}
+	span.sc.SpanID[0] = byte(len(t.spans) + 1)
+	t.spans = append(t.spans, span)
+
+	return webtrace.ContextWithSpan(ctx, span), span
+}
+
+func (s *recordedSpan) SpanContext() webtrace.SpanContext { return s.sc }
+func (s *recordedSpan) SetAttribute(key, value string)    { s.attrs[key] = value }
+func (s *recordedSpan) SetError(err error)                { s.err = err }
+func (s *recordedSpan) End()                              { s.ended = true }
+
+func TestTrace(t *testing.T) {
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := webtrace.StartSpan(r.Context(), "db.query")
+		span.End()
+	})
+	mux.HandleFunc("GET /fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "failed", http.StatusInternalServerError)
+	})
+
+	tracer := &recordingTracer{}
+	h := webhandler.NewRequestIDMiddleware(webhandler.Trace(mux, tracer))
+
+	r := httptest.NewRequest(http.MethodGet, "/items/1?x=y", nil)
+	r.Header.Set(webtrace.TraceParentHeader, parent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(tracer.spans))
+	}
+	req, query := tracer.spans[0], tracer.spans[1]
+
+	if req.name != "GET /items/{id}" {
+		t.Errorf("got name %q, want route", req.name)
+	}
+	if got := req.parent.TraceParent(); got != parent {
+		t.Errorf("got parent %q, want %q", got, parent)
+	}
+	want := map[string]string{
+		"http.method":      http.MethodGet,
+		"http.target":      "/items/1?x=y",
+		"http.route":       "GET /items/{id}",
+		"http.status_code": "200",
+		"request.id":       w.Header().Get("X-Request-ID"),
+	}
+	for k, v := range want {
+		if req.attrs[k] != v {
+			t.Errorf("attribute %s = %q, want %q", k, req.attrs[k], v)
+		}
+	}
+	if !req.ended || req.err != nil {
+		t.Errorf("got ended %v and err %v, want ended without err", req.ended, req.err)
+	}
+
+	if query.parent != req.sc {
+		t.Errorf("got query parent %+v, want %+v", query.parent, req.sc)
+	}
+
+	tracer.spans = nil
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if len(tracer.spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(tracer.spans))
+	}
+	if span := tracer.spans[0]; span.err == nil || span.attrs["http.status_code"] != "500" || span.parent.IsValid() {
+		t.Errorf("got span %+v, want root span with error", span)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhealth
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// Status of a Report or CheckReport.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckReport is the JSON form of a Result. The error is not included,
+// since probes may be reachable by anyone, but is logged instead.
+type CheckReport struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latencyMs"`
+}
+
+// Report is the JSON response of Handler.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckReport `json:"checks"`
+}
+
+// NewReport returns the Report of results.
+func NewReport(results []Result) Report {
+	report := Report{Status: StatusOK, Checks: []CheckReport{}}
+
+	for _, r := range results {
+		status := StatusOK
+		if !r.Healthy {
+			status = StatusFail
+			report.Status = StatusFail
+		}
+		report.Checks = append(report.Checks, CheckReport{
+			Name:      r.Name,
+			Status:    status,
+			LatencyMS: r.Latency.Milliseconds(),
+		})
+	}
+
+	return report
+}
+
+// Handler returns a handler that runs checks and responds with their
+// Report as JSON, for probes such as those of Kubernetes. The status code
+// is http.StatusOK if every check is healthy and
+// http.StatusServiceUnavailable otherwise.
+//
+// Serve it at /healthz with the checks that show the process is alive,
+// and at /readyz with the checks of the components needed to serve
+// requests, such as the database.
+func Handler(checks *Checks) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !webutil.CheckAllowedMethods(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+
+		var results []Result
+		if checks != nil {
+			results = checks.Run(r.Context())
+		}
+		for _, result := range results {
+			if !result.Healthy {
+				slog.Warn("unhealthy", "path", r.URL.Path,
+					"name", result.Name, "err", result.Err)
+			}
+		}
+
+		code := http.StatusOK
+		if !Healthy(results) {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := webutil.RespondWithJSON(w, code, NewReport(results)); err != nil {
+			slog.Error("failed to write JSON", "err", err)
+		}
+	})
+}
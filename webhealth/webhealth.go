@@ -0,0 +1,159 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webhealth checks the health of the components a web app depends
+// on, such as a database or SMTP server.
+package webhealth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/email"
+)
+
+// Checker reports whether a component is ready to serve requests.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// DefaultTimeout is the time allowed for each check.
+const DefaultTimeout = 2 * time.Second
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name    string        // Name of the check.
+	Healthy bool          // Healthy is true if the check succeeded.
+	Latency time.Duration // Latency is how long the check took.
+	Err     error         // Err is the error returned by the check.
+}
+
+// Checks is a named set of Checkers. The zero value is ready to use.
+type Checks struct {
+	mu       sync.Mutex
+	names    []string
+	checkers map[string]Checker
+}
+
+// Add adds or replaces the Checker for name.
+func (c *Checks) Add(name string, checker Checker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checkers == nil {
+		c.checkers = make(map[string]Checker)
+	}
+	if _, exists := c.checkers[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.checkers[name] = checker
+}
+
+// Run runs all checks concurrently and returns the results in the order
+// the checks were added.
+func (c *Checks) Run(ctx context.Context) []Result {
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checkers := make([]Checker, len(names))
+	for i, name := range names {
+		checkers[i] = c.checkers[name]
+	}
+	c.mu.Unlock()
+
+	results := make([]Result, len(names))
+
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := checkers[i].Check(ctx)
+			results[i] = Result{
+				Name:    names[i],
+				Healthy: err == nil,
+				Latency: time.Since(start),
+				Err:     err,
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Healthy returns true if every result is healthy.
+func Healthy(results []Result) bool {
+	for _, r := range results {
+		if !r.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
+
+var ErrNilDB = errors.New("db is nil")
+
+// DBChecker returns a Checker that pings db.
+func DBChecker(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if db == nil {
+			return ErrNilDB
+		}
+
+		return db.PingContext(ctx)
+	})
+}
+
+// SMTPChecker returns a Checker that connects to the SMTP server in cfg.
+func SMTPChecker(cfg email.SMTPConfig) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var d net.Dialer
+
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, cfg.Port))
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	})
+}
+
+var ErrNoTemplates = errors.New("no templates")
+
+// TemplateChecker returns a Checker that verifies tmpl has been parsed and
+// defines each template in names.
+func TemplateChecker(tmpl *template.Template, names ...string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		if tmpl == nil || tmpl.DefinedTemplates() == "" {
+			return ErrNoTemplates
+		}
+
+		for _, name := range names {
+			if tmpl.Lookup(name) == nil {
+				return fmt.Errorf("%w: %q", ErrNoTemplates, name)
+			}
+		}
+
+		return nil
+	})
+}
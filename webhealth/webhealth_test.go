@@ -0,0 +1,181 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webhealth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bnixon67/webapp/email"
+	"github.com/bnixon67/webapp/webhealth"
+)
+
+func TestChecksRun(t *testing.T) {
+	errDown := errors.New("down")
+
+	var checks webhealth.Checks
+	checks.Add("ok", webhealth.CheckerFunc(func(context.Context) error { return nil }))
+	checks.Add("down", webhealth.CheckerFunc(func(context.Context) error { return errDown }))
+	checks.Add("slow", webhealth.CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	// Replacing a check keeps its position.
+	checks.Add("ok", webhealth.CheckerFunc(func(context.Context) error { return nil }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := checks.Run(ctx)
+
+	want := []struct {
+		name    string
+		healthy bool
+		err     error
+	}{
+		{"ok", true, nil},
+		{"down", false, errDown},
+		{"slow", false, context.Canceled},
+	}
+
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.Name != w.name || r.Healthy != w.healthy || !errors.Is(r.Err, w.err) {
+			t.Errorf("result %d = %+v, want %+v", i, r, w)
+		}
+	}
+
+	if webhealth.Healthy(results) {
+		t.Errorf("Healthy() = true, want false")
+	}
+	if !webhealth.Healthy(results[:1]) {
+		t.Errorf("Healthy(ok) = false, want true")
+	}
+}
+
+func TestDBCheckerNil(t *testing.T) {
+	err := webhealth.DBChecker(nil).Check(context.Background())
+	if !errors.Is(err, webhealth.ErrNilDB) {
+		t.Errorf("Check() = %v, want %v", err, webhealth.ErrNilDB)
+	}
+}
+
+func TestSMTPChecker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	cfg := email.SMTPConfig{Host: host, Port: port}
+	if err := webhealth.SMTPChecker(cfg).Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+
+	ln.Close()
+
+	if err := webhealth.SMTPChecker(cfg).Check(context.Background()); err == nil {
+		t.Errorf("Check() = nil after close, want error")
+	}
+}
+
+func TestTemplateChecker(t *testing.T) {
+	tmpl := template.Must(template.New("page.html").Parse("page"))
+
+	tests := []struct {
+		name  string
+		tmpl  *template.Template
+		names []string
+		want  error
+	}{
+		{"parsed", tmpl, nil, nil},
+		{"named", tmpl, []string{"page.html"}, nil},
+		{"missing", tmpl, []string{"other.html"}, webhealth.ErrNoTemplates},
+		{"nil", nil, nil, webhealth.ErrNoTemplates},
+		{"empty", template.New("empty"), nil, webhealth.ErrNoTemplates},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := webhealth.TemplateChecker(tc.tmpl, tc.names...).Check(context.Background())
+			if !errors.Is(err, tc.want) {
+				t.Errorf("Check() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ok := webhealth.CheckerFunc(func(context.Context) error { return nil })
+	down := webhealth.CheckerFunc(func(context.Context) error { return errors.New("secret detail") })
+
+	healthy := &webhealth.Checks{}
+	healthy.Add("ok", ok)
+
+	unhealthy := &webhealth.Checks{}
+	unhealthy.Add("ok", ok)
+	unhealthy.Add("down", down)
+
+	tests := []struct {
+		name     string
+		checks   *webhealth.Checks
+		method   string
+		wantCode int
+		want     webhealth.Report
+	}{
+		{
+			name: "healthy", checks: healthy, method: http.MethodGet, wantCode: http.StatusOK,
+			want: webhealth.Report{Status: "ok", Checks: []webhealth.CheckReport{{Name: "ok", Status: "ok"}}},
+		},
+		{
+			name: "unhealthy", checks: unhealthy, method: http.MethodGet, wantCode: http.StatusServiceUnavailable,
+			want: webhealth.Report{Status: "fail", Checks: []webhealth.CheckReport{{Name: "ok", Status: "ok"}, {Name: "down", Status: "fail"}}},
+		},
+		{
+			name: "none", checks: nil, method: http.MethodGet, wantCode: http.StatusOK,
+			want: webhealth.Report{Status: "ok", Checks: []webhealth.CheckReport{}},
+		},
+		{
+			name: "post", checks: healthy, method: http.MethodPost, wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			webhealth.Handler(tc.checks).ServeHTTP(w, httptest.NewRequest(tc.method, "/readyz", nil))
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("got status %d, want %d", w.Code, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusMethodNotAllowed {
+				return
+			}
+
+			var got webhealth.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid JSON %q: %v", w.Body, err)
+			}
+			for i := range got.Checks {
+				got.Checks[i].LatencyMS = 0
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("got Cache-Control %q, want no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webid generates UUIDv7 identifiers, as defined by RFC 9562. They
+// are globally unique and sort by creation time, even across instances,
+// which makes them suitable for request IDs and the primary keys of
+// records such as users, API keys, and events.
+package webid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ID is a UUIDv7.
+type ID [16]byte
+
+// Nil is the zero ID.
+var Nil ID
+
+var ErrInvalid = errors.New("invalid id")
+
+// Generator creates IDs. IDs from the same Generator are strictly
+// increasing, even if created in the same millisecond or if the clock goes
+// backwards. The zero value uses crypto/rand and time.Now and is safe for
+// concurrent use.
+type Generator struct {
+	Rand io.Reader        // Rand is the source of random bytes.
+	Now  func() time.Time // Now returns the current time.
+
+	mu     sync.Mutex
+	lastMs int64  // lastMs is the timestamp of the last ID.
+	seq    uint16 // seq is the 12-bit counter in the last ID.
+}
+
+// maxSeq is the largest value of the 12-bit counter.
+const maxSeq = 0xFFF
+
+// New returns a new ID from g.
+func (g *Generator) New() (ID, error) {
+	var id ID
+
+	r := g.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	if _, err := io.ReadFull(r, id[6:]); err != nil {
+		return Nil, err
+	}
+
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+
+	g.mu.Lock()
+	ms := now().UnixMilli()
+	if ms > g.lastMs {
+		// Start the counter at a random value, leaving room to increment.
+		g.seq = binary.BigEndian.Uint16(id[6:8]) & (maxSeq >> 1)
+	} else {
+		ms = g.lastMs
+		g.seq++
+		if g.seq > maxSeq {
+			ms++
+			g.seq = 0
+		}
+	}
+	g.lastMs = ms
+	seq := g.seq
+	g.mu.Unlock()
+
+	// 48-bit big-endian Unix milliseconds.
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+
+	// Version 7 and 12-bit counter.
+	binary.BigEndian.PutUint16(id[6:8], 0x7000|seq)
+
+	// Variant 10 followed by random bits.
+	id[8] = 0x80 | id[8]&0x3F
+
+	return id, nil
+}
+
+// defaultGenerator is used by New.
+var defaultGenerator Generator
+
+// New returns a new ID using crypto/rand and time.Now.
+func New() (ID, error) {
+	return defaultGenerator.New()
+}
+
+// NewString returns the string form of a new ID.
+func NewString() (string, error) {
+	id, err := New()
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// String returns id in the standard form, e.g.,
+// "01906d3c-8a6b-7cde-9f01-23456789abcd".
+func (id ID) String() string {
+	var b [36]byte
+
+	hex.Encode(b[0:8], id[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], id[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], id[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], id[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], id[10:])
+
+	return string(b[:])
+}
+
+// Parse returns the ID in the standard form s. Only UUIDv7 is accepted.
+func Parse(s string) (ID, error) {
+	var id ID
+
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return Nil, ErrInvalid
+	}
+
+	dst := id[:]
+	for _, part := range []string{s[0:8], s[9:13], s[14:18], s[19:23], s[24:]} {
+		n, err := hex.Decode(dst, []byte(part))
+		if err != nil {
+			return Nil, ErrInvalid
+		}
+		dst = dst[n:]
+	}
+
+	if id.Version() != 7 || id[8]&0xC0 != 0x80 {
+		return Nil, ErrInvalid
+	}
+
+	return id, nil
+}
+
+// Version returns the UUID version of id.
+func (id ID) Version() int {
+	return int(id[6] >> 4)
+}
+
+// Time returns the time id was created, to the millisecond.
+func (id ID) Time() time.Time {
+	ms := int64(id[0])<<40 | int64(id[1])<<32 | int64(id[2])<<24 |
+		int64(id[3])<<16 | int64(id[4])<<8 | int64(id[5])
+
+	return time.UnixMilli(ms)
+}
+
+// IsZero returns true if id is Nil.
+func (id ID) IsZero() bool {
+	return id == Nil
+}
+
+// MarshalText returns the standard form of id.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText parses the standard form of an ID.
+func (id *ID) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*id = v
+
+	return nil
+}
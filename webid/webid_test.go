@@ -0,0 +1,117 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webid_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webid"
+	"github.com/bnixon67/webapp/webtest"
+)
+
+func TestGeneratorNew(t *testing.T) {
+	now := time.UnixMilli(1717243200123)
+	g := &webid.Generator{
+		Rand: webtest.NewSeqReader(0),
+		Now:  func() time.Time { return now },
+	}
+
+	var prev string
+	for i := 0; i < 5000; i++ {
+		id, err := g.New()
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if id.Version() != 7 {
+			t.Fatalf("Version() = %d, want 7", id.Version())
+		}
+
+		s := id.String()
+		if s <= prev {
+			t.Fatalf("ID %d %q not after %q", i, s, prev)
+		}
+		prev = s
+	}
+
+	// The counter overflowed into the next milliseconds.
+	last, err := webid.Parse(prev)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", prev, err)
+	}
+	if !last.Time().After(now) {
+		t.Errorf("Time() = %v, want after %v", last.Time(), now)
+	}
+}
+
+func TestGeneratorClockBackwards(t *testing.T) {
+	now := time.UnixMilli(1717243200123)
+	g := &webid.Generator{Now: func() time.Time { return now }}
+
+	first, err := g.New()
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	now = now.Add(-time.Second)
+	second, err := g.New()
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	if second.String() <= first.String() {
+		t.Errorf("ID %q after clock went backwards not after %q", second, first)
+	}
+}
+
+func TestParse(t *testing.T) {
+	id, err := webid.New()
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	got, err := webid.Parse(id.String())
+	if err != nil || got != id {
+		t.Errorf("Parse(%q) = %v, %v, want %v", id, got, err, id)
+	}
+
+	if d := time.Since(id.Time()); d < 0 || d > time.Minute {
+		t.Errorf("Time() = %v, want about now", id.Time())
+	}
+
+	for _, s := range []string{
+		"",
+		"not-an-id",
+		"01906d3c-8a6b-4cde-9f01-23456789abcd", // version 4
+		"01906d3c-8a6b-7cde-1f01-23456789abcd", // bad variant
+		"01906d3c-8a6b-7cde-9f01-23456789abcg", // not hex
+		"01906d3c8a6b-7cde-9f01-23456789abcd0",
+	} {
+		if _, err := webid.Parse(s); !errors.Is(err, webid.ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want %v", s, err, webid.ErrInvalid)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	id, err := webid.New()
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	b, err := json.Marshal(struct{ ID webid.ID }{id})
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	if want := `{"ID":"` + id.String() + `"}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+
+	var v struct{ ID webid.ID }
+	if err := json.Unmarshal(b, &v); err != nil || v.ID != id {
+		t.Errorf("Unmarshal() = %v, %v, want %v", v.ID, err, id)
+	}
+}
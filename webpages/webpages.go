@@ -0,0 +1,255 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webpages serves a directory of Markdown files as web pages,
+// such as About, Help, and Privacy pages, using the templates of an app
+// as layouts.
+//
+// A file can start with front matter between lines of "---", which has
+// "key: value" lines. The title key sets the title of the page and the
+// layout key names the template used to render it.
+package webpages
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Ext is the extension of Markdown files.
+const Ext = ".md"
+
+// DefaultLayout is the template of pages if neither the page nor Config
+// names one.
+const DefaultLayout = "page.html"
+
+// Config configures the Markdown pages.
+type Config struct {
+	Dir string // Dir is the directory of the Markdown files.
+
+	// Prefix is the route of the directory, so about.md is served at
+	// Prefix + "about". If empty, "/" is used.
+	Prefix string
+
+	// Routes maps routes to the names of files in Dir, to serve only
+	// those files at those routes instead of all files under Prefix.
+	Routes map[string]string
+
+	Layout string // Layout is the template of pages without one.
+}
+
+// Page is a Markdown page.
+type Page struct {
+	Name    string            // Name is the file name without Ext.
+	Title   string            // Title is from the front matter.
+	Layout  string            // Layout is the template of the page.
+	Meta    map[string]string // Meta has the other front matter keys.
+	Content template.HTML     // Content is the rendered Markdown.
+}
+
+// Pages are the Markdown pages by route.
+type Pages struct {
+	pages map[string]*Page
+}
+
+var (
+	ErrNoDir       = errors.New("no pages directory")
+	ErrFrontMatter = errors.New("invalid front matter")
+	ErrRoute       = errors.New("invalid route")
+)
+
+// markdown converts Markdown to HTML. Raw HTML in files is omitted, since
+// goldmark does not render it by default.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// Load reads and renders the Markdown pages of cfg.
+func Load(cfg Config) (*Pages, error) {
+	if cfg.Dir == "" {
+		return nil, ErrNoDir
+	}
+
+	layout := cfg.Layout
+	if layout == "" {
+		layout = DefaultLayout
+	}
+
+	routes := cfg.Routes
+	if len(routes) == 0 {
+		prefix := cfg.Prefix
+		if prefix == "" {
+			prefix = "/"
+		}
+		if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+			return nil, fmt.Errorf("%w: prefix %q must start and end with /", ErrRoute, prefix)
+		}
+
+		files, err := filepath.Glob(filepath.Join(cfg.Dir, "*"+Ext))
+		if err != nil {
+			return nil, err
+		}
+
+		routes = make(map[string]string, len(files))
+		for _, f := range files {
+			name := filepath.Base(f)
+			routes[prefix+strings.TrimSuffix(name, Ext)] = name
+		}
+	}
+
+	p := &Pages{pages: make(map[string]*Page, len(routes))}
+	for route, name := range routes {
+		if !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("%w: %q must start with /", ErrRoute, route)
+		}
+
+		src, err := os.ReadFile(filepath.Join(cfg.Dir, filepath.Base(name)))
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := Parse(strings.TrimSuffix(filepath.Base(name), Ext), src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if page.Layout == "" {
+			page.Layout = layout
+		}
+
+		p.pages[cleanRoute(route)] = page
+	}
+
+	return p, nil
+}
+
+// Parse returns the page named name with the Markdown and front matter
+// of src.
+func Parse(name string, src []byte) (*Page, error) {
+	page := &Page{Name: name, Meta: map[string]string{}}
+
+	body, err := page.parseFrontMatter(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Convert(body, &buf); err != nil {
+		return nil, err
+	}
+	page.Content = template.HTML(buf.String())
+
+	return page, nil
+}
+
+// parseFrontMatter sets the fields of page from the front matter of src,
+// if any, and returns the rest of src.
+func (page *Page) parseFrontMatter(src []byte) ([]byte, error) {
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+
+	rest, ok := bytes.CutPrefix(src, []byte("---\n"))
+	if !ok {
+		return src, nil
+	}
+
+	front, body, ok := bytes.Cut(rest, []byte("\n---\n"))
+	if !ok {
+		front, ok = bytes.CutSuffix(rest, []byte("\n---"))
+		if !ok {
+			return nil, fmt.Errorf("%w: no closing ---", ErrFrontMatter)
+		}
+	}
+
+	for _, line := range strings.Split(string(front), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not key: value", ErrFrontMatter, line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch key {
+		case "title":
+			page.Title = value
+		case "layout":
+			page.Layout = value
+		default:
+			page.Meta[key] = value
+		}
+	}
+
+	return body, nil
+}
+
+// cleanRoute returns route without extra slashes and dots, keeping a
+// trailing slash.
+func cleanRoute(route string) string {
+	clean := path.Clean(route)
+	if strings.HasSuffix(route, "/") && clean != "/" {
+		clean += "/"
+	}
+
+	return clean
+}
+
+// Routes returns the routes of the pages in order.
+func (p *Pages) Routes() []string {
+	routes := make([]string, 0, len(p.pages))
+	for route := range p.pages {
+		routes = append(routes, route)
+	}
+	slices.Sort(routes)
+
+	return routes
+}
+
+// Page returns the page at route, or nil if there is none.
+func (p *Pages) Page(route string) *Page {
+	return p.pages[route]
+}
+
+// RenderFunc renders page with its layout, which is the name of a
+// template.
+type RenderFunc func(w http.ResponseWriter, r *http.Request, page *Page)
+
+// AddRoutes adds a handler for each page to mux, which renders the page
+// with render.
+func (p *Pages) AddRoutes(mux *webhandler.Mux, render RenderFunc) {
+	for _, route := range p.Routes() {
+		page := p.pages[route]
+		pattern := "GET " + route
+		if strings.HasSuffix(route, "/") {
+			pattern += "{$}" // Match only the route, not the subtree.
+		}
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			render(w, r, page)
+		})
+	}
+}
+
+// TemplateRenderer returns a RenderFunc that executes the layout of the
+// page in tmpl with the page as data.
+func TemplateRenderer(tmpl *template.Template) RenderFunc {
+	return func(w http.ResponseWriter, r *http.Request, page *Page) {
+		logger := webhandler.RequestLogger(r)
+
+		err := webutil.RenderTemplateOrError(tmpl, w, page.Layout, page)
+		if err != nil {
+			logger.Error("unable to render page", "page", page.Name, "err", err)
+		}
+	}
+}
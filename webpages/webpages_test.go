@@ -0,0 +1,157 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webpages_test
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webpages"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		src         string
+		wantTitle   string
+		wantLayout  string
+		wantContent string
+		wantErr     error
+	}{
+		{
+			name:        "frontMatter",
+			src:         "---\ntitle: \"Privacy\"\nlayout: legal.html\n---\nText",
+			wantTitle:   "Privacy",
+			wantLayout:  "legal.html",
+			wantContent: "<p>Text</p>\n",
+		},
+		{
+			name:        "crlf",
+			src:         "---\r\ntitle: Privacy\r\n---\r\nText",
+			wantTitle:   "Privacy",
+			wantContent: "<p>Text</p>\n",
+		},
+		{
+			name:        "noFrontMatter",
+			src:         "Text\n\n---\n\nMore",
+			wantContent: "<p>Text</p>\n<hr>\n<p>More</p>\n",
+		},
+		{
+			name:        "onlyFrontMatter",
+			src:         "---\ntitle: Empty\n---",
+			wantTitle:   "Empty",
+			wantContent: "",
+		},
+		{
+			name:    "unclosed",
+			src:     "---\ntitle: Privacy\nText",
+			wantErr: webpages.ErrFrontMatter,
+		},
+		{
+			name:    "notKeyValue",
+			src:     "---\nPrivacy\n---\nText",
+			wantErr: webpages.ErrFrontMatter,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := webpages.Parse("privacy", []byte(tc.src))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if page.Title != tc.wantTitle || page.Layout != tc.wantLayout {
+				t.Errorf("Title, Layout = %q, %q, want %q, %q", page.Title, page.Layout, tc.wantTitle, tc.wantLayout)
+			}
+			if string(page.Content) != tc.wantContent {
+				t.Errorf("Content = %q, want %q", page.Content, tc.wantContent)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        webpages.Config
+		wantRoutes []string
+		wantErr    error
+	}{
+		{"all", webpages.Config{Dir: "testdata"}, []string{"/about", "/help"}, nil},
+		{"prefix", webpages.Config{Dir: "testdata", Prefix: "/pages/"}, []string{"/pages/about", "/pages/help"}, nil},
+		{"routes", webpages.Config{Dir: "testdata", Routes: map[string]string{"/info/": "about.md"}}, []string{"/info/"}, nil},
+		{"noDir", webpages.Config{}, nil, webpages.ErrNoDir},
+		{"badPrefix", webpages.Config{Dir: "testdata", Prefix: "pages"}, nil, webpages.ErrRoute},
+		{"badRoute", webpages.Config{Dir: "testdata", Routes: map[string]string{"info": "about.md"}}, nil, webpages.ErrRoute},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pages, err := webpages.Load(tc.cfg)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && !slices.Equal(pages.Routes(), tc.wantRoutes) {
+				t.Errorf("Routes() = %q, want %q", pages.Routes(), tc.wantRoutes)
+			}
+		})
+	}
+
+	if _, err := webpages.Load(webpages.Config{Dir: "testdata", Routes: map[string]string{"/x": "missing.md"}}); err == nil {
+		t.Error("Load() with missing file succeeded")
+	}
+}
+
+func TestAddRoutes(t *testing.T) {
+	pages, err := webpages.Load(webpages.Config{Dir: "testdata"})
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	tmpl := template.Must(template.ParseFiles("testdata/layout.html"))
+	mux := webhandler.NewMux()
+	pages.AddRoutes(mux, webpages.TemplateRenderer(tmpl))
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       []string
+		notWant    []string
+	}{
+		{"/about", http.StatusOK, []string{"<h1>About Us</h1>", "<strong>this</strong>", "<p>ops</p>"}, []string{"title:"}},
+		{"/help", http.StatusOK, []string{"<title></title>", `<a href="/faq">FAQ</a>`}, []string{"<script>"}},
+		{"/about/more", http.StatusNotFound, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			body := w.Body.String()
+			for _, s := range tc.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("body %q does not contain %q", body, s)
+				}
+			}
+			for _, s := range tc.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("body %q contains %q", body, s)
+				}
+			}
+		})
+	}
+}
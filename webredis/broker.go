@@ -0,0 +1,116 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bnixon67/webapp/websse"
+)
+
+// brokerRetry is how long Run waits to subscribe again after an error.
+const brokerRetry = time.Second
+
+// envelope is a message published by a Broker.
+type envelope struct {
+	From    string         // From is the ID of the Broker that published it.
+	Message websse.Message // Message to publish to the local clients.
+}
+
+// Broker relays websse messages between the instances of an app with the
+// PUBLISH and SUBSCRIBE commands, so the clients of every instance get the
+// messages published on any instance. It implements websse.Publisher.
+type Broker struct {
+	client  *Client
+	local   websse.Publisher // local publishes to the clients of this instance.
+	channel string
+	id      string // id identifies this Broker, so it ignores its own messages.
+}
+
+// NewBroker returns a Broker that publishes messages to local, which is
+// usually a websse.Server, and to other instances on channel. Run must be
+// called to get the messages of other instances.
+func NewBroker(c *Client, local websse.Publisher, channel string) *Broker {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &Broker{client: c, local: local, channel: channel, id: hex.EncodeToString(id)}
+}
+
+// Publish publishes msg to the local clients, waiting if they are busy,
+// and to other instances.
+func (b *Broker) Publish(msg websse.Message) error {
+	if err := b.local.Publish(msg); err != nil {
+		return err
+	}
+
+	return b.relay(msg)
+}
+
+// TryPublish is like Publish, but returns websse.ErrBusy instead of waiting
+// for the local clients.
+func (b *Broker) TryPublish(msg websse.Message) error {
+	if err := b.local.TryPublish(msg); err != nil {
+		return err
+	}
+
+	return b.relay(msg)
+}
+
+// relay publishes msg to other instances.
+func (b *Broker) relay(msg websse.Message) error {
+	data, err := json.Marshal(envelope{From: b.id, Message: msg})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.client.Do(context.Background(), "PUBLISH", b.client.Key(b.channel), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to relay message: %w", err)
+	}
+
+	return nil
+}
+
+// Run publishes the messages of other instances to the local clients until
+// ctx is done. If the subscription fails, such as when Redis restarts, it
+// subscribes again, and messages published in the meantime are lost.
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		err := b.client.Subscribe(ctx, b.channel, b.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("broker subscription failed", "channel", b.channel, "err", err)
+
+		select {
+		case <-time.After(brokerRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive publishes the message of payload to the local clients, unless
+// it was published by b.
+func (b *Broker) receive(payload string) {
+	var e envelope
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		slog.Warn("invalid broker message", "channel", b.channel, "err", err)
+		return
+	}
+	if e.From == b.id {
+		return
+	}
+
+	if err := b.local.TryPublish(e.Message); err != nil {
+		slog.Warn("failed to publish broker message", "channel", b.channel, "event", e.Message.Event, "err", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webredis"
+	"github.com/bnixon67/webapp/websse"
+)
+
+// recorder is a websse.Publisher that sends messages to a channel.
+type recorder chan websse.Message
+
+func (r recorder) Publish(msg websse.Message) error {
+	r <- msg
+	return nil
+}
+
+func (r recorder) TryPublish(msg websse.Message) error {
+	return r.Publish(msg)
+}
+
+// receive returns the next message of r, or fails the test after a while.
+func (r recorder) receive(t *testing.T) websse.Message {
+	t.Helper()
+
+	select {
+	case msg := <-r:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+
+	return websse.Message{}
+}
+
+func TestBroker(t *testing.T) {
+	s := serverForTest(t)
+
+	local, remote := make(recorder, 10), make(recorder, 10)
+	a := webredis.NewBroker(clientForTest(t, s, webredis.Config{}), local, "live")
+	b := webredis.NewBroker(clientForTest(t, s, webredis.Config{}), remote, "live")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+	go b.Run(ctx)
+
+	// Publish until b is subscribed, which drops earlier messages.
+	want := websse.Message{Event: "events", Data: "hello"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := a.Publish(want); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if got := local.receive(t); got != want {
+			t.Fatalf("local message = %v, want %v", got, want)
+		}
+
+		select {
+		case got := <-remote:
+			if got != want {
+				t.Errorf("remote message = %v, want %v", got, want)
+			}
+			// a does not get its own message again.
+			select {
+			case msg := <-local:
+				t.Errorf("local got relayed message %v", msg)
+			case <-time.After(50 * time.Millisecond):
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("message not relayed")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Cache is a cache of values of type V by string keys, which are stored
+// in Redis as JSON, so they are shared by the instances of an app. It
+// implements webcache.Store.
+//
+// Since a cache is only an optimization, the errors of Redis are logged
+// rather than returned, and GetOrLoad calls load if Redis fails.
+type Cache[V any] struct {
+	client *Client
+	prefix string        // prefix of the keys of the cache.
+	ttl    time.Duration // ttl is zero if values do not expire.
+}
+
+// NewCache returns a Cache named name that stores values in c for ttl. If
+// ttl is zero or negative, values do not expire.
+func NewCache[V any](c *Client, name string, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{client: c, prefix: c.Key("cache:" + name + ":"), ttl: ttl}
+}
+
+// Get returns the value of key, and true if it was found.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	v, ok, err := c.get(context.Background(), key)
+	if err != nil {
+		slog.Warn("failed to get from redis cache", "key", c.prefix+key, "err", err)
+	}
+
+	return v, ok
+}
+
+// get returns the value of key, and true if it was found.
+func (c *Cache[V]) get(ctx context.Context, key string) (V, bool, error) {
+	var v V
+
+	data, err := c.client.String(ctx, "GET", c.prefix+key)
+	if errors.Is(err, ErrNil) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return v, false, err
+	}
+
+	return v, true, nil
+}
+
+// Set caches value for key, replacing any value it had.
+func (c *Cache[V]) Set(key string, value V) {
+	if err := c.set(context.Background(), key, value); err != nil {
+		slog.Warn("failed to set in redis cache", "key", c.prefix+key, "err", err)
+	}
+}
+
+// set caches value for key.
+func (c *Cache[V]) set(ctx context.Context, key string, value V) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"SET", c.prefix + key, string(data)}
+	if c.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(c.ttl.Milliseconds(), 1), 10))
+	}
+	_, err = c.client.Do(ctx, args...)
+
+	return err
+}
+
+// Delete removes the value of key.
+func (c *Cache[V]) Delete(key string) {
+	if _, err := c.client.Do(context.Background(), "DEL", c.prefix+key); err != nil {
+		slog.Warn("failed to delete from redis cache", "key", c.prefix+key, "err", err)
+	}
+}
+
+// Clear removes all values of the cache.
+func (c *Cache[V]) Clear() {
+	ctx := context.Background()
+
+	keys, err := c.client.Keys(ctx, c.prefix+"*")
+	if err == nil && len(keys) > 0 {
+		_, err = c.client.Do(ctx, append([]string{"DEL"}, keys...)...)
+	}
+	if err != nil {
+		slog.Warn("failed to clear redis cache", "prefix", c.prefix, "err", err)
+	}
+}
+
+// GetOrLoad returns the value of key, calling load to get and cache it if
+// it is not cached. Errors of load are returned but not cached.
+//
+// Unlike webcache.Cache, concurrent calls for the same key are not
+// combined, since they may be on different instances.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, load func(context.Context) (V, error)) (V, error) {
+	v, ok, err := c.get(ctx, key)
+	if err != nil {
+		slog.Warn("failed to get from redis cache", "key", c.prefix+key, "err", err)
+	}
+	if ok {
+		return v, nil
+	}
+
+	v, err = load(ctx)
+	if err != nil {
+		return v, err
+	}
+
+	if err := c.set(ctx, key, v); err != nil {
+		slog.Warn("failed to set in redis cache", "key", c.prefix+key, "err", err)
+	}
+
+	return v, nil
+}
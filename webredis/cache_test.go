@@ -0,0 +1,110 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webcache"
+	"github.com/bnixon67/webapp/webredis"
+)
+
+type item struct {
+	Name  string
+	Count int
+}
+
+func TestCache(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{})
+
+	var cache webcache.Store[string, item] = webredis.NewCache[item](c, "items", time.Minute)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Get() of missing key found a value")
+	}
+
+	cache.Set("a", item{Name: "a", Count: 1})
+	if got, ok := cache.Get("a"); !ok || got != (item{Name: "a", Count: 1}) {
+		t.Errorf("Get() = %v, %v, want %v, true", got, ok, item{Name: "a", Count: 1})
+	}
+
+	// Another instance shares the values.
+	other := webredis.NewCache[item](c, "items", time.Minute)
+	if _, ok := other.Get("a"); !ok {
+		t.Error("Get() of other cache did not find the value")
+	}
+
+	cache.Delete("a")
+	if _, ok := other.Get("a"); ok {
+		t.Error("Get() after Delete found a value")
+	}
+
+	cache.Set("b", item{Name: "b"})
+	cache.Set("c", item{Name: "c"})
+	cache.Clear()
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Get() after Clear found a value")
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{})
+	cache := webredis.NewCache[item](c, "items", time.Minute)
+	ctx := context.Background()
+
+	loads := 0
+	load := func(context.Context) (item, error) {
+		loads++
+		return item{Name: "x", Count: loads}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.GetOrLoad(ctx, "x", load)
+		if err != nil || got != (item{Name: "x", Count: 1}) {
+			t.Errorf("GetOrLoad() = %v, %v, want cached value", got, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+
+	errLoad := errors.New("load failed")
+	_, err := cache.GetOrLoad(ctx, "y", func(context.Context) (item, error) { return item{}, errLoad })
+	if !errors.Is(err, errLoad) {
+		t.Errorf("GetOrLoad() error = %v, want %v", err, errLoad)
+	}
+	if _, ok := cache.Get("y"); ok {
+		t.Error("error of load was cached")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{})
+	cache := webredis.NewCache[item](c, "items", 10*time.Millisecond)
+
+	cache.Set("a", item{Name: "a"})
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Get() after TTL found a value")
+	}
+}
+
+func TestCacheUnavailable(t *testing.T) {
+	s := serverForTest(t)
+	c := clientForTest(t, s, webredis.Config{Timeout: "100ms"})
+	s.Close()
+
+	cache := webredis.NewCache[item](c, "items", time.Minute)
+
+	got, err := cache.GetOrLoad(context.Background(), "a", func(context.Context) (item, error) {
+		return item{Name: "a"}, nil
+	})
+	if err != nil || got.Name != "a" {
+		t.Errorf("GetOrLoad() = %v, %v, want loaded value", got, err)
+	}
+}
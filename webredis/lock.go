@@ -0,0 +1,26 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// TryLock acquires the lock of name for ttl and returns true, or returns
+// false if the lock is held. A lock is not released early, so a job that
+// runs while holding it runs at most once per ttl across the clients of
+// the server.
+func (c *Client) TryLock(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	ms := strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+
+	_, err := c.String(ctx, "SET", c.Key("lock:"+name), "1", "NX", "PX", ms)
+	if errors.Is(err, ErrNil) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
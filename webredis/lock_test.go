@@ -0,0 +1,35 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webredis"
+)
+
+func TestTryLock(t *testing.T) {
+	s := serverForTest(t)
+	a := clientForTest(t, s, webredis.Config{Prefix: "app:"})
+	b := clientForTest(t, s, webredis.Config{Prefix: "app:"})
+	ctx := context.Background()
+
+	tryLock := func(c *webredis.Client, name string, want bool) {
+		t.Helper()
+		if got, err := c.TryLock(ctx, name, 50*time.Millisecond); err != nil || got != want {
+			t.Errorf("TryLock(%q) = %v, %v, want %v, nil", name, got, err, want)
+		}
+	}
+
+	tryLock(a, "job", true)
+	tryLock(b, "job", false)
+	tryLock(a, "job", false)
+	tryLock(b, "other", true)
+
+	// The lock is released when its ttl expires.
+	time.Sleep(100 * time.Millisecond)
+	tryLock(b, "job", true)
+}
@@ -0,0 +1,495 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package redistest provides an in-memory Redis server for tests of
+// packages that use webredis, like net/http/httptest does for HTTP.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bnixon67/webapp/webredis"
+)
+
+// Server is an in-memory server for tests that supports the commands
+// used by webredis: PING, AUTH, SELECT, GET, MGET, SET with NX and PX,
+// DEL, INCR, PEXPIRE, HGET, HSET, HDEL, HLEN, HEXISTS, SCAN, PUBLISH, and
+// SUBSCRIBE.
+// SCAN returns all keys at once, and its MATCH only supports a trailing *.
+type Server struct {
+	Password string // Password required by AUTH, if set before use.
+
+	ln net.Listener
+
+	mu       sync.Mutex
+	strings  map[string]string
+	hashes   map[string]map[string]string
+	expires  map[string]time.Time
+	subs     map[string][]*testConn
+	conns    map[*testConn]struct{}
+	accepted int
+}
+
+// testConn is a connection to a Server.
+type testConn struct {
+	net.Conn
+	mu   sync.Mutex // mu serializes writes, such as of published messages.
+	w    *bufio.Writer
+	auth bool
+}
+
+// NewServer returns a Server listening on a local address.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:      ln,
+		strings: make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		expires: make(map[string]time.Time),
+		subs:    make(map[string][]*testConn),
+		conns:   make(map[*testConn]struct{}),
+	}
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns the address of s for Config.Addr.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Accepted returns the number of connections accepted by s.
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// Close stops s from accepting connections and closes its connections,
+// like a server that was shut down.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+
+	return err
+}
+
+// serve accepts connections until s is closed.
+func (s *Server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &testConn{Conn: nc, w: bufio.NewWriter(nc)}
+
+		s.mu.Lock()
+		s.accepted++
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(c)
+	}
+}
+
+// handle runs the commands of c until it is closed.
+func (s *Server) handle(c *testConn) {
+	defer s.remove(c)
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		reply := s.do(c, args)
+
+		c.mu.Lock()
+		writeReply(c.w, reply)
+		err = c.w.Flush()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// remove removes c from the connections and subscribers of s.
+func (s *Server) remove(c *testConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, c)
+
+	for channel, conns := range s.subs {
+		s.subs[channel] = slices.DeleteFunc(conns, func(sub *testConn) bool { return sub == c })
+	}
+}
+
+// readCommand reads a RESP array of bulk strings from r, the form of
+// every command sent by webredis.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 || size > maxBulkLen {
+			return nil, fmt.Errorf("%w: bad length %d", webredis.ErrProtocol, size)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
+
+// maxBulkLen is the maximum length of a bulk string, as in Redis.
+const maxBulkLen = 512 << 20
+
+// readLength reads a line of r with the prefix and returns its length.
+func readLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 4 || line[0] != prefix || line[len(line)-2] != '\r' {
+		return 0, fmt.Errorf("%w: bad line %q", webredis.ErrProtocol, line)
+	}
+
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad line %q", webredis.ErrProtocol, line)
+	}
+
+	return n, nil
+}
+
+// writeReply writes v to w as RESP.
+func writeReply(w *bufio.Writer, v any) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case webredis.Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", string(v))
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+// status is a simple string reply.
+type status string
+
+// errArgs is the reply to a command with the wrong number of arguments.
+const errArgs = webredis.Error("ERR wrong number of arguments")
+
+// expire removes key if it expired. The caller must hold s.mu.
+func (s *Server) expire(key string) {
+	if t, ok := s.expires[key]; ok && !time.Now().Before(t) {
+		delete(s.strings, key)
+		delete(s.hashes, key)
+		delete(s.expires, key)
+	}
+}
+
+// exists returns true if key has a value. The caller must hold s.mu.
+func (s *Server) exists(key string) bool {
+	s.expire(key)
+	_, isString := s.strings[key]
+	_, isHash := s.hashes[key]
+
+	return isString || isHash
+}
+
+// do returns the reply to the command of args on c.
+func (s *Server) do(c *testConn, args []string) any {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cmd == "AUTH" {
+		if len(args) != 1 {
+			return errArgs
+		}
+		if args[0] != s.Password {
+			return webredis.Error("WRONGPASS invalid password")
+		}
+		c.auth = true
+		return status("OK")
+	}
+	if s.Password != "" && !c.auth {
+		return webredis.Error("NOAUTH Authentication required.")
+	}
+
+	switch cmd {
+	case "PING":
+		return status("PONG")
+
+	case "SELECT":
+		return status("OK")
+
+	case "GET":
+		if len(args) != 1 {
+			return errArgs
+		}
+		s.expire(args[0])
+		if v, ok := s.strings[args[0]]; ok {
+			return v
+		}
+		return nil
+
+	case "MGET":
+		values := make([]any, len(args))
+		for i, key := range args {
+			s.expire(key)
+			if v, ok := s.strings[key]; ok {
+				values[i] = v
+			}
+		}
+		return values
+
+	case "SET":
+		if len(args) < 2 {
+			return errArgs
+		}
+		key := args[0]
+		var (
+			nx      bool
+			expires time.Time
+		)
+		for opts := args[2:]; len(opts) > 0; opts = opts[1:] {
+			switch strings.ToUpper(opts[0]) {
+			case "NX":
+				nx = true
+			case "PX":
+				if len(opts) < 2 {
+					return webredis.Error("ERR syntax error")
+				}
+				ms, err := strconv.Atoi(opts[1])
+				if err != nil || ms <= 0 {
+					return webredis.Error("ERR syntax error")
+				}
+				expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				opts = opts[1:]
+			default:
+				return webredis.Error("ERR syntax error")
+			}
+		}
+		if nx && s.exists(key) {
+			return nil
+		}
+		delete(s.hashes, key)
+		delete(s.expires, key)
+		s.strings[key] = args[1]
+		if !expires.IsZero() {
+			s.expires[key] = expires
+		}
+		return status("OK")
+
+	case "DEL":
+		n := 0
+		for _, key := range args {
+			if s.exists(key) {
+				n++
+			}
+			delete(s.strings, key)
+			delete(s.hashes, key)
+			delete(s.expires, key)
+		}
+		return n
+
+	case "INCR":
+		if len(args) != 1 {
+			return errArgs
+		}
+		s.expire(args[0])
+		n := 0
+		if v, ok := s.strings[args[0]]; ok {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil {
+				return webredis.Error("ERR value is not an integer or out of range")
+			}
+		}
+		n++
+		s.strings[args[0]] = strconv.Itoa(n)
+		return n
+
+	case "PEXPIRE":
+		if len(args) != 2 {
+			return errArgs
+		}
+		ms, err := strconv.Atoi(args[1])
+		if err != nil {
+			return webredis.Error("ERR value is not an integer or out of range")
+		}
+		if !s.exists(args[0]) {
+			return 0
+		}
+		s.expires[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		s.expire(args[0])
+		return 1
+
+	case "HGET", "HEXISTS":
+		if len(args) != 2 {
+			return errArgs
+		}
+		s.expire(args[0])
+		v, ok := s.hashes[args[0]][args[1]]
+		if cmd == "HEXISTS" {
+			if ok {
+				return 1
+			}
+			return 0
+		}
+		if !ok {
+			return nil
+		}
+		return v
+
+	case "HSET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return errArgs
+		}
+		s.expire(args[0])
+		if _, ok := s.strings[args[0]]; ok {
+			return webredis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		h := s.hashes[args[0]]
+		if h == nil {
+			h = make(map[string]string)
+			s.hashes[args[0]] = h
+		}
+		n := 0
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := h[args[i]]; !ok {
+				n++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return n
+
+	case "HDEL":
+		if len(args) < 2 {
+			return errArgs
+		}
+		s.expire(args[0])
+		h := s.hashes[args[0]]
+		n := 0
+		for _, field := range args[1:] {
+			if _, ok := h[field]; ok {
+				delete(h, field)
+				n++
+			}
+		}
+		if h != nil && len(h) == 0 {
+			delete(s.hashes, args[0])
+			delete(s.expires, args[0])
+		}
+		return n
+
+	case "HLEN":
+		if len(args) != 1 {
+			return errArgs
+		}
+		s.expire(args[0])
+		return len(s.hashes[args[0]])
+
+	case "SCAN":
+		pattern := "*"
+		for i := 1; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+		var keys []any
+		match := func(key string) {
+			if s.exists(key) && matchPattern(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		for key := range s.strings {
+			match(key)
+		}
+		for key := range s.hashes {
+			match(key)
+		}
+		return []any{"0", keys}
+
+	case "PUBLISH":
+		if len(args) != 2 {
+			return errArgs
+		}
+		conns := s.subs[args[0]]
+		for _, sub := range conns {
+			sub.mu.Lock()
+			writeReply(sub.w, []any{"message", args[0], args[1]})
+			sub.w.Flush()
+			sub.mu.Unlock()
+		}
+		return len(conns)
+
+	case "SUBSCRIBE":
+		if len(args) != 1 {
+			return errArgs
+		}
+		s.subs[args[0]] = append(s.subs[args[0]], c)
+		return []any{"subscribe", args[0], 1}
+	}
+
+	return webredis.Error(fmt.Sprintf("ERR unknown command '%s'", cmd))
+}
+
+// matchPattern returns true if key matches pattern, which is a key or a
+// prefix followed by *.
+func matchPattern(pattern, key string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+
+	return key == pattern
+}
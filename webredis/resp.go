@@ -0,0 +1,110 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Error is an error reply from the server, such as for a wrong command.
+// The connection can still be used after an Error.
+type Error string
+
+// Error returns the message of the reply.
+func (e Error) Error() string {
+	return "webredis: " + string(e)
+}
+
+var ErrProtocol = errors.New("webredis: protocol error")
+
+// maxBulkLen is the largest bulk string that is read, which is the limit
+// of the server.
+const maxBulkLen = 512 << 20
+
+// writeCommand writes args to w as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return w.Flush()
+}
+
+// readLine returns the next line of r without the CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("%w: bad line %q", ErrProtocol, line)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// readReply reads a RESP reply from r. A simple or bulk string is returned
+// as a string, an integer as an int64, an array as a []any, and a null as
+// nil. An error reply is returned as an Error.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad integer %q", ErrProtocol, line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxBulkLen {
+			return nil, fmt.Errorf("%w: bad length %q", ErrProtocol, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad length %q", ErrProtocol, line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		array := make([]any, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			v, err := readReply(r)
+			if err != nil {
+				// An error reply in an array does not end the reply.
+				var e Error
+				if !errors.As(err, &e) {
+					return nil, err
+				}
+				v = e
+			}
+			array = append(array, v)
+		}
+		return array, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown reply %q", ErrProtocol, line)
+}
@@ -0,0 +1,407 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webredis provides a Redis client with a pool of connections, and
+// adapters that keep the state of an app in Redis, so it is shared by
+// the instances of the app: a Cache that implements webcache.Store, and a
+// Broker that relays websse messages between servers. The session values
+// and rate limits of webauth are kept in Redis by webauth when Config.Redis
+// is set.
+//
+// The client speaks RESP2 and only needs the standard library.
+package webredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of Config.
+const (
+	DefaultPoolSize = 10
+	DefaultTimeout  = 5 * time.Second
+)
+
+// Config holds the settings of a Client.
+type Config struct {
+	Addr     string // Addr is the host:port of the server. Redis is not used if empty.
+	Password string // Password to AUTH with, if any.
+	DB       int    // DB is the number of the database to SELECT.
+	PoolSize int    // PoolSize is the most open connections, or DefaultPoolSize if zero.
+	Timeout  string // Timeout of dials and commands, or DefaultTimeout if empty.
+	Prefix   string // Prefix of keys and channels, so apps can share a server.
+}
+
+// Enabled returns true if c has an Addr.
+func (c Config) Enabled() bool {
+	return c.Addr != ""
+}
+
+var (
+	ErrNil    = errors.New("webredis: nil reply")
+	ErrClosed = errors.New("webredis: client closed")
+)
+
+// conn is a connection to the server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Client is a Redis client. It is safe for concurrent use, and uses up to
+// Config.PoolSize connections, which are reused.
+type Client struct {
+	cfg     Config
+	timeout time.Duration
+
+	sem    chan struct{} // sem has a value for each connection in use.
+	idle   chan *conn    // idle are connections that can be reused.
+	closed atomic.Bool
+}
+
+// New returns a Client for cfg. Connections are opened when needed, so an
+// unavailable server is reported by commands and Check, not by New.
+func New(cfg Config) (*Client, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("no Redis.Addr")
+	}
+	if cfg.PoolSize < 0 {
+		return nil, fmt.Errorf("negative Redis.PoolSize %d", cfg.PoolSize)
+	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = DefaultPoolSize
+	}
+	if cfg.DB < 0 {
+		return nil, fmt.Errorf("negative Redis.DB %d", cfg.DB)
+	}
+
+	timeout := DefaultTimeout
+	if cfg.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis.Timeout: %w", err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("non-positive Redis.Timeout %q", cfg.Timeout)
+		}
+	}
+
+	return &Client{
+		cfg:     cfg,
+		timeout: timeout,
+		sem:     make(chan struct{}, cfg.PoolSize),
+		idle:    make(chan *conn, cfg.PoolSize),
+	}, nil
+}
+
+// Key returns name with the Config.Prefix of c.
+func (c *Client) Key(name string) string {
+	return c.cfg.Prefix + name
+}
+
+// dial opens a connection, and authenticates and selects the database of
+// the config.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.timeout}
+	nc, err := d.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if c.cfg.Password != "" {
+		setup = append(setup, []string{"AUTH", c.cfg.Password})
+	}
+	if c.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.cfg.DB)})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(ctx, cn, args); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+
+	return cn, nil
+}
+
+// get returns a connection from the pool, or a new connection if none are
+// idle. It waits for a connection to be put back if PoolSize are in use.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.sem
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// put returns cn to the pool, or closes it if it is broken.
+func (c *Client) put(cn *conn, broken bool) {
+	defer func() { <-c.sem }()
+
+	if broken || c.closed.Load() {
+		cn.Close()
+		return
+	}
+
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// roundTrip sends args on cn and reads the reply, within the timeout of c
+// and the deadline of ctx.
+func (c *Client) roundTrip(ctx context.Context, cn *conn, args []string) (any, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	cn.SetDeadline(deadline)
+
+	// End the round trip at once if ctx is canceled.
+	stop := context.AfterFunc(ctx, func() { cn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := writeCommand(cn.w, args); err != nil {
+		return nil, err
+	}
+
+	return readReply(cn.r)
+}
+
+// Do sends the command of args and returns the reply, as described by
+// readReply. An error reply from the server is returned as an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(ctx, cn, args)
+
+	// The connection is in an unknown state after other errors.
+	var e Error
+	c.put(cn, err != nil && !errors.As(err, &e))
+
+	if err == nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return reply, err
+}
+
+// String is like Do for a command that returns a string. ErrNil is
+// returned for a null reply, such as GET of a missing key.
+func (c *Client) String(ctx context.Context, args ...string) (string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := reply.(type) {
+	case nil:
+		return "", ErrNil
+	case string:
+		return v, nil
+	}
+
+	return "", fmt.Errorf("%w: %s returned %T", ErrProtocol, args[0], reply)
+}
+
+// Int is like Do for a command that returns an integer.
+func (c *Client) Int(ctx context.Context, args ...string) (int64, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	v, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s returned %T", ErrProtocol, args[0], reply)
+	}
+
+	return v, nil
+}
+
+// Strings is like Do for a command that returns an array of strings. Null
+// elements are returned as empty strings.
+func (c *Client) Strings(ctx context.Context, args ...string) ([]string, error) {
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(args[0], reply)
+}
+
+// toStrings returns reply, the reply to cmd, as strings.
+func toStrings(cmd string, reply any) ([]string, error) {
+	array, ok := reply.([]any)
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("%w: %s returned %T", ErrProtocol, cmd, reply)
+	}
+
+	s := make([]string, len(array))
+	for i, v := range array {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			s[i] = v
+		default:
+			return nil, fmt.Errorf("%w: %s returned %T", ErrProtocol, cmd, v)
+		}
+	}
+
+	return s, nil
+}
+
+// Keys returns the keys that match pattern, using SCAN so the server is
+// not blocked by a large database.
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+
+	cursor := "0"
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+
+		array, ok := reply.([]any)
+		if !ok || len(array) != 2 {
+			return nil, fmt.Errorf("%w: SCAN returned %v", ErrProtocol, reply)
+		}
+		cursor, ok = array[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: SCAN returned cursor %v", ErrProtocol, array[0])
+		}
+		page, err := toStrings("SCAN", array[1])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+
+		if cursor == "0" {
+			return keys, nil
+		}
+	}
+}
+
+// Check returns an error if the server does not reply to PING. This allows
+// the client to be used as a health check.
+func (c *Client) Check(ctx context.Context) error {
+	reply, err := c.String(ctx, "PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: PING returned %q", ErrProtocol, reply)
+	}
+
+	return nil
+}
+
+// Close closes the idle connections, and connections in use when they are
+// done. Commands after Close return ErrClosed.
+func (c *Client) Close() error {
+	if c == nil || c.closed.Swap(true) {
+		return nil
+	}
+
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Subscribe calls handle with the payload of each message published to
+// channel, which does not have the Prefix, until ctx is done or the
+// connection fails. It uses its own connection, since a subscribed
+// connection cannot send other commands.
+//
+// ctx.Err() is returned when ctx is done.
+func (c *Client) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer cn.Close()
+
+	// Unblock the read of the next message when ctx is done.
+	stop := context.AfterFunc(ctx, func() { cn.SetDeadline(time.Now()) })
+	defer stop()
+
+	cn.SetDeadline(time.Now().Add(c.timeout))
+	if err := writeCommand(cn.w, []string{"SUBSCRIBE", c.Key(channel)}); err != nil {
+		return err
+	}
+
+	for {
+		reply, err := readReply(cn.r)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+
+		array, ok := reply.([]any)
+		if !ok || len(array) != 3 {
+			return fmt.Errorf("%w: SUBSCRIBE returned %v", ErrProtocol, reply)
+		}
+
+		switch array[0] {
+		case "subscribe":
+			// Wait for messages without a deadline, unless ctx was
+			// done before it was cleared.
+			cn.SetDeadline(time.Time{})
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+		case "message":
+			payload, ok := array[2].(string)
+			if !ok {
+				return fmt.Errorf("%w: message of %T", ErrProtocol, array[2])
+			}
+			handle(payload)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webredis_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webredis"
+	"github.com/bnixon67/webapp/webredis/redistest"
+)
+
+// serverForTest returns a redistest.Server that is closed when the test ends.
+func serverForTest(t *testing.T) *redistest.Server {
+	t.Helper()
+
+	s, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// clientForTest returns a Client of s that is closed when the test ends.
+func clientForTest(t *testing.T, s *redistest.Server, cfg webredis.Config) *webredis.Client {
+	t.Helper()
+
+	cfg.Addr = s.Addr()
+	c, err := webredis.New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  webredis.Config
+	}{
+		{"NoAddr", webredis.Config{}},
+		{"NegativePoolSize", webredis.Config{Addr: "localhost:6379", PoolSize: -1}},
+		{"NegativeDB", webredis.Config{Addr: "localhost:6379", DB: -1}},
+		{"InvalidTimeout", webredis.Config{Addr: "localhost:6379", Timeout: "soon"}},
+		{"ZeroTimeout", webredis.Config{Addr: "localhost:6379", Timeout: "0s"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := webredis.New(tc.cfg); err == nil {
+				t.Errorf("New(%+v) error = nil, want error", tc.cfg)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{DB: 1})
+	ctx := context.Background()
+
+	if _, err := c.String(ctx, "GET", "k"); !errors.Is(err, webredis.ErrNil) {
+		t.Errorf("GET missing key error = %v, want %v", err, webredis.ErrNil)
+	}
+
+	if _, err := c.Do(ctx, "SET", "k", "v"); err != nil {
+		t.Fatalf("SET error = %v", err)
+	}
+	if got, err := c.String(ctx, "GET", "k"); err != nil || got != "v" {
+		t.Errorf("GET = %q, %v, want %q, nil", got, err, "v")
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		if got, err := c.Int(ctx, "INCR", "n"); err != nil || got != want {
+			t.Errorf("INCR = %d, %v, want %d, nil", got, err, want)
+		}
+	}
+
+	// An error reply does not break the connection.
+	_, err := c.Do(ctx, "INCR", "k")
+	var e webredis.Error
+	if !errors.As(err, &e) {
+		t.Errorf("INCR of string error = %v, want Error", err)
+	}
+	if err := c.Check(ctx); err != nil {
+		t.Errorf("Check() after error reply = %v", err)
+	}
+}
+
+func TestClientPool(t *testing.T) {
+	s := serverForTest(t)
+	c := clientForTest(t, s, webredis.Config{PoolSize: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Check(context.Background()); err != nil {
+				t.Errorf("Check() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := s.Accepted(); got < 1 || got > 2 {
+		t.Errorf("connections = %d, want 1 to 2", got)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	s := serverForTest(t)
+	s.Password = "secret"
+
+	bad := clientForTest(t, s, webredis.Config{Password: "wrong"})
+	if err := bad.Check(context.Background()); err == nil {
+		t.Error("Check() with wrong password = nil, want error")
+	}
+
+	good := clientForTest(t, s, webredis.Config{Password: "secret"})
+	if err := good.Check(context.Background()); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	s := serverForTest(t)
+	c := clientForTest(t, s, webredis.Config{})
+
+	if err := c.Check(context.Background()); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+
+	c.Close()
+	if err := c.Check(context.Background()); !errors.Is(err, webredis.ErrClosed) {
+		t.Errorf("Check() after Close = %v, want %v", err, webredis.ErrClosed)
+	}
+
+	s.Close()
+	other := clientForTest(t, s, webredis.Config{Timeout: "100ms"})
+	if err := other.Check(context.Background()); err == nil {
+		t.Error("Check() of closed server = nil, want error")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{Prefix: "app:"})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Do(ctx, "SET", c.Key("a:"+strconv.Itoa(i)), "v"); err != nil {
+			t.Fatalf("SET error = %v", err)
+		}
+	}
+	if _, err := c.Do(ctx, "SET", c.Key("b"), "v"); err != nil {
+		t.Fatalf("SET error = %v", err)
+	}
+
+	keys, err := c.Keys(ctx, c.Key("a:*"))
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	slices.Sort(keys)
+
+	want := []string{"app:a:0", "app:a:1", "app:a:2"}
+	if !slices.Equal(keys, want) {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c := clientForTest(t, serverForTest(t), webredis.Config{Prefix: "app:"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 1)
+	done := make(chan error)
+	go func() {
+		done <- c.Subscribe(ctx, "news", func(payload string) { got <- payload })
+	}()
+
+	// Publish until the subscription is ready.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, err := c.Int(context.Background(), "PUBLISH", c.Key("news"), "hello")
+		if err != nil {
+			t.Fatalf("PUBLISH error = %v", err)
+		}
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no subscriber")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if payload := <-got; payload != "hello" {
+		t.Errorf("payload = %q, want %q", payload, "hello")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Subscribe() = %v, want %v", err, context.Canceled)
+	}
+}
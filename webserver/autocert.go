@@ -0,0 +1,131 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DefaultAutocertHTTPAddr is the address of the server for the HTTP-01
+// challenge of ACME, which must be port 80 of each domain.
+const DefaultAutocertHTTPAddr = ":80"
+
+// AutocertConfig configures certificates provisioned with ACME.
+type AutocertConfig struct {
+	Domains  []string // Domains are the hosts to get certificates for.
+	CacheDir string   // CacheDir is the directory to cache certificates.
+	Email    string   // Email is the optional contact of the account.
+
+	// HTTPAddr is the address of the server for the HTTP-01 challenge,
+	// which redirects other requests to HTTPS. If empty,
+	// DefaultAutocertHTTPAddr is used.
+	HTTPAddr string
+}
+
+// WithAutocert returns an Option to provision and renew certificates for
+// domains from Let's Encrypt using ACME, cached in cacheDir. The server
+// uses HTTPS and also listens on DefaultAutocertHTTPAddr to answer the
+// HTTP-01 challenge and redirect other requests to HTTPS.
+//
+// Certificates from WithTLS and WithHostCert are still used for hosts not
+// in domains. The Autocert field can be changed to set an email or use a
+// different directory, such as the staging environment of Let's Encrypt.
+func WithAutocert(domains []string, cacheDir string) Option {
+	return func(s *WebServer) {
+		s.Autocert = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		s.autocertDomains = normalizeDomains(domains)
+		if s.AutocertHTTPAddr == "" {
+			s.AutocertHTTPAddr = DefaultAutocertHTTPAddr
+		}
+	}
+}
+
+// WithAutocertHTTPAddr returns an Option to set the address of the server
+// for the HTTP-01 challenge used by WithAutocert.
+func WithAutocertHTTPAddr(addr string) Option {
+	return func(s *WebServer) {
+		s.AutocertHTTPAddr = addr
+	}
+}
+
+// normalizeDomains returns domains in lowercase without a trailing dot.
+func normalizeDomains(domains []string) []string {
+	normal := make([]string, len(domains))
+	for i, d := range domains {
+		normal[i] = strings.TrimSuffix(strings.ToLower(d), ".")
+	}
+	return normal
+}
+
+// autocertTLSConfig changes cfg to get certificates for the autocert
+// domains from s.Autocert and others from getCert, which may be nil.
+func (s *WebServer) autocertTLSConfig(cfg *tls.Config, getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+		if slices.Contains(s.autocertDomains, name) {
+			return s.Autocert.GetCertificate(hello)
+		}
+		if getCert != nil {
+			return getCert(hello)
+		}
+		// Use the certificates from CertFile and KeyFile.
+		return nil, nil
+	}
+
+	// Answer the TLS-ALPN-01 challenge, as well as HTTP-01.
+	if !slices.Contains(cfg.NextProtos, acme.ALPNProto) {
+		cfg.NextProtos = append(cfg.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+	}
+}
+
+// startAutocertHTTP starts the server for the HTTP-01 challenge, which
+// redirects other requests to HTTPS, and sends any error to errCh.
+func (s *WebServer) startAutocertHTTP(errCh chan<- error) error {
+	ln, err := net.Listen("tcp", s.AutocertHTTPAddr)
+	if err != nil {
+		return err
+	}
+
+	s.autocertHTTP = &http.Server{
+		Handler:      s.Autocert.HTTPHandler(nil),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("starting acme http server",
+			slog.String("addr", ln.Addr().String()))
+
+		err := s.autocertHTTP.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	return nil
+}
+
+// shutdownAutocertHTTP shuts down the server for the HTTP-01 challenge,
+// if it was started.
+func (s *WebServer) shutdownAutocertHTTP(ctx context.Context) error {
+	if s.autocertHTTP == nil {
+		return nil
+	}
+
+	return s.autocertHTTP.Shutdown(ctx)
+}
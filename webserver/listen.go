@@ -0,0 +1,106 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+)
+
+// DefaultUnixSocketPerm is the permission of a Unix domain socket if none
+// is set, which allows the group, such as that of a reverse proxy, to
+// connect.
+const DefaultUnixSocketPerm fs.FileMode = 0o660
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// WithUnixSocket returns an Option to listen on a Unix domain socket at
+// path, with permission perm, instead of a TCP address, such as behind a
+// local reverse proxy. A stale socket file at path is removed.
+func WithUnixSocket(path string, perm fs.FileMode) Option {
+	return func(s *WebServer) {
+		s.UnixSocket = path
+		s.UnixSocketPerm = perm
+	}
+}
+
+// listen returns the listener of the server, which is, in order of
+// preference, the socket passed by systemd socket activation, the Unix
+// domain socket, or the TCP address.
+func (s *WebServer) listen() (net.Listener, error) {
+	ln, err := activatedListener()
+	if ln != nil || err != nil {
+		return ln, err
+	}
+
+	if s.UnixSocket != "" {
+		return listenUnix(s.UnixSocket, s.UnixSocketPerm)
+	}
+
+	return net.Listen("tcp", s.HTTPServer.Addr)
+}
+
+// listenUnix listens on a Unix domain socket at path with permission perm.
+func listenUnix(path string, perm fs.FileMode) (net.Listener, error) {
+	// Remove a socket left by a server that did not shut down.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if perm == 0 {
+		perm = DefaultUnixSocketPerm
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// activatedListener returns the first socket passed by systemd socket
+// activation, using the LISTEN_PID and LISTEN_FDS environment variables,
+// or nil if the process was not activated. The variables are unset, so
+// they are not inherited by child processes.
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if n > 1 {
+		slog.Warn("ignoring extra activated sockets", slog.Int("fds", n))
+	}
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	if f == nil {
+		return nil, errors.New("invalid activated socket")
+	}
+	defer f.Close()
+
+	// FileListener duplicates the descriptor, so f can be closed.
+	return net.FileListener(f)
+}
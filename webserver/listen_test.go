@@ -0,0 +1,183 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webserver"
+)
+
+// hello is a handler that writes "hello".
+var hello = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, "hello")
+})
+
+// getBody returns the body of a GET request to url with client, waiting
+// for the server to start.
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i := 0; i < 20; i++ {
+		resp, err = client.Get(url)
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	return string(b)
+}
+
+func TestUnixSocket(t *testing.T) {
+	// Use a short directory, since socket paths are limited to about 100
+	// bytes.
+	dir, err := os.MkdirTemp("", "webserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "web.sock")
+
+	// Leave a stale socket, as from a server that did not shut down.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	server, err := webserver.New(
+		webserver.WithHandler(hello),
+		webserver.WithUnixSocket(path, 0o600),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(context.Background()) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	if got := getBody(t, client, "http://unix/"); got != "hello" {
+		t.Errorf("body = %q, want %q", got, "hello")
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0o600 {
+		t.Errorf("permission = %v, want %v", got, fs.FileMode(0o600))
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	<-done
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket after shutdown: %v, want removed", err)
+	}
+}
+
+func TestCreateUnixSocket(t *testing.T) {
+	tests := []struct {
+		perm    string
+		want    fs.FileMode
+		wantErr bool
+	}{
+		{"", webserver.DefaultUnixSocketPerm, false},
+		{"0600", 0o600, false},
+		{"rw", 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.perm, func(t *testing.T) {
+			cfg := webserver.Config{UnixSocket: "/run/web.sock", UnixSocketPerm: tc.perm}
+
+			server, err := cfg.Create(http.DefaultServeMux)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && (server.UnixSocket != cfg.UnixSocket || server.UnixSocketPerm != tc.want) {
+				t.Errorf("UnixSocket = %q %v, want %q %v", server.UnixSocket, server.UnixSocketPerm, cfg.UnixSocket, tc.want)
+			}
+		})
+	}
+}
+
+func TestSocketActivation(t *testing.T) {
+	// The test runs again in a child process, which is passed the
+	// listener as systemd would, and serves on it.
+	if os.Getenv("WEBSERVER_TEST_ACTIVATED") == "1" {
+		// systemd sets LISTEN_PID after it forks.
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+		// The address is not used, since the socket is passed.
+		server, err := webserver.New(webserver.WithAddr("localhost:1"), webserver.WithHandler(hello))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSocketActivation$")
+	cmd.Env = append(os.Environ(), "WEBSERVER_TEST_ACTIVATED=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f} // ExtraFiles start at descriptor 3.
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start child: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// Only the child accepts connections.
+	addr := ln.Addr().String()
+	f.Close()
+	ln.Close()
+
+	if got := getBody(t, http.DefaultClient, "http://"+addr+"/"); got != "hello" {
+		t.Errorf("body = %q, want %q", got, "hello")
+	}
+}
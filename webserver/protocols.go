@@ -0,0 +1,108 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// WithH2C returns an Option to accept HTTP/2 without TLS (h2c) as well as
+// HTTP/1.1, such as behind a reverse proxy that terminates TLS and speaks
+// HTTP/2 to the server. It is ignored if TLS is configured, since HTTP/2
+// is then negotiated with TLS.
+func WithH2C() Option {
+	return func(s *WebServer) {
+		s.H2C = true
+	}
+}
+
+// WithHTTP3 returns an Option to also serve HTTP/3 over QUIC on the UDP
+// port of the address, if TLS is configured. Responses over TCP advertise
+// it with the Alt-Svc header, so clients can switch. HTTP/3 support is
+// experimental.
+func WithHTTP3() Option {
+	return func(s *WebServer) {
+		s.HTTP3 = true
+	}
+}
+
+// isTLS reports whether the server is configured to serve HTTPS.
+func (s *WebServer) isTLS() bool {
+	return (s.CertFile != "" && s.KeyFile != "") || len(s.Certs) > 0 || s.Autocert != nil
+}
+
+// h2cHandler returns h wrapped to accept HTTP/2 without TLS.
+func h2cHandler(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+
+	return h2c.NewHandler(h, &http2.Server{})
+}
+
+// startHTTP3 starts serving HTTP/3 on the UDP port of addr using the
+// handler and TLS configuration of the server, and sets the handler to
+// advertise it. Errors serving are sent to errCh.
+func (s *WebServer) startHTTP3(addr string, errCh chan<- error) error {
+	cfg := s.HTTPServer.TLSConfig.Clone()
+
+	// ServeTLS loads CertFile and KeyFile itself, so load them for QUIC.
+	if s.CertFile != "" && s.KeyFile != "" && cfg.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	handler := s.HTTPServer.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	h3 := &http3.Server{
+		Handler:        handler,
+		TLSConfig:      http3.ConfigureTLSConfig(cfg),
+		MaxHeaderBytes: s.HTTPServer.MaxHeaderBytes,
+		IdleTimeout:    s.HTTPServer.IdleTimeout,
+	}
+
+	s.mu.Lock()
+	s.http3Server = h3
+	s.mu.Unlock()
+
+	// Advertise HTTP/3 on responses over TCP.
+	s.HTTPServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			h3.SetQUICHeaders(w.Header())
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	go func() {
+		slog.Info("starting http3 server",
+			slog.String("addr", conn.LocalAddr().String()))
+
+		// Serve does not close conn when the server is closed.
+		defer conn.Close()
+
+		if err := h3.Serve(conn); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	return nil
+}
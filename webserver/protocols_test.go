@@ -0,0 +1,119 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webserver"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// proto is a handler that writes the protocol of the request.
+var proto = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, r.Proto)
+})
+
+func TestH2C(t *testing.T) {
+	const addr = "localhost:9449"
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithHandler(proto),
+		webserver.WithH2C(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	// The client speaks HTTP/2 without TLS, as a reverse proxy would.
+	h2 := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	if got := getBody(t, h2, "http://"+addr+"/"); got != "HTTP/2.0" {
+		t.Errorf("protocol = %q, want %q", got, "HTTP/2.0")
+	}
+
+	// HTTP/1.1 is still accepted.
+	if got := getBody(t, http.DefaultClient, "http://"+addr+"/"); got != "HTTP/1.1" {
+		t.Errorf("protocol = %q, want %q", got, "HTTP/1.1")
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	const addr = "localhost:9450"
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithHandler(proto),
+		webserver.WithTLS("testdata/cert.pem", "testdata/key.pem"),
+		webserver.WithHTTP3(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(context.Background()) }()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	// Responses over TCP advertise HTTP/3.
+	tcp := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	var resp *http.Response
+	for i := 0; i < 20; i++ {
+		resp, err = tcp.Get("https://" + addr + "/")
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Alt-Svc"); !strings.Contains(got, `h3=":9450"`) {
+		t.Errorf("Alt-Svc = %q, want h3 on port 9450", got)
+	}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer h3.Close()
+	if got := getBody(t, &http.Client{Transport: h3}, "https://"+addr+"/"); got != "HTTP/3.0" {
+		t.Errorf("protocol = %q, want %q", got, "HTTP/3.0")
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+}
+
+func TestCreateProtocols(t *testing.T) {
+	cfg := webserver.Config{H2C: true, HTTP3: true}
+
+	server, err := cfg.Create(http.DefaultServeMux)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if !server.H2C || !server.HTTP3 {
+		t.Errorf("H2C = %v, HTTP3 = %v, want true", server.H2C, server.HTTP3)
+	}
+}
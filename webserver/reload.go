@@ -0,0 +1,115 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webserver
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// WithTLSReload returns an Option to check the certificate and key files
+// for changes, at most once per interval, and use the new certificate
+// without a restart, such as after certbot renews it. The files are
+// checked during TLS handshakes, so an idle server does no work.
+func WithTLSReload(interval time.Duration) Option {
+	return func(s *WebServer) {
+		s.TLSReload = interval
+	}
+}
+
+// fileStamp identifies the version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stampOf returns the fileStamp of name.
+func stampOf(name string) (fileStamp, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// certReloader loads a certificate and key pair again when either file
+// changes.
+type certReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamps  [2]fileStamp // stamps of certFile and keyFile when loaded.
+	checked time.Time    // checked is when the files were last checked.
+}
+
+// newCertReloader loads the certificate and key pair, which is checked
+// for changes at most once per interval.
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load loads the files, if they changed since the last load. The caller
+// must hold r.mu, unless r is not yet shared.
+func (r *certReloader) load() error {
+	r.checked = time.Now()
+
+	certStamp, err := stampOf(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := stampOf(r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	stamps := [2]fileStamp{certStamp, keyStamp}
+	if r.cert != nil && stamps == r.stamps {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if r.cert != nil {
+		slog.Info("reloaded certificate", slog.String("certFile", r.certFile))
+	}
+	r.cert = &cert
+	r.stamps = stamps
+
+	return nil
+}
+
+// GetCertificate returns the certificate, after loading it again if the
+// files changed. If they cannot be loaded, such as while they are being
+// replaced, the previous certificate is returned.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= r.interval {
+		if err := r.load(); err != nil {
+			slog.Error("failed to reload certificate",
+				slog.String("certFile", r.certFile), slog.Any("err", err))
+		}
+	}
+
+	return r.cert, nil
+}
@@ -6,15 +6,24 @@ package webserver
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Config holds the web server configuration.
@@ -23,14 +32,99 @@ type Config struct {
 	Port     string // Server port.
 	CertFile string // CertFile is path to the cert file.
 	KeyFile  string // KeyFile is path to the key file.
+
+	// Certs are certificates for specific hosts, selected using the
+	// server name sent by the client (SNI). CertFile and KeyFile are
+	// used for other hosts.
+	Certs []HostCert
+
+	// ShutdownTimeout is a duration string to wait for connections to
+	// drain on shutdown. If empty, DefaultShutdownTimeout is used.
+	ShutdownTimeout string
+
+	// ReadTimeout, WriteTimeout, IdleTimeout, and ReadHeaderTimeout are
+	// duration strings for the timeouts of http.Server. If empty, the
+	// defaults of New are used.
+	ReadTimeout       string
+	WriteTimeout      string
+	IdleTimeout       string
+	ReadHeaderTimeout string
+
+	// MaxHeaderBytes is the maximum size of request headers. If zero,
+	// http.DefaultMaxHeaderBytes is used.
+	MaxHeaderBytes int
+
+	// MaxBodyBytes is the maximum size of request bodies. If zero, they
+	// are not limited.
+	MaxBodyBytes int64
+
+	// UnixSocket is the path of a Unix domain socket to listen on instead
+	// of Host and Port, with the octal permission UnixSocketPerm. If
+	// UnixSocketPerm is empty, DefaultUnixSocketPerm is used.
+	UnixSocket     string
+	UnixSocketPerm string
+
+	// TLSReload is a duration string between checks for changes to the
+	// certificate and key files, if enabled.
+	TLSReload string
+
+	// H2C accepts HTTP/2 without TLS, such as from a reverse proxy.
+	H2C bool
+
+	// HTTP3 serves HTTP/3 over QUIC too, if TLS is configured. It is
+	// experimental.
+	HTTP3 bool
+
+	// Autocert provisions certificates with ACME, if it has Domains.
+	Autocert AutocertConfig
+}
+
+// HostCert is the certificate for a host.
+type HostCert struct {
+	Host     string // Host is a name, or a wildcard like *.example.com.
+	CertFile string // CertFile is path to the cert file.
+	KeyFile  string // KeyFile is path to the key file.
 }
 
+// DefaultShutdownTimeout is how long to wait for connections to drain on
+// shutdown if no timeout is set.
+const DefaultShutdownTimeout = 5 * time.Second
+
 // WebServer represents an HTTP server.
 type WebServer struct {
 	Config
-	HTTPServer       http.Server
-	shutdownComplete chan struct{} // Channel to signal shutdown completion
+	HTTPServer http.Server
+
+	// ShutdownTimeout is how long Shutdown waits for connections to
+	// drain before they are closed.
+	ShutdownTimeout time.Duration
+
+	// UnixSocket is the path of a Unix domain socket to listen on instead
+	// of the address, with permission UnixSocketPerm.
+	UnixSocket     string
+	UnixSocketPerm fs.FileMode
+
+	// TLSReload is how often the certificate and key files are checked
+	// for changes. If zero, they are only loaded when the server starts.
+	TLSReload time.Duration
 
+	// Autocert provisions certificates with ACME, if not nil.
+	Autocert *autocert.Manager
+
+	// AutocertHTTPAddr is the address of the server for the HTTP-01
+	// challenge used by Autocert.
+	AutocertHTTPAddr string
+
+	autocertDomains []string     // autocertDomains are managed by Autocert.
+	autocertHTTP    *http.Server // autocertHTTP answers HTTP-01 challenges.
+
+	http3Server *http3.Server // http3Server serves HTTP/3, if enabled.
+
+	mu           sync.Mutex
+	hooks        []func(context.Context) error // Hooks run by Shutdown.
+	shutdownOnce sync.Once
+	shutdownDone chan struct{} // Closed when shutdown is complete.
+	shutdownErr  error
 }
 
 // Option is a function type for configuring the HTTP server.
@@ -66,6 +160,17 @@ func WithTLS(certFile, keyFile string) Option {
 	}
 }
 
+// WithHostCert returns an Option to add a certificate for host, which is
+// used instead of the certificate set by WithTLS when the client requests
+// host. The host can be a wildcard like *.example.com.
+func WithHostCert(host, certFile, keyFile string) Option {
+	return func(s *WebServer) {
+		s.Certs = append(s.Certs, HostCert{
+			Host: host, CertFile: certFile, KeyFile: keyFile,
+		})
+	}
+}
+
 // WithReadTimeout returns an Option to set the ReadTimeout of the server.
 func WithReadTimeout(d time.Duration) Option {
 	return func(s *WebServer) {
@@ -80,6 +185,52 @@ func WithWriteTimeout(d time.Duration) Option {
 	}
 }
 
+// WithIdleTimeout returns an Option to set the IdleTimeout of the server.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *WebServer) {
+		s.HTTPServer.IdleTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout returns an Option to set the ReadHeaderTimeout of
+// the server.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *WebServer) {
+		s.HTTPServer.ReadHeaderTimeout = d
+	}
+}
+
+// WithMaxHeaderBytes returns an Option to set the MaxHeaderBytes of the
+// server.
+func WithMaxHeaderBytes(n int) Option {
+	return func(s *WebServer) {
+		s.HTTPServer.MaxHeaderBytes = n
+	}
+}
+
+// WithMaxBodyBytes returns an Option to limit request bodies to n bytes
+// using webhandler.MaxBodySize.
+func WithMaxBodyBytes(n int64) Option {
+	return func(s *WebServer) {
+		s.MaxBodyBytes = n
+	}
+}
+
+// WithShutdownTimeout returns an Option to set how long Shutdown waits
+// for connections to drain before they are closed.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(s *WebServer) {
+		s.ShutdownTimeout = d
+	}
+}
+
+// WithOnShutdown returns an Option to add a hook run by Shutdown.
+func WithOnShutdown(hook func(context.Context) error) Option {
+	return func(s *WebServer) {
+		s.OnShutdown(hook)
+	}
+}
+
 // New creates a new HTTP server with the given options and returns it.
 func New(opts ...Option) (*WebServer, error) {
 	s := &WebServer{
@@ -88,6 +239,7 @@ func New(opts ...Option) (*WebServer, error) {
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  120 * time.Second,
 		},
+		ShutdownTimeout: DefaultShutdownTimeout,
 	}
 
 	// Apply configuration options to the server.
@@ -99,31 +251,235 @@ func New(opts ...Option) (*WebServer, error) {
 }
 
 func (cfg Config) Create(h http.Handler) (*WebServer, error) {
-	return New(
+	opts := []Option{
 		WithHostPort(cfg.Host, cfg.Port),
 		WithHandler(h),
 		WithTLS(cfg.CertFile, cfg.KeyFile),
-	)
+		func(s *WebServer) { s.Certs = cfg.Certs },
+	}
+
+	if cfg.H2C {
+		opts = append(opts, WithH2C())
+	}
+
+	if cfg.HTTP3 {
+		opts = append(opts, WithHTTP3())
+	}
+
+	timeouts := []struct {
+		name  string
+		value string
+		opt   func(time.Duration) Option
+	}{
+		{"ReadTimeout", cfg.ReadTimeout, WithReadTimeout},
+		{"WriteTimeout", cfg.WriteTimeout, WithWriteTimeout},
+		{"IdleTimeout", cfg.IdleTimeout, WithIdleTimeout},
+		{"ReadHeaderTimeout", cfg.ReadHeaderTimeout, WithReadHeaderTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(timeout.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", timeout.name, err)
+		}
+		opts = append(opts, timeout.opt(d))
+	}
+
+	if cfg.MaxHeaderBytes != 0 {
+		opts = append(opts, WithMaxHeaderBytes(cfg.MaxHeaderBytes))
+	}
+
+	if cfg.MaxBodyBytes != 0 {
+		opts = append(opts, WithMaxBodyBytes(cfg.MaxBodyBytes))
+	}
+
+	if cfg.ShutdownTimeout != "" {
+		d, err := time.ParseDuration(cfg.ShutdownTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ShutdownTimeout: %w", err)
+		}
+		opts = append(opts, WithShutdownTimeout(d))
+	}
+
+	if cfg.UnixSocket != "" {
+		perm := uint64(DefaultUnixSocketPerm)
+		if cfg.UnixSocketPerm != "" {
+			var err error
+			perm, err = strconv.ParseUint(cfg.UnixSocketPerm, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UnixSocketPerm: %w", err)
+			}
+		}
+		opts = append(opts, WithUnixSocket(cfg.UnixSocket, fs.FileMode(perm)))
+	}
+
+	if cfg.TLSReload != "" {
+		d, err := time.ParseDuration(cfg.TLSReload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLSReload: %w", err)
+		}
+		opts = append(opts, WithTLSReload(d))
+	}
+
+	if ac := cfg.Autocert; len(ac.Domains) > 0 {
+		opts = append(opts, WithAutocert(ac.Domains, ac.CacheDir),
+			func(s *WebServer) { s.Autocert.Email = ac.Email })
+		if ac.HTTPAddr != "" {
+			opts = append(opts, WithAutocertHTTPAddr(ac.HTTPAddr))
+		}
+	}
+
+	return New(opts...)
+}
+
+// tlsConfig returns the TLS configuration of the server, which selects
+// one of the host certificates using the server name of the client.
+// If no host certificate matches, CertFile and KeyFile are used.
+func (s *WebServer) tlsConfig() (*tls.Config, error) {
+	var cfg *tls.Config
+	if s.HTTPServer.TLSConfig != nil {
+		cfg = s.HTTPServer.TLSConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+
+	// defaultCert returns the certificate from CertFile and KeyFile, or
+	// nil for the server to use those loaded when it starts.
+	defaultCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return nil, nil
+	}
+	if s.TLSReload > 0 && s.CertFile != "" && s.KeyFile != "" {
+		r, err := newCertReloader(s.CertFile, s.KeyFile, s.TLSReload)
+		if err != nil {
+			return nil, err
+		}
+		defaultCert = r.GetCertificate
+	}
+
+	var getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	if len(s.Certs) > 0 {
+		certs := make(map[string]func(*tls.ClientHelloInfo) (*tls.Certificate, error), len(s.Certs))
+		for _, hc := range s.Certs {
+			get, err := s.loadCert(hc.CertFile, hc.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("host %s: %w", hc.Host, err)
+			}
+			certs[strings.ToLower(hc.Host)] = get
+		}
+
+		getCert = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+			if get, ok := certs[name]; ok {
+				return get(hello)
+			}
+			if _, parent, ok := strings.Cut(name, "."); ok {
+				if get, ok := certs["*."+parent]; ok {
+					return get(hello)
+				}
+			}
+			return defaultCert(hello)
+		}
+	} else if s.TLSReload > 0 {
+		getCert = defaultCert
+	}
+
+	if getCert != nil {
+		cfg.GetCertificate = getCert
+	}
+
+	if s.Autocert != nil {
+		s.autocertTLSConfig(cfg, getCert)
+	}
+
+	return cfg, nil
+}
+
+// loadCert loads the certificate and key pair and returns a function to
+// get it, which loads it again after changes if TLSReload is set.
+func (s *WebServer) loadCert(certFile, keyFile string) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	if s.TLSReload > 0 {
+		r, err := newCertReloader(certFile, keyFile, s.TLSReload)
+		if err != nil {
+			return nil, err
+		}
+		return r.GetCertificate, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &cert, nil
+	}, nil
 }
 
 var ErrServerStart = errors.New("failed to start server")
 
 // Run starts the HTTP server and waits for a shutdown signal.
 // It returns an error if there's an issue starting or stopping the server.
+//
+// The server listens on the socket passed by systemd socket activation,
+// if any, so it does not bind ports itself. Otherwise, it listens on
+// UnixSocket, if set, or the address.
 func (s *WebServer) Run(ctx context.Context) error {
-	ln, err := net.Listen("tcp", s.HTTPServer.Addr)
+	tlsConfig, err := s.tlsConfig()
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrServerStart, err)
 	}
+	s.HTTPServer.TLSConfig = tlsConfig
 
-	// Initialize the channels
-	errCh := make(chan error, 1)
-	s.shutdownComplete = make(chan struct{})
+	ln, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrServerStart, err)
+	}
+
+	errCh := make(chan error, 3)
+
+	// Answer ACME challenges and redirect to HTTPS, if enabled.
+	if s.Autocert != nil {
+		if err := s.startAutocertHTTP(errCh); err != nil {
+			ln.Close()
+			return fmt.Errorf("%w: %v", ErrServerStart, err)
+		}
+	}
+
+	// Limit the size of request bodies, if enabled.
+	if s.MaxBodyBytes > 0 {
+		handler := s.HTTPServer.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		s.HTTPServer.Handler = webhandler.MaxBodySize(handler, s.MaxBodyBytes)
+	}
+
+	// Serve HTTP/3 on the same port, if enabled.
+	if s.HTTP3 && s.isTLS() {
+		addr := s.HTTPServer.Addr
+		if ln.Addr().Network() == "tcp" {
+			addr = ln.Addr().String()
+		}
+		if err := s.startHTTP3(addr, errCh); err != nil {
+			ln.Close()
+			return fmt.Errorf("%w: %v", ErrServerStart, err)
+		}
+	} else if s.HTTP3 {
+		slog.Warn("ignoring http3 without tls")
+	}
+
+	// Accept HTTP/2 without TLS, if enabled.
+	if s.H2C && !s.isTLS() {
+		s.HTTPServer.Handler = h2cHandler(s.HTTPServer.Handler)
+	}
 
 	// Start the server in a separate goroutine.
 	go func() {
 		var serverErr error
-		if s.CertFile != "" && s.KeyFile != "" {
+		if s.isTLS() {
 			slog.Info("starting https server",
 				slog.String("addr", ln.Addr().String()))
 
@@ -143,6 +499,7 @@ func (s *WebServer) Run(ctx context.Context) error {
 	// Ask for notification of shutdown signals to shut down server.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	select {
 	case <-ctx.Done():
@@ -151,34 +508,107 @@ func (s *WebServer) Run(ctx context.Context) error {
 	case sig := <-sigChan:
 		// If a shutdown signal, gracefully shut down the server.
 		slog.Info("shutting down server", "signal", sig)
-		err := s.shutdownServer(ctx)
-		if err != nil {
-			return err
-		}
+		return s.Shutdown(ctx)
+	case <-s.done():
+		// If Shutdown was called, return its result.
+		return s.shutdownErr
 	case err := <-errCh:
 		// Handle the error that occurred during server startup.
 		return fmt.Errorf("%w: %v", ErrServerStart, err)
 	}
+}
+
+// OnShutdown adds a hook to run when the server is shut down, such as to
+// close the database. Hooks run in the order they are added, after the
+// connections are drained or the ShutdownTimeout expires.
+//
+// Handlers that never return on their own, such as event streams, block
+// draining, so they should be stopped with HTTPServer.RegisterOnShutdown
+// instead.
+func (s *WebServer) OnShutdown(hook func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	<-s.shutdownComplete // Wait for shutdown to complete
-	return nil
+	s.hooks = append(s.hooks, hook)
 }
 
-// shutdownServer attempts to gracefully shut down the server.
-func (s *WebServer) shutdownServer(ctx context.Context) error {
+// done returns the channel closed when shutdown is complete.
+func (s *WebServer) done() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdownDone == nil {
+		s.shutdownDone = make(chan struct{})
+	}
+
+	return s.shutdownDone
+}
+
+// Shutdown gracefully shuts down the server, which causes Run to return,
+// and then runs the OnShutdown hooks. Connections still active after
+// ShutdownTimeout are closed. It is safe to call more than once, and
+// every call returns the errors of the first.
+func (s *WebServer) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+		close(s.done())
+	})
+
+	<-s.done()
+	return s.shutdownErr
+}
+
+// shutdown shuts down the server and runs the hooks.
+func (s *WebServer) shutdown(ctx context.Context) error {
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
 	// Create a context with timeout to shut down within a reasonable time.
-	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	var errs []error
+
+	if err := s.shutdownAutocertHTTP(shutdownCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.mu.Lock()
+	h3 := s.http3Server
+	s.mu.Unlock()
+
+	if h3 != nil {
+		if err := h3.Shutdown(shutdownCtx); err != nil {
+			slog.Error("error shutting down http3 server", slog.Any("err", err))
+			errs = append(errs, err)
+		}
+	}
+
 	err := s.HTTPServer.Shutdown(shutdownCtx)
 	if err != nil {
 		slog.Error("error shutting down server", slog.Any("err", err))
-		return err
+		errs = append(errs, err)
+
+		// Close the connections that did not drain in time.
+		if err := s.HTTPServer.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	close(s.shutdownComplete) // Signal that shutdown is complete.
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(shutdownCtx); err != nil {
+			slog.Error("error in shutdown hook", slog.Any("err", err))
+			errs = append(errs, err)
+		}
+	}
 
 	slog.Info("server shutdown")
 
-	return nil
+	return errors.Join(errs...)
 }
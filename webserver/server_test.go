@@ -5,8 +5,14 @@ package webserver_test
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,6 +62,15 @@ func TestWebServer(t *testing.T) {
 			},
 			expectedErr: webserver.ErrServerStart,
 		},
+		{
+			name: "Invalid Host Certificate",
+			options: []webserver.Option{
+				webserver.WithAddr(":9443"),
+				webserver.WithHostCert("auth.example.com",
+					"cert.none", "key.none"),
+			},
+			expectedErr: webserver.ErrServerStart,
+		},
 		{
 			name: "Invalid TLS Configuration",
 			options: []webserver.Option{
@@ -96,6 +111,374 @@ func TestWebServer(t *testing.T) {
 	}
 }
 
+func TestWebServerHostCert(t *testing.T) {
+	const addr = "localhost:9444"
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithTLS("testdata/cert.pem", "testdata/key.pem"),
+		webserver.WithHostCert("*.example.com",
+			"testdata/auth_cert.pem", "testdata/auth_key.pem"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"auth.example.com", "auth.example.com"},
+		{"AUTH.example.com", "auth.example.com"},
+		{"localhost", "localhost"},
+		{"example.com", "localhost"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.serverName, func(t *testing.T) {
+			var (
+				conn *tls.Conn
+				err  error
+			)
+			// Wait for the server to start.
+			for i := 0; i < 20; i++ {
+				conn, err = tls.Dial("tcp", addr, &tls.Config{
+					ServerName:         tc.serverName,
+					InsecureSkipVerify: true,
+				})
+				if err == nil {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer conn.Close()
+
+			got := conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			if got != tc.want {
+				t.Errorf("certificate for %q = %q, want %q", tc.serverName, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	const addr = "localhost:9445"
+
+	var calls []string
+	errHook := errors.New("hook failed")
+
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithHandler(mux),
+		webserver.WithShutdownTimeout(100*time.Millisecond),
+		webserver.WithOnShutdown(func(ctx context.Context) error {
+			calls = append(calls, "first")
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server.OnShutdown(func(ctx context.Context) error {
+		calls = append(calls, "second")
+		return errHook
+	})
+	defer close(release)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Run(context.Background())
+	}()
+
+	// Wait for the server to start.
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 20 {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Start a request that does not finish before the timeout.
+	go http.Get("http://" + addr + "/slow")
+	time.Sleep(50 * time.Millisecond)
+
+	err = server.Shutdown(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errHook) {
+		t.Errorf("Shutdown() = %v, want %v and %v", err, context.DeadlineExceeded, errHook)
+	}
+
+	select {
+	case runErr := <-errChan:
+		if runErr != err {
+			t.Errorf("Run() = %v, want %v", runErr, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+
+	if again := server.Shutdown(context.Background()); again != err {
+		t.Errorf("Shutdown() again = %v, want %v", again, err)
+	}
+
+	if want := []string{"first", "second"}; !slices.Equal(calls, want) {
+		t.Errorf("hooks called %q, want %q", calls, want)
+	}
+}
+
+func TestCreateShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", webserver.DefaultShutdownTimeout, false},
+		{"30s", 30 * time.Second, false},
+		{"soon", 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.timeout, func(t *testing.T) {
+			cfg := webserver.Config{ShutdownTimeout: tc.timeout}
+
+			server, err := cfg.Create(http.DefaultServeMux)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && server.ShutdownTimeout != tc.want {
+				t.Errorf("ShutdownTimeout = %v, want %v", server.ShutdownTimeout, tc.want)
+			}
+		})
+	}
+}
+
+func TestAutocert(t *testing.T) {
+	const (
+		addr     = "localhost:9446"
+		httpAddr = "localhost:9447"
+	)
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithAutocert([]string{"auth.example.com"}, t.TempDir()),
+		webserver.WithAutocertHTTPAddr(httpAddr),
+		webserver.WithHostCert("localhost",
+			"testdata/cert.pem", "testdata/key.pem"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+	defer server.Shutdown(context.Background())
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var resp *http.Response
+	// Wait for the server to start.
+	for i := 0; i < 20; i++ {
+		resp, err = client.Get("http://" + httpAddr + "/login?next=/")
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	if got, want := resp.Header.Get("Location"), "https://localhost:443/login?next=/"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	// Unknown challenges of managed hosts are not found.
+	r, err := http.NewRequest(http.MethodGet, "http://"+httpAddr+"/.well-known/acme-challenge/token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Host = "auth.example.com"
+	resp, err = client.Do(r)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("challenge status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	// Hosts not managed by ACME use their certificate.
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if got := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; got != "localhost" {
+		t.Errorf("certificate = %q, want localhost", got)
+	}
+}
+
+func TestCreateAutocert(t *testing.T) {
+	cfg := webserver.Config{Autocert: webserver.AutocertConfig{
+		Domains:  []string{"example.com"},
+		CacheDir: t.TempDir(),
+		Email:    "admin@example.com",
+	}}
+
+	server, err := cfg.Create(http.DefaultServeMux)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if server.Autocert == nil || server.Autocert.Email != "admin@example.com" {
+		t.Fatalf("Autocert = %+v, want manager with email", server.Autocert)
+	}
+	if server.AutocertHTTPAddr != webserver.DefaultAutocertHTTPAddr {
+		t.Errorf("AutocertHTTPAddr = %q, want %q", server.AutocertHTTPAddr, webserver.DefaultAutocertHTTPAddr)
+	}
+}
+
+func TestTLSReload(t *testing.T) {
+	const addr = "localhost:9448"
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	// copyCert replaces the certificate and key with those of name, and
+	// moves their time forward, as a renewal would.
+	modTime := time.Now()
+	copyCert := func(name string) {
+		t.Helper()
+		modTime = modTime.Add(time.Minute)
+		for dst, src := range map[string]string{
+			certFile: "testdata/" + name + "cert.pem",
+			keyFile:  "testdata/" + name + "key.pem",
+		} {
+			b, err := os.ReadFile(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dst, b, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dst, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	copyCert("")
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithTLS(certFile, keyFile),
+		webserver.WithTLSReload(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	// commonName returns the common name of the certificate of the server.
+	commonName := func() string {
+		t.Helper()
+		var (
+			conn *tls.Conn
+			err  error
+		)
+		// Wait for the server to start.
+		for i := 0; i < 20; i++ {
+			conn, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+			if err == nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	if got := commonName(); got != "localhost" {
+		t.Errorf("certificate = %q, want %q", got, "localhost")
+	}
+
+	copyCert("auth_")
+	time.Sleep(5 * time.Millisecond)
+	if got := commonName(); got != "auth.example.com" {
+		t.Errorf("certificate after renewal = %q, want %q", got, "auth.example.com")
+	}
+
+	// A certificate that cannot be loaded keeps the previous one.
+	if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if got := commonName(); got != "auth.example.com" {
+		t.Errorf("certificate after invalid renewal = %q, want %q", got, "auth.example.com")
+	}
+}
+
+func TestCreateTLSReload(t *testing.T) {
+	tests := []struct {
+		reload  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1h", time.Hour, false},
+		{"daily", 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.reload, func(t *testing.T) {
+			cfg := webserver.Config{TLSReload: tc.reload}
+
+			server, err := cfg.Create(http.DefaultServeMux)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Create() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && server.TLSReload != tc.want {
+				t.Errorf("TLSReload = %v, want %v", server.TLSReload, tc.want)
+			}
+		})
+	}
+}
+
 /*
 func TestNew(t *testing.T) {
 	tests := []struct {
@@ -152,3 +535,72 @@ func TestRun(t *testing.T) {
 	}
 }
 */
+
+func TestCreateLimits(t *testing.T) {
+	cfg := webserver.Config{
+		ReadTimeout:       "1s",
+		WriteTimeout:      "2s",
+		IdleTimeout:       "3s",
+		ReadHeaderTimeout: "4s",
+		MaxHeaderBytes:    4096,
+		MaxBodyBytes:      1024,
+	}
+
+	server, err := cfg.Create(http.DefaultServeMux)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+
+	hs := &server.HTTPServer
+	got := []time.Duration{hs.ReadTimeout, hs.WriteTimeout, hs.IdleTimeout, hs.ReadHeaderTimeout}
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Errorf("timeouts = %v, want %v", got, want)
+	}
+	if hs.MaxHeaderBytes != 4096 || server.MaxBodyBytes != 1024 {
+		t.Errorf("MaxHeaderBytes = %d, MaxBodyBytes = %d, want 4096 and 1024",
+			hs.MaxHeaderBytes, server.MaxBodyBytes)
+	}
+
+	// Timeouts not set keep the defaults of New.
+	server, err = webserver.Config{ReadTimeout: "1s"}.Create(http.DefaultServeMux)
+	if err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	if server.HTTPServer.IdleTimeout != 120*time.Second {
+		t.Errorf("IdleTimeout = %v, want default", server.HTTPServer.IdleTimeout)
+	}
+
+	if _, err := (webserver.Config{IdleTimeout: "forever"}).Create(http.DefaultServeMux); err == nil {
+		t.Error("Create() with invalid IdleTimeout succeeded")
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	const addr = "localhost:9451"
+
+	server, err := webserver.New(
+		webserver.WithAddr(addr),
+		webserver.WithHandler(hello),
+		webserver.WithMaxBodyBytes(4),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	// Wait for the server to start.
+	getBody(t, http.DefaultClient, "http://"+addr+"/")
+
+	resp, err := http.Post("http://"+addr+"/", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -36,3 +36,21 @@ func TestAddAndRemoveClient(t *testing.T) {
 		})
 	}
 }
+
+func TestClientCount(t *testing.T) {
+	server := NewServer()
+
+	c1 := server.addClient("client1", "event1")
+	server.addClient("client2", "event1")
+	server.addClient("client3", "event2")
+
+	if got := server.ClientCount(); got != 3 {
+		t.Errorf("ClientCount() = %d, want 3", got)
+	}
+
+	server.removeClient("event1", c1)
+
+	if got := server.ClientCount(); got != 2 {
+		t.Errorf("ClientCount() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,65 @@
+package websse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	server := NewServer()
+
+	if err := server.Check(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Check() before Run = %v, want %v", err, ErrNotRunning)
+	}
+
+	server.Run()
+
+	if err := server.Check(context.Background()); err != nil {
+		t.Errorf("Check() after Run = %v, want nil", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := NewServer()
+	server.RegisterEvent("event1")
+	server.Run()
+
+	ts := httptest.NewServer(http.HandlerFunc(server.EventStreamHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?event=event1")
+	if err != nil {
+		t.Fatalf("could not get stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	server.Close()
+	server.Close() // Close can be called more than once.
+
+	done := make(chan error)
+	go func() {
+		_, err := io.ReadAll(resp.Body)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("stream ended with %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not ended by Close")
+	}
+
+	if err := server.Check(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Check() after Close = %v, want %v", err, ErrNotRunning)
+	}
+	if got := server.ClientCount(); got != 0 {
+		t.Errorf("ClientCount() after Close = %d, want 0", got)
+	}
+}
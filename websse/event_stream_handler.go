@@ -37,7 +37,7 @@ func (s *Server) EventStreamHandler(w http.ResponseWriter, r *http.Request) {
 	// Only listen for registered events.
 	if !s.EventExists(event) {
 		slog.Error("event does not exist", "event", event)
-		webutil.RespondWithError(w, http.StatusBadRequest)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
 		return
 	}
 
@@ -45,8 +45,13 @@ func (s *Server) EventStreamHandler(w http.ResponseWriter, r *http.Request) {
 	id := webhandler.RequestID(r.Context())
 	client := s.addClient(id, event)
 
-	// Write necessary HTTP headers for SSE.
+	// Write necessary HTTP headers for SSE and send them now, so the
+	// client knows the stream is open before the first message.
 	writeHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
 
 	// Process messages and handle client disconnects.
 	s.process(event, client, w, r, logger)
@@ -82,6 +87,7 @@ func (s *Server) process(event string, client *Client, w http.ResponseWriter, r
 					"err", err,
 					"message", msg,
 				)
+				s.removeClient(event, client)
 				return
 			}
 
@@ -93,6 +99,14 @@ func (s *Server) process(event string, client *Client, w http.ResponseWriter, r
 			s.removeClient(event, client)
 			return
 
+		case <-s.done: // Server closed.
+			logger.Info("server closed",
+				"client.id", client.id,
+				"event", event,
+			)
+			s.removeClient(event, client)
+			return
+
 		}
 	}
 }
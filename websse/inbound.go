@@ -0,0 +1,196 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package websse
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/bnixon67/webapp/webhandler"
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// MaxInboundSize is the largest inbound webhook body accepted, in bytes.
+const MaxInboundSize = 10 << 20
+
+// InboundSecretHeader is the header that holds the inbound webhook secret.
+// It is not accepted in the URL, which is often logged.
+const InboundSecretHeader = "X-Webhook-Secret"
+
+// InboundEmail is an email received from a provider webhook.
+type InboundEmail struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// InboundEvent is the data published for an inbound email, encoded as JSON.
+type InboundEvent struct {
+	Tag     string `json:"tag"`     // Tag is the plus-address tag, e.g., id in reply+id@host.
+	From    string `json:"from"`    // From is the sender address.
+	Subject string `json:"subject"` // Subject of the email.
+	Reply   string `json:"reply"`   // Reply is the first line of the text not quoted.
+}
+
+// InboundAdapter extracts an inbound email from a provider webhook request.
+type InboundAdapter func(r *http.Request) (InboundEmail, error)
+
+// ErrInboundPayload indicates the webhook request could not be parsed.
+var ErrInboundPayload = errors.New("invalid inbound payload")
+
+// JSONInboundAdapter reads an InboundEmail encoded as JSON.
+func JSONInboundAdapter(r *http.Request) (InboundEmail, error) {
+	var email InboundEmail
+
+	if err := json.NewDecoder(r.Body).Decode(&email); err != nil {
+		return InboundEmail{}, fmt.Errorf("%w: %v", ErrInboundPayload, err)
+	}
+
+	return email, nil
+}
+
+// FormInboundAdapter reads an inbound email posted as a form, as sent by
+// SendGrid Inbound Parse (from, to, subject, text) or Mailgun routes
+// (sender, recipient, subject, body-plain).
+func FormInboundAdapter(r *http.Request) (InboundEmail, error) {
+	err := r.ParseMultipartForm(MaxInboundSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return InboundEmail{}, fmt.Errorf("%w: %v", ErrInboundPayload, err)
+	}
+
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if v := r.FormValue(key); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	return InboundEmail{
+		From:    first("from", "sender"),
+		To:      first("to", "recipient"),
+		Subject: first("subject"),
+		Text:    first("text", "body-plain"),
+	}, nil
+}
+
+// InboundBridge publishes emails received by a provider webhook as events.
+//
+// The recipient address selects the event. An email sent to
+// approve+1234@example.com is published to the "approve" event with a
+// tag of "1234", which allows an app to send an email with a Reply-To of
+// approve+1234@example.com and act on the reply.
+type InboundBridge struct {
+	server  *Server
+	adapter InboundAdapter
+	secret  string
+}
+
+// NewInboundBridge returns a bridge that publishes inbound emails parsed
+// by adapter to server. Requests must include secret in the
+// InboundSecretHeader.
+func NewInboundBridge(server *Server, adapter InboundAdapter, secret string) *InboundBridge {
+	return &InboundBridge{server: server, adapter: adapter, secret: secret}
+}
+
+// InboundHandler receives an inbound email webhook and publishes it.
+func (b *InboundBridge) InboundHandler(w http.ResponseWriter, r *http.Request) {
+	logger := webhandler.RequestLoggerWithFuncName(r)
+
+	if !webutil.CheckAllowedMethods(w, r, http.MethodPost) {
+		logger.Error("invalid method")
+		return
+	}
+
+	secret := r.Header.Get(InboundSecretHeader)
+	if b.secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(b.secret)) != 1 {
+		logger.Warn("invalid inbound secret")
+		webutil.Error(w, r, http.StatusUnauthorized, "", "")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxInboundSize)
+
+	email, err := b.adapter(r)
+	if err != nil {
+		logger.Error("failed to parse inbound email", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	msg, err := InboundMessage(email)
+	if err != nil {
+		logger.Error("failed to create message", "err", err)
+		webutil.Error(w, r, http.StatusBadRequest, "", "")
+		return
+	}
+
+	err = b.server.Publish(msg)
+	if err != nil {
+		logger.Error("unable to publish message", "err", err, "message", msg)
+		webutil.Error(w, r, http.StatusUnprocessableEntity, "", "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	logger.Info("done", "event", msg.Event)
+}
+
+// InboundMessage returns the message to publish for email.
+func InboundMessage(email InboundEmail) (Message, error) {
+	to, err := mail.ParseAddress(firstAddress(email.To))
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: to: %v", ErrInboundPayload, err)
+	}
+
+	from := email.From
+	if addr, err := mail.ParseAddress(email.From); err == nil {
+		from = addr.Address
+	}
+
+	local, _, _ := strings.Cut(to.Address, "@")
+	event, tag, _ := strings.Cut(local, "+")
+
+	data, err := json.Marshal(InboundEvent{
+		Tag:     tag,
+		From:    from,
+		Subject: email.Subject,
+		Reply:   replyLine(email.Text),
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Event: strings.ToLower(event), Data: string(data)}, nil
+}
+
+// firstAddress returns the first address in a comma separated list.
+func firstAddress(list string) string {
+	addresses, err := mail.ParseAddressList(list)
+	if err != nil || len(addresses) == 0 {
+		return list
+	}
+
+	return addresses[0].String()
+}
+
+// replyLine returns the first non-empty line of text that is not quoted.
+func replyLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, ">") {
+			return line
+		}
+	}
+
+	return ""
+}
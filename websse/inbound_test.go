@@ -0,0 +1,181 @@
+package websse
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInboundMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   InboundEmail
+		want    Message
+		wantErr error
+	}{
+		{
+			name: "tagged",
+			email: InboundEmail{
+				From:    "Test User <test@example.com>",
+				To:      "Approve+1234@example.com",
+				Subject: "Re: approve request",
+				Text:    "\nyes\n\n> Reply yes to approve.\n",
+			},
+			want: Message{
+				Event: "approve",
+				Data:  `{"tag":"1234","from":"test@example.com","subject":"Re: approve request","reply":"yes"}`,
+			},
+		},
+		{
+			name: "untaggedList",
+			email: InboundEmail{
+				From: "test@example.com",
+				To:   "Reply <reply@example.com>, other@example.com",
+				Text: "> quoted only",
+			},
+			want: Message{
+				Event: "reply",
+				Data:  `{"tag":"","from":"test@example.com","subject":"","reply":""}`,
+			},
+		},
+		{
+			name:    "invalidTo",
+			email:   InboundEmail{To: "not an address"},
+			wantErr: ErrInboundPayload,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := InboundMessage(tc.email)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got err %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInboundHandler(t *testing.T) {
+	server := NewServer()
+	server.RegisterEvents("approve")
+	server.Run()
+
+	form := url.Values{
+		"sender":     {"test@example.com"},
+		"recipient":  {"approve+42@example.com"},
+		"subject":    {"Re: request"},
+		"body-plain": {"no"},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		secret     string
+		body       string
+		adapter    InboundAdapter
+		wantStatus int
+		wantData   string
+	}{
+		{
+			name:       "invalidMethod",
+			method:     http.MethodGet,
+			target:     "/inbound",
+			secret:     "secret",
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "invalidSecret",
+			method:     http.MethodPost,
+			target:     "/inbound",
+			secret:     "wrong",
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			// The secret is not accepted in the URL, which is logged.
+			name:       "querySecret",
+			method:     http.MethodPost,
+			target:     "/inbound?token=secret",
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalidJSON",
+			method:     http.MethodPost,
+			target:     "/inbound",
+			secret:     "secret",
+			body:       "not json",
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unregisteredEvent",
+			method:     http.MethodPost,
+			target:     "/inbound",
+			secret:     "secret",
+			body:       `{"from":"test@example.com","to":"other@example.com"}`,
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "json",
+			method:     http.MethodPost,
+			target:     "/inbound",
+			secret:     "secret",
+			body:       `{"from":"test@example.com","to":"approve+1@example.com","text":"yes"}`,
+			adapter:    JSONInboundAdapter,
+			wantStatus: http.StatusNoContent,
+			wantData:   `{"tag":"1","from":"test@example.com","subject":"","reply":"yes"}`,
+		},
+		{
+			name:       "form",
+			method:     http.MethodPost,
+			target:     "/inbound",
+			secret:     "secret",
+			body:       form.Encode(),
+			adapter:    FormInboundAdapter,
+			wantStatus: http.StatusNoContent,
+			wantData:   `{"tag":"42","from":"test@example.com","subject":"Re: request","reply":"no"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var client *Client
+			if tc.wantData != "" {
+				client = server.addClient(tc.name, "approve")
+				defer server.removeClient("approve", client)
+			}
+
+			r := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.method == http.MethodPost {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tc.secret != "" {
+				r.Header.Set(InboundSecretHeader, tc.secret)
+			}
+			w := httptest.NewRecorder()
+
+			NewInboundBridge(server, tc.adapter, "secret").InboundHandler(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, tc.wantStatus)
+			}
+
+			if client != nil {
+				msg := <-client.msgChan
+				if msg.Event != "approve" || msg.Data != tc.wantData {
+					t.Errorf("got message %+v, want data %s", msg, tc.wantData)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package websse
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -47,3 +48,24 @@ func TestPublish(t *testing.T) {
 		})
 	}
 }
+
+func TestTryPublish(t *testing.T) {
+	server := NewServer()
+	server.RegisterEvent("event")
+
+	if err := server.TryPublish(Message{Event: "unknown"}); !errors.Is(err, ErrEventNotRegistered) {
+		t.Errorf("TryPublish(unknown) = %v, want %v", err, ErrEventNotRegistered)
+	}
+
+	// Without Run, nothing receives from the broadcast channel, so it
+	// fills up.
+	for n := 0; n < broadcastBuffer; n++ {
+		if err := server.TryPublish(Message{Event: "event"}); err != nil {
+			t.Fatalf("TryPublish %d = %v, want nil", n, err)
+		}
+	}
+
+	if err := server.TryPublish(Message{Event: "event"}); !errors.Is(err, ErrBusy) {
+		t.Errorf("TryPublish when full = %v, want %v", err, ErrBusy)
+	}
+}
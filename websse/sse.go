@@ -26,14 +26,22 @@ The general flow is:
 	s.Publish(websse.Message{Event:"event1", Data:"data"})
 
 See example in cmd/simple-websse.
+
+An InboundBridge publishes emails received from a provider webhook, which
+allows an app to act on email replies:
+
+	b := websse.NewInboundBridge(s, websse.FormInboundAdapter, secret)
+	http.HandleFunc("/inbound", b.InboundHandler)
 */
 package websse
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 )
 
 // Client represents event stream clients.
@@ -60,6 +68,13 @@ type Server struct {
 
 	// broadcast is the channel to send an event.
 	broadcast chan Message
+
+	// running is true once Run has started the broadcast loop.
+	running atomic.Bool
+
+	// done is closed by Close to end the event streams.
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // RegisterEvent allows the server to accept and respond to event.
@@ -89,6 +104,13 @@ func (s *Server) EventExists(event string) bool {
 
 var ErrEventNotRegistered = errors.New("event not registered")
 
+// Publisher publishes messages to the clients of events. It is implemented
+// by Server, and by brokers that also relay messages to other servers.
+type Publisher interface {
+	Publish(msg Message) error
+	TryPublish(msg Message) error
+}
+
 // Publish sends a message to the broadcast channel.
 func (s *Server) Publish(msg Message) error {
 	slog.Debug("publishing message", "msg", msg)
@@ -102,11 +124,34 @@ func (s *Server) Publish(msg Message) error {
 	return nil
 }
 
+var ErrBusy = errors.New("server busy")
+
+// TryPublish is like Publish, but returns ErrBusy instead of waiting if
+// the broadcast channel is full. This allows messages to be published
+// from a request without blocking it on slow clients.
+func (s *Server) TryPublish(msg Message) error {
+	if !s.EventExists(msg.Event) {
+		return fmt.Errorf("%w: %s", ErrEventNotRegistered, msg.Event)
+	}
+
+	select {
+	case s.broadcast <- msg:
+		return nil
+	default:
+		return ErrBusy
+	}
+}
+
+// broadcastBuffer is the number of messages that can be published before
+// the broadcast loop receives them.
+const broadcastBuffer = 100
+
 // NewServer returns a new server to process server-side events.
 func NewServer() *Server {
 	s := &Server{
 		eventClients: make(map[string][]*Client),
-		broadcast:    make(chan Message),
+		broadcast:    make(chan Message, broadcastBuffer),
+		done:         make(chan struct{}),
 	}
 
 	return s
@@ -114,9 +159,43 @@ func NewServer() *Server {
 
 // Run runs the server in a goroutine.
 func (s *Server) Run() {
+	s.running.Store(true)
 	go s.listenAndBroadcast()
 }
 
+// Close ends the event streams of all clients, so a web server can drain
+// its connections on shutdown, and causes Check to return ErrNotRunning.
+// Messages can still be published, but are not sent to the closed streams.
+func (s *Server) Close() {
+	s.running.Store(false)
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+var ErrNotRunning = errors.New("server not running")
+
+// Check returns ErrNotRunning if the server cannot broadcast messages.
+// This allows the server to be used as a health check.
+func (s *Server) Check(ctx context.Context) error {
+	if !s.running.Load() {
+		return ErrNotRunning
+	}
+
+	return nil
+}
+
+// ClientCount returns the number of clients connected for all events.
+func (s *Server) ClientCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, clients := range s.eventClients {
+		n += len(clients)
+	}
+
+	return n
+}
+
 // addClient creates a new client and adds it to the event client list.
 func (s *Server) addClient(id, event string) *Client {
 	client := &Client{
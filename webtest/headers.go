@@ -0,0 +1,220 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webtest
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// HeaderSuite checks the headers of the responses of a handler, usually
+// the routes with all the middleware of an app, for the security, cache,
+// and cookie practices of the webapp packages. Apps that embed the
+// packages can run it to verify their own stacks.
+type HeaderSuite struct {
+	Handler http.Handler
+
+	// Dynamic are the paths of pages generated for each request, which
+	// must not be stored by caches.
+	Dynamic []string
+
+	// Static are the paths of static files, which can be cached and
+	// must have a validator, such as Last-Modified or ETag.
+	Static []string
+
+	// Requests return requests whose responses set cookies, such as a
+	// login, to check the attributes of the cookies. The responses of
+	// Dynamic and Static are checked too.
+	Requests []func() *http.Request
+
+	// ScriptCookies are the names of cookies that scripts can read, so
+	// they are not HttpOnly.
+	ScriptCookies []string
+
+	// HSTSMaxAge is the minimum max-age of Strict-Transport-Security on
+	// HTTPS responses. If zero, the header is not required.
+	HSTSMaxAge time.Duration
+}
+
+// Run runs a subtest for each path and request of s. The requests are
+// sent with TLS, so HTTPS-only headers and cookies are expected.
+func (s HeaderSuite) Run(t *testing.T) {
+	t.Helper()
+
+	for _, path := range s.Dynamic {
+		t.Run("dynamic "+path, func(t *testing.T) {
+			resp := s.serve(httptest.NewRequest(http.MethodGet, path, nil))
+			s.check(t, resp)
+			for _, problem := range CheckNoStore(resp.Header) {
+				t.Error(problem)
+			}
+		})
+	}
+
+	for _, path := range s.Static {
+		t.Run("static "+path, func(t *testing.T) {
+			resp := s.serve(httptest.NewRequest(http.MethodGet, path, nil))
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+			s.check(t, resp)
+			for _, problem := range CheckCacheable(resp.Header) {
+				t.Error(problem)
+			}
+		})
+	}
+
+	for i, newRequest := range s.Requests {
+		r := newRequest()
+		t.Run(strconv.Itoa(i)+" "+r.Method+" "+r.URL.Path, func(t *testing.T) {
+			resp := s.serve(r)
+			s.check(t, resp)
+			if len(resp.Cookies()) == 0 {
+				t.Error("no cookies set")
+			}
+		})
+	}
+}
+
+// serve returns the response of s.Handler to r, sent with TLS.
+func (s HeaderSuite) serve(r *http.Request) *http.Response {
+	if r.TLS == nil {
+		r.TLS = &tls.ConnectionState{}
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler.ServeHTTP(w, r)
+
+	return w.Result()
+}
+
+// check reports the problems with the security headers and cookies of
+// resp.
+func (s HeaderSuite) check(t *testing.T, resp *http.Response) {
+	t.Helper()
+
+	problems := CheckSecurityHeaders(resp.Header)
+	if s.HSTSMaxAge > 0 {
+		problems = append(problems, CheckHSTS(resp.Header, s.HSTSMaxAge)...)
+	}
+	for _, c := range resp.Cookies() {
+		problems = append(problems, CheckCookie(c, slices.Contains(s.ScriptCookies, c.Name))...)
+	}
+
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
+
+// CheckSecurityHeaders returns the problems with the security headers of
+// a response, which must have a Content-Security-Policy, disable MIME
+// sniffing, and not allow framing by other sites.
+func CheckSecurityHeaders(h http.Header) []string {
+	var problems []string
+
+	csp := h.Get("Content-Security-Policy")
+	if !strings.Contains(csp, "default-src") {
+		problems = append(problems, "Content-Security-Policy "+strconv.Quote(csp)+" has no default-src")
+	}
+
+	if got := h.Get("X-Content-Type-Options"); got != "nosniff" {
+		problems = append(problems, "X-Content-Type-Options = "+strconv.Quote(got)+", want nosniff")
+	}
+
+	frame := strings.ToUpper(h.Get("X-Frame-Options"))
+	if frame != "DENY" && frame != "SAMEORIGIN" && !strings.Contains(csp, "frame-ancestors") {
+		problems = append(problems, "framing is not restricted by X-Frame-Options or frame-ancestors")
+	}
+
+	return problems
+}
+
+// CheckHSTS returns the problems with the Strict-Transport-Security
+// header, which must have a max-age of at least minAge.
+func CheckHSTS(h http.Header, minAge time.Duration) []string {
+	hsts := h.Get("Strict-Transport-Security")
+
+	for _, directive := range strings.Split(hsts, ";") {
+		v, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age=")
+		if !ok {
+			continue
+		}
+		age, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && time.Duration(age)*time.Second >= minAge {
+			return nil
+		}
+	}
+
+	return []string{"Strict-Transport-Security " + strconv.Quote(hsts) +
+		" does not have a max-age of at least " + minAge.String()}
+}
+
+// CheckNoStore returns the problems with the cache headers of a dynamic
+// response, which must not be stored by caches.
+func CheckNoStore(h http.Header) []string {
+	cc := h.Get("Cache-Control")
+	if !strings.Contains(cc, "no-store") {
+		return []string{"Cache-Control " + strconv.Quote(cc) + " of dynamic response does not have no-store"}
+	}
+
+	return nil
+}
+
+// CheckCacheable returns the problems with the cache headers of a static
+// response, which must be cacheable and have a validator, so caches can
+// check whether it changed.
+func CheckCacheable(h http.Header) []string {
+	var problems []string
+
+	if cc := h.Get("Cache-Control"); strings.Contains(cc, "no-store") {
+		problems = append(problems, "Cache-Control "+strconv.Quote(cc)+" of static response has no-store")
+	}
+	if h.Get("Last-Modified") == "" && h.Get("ETag") == "" {
+		problems = append(problems, "static response has no Last-Modified or ETag")
+	}
+
+	return problems
+}
+
+// CheckCookie returns the problems with the attributes of c, as set by a
+// response. Cookies must be Secure, have a SameSite mode, and be HttpOnly
+// unless script is true. A cookie that removes another is only checked
+// for the rules of its name prefix, since browsers ignore it otherwise.
+func CheckCookie(c *http.Cookie, script bool) []string {
+	var problems []string
+
+	add := func(problem string) {
+		problems = append(problems, "cookie "+c.Name+": "+problem)
+	}
+
+	if strings.HasPrefix(c.Name, "__Host-") {
+		if !c.Secure || c.Path != "/" || c.Domain != "" {
+			add("__Host- prefix requires Secure, Path=/, and no Domain")
+		}
+	} else if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		add("__Secure- prefix requires Secure")
+	}
+
+	if c.MaxAge < 0 {
+		return problems
+	}
+
+	if !c.Secure {
+		add("not Secure")
+	}
+	if !c.HttpOnly && !script {
+		add("not HttpOnly")
+	}
+	if c.SameSite == http.SameSiteDefaultMode || c.SameSite == 0 {
+		add("no SameSite")
+	}
+
+	return problems
+}
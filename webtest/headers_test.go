@@ -0,0 +1,144 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webtest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webtest"
+)
+
+func TestHeaderSuite(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		http.SetCookie(w, &http.Cookie{Name: "__Host-id", Value: "1", Path: "/",
+			Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	})
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		mux.ServeHTTP(w, r)
+	})
+
+	webtest.HeaderSuite{
+		Handler: h,
+		Dynamic: []string{"/page"},
+		Static:  []string{"/file"},
+		Requests: []func() *http.Request{
+			func() *http.Request { return httptest.NewRequest(http.MethodPost, "/page", nil) },
+		},
+		HSTSMaxAge: 24 * time.Hour,
+	}.Run(t)
+}
+
+func TestCheckSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"valid", http.Header{
+			"Content-Security-Policy": {"default-src 'self'"},
+			"X-Content-Type-Options":  {"nosniff"},
+			"X-Frame-Options":         {"DENY"},
+		}, 0},
+		{"frameAncestors", http.Header{
+			"Content-Security-Policy": {"default-src 'self'; frame-ancestors 'none'"},
+			"X-Content-Type-Options":  {"nosniff"},
+		}, 0},
+		{"missing", http.Header{}, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webtest.CheckSecurityHeaders(tc.header); len(got) != tc.want {
+				t.Errorf("CheckSecurityHeaders() = %q, want %d problems", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckHSTS(t *testing.T) {
+	tests := []struct {
+		hsts string
+		want int
+	}{
+		{"max-age=31536000; includeSubDomains; preload", 0},
+		{"max-age=3600", 1},
+		{"max-age=invalid", 1},
+		{"", 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.hsts, func(t *testing.T) {
+			h := http.Header{"Strict-Transport-Security": {tc.hsts}}
+			if got := webtest.CheckHSTS(h, 24*time.Hour); len(got) != tc.want {
+				t.Errorf("CheckHSTS() = %q, want %d problems", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckCache(t *testing.T) {
+	modified := time.Now().UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name          string
+		header        http.Header
+		wantNoStore   int
+		wantCacheable int
+	}{
+		{"noStore", http.Header{"Cache-Control": {"no-cache, no-store, must-revalidate"}}, 0, 2},
+		{"lastModified", http.Header{"Last-Modified": {modified}}, 1, 0},
+		{"etag", http.Header{"Etag": {`"1"`}, "Cache-Control": {"max-age=3600"}}, 1, 0},
+		{"none", http.Header{}, 1, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webtest.CheckNoStore(tc.header); len(got) != tc.wantNoStore {
+				t.Errorf("CheckNoStore() = %q, want %d problems", got, tc.wantNoStore)
+			}
+			if got := webtest.CheckCacheable(tc.header); len(got) != tc.wantCacheable {
+				t.Errorf("CheckCacheable() = %q, want %d problems", got, tc.wantCacheable)
+			}
+		})
+	}
+}
+
+func TestCheckCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie http.Cookie
+		script bool
+		want   int
+	}{
+		{"valid", http.Cookie{Name: "id", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}, false, 0},
+		{"script", http.Cookie{Name: "id", Secure: true, SameSite: http.SameSiteLaxMode}, true, 0},
+		{"insecure", http.Cookie{Name: "id"}, false, 3},
+		{"host", http.Cookie{Name: "__Host-id", Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode}, false, 0},
+		{"hostDomain", http.Cookie{Name: "__Host-id", Path: "/", Domain: "example.com", Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode}, false, 1},
+		{"secureInsecure", http.Cookie{Name: "__Secure-id", HttpOnly: true, SameSite: http.SameSiteStrictMode}, false, 2},
+		{"remove", http.Cookie{Name: "id", MaxAge: -1}, false, 0},
+		{"removeHost", http.Cookie{Name: "__Host-id", Path: "/", MaxAge: -1}, false, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webtest.CheckCookie(&tc.cookie, tc.script); len(got) != tc.want {
+				t.Errorf("CheckCookie() = %q, want %d problems", got, tc.want)
+			}
+		})
+	}
+}
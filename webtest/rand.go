@@ -0,0 +1,36 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webtest provides helpers for testing code that uses the webapp
+// packages.
+package webtest
+
+import "sync"
+
+// SeqReader is an io.Reader that returns an incrementing sequence of bytes
+// instead of random bytes. It is used in place of crypto/rand.Reader so
+// tests get reproducible tokens and request IDs. It is safe for concurrent
+// use.
+type SeqReader struct {
+	mu   sync.Mutex
+	next byte
+}
+
+// NewSeqReader returns a SeqReader whose first byte is seed.
+func NewSeqReader(seed byte) *SeqReader {
+	return &SeqReader{next: seed}
+}
+
+// Read fills p with the next bytes in the sequence, wrapping after 255.
+// It never returns an error.
+func (r *SeqReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range p {
+		p[i] = r.next
+		r.next++
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webtest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bnixon67/webapp/webtest"
+)
+
+func TestSeqReader(t *testing.T) {
+	r := webtest.NewSeqReader(254)
+
+	got := make([]byte, 4)
+	n, err := r.Read(got)
+	if n != len(got) || err != nil {
+		t.Fatalf("Read() = %d, %v, want %d, nil", n, err, len(got))
+	}
+
+	want := []byte{254, 255, 0, 1}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Read() got %v, want %v", got, want)
+	}
+
+	// Readers with the same seed return the same bytes.
+	a, b := make([]byte, 8), make([]byte, 8)
+	webtest.NewSeqReader(7).Read(a)
+	webtest.NewSeqReader(7).Read(b)
+	if !bytes.Equal(a, b) {
+		t.Errorf("same seed got %v and %v", a, b)
+	}
+}
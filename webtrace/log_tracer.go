@@ -0,0 +1,112 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webtrace
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogTracer is a Tracer that logs each span when it ends. The zero value
+// logs to slog.Default with random ids from crypto/rand.
+type LogTracer struct {
+	Logger *slog.Logger // Logger logs the spans.
+	Rand   io.Reader    // Rand is the source of random ids.
+}
+
+// Start starts a span named name as a child of Parent(ctx). The span
+// continues the trace of the parent, or starts a new trace.
+func (t *LogTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	r := t.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	parent := Parent(ctx)
+	span := &logSpan{
+		tracer: t,
+		name:   name,
+		parent: parent.SpanID,
+		start:  time.Now(),
+		sc:     SpanContext{Sampled: true, TraceState: parent.TraceState},
+	}
+
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+	} else if _, err := io.ReadFull(r, span.sc.TraceID[:]); err != nil {
+		return ctx, noopSpan{}
+	}
+	if _, err := io.ReadFull(r, span.sc.SpanID[:]); err != nil {
+		return ctx, noopSpan{}
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// logSpan is a Span of a LogTracer.
+type logSpan struct {
+	tracer *LogTracer
+	name   string
+	parent SpanID
+	start  time.Time
+	sc     SpanContext
+
+	mu    sync.Mutex
+	attrs []any
+	err   error
+}
+
+// SpanContext returns the identity of the span.
+func (s *logSpan) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttribute sets the attribute key of the span to value.
+func (s *logSpan) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attrs = append(s.attrs, slog.String(key, value))
+}
+
+// SetError records that the operation of the span failed with err.
+func (s *logSpan) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// End logs the span.
+func (s *logSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logger := s.tracer.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	args := []any{
+		slog.String("name", s.name),
+		slog.String("traceID", s.sc.TraceID.String()),
+		slog.String("spanID", s.sc.SpanID.String()),
+		slog.Duration("duration", time.Since(s.start)),
+	}
+	if s.parent.IsValid() {
+		args = append(args, slog.String("parentID", s.parent.String()))
+	}
+	if len(s.attrs) > 0 {
+		args = append(args, slog.Group("attrs", s.attrs...))
+	}
+	if s.err != nil {
+		args = append(args, slog.Any("err", s.err))
+	}
+
+	logger.Info("span", args...)
+}
@@ -0,0 +1,257 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package webtrace traces requests with spans that are propagated using
+// the W3C Trace Context headers.
+//
+// Tracer and Span have the shape of those of OpenTelemetry, so that a thin
+// adapter can export spans to an OpenTelemetry collector without this
+// module depending on the OpenTelemetry SDK. LogTracer logs spans instead.
+//
+// Code that does work on behalf of a request, such as a database query or
+// an email send, calls StartSpan with the context of the request. The span
+// is a child of the span of the request, or a no-op if the request is not
+// traced.
+package webtrace
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Headers of the W3C Trace Context.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the lowercase hex of id.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns true if id is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the lowercase hex of id.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns true if id is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext identifies a span, either local or received from a client.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool   // Sampled is true if the caller may have recorded the trace.
+	TraceState string // TraceState is the vendor data of the tracestate header.
+}
+
+// IsValid returns true if sc has a trace and span id.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// TraceParent returns the value of the traceparent header for sc.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// ParseTraceParent parses the value of a traceparent header. Versions
+// other than 00 are parsed as version 00, as required by the
+// specification, except for the invalid version ff.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceParent
+	}
+
+	if _, err := decodeLowerHex(parts[0], 1); err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	traceID, err := decodeLowerHex(parts[1], len(sc.TraceID))
+	if err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	spanID, err := decodeLowerHex(parts[2], len(sc.SpanID))
+	if err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+	flags, err := decodeLowerHex(parts[3], 1)
+	if err != nil {
+		return sc, ErrInvalidTraceParent
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	return sc, nil
+}
+
+// decodeLowerHex decodes s, which must be n bytes of lowercase hex.
+func decodeLowerHex(s string, n int) ([]byte, error) {
+	if len(s) != 2*n || strings.ToLower(s) != s {
+		return nil, ErrInvalidTraceParent
+	}
+
+	return hex.DecodeString(s)
+}
+
+// Extract returns the span context of the traceparent and tracestate
+// headers of h, or false if there is no valid traceparent.
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(h.Get(TraceParentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = strings.Join(h.Values(TraceStateHeader), ",")
+
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers of h to the span of
+// ctx, so that an outgoing request continues the trace. h is unchanged if
+// ctx has no span.
+func Inject(ctx context.Context, h http.Header) {
+	sc := Parent(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceParentHeader, sc.TraceParent())
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+}
+
+// Span is an operation within a trace.
+type Span interface {
+	// SpanContext returns the identity of the span.
+	SpanContext() SpanContext
+
+	// SetAttribute sets the attribute key of the span to value.
+	SetAttribute(key, value string)
+
+	// SetError records that the operation of the span failed with err.
+	SetError(err error)
+
+	// End completes the span. Other methods must not be called after End.
+	End()
+}
+
+// Tracer starts spans.
+type Tracer interface {
+	// Start starts a span named name and returns it with a context that
+	// holds it. The span is a child of Parent(ctx), if it is valid.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// contextKeyType is a custom type to avoid collisions in context values.
+type contextKeyType int
+
+// Keys to store/retrieve values from a context.
+const (
+	tracerKey contextKeyType = iota
+	spanKey
+	remoteKey
+)
+
+// ContextWithTracer returns a copy of ctx with t, which StartSpan uses to
+// start spans.
+func ContextWithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey, t)
+}
+
+// TracerFromContext returns the Tracer of ctx, or nil if there is none.
+func TracerFromContext(ctx context.Context) Tracer {
+	t, _ := ctx.Value(tracerKey).(Tracer)
+	return t
+}
+
+// ContextWithSpan returns a copy of ctx with span as the current span.
+// Tracer implementations use it to return the context of a new span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// SpanFromContext returns the current span of ctx, or a no-op span if
+// there is none.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey).(Span); ok {
+		return span
+	}
+
+	return noopSpan{}
+}
+
+// ContextWithRemote returns a copy of ctx with sc, the span context
+// received from a client, as the parent of the next span.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// Parent returns the span context of the current span of ctx, or the
+// remote span context of ctx if there is no current span. It is invalid
+// if there is neither.
+func Parent(ctx context.Context) SpanContext {
+	if span, ok := ctx.Value(spanKey).(Span); ok {
+		return span.SpanContext()
+	}
+
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
+
+// StartSpan starts a span named name with the Tracer of ctx, as a child
+// of the current span of ctx. If ctx has no Tracer, the span is a no-op.
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	t := TracerFromContext(ctx)
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+
+	return t.Start(ctx, name)
+}
+
+// noopSpan is a Span that does nothing.
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext       { return SpanContext{} }
+func (noopSpan) SetAttribute(key, value string) {}
+func (noopSpan) SetError(err error)             {}
+func (noopSpan) End()                           {}
@@ -0,0 +1,146 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webtrace_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/webtest"
+	"github.com/bnixon67/webapp/webtrace"
+)
+
+const validParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		sampled bool
+		wantErr error
+	}{
+		{"valid", validParent, true, nil},
+		{"notSampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, nil},
+		{"futureVersion", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, nil},
+		{"empty", "", false, webtrace.ErrInvalidTraceParent},
+		{"invalidVersion", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, webtrace.ErrInvalidTraceParent},
+		{"extraFields", validParent + "-extra", false, webtrace.ErrInvalidTraceParent},
+		{"upperHex", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, webtrace.ErrInvalidTraceParent},
+		{"zeroTraceID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, webtrace.ErrInvalidTraceParent},
+		{"zeroSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, webtrace.ErrInvalidTraceParent},
+		{"shortSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", false, webtrace.ErrInvalidTraceParent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := webtrace.ParseTraceParent(tc.in)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("ParseTraceParent(%q) error = %v, want %v", tc.in, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sc.Sampled != tc.sampled {
+				t.Errorf("Sampled = %v, want %v", sc.Sampled, tc.sampled)
+			}
+			if got := sc.TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("TraceID = %s", got)
+			}
+			if got := sc.SpanID.String(); got != "00f067aa0ba902b7" {
+				t.Errorf("SpanID = %s", got)
+			}
+		})
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	in := http.Header{}
+	in.Set(webtrace.TraceParentHeader, validParent)
+	in.Set(webtrace.TraceStateHeader, "vendor=value")
+
+	sc, ok := webtrace.Extract(in)
+	if !ok {
+		t.Fatalf("Extract() failed")
+	}
+	if got := sc.TraceParent(); got != validParent {
+		t.Errorf("TraceParent() = %q, want %q", got, validParent)
+	}
+
+	ctx := webtrace.ContextWithRemote(context.Background(), sc)
+	out := http.Header{}
+	webtrace.Inject(ctx, out)
+	if got := out.Get(webtrace.TraceParentHeader); got != validParent {
+		t.Errorf("traceparent = %q, want %q", got, validParent)
+	}
+	if got := out.Get(webtrace.TraceStateHeader); got != "vendor=value" {
+		t.Errorf("tracestate = %q, want %q", got, "vendor=value")
+	}
+
+	out = http.Header{}
+	webtrace.Inject(context.Background(), out)
+	if len(out) != 0 {
+		t.Errorf("Inject() without span set %v", out)
+	}
+}
+
+func TestStartSpanWithoutTracer(t *testing.T) {
+	ctx, span := webtrace.StartSpan(context.Background(), "noop")
+	span.SetAttribute("key", "value")
+	span.End()
+
+	if span.SpanContext().IsValid() {
+		t.Errorf("got valid span context for no-op span")
+	}
+	if webtrace.Parent(ctx).IsValid() {
+		t.Errorf("got valid parent after no-op span")
+	}
+}
+
+func TestLogTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := &webtrace.LogTracer{
+		Logger: slog.New(slog.NewTextHandler(&buf, nil)),
+		Rand:   webtest.NewSeqReader(1),
+	}
+
+	remote, err := webtrace.ParseTraceParent(validParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := webtrace.ContextWithTracer(context.Background(), tracer)
+	ctx = webtrace.ContextWithRemote(ctx, remote)
+
+	ctx, parent := webtrace.StartSpan(ctx, "parent")
+	_, child := webtrace.StartSpan(ctx, "child")
+	child.SetAttribute("key", "value")
+	child.SetError(errors.New("failed"))
+	child.End()
+	parent.End()
+
+	psc, csc := parent.SpanContext(), child.SpanContext()
+	if psc.TraceID != remote.TraceID || csc.TraceID != remote.TraceID {
+		t.Errorf("spans did not continue trace %s", remote.TraceID)
+	}
+	if psc.SpanID == csc.SpanID || psc.SpanID == remote.SpanID {
+		t.Errorf("spans have the same id")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+	for _, want := range []string{"name=child", "parentID=" + psc.SpanID.String(), "attrs.key=value", "err=failed"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("child log %q does not contain %q", lines[0], want)
+		}
+	}
+	if !strings.Contains(lines[1], "parentID="+remote.SpanID.String()) {
+		t.Errorf("parent log %q does not contain remote parent", lines[1])
+	}
+}
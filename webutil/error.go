@@ -5,13 +5,14 @@
 package webutil
 
 import (
-	"fmt"
 	"net/http"
 )
 
 // RespondWithError sends an HTTP response with the specified error code and
-// a corresponding error message.
+// a corresponding error message as text, like Error for a request that
+// wants neither JSON nor an error page.
+//
+// Deprecated: Use Error, which responds as the request wants.
 func RespondWithError(w http.ResponseWriter, code int) {
-	message := fmt.Sprintf("Error: %s", http.StatusText(code))
-	http.Error(w, message, code)
+	http.Error(w, Problem{Title: http.StatusText(code)}.String(), code)
 }
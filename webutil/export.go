@@ -0,0 +1,102 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bnixon67/webapp/csv"
+	"github.com/bnixon67/webapp/xlsx"
+)
+
+// ErrUnknownFormat means that an export was requested in a format without
+// an Exporter.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// DefaultExportFormat is the format of an export without a "format" query
+// parameter.
+const DefaultExportFormat = "csv"
+
+// Exporter writes a slice of structs in a format that can be downloaded.
+type Exporter interface {
+	ContentType() string
+	Export(w io.Writer, data any) error
+}
+
+// CSVExporter exports data as CSV, with the field names or `csv` tags as
+// headers.
+type CSVExporter struct{}
+
+func (CSVExporter) ContentType() string { return "text/csv" }
+
+func (CSVExporter) Export(w io.Writer, data any) error {
+	return csv.SliceOfStructsToCSV(w, data)
+}
+
+// JSONExporter exports data as a JSON array.
+type JSONExporter struct{}
+
+func (JSONExporter) ContentType() string { return "application/json" }
+
+func (JSONExporter) Export(w io.Writer, data any) error {
+	return json.NewEncoder(w).Encode(data)
+}
+
+// XLSXExporter exports data as an Excel workbook, with the same headers and
+// values as CSVExporter.
+type XLSXExporter struct{}
+
+func (XLSXExporter) ContentType() string { return xlsx.ContentType }
+
+func (XLSXExporter) Export(w io.Writer, data any) error {
+	return xlsx.SliceOfStructsToXLSX(w, data)
+}
+
+// exporters are the Exporters by format, which is also the file extension.
+var exporters = map[string]Exporter{
+	"csv":  CSVExporter{},
+	"json": JSONExporter{},
+	"xlsx": XLSXExporter{},
+}
+
+// RegisterExporter adds or replaces the Exporter of format, which is also
+// the extension of the exported file, for all exports. It is not safe for
+// concurrent use, so it should be called during initialization.
+func RegisterExporter(format string, e Exporter) {
+	exporters[format] = e
+}
+
+// Export responds with data exported in the format of the "format" query
+// parameter of r, or DefaultExportFormat, as an attachment named name with
+// the format as its extension. If an error is returned, Export has already
+// responded with an error.
+func Export(w http.ResponseWriter, r *http.Request, name string, data any) error {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = DefaultExportFormat
+	}
+
+	e, ok := exporters[format]
+	if !ok {
+		Error(w, r, http.StatusBadRequest, "", "")
+		return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+
+	// Export to a buffer, so a failure can still respond with an error.
+	var buf bytes.Buffer
+	if err := e.Export(&buf, data); err != nil {
+		Error(w, r, http.StatusInternalServerError, "", "")
+		return err
+	}
+
+	w.Header().Set("Content-Type", e.ContentType())
+	w.Header().Set("Content-Disposition", "attachment;filename="+name+"."+format)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
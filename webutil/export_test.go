@@ -0,0 +1,123 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+// tsvExporter is an Exporter added by a test.
+type tsvExporter struct{}
+
+func (tsvExporter) ContentType() string { return "text/tab-separated-values" }
+
+func (tsvExporter) Export(w io.Writer, data any) error {
+	_, err := io.WriteString(w, "ID\tName\n")
+	return err
+}
+
+func TestExport(t *testing.T) {
+	type row struct {
+		ID   int
+		Name string
+	}
+	data := []row{{1, "Alice"}}
+
+	webutil.RegisterExporter("tsv", tsvExporter{})
+
+	tests := []struct {
+		name            string
+		target          string
+		wantCode        int
+		wantType        string
+		wantDisposition string
+		wantBody        string
+		wantErr         error
+	}{
+		{
+			name:            "default",
+			target:          "/export",
+			wantCode:        http.StatusOK,
+			wantType:        "text/csv",
+			wantDisposition: "attachment;filename=rows.csv",
+			wantBody:        "ID,Name\n1,Alice\n",
+		},
+		{
+			name:            "json",
+			target:          "/export?format=json",
+			wantCode:        http.StatusOK,
+			wantType:        "application/json",
+			wantDisposition: "attachment;filename=rows.json",
+			wantBody:        "[{\"ID\":1,\"Name\":\"Alice\"}]\n",
+		},
+		{
+			name:            "xlsx",
+			target:          "/export?format=xlsx",
+			wantCode:        http.StatusOK,
+			wantType:        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			wantDisposition: "attachment;filename=rows.xlsx",
+		},
+		{
+			name:            "registered",
+			target:          "/export?format=tsv",
+			wantCode:        http.StatusOK,
+			wantType:        "text/tab-separated-values",
+			wantDisposition: "attachment;filename=rows.tsv",
+			wantBody:        "ID\tName\n",
+		},
+		{
+			name:     "unknown",
+			target:   "/export?format=pdf",
+			wantCode: http.StatusBadRequest,
+			wantType: "text/plain; charset=utf-8",
+			wantBody: "Error: Bad Request\n",
+			wantErr:  webutil.ErrUnknownFormat,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+
+			err := webutil.Export(w, r, "rows", data)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("Export() error = %v, want %v", err, tc.wantErr)
+			}
+			if w.Code != tc.wantCode {
+				t.Errorf("got code %d, want %d", w.Code, tc.wantCode)
+			}
+			if got := w.Header().Get("Content-Type"); got != tc.wantType {
+				t.Errorf("got Content-Type %q, want %q", got, tc.wantType)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != tc.wantDisposition {
+				t.Errorf("got Content-Disposition %q, want %q", got, tc.wantDisposition)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("got body %q, want %q", w.Body, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestExportFailed(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/export", nil)
+
+	if err := webutil.Export(w, r, "rows", 1); err == nil {
+		t.Error("Export() of non-slice did not fail")
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got code %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("got Content-Disposition %q, want none", got)
+	}
+}
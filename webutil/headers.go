@@ -5,7 +5,9 @@
 package webutil
 
 import (
+	"context"
 	"net/http"
+	"net/netip"
 )
 
 // SetHeaders applies headers to the HTTP response.
@@ -46,8 +48,28 @@ func SetContentTypeHTML(w http.ResponseWriter) {
 	SetContentType(w, "text/html;charset=utf-8")
 }
 
-// ClientIP retrieves the client's IP address, preferring the X-Real-IP header.
+// clientIPKey is the context key of the client IP.
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx with the IP of the client, such as
+// found by webhandler.RealIP.
+func WithClientIP(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the IP of the client set by WithClientIP.
+func ClientIPFromContext(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(netip.Addr)
+	return ip, ok
+}
+
+// ClientIP retrieves the client's IP address. The IP found by
+// webhandler.RealIP is used if set. Otherwise, the X-Real-IP header is
+// preferred to the address of the connection.
 func ClientIP(r *http.Request) string {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip.String()
+	}
 	if ip := r.Header.Get("X-Real-IP"); ip != "" {
 		return ip
 	}
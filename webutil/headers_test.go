@@ -6,6 +6,7 @@ package webutil_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
 
 	"github.com/bnixon67/webapp/webutil"
@@ -100,3 +101,22 @@ func TestClientIP(t *testing.T) {
 		})
 	}
 }
+
+func TestClientIPFromContext(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Real-IP", "192.168.1.1")
+
+	if _, ok := webutil.ClientIPFromContext(r.Context()); ok {
+		t.Error("ClientIPFromContext() found IP in empty context")
+	}
+
+	ip := netip.MustParseAddr("203.0.113.7")
+	r = r.WithContext(webutil.WithClientIP(r.Context(), ip))
+
+	if got, ok := webutil.ClientIPFromContext(r.Context()); !ok || got != ip {
+		t.Errorf("ClientIPFromContext() = %v, %v, want %v, true", got, ok, ip)
+	}
+	if got := webutil.ClientIP(r); got != ip.String() {
+		t.Errorf("ClientIP() = %q, want %q", got, ip)
+	}
+}
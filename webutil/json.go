@@ -0,0 +1,29 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// RespondWithJSON sends an HTTP response with the specified code and v
+// encoded as JSON.
+func RespondWithJSON(w http.ResponseWriter, code int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	return json.NewEncoder(w).Encode(v)
+}
+
+// WantsJSON returns true if the request asks for JSON, either with a
+// "format=json" query parameter or an Accept header of application/json.
+func WantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestRespondWithJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	err := webutil.RespondWithJSON(w, http.StatusCreated, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("RespondWithJSON() = %v", err)
+	}
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("got code %v, want %v", w.Code, http.StatusCreated)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q, want %q", got, "application/json")
+	}
+	if got, want := w.Body.String(), "{\"a\":1}\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   bool
+	}{
+		{"none", "/", "", false},
+		{"html", "/", "text/html", false},
+		{"accept", "/", "application/json", true},
+		{"query", "/?format=json", "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+
+			if got := webutil.WantsJSON(r); got != tc.want {
+				t.Errorf("WantsJSON() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
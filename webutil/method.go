@@ -16,7 +16,7 @@ import (
 // processing if false is returned.
 func IsMethodOrError(w http.ResponseWriter, r *http.Request, method string) bool {
 	if r.Method != method {
-		RespondWithError(w, http.StatusMethodNotAllowed)
+		Error(w, r, http.StatusMethodNotAllowed, "", "")
 		return false
 	}
 	return true
@@ -59,6 +59,19 @@ func TestIsMethodOrError(t *testing.T) {
 	}
 }
 
+func TestIsMethodOrErrorProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	if webutil.IsMethodOrError(w, r, http.MethodGet) {
+		t.Fatal("IsMethodOrError() = true, want false")
+	}
+	if got := w.Header().Get("Content-Type"); got != webutil.ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", got, webutil.ProblemContentType)
+	}
+}
+
 func TestCheckAllowedMethods(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -0,0 +1,109 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of a Problem, per RFC 7807.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the details of an error in an HTTP response, per RFC 7807.
+type Problem struct {
+	Type     string `json:"type"`               // Type is a URI of the kind of problem.
+	Title    string `json:"title"`              // Title is a summary of the kind of problem.
+	Status   int    `json:"status"`             // Status is the HTTP status code.
+	Detail   string `json:"detail,omitempty"`   // Detail explains this occurrence.
+	Instance string `json:"instance,omitempty"` // Instance is the path of the request.
+
+	// Code is a short, stable identifier of the error for clients, such
+	// as "invalid_token", an extension member of the problem.
+	Code string `json:"code,omitempty"`
+}
+
+// NewProblem returns the Problem for an error with status, code, and
+// detail in the response to r. Its Type is "about:blank", so its Title
+// is the text of status.
+func NewProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+// String returns the problem as text, with the detail on a second line.
+func (p Problem) String() string {
+	msg := fmt.Sprintf("Error: %s", p.Title)
+	if p.Detail != "" {
+		msg += "\n" + p.Detail
+	}
+
+	return msg
+}
+
+// WriteProblem sends p as application/problem+json.
+func WriteProblem(w http.ResponseWriter, p Problem) error {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	return json.NewEncoder(w).Encode(p)
+}
+
+// WantsProblem returns true if the request asks for an error as JSON,
+// either as WantsJSON does or with an Accept header of
+// application/problem+json.
+func WantsProblem(r *http.Request) bool {
+	return WantsJSON(r) || strings.Contains(r.Header.Get("Accept"), ProblemContentType)
+}
+
+// ErrorPage renders p as an HTML page with the status of p. If it returns
+// an error, it must not have written to w.
+type ErrorPage func(w http.ResponseWriter, r *http.Request, p Problem) error
+
+type errorPageKeyType struct{}
+
+var errorPageKey = errorPageKeyType{}
+
+// WithErrorPage returns a handler that calls next with page in the request
+// context, for Error to render the errors of browser requests.
+func WithErrorPage(next http.Handler, page ErrorPage) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), errorPageKey, page)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Error responds to r with an error of status, with code and detail for
+// the client. Requests that want JSON get a Problem as
+// application/problem+json. Others get the ErrorPage of WithErrorPage,
+// if any, or else the problem as text.
+//
+// Like http.Error, the caller should not write to w after Error.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	p := NewProblem(r, status, code, detail)
+
+	if WantsProblem(r) {
+		WriteProblem(w, p)
+		return
+	}
+
+	if page, ok := r.Context().Value(errorPageKey).(ErrorPage); ok && page != nil {
+		if err := page(w, r, p); err == nil {
+			return
+		}
+	}
+
+	http.Error(w, p.String(), status)
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestErrorProblem(t *testing.T) {
+	for _, accept := range []string{"application/json", webutil.ProblemContentType} {
+		t.Run(accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+			r.Header.Set("Accept", accept)
+			w := httptest.NewRecorder()
+
+			webutil.Error(w, r, http.StatusNotFound, "no_item", "No item 1.")
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+			if got := w.Header().Get("Content-Type"); got != webutil.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", got, webutil.ProblemContentType)
+			}
+
+			var got webutil.Problem
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode problem: %v", err)
+			}
+			want := webutil.Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "No item 1.", Instance: "/items/1", Code: "no_item"}
+			if got != want {
+				t.Errorf("problem = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestErrorPage(t *testing.T) {
+	page := func(w http.ResponseWriter, r *http.Request, p webutil.Problem) error {
+		if p.Code == "broken" {
+			return errors.New("broken page")
+		}
+		w.WriteHeader(p.Status)
+		fmt.Fprintf(w, "<h1>%s</h1>", p.Title)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		page     webutil.ErrorPage
+		code     string
+		wantBody string
+	}{
+		{"page", page, "", "<h1>Bad Request</h1>"},
+		{"no page", nil, "", "Error: Bad Request\nTry again.\n"},
+		{"page fails", page, "broken", "Error: Bad Request\nTry again.\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				webutil.Error(w, r, http.StatusBadRequest, tc.code, "Try again.")
+			})
+			if tc.page != nil {
+				h = webutil.WithErrorPage(h, tc.page)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if got := w.Body.String(); got != tc.wantBody {
+				t.Errorf("body = %q, want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"html/template"
+	"strconv"
+	"time"
+)
+
+// relativeUnits are the units of TimeAgo, largest first. Months and years
+// are approximate, which is enough for a humanized time.
+var relativeUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// TimeAgo returns t relative to now in the largest whole unit, such as
+// "5 minutes ago" or "in 2 days". Times within a minute of now are
+// "just now", and the zero time is "never".
+//
+// The strings match those of relative-time.js, which keeps them fresh.
+func TimeAgo(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	for _, unit := range relativeUnits {
+		n := int(d / unit.d)
+		if n < 1 {
+			continue
+		}
+
+		s := strconv.Itoa(n) + " " + unit.name
+		if n > 1 {
+			s += "s"
+		}
+		if future {
+			return "in " + s
+		}
+		return s + " ago"
+	}
+
+	return "just now"
+}
+
+// RelativeTime returns a time element with t relative to now, such as
+// "5 minutes ago", for templates. The data-timestamp attribute, in Unix
+// seconds, lets relative-time.js keep the text fresh, and the title shows
+// t in the default time zone. The zero time is "never".
+func (z *TimeZones) RelativeTime(t time.Time) template.HTML {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return template.HTML(`<time datetime="` + t.UTC().Format(time.RFC3339) +
+		`" data-timestamp="` + strconv.FormatInt(t.Unix(), 10) +
+		`" title="` + t.In(z.def).Format("2006-01-02 03:04 PM MST") + `">` +
+		TimeAgo(t, time.Now()) + `</time>`)
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestTimeAgo(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Time{}, "never"},
+		{now, "just now"},
+		{now.Add(-59 * time.Second), "just now"},
+		{now.Add(-time.Minute), "1 minute ago"},
+		{now.Add(-5*time.Minute - 30*time.Second), "5 minutes ago"},
+		{now.Add(-2 * time.Hour), "2 hours ago"},
+		{now.Add(-36 * time.Hour), "1 day ago"},
+		{now.Add(-45 * 24 * time.Hour), "1 month ago"},
+		{now.Add(-800 * 24 * time.Hour), "2 years ago"},
+		{now.Add(3 * 24 * time.Hour), "in 3 days"},
+	}
+
+	for _, tc := range tests {
+		if got := webutil.TimeAgo(tc.t, now); got != tc.want {
+			t.Errorf("TimeAgo(%v) = %q, want %q", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	tz, err := webutil.NewTimeZones("UTC", nil)
+	if err != nil {
+		t.Fatalf("NewTimeZones() failed: %v", err)
+	}
+
+	if got := tz.RelativeTime(time.Time{}); got != "never" {
+		t.Errorf("RelativeTime(zero) = %q, want %q", got, "never")
+	}
+
+	ts := time.Now().Add(-5*time.Minute - time.Second)
+	got := string(tz.RelativeTime(ts))
+	for _, want := range []string{
+		`data-timestamp="` + strconv.FormatInt(ts.Unix(), 10) + `"`,
+		`datetime="` + ts.UTC().Format(time.RFC3339) + `"`,
+		">5 minutes ago</time>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("RelativeTime() = %q, want %q in it", got, want)
+		}
+	}
+}
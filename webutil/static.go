@@ -0,0 +1,248 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprintLen is the number of hex characters of the content hash in a
+// fingerprinted file name.
+const fingerprintLen = 12
+
+// Cache-Control of static files. Fingerprinted files never change, since
+// new content has a new name, so they are cached for a year.
+const (
+	CacheImmutable  = "public, max-age=31536000, immutable"
+	CacheRevalidate = "no-cache"
+)
+
+// StaticHandler serves the files of an fs.FS, such as an embed.FS of
+// bundled assets or os.DirFS of a directory, by the path of the request
+// after its prefix. Directories are not listed.
+//
+// Files are served with a strong ETag of their content and with
+// Last-Modified, if known. Range requests return 206 (Partial Content),
+// or 416 (Range Not Satisfiable) if no range is in the file, and the
+// If-Match, If-None-Match, If-Modified-Since, If-Unmodified-Since, and
+// If-Range preconditions are checked. Methods other than GET and HEAD
+// return 405 (Method Not Allowed).
+//
+// A file can also be requested by its fingerprinted name from URL, such
+// as css/app.0123456789ab.css for css/app.css, which is cached by
+// browsers for a year, since a change to the file changes its URL. Other
+// names must be revalidated with the ETag.
+type StaticHandler struct {
+	fsys   fs.FS
+	prefix string
+	hashes sync.Map // hashes has a staticHash by name.
+}
+
+// staticHash is the hash of a file with a modification time and size.
+type staticHash struct {
+	modTime time.Time
+	size    int64
+	sum     []byte
+}
+
+// NewStaticHandler returns a StaticHandler that serves fsys at the URL
+// path prefix, such as "/static/". Requests must have the prefix, so use
+// it where the handler is registered with a ServeMux.
+func NewStaticHandler(fsys fs.FS, prefix string) *StaticHandler {
+	return &StaticHandler{fsys: fsys, prefix: prefix}
+}
+
+// ServeHTTP serves the file named by the path of r after the prefix.
+func (s *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlPath, prefix := path.Clean("/"+r.URL.Path), path.Clean("/"+s.prefix)
+	if prefix != "/" {
+		rest, ok := strings.CutPrefix(urlPath, prefix)
+		if !ok || (rest != "" && rest[0] != '/') {
+			http.NotFound(w, r)
+			return
+		}
+		urlPath = rest
+	}
+
+	name := strings.TrimPrefix(urlPath, "/")
+	if name == "" {
+		name = "."
+	}
+
+	s.serve(w, r, name)
+}
+
+// File returns a handler that serves the file name of the StaticHandler
+// for any request path, such as /favicon.ico for ico/favicon.ico.
+func (s *StaticHandler) File(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, name)
+	}
+}
+
+// serve serves the file name, or the file of the fingerprinted name,
+// for r.
+func (s *StaticHandler) serve(w http.ResponseWriter, r *http.Request, name string) {
+	if !CheckAllowedMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+
+	fingerprint := ""
+	f, fi, content, err := s.open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if original, fp, ok := splitFingerprint(name); ok {
+			name, fingerprint = original, fp
+			f, fi, content, err = s.open(name)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errIsDir) {
+			http.NotFound(w, r)
+		} else {
+			Error(w, r, http.StatusInternalServerError, "", "")
+		}
+		return
+	}
+	defer f.Close()
+
+	sum, err := s.sum(name, fi, content)
+	if err != nil {
+		Error(w, r, http.StatusInternalServerError, "", "")
+		return
+	}
+	w.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+
+	// An old fingerprint gets the current file, which is not immutable
+	// at that URL.
+	if fingerprint != "" && fingerprint == fingerprintOf(sum) {
+		w.Header().Set("Cache-Control", CacheImmutable)
+	} else {
+		w.Header().Set("Cache-Control", CacheRevalidate)
+	}
+
+	// ServeContent handles Range, HEAD, and the preconditions.
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+}
+
+// errIsDir is returned by open for a directory.
+var errIsDir = errors.New("is a directory")
+
+// open opens the file name and returns it, to be closed, with its info
+// and content.
+func (s *StaticHandler) open(name string) (fs.File, fs.FileInfo, io.ReadSeeker, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		err = errIsDir
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, nil, err
+		}
+		content = bytes.NewReader(b)
+	}
+
+	return f, fi, content, nil
+}
+
+// sum returns the SHA-256 of the content of the file named name with fi,
+// hashing content if it changed since last hashed. The offset of content
+// is left at the start.
+func (s *StaticHandler) sum(name string, fi fs.FileInfo, content io.ReadSeeker) ([]byte, error) {
+	if v, ok := s.hashes.Load(name); ok {
+		h := v.(staticHash)
+		if h.modTime.Equal(fi.ModTime()) && h.size == fi.Size() {
+			return h.sum, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	sum := h.Sum(nil)
+	s.hashes.Store(name, staticHash{modTime: fi.ModTime(), size: fi.Size(), sum: sum})
+
+	return sum, nil
+}
+
+// URL returns the fingerprinted URL of the file name, such as
+// "/static/css/app.0123456789ab.css" for "css/app.css", which changes
+// when the content of the file does.
+func (s *StaticHandler) URL(name string) (string, error) {
+	f, fi, content, err := s.open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sum, err := s.sum(name, fi, content)
+	if err != nil {
+		return "", err
+	}
+
+	dir, file := path.Split(name)
+	ext := path.Ext(file)
+	fingerprinted := strings.TrimSuffix(file, ext) + "." + fingerprintOf(sum) + ext
+
+	return path.Join("/", s.prefix, dir, fingerprinted), nil
+}
+
+// FuncMap returns the AssetURL template function, which returns the URL
+// of an asset, e.g., {{AssetURL "css/app.css"}}.
+func (s *StaticHandler) FuncMap() template.FuncMap {
+	return template.FuncMap{"AssetURL": s.URL}
+}
+
+// fingerprintOf returns the fingerprint of a file with the hash sum.
+func fingerprintOf(sum []byte) string {
+	return hex.EncodeToString(sum)[:fingerprintLen]
+}
+
+// splitFingerprint returns the name without the fingerprint of name and
+// the fingerprint, or false if name is not fingerprinted.
+func splitFingerprint(name string) (string, string, bool) {
+	dir, file := path.Split(name)
+	ext := path.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+
+	i := strings.LastIndexByte(base, '.')
+	if i < 0 || len(base)-i-1 != fingerprintLen {
+		return "", "", false
+	}
+	fingerprint := base[i+1:]
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return "", "", false
+	}
+
+	return dir + base[:i] + ext, fingerprint, true
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestStaticHandler(t *testing.T) {
+	fsys := fstest.MapFS{"css/app.css": {Data: []byte("body{}")}}
+	s := webutil.NewStaticHandler(fsys, "/static/")
+
+	url, err := s.URL("css/app.css")
+	if err != nil {
+		t.Fatalf("URL() failed: %v", err)
+	}
+	if !regexp.MustCompile(`^/static/css/app\.[0-9a-f]{12}\.css$`).MatchString(url) {
+		t.Fatalf("URL() = %q, want fingerprinted path under /static/", url)
+	}
+	stale := url[:len("/static/css/app.")] + "000000000000.css"
+
+	get := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	etag := get(http.MethodGet, "/static/css/app.css", nil).Header().Get("ETag")
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		header    map[string]string
+		wantCode  int
+		wantBody  string
+		wantCache string
+	}{
+		{"name", http.MethodGet, "/static/css/app.css", nil, http.StatusOK, "body{}", webutil.CacheRevalidate},
+		{"fingerprint", http.MethodGet, url, nil, http.StatusOK, "body{}", webutil.CacheImmutable},
+		{"stale fingerprint", http.MethodGet, stale, nil, http.StatusOK, "body{}", webutil.CacheRevalidate},
+		{"not modified", http.MethodGet, "/static/css/app.css", map[string]string{"If-None-Match": etag}, http.StatusNotModified, "", webutil.CacheRevalidate},
+		{"missing", http.MethodGet, "/static/css/other.css", nil, http.StatusNotFound, "404 page not found\n", ""},
+		{"directory", http.MethodGet, "/static/css", nil, http.StatusNotFound, "404 page not found\n", ""},
+		{"other prefix", http.MethodGet, "/staticx/css/app.css", nil, http.StatusNotFound, "404 page not found\n", ""},
+		{"method", http.MethodPost, "/static/css/app.css", nil, http.StatusMethodNotAllowed, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := get(tc.method, tc.target, tc.header)
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tc.wantBody)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tc.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tc.wantCache)
+			}
+		})
+	}
+
+	fsys["css/app.css"] = &fstest.MapFile{Data: []byte("body{color:red}")}
+	if changed, _ := s.URL("css/app.css"); changed == url {
+		t.Errorf("URL() = %q after change, want a new fingerprint", changed)
+	}
+	if _, err := s.URL("css/missing.css"); err == nil {
+		t.Error("URL() of missing file succeeded")
+	}
+	if !strings.Contains(get(http.MethodGet, url, nil).Header().Get("Cache-Control"), "no-cache") {
+		t.Error("old fingerprint is immutable after change")
+	}
+}
@@ -8,8 +8,13 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -33,11 +38,102 @@ func Templates(pattern string) (*template.Template, error) {
 // TemplatesWithFuncs parses templates from files matching the given pattern
 // and applies a FuncMap.
 func TemplatesWithFuncs(pattern string, funcMap template.FuncMap) (*template.Template, error) {
-	tmpls, err := template.New("tmpl").Funcs(funcMap).ParseGlob(pattern)
+	return TemplatesWithDelims(pattern, funcMap, "", "")
+}
+
+// TemplatesWithDelims parses templates like TemplatesWithFuncs, with left
+// and right as the delimiters of actions, so that the templates can have
+// the {{ }} syntax of client-side frameworks such as Vue or Angular. Empty
+// delimiters are the defaults, {{ and }}.
+//
+// Templates can also use the raw function, e.g., {{raw "{{ count }}"}}, or
+// a raw zone between the actions raw and endraw, e.g.,
+//
+//	{{raw}}<p v-if="seen">{{ message }}</p>{{endraw}}
+//
+// whose text is output as written, without being parsed. Raw zones are
+// trusted HTML, like the rest of the template, so data must not be added
+// to them.
+//
+// A page can extend a layout, a template with the markup shared by pages,
+// such as the head, header, and footer, and named blocks that pages fill
+// in. The first action of the page is extends, with the name of the
+// layout, and the page defines the blocks, e.g.,
+//
+//	{{extends "layout.html"}}
+//	{{define "content"}}<p>Hello, {{.Name}}</p>{{end}}
+//
+// The page is executed by its name like other templates, with its data
+// passed to the layout, so the layout can use the fields that all page
+// data share. Each page is parsed with a copy of the other templates, so
+// pages can define the same blocks.
+func TemplatesWithDelims(pattern string, funcMap template.FuncMap, left, right string) (*template.Template, error) {
+	filenames, err := filepath.Glob(pattern)
 	if err != nil {
 		return nil, err
 	}
 
+	return parseTemplates(filenames, os.ReadFile, pattern, funcMap, left, right)
+}
+
+// TemplatesFS parses templates like TemplatesWithDelims, from the files
+// of fsys matching pattern, such as an embed.FS of the templates bundled
+// with a binary. The pattern has the syntax of fs.Glob, e.g.,
+// "tmpl/*.html".
+func TemplatesFS(fsys fs.FS, pattern string, funcMap template.FuncMap, left, right string) (*template.Template, error) {
+	filenames, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	readFile := func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	}
+
+	return parseTemplates(filenames, readFile, pattern, funcMap, left, right)
+}
+
+// parseTemplates parses the files of filenames, which matched pattern,
+// read with readFile. Each template is named for the base of its file.
+func parseTemplates(filenames []string, readFile func(string) ([]byte, error), pattern string, funcMap template.FuncMap, left, right string) (*template.Template, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("%w: %#q", ErrNoTemplates, pattern)
+	}
+
+	// pages are the templates of the pages that extend a layout, by name.
+	pages := make(map[string]*template.Template)
+
+	tmpls := template.New("tmpl").Delims(left, right).
+		Funcs(template.FuncMap{"raw": raw, rawZoneFunc: rawZone, layoutFunc: executePage(pages)}).
+		Funcs(funcMap)
+
+	var extending []page
+	for _, filename := range filenames {
+		b, err := readFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		text, err := replaceRawZones(string(b), left, right)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		name := path.Base(filepath.ToSlash(filename))
+		if layout, rest, ok := cutExtends(text, left, right); ok {
+			extending = append(extending, page{name: name, layout: layout, text: rest})
+			continue
+		}
+
+		if _, err := tmpls.New(name).Parse(text); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parsePages(tmpls, pages, extending, left, right); err != nil {
+		return nil, err
+	}
+
 	if slog.Default().Enabled(nil, slog.LevelDebug) {
 		tmplNames := strings.Join(TemplateNames(tmpls), ", ")
 		slog.Debug("parsed templates with functions",
@@ -50,11 +146,152 @@ func TemplatesWithFuncs(pattern string, funcMap template.FuncMap) (*template.Tem
 	return tmpls, nil
 }
 
+var (
+	ErrNoTemplates     = errors.New("pattern matches no template files")
+	ErrUnclosedRawZone = errors.New("raw zone without endraw")
+	ErrNoLayout        = errors.New("page extends a missing layout")
+)
+
+// layoutFunc is the name of the function that executes a page in its
+// layout.
+const layoutFunc = "_layout"
+
+// page is a template that extends a layout.
+type page struct {
+	name   string
+	layout string
+	text   string // text of the page without the extends action.
+}
+
+// cutExtends returns the layout that text extends, with its first action
+// of extends removed, or false if it does not extend a layout.
+func cutExtends(text, left, right string) (layout, rest string, ok bool) {
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+
+	after, found := strings.CutPrefix(strings.TrimLeft(text, " \t\r\n"), left+"extends ")
+	if !found {
+		return "", "", false
+	}
+	quoted, rest, found := strings.Cut(after, right)
+	if !found {
+		return "", "", false
+	}
+	layout, err := strconv.Unquote(strings.TrimSpace(quoted))
+	if err != nil {
+		return "", "", false
+	}
+
+	return layout, rest, true
+}
+
+// parsePages parses each of extending in a clone of tmpls, which has the
+// layouts, into pages, and adds a template to tmpls for each that executes
+// it with layoutFunc.
+func parsePages(tmpls *template.Template, pages map[string]*template.Template, extending []page, left, right string) error {
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+
+	// Clone before adding pages to tmpls, which cannot be cloned once
+	// they are executed, and so a page cannot extend another.
+	for _, p := range extending {
+		if tmpls.Lookup(p.layout) == nil {
+			return fmt.Errorf("%s: %w %q", p.name, ErrNoLayout, p.layout)
+		}
+
+		clone, err := tmpls.Clone()
+		if err != nil {
+			return err
+		}
+		text := left + "template " + strconv.Quote(p.layout) + " ." + right + p.text
+		if _, err := clone.New(p.name).Parse(text); err != nil {
+			return err
+		}
+		pages[p.name] = clone
+	}
+
+	for _, p := range extending {
+		text := left + layoutFunc + " " + strconv.Quote(p.name) + " ." + right
+		if _, err := tmpls.New(p.name).Parse(text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executePage returns the layoutFunc function, which executes the page
+// name of pages with data. The page was escaped when executed, so it is
+// returned as trusted HTML.
+func executePage(pages map[string]*template.Template) func(name string, data any) (template.HTML, error) {
+	return func(name string, data any) (template.HTML, error) {
+		var b bytes.Buffer
+		if err := pages[name].ExecuteTemplate(&b, name, data); err != nil {
+			return "", err
+		}
+
+		return template.HTML(b.String()), nil
+	}
+}
+
+// rawZoneFunc is the name of the function that outputs a raw zone.
+const rawZoneFunc = "_rawZone"
+
+// raw returns s, for templates to output text with the delimiters of
+// actions.
+func raw(s string) string {
+	return s
+}
+
+// rawZone returns the text of a raw zone, which is part of a template, so
+// it is trusted HTML.
+func rawZone(s string) template.HTML {
+	return template.HTML(s)
+}
+
+// replaceRawZones returns text with each raw zone replaced by an action
+// that outputs its text, using the delimiters left and right.
+func replaceRawZones(text, left, right string) (string, error) {
+	if left == "" {
+		left = "{{"
+	}
+	if right == "" {
+		right = "}}"
+	}
+	start, end := left+"raw"+right, left+"endraw"+right
+
+	var b strings.Builder
+	for {
+		before, after, found := strings.Cut(text, start)
+		b.WriteString(before)
+		if !found {
+			return b.String(), nil
+		}
+
+		zone, rest, found := strings.Cut(after, end)
+		if !found {
+			return "", ErrUnclosedRawZone
+		}
+
+		b.WriteString(left + rawZoneFunc + " " + strconv.Quote(zone) + right)
+		text = rest
+	}
+}
+
 const MsgTemplateError = "The server is unable to display this page."
 
 // RenderTemplateOrError attempts to render a named template with data,
 // handling errors by responding with HTTP 500.  The caller must ensure no
-// further writes are done for a non-nil error.
+// further writes are done for a non-nil error. A page that extends a
+// layout is rendered in the layout, which is given data.
 func RenderTemplateOrError(tmpl *template.Template, w http.ResponseWriter, name string, data interface{}) error {
 	if tmpl == nil {
 		http.Error(w, MsgTemplateError, http.StatusInternalServerError)
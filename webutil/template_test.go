@@ -4,9 +4,13 @@
 package webutil_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"testing"
+	"testing/fstest"
 
 	"github.com/bnixon67/webapp/webutil"
 )
@@ -51,3 +55,130 @@ func TestTemplates(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplatesWithDelims(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		left, right string
+		want        string
+		wantErr     error
+	}{
+		{
+			name: "default",
+			text: `<p>{{.}}</p>`,
+			want: `<p>&lt;b&gt;</p>`,
+		},
+		{
+			name: "custom",
+			text: `<p>[[.]] {{ message }}</p>`,
+			left: "[[", right: "]]",
+			want: `<p>&lt;b&gt; {{ message }}</p>`,
+		},
+		{
+			name: "rawFunc",
+			text: `<p>{{.}} {{raw "{{ count }}"}}</p>`,
+			want: `<p>&lt;b&gt; {{ count }}</p>`,
+		},
+		{
+			name: "rawZone",
+			text: "{{.}}{{raw}}<p v-if=\"seen\">{{ message }}\n</p>{{endraw}}{{raw}}{{ x }}{{endraw}}",
+			want: "&lt;b&gt;<p v-if=\"seen\">{{ message }}\n</p>{{ x }}",
+		},
+		{
+			name: "rawZoneCustom",
+			text: `[[.]][[raw]]<p>[[ message ]]</p>[[endraw]]`,
+			left: "[[", right: "]]",
+			want: `&lt;b&gt;<p>[[ message ]]</p>`,
+		},
+		{
+			name:    "unclosed",
+			text:    `{{raw}}<p>{{ message }}</p>`,
+			wantErr: webutil.ErrUnclosedRawZone,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(tc.text), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			tmpl, err := webutil.TemplatesWithDelims(filepath.Join(dir, "*.html"), nil, tc.left, tc.right)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("TemplatesWithDelims() error = %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got := webutil.RenderTemplateForTest(t, tmpl, "page.html", "<b>")
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	_, err := webutil.TemplatesWithDelims(filepath.Join(t.TempDir(), "*.html"), nil, "", "")
+	if !errors.Is(err, webutil.ErrNoTemplates) {
+		t.Errorf("TemplatesWithDelims() of no files = %v, want %v", err, webutil.ErrNoTemplates)
+	}
+}
+
+func TestTemplatesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tmpl/page.html":  {Data: []byte(`<p>[[.]] {{ message }}</p>`)},
+		"tmpl/other.txt":  {Data: []byte(`not a template`)},
+		"other/page.html": {Data: []byte(`other`)},
+	}
+
+	tmpl, err := webutil.TemplatesFS(fsys, "tmpl/*.html", nil, "[[", "]]")
+	if err != nil {
+		t.Fatalf("TemplatesFS() failed: %v", err)
+	}
+
+	if names := webutil.TemplateNames(tmpl); len(names) != 2 || !slices.Contains(names, "page.html") {
+		t.Errorf("TemplateNames() = %q, want tmpl and page.html", names)
+	}
+	if got, want := webutil.RenderTemplateForTest(t, tmpl, "page.html", "<b>"), `<p>&lt;b&gt; {{ message }}</p>`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := webutil.TemplatesFS(fsys, "missing/*.html", nil, "", ""); !errors.Is(err, webutil.ErrNoTemplates) {
+		t.Errorf("TemplatesFS() error = %v, want %v", err, webutil.ErrNoTemplates)
+	}
+}
+
+func TestTemplatesLayout(t *testing.T) {
+	fsys := fstest.MapFS{
+		"tmpl/layout.html": {Data: []byte(`<title>{{block "title" .}}{{.Title}}{{end}}</title><main>{{block "content" .}}{{end}}</main>`)},
+		"tmpl/home.html":   {Data: []byte("\n{{extends \"layout.html\"}}\n{{define \"content\"}}<p>{{.Name}}</p>{{end}}")},
+		"tmpl/about.html":  {Data: []byte(`{{extends "layout.html"}}{{define "title"}}About {{.Title}}{{end}}{{define "content"}}<a href="/?q={{.Name}}">x</a>{{end}}`)},
+	}
+	data := struct{ Title, Name string }{"App", "<b>"}
+
+	tmpl, err := webutil.TemplatesFS(fsys, "tmpl/*.html", nil, "", "")
+	if err != nil {
+		t.Fatalf("TemplatesFS() failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"home.html", "<title>App</title><main><p>&lt;b&gt;</p></main>\n"},
+		{"about.html", `<title>About App</title><main><a href="/?q=%3cb%3e">x</a></main>`},
+		{"layout.html", "<title>App</title><main></main>"},
+	}
+	for _, tc := range tests {
+		if got := webutil.RenderTemplateForTest(t, tmpl, tc.name, data); got != tc.want {
+			t.Errorf("%s = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	fsys["tmpl/broken.html"] = &fstest.MapFile{Data: []byte(`{{extends "missing.html"}}`)}
+	if _, err := webutil.TemplatesFS(fsys, "tmpl/*.html", nil, "", ""); !errors.Is(err, webutil.ErrNoLayout) {
+		t.Errorf("TemplatesFS() error = %v, want %v", err, webutil.ErrNoLayout)
+	}
+}
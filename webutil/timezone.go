@@ -0,0 +1,147 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultTimeZone is the time zone of pages if none is configured.
+const DefaultTimeZone = "America/Chicago"
+
+var ErrUnknownTimeZone = errors.New("unknown time zone")
+
+// LoadTimeZone returns the location of the IANA time zone name, such as
+// "America/New_York" or "UTC". Unlike time.LoadLocation, an empty name and
+// "Local" are rejected, since their meaning depends on the host.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTimeZone, name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrUnknownTimeZone, name, err)
+	}
+
+	return loc, nil
+}
+
+// TimeZones converts times for pages to a default time zone or to one of
+// a list of trusted time zones. It is safe for concurrent use.
+//
+// Time zones are loaded from the host tzdata. Build with -tags tzdata to
+// embed the time zone database in hosts without it.
+type TimeZones struct {
+	def     *time.Location
+	trusted map[string]*time.Location // trusted is nil if any zone is allowed.
+
+	mu     sync.Mutex
+	loaded map[string]*time.Location // loaded caches zones if any is allowed.
+	warned map[string]bool           // warned records zones already logged.
+}
+
+// NewTimeZones returns TimeZones with the default time zone def, or
+// DefaultTimeZone if def is empty. If trusted is not empty, only those
+// time zones and def may be used. An error is returned if a time zone
+// cannot be loaded.
+func NewTimeZones(def string, trusted []string) (*TimeZones, error) {
+	if def == "" {
+		def = DefaultTimeZone
+	}
+
+	loc, err := LoadTimeZone(def)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &TimeZones{
+		def:    loc,
+		loaded: make(map[string]*time.Location),
+		warned: make(map[string]bool),
+	}
+
+	if len(trusted) > 0 {
+		z.trusted = map[string]*time.Location{def: loc}
+		for _, name := range trusted {
+			loc, err := LoadTimeZone(name)
+			if err != nil {
+				return nil, err
+			}
+			z.trusted[name] = loc
+		}
+	}
+
+	return z, nil
+}
+
+// Default returns the default time zone.
+func (z *TimeZones) Default() *time.Location {
+	return z.def
+}
+
+// Location returns the time zone name. The default time zone is returned,
+// and the problem is logged once, if name is unknown or not trusted, so
+// that a page is still shown. An empty name is the default time zone.
+func (z *TimeZones) Location(name string) *time.Location {
+	if name == "" {
+		return z.def
+	}
+
+	if z.trusted != nil {
+		if loc, ok := z.trusted[name]; ok {
+			return loc
+		}
+		z.warnOnce(name, "untrusted time zone", nil)
+		return z.def
+	}
+
+	z.mu.Lock()
+	loc, ok := z.loaded[name]
+	z.mu.Unlock()
+	if ok {
+		return loc
+	}
+
+	loc, err := LoadTimeZone(name)
+	if err != nil {
+		z.warnOnce(name, "unknown time zone", err)
+		return z.def
+	}
+
+	z.mu.Lock()
+	z.loaded[name] = loc
+	z.mu.Unlock()
+
+	return loc
+}
+
+// warnOnce logs msg for the time zone name the first time it is seen.
+func (z *TimeZones) warnOnce(name, msg string, err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.warned[name] {
+		return
+	}
+	z.warned[name] = true
+
+	slog.Warn(msg, "zone", name, "default", z.def.String(), "err", err)
+}
+
+// ToTimeZone returns t in the time zone name, or in the default time zone
+// if name is unknown or not trusted. It is meant for templates, which
+// fail on errors.
+func (z *TimeZones) ToTimeZone(t time.Time, name string) time.Time {
+	return t.In(z.Location(name))
+}
+
+// LocalTime returns t in the default time zone.
+func (z *TimeZones) LocalTime(t time.Time) time.Time {
+	return t.In(z.def)
+}
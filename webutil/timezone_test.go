@@ -0,0 +1,90 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package webutil_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bnixon67/webapp/webutil"
+)
+
+func TestLoadTimeZone(t *testing.T) {
+	for _, name := range []string{"", "Local", "Mars/Phobos"} {
+		if _, err := webutil.LoadTimeZone(name); !errors.Is(err, webutil.ErrUnknownTimeZone) {
+			t.Errorf("LoadTimeZone(%q) error = %v, want %v", name, err, webutil.ErrUnknownTimeZone)
+		}
+	}
+
+	if loc, err := webutil.LoadTimeZone("UTC"); err != nil || loc != time.UTC {
+		t.Errorf("LoadTimeZone(UTC) = %v, %v, want UTC", loc, err)
+	}
+}
+
+func TestNewTimeZones(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     string
+		trusted []string
+		wantDef string
+		wantErr error
+	}{
+		{name: "default", wantDef: webutil.DefaultTimeZone},
+		{name: "configured", def: "Asia/Kolkata", wantDef: "Asia/Kolkata"},
+		{name: "unknownDefault", def: "Mars/Phobos", wantErr: webutil.ErrUnknownTimeZone},
+		{name: "unknownTrusted", trusted: []string{"UTC", "Mars/Phobos"}, wantErr: webutil.ErrUnknownTimeZone},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tz, err := webutil.NewTimeZones(tc.def, tc.trusted)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("NewTimeZones() error = %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && tz.Default().String() != tc.wantDef {
+				t.Errorf("Default() = %v, want %v", tz.Default(), tc.wantDef)
+			}
+		})
+	}
+}
+
+func TestTimeZonesToTimeZone(t *testing.T) {
+	base := time.Date(2023, time.April, 10, 12, 0, 0, 0, time.UTC)
+
+	any, err := webutil.NewTimeZones("UTC", nil)
+	if err != nil {
+		t.Fatalf("NewTimeZones() failed: %v", err)
+	}
+	trusted, err := webutil.NewTimeZones("UTC", []string{"Asia/Kolkata"})
+	if err != nil {
+		t.Fatalf("NewTimeZones() failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tz     *webutil.TimeZones
+		zone   string
+		offset int
+	}{
+		{name: "anyZone", tz: any, zone: "America/Los_Angeles", offset: -7 * 3600},
+		{name: "unknownIsDefault", tz: any, zone: "Mars/Phobos", offset: 0},
+		{name: "emptyIsDefault", tz: any, zone: "", offset: 0},
+		{name: "trusted", tz: trusted, zone: "Asia/Kolkata", offset: 5*3600 + 1800},
+		{name: "untrustedIsDefault", tz: trusted, zone: "America/Los_Angeles", offset: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.tz.ToTimeZone(base, tc.zone)
+			if _, offset := got.Zone(); offset != tc.offset || !got.Equal(base) {
+				t.Errorf("ToTimeZone(%q) = %v, want offset %d", tc.zone, got, tc.offset)
+			}
+		})
+	}
+
+	if got := trusted.LocalTime(base); got.Location() != time.UTC {
+		t.Errorf("LocalTime() = %v, want UTC", got)
+	}
+}
@@ -10,9 +10,11 @@ import (
 )
 
 // ToTimeZone returns time adjusted to the given timezone.
-// If tzName is invalid, then the zero time value is returned.
+// If tzName is invalid, then the zero time value and an error wrapping
+// ErrUnknownTimeZone are returned. Templates should use
+// TimeZones.ToTimeZone instead, which does not fail.
 func ToTimeZone(t time.Time, tzName string) (time.Time, error) {
-	loc, err := time.LoadLocation(tzName)
+	loc, err := LoadTimeZone(tzName)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -25,3 +27,25 @@ func ToTimeZone(t time.Time, tzName string) (time.Time, error) {
 func Join(elems []string, sep string) template.HTML {
 	return template.HTML(strings.Join(elems, sep))
 }
+
+// CSRFFieldName is the name of the form field with the CSRF token.
+const CSRFFieldName = "csrf_token"
+
+// CSRFField returns a hidden form field with the CSRF token, which must be
+// included in forms that are not submitted with a GET.
+func CSRFField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CSRFFieldName +
+		`" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// NonceAttr returns the nonce attribute of an inline script or style for
+// the Content-Security-Policy nonce, such as in
+// <script {{NonceAttr .CSPNonce}}>. If nonce is empty, no attribute is
+// returned.
+func NonceAttr(nonce string) template.HTMLAttr {
+	if nonce == "" {
+		return ""
+	}
+
+	return template.HTMLAttr(`nonce="` + template.HTMLEscapeString(nonce) + `"`)
+}
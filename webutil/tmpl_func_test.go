@@ -110,3 +110,37 @@ func TestJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestCSRFField(t *testing.T) {
+	tests := []struct {
+		token string
+		want  template.HTML
+	}{
+		{"abc", `<input type="hidden" name="csrf_token" value="abc">`},
+		{"", `<input type="hidden" name="csrf_token" value="">`},
+		{`"><x`, `<input type="hidden" name="csrf_token" value="&#34;&gt;&lt;x">`},
+	}
+
+	for _, tc := range tests {
+		if got := webutil.CSRFField(tc.token); got != tc.want {
+			t.Errorf("CSRFField(%q) = %q, want %q", tc.token, got, tc.want)
+		}
+	}
+}
+
+func TestNonceAttr(t *testing.T) {
+	tests := []struct {
+		nonce string
+		want  template.HTMLAttr
+	}{
+		{"abc+/=", `nonce="abc+/="`},
+		{"", ""},
+		{`"><x`, `nonce="&#34;&gt;&lt;x"`},
+	}
+
+	for _, tc := range tests {
+		if got := webutil.NonceAttr(tc.nonce); got != tc.want {
+			t.Errorf("NonceAttr(%q) = %q, want %q", tc.nonce, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+//go:build tzdata
+
+package webutil
+
+// Embed the time zone database, about 450 KB, so that TimeZones work on
+// hosts without tzdata, such as scratch containers.
+import _ "time/tzdata"
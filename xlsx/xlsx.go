@@ -0,0 +1,127 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+// Package xlsx writes records as an Excel (Office Open XML) workbook with a
+// single worksheet. Every cell is written as text, like CSV.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bnixon67/webapp/csv"
+)
+
+var ErrXLSXWriteFailed = errors.New("failed to write")
+
+// ContentType is the media type of an Excel workbook.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// SliceOfStructsToXLSX writes a slice of structs to w as a workbook, with
+// the same headers and values as csv.SliceOfStructsToCSV.
+func SliceOfStructsToXLSX(w io.Writer, data interface{}) error {
+	records, err := csv.Records(data)
+	if err != nil {
+		return err
+	}
+
+	return Write(w, records)
+}
+
+// The parts of the workbook other than the worksheet, which do not change.
+var parts = []struct{ name, content string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// Write writes records to w as a workbook, one row per record.
+func Write(w io.Writer, records [][]string) error {
+	zw := zip.NewWriter(w)
+
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrXLSXWriteFailed, err)
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return fmt.Errorf("%w: %v", ErrXLSXWriteFailed, err)
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrXLSXWriteFailed, err)
+	}
+	if err := writeSheet(f, records); err != nil {
+		return fmt.Errorf("%w: %v", ErrXLSXWriteFailed, err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrXLSXWriteFailed, err)
+	}
+
+	return nil
+}
+
+// writeSheet writes the worksheet of records, with each value as an
+// inline string.
+func writeSheet(w io.Writer, records [][]string) error {
+	ew := &errWriter{w: w}
+
+	ew.write(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, record := range records {
+		row := strconv.Itoa(i + 1)
+		ew.write(`<row r="` + row + `">`)
+		for j, value := range record {
+			ew.write(`<c r="` + Column(j) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+			if ew.err == nil {
+				ew.err = xml.EscapeText(w, []byte(value))
+			}
+			ew.write(`</t></is></c>`)
+		}
+		ew.write(`</row>`)
+	}
+	ew.write(`</sheetData></worksheet>`)
+
+	return ew.err
+}
+
+// errWriter keeps the first error of a sequence of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) write(s string) {
+	if ew.err == nil {
+		_, ew.err = io.WriteString(ew.w, s)
+	}
+}
+
+// Column returns the letters of the zero-based column n, such as "A" for 0
+// and "AA" for 26.
+func Column(n int) string {
+	var b []byte
+	for n >= 0 {
+		b = append([]byte{byte('A' + n%26)}, b...)
+		n = n/26 - 1
+	}
+	return string(b)
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Bill Nixon. All rights reserved.
+// Use of this source code is governed by the license found in the LICENSE file.
+
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bnixon67/webapp/csv"
+	"github.com/bnixon67/webapp/xlsx"
+)
+
+// readPart returns the content of the part named name of the workbook b.
+func readPart(t *testing.T, b []byte, name string) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() failed: %v", err)
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("Open(%q) failed: %v", name, err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll(%q) failed: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestSliceOfStructsToXLSX(t *testing.T) {
+	type User struct {
+		ID   int
+		Name string `csv:"Full Name"`
+	}
+
+	var buf bytes.Buffer
+	err := xlsx.SliceOfStructsToXLSX(&buf, []User{{1, "Alice"}, {2, "Bob & <Co>"}})
+	if err != nil {
+		t.Fatalf("SliceOfStructsToXLSX() error = %v", err)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		readPart(t, buf.Bytes(), name)
+	}
+
+	sheet := readPart(t, buf.Bytes(), "xl/worksheets/sheet1.xml")
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">ID</t></is></c>`,
+		`<c r="B1" t="inlineStr"><is><t xml:space="preserve">Full Name</t></is></c>`,
+		`<c r="A3" t="inlineStr"><is><t xml:space="preserve">2</t></is></c>`,
+		`<t xml:space="preserve">Bob &amp; &lt;Co&gt;</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet %q does not contain %q", sheet, want)
+		}
+	}
+
+	if err := xlsx.SliceOfStructsToXLSX(&buf, []int{1}); !errors.Is(err, csv.ErrCSVNotSliceOfStructs) {
+		t.Errorf("SliceOfStructsToXLSX() error = %v, want %v", err, csv.ErrCSVNotSliceOfStructs)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, tc := range tests {
+		if got := xlsx.Column(tc.n); got != tc.want {
+			t.Errorf("Column(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}